@@ -0,0 +1,117 @@
+package bond
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ArtifactClass is a kind of file on MongoDB's download servers. A
+// Config can route each class to its own mirror.
+type ArtifactClass string
+
+// The classes of artifacts.
+const (
+	// FeedArtifacts are the feeds of releases (e.g. full.json).
+	FeedArtifacts ArtifactClass = "feed"
+	// ServerArtifacts are the archives of server builds.
+	ServerArtifacts ArtifactClass = "server"
+	// DebugSymbolArtifacts are the archives of server builds'
+	// debug symbols.
+	DebugSymbolArtifacts ArtifactClass = "debug"
+	// ToolsArtifacts are the archives of the database tools.
+	ToolsArtifacts ArtifactClass = "tools"
+	// ShellArtifacts are the archives of mongosh.
+	ShellArtifacts ArtifactClass = "shell"
+)
+
+// ArtifactClasses lists the classes of artifacts.
+var ArtifactClasses = []ArtifactClass{FeedArtifacts, ServerArtifacts, DebugSymbolArtifacts, ToolsArtifacts, ShellArtifacts}
+
+// Validate returns an error if the class is not known.
+func (c ArtifactClass) Validate() error {
+	for _, class := range ArtifactClasses {
+		if c == class {
+			return nil
+		}
+	}
+
+	return errors.Errorf("'%s' is not a valid artifact class", c)
+}
+
+// ClassifyURL returns the class of the file at the URL, from its
+// path. Files that are not feeds, debug symbols, tools, or shells are
+// ServerArtifacts.
+func ClassifyURL(addr string) ArtifactClass {
+	path := addr
+	if parsed, err := url.Parse(addr); err == nil {
+		path = parsed.Path
+	}
+
+	switch {
+	case strings.HasSuffix(path, ".json"):
+		return FeedArtifacts
+	case strings.Contains(path, "debugsymbols"):
+		return DebugSymbolArtifacts
+	case strings.HasPrefix(path, "/tools/"):
+		return ToolsArtifacts
+	case strings.HasPrefix(path, "/compass/") || strings.Contains(path, "mongosh"):
+		return ShellArtifacts
+	default:
+		return ServerArtifacts
+	}
+}
+
+// WithClassMirror sets the mirror of a class of artifacts, which
+// replaces the Config's mirror for the class. An empty base URL
+// downloads the class from MongoDB's servers even when the Config
+// has a mirror:
+//
+//	bond.NewConfig(
+//		bond.WithMirror("https://mirror.internal/mongodb"),
+//		bond.WithClassMirror(bond.DebugSymbolArtifacts, ""),
+//		bond.WithClassMirror(bond.ToolsArtifacts, "https://bucket.s3.amazonaws.com/mongodb"))
+func WithClassMirror(class ArtifactClass, base string) Option {
+	return func(c *Config) {
+		mirrors := make(map[ArtifactClass]string, len(c.ClassMirrors)+1)
+		for k, v := range c.ClassMirrors {
+			mirrors[k] = v
+		}
+		mirrors[class] = strings.TrimSuffix(base, "/")
+		c.ClassMirrors = mirrors
+	}
+}
+
+// ParseClassMirror parses a class mirror setting, in the form
+// class=url (e.g. "debug=" or "tools=https://bucket.example.net").
+func ParseClassMirror(val string) (ArtifactClass, string, error) {
+	parts := strings.SplitN(val, "=", 2)
+	if len(parts) != 2 {
+		return "", "", errors.Errorf("'%s' is not in the form class=url", val)
+	}
+
+	class := ArtifactClass(strings.TrimSpace(parts[0]))
+	if err := class.Validate(); err != nil {
+		return "", "", err
+	}
+
+	return class, strings.TrimSpace(parts[1]), nil
+}
+
+// GetMirror returns the base URL of the mirror of the class, or an
+// empty string if the class is not mirrored.
+func (c *Config) GetMirror(class ArtifactClass) string {
+	if c == nil {
+		return ""
+	}
+
+	if base, ok := c.ClassMirrors[class]; ok {
+		return base
+	}
+	if c.Mirrors != nil {
+		return c.Mirrors.Best()
+	}
+
+	return c.Mirror
+}
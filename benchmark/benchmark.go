@@ -0,0 +1,261 @@
+/*
+Package benchmark generates synthetic job load against amboy queues,
+drivers, and runners, and reports throughput and latency, so that
+changes to drivers and queue wrappers can be measured before they're
+released.
+
+Use Run to benchmark a driver (optionally with a specific runner)
+behind amboy's remote unordered queue, or RunQueue to benchmark any
+queue that has not been started.
+*/
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"github.com/tychoish/bond/jobs"
+)
+
+// Options configures the load that the harness generates.
+type Options struct {
+	// Jobs is the total number of jobs to submit.
+	Jobs int `bson:"jobs" json:"jobs" yaml:"jobs"`
+	// Producers is the number of goroutines submitting jobs, and
+	// defaults to 1.
+	Producers int `bson:"producers" json:"producers" yaml:"producers"`
+	// Workers is the number of workers for queues that Run
+	// constructs, and defaults to 2.
+	Workers int `bson:"workers" json:"workers" yaml:"workers"`
+	// Work is how long each job runs.
+	Work time.Duration `bson:"work" json:"work" yaml:"work"`
+	// Payload is the size, in bytes, of the data in each job.
+	Payload int `bson:"payload" json:"payload" yaml:"payload"`
+	// Timeout bounds the whole run, and defaults to 10 minutes.
+	Timeout time.Duration `bson:"timeout" json:"timeout" yaml:"timeout"`
+}
+
+// Validate returns an error if the options are invalid, and sets
+// defaults for unspecified values.
+func (o *Options) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(o.Jobs <= 0, "must specify a positive number of jobs")
+	catcher.NewWhen(o.Producers < 0, "producers must be 0 or positive")
+	catcher.NewWhen(o.Workers < 0, "workers must be 0 or positive")
+	catcher.NewWhen(o.Work < 0, "work must be 0 or positive")
+	catcher.NewWhen(o.Payload < 0, "payload must be 0 or positive")
+	catcher.NewWhen(o.Timeout < 0, "timeout must be 0 or positive")
+	if catcher.HasErrors() {
+		return catcher.Resolve()
+	}
+
+	if o.Producers == 0 {
+		o.Producers = 1
+	}
+	if o.Workers == 0 {
+		o.Workers = 2
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 10 * time.Minute
+	}
+
+	return nil
+}
+
+// Percentiles summarizes a distribution of durations.
+type Percentiles struct {
+	P50 time.Duration `bson:"p50" json:"p50" yaml:"p50"`
+	P90 time.Duration `bson:"p90" json:"p90" yaml:"p90"`
+	P99 time.Duration `bson:"p99" json:"p99" yaml:"p99"`
+	Max time.Duration `bson:"max" json:"max" yaml:"max"`
+}
+
+// String formats the percentiles on one line.
+func (p Percentiles) String() string {
+	return fmt.Sprintf("p50=%s p90=%s p99=%s max=%s", p.P50, p.P90, p.P99, p.Max)
+}
+
+// Report describes the results of a run.
+type Report struct {
+	Queue    string        `bson:"queue" json:"queue" yaml:"queue"`
+	Jobs     int           `bson:"jobs" json:"jobs" yaml:"jobs"`
+	Failed   int           `bson:"failed" json:"failed" yaml:"failed"`
+	Duration time.Duration `bson:"duration" json:"duration" yaml:"duration"`
+	// Throughput is the number of jobs completed per second.
+	Throughput float64 `bson:"throughput" json:"throughput" yaml:"throughput"`
+	// Put is the time spent in each call to Put.
+	Put Percentiles `bson:"put" json:"put" yaml:"put"`
+	// Wait is the time from submission until each job started.
+	Wait Percentiles `bson:"wait" json:"wait" yaml:"wait"`
+	// Latency is the time from submission until each job
+	// completed.
+	Latency Percentiles `bson:"latency" json:"latency" yaml:"latency"`
+}
+
+// String formats the report for humans.
+func (r *Report) String() string {
+	out := []string{
+		fmt.Sprintf("queue:      %s", r.Queue),
+		fmt.Sprintf("jobs:       %d (%d failed)", r.Jobs, r.Failed),
+		fmt.Sprintf("duration:   %s", r.Duration),
+		fmt.Sprintf("throughput: %.1f jobs/sec", r.Throughput),
+		fmt.Sprintf("put:        %s", r.Put),
+		fmt.Sprintf("wait:       %s", r.Wait),
+		fmt.Sprintf("latency:    %s", r.Latency),
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// Run benchmarks the driver behind a remote unordered queue. If the
+// runner is nil, the queue uses its default worker pool, with the
+// number of workers in the options.
+func Run(ctx context.Context, d queue.Driver, r amboy.Runner, opts Options) (*Report, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid benchmark options")
+	}
+
+	q := queue.NewRemoteUnordered(opts.Workers)
+	if err := q.SetDriver(d); err != nil {
+		return nil, errors.Wrap(err, "problem setting driver")
+	}
+
+	if r != nil {
+		if err := q.SetRunner(r); err != nil {
+			return nil, errors.Wrap(err, "problem setting runner")
+		}
+		if err := r.SetQueue(q); err != nil {
+			return nil, errors.Wrap(err, "problem attaching runner to queue")
+		}
+	}
+
+	return RunQueue(ctx, q, opts)
+}
+
+// RunQueue starts the queue, submits the jobs, and waits for them to
+// complete. The queue must not have started.
+func RunQueue(ctx context.Context, q amboy.Queue, opts Options) (*Report, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid benchmark options")
+	}
+
+	if q.Started() {
+		return nil, errors.New("cannot benchmark a queue that has already started")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	if err := q.Start(ctx); err != nil {
+		return nil, errors.Wrap(err, "problem starting queue")
+	}
+
+	run := uuid.NewV4().String()
+	submitted := make([]time.Time, opts.Jobs)
+	puts := make([]time.Duration, opts.Jobs)
+	ids := make([]string, opts.Jobs)
+
+	start := time.Now()
+	catcher := grip.NewCatcher()
+	work := make(chan int)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < opts.Producers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range work {
+				j := NewJob(run, idx, opts.Work, opts.Payload)
+				ids[idx] = j.ID()
+				submitted[idx] = time.Now()
+				catcher.Add(q.Put(ctx, j))
+				puts[idx] = time.Since(submitted[idx])
+			}
+		}()
+	}
+
+	for i := 0; i < opts.Jobs; i++ {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	if catcher.HasErrors() {
+		return nil, errors.Wrap(catcher.Resolve(), "problem submitting jobs")
+	}
+
+	if _, err := jobs.WaitN(ctx, q, ids, len(ids), jobs.Backoff{}); err != nil {
+		return nil, errors.Wrap(err, "problem waiting for jobs")
+	}
+	elapsed := time.Since(start)
+
+	report := &Report{
+		Queue:      q.ID(),
+		Jobs:       opts.Jobs,
+		Duration:   elapsed,
+		Throughput: float64(opts.Jobs) / elapsed.Seconds(),
+		Put:        summarize(puts),
+	}
+
+	waits := make([]time.Duration, 0, len(ids))
+	latencies := make([]time.Duration, 0, len(ids))
+	for idx, id := range ids {
+		j, ok := q.Get(ctx, id)
+		if !ok {
+			return nil, errors.Errorf("job '%s' does not exist", id)
+		}
+
+		if j.Error() != nil {
+			report.Failed++
+		}
+
+		ti := j.TimeInfo()
+		if !ti.Start.IsZero() {
+			waits = append(waits, ti.Start.Sub(submitted[idx]))
+		}
+		if !ti.End.IsZero() {
+			latencies = append(latencies, ti.End.Sub(submitted[idx]))
+		}
+	}
+	report.Wait = summarize(waits)
+	report.Latency = summarize(latencies)
+
+	return report, nil
+}
+
+// summarize computes nearest-rank percentiles of the durations.
+func summarize(durations []time.Duration) Percentiles {
+	if len(durations) == 0 {
+		return Percentiles{}
+	}
+
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	rank := func(p float64) time.Duration {
+		idx := int(p*float64(len(sorted))+0.5) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		if idx >= len(sorted) {
+			idx = len(sorted) - 1
+		}
+		return sorted[idx]
+	}
+
+	return Percentiles{
+		P50: rank(0.50),
+		P90: rank(0.90),
+		P99: rank(0.99),
+		Max: sorted[len(sorted)-1],
+	}
+}
@@ -0,0 +1,78 @@
+package benchmark
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy/pool"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/driver"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	opts := Options{Jobs: 1}
+	require.NoError(t, opts.Validate())
+	assert.Equal(t, 1, opts.Producers)
+	assert.Equal(t, 2, opts.Workers)
+	assert.Equal(t, 10*time.Minute, opts.Timeout)
+
+	assert.Error(t, (&Options{}).Validate())
+	assert.Error(t, (&Options{Jobs: 1, Work: -1}).Validate())
+	assert.Error(t, (&Options{Jobs: 1, Payload: -1}).Validate())
+}
+
+func TestSummarize(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(Percentiles{}, summarize(nil))
+
+	durations := make([]time.Duration, 100)
+	for i := range durations {
+		durations[len(durations)-1-i] = time.Duration(i+1) * time.Millisecond
+	}
+
+	p := summarize(durations)
+	assert.Equal(50*time.Millisecond, p.P50)
+	assert.Equal(90*time.Millisecond, p.P90)
+	assert.Equal(99*time.Millisecond, p.P99)
+	assert.Equal(100*time.Millisecond, p.Max)
+}
+
+func TestRunDriver(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	report, err := Run(ctx, queue.NewInternalDriver(), nil, Options{Jobs: 50, Producers: 4, Work: time.Millisecond, Payload: 64})
+	require.NoError(t, err)
+	assert.Equal(50, report.Jobs)
+	assert.Equal(0, report.Failed)
+	assert.True(report.Throughput > 0)
+	assert.True(report.Latency.Max >= time.Millisecond)
+	assert.True(report.Latency.P50 <= report.Latency.P99)
+	assert.Contains(report.String(), "throughput")
+
+	d, err := driver.NewAging(driver.AgingOptions{})
+	require.NoError(t, err)
+	report, err = Run(ctx, d, pool.NewLocalWorkers(4, nil), Options{Jobs: 20})
+	require.NoError(t, err)
+	assert.Equal(20, report.Jobs)
+
+	_, err = Run(ctx, queue.NewInternalDriver(), nil, Options{})
+	assert.Error(err)
+}
+
+func TestRunQueueRequiresUnstartedQueue(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q := queue.NewLocalLimitedSize(2, 128)
+	report, err := RunQueue(ctx, q, Options{Jobs: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 10, report.Jobs)
+
+	_, err = RunQueue(ctx, q, Options{Jobs: 10})
+	assert.Error(t, err)
+}
@@ -0,0 +1,70 @@
+package benchmark
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/dependency"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/registry"
+)
+
+const jobTypeName = "bond-benchmark"
+
+func init() {
+	registry.AddJobType(jobTypeName, func() amboy.Job { return makeJob() })
+}
+
+// Job is the synthetic job that the harness submits. It sleeps for
+// Work, and carries Payload bytes of data to exercise drivers'
+// serialization.
+type Job struct {
+	Work      time.Duration `bson:"work" json:"work" yaml:"work"`
+	Payload   []byte        `bson:"payload" json:"payload" yaml:"payload"`
+	*job.Base `bson:"metadata" json:"metadata" yaml:"metadata"`
+}
+
+func makeJob() *Job {
+	return &Job{
+		Base: &job.Base{
+			JobType: amboy.JobType{
+				Name:    jobTypeName,
+				Version: 0,
+			},
+		},
+	}
+}
+
+// NewJob constructs a benchmark job with the specified run time and
+// payload size.
+func NewJob(run string, idx int, work time.Duration, payload int) *Job {
+	j := makeJob()
+	j.SetID(fmt.Sprintf("%s-%s-%d", jobTypeName, run, idx))
+	j.SetDependency(dependency.NewAlways())
+	j.Work = work
+	j.Payload = make([]byte, payload)
+	j.UpdateTimeInfo(amboy.JobTimeInfo{Created: time.Now()})
+
+	return j
+}
+
+// Run sleeps for the job's work duration, or until the context is
+// canceled.
+func (j *Job) Run(ctx context.Context) {
+	defer j.MarkComplete()
+
+	if j.Work <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(j.Work)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		j.AddError(ctx.Err())
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,180 @@
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// Reference identifies a blob attached to a job, and is what the job
+// stores in place of the blob's contents.
+type Reference struct {
+	Name     string    `bson:"name" json:"name" yaml:"name"`
+	Key      string    `bson:"key" json:"key" yaml:"key"`
+	Size     int64     `bson:"size" json:"size" yaml:"size"`
+	SHA256   string    `bson:"sha256" json:"sha256" yaml:"sha256"`
+	Attached time.Time `bson:"attached" json:"attached" yaml:"attached"`
+}
+
+// Attacher is implemented by jobs that keep references to their
+// attached blobs.
+type Attacher interface {
+	AttachArtifact(Reference)
+	ArtifactReferences() []Reference
+}
+
+// JobArtifacts stores a job's references, and implements Attacher for
+// the jobs that embed it.
+type JobArtifacts struct {
+	References []Reference `bson:"references,omitempty" json:"references,omitempty" yaml:"references,omitempty"`
+}
+
+// AttachArtifact adds the reference, replacing any reference with the
+// same name.
+func (a *JobArtifacts) AttachArtifact(ref Reference) {
+	for idx := range a.References {
+		if a.References[idx].Name == ref.Name {
+			a.References[idx] = ref
+			return
+		}
+	}
+
+	a.References = append(a.References, ref)
+}
+
+// ArtifactReferences returns the references of the attached blobs.
+func (a *JobArtifacts) ArtifactReferences() []Reference { return a.References }
+
+// ValidateName returns an error if the name cannot identify a blob of
+// a job. Names must not be empty, or contain slashes.
+func ValidateName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return errors.Errorf("'%s' is not a valid artifact name", name)
+	}
+
+	return nil
+}
+
+// Key returns the key of the job's blob with the name.
+func Key(j amboy.Job, name string) string {
+	return path.Join("jobs", strings.Replace(j.ID(), "/", "-", -1), name)
+}
+
+// Attach stores the contents of the reader as the job's blob with the
+// name, and, if the job implements Attacher, adds the reference to
+// the job. The queue stores the reference when it saves the job. The
+// contents are written to a temporary file first, so that the
+// reference records their size and checksum.
+func Attach(ctx context.Context, s Store, j amboy.Job, name string, r io.Reader) (Reference, error) {
+	if err := ValidateName(name); err != nil {
+		return Reference{}, err
+	}
+
+	tmp, err := ioutil.TempFile("", "bond-blob.")
+	if err != nil {
+		return Reference{}, errors.Wrap(err, "problem creating temporary file")
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(err)
+	catcher.Add(tmp.Close())
+	if catcher.HasErrors() {
+		return Reference{}, errors.Wrapf(catcher.Resolve(), "problem writing artifact '%s'", name)
+	}
+
+	return attach(ctx, s, j, name, tmp.Name(), size, hex.EncodeToString(h.Sum(nil)))
+}
+
+// AttachFile stores the contents of the file as the job's blob with
+// the name, as Attach does.
+func AttachFile(ctx context.Context, s Store, j amboy.Job, name, fileName string) (Reference, error) {
+	if err := ValidateName(name); err != nil {
+		return Reference{}, err
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return Reference{}, errors.Wrapf(err, "problem opening %s", fileName)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return Reference{}, errors.Wrapf(err, "problem reading %s", fileName)
+	}
+
+	return attach(ctx, s, j, name, fileName, size, hex.EncodeToString(h.Sum(nil)))
+}
+
+func attach(ctx context.Context, s Store, j amboy.Job, name, fileName string, size int64, sum string) (Reference, error) {
+	ref := Reference{
+		Name:     name,
+		Key:      Key(j, name),
+		Size:     size,
+		SHA256:   sum,
+		Attached: time.Now(),
+	}
+
+	if err := s.PutBlob(ctx, ref.Key, fileName); err != nil {
+		return Reference{}, errors.Wrapf(err, "problem storing artifact '%s' of job '%s'", name, j.ID())
+	}
+
+	if a, ok := j.(Attacher); ok {
+		a.AttachArtifact(ref)
+	}
+
+	return ref, nil
+}
+
+// Open returns a reader of the referenced blob.
+func Open(ctx context.Context, s Store, ref Reference) (io.ReadCloser, error) {
+	r, err := s.OpenBlob(ctx, ref.Key)
+	return r, errors.Wrapf(err, "problem opening artifact '%s'", ref.Name)
+}
+
+// Find returns the reference of the job's blob with the name, if the
+// job implements Attacher and has one.
+func Find(j amboy.Job, name string) (Reference, bool) {
+	a, ok := j.(Attacher)
+	if !ok {
+		return Reference{}, false
+	}
+
+	for _, ref := range a.ArtifactReferences() {
+		if ref.Name == name {
+			return ref, true
+		}
+	}
+
+	return Reference{}, false
+}
+
+// Remove deletes the blobs of the job, for use when jobs are deleted
+// from a queue.
+func Remove(ctx context.Context, s Store, j amboy.Job) error {
+	a, ok := j.(Attacher)
+	if !ok {
+		return nil
+	}
+
+	catcher := grip.NewBasicCatcher()
+	for _, ref := range a.ArtifactReferences() {
+		catcher.Wrapf(s.DeleteBlob(ctx, ref.Key), "problem deleting artifact '%s'", ref.Name)
+	}
+
+	return catcher.Resolve()
+}
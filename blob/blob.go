@@ -0,0 +1,55 @@
+/*
+Package blob stores large job results (log bundles, reports, and
+other artifacts) outside of a queue's storage, in a pluggable Store,
+so that jobs can preserve their full outputs while the documents that
+drivers store contain only small references to them.
+
+Jobs attach results with Attach, inside Run, using the store that
+middleware.ArtifactQueue provides in the context, and embed
+JobArtifacts to keep the references:
+
+	store, ok := blob.StoreFrom(ctx)
+	if ok {
+		ref, err := blob.Attach(ctx, store, j, "report.json", bytes.NewReader(report))
+		...
+	}
+*/
+package blob
+
+import (
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned by stores when a blob does not exist.
+var ErrNotFound = errors.New("blob not found")
+
+// Store is a place to keep blobs. Keys are slash-separated paths.
+// Implementations must replace blobs atomically, so that readers
+// never see partial blobs, and must return an error that wraps
+// ErrNotFound when opening a missing blob.
+type Store interface {
+	// PutBlob stores the contents of the file with the key.
+	PutBlob(ctx context.Context, key, fileName string) error
+	// OpenBlob returns a reader of the blob with the key.
+	OpenBlob(ctx context.Context, key string) (io.ReadCloser, error)
+	// DeleteBlob removes the blob with the key. Deleting a
+	// missing blob is not an error.
+	DeleteBlob(ctx context.Context, key string) error
+}
+
+type storeCtxKey struct{}
+
+// WithStore returns a context that carries the store, for use by jobs
+// during Run.
+func WithStore(ctx context.Context, s Store) context.Context {
+	return context.WithValue(ctx, storeCtxKey{}, s)
+}
+
+// StoreFrom returns the store attached to the context, if any.
+func StoreFrom(ctx context.Context) (Store, bool) {
+	s, ok := ctx.Value(storeCtxKey{}).(Store)
+	return s, ok && s != nil
+}
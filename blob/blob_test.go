@@ -0,0 +1,154 @@
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type artifactJob struct {
+	*job.Base
+	JobArtifacts
+}
+
+func newArtifactJob(id string) *artifactJob {
+	j := &artifactJob{Base: &job.Base{JobType: amboy.JobType{Name: "blob-test"}}}
+	j.SetID(id)
+	return j
+}
+
+func (j *artifactJob) Run(_ context.Context) { j.MarkComplete() }
+
+func readBlob(t *testing.T, s Store, key string) string {
+	r, err := s.OpenBlob(context.Background(), key)
+	require.NoError(t, err)
+	defer r.Close()
+
+	data, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestDirectoryStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "bond-blob-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s := DirectoryStore{Path: filepath.Join(dir, "store")}
+
+	src := filepath.Join(dir, "src")
+	require.NoError(t, ioutil.WriteFile(src, []byte("first"), 0600))
+	require.NoError(t, s.PutBlob(ctx, "a/b/c", src))
+	assert.Equal("first", readBlob(t, s, "a/b/c"))
+
+	require.NoError(t, ioutil.WriteFile(src, []byte("second"), 0600))
+	require.NoError(t, s.PutBlob(ctx, "a/b/c", src))
+	assert.Equal("second", readBlob(t, s, "a/b/c"))
+
+	// no temporary files are left behind
+	entries, err := ioutil.ReadDir(filepath.Join(dir, "store", "a", "b"))
+	require.NoError(t, err)
+	assert.Len(entries, 1)
+
+	assert.NoError(s.DeleteBlob(ctx, "a/b/c"))
+	assert.NoError(s.DeleteBlob(ctx, "a/b/c"))
+	_, err = s.OpenBlob(ctx, "a/b/c")
+	assert.Equal(ErrNotFound, errors.Cause(err))
+
+	for _, key := range []string{"", "/", "../escape", "a/../../escape", "/abs", "a//b", `a\b`} {
+		assert.Error(s.PutBlob(ctx, key, src), key)
+		_, err = s.OpenBlob(ctx, key)
+		assert.Error(err, key)
+		assert.Error(s.DeleteBlob(ctx, key), key)
+	}
+	assert.Error(s.PutBlob(ctx, "missing", filepath.Join(dir, "missing")))
+}
+
+func TestValidateName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(ValidateName("report.json"))
+	for _, name := range []string{"", ".", "..", "a/b", `a\b`} {
+		assert.Error(ValidateName(name), name)
+	}
+}
+
+func TestAttach(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "bond-blob-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	s := DirectoryStore{Path: dir}
+
+	j := newArtifactJob("a/job")
+	ref, err := Attach(ctx, s, j, "log.txt", strings.NewReader("log contents"))
+	require.NoError(t, err)
+	sum := sha256.Sum256([]byte("log contents"))
+	assert.Equal("log.txt", ref.Name)
+	assert.Equal("jobs/a-job/log.txt", ref.Key)
+	assert.EqualValues(len("log contents"), ref.Size)
+	assert.Equal(hex.EncodeToString(sum[:]), ref.SHA256)
+	assert.False(ref.Attached.IsZero())
+	assert.Equal("log contents", readBlob(t, s, ref.Key))
+
+	// attaching the same name again replaces the reference
+	src := filepath.Join(dir, "report")
+	require.NoError(t, ioutil.WriteFile(src, []byte("new log"), 0600))
+	ref, err = AttachFile(ctx, s, j, "log.txt", src)
+	require.NoError(t, err)
+	assert.EqualValues(len("new log"), ref.Size)
+	require.Len(t, j.ArtifactReferences(), 1)
+	assert.Equal(ref, j.ArtifactReferences()[0])
+
+	_, err = Attach(ctx, s, j, "../log.txt", strings.NewReader(""))
+	assert.Error(err)
+	_, err = AttachFile(ctx, s, j, "other.txt", filepath.Join(dir, "missing"))
+	assert.Error(err)
+	assert.Len(j.ArtifactReferences(), 1)
+
+	found, ok := Find(j, "log.txt")
+	assert.True(ok)
+	assert.Equal(ref, found)
+	_, ok = Find(j, "other.txt")
+	assert.False(ok)
+	_, ok = Find(job.NewShellJob("true", ""), "log.txt")
+	assert.False(ok)
+
+	r, err := Open(ctx, s, found)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	assert.NoError(r.Close())
+	assert.NoError(err)
+	assert.Equal("new log", string(data))
+
+	require.NoError(t, Remove(ctx, s, j))
+	_, err = Open(ctx, s, found)
+	assert.Equal(ErrNotFound, errors.Cause(err))
+	assert.NoError(Remove(ctx, s, job.NewShellJob("true", "")))
+}
+
+func TestStoreFrom(t *testing.T) {
+	assert := assert.New(t)
+
+	_, ok := StoreFrom(context.Background())
+	assert.False(ok)
+
+	s, ok := StoreFrom(WithStore(context.Background(), DirectoryStore{Path: "dir"}))
+	assert.True(ok)
+	assert.Equal(DirectoryStore{Path: "dir"}, s)
+}
@@ -0,0 +1,96 @@
+package blob
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// DirectoryStore is a Store in a local (or mounted) directory, where
+// each blob is a file at the path of its key.
+type DirectoryStore struct {
+	Path string
+}
+
+func (s DirectoryStore) fileName(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || clean == "/" || strings.Contains(key, `\`) || clean != "/"+key {
+		return "", errors.Errorf("'%s' is not a valid blob key", key)
+	}
+
+	return filepath.Join(s.Path, filepath.FromSlash(clean[1:])), nil
+}
+
+// PutBlob copies the file to a temporary file in the directory, and
+// renames it into place once it's complete.
+func (s DirectoryStore) PutBlob(ctx context.Context, key, fileName string) error {
+	fn, err := s.fileName(key)
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(fileName)
+	if err != nil {
+		return errors.Wrapf(err, "problem opening %s", fileName)
+	}
+	defer in.Close()
+
+	if err = os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return errors.Wrapf(err, "problem creating directory for %s", fn)
+	}
+
+	out, err := ioutil.TempFile(filepath.Dir(fn), "."+filepath.Base(fn)+".")
+	if err != nil {
+		return errors.Wrapf(err, "problem creating temporary file for %s", fn)
+	}
+	defer os.Remove(out.Name())
+
+	_, err = io.Copy(out, in)
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(err)
+	catcher.Add(out.Close())
+	if catcher.HasErrors() {
+		return errors.Wrapf(catcher.Resolve(), "problem writing %s", out.Name())
+	}
+
+	return errors.Wrapf(os.Rename(out.Name(), fn), "problem moving %s into place", fn)
+}
+
+// OpenBlob opens the file of the blob.
+func (s DirectoryStore) OpenBlob(_ context.Context, key string) (io.ReadCloser, error) {
+	fn, err := s.fileName(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(fn)
+	if os.IsNotExist(err) {
+		return nil, errors.Wrapf(ErrNotFound, "no blob '%s'", key)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem opening %s", fn)
+	}
+
+	return f, nil
+}
+
+// DeleteBlob removes the file of the blob.
+func (s DirectoryStore) DeleteBlob(_ context.Context, key string) error {
+	fn, err := s.fileName(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(fn); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "problem removing %s", fn)
+	}
+
+	return nil
+}
@@ -0,0 +1,242 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+)
+
+// S3Options configure an S3Store.
+type S3Options struct {
+	// Endpoint is the base URL of the service, and defaults to
+	// https://s3.<region>.amazonaws.com. Other services that
+	// implement the S3 API (e.g. MinIO) work with their own
+	// endpoints.
+	Endpoint string `bson:"endpoint" json:"endpoint" yaml:"endpoint"`
+	Region   string `bson:"region" json:"region" yaml:"region"`
+	Bucket   string `bson:"bucket" json:"bucket" yaml:"bucket"`
+	// Prefix, if specified, is prepended to every key.
+	Prefix    string `bson:"prefix" json:"prefix" yaml:"prefix"`
+	AccessKey string `bson:"access_key" json:"access_key" yaml:"access_key"`
+	SecretKey string `bson:"-" json:"-" yaml:"-"`
+	// Client defaults to http.DefaultClient.
+	Client *http.Client `bson:"-" json:"-" yaml:"-"`
+}
+
+// Validate returns an error if the options are invalid, and sets
+// defaults for unspecified values.
+func (o *S3Options) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(o.Region == "", "must specify a region")
+	catcher.NewWhen(o.Bucket == "", "must specify a bucket")
+	catcher.NewWhen(o.AccessKey == "" || o.SecretKey == "", "must specify credentials")
+	if o.Endpoint != "" {
+		_, err := url.Parse(o.Endpoint)
+		catcher.Wrapf(err, "invalid endpoint '%s'", o.Endpoint)
+	}
+	if catcher.HasErrors() {
+		return catcher.Resolve()
+	}
+
+	if o.Endpoint == "" {
+		o.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", o.Region)
+	}
+	o.Endpoint = strings.TrimRight(o.Endpoint, "/")
+	o.Prefix = strings.Trim(o.Prefix, "/")
+	if o.Client == nil {
+		o.Client = http.DefaultClient
+	}
+
+	return nil
+}
+
+// S3Store is a Store in an S3 bucket. Requests use path-style URLs
+// and are signed with AWS Signature Version 4.
+type S3Store struct {
+	opts S3Options
+}
+
+// NewS3Store constructs a store, returning an error if the options are
+// not valid.
+func NewS3Store(opts S3Options) (*S3Store, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid S3 options")
+	}
+
+	return &S3Store{opts: opts}, nil
+}
+
+func (s *S3Store) objectURL(key string) string {
+	if s.opts.Prefix != "" {
+		key = s.opts.Prefix + "/" + key
+	}
+
+	segments := strings.Split(key, "/")
+	for idx := range segments {
+		segments[idx] = s3Escape(segments[idx])
+	}
+
+	return s.opts.Endpoint + "/" + s3Escape(s.opts.Bucket) + "/" + strings.Join(segments, "/")
+}
+
+// s3Escape encodes every byte except the unreserved characters, as
+// the canonical requests of signatures require.
+func s3Escape(segment string) string {
+	out := strings.Builder{}
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-', c == '.', c == '_', c == '~':
+			out.WriteByte(c)
+		default:
+			fmt.Fprintf(&out, "%%%02X", c)
+		}
+	}
+
+	return out.String()
+}
+
+// emptyPayload is the SHA-256 of an empty request body.
+const emptyPayload = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func (s *S3Store) do(ctx context.Context, method, key string, body io.Reader, size int64, sum string) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.objectURL(key), body)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem building request")
+	}
+	if body != nil {
+		req.ContentLength = size
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	s.sign(req, sum, time.Now().UTC())
+
+	resp, err := s.opts.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem requesting %s", req.URL)
+	}
+
+	return resp, nil
+}
+
+// sign adds the headers of AWS Signature Version 4 to the request.
+func (s *S3Store) sign(req *http.Request, payload string, now time.Time) {
+	stamp := now.Format("20060102T150405Z")
+	date := stamp[:8]
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	const signed = "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payload,
+		"x-amz-date:" + stamp,
+		"",
+		signed,
+		payload,
+	}, "\n")
+
+	scope := date + "/" + s.opts.Region + "/s3/aws4_request"
+	hashed := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := []byte("AWS4" + s.opts.SecretKey)
+	for _, part := range []string{date, s.opts.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.opts.AccessKey, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func s3Error(resp *http.Response, op, key string) error {
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return errors.Errorf("S3 responded to %s of '%s' with %s: %s", op, key, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// PutBlob uploads the file as the object of the key.
+func (s *S3Store) PutBlob(ctx context.Context, key, fileName string) error {
+	sum, err := bond.FileChecksum(fileName, bond.SHA256)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return errors.Wrapf(err, "problem opening %s", fileName)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "problem finding size of %s", fileName)
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, key, f, info.Size(), sum.Value)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp, "upload", key)
+	}
+
+	return nil
+}
+
+// OpenBlob downloads the object of the key.
+func (s *S3Store) OpenBlob(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, nil, 0, emptyPayload)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, errors.Wrapf(ErrNotFound, "no blob '%s'", key)
+	default:
+		defer resp.Body.Close()
+		return nil, s3Error(resp, "download", key)
+	}
+}
+
+// DeleteBlob deletes the object of the key.
+func (s *S3Store) DeleteBlob(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, 0, emptyPayload)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	default:
+		return s3Error(resp, "deletion", key)
+	}
+}
@@ -0,0 +1,140 @@
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 stores objects by path, and rejects requests without
+// signature headers.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=key/") || !strings.Contains(auth, "/region/s3/aws4_request") {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	path := r.URL.EscapedPath()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := ioutil.ReadAll(r.Body)
+		sum := sha256.Sum256(data)
+		if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[path] = data
+	case http.MethodGet:
+		data, ok := f.objects[path]
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = rw.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, path)
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3Options(t *testing.T) {
+	assert := assert.New(t)
+
+	opts := S3Options{}
+	assert.Error(opts.Validate())
+
+	opts = S3Options{Region: "us-east-1", Bucket: "bucket", AccessKey: "key", SecretKey: "secret", Prefix: "/artifacts/"}
+	assert.NoError(opts.Validate())
+	assert.Equal("https://s3.us-east-1.amazonaws.com", opts.Endpoint)
+	assert.Equal("artifacts", opts.Prefix)
+	assert.Equal(http.DefaultClient, opts.Client)
+
+	opts.SecretKey = ""
+	assert.Error(opts.Validate())
+	_, err := NewS3Store(opts)
+	assert.Error(err)
+}
+
+func TestS3Store(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	fake := &fakeS3{objects: map[string][]byte{}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	s, err := NewS3Store(S3Options{
+		Endpoint:  srv.URL + "/",
+		Region:    "region",
+		Bucket:    "bucket",
+		Prefix:    "bond",
+		AccessKey: "key",
+		SecretKey: "secret",
+	})
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "bond-s3-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "src")
+	require.NoError(t, ioutil.WriteFile(src, []byte("contents"), 0600))
+
+	require.NoError(t, s.PutBlob(ctx, "jobs/a:b/log file.txt", src))
+	assert.Contains(fake.objects, "/bucket/bond/jobs/a%3Ab/log%20file.txt")
+	assert.Equal("contents", readBlob(t, s, "jobs/a:b/log file.txt"))
+
+	require.NoError(t, s.DeleteBlob(ctx, "jobs/a:b/log file.txt"))
+	_, err = s.OpenBlob(ctx, "jobs/a:b/log file.txt")
+	assert.Equal(ErrNotFound, errors.Cause(err))
+	assert.Error(s.PutBlob(ctx, "missing", filepath.Join(dir, "missing")))
+
+	bad, err := NewS3Store(S3Options{Endpoint: srv.URL, Region: "other", Bucket: "bucket", AccessKey: "key", SecretKey: "secret"})
+	require.NoError(t, err)
+	err = bad.PutBlob(ctx, "key", src)
+	require.Error(t, err)
+	assert.Contains(err.Error(), "403")
+}
+
+func TestS3Signature(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := NewS3Store(S3Options{Region: "us-east-1", Bucket: "examplebucket", AccessKey: "key", SecretKey: "secret"})
+	require.NoError(t, err)
+
+	sign := func() string {
+		req, err := http.NewRequest(http.MethodGet, s.objectURL("test.txt"), nil)
+		require.NoError(t, err)
+		s.sign(req, emptyPayload, time.Date(2013, 5, 24, 0, 0, 0, 0, time.UTC))
+		assert.Equal("20130524T000000Z", req.Header.Get("X-Amz-Date"))
+		return req.Header.Get("Authorization")
+	}
+
+	auth := sign()
+	assert.True(strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=key/20130524/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="))
+	assert.Equal(auth, sign())
+
+	s.opts.SecretKey = "other"
+	assert.NotEqual(auth, sign())
+}
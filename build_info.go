@@ -35,7 +35,7 @@ func GetInfoFromFileName(fileName string) (BuildInfo, error) {
 		info.Options.Debug = true
 	}
 
-	for _, arch := range []MongoDBArch{AMD64, X86, POWER, ZSeries} {
+	for _, arch := range Architectures {
 		if strings.Contains(fileName, string(arch)) {
 			info.Options.Arch = arch
 			break
@@ -178,6 +178,11 @@ func getTarget(fn string) (string, error) {
 
 func isArch(part string) bool {
 	arch := MongoDBArch(part)
+	for _, known := range Architectures {
+		if arch == known {
+			return true
+		}
+	}
 
-	return arch == AMD64 || arch == ZSeries || arch == POWER || arch == X86
+	return false
 }
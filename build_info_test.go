@@ -341,3 +341,41 @@ func TestVersionIdentification(t *testing.T) {
 		assert.Error(err)
 	}
 }
+
+func TestPowerAndZSeriesBuilds(t *testing.T) {
+	assert := assert.New(t)
+
+	builds := map[string]BuildInfo{
+		"mongodb-linux-ppc64le-enterprise-rhel71-3.4.0.tgz":                                   {"3.4.0", BuildOptions{"rhel71", POWER, Enterprise, false}},
+		"mongodb-linux-ppc64le-enterprise-ubuntu1604-3.6.23.tgz":                              {"3.6.23", BuildOptions{"ubuntu1604", POWER, Enterprise, false}},
+		"mongodb-linux-ppc64le-enterprise-rhel81-4.4.0-rc5.tgz":                               {"4.4.0-rc5", BuildOptions{"rhel81", POWER, Enterprise, false}},
+		"mongodb-linux-ppc64le-enterprise-rhel71-v4.0-latest.tgz":                             {"4.0-latest", BuildOptions{"rhel71", POWER, Enterprise, false}},
+		"mongodb-linux-s390x-enterprise-rhel72-3.4.0.tgz":                                     {"3.4.0", BuildOptions{"rhel72", ZSeries, Enterprise, false}},
+		"mongodb-linux-s390x-enterprise-suse12-4.0.10.tgz":                                    {"4.0.10", BuildOptions{"suse12", ZSeries, Enterprise, false}},
+		"mongodb-linux-s390x-enterprise-ubuntu1804-6.0.5.tgz":                                 {"6.0.5", BuildOptions{"ubuntu1804", ZSeries, Enterprise, false}},
+		"mongodb-linux-s390x-enterprise-rhel83-debugsymbols-7.0.2.tgz":                        {"7.0.2", BuildOptions{"rhel83", ZSeries, Enterprise, true}},
+		"mongodb-linux-ppc64le-enterprise-rhel81-debugsymbols-4.4.3.tgz":                      {"4.4.3", BuildOptions{"rhel81", POWER, Enterprise, true}},
+		"https://downloads.mongodb.com/linux/mongodb-linux-s390x-enterprise-rhel72-4.2.1.tgz": {"4.2.1", BuildOptions{"rhel72", ZSeries, Enterprise, false}},
+	}
+
+	for fn, expected := range builds {
+		info, err := GetInfoFromFileName(fn[:len(fn)-4])
+		if assert.NoError(err, fn) {
+			assert.Equal(expected, info, fn)
+		}
+	}
+
+	for name, arch := range map[string]MongoDBArch{
+		"ppc64le": POWER, "ppc64el": POWER, "power": POWER,
+		"s390x": ZSeries, "zSeries": ZSeries,
+		"amd64": AMD64, "x86_64": AMD64,
+		"aarch64": "aarch64",
+	} {
+		assert.Equal(arch, ParseArch(name), name)
+	}
+
+	assert.NoError(BuildOptions{Target: "rhel81", Arch: POWER, Edition: Enterprise}.Validate())
+	assert.NoError(BuildOptions{Target: "rhel72", Arch: ZSeries, Edition: Enterprise}.Validate())
+	assert.Error(BuildOptions{Target: "rhel81", Arch: "ppc64el", Edition: Enterprise}.Validate())
+	assert.Error(BuildOptions{Target: "rhel72", Arch: "zseries", Edition: Enterprise}.Validate())
+}
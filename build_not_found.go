@@ -0,0 +1,167 @@
+package bond
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrBuildNotFound is the cause of BuildNotFoundError, so that callers
+// can check for missing builds with Is.
+var ErrBuildNotFound = errors.New("build not found")
+
+// maxAlternatives is the number of alternatives that a
+// BuildNotFoundError reports, of each kind.
+const maxAlternatives = 5
+
+// BuildNotFoundError is returned when the feed has a version, but no
+// build of it with the requested options. It reports the nearest
+// available alternatives: other builds of the version, most similar
+// first, and the nearest versions that have a build with the
+// requested options.
+type BuildNotFoundError struct {
+	Version       string         `bson:"version" json:"version" yaml:"version"`
+	Options       BuildOptions   `bson:"options" json:"options" yaml:"options"`
+	OtherBuilds   []BuildOptions `bson:"other_builds" json:"other_builds" yaml:"other_builds"`
+	OtherVersions []string       `bson:"other_versions" json:"other_versions" yaml:"other_versions"`
+}
+
+func (e *BuildNotFoundError) Error() string {
+	out := []string{fmt.Sprintf("there is no build for %s (%s) in edition %s of %s",
+		e.Options.Target, e.Options.Arch, e.Options.Edition, e.Version)}
+
+	if len(e.OtherBuilds) > 0 {
+		builds := make([]string, 0, len(e.OtherBuilds))
+		for _, opts := range e.OtherBuilds {
+			builds = append(builds, fmt.Sprintf("%s (%s, %s)", opts.Target, opts.Arch, opts.Edition))
+		}
+		out = append(out, fmt.Sprintf("%s has builds for %s", e.Version, strings.Join(builds, ", ")))
+	}
+
+	if len(e.OtherVersions) > 0 {
+		out = append(out, fmt.Sprintf("versions with this build: %s", strings.Join(e.OtherVersions, ", ")))
+	}
+
+	return strings.Join(out, "; ")
+}
+
+// Cause returns ErrBuildNotFound.
+func (e *BuildNotFoundError) Cause() error { return ErrBuildNotFound }
+
+// AsBuildNotFound returns the BuildNotFoundError in the error's
+// chain, if there is one.
+func AsBuildNotFound(err error) (*BuildNotFoundError, bool) {
+	for err != nil {
+		if missing, ok := err.(*BuildNotFoundError); ok {
+			return missing, true
+		}
+
+		cause, ok := err.(interface{ Cause() error })
+		if !ok {
+			return nil, false
+		}
+		err = cause.Cause()
+	}
+
+	return nil, false
+}
+
+// buildSimilarity ranks how close a build is to the requested
+// options: the same architecture and edition matter most, and then
+// targets of the same distribution (e.g. rhel70 and rhel80).
+func buildSimilarity(requested, opts BuildOptions) int {
+	score := 0
+	if requested.Arch == opts.Arch {
+		score += 100
+	}
+	if requested.Edition == opts.Edition {
+		score += 50
+	}
+
+	for i := 0; i < len(requested.Target) && i < len(opts.Target); i++ {
+		if requested.Target[i] != opts.Target[i] {
+			break
+		}
+		score++
+	}
+
+	return score
+}
+
+// newBuildNotFoundError describes the missing build, with the other
+// builds of the version. The key has been normalized for the table.
+func (version *ArtifactVersion) newBuildNotFoundError(requested, key BuildOptions) *BuildNotFoundError {
+	others := make([]BuildOptions, 0, len(version.table))
+	for opts := range version.table {
+		if opts.Edition == "source" {
+			continue
+		}
+		others = append(others, opts)
+	}
+
+	sort.Slice(others, func(i, j int) bool {
+		si, sj := buildSimilarity(key, others[i]), buildSimilarity(key, others[j])
+		if si != sj {
+			return si > sj
+		}
+		return others[i].String() < others[j].String()
+	})
+
+	if len(others) > maxAlternatives {
+		others = others[:maxAlternatives]
+	}
+
+	return &BuildNotFoundError{
+		Version:     version.Version,
+		Options:     requested,
+		OtherBuilds: others,
+	}
+}
+
+// explainMissingBuild adds the nearest versions that have the
+// requested build to a BuildNotFoundError, and returns other errors
+// unchanged.
+func (feed *ArtifactsFeed) explainMissingBuild(err error) error {
+	missing, ok := AsBuildNotFound(err)
+	if !ok {
+		return err
+	}
+
+	idx := -1
+	for i, version := range feed.Versions {
+		if version.Version == missing.Version {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return err
+	}
+
+	has := func(i int) bool {
+		version := feed.Versions[i]
+		if parsed, err := NewMongoDBVersion(version.Version); err != nil || parsed.IsDevelopmentBuild() {
+			return false
+		}
+		_, err := version.GetDownload(missing.Options)
+		return err == nil
+	}
+
+	// walk out from the requested version in both directions, so
+	// that the nearest versions come first.
+	for dist := 1; len(missing.OtherVersions) < maxAlternatives; dist++ {
+		before, after := idx-dist, idx+dist
+		if before < 0 && after >= len(feed.Versions) {
+			break
+		}
+		for _, i := range []int{before, after} {
+			if i >= 0 && i < len(feed.Versions) && len(missing.OtherVersions) < maxAlternatives && has(i) {
+				missing.OtherVersions = append(missing.OtherVersions, feed.Versions[i].Version)
+			}
+		}
+	}
+
+	return err
+}
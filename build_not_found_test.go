@@ -0,0 +1,74 @@
+package bond
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildNotFoundReportsAlternatives(t *testing.T) {
+	assert := assert.New(t)
+
+	feed, err := NewArtifactsFeed("")
+	require.NoError(t, err)
+	defer os.RemoveAll(feed.dir)
+
+	require.NoError(t, feed.Reload([]byte(`{"versions": [
+  {"version": "4.2.1", "current": true, "downloads": [
+    {"target": "rhel80", "arch": "x86_64", "edition": "enterprise"}]},
+  {"version": "4.2.1-5-g1234567", "downloads": [
+    {"target": "rhel70", "arch": "x86_64", "edition": "enterprise"}]},
+  {"version": "4.2.0", "downloads": [
+    {"target": "rhel80", "arch": "x86_64", "edition": "enterprise"},
+    {"target": "ubuntu1804", "arch": "x86_64", "edition": "enterprise"},
+    {"target": "rhel71", "arch": "ppc64le", "edition": "enterprise"},
+    {"target": "rhel80", "arch": "x86_64", "edition": "targeted"}]},
+  {"version": "4.0.9", "downloads": [
+    {"target": "rhel70", "arch": "x86_64", "edition": "enterprise"}]},
+  {"version": "4.0.8", "downloads": [
+    {"target": "rhel70", "arch": "x86_64", "edition": "enterprise"}]}
+]}`)))
+
+	opts := BuildOptions{Target: "rhel70", Arch: AMD64, Edition: Enterprise}
+	version, ok := feed.GetVersion("4.2.0")
+	require.True(t, ok)
+	_, err = version.GetDownload(opts)
+	require.Error(t, err)
+	assert.True(Is(err, ErrBuildNotFound))
+
+	missing, ok := AsBuildNotFound(err)
+	require.True(t, ok)
+	assert.Equal("4.2.0", missing.Version)
+	assert.Equal(opts, missing.Options)
+	assert.Equal([]BuildOptions{
+		{Target: "rhel80", Arch: AMD64, Edition: Enterprise},
+		{Target: "ubuntu1804", Arch: AMD64, Edition: Enterprise},
+		{Target: "rhel80", Arch: AMD64, Edition: CommunityTargeted},
+		{Target: "rhel71", Arch: POWER, Edition: Enterprise},
+	}, missing.OtherBuilds)
+	assert.Len(missing.OtherVersions, 0)
+
+	err = feed.explainMissingBuild(err)
+	assert.Equal([]string{"4.0.9", "4.0.8"}, missing.OtherVersions)
+	assert.Contains(err.Error(), "4.2.0 has builds for rhel80 (x86_64, enterprise)")
+	assert.Contains(err.Error(), "versions with this build: 4.0.9, 4.0.8")
+
+	urls, errs := feed.GetArchives([]string{"4.2.0"}, opts)
+	for range urls {
+		assert.Fail("unexpected archive")
+	}
+	err = <-errs
+	require.Error(t, err)
+	assert.Contains(err.Error(), "versions with this build: 4.0.9, 4.0.8")
+
+	_, err = feed.GetCurrentArchive("4.2", opts)
+	require.Error(t, err)
+	missing, ok = AsBuildNotFound(err)
+	require.True(t, ok)
+	assert.Equal([]string{"4.0.9", "4.0.8"}, missing.OtherVersions)
+
+	_, ok = AsBuildNotFound(ErrVersionNotFound)
+	assert.False(ok)
+}
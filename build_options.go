@@ -43,6 +43,8 @@ func (o BuildOptions) Validate() error {
 
 	if o.Arch == "" {
 		errs = append(errs, "arch definition is missing")
+	} else if arch := ParseArch(string(o.Arch)); arch != o.Arch {
+		errs = append(errs, "arch '"+string(o.Arch)+"' is an alias for '"+string(arch)+"'")
 	}
 
 	if o.Edition == "" {
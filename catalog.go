@@ -10,6 +10,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/mongodb/grip"
 	"github.com/mongodb/grip/message"
@@ -20,60 +21,87 @@ import (
 // artifacts managed by bond, and provides an interface for retrieving
 // artifacts.
 type BuildCatalog struct {
-	Path  string
-	table map[BuildInfo]string
-	feed  *ArtifactsFeed
-	mutex sync.RWMutex
+	Path       string
+	table      map[BuildInfo]string
+	verified   map[string]Verification
+	provenance map[string]Provenance
+	feed       *ArtifactsFeed
+	readOnly   bool
+	// indexed is when the catalog's index was written, if the
+	// catalog was read from or written to one.
+	indexed time.Time
+	mutex   sync.RWMutex
 }
 
-// NewCatalog populates and returns a BuildCatalog object from a given path.
-func NewCatalog(ctx context.Context, path string) (*BuildCatalog, error) {
+// NewCatalog populates and returns a BuildCatalog object from a given
+// path, or from the options' cache path if the path is empty. With
+// WithReadOnlyCatalog, the catalog is read from the path's index.
+func NewCatalog(ctx context.Context, path string, opts ...Option) (*BuildCatalog, error) {
+	conf := NewConfig(opts...)
+	if path == "" {
+		path = conf.CachePath
+	}
+
 	var err error
 	path, err = filepath.Abs(path)
 	if err != nil {
 		return nil, errors.Wrap(err, "problem resolving absolute path")
 	}
 
+	if conf.ReadOnlyCatalog {
+		return newReadOnlyCatalog(path, opts...)
+	}
+
 	contents, err := getContents(path)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not find contents")
 	}
 
-	feed, err := GetArtifactsFeed(ctx, path)
+	feed, err := GetArtifactsFeed(ctx, path, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not find build feed")
 	}
 
-	cache := &BuildCatalog{
-		Path:  path,
-		feed:  feed,
-		table: map[BuildInfo]string{},
+	cache := newBuildCatalog(path)
+	cache.feed = feed
+	if err = cache.addBuilds(contents); err != nil {
+		return nil, err
 	}
 
+	return cache, nil
+}
+
+func newBuildCatalog(path string) *BuildCatalog {
+	return &BuildCatalog{
+		Path:       path,
+		table:      map[BuildInfo]string{},
+		verified:   map[string]Verification{},
+		provenance: map[string]Provenance{},
+	}
+}
+
+// addBuilds adds the builds among the contents of the catalog's
+// directory.
+func (c *BuildCatalog) addBuilds(contents []os.FileInfo) error {
 	catcher := grip.NewCatcher()
 	for _, obj := range contents {
 		if !obj.IsDir() {
 			continue
 		}
 
-		if !strings.HasPrefix(obj.Name(), "mongodb-") {
+		// the database tools share the prefix of builds, but are
+		// a separate component of a toolchain
+		if !strings.HasPrefix(obj.Name(), "mongodb-") || strings.HasPrefix(obj.Name(), "mongodb-database-tools-") {
 			continue
 		}
 
-		fileName := filepath.Join(path, obj.Name())
-
-		if err := cache.Add(fileName); err != nil {
+		if err := c.Add(filepath.Join(c.Path, obj.Name())); err != nil {
 			catcher.Add(err)
 			continue
 		}
 	}
 
-	if catcher.HasErrors() {
-		return nil, errors.Wrapf(catcher.Resolve(),
-			"problem building build catalog from path: %s", path)
-	}
-
-	return cache, nil
+	return errors.Wrapf(catcher.Resolve(), "problem building build catalog from path: %s", c.Path)
 }
 
 // Add adds a build to the catalog, and returns an error if it's not a
@@ -101,6 +129,16 @@ func (c *BuildCatalog) Add(fileName string) error {
 		return errors.Wrapf(err, "problem validating contents of %s", fileName)
 	}
 
+	verification, verified, err := ReadVerification(fileName)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	provenance, hasProvenance, err := ReadProvenance(fileName)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	if _, ok := c.table[info]; ok {
@@ -108,6 +146,12 @@ func (c *BuildCatalog) Add(fileName string) error {
 	}
 
 	c.table[info] = fileName
+	if verified {
+		c.verified[fileName] = verification
+	}
+	if hasProvenance {
+		c.provenance[fileName] = provenance
+	}
 
 	return nil
 }
@@ -125,6 +169,17 @@ func (c *BuildCatalog) Contents() map[BuildInfo]string {
 	return output
 }
 
+// Verification returns the record of the checksum that verified the
+// archive of the build at the path. The second value is false if the
+// build's archive was not verified.
+func (c *BuildCatalog) Verification(path string) (Verification, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	v, ok := c.verified[path]
+	return v, ok
+}
+
 func (c *BuildCatalog) String() string {
 	inverted := map[string]BuildInfo{}
 
@@ -209,8 +264,20 @@ func (c *BuildCatalog) Get(version, edition, target, arch string, debug bool) (s
 	defer c.mutex.RUnlock()
 
 	path, ok := c.table[info]
+	if !ok && c.feed != nil && c.feed.conf != nil && c.feed.conf.GenericLinuxFallback {
+		if generic, isLinux := genericLinuxOptions(info.Options); isLinux {
+			path, ok = c.table[BuildInfo{Version: version, Options: generic}]
+			grip.WarningWhen(ok, message.Fields{
+				"message": "falling back to generic linux build",
+				"version": version,
+				"target":  target,
+				"arch":    arch,
+				"path":    path,
+			})
+		}
+	}
 	if !ok {
-		return "", errors.Errorf("could not find version %s, edition %s, target %s, arch %s in %s",
+		return "", errors.Wrapf(ErrVersionNotFound, "could not find version %s, edition %s, target %s, arch %s in %s",
 			version, edition, target, arch, c.Path)
 	}
 
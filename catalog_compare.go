@@ -0,0 +1,251 @@
+package bond
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// archiveExtensions are the extensions of the archives that builds
+// are extracted from.
+var archiveExtensions = []string{".tgz", ".zip"}
+
+// ArchiveChecksum compares the checksum that the feed publishes for a
+// cached build's archive with the checksum of the archive on disk.
+type ArchiveChecksum struct {
+	Build   string       `bson:"build" json:"build" yaml:"build"`
+	Version string       `bson:"version" json:"version" yaml:"version"`
+	Options BuildOptions `bson:"options" json:"options" yaml:"options"`
+	// Archive is the archive that the build was extracted from, or
+	// empty if the archive is no longer in the cache.
+	Archive  string   `bson:"archive,omitempty" json:"archive,omitempty" yaml:"archive,omitempty"`
+	Expected Checksum `bson:"expected" json:"expected" yaml:"expected"`
+	Actual   Checksum `bson:"actual" json:"actual" yaml:"actual"`
+	// Verification is the record of the verification of the
+	// archive when it was downloaded, if any.
+	Verification *Verification `bson:"verification,omitempty" json:"verification,omitempty" yaml:"verification,omitempty"`
+	Error        string        `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// OK reports whether the archive matches its published checksum.
+func (s ArchiveChecksum) OK() bool {
+	return s.Error == "" && s.Actual.Value != "" && strings.EqualFold(s.Actual.Value, s.Expected.Value)
+}
+
+func (s ArchiveChecksum) String() string {
+	out := []string{fmt.Sprintf("%s (%s)", s.Version, s.Options)}
+
+	if s.Expected.Value == "" {
+		out = append(out, "  expected: not published")
+	} else {
+		out = append(out, fmt.Sprintf("  expected: %s %s", s.Expected.Algorithm, s.Expected.Value))
+	}
+
+	switch {
+	case s.Error != "":
+		out = append(out, fmt.Sprintf("  actual:   %s", s.Error))
+	case s.Archive == "":
+		out = append(out, "  actual:   archive is not in the cache")
+	default:
+		status := "match"
+		if !s.OK() {
+			status = "MISMATCH"
+		}
+		out = append(out, fmt.Sprintf("  actual:   %s %s (%s)", s.Actual.Algorithm, s.Actual.Value, status))
+	}
+
+	if s.Verification != nil {
+		by := s.Verification.Verifiers
+		if len(by) == 0 {
+			by = []string{string(s.Verification.Checksum.Algorithm)}
+		}
+		out = append(out, fmt.Sprintf("  verified: %s by %s", s.Verification.Verified.Format("2006-01-02 15:04:05"), strings.Join(by, ", ")))
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// Checksums compares the published and actual checksums of the
+// archives of the version's cached builds, and returns an error if
+// the catalog has no builds of the version. The published checksums
+// come from the catalog's feed, or, for catalogs without a feed, from
+// the builds' verification records.
+func (c *BuildCatalog) Checksums(version string) ([]ArchiveChecksum, error) {
+	out := []ArchiveChecksum{}
+
+	c.mutex.RLock()
+	for info, path := range c.table {
+		if info.Version != version {
+			continue
+		}
+
+		sum := ArchiveChecksum{Build: path, Version: info.Version, Options: info.Options}
+		if v, ok := c.verified[path]; ok {
+			sum.Verification = &v
+			sum.Expected = v.Checksum
+		}
+		out = append(out, sum)
+	}
+	c.mutex.RUnlock()
+
+	if len(out) == 0 {
+		return nil, errors.Errorf("no builds of %s in %s", version, c.Path)
+	}
+
+	var release *ArtifactVersion
+	if c.feed != nil {
+		release, _ = c.feed.GetVersion(version)
+	}
+
+	for idx := range out {
+		sum := &out[idx]
+		if release != nil {
+			if dl, err := release.GetDownload(sum.Options); err == nil {
+				if expected, ok := Strongest(dl.Checksums()); ok {
+					sum.Expected = expected
+				}
+			}
+		}
+
+		for _, ext := range archiveExtensions {
+			if _, err := os.Stat(sum.Build + ext); err == nil {
+				sum.Archive = sum.Build + ext
+				break
+			}
+		}
+		if sum.Archive == "" {
+			continue
+		}
+
+		alg := sum.Expected.Algorithm
+		if alg == "" {
+			alg = SHA256
+		}
+		actual, err := FileChecksum(sum.Archive, alg)
+		if err != nil {
+			sum.Error = err.Error()
+			continue
+		}
+		sum.Actual = actual
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Build < out[j].Build })
+
+	return out, nil
+}
+
+// BinaryInfo describes a file in the bin directory of a build.
+type BinaryInfo struct {
+	Name string `bson:"name" json:"name" yaml:"name"`
+	Size int64  `bson:"size" json:"size" yaml:"size"`
+}
+
+// GetBinaries returns the files in the bin directory of the build,
+// sorted by name.
+func GetBinaries(buildDir string) ([]BinaryInfo, error) {
+	dir := filepath.Join(buildDir, "bin")
+	contents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading binaries of %s", buildDir)
+	}
+
+	out := make([]BinaryInfo, 0, len(contents))
+	for _, info := range contents {
+		if info.IsDir() {
+			continue
+		}
+		out = append(out, BinaryInfo{Name: info.Name(), Size: info.Size()})
+	}
+
+	return out, nil
+}
+
+// BinaryChange is a binary that two builds both have, with different
+// sizes.
+type BinaryChange struct {
+	Name  string `bson:"name" json:"name" yaml:"name"`
+	SizeA int64  `bson:"size_a" json:"size_a" yaml:"size_a"`
+	SizeB int64  `bson:"size_b" json:"size_b" yaml:"size_b"`
+}
+
+// BuildComparison is the difference between the binaries of two
+// builds.
+type BuildComparison struct {
+	A       string         `bson:"a" json:"a" yaml:"a"`
+	B       string         `bson:"b" json:"b" yaml:"b"`
+	OnlyA   []BinaryInfo   `bson:"only_a" json:"only_a" yaml:"only_a"`
+	OnlyB   []BinaryInfo   `bson:"only_b" json:"only_b" yaml:"only_b"`
+	Changed []BinaryChange `bson:"changed" json:"changed" yaml:"changed"`
+	// Same are the names of the binaries that both builds have,
+	// with the same sizes.
+	Same []string `bson:"same" json:"same" yaml:"same"`
+}
+
+func (c *BuildComparison) String() string {
+	out := []string{fmt.Sprintf("--- %s", c.A), fmt.Sprintf("+++ %s", c.B)}
+
+	for _, bin := range c.OnlyA {
+		out = append(out, fmt.Sprintf("- %-24s %12d bytes", bin.Name, bin.Size))
+	}
+	for _, bin := range c.OnlyB {
+		out = append(out, fmt.Sprintf("+ %-24s %12d bytes", bin.Name, bin.Size))
+	}
+	for _, bin := range c.Changed {
+		out = append(out, fmt.Sprintf("~ %-24s %12d -> %d bytes (%+d)", bin.Name, bin.SizeA, bin.SizeB, bin.SizeB-bin.SizeA))
+	}
+	out = append(out, fmt.Sprintf("  %d binaries unchanged", len(c.Same)))
+
+	return strings.Join(out, "\n")
+}
+
+// CompareBuilds compares the binaries of two extracted builds.
+func CompareBuilds(a, b string) (*BuildComparison, error) {
+	binsA, err := GetBinaries(a)
+	if err != nil {
+		return nil, err
+	}
+	binsB, err := GetBinaries(b)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &BuildComparison{
+		A:       a,
+		B:       b,
+		OnlyA:   []BinaryInfo{},
+		OnlyB:   []BinaryInfo{},
+		Changed: []BinaryChange{},
+		Same:    []string{},
+	}
+
+	sizes := map[string]int64{}
+	for _, bin := range binsB {
+		sizes[bin.Name] = bin.Size
+	}
+
+	for _, bin := range binsA {
+		size, ok := sizes[bin.Name]
+		switch {
+		case !ok:
+			out.OnlyA = append(out.OnlyA, bin)
+		case size != bin.Size:
+			out.Changed = append(out.Changed, BinaryChange{Name: bin.Name, SizeA: bin.Size, SizeB: size})
+		default:
+			out.Same = append(out.Same, bin.Name)
+		}
+		delete(sizes, bin.Name)
+	}
+
+	for _, bin := range binsB {
+		if _, ok := sizes[bin.Name]; ok {
+			out.OnlyB = append(out.OnlyB, bin)
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,94 @@
+package bond
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatalogChecksums(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-catalog-checksums")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+
+	good := writeTestBuild(t, dir, "mongodb-linux-x86_64-enterprise-ubuntu1604-3.6.0")
+	bad := writeTestBuild(t, dir, "mongodb-linux-x86_64-ubuntu1604-3.6.0")
+	writeTestBuild(t, dir, "mongodb-linux-x86_64-ubuntu1604-3.4.0")
+	require.NoError(t, ioutil.WriteFile(good+".tgz", []byte("archive"), 0644))
+	require.NoError(t, ioutil.WriteFile(bad+".tgz", []byte("corrupt"), 0644))
+
+	sum := sha256.Sum256([]byte("archive"))
+	expected := hex.EncodeToString(sum[:])
+	require.NoError(t, WriteVerification(bad, Verification{Archive: bad + ".tgz", Checksum: Checksum{Algorithm: SHA256, Value: expected}}))
+
+	feed, err := NewArtifactsFeed(dir)
+	require.NoError(t, err)
+	require.NoError(t, feed.Reload([]byte(fmt.Sprintf(`{"versions": [{"version": "3.6.0", "downloads": [
+	  {"target": "ubuntu1604", "arch": "x86_64", "edition": "enterprise", "archive": {"url": "https://example.net/a.tgz", "sha256": "%s"}}]}]}`, expected))))
+
+	catalog := &BuildCatalog{Path: dir, feed: feed, table: map[BuildInfo]string{}, verified: map[string]Verification{}}
+	for _, path := range []string{good, bad, filepath.Join(dir, "mongodb-linux-x86_64-ubuntu1604-3.4.0")} {
+		require.NoError(t, catalog.Add(path))
+	}
+
+	sums, err := catalog.Checksums("3.6.0")
+	require.NoError(t, err)
+	require.Len(t, sums, 2)
+
+	assert.Equal(good, sums[0].Build)
+	assert.True(sums[0].OK())
+	assert.Equal(expected, sums[0].Expected.Value)
+	assert.Contains(sums[0].String(), "(match)")
+
+	assert.Equal(bad, sums[1].Build)
+	assert.False(sums[1].OK())
+	assert.Equal(expected, sums[1].Expected.Value)
+	assert.NotNil(sums[1].Verification)
+	assert.Contains(sums[1].String(), "MISMATCH")
+
+	sums, err = catalog.Checksums("3.4.0")
+	require.NoError(t, err)
+	require.Len(t, sums, 1)
+	assert.False(sums[0].OK())
+	assert.Contains(sums[0].String(), "not published")
+	assert.Contains(sums[0].String(), "archive is not in the cache")
+
+	_, err = catalog.Checksums("4.0.0")
+	assert.Error(err)
+}
+
+func TestCompareBuilds(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-compare-builds")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a := writeTestBuild(t, dir, "mongodb-linux-x86_64-ubuntu1604-3.4.0")
+	b := writeTestBuild(t, dir, "mongodb-linux-x86_64-ubuntu1604-3.6.0")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(a, "bin", "mongo"), []byte("shell"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(b, "bin", "mongodump"), []byte("tool"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(b, "bin", "mongod"), []byte("bigger binary"), 0755))
+
+	cmp, err := CompareBuilds(a, b)
+	require.NoError(t, err)
+	assert.Equal([]BinaryInfo{{Name: "mongo", Size: 5}}, cmp.OnlyA)
+	assert.Equal([]BinaryInfo{{Name: "mongodump", Size: 4}}, cmp.OnlyB)
+	assert.Equal([]BinaryChange{{Name: "mongod", SizeA: 6, SizeB: 13}}, cmp.Changed)
+	assert.Equal([]string{"mongos"}, cmp.Same)
+	assert.Contains(cmp.String(), "(+7)")
+
+	_, err = CompareBuilds(a, filepath.Join(dir, "missing"))
+	assert.Error(err)
+}
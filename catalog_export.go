@@ -0,0 +1,537 @@
+package bond
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// ExportFormat is the format of the archives that Export writes.
+type ExportFormat string
+
+// The export formats. LayerTarball, the default, is a gzipped tar
+// that a Dockerfile adds to an image (see CatalogExport's Dockerfile),
+// and OCILayout is a tar of an OCI image layout with a single image of
+// that layer, which tools such as skopeo push to a registry.
+const (
+	LayerTarball ExportFormat = "layer"
+	OCILayout    ExportFormat = "oci"
+)
+
+// DefaultExportPath is the directory, in images, of the builds that
+// Export writes, by default.
+const DefaultExportPath = "/opt/mongodb"
+
+// The media types of the OCI image that Export writes.
+const (
+	ociLayerMediaType    = "application/vnd.oci.image.layer.v1.tar+gzip"
+	ociConfigMediaType   = "application/vnd.oci.image.config.v1+json"
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+)
+
+// defaultImagePath is the PATH of images, to which the exported
+// build's bin directory is prepended.
+const defaultImagePath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// CatalogExportOptions control the export of cached builds to a
+// container image layer.
+type CatalogExportOptions struct {
+	// Versions are the releases or series (see Resolve) whose
+	// builds are exported. If there are none, every build in the
+	// catalog with the build options is exported.
+	Versions []string `bson:"versions" json:"versions" yaml:"versions"`
+	// Build selects the builds of the versions, as in Resolve, and,
+	// if there are no versions, the builds to export.
+	Build BuildOptions `bson:"build" json:"build" yaml:"build"`
+	// Path is the absolute directory of the builds in the image,
+	// and defaults to DefaultExportPath. The builds keep the names
+	// of their directories in the catalog, so the directory is
+	// a catalog in the image.
+	Path string `bson:"path" json:"path" yaml:"path"`
+	// Format defaults to LayerTarball.
+	Format ExportFormat `bson:"format" json:"format" yaml:"format"`
+	// IncludeFeed adds the catalog's feed to the layer, so that
+	// bond resolves versions in the image without downloading it.
+	IncludeFeed bool `bson:"include_feed" json:"include_feed" yaml:"include_feed"`
+	// Tag is the reference name of the image in an OCI layout,
+	// and defaults to "latest".
+	Tag string `bson:"tag" json:"tag" yaml:"tag"`
+	// ModTime is the modification time of every file in the layer,
+	// and defaults to the Unix epoch, so that exports of the same
+	// builds are identical, and images that add them share layers.
+	ModTime time.Time `bson:"mod_time" json:"mod_time" yaml:"mod_time"`
+}
+
+// Validate checks the format and path of the options, and sets their
+// defaults.
+func (opts *CatalogExportOptions) Validate() error {
+	if opts.Format == "" {
+		opts.Format = LayerTarball
+	}
+	if opts.Path == "" {
+		opts.Path = DefaultExportPath
+	}
+	if opts.Tag == "" {
+		opts.Tag = "latest"
+	}
+	if opts.ModTime.IsZero() {
+		opts.ModTime = time.Unix(0, 0)
+	}
+	opts.ModTime = opts.ModTime.UTC().Truncate(time.Second)
+
+	catcher := grip.NewBasicCatcher()
+	catcher.ErrorfWhen(opts.Format != LayerTarball && opts.Format != OCILayout, "'%s' is not a valid export format", opts.Format)
+	catcher.ErrorfWhen(!path.IsAbs(opts.Path), "export path '%s' must be absolute", opts.Path)
+	catcher.NewWhen(path.Clean(opts.Path) == "/", "cannot export builds to the root of an image")
+
+	return catcher.Resolve()
+}
+
+// CatalogExport describes the builds and the layer that Export wrote.
+type CatalogExport struct {
+	Format ExportFormat `bson:"format" json:"format" yaml:"format"`
+	// Path is the directory of the builds in the image.
+	Path string `bson:"path" json:"path" yaml:"path"`
+	// Builds are the paths of the exported builds in the image.
+	Builds []string `bson:"builds" json:"builds" yaml:"builds"`
+	// DiffID is the digest of the uncompressed layer, and Digest
+	// and Size are the digest and size of the compressed layer.
+	DiffID string `bson:"diff_id" json:"diff_id" yaml:"diff_id"`
+	Digest string `bson:"digest" json:"digest" yaml:"digest"`
+	Size   int64  `bson:"size" json:"size" yaml:"size"`
+	// Manifest is the digest of the image's manifest in an OCI
+	// layout.
+	Manifest string `bson:"manifest,omitempty" json:"manifest,omitempty" yaml:"manifest,omitempty"`
+	// Platform is the OS and architecture of the builds (e.g.
+	// linux/amd64), if they share one.
+	Platform string `bson:"platform,omitempty" json:"platform,omitempty" yaml:"platform,omitempty"`
+}
+
+func (e *CatalogExport) String() string {
+	return fmt.Sprintf("exported %d builds to %s (%s, %d bytes, %s)", len(e.Builds), e.Path, e.Format, e.Size, e.Digest)
+}
+
+// Dockerfile returns the Dockerfile instructions that add the export
+// to an image, where source is the layer's file, relative to the
+// build's context, or, for an OCI layout, the name of the image that
+// it was pushed or loaded as. With a single build, the instructions
+// also put its binaries on the PATH, as EnvExports does.
+func (e *CatalogExport) Dockerfile(source string) string {
+	lines := []string{}
+	if e.Format == OCILayout {
+		lines = append(lines, fmt.Sprintf("COPY --from=%s %s %s", source, e.Path, e.Path))
+	} else {
+		lines = append(lines, fmt.Sprintf("ADD %s /", source))
+	}
+
+	if len(e.Builds) == 1 {
+		bin := path.Join(e.Builds[0], "bin")
+		lines = append(lines,
+			fmt.Sprintf("ENV PATH=%s:$PATH", bin),
+			fmt.Sprintf("ENV %s=%s", BinariesEnvVar, bin))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Export writes the selected builds, with their files' modes and
+// links, to w as a container image layer in the options' format, so
+// that CI systems bake the builds of a catalog into their images
+// rather than downloading them in every job. The files in the layer
+// belong to root, and have the options' modification time.
+func (c *BuildCatalog) Export(ctx context.Context, w io.Writer, opts CatalogExportOptions) (*CatalogExport, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid export options")
+	}
+	imagePath := path.Clean(opts.Path)
+
+	builds, err := c.exportedBuilds(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &CatalogExport{Format: opts.Format, Path: imagePath}
+	selected := map[string]bool{}
+	for _, dir := range builds {
+		export.Builds = append(export.Builds, path.Join(imagePath, filepath.Base(dir)))
+		selected[dir] = true
+	}
+	platforms := map[string]bool{}
+	for info, dir := range c.Contents() {
+		if selected[dir] {
+			platforms[imagePlatform(info.Options)] = true
+		}
+	}
+	if len(platforms) == 1 {
+		for p := range platforms {
+			export.Platform = p
+		}
+	}
+
+	if opts.Format == LayerTarball {
+		if err = c.writeLayer(ctx, w, builds, export, opts); err != nil {
+			return nil, errors.Wrap(err, "problem writing layer")
+		}
+		return export, nil
+	}
+
+	if export.Platform == "" {
+		return nil, errors.Errorf("cannot export builds of %d platforms as one image", len(platforms))
+	}
+
+	layer, err := ioutil.TempFile("", "bond-export-layer")
+	if err != nil {
+		return nil, errors.Wrap(err, "problem creating layer file")
+	}
+	defer os.Remove(layer.Name())
+	defer layer.Close()
+
+	if err = c.writeLayer(ctx, layer, builds, export, opts); err != nil {
+		return nil, errors.Wrap(err, "problem writing layer")
+	}
+	if _, err = layer.Seek(0, io.SeekStart); err != nil {
+		return nil, errors.Wrap(err, "problem reading layer")
+	}
+
+	if err = writeOCILayout(w, layer, export, opts); err != nil {
+		return nil, errors.Wrap(err, "problem writing OCI layout")
+	}
+
+	return export, nil
+}
+
+// exportedBuilds returns the sorted directories of the builds that the
+// options select.
+func (c *BuildCatalog) exportedBuilds(opts CatalogExportOptions) ([]string, error) {
+	selected := map[string]bool{}
+	if len(opts.Versions) == 0 {
+		for info, dir := range c.Contents() {
+			if opts.Build == (BuildOptions{}) || info.Options == opts.Build {
+				selected[dir] = true
+			}
+		}
+	}
+	for _, version := range opts.Versions {
+		dir, err := c.Resolve(version, opts.Build)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem resolving %s", version)
+		}
+		selected[dir] = true
+	}
+
+	if len(selected) == 0 {
+		return nil, errors.Errorf("%s has no builds to export", c.Path)
+	}
+
+	builds := make([]string, 0, len(selected))
+	for dir := range selected {
+		builds = append(builds, dir)
+	}
+	sort.Slice(builds, func(i, j int) bool { return filepath.Base(builds[i]) < filepath.Base(builds[j]) })
+
+	return builds, nil
+}
+
+// imagePlatform returns the OCI platform (e.g. linux/amd64) of builds
+// with the options.
+func imagePlatform(opts BuildOptions) string {
+	goos := "linux"
+	switch target := strings.ToLower(opts.Target); {
+	case strings.Contains(target, "windows"):
+		goos = "windows"
+	case strings.Contains(target, "osx"), strings.Contains(target, "macos"):
+		goos = "darwin"
+	}
+
+	arch := strings.ToLower(string(opts.Arch))
+	switch opts.Arch {
+	case AMD64:
+		arch = "amd64"
+	case X86:
+		arch = "386"
+	case "aarch64", "arm64":
+		arch = "arm64"
+	}
+
+	return goos + "/" + arch
+}
+
+// digestWriter records the digest and size of the data written to it.
+type digestWriter struct {
+	io.Writer
+	hash hash.Hash
+	size int64
+}
+
+func newDigestWriter(w io.Writer) *digestWriter {
+	h := sha256.New()
+	return &digestWriter{Writer: io.MultiWriter(w, h), hash: h}
+}
+
+func (w *digestWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *digestWriter) digest() string { return "sha256:" + hex.EncodeToString(w.hash.Sum(nil)) }
+
+// writeLayer writes the gzipped tar of the builds to w, and records the
+// layer's digests in the export.
+func (c *BuildCatalog) writeLayer(ctx context.Context, w io.Writer, builds []string, export *CatalogExport, opts CatalogExportOptions) error {
+	compressed := newDigestWriter(w)
+	gz := gzip.NewWriter(compressed)
+	uncompressed := newDigestWriter(gz)
+	tw := tar.NewWriter(uncompressed)
+
+	// the parents of the export's directory
+	parts := strings.Split(strings.TrimPrefix(export.Path, "/"), "/")
+	for i := range parts {
+		if err := tw.WriteHeader(layerDir(path.Join(parts[:i+1]...), opts.ModTime)); err != nil {
+			return errors.Wrap(err, "problem writing directory")
+		}
+	}
+
+	if opts.IncludeFeed {
+		feed := filepath.Join(c.Path, "full.json")
+		info, err := os.Stat(feed)
+		if err != nil {
+			return errors.Wrapf(err, "problem finding the feed of %s", c.Path)
+		}
+		if err = addLayerFile(tw, feed, path.Join(export.Path, "full.json"), info, opts.ModTime); err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range builds {
+		root := path.Join(export.Path, filepath.Base(dir))
+		err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if ctx.Err() != nil {
+				return errors.Wrap(ctx.Err(), "operation canceled")
+			}
+
+			rel, err := filepath.Rel(dir, file)
+			if err != nil {
+				return err
+			}
+			return addLayerFile(tw, file, path.Join(root, filepath.ToSlash(rel)), info, opts.ModTime)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "problem exporting %s", dir)
+		}
+	}
+
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(tw.Close())
+	catcher.Add(gz.Close())
+	if err := catcher.Resolve(); err != nil {
+		return err
+	}
+
+	export.DiffID = uncompressed.digest()
+	export.Digest = compressed.digest()
+	export.Size = compressed.size
+
+	return nil
+}
+
+func layerDir(name string, modTime time.Time) *tar.Header {
+	return &tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name + "/",
+		Mode:     0755,
+		ModTime:  modTime,
+	}
+}
+
+// addLayerFile writes the file to the layer as name, which is an
+// absolute path in the image.
+func addLayerFile(tw *tar.Writer, file, name string, info os.FileInfo, modTime time.Time) error {
+	name = strings.TrimPrefix(name, "/")
+
+	switch {
+	case info.IsDir():
+		hdr := layerDir(name, modTime)
+		hdr.Mode = int64(info.Mode().Perm())
+		return errors.Wrapf(tw.WriteHeader(hdr), "problem writing %s", name)
+	case info.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(file)
+		if err != nil {
+			return errors.Wrapf(err, "problem reading link %s", file)
+		}
+		return errors.Wrapf(tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeSymlink,
+			Name:     name,
+			Linkname: link,
+			Mode:     0777,
+			ModTime:  modTime,
+		}), "problem writing %s", name)
+	case !info.Mode().IsRegular():
+		return errors.Errorf("cannot export %s, which is not a regular file", file)
+	}
+
+	in, err := os.Open(file)
+	if err != nil {
+		return errors.Wrapf(err, "problem opening %s", file)
+	}
+	defer in.Close()
+
+	err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(info.Mode().Perm()),
+		Size:     info.Size(),
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "problem writing %s", name)
+	}
+
+	_, err = io.Copy(tw, in)
+	return errors.Wrapf(err, "problem writing %s", name)
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType,omitempty"`
+	Config        *ociDescriptor  `json:"config,omitempty"`
+	Layers        []ociDescriptor `json:"layers,omitempty"`
+	Manifests     []ociDescriptor `json:"manifests,omitempty"`
+}
+
+type ociImageConfig struct {
+	Created      time.Time `json:"created"`
+	Architecture string    `json:"architecture"`
+	OS           string    `json:"os"`
+	Config       struct {
+		Env []string `json:"Env,omitempty"`
+	} `json:"config"`
+	RootFS struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// writeOCILayout writes a tar of an OCI image layout, whose image has
+// the single layer, to w, and records the image's manifest in the
+// export.
+func writeOCILayout(w io.Writer, layer io.Reader, export *CatalogExport, opts CatalogExportOptions) error {
+	conf := ociImageConfig{Created: opts.ModTime}
+	parts := strings.SplitN(export.Platform, "/", 2)
+	conf.OS, conf.Architecture = parts[0], parts[1]
+	conf.RootFS.Type = "layers"
+	conf.RootFS.DiffIDs = []string{export.DiffID}
+	if len(export.Builds) == 1 {
+		bin := path.Join(export.Builds[0], "bin")
+		conf.Config.Env = []string{"PATH=" + bin + ":" + defaultImagePath, BinariesEnvVar + "=" + bin}
+	}
+	confData, err := json.Marshal(conf)
+	if err != nil {
+		return errors.Wrap(err, "problem encoding image config")
+	}
+
+	manifest := ociManifest{
+		SchemaVersion: 2,
+		MediaType:     ociManifestMediaType,
+		Config:        &ociDescriptor{MediaType: ociConfigMediaType, Digest: blobDigest(confData), Size: int64(len(confData))},
+		Layers:        []ociDescriptor{{MediaType: ociLayerMediaType, Digest: export.Digest, Size: export.Size}},
+	}
+	manifestData, err := json.Marshal(manifest)
+	if err != nil {
+		return errors.Wrap(err, "problem encoding image manifest")
+	}
+	export.Manifest = blobDigest(manifestData)
+
+	indexData, err := json.Marshal(ociManifest{
+		SchemaVersion: 2,
+		Manifests: []ociDescriptor{{
+			MediaType:   ociManifestMediaType,
+			Digest:      export.Manifest,
+			Size:        int64(len(manifestData)),
+			Annotations: map[string]string{ociRefNameAnnotation: opts.Tag},
+		}},
+	})
+	if err != nil {
+		return errors.Wrap(err, "problem encoding image index")
+	}
+
+	tw := tar.NewWriter(w)
+	for _, dir := range []string{"blobs", "blobs/sha256"} {
+		if err = tw.WriteHeader(layerDir(dir, opts.ModTime)); err != nil {
+			return err
+		}
+	}
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`)},
+		{"index.json", indexData},
+		{blobName(manifest.Config.Digest), confData},
+		{blobName(export.Manifest), manifestData},
+	}
+	for _, f := range files {
+		if err = writeLayoutFile(tw, f.name, int64(len(f.data)), bytes.NewReader(f.data), opts.ModTime); err != nil {
+			return err
+		}
+	}
+	if err = writeLayoutFile(tw, blobName(export.Digest), export.Size, layer, opts.ModTime); err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+func writeLayoutFile(tw *tar.Writer, name string, size int64, r io.Reader, modTime time.Time) error {
+	err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "problem writing %s", name)
+	}
+
+	_, err = io.CopyN(tw, r, size)
+	return errors.Wrapf(err, "problem writing %s", name)
+}
+
+func blobDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func blobName(digest string) string {
+	return "blobs/sha256/" + strings.TrimPrefix(digest, "sha256:")
+}
@@ -0,0 +1,165 @@
+package bond
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tarEntry struct {
+	header *tar.Header
+	data   []byte
+}
+
+func readTestTar(t *testing.T, r io.Reader) ([]string, map[string]tarEntry) {
+	names := []string{}
+	entries := map[string]tarEntry{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(tr)
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+		entries[hdr.Name] = tarEntry{header: hdr, data: data}
+	}
+	return names, entries
+}
+
+func testDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestCatalogExport(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "bond-catalog-export")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	catalog := &BuildCatalog{Path: dir, table: map[BuildInfo]string{}, verified: map[string]Verification{}}
+	for _, name := range []string{"mongodb-linux-x86_64-ubuntu1604-3.4.0", "mongodb-linux-x86_64-ubuntu1604-3.4.1"} {
+		build := writeTestBuild(t, dir, name)
+		require.NoError(t, os.Symlink("mongod", filepath.Join(build, "bin", "mongod-link")))
+		require.NoError(t, catalog.Add(build))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "full.json"), []byte("{}"), 0644))
+
+	t.Run("Layer", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		export, err := catalog.Export(ctx, out, CatalogExportOptions{Versions: []string{"3.4"}, IncludeFeed: true})
+		require.NoError(t, err)
+		assert.Equal(LayerTarball, export.Format)
+		assert.Equal([]string{"/opt/mongodb/mongodb-linux-x86_64-ubuntu1604-3.4.1"}, export.Builds)
+		assert.Equal("linux/amd64", export.Platform)
+		assert.Equal(testDigest(out.Bytes()), export.Digest)
+		assert.Equal(int64(out.Len()), export.Size)
+		assert.Equal("ADD cache.tar.gz /\n"+
+			"ENV PATH=/opt/mongodb/mongodb-linux-x86_64-ubuntu1604-3.4.1/bin:$PATH\n"+
+			"ENV MONGODB_BINARIES=/opt/mongodb/mongodb-linux-x86_64-ubuntu1604-3.4.1/bin\n",
+			export.Dockerfile("cache.tar.gz"))
+
+		gz, err := gzip.NewReader(bytes.NewReader(out.Bytes()))
+		require.NoError(t, err)
+		layer, err := ioutil.ReadAll(gz)
+		require.NoError(t, err)
+		assert.Equal(testDigest(layer), export.DiffID)
+
+		names, entries := readTestTar(t, bytes.NewReader(layer))
+		build := "opt/mongodb/mongodb-linux-x86_64-ubuntu1604-3.4.1"
+		assert.Equal([]string{
+			"opt/", "opt/mongodb/", "opt/mongodb/full.json",
+			build + "/", build + "/bin/",
+			build + "/bin/mongod", build + "/bin/mongod-link", build + "/bin/mongos",
+		}, names)
+		for _, entry := range entries {
+			assert.Equal(0, entry.header.Uid)
+			assert.Equal(0, entry.header.Gid)
+			assert.True(entry.header.ModTime.Equal(time.Unix(0, 0)), entry.header.Name)
+		}
+		assert.Equal([]byte("binary"), entries[build+"/bin/mongod"].data)
+		assert.Equal(int64(0755), entries[build+"/bin/mongod"].header.Mode)
+		assert.Equal([]byte("{}"), entries["opt/mongodb/full.json"].data)
+		link := entries[build+"/bin/mongod-link"].header
+		assert.Equal(byte(tar.TypeSymlink), link.Typeflag)
+		assert.Equal("mongod", link.Linkname)
+
+		// exports of the same builds are identical
+		again := &bytes.Buffer{}
+		_, err = catalog.Export(ctx, again, CatalogExportOptions{Versions: []string{"3.4.1"}, IncludeFeed: true})
+		require.NoError(t, err)
+		assert.Equal(out.Bytes(), again.Bytes())
+	})
+
+	t.Run("OCILayout", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		export, err := catalog.Export(ctx, out, CatalogExportOptions{Format: OCILayout, Path: "/cache", Tag: "mongodb"})
+		require.NoError(t, err)
+		assert.Len(export.Builds, 2)
+		assert.Equal("COPY --from=ci/mongodb /cache /cache\n", export.Dockerfile("ci/mongodb"))
+
+		names, entries := readTestTar(t, out)
+		assert.Contains(names, "oci-layout")
+		for name, entry := range entries {
+			if entry.header.Typeflag == tar.TypeReg && filepath.Dir(name) == "blobs/sha256" {
+				assert.Equal("sha256:"+filepath.Base(name), testDigest(entry.data))
+			}
+		}
+
+		index := ociManifest{}
+		require.NoError(t, json.Unmarshal(entries["index.json"].data, &index))
+		require.Len(t, index.Manifests, 1)
+		assert.Equal(export.Manifest, index.Manifests[0].Digest)
+		assert.Equal("mongodb", index.Manifests[0].Annotations[ociRefNameAnnotation])
+
+		manifest := ociManifest{}
+		require.NoError(t, json.Unmarshal(entries[blobName(export.Manifest)].data, &manifest))
+		require.Len(t, manifest.Layers, 1)
+		assert.Equal(export.Digest, manifest.Layers[0].Digest)
+		assert.Equal(export.Size, manifest.Layers[0].Size)
+		assert.Len(entries[blobName(export.Digest)].data, int(export.Size))
+
+		conf := ociImageConfig{}
+		require.NoError(t, json.Unmarshal(entries[blobName(manifest.Config.Digest)].data, &conf))
+		assert.Equal("linux", conf.OS)
+		assert.Equal("amd64", conf.Architecture)
+		assert.Equal([]string{export.DiffID}, conf.RootFS.DiffIDs)
+		assert.Empty(conf.Config.Env)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		for _, opts := range []CatalogExportOptions{
+			{Format: "zip"},
+			{Path: "opt/mongodb"},
+			{Path: "/"},
+			{Versions: []string{"4.0"}},
+			{Build: BuildOptions{Target: "windows", Arch: AMD64, Edition: Base}},
+		} {
+			_, err := catalog.Export(ctx, ioutil.Discard, opts)
+			assert.Error(err, "%+v", opts)
+		}
+	})
+
+	assert.Equal("linux/arm64", imagePlatform(BuildOptions{Target: "ubuntu2004", Arch: "aarch64"}))
+	assert.Equal("darwin/amd64", imagePlatform(BuildOptions{Target: "macos", Arch: AMD64}))
+	assert.Equal("windows/amd64", imagePlatform(BuildOptions{Target: "windows", Arch: AMD64}))
+	assert.Equal("linux/s390x", imagePlatform(BuildOptions{Target: "rhel72", Arch: ZSeries}))
+}
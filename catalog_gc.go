@@ -0,0 +1,245 @@
+package bond
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+// GCMarkerFileName is the name of the file, in a catalog's directory,
+// whose modification time records the catalog's last garbage
+// collection.
+const GCMarkerFileName = ".bond-last-gc"
+
+// CatalogGCOptions control the reconciliation of a catalog with the
+// contents of its directory.
+type CatalogGCOptions struct {
+	// RemoveUnindexed removes files and directories in the
+	// catalog's directory that are not builds in the catalog,
+	// the archives of those builds, the other components of
+	// toolchains (see recall.FetchToolchain), feeds, or bond's own
+	// metadata.
+	RemoveUnindexed bool `bson:"remove_unindexed" json:"remove_unindexed" yaml:"remove_unindexed"`
+	// MinAge protects unindexed files modified more recently than
+	// this from removal, so that the garbage collection does not
+	// remove downloads or extractions that are in progress.
+	MinAge time.Duration `bson:"min_age" json:"min_age" yaml:"min_age"`
+	// DryRun reports what the garbage collection would do without
+	// changing the catalog or removing any files.
+	DryRun bool `bson:"dry_run" json:"dry_run" yaml:"dry_run"`
+}
+
+// CatalogGCReport describes the changes of a garbage collection.
+type CatalogGCReport struct {
+	// Vanished are the builds that were removed from the catalog
+	// because their directories no longer exist or are no longer
+	// valid builds.
+	Vanished []string `bson:"vanished" json:"vanished" yaml:"vanished"`
+	// Added are valid builds in the directory that were not in the
+	// catalog, and were added to it.
+	Added []string `bson:"added" json:"added" yaml:"added"`
+	// Unindexed are the files and directories that are neither
+	// builds, toolchain components, nor their archives.
+	Unindexed []string `bson:"unindexed" json:"unindexed" yaml:"unindexed"`
+	// Removed are the unindexed files that were removed.
+	Removed []string `bson:"removed" json:"removed" yaml:"removed"`
+	// BytesFreed is the size of the removed files.
+	BytesFreed int64 `bson:"bytes_freed" json:"bytes_freed" yaml:"bytes_freed"`
+	DryRun     bool  `bson:"dry_run" json:"dry_run" yaml:"dry_run"`
+}
+
+func (r *CatalogGCReport) String() string {
+	prefix := ""
+	if r.DryRun {
+		prefix = "[dry run] "
+	}
+
+	return fmt.Sprintf("%s%d vanished, %d added, %d unindexed, %d removed (%d bytes)",
+		prefix, len(r.Vanished), len(r.Added), len(r.Unindexed), len(r.Removed), r.BytesFreed)
+}
+
+// GC reconciles the catalog with the contents of its directory:
+// builds whose directories have vanished are removed from the
+// catalog, valid builds that appeared are added to it, and, if the
+// options specify, unindexed files are removed. If the catalog has an
+// index, the collection rewrites it. Read-only catalogs can only be
+// collected as a dry run.
+func (c *BuildCatalog) GC(opts CatalogGCOptions) (*CatalogGCReport, error) {
+	if c.readOnly && !opts.DryRun {
+		return nil, errors.Wrapf(ErrReadOnlyCatalog, "cannot collect %s", c.Path)
+	}
+
+	report := &CatalogGCReport{DryRun: opts.DryRun}
+
+	indexed := map[string]struct{}{}
+	c.mutex.Lock()
+	for info, path := range c.table {
+		if err := validateBuildArtifacts(path, info.Version); err == nil {
+			indexed[filepath.Base(path)] = struct{}{}
+			continue
+		}
+
+		report.Vanished = append(report.Vanished, path)
+		if !opts.DryRun {
+			delete(c.table, info)
+			delete(c.verified, path)
+			delete(c.provenance, path)
+		}
+	}
+	c.mutex.Unlock()
+
+	contents, err := ioutil.ReadDir(c.Path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading contents of %s", c.Path)
+	}
+
+	catcher := grip.NewBasicCatcher()
+	for _, obj := range contents {
+		name := obj.Name()
+		if _, ok := indexed[name]; ok || isCatalogMetadata(name) || isIndexedArchive(name, indexed) {
+			continue
+		}
+		if isComponentArtifact(name, obj.IsDir()) {
+			continue
+		}
+
+		path := filepath.Join(c.Path, name)
+		if obj.IsDir() && strings.HasPrefix(name, "mongodb-") && isBuild(path) {
+			report.Added = append(report.Added, path)
+			if !opts.DryRun {
+				catcher.Add(c.Add(path))
+			}
+			continue
+		}
+
+		report.Unindexed = append(report.Unindexed, path)
+		if !opts.RemoveUnindexed || time.Since(obj.ModTime()) < opts.MinAge {
+			continue
+		}
+
+		size := diskUsage(path)
+		report.Removed = append(report.Removed, path)
+		report.BytesFreed += size
+		if opts.DryRun {
+			continue
+		}
+
+		if err := os.RemoveAll(path); err != nil {
+			catcher.Add(errors.Wrapf(err, "problem removing %s", path))
+		}
+	}
+
+	sort.Strings(report.Vanished)
+
+	if !opts.DryRun {
+		catcher.Add(touchGCMarker(c.Path))
+		if HasCatalogIndex(c.Path) {
+			catcher.Add(c.WriteIndex(context.Background()))
+		}
+	}
+
+	grip.Info(message.Fields{
+		"message": "catalog garbage collection",
+		"path":    c.Path,
+		"report":  report.String(),
+	})
+
+	return report, catcher.Resolve()
+}
+
+func touchGCMarker(path string) error {
+	fn := filepath.Join(path, GCMarkerFileName)
+	if err := ioutil.WriteFile(fn, nil, 0644); err != nil {
+		return errors.Wrapf(err, "problem recording garbage collection in %s", fn)
+	}
+
+	now := time.Now()
+	return errors.Wrapf(os.Chtimes(fn, now, now), "problem recording garbage collection in %s", fn)
+}
+
+// LastGC returns the time of the last garbage collection of the
+// catalog in the directory. The second value is false if the catalog
+// has never been collected.
+func LastGC(path string) (time.Time, bool) {
+	stat, err := os.Stat(filepath.Join(path, GCMarkerFileName))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return stat.ModTime(), true
+}
+
+// isCatalogMetadata reports whether the file is one that bond itself
+// uses in a cache directory: feeds, the content store, and other
+// hidden files. The state files of partial downloads are collected
+// with the partial files.
+func isCatalogMetadata(name string) bool {
+	if strings.HasSuffix(name, DownloadStateFileName("")) {
+		return false
+	}
+
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, ".json")
+}
+
+func isIndexedArchive(name string, indexed map[string]struct{}) bool {
+	for _, ext := range []string{".tgz", ".zip"} {
+		if strings.HasSuffix(name, ext) {
+			_, ok := indexed[strings.TrimSuffix(name, ext)]
+			return ok
+		}
+	}
+
+	return false
+}
+
+// componentArtifactPrefixes are the prefixes of the names of the
+// archives of the toolchain components other than the server, and so
+// of the directories that they're extracted into.
+var componentArtifactPrefixes = []string{"mongodb-database-tools-", "mongosh-", "mongo_crypt_shared_v1-"}
+
+// isComponentArtifact reports whether the file is the archive of a
+// toolchain component other than the server, or its extraction, which
+// the catalog does not index.
+func isComponentArtifact(name string, isDir bool) bool {
+	if !isDir && !strings.HasSuffix(name, ".tgz") && !strings.HasSuffix(name, ".zip") {
+		return false
+	}
+
+	for _, prefix := range componentArtifactPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isBuild(path string) bool {
+	info, err := GetInfoFromFileName(path)
+	if err != nil {
+		return false
+	}
+
+	return validateBuildArtifacts(path, info.Version) == nil
+}
+
+func diskUsage(path string) int64 {
+	var size int64
+	_ = filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+
+	return size
+}
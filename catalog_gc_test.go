@@ -0,0 +1,108 @@
+package bond
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestBuild(t *testing.T, dir, name string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.MkdirAll(filepath.Join(path, "bin"), 0755))
+	for _, bin := range []string{"mongod", "mongos"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(path, "bin", bin), []byte("binary"), 0755))
+	}
+	return path
+}
+
+func TestCatalogGC(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-catalog-gc")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+
+	catalog := &BuildCatalog{Path: dir, table: map[BuildInfo]string{}, verified: map[string]Verification{}}
+	kept := writeTestBuild(t, dir, "mongodb-linux-x86_64-ubuntu1604-3.4.0")
+	vanished := writeTestBuild(t, dir, "mongodb-linux-x86_64-ubuntu1604-3.4.1")
+	require.NoError(t, catalog.Add(kept))
+	require.NoError(t, catalog.Add(vanished))
+	require.NoError(t, os.RemoveAll(vanished))
+
+	added := writeTestBuild(t, dir, "mongodb-linux-x86_64-ubuntu1604-3.4.2")
+	for name, data := range map[string]string{
+		"mongodb-linux-x86_64-ubuntu1604-3.4.0.tgz":              "archive",
+		"mongodb-linux-x86_64-ubuntu1604-3.4.1.tgz":              "orphan",
+		"mongodb-linux-x86_64-ubuntu1604-3.4.3.tgz.partial":      "part",
+		"mongodb-linux-x86_64-ubuntu1604-3.4.3.tgz.partial.json": "{}",
+		"mongosh-2.1.1-linux-x64.tgz":                            "shell",
+		"mongosh-2.1.1-linux-x64.tgz.partial":                    "part",
+		"mongodb-database-tools-ubuntu1604-x86_64-100.9.4.tgz":   "tools",
+		"full.json":          "{}",
+		VerificationFileName: "{}",
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "mongodb-linux-x86_64-ubuntu1604-3.4.4"), 0755))
+	// the other components of toolchains are not builds, but are
+	// not garbage
+	components := []string{"mongosh-2.1.1-linux-x64", "mongodb-database-tools-ubuntu1604-x86_64-100.9.4"}
+	for _, name := range components {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, name, "bin"), 0755))
+	}
+
+	report, err := catalog.GC(CatalogGCOptions{RemoveUnindexed: true, DryRun: true})
+	require.NoError(t, err)
+	assert.True(report.DryRun)
+	assert.Equal([]string{vanished}, report.Vanished)
+	assert.Equal([]string{added}, report.Added)
+	unindexed := []string{
+		filepath.Join(dir, "mongodb-linux-x86_64-ubuntu1604-3.4.1.tgz"),
+		filepath.Join(dir, "mongodb-linux-x86_64-ubuntu1604-3.4.3.tgz.partial"),
+		filepath.Join(dir, "mongodb-linux-x86_64-ubuntu1604-3.4.3.tgz.partial.json"),
+		filepath.Join(dir, "mongodb-linux-x86_64-ubuntu1604-3.4.4"),
+		filepath.Join(dir, "mongosh-2.1.1-linux-x64.tgz.partial"),
+	}
+	assert.Equal(unindexed, report.Unindexed)
+	assert.Equal(unindexed, report.Removed)
+	assert.EqualValues(len("orphan")+2*len("part")+len("{}"), report.BytesFreed)
+	assert.Len(catalog.Contents(), 2)
+	for _, path := range unindexed {
+		_, err = os.Stat(path)
+		assert.NoError(err, path)
+	}
+	_, ok := LastGC(dir)
+	assert.False(ok)
+
+	report, err = catalog.GC(CatalogGCOptions{RemoveUnindexed: true, MinAge: time.Hour})
+	require.NoError(t, err)
+	last, ok := LastGC(dir)
+	assert.True(ok)
+	assert.WithinDuration(time.Now(), last, time.Minute)
+	assert.Equal(unindexed, report.Unindexed)
+	assert.Len(report.Removed, 0)
+	assert.Len(catalog.Contents(), 2)
+	_, err = catalog.Get("3.4.2", "targeted", "ubuntu1604", "x86_64", false)
+	assert.NoError(err)
+
+	report, err = catalog.GC(CatalogGCOptions{RemoveUnindexed: true})
+	require.NoError(t, err)
+	assert.Len(report.Vanished, 0)
+	assert.Len(report.Added, 0)
+	assert.Equal(unindexed, report.Removed)
+	for _, path := range unindexed {
+		_, err = os.Stat(path)
+		assert.True(os.IsNotExist(err), path)
+	}
+	for _, name := range append(components, "full.json", VerificationFileName, "mongodb-linux-x86_64-ubuntu1604-3.4.0.tgz", "mongosh-2.1.1-linux-x64.tgz") {
+		_, err = os.Stat(filepath.Join(dir, name))
+		assert.NoError(err, name)
+	}
+}
@@ -0,0 +1,306 @@
+package bond
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+const (
+	// CatalogIndexFileName is the name of the file, in a catalog's
+	// directory, that indexes its builds, so that catalogs in
+	// other processes can read them without scanning the
+	// directory.
+	CatalogIndexFileName = ".bond-catalog.json"
+	// CatalogLockFileName is the name of the file, in a catalog's
+	// directory, that its writer holds while it writes the index.
+	CatalogLockFileName = ".bond-catalog.lock"
+	// CatalogLockStaleAge is the age after which a lock is
+	// abandoned by a writer that failed to release it, and is
+	// broken by the next writer.
+	CatalogLockStaleAge = 2 * time.Minute
+)
+
+// catalogLockPoll is how often writers check whether a held lock has
+// been released.
+const catalogLockPoll = 50 * time.Millisecond
+
+// CatalogIndex records the builds of a catalog. Builds' directories
+// are relative to the catalog's directory, so that hosts that mount a
+// shared catalog at different paths can read the same index.
+type CatalogIndex struct {
+	Written time.Time           `bson:"written" json:"written" yaml:"written"`
+	Builds  []CatalogIndexEntry `bson:"builds" json:"builds" yaml:"builds"`
+}
+
+// CatalogIndexEntry is a build in a catalog index.
+type CatalogIndexEntry struct {
+	Build        BuildInfo     `bson:"build" json:"build" yaml:"build"`
+	Directory    string        `bson:"dir" json:"dir" yaml:"dir"`
+	Verification *Verification `bson:"verification,omitempty" json:"verification,omitempty" yaml:"verification,omitempty"`
+	Provenance   *Provenance   `bson:"provenance,omitempty" json:"provenance,omitempty" yaml:"provenance,omitempty"`
+}
+
+// WithReadOnlyCatalog opens catalogs read-only, for processes that
+// share a catalog, for example on NFS, with a single writer. A
+// read-only catalog reads its builds from the catalog's index, if it
+// has one, and its feed from the catalog's directory, and never
+// writes to the directory or takes the catalog's lock: it may not
+// have the writer's latest changes until it's refreshed.
+func WithReadOnlyCatalog() Option { return func(c *Config) { c.ReadOnlyCatalog = true } }
+
+// HasCatalogIndex reports whether the catalog in the directory has an
+// index.
+func HasCatalogIndex(path string) bool {
+	_, err := os.Stat(filepath.Join(path, CatalogIndexFileName))
+	return err == nil
+}
+
+// ReadCatalogIndex reads the index of the catalog in the directory.
+// The second value is false if the catalog has no index.
+func ReadCatalogIndex(path string) (CatalogIndex, bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(path, CatalogIndexFileName))
+	if os.IsNotExist(err) {
+		return CatalogIndex{}, false, nil
+	}
+	if err != nil {
+		return CatalogIndex{}, false, errors.Wrapf(err, "problem reading catalog index for %s", path)
+	}
+
+	idx := CatalogIndex{}
+	if err = json.Unmarshal(data, &idx); err != nil {
+		return CatalogIndex{}, false, errors.Wrapf(err, "problem parsing catalog index for %s", path)
+	}
+
+	return idx, true, nil
+}
+
+// WriteCatalogIndex indexes the builds in the directory, without a
+// feed, and writes the index, holding the catalog's lock.
+func WriteCatalogIndex(ctx context.Context, path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return errors.Wrap(err, "problem resolving absolute path")
+	}
+
+	contents, err := getContents(path)
+	if err != nil {
+		return errors.Wrap(err, "could not find contents")
+	}
+
+	c := newBuildCatalog(path)
+	if err = c.addBuilds(contents); err != nil {
+		return err
+	}
+
+	return c.WriteIndex(ctx)
+}
+
+// LockCatalog takes the lock of the catalog in the directory, waiting
+// until the lock is released or the context is done, and returns a
+// function that releases it. Locks are files created exclusively, so
+// that they exclude writers on other hosts that share the directory
+// over NFS. Locks older than CatalogLockStaleAge are broken.
+func LockCatalog(ctx context.Context, path string) (func() error, error) {
+	fn := filepath.Join(path, CatalogLockFileName)
+	host, _ := os.Hostname()
+	holder := fmt.Sprintf("%s:%d", host, os.Getpid())
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			data, _ := ioutil.ReadFile(fn)
+			return nil, errors.Wrapf(ctx.Err(), "problem taking catalog lock %s, held by %s", fn, string(data))
+		case <-timer.C:
+		}
+
+		f, err := os.OpenFile(fn, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = f.WriteString(holder)
+			catcher := grip.NewBasicCatcher()
+			catcher.Add(err)
+			catcher.Add(f.Close())
+			if catcher.HasErrors() {
+				grip.Warning(os.Remove(fn))
+				return nil, errors.Wrapf(catcher.Resolve(), "problem writing catalog lock %s", fn)
+			}
+
+			return func() error {
+				return errors.Wrapf(os.Remove(fn), "problem releasing catalog lock %s", fn)
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, errors.Wrapf(err, "problem taking catalog lock %s", fn)
+		}
+
+		if stat, err := os.Stat(fn); err == nil && time.Since(stat.ModTime()) > CatalogLockStaleAge {
+			data, _ := ioutil.ReadFile(fn)
+			grip.Warning(message.Fields{
+				"message": "breaking stale catalog lock",
+				"lock":    fn,
+				"holder":  string(data),
+				"age":     time.Since(stat.ModTime()).String(),
+			})
+			grip.Warning(os.Remove(fn))
+			timer.Reset(0)
+			continue
+		}
+
+		timer.Reset(catalogLockPoll)
+	}
+}
+
+// ReadOnly reports whether the catalog was opened read-only.
+func (c *BuildCatalog) ReadOnly() bool { return c.readOnly }
+
+// Index returns the index of the catalog's builds, sorted by their
+// directories.
+func (c *BuildCatalog) Index() CatalogIndex {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	idx := CatalogIndex{Written: c.indexed, Builds: []CatalogIndexEntry{}}
+	for info, path := range c.table {
+		entry := CatalogIndexEntry{Build: info, Directory: filepath.Base(path)}
+		if v, ok := c.verified[path]; ok {
+			entry.Verification = &v
+		}
+		if p, ok := c.provenance[path]; ok {
+			entry.Provenance = &p
+		}
+		idx.Builds = append(idx.Builds, entry)
+	}
+	sort.Slice(idx.Builds, func(i, j int) bool { return idx.Builds[i].Directory < idx.Builds[j].Directory })
+
+	return idx
+}
+
+// WriteIndex writes the index of the catalog's builds to its
+// directory, holding the catalog's lock. The index replaces the
+// previous index at once, so that readers read either index in full.
+func (c *BuildCatalog) WriteIndex(ctx context.Context) error {
+	if c.readOnly {
+		return errors.Wrapf(ErrReadOnlyCatalog, "cannot write the index of %s", c.Path)
+	}
+
+	unlock, err := LockCatalog(ctx, c.Path)
+	if err != nil {
+		return err
+	}
+	defer func() { grip.Warning(unlock()) }()
+
+	idx := c.Index()
+	idx.Written = time.Now()
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return errors.Wrap(err, "problem converting catalog index to json")
+	}
+
+	tmp, err := ioutil.TempFile(c.Path, CatalogIndexFileName+".")
+	if err != nil {
+		return errors.Wrapf(err, "problem writing catalog index for %s", c.Path)
+	}
+
+	_, err = tmp.Write(data)
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(err)
+	catcher.Add(tmp.Sync())
+	catcher.Add(tmp.Close())
+	if !catcher.HasErrors() {
+		catcher.Add(os.Rename(tmp.Name(), filepath.Join(c.Path, CatalogIndexFileName)))
+	}
+	if catcher.HasErrors() {
+		grip.Warning(os.Remove(tmp.Name()))
+		return errors.Wrapf(catcher.Resolve(), "problem writing catalog index for %s", c.Path)
+	}
+
+	c.mutex.Lock()
+	c.indexed = idx.Written
+	c.mutex.Unlock()
+
+	return nil
+}
+
+// Refresh reloads the catalog's builds from its index, or, if it
+// has no index, from the contents of its directory. Builds in the
+// index whose directories no longer exist are skipped, because the
+// writer removed them after it wrote the index.
+func (c *BuildCatalog) Refresh() error {
+	idx, ok, err := ReadCatalogIndex(c.Path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	fresh := newBuildCatalog(c.Path)
+	if ok {
+		fresh.indexed = idx.Written
+		for _, entry := range idx.Builds {
+			path := filepath.Join(c.Path, filepath.Base(entry.Directory))
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+
+			fresh.table[entry.Build] = path
+			if entry.Verification != nil {
+				fresh.verified[path] = *entry.Verification
+			}
+			if entry.Provenance != nil {
+				fresh.provenance[path] = *entry.Provenance
+			}
+		}
+	} else {
+		contents, err := getContents(c.Path)
+		if err != nil {
+			return errors.Wrap(err, "could not find contents")
+		}
+		if err = fresh.addBuilds(contents); err != nil {
+			return err
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.table = fresh.table
+	c.verified = fresh.verified
+	c.provenance = fresh.provenance
+	c.indexed = fresh.indexed
+
+	return nil
+}
+
+// newReadOnlyCatalog opens the catalog in the directory read-only,
+// with the feed in the directory.
+func newReadOnlyCatalog(path string, opts ...Option) (*BuildCatalog, error) {
+	feed, err := NewArtifactsFeed(path, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem building feed")
+	}
+
+	data, err := ioutil.ReadFile(feed.path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read-only catalog %s has no feed", path)
+	}
+	if err = feed.Reload(data); err != nil {
+		return nil, errors.Wrap(err, "problem reloading feed")
+	}
+
+	c := newBuildCatalog(path)
+	c.feed = feed
+	c.readOnly = true
+	if err = c.Refresh(); err != nil {
+		return nil, errors.Wrapf(err, "problem reading catalog %s", path)
+	}
+
+	return c, nil
+}
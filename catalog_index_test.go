@@ -0,0 +1,150 @@
+package bond
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSharedCatalogDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "bond-catalog-index")
+	require.NoError(t, err)
+	dir, err = filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+
+	// a current feed, so that catalogs do not download one
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "full.json"), []byte(`{"versions": []}`), 0644))
+	return dir
+}
+
+func TestReadOnlyCatalog(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir := newTestSharedCatalogDir(t)
+	defer os.RemoveAll(dir)
+	first := writeTestBuild(t, dir, "mongodb-linux-x86_64-ubuntu1604-3.4.0")
+	require.NoError(t, WriteVerification(first, Verification{Archive: "mongodb-linux-x86_64-ubuntu1604-3.4.0.tgz", Checksum: Checksum{Algorithm: SHA256, Value: "abc"}}))
+
+	writer, err := NewCatalog(ctx, dir)
+	require.NoError(t, err)
+	assert.False(writer.ReadOnly())
+	require.NoError(t, writer.WriteIndex(ctx))
+	assert.True(HasCatalogIndex(dir))
+	_, err = os.Stat(filepath.Join(dir, CatalogLockFileName))
+	assert.True(os.IsNotExist(err))
+
+	// a build that the writer has not indexed is not visible to
+	// readers, which read the index rather than the directory
+	second := writeTestBuild(t, dir, "mongodb-linux-x86_64-ubuntu1604-3.4.1")
+	reader, err := NewCatalog(ctx, dir, WithReadOnlyCatalog())
+	require.NoError(t, err)
+	assert.True(reader.ReadOnly())
+	assert.Equal(map[BuildInfo]string{mustInfo(t, first): first}, reader.Contents())
+	v, ok := reader.Verification(first)
+	assert.True(ok)
+	assert.Equal("abc", v.Checksum.Value)
+
+	require.NoError(t, writer.Add(second))
+	require.NoError(t, writer.WriteIndex(ctx))
+	require.NoError(t, reader.Refresh())
+	assert.Len(reader.Contents(), 2)
+	info := mustInfo(t, second)
+	path, err := reader.Get(info.Version, string(info.Options.Edition), info.Options.Target, string(info.Options.Arch), false)
+	require.NoError(t, err)
+	assert.Equal(second, path)
+
+	// readers skip builds that were removed after the index was
+	// written, and cannot change the catalog
+	require.NoError(t, os.RemoveAll(first))
+	require.NoError(t, reader.Refresh())
+	assert.Len(reader.Contents(), 1)
+	assert.True(Is(reader.WriteIndex(ctx), ErrReadOnlyCatalog))
+	_, err = reader.GC(CatalogGCOptions{})
+	assert.True(Is(err, ErrReadOnlyCatalog))
+	report, err := reader.GC(CatalogGCOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.Len(report.Vanished, 0)
+
+	// the writer's collection rewrites the index
+	report, err = writer.GC(CatalogGCOptions{})
+	require.NoError(t, err)
+	assert.Equal([]string{first}, report.Vanished)
+	idx, ok, err := ReadCatalogIndex(dir)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Len(t, idx.Builds, 1)
+	assert.Equal(filepath.Base(second), idx.Builds[0].Directory)
+}
+
+func TestReadOnlyCatalogWithoutIndex(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir := newTestSharedCatalogDir(t)
+	defer os.RemoveAll(dir)
+	build := writeTestBuild(t, dir, "mongodb-linux-x86_64-ubuntu1604-3.4.0")
+
+	reader, err := NewCatalog(ctx, dir, WithReadOnlyCatalog())
+	require.NoError(t, err)
+	assert.Len(reader.Contents(), 1)
+	assert.False(HasCatalogIndex(dir))
+
+	require.NoError(t, WriteCatalogIndex(ctx, dir))
+	idx, ok, err := ReadCatalogIndex(dir)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal([]CatalogIndexEntry{{Build: mustInfo(t, build), Directory: filepath.Base(build)}}, idx.Builds)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "full.json")))
+	_, err = NewCatalog(ctx, dir, WithReadOnlyCatalog())
+	assert.Error(err)
+}
+
+func TestLockCatalog(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "bond-catalog-lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	unlock, err := LockCatalog(ctx, dir)
+	require.NoError(t, err)
+
+	tctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err = LockCatalog(tctx, dir)
+	require.Error(t, err)
+	assert.Contains(err.Error(), "held by")
+
+	// a waiting writer takes the lock once it's released
+	released := make(chan error)
+	go func() {
+		time.Sleep(2 * catalogLockPoll)
+		released <- unlock()
+	}()
+	waited, err := LockCatalog(ctx, dir)
+	require.NoError(t, err)
+	assert.NoError(<-released)
+
+	// abandoned locks are broken
+	stale := time.Now().Add(-2 * CatalogLockStaleAge)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, CatalogLockFileName), stale, stale))
+	again, err := LockCatalog(ctx, dir)
+	require.NoError(t, err)
+	assert.NoError(again())
+	assert.Error(waited())
+}
+
+func mustInfo(t *testing.T, path string) BuildInfo {
+	info, err := GetInfoFromFileName(path)
+	require.NoError(t, err)
+	return info
+}
@@ -0,0 +1,123 @@
+package bond
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// UsageStats is the number and size of a group of builds.
+type UsageStats struct {
+	Builds int   `bson:"builds" json:"builds" yaml:"builds"`
+	Bytes  int64 `bson:"bytes" json:"bytes" yaml:"bytes"`
+}
+
+// CachedBuild describes a build in a catalog.
+type CachedBuild struct {
+	Path     string    `bson:"path" json:"path" yaml:"path"`
+	Version  string    `bson:"version" json:"version" yaml:"version"`
+	Modified time.Time `bson:"modified" json:"modified" yaml:"modified"`
+}
+
+// CatalogStats describes the disk usage of a catalog's builds.
+type CatalogStats struct {
+	Path  string     `bson:"path" json:"path" yaml:"path"`
+	Total UsageStats `bson:"total" json:"total" yaml:"total"`
+	// BySeries and ByEdition group the builds by release series
+	// (e.g. 4.4) and by edition.
+	BySeries  map[string]UsageStats `bson:"by_series" json:"by_series" yaml:"by_series"`
+	ByEdition map[string]UsageStats `bson:"by_edition" json:"by_edition" yaml:"by_edition"`
+	// Oldest and Newest are the builds with the oldest and newest
+	// modification times, or nil if the catalog has no builds.
+	Oldest      *CachedBuild      `bson:"oldest,omitempty" json:"oldest,omitempty" yaml:"oldest,omitempty"`
+	Newest      *CachedBuild      `bson:"newest,omitempty" json:"newest,omitempty" yaml:"newest,omitempty"`
+	Quarantined []QuarantinedFile `bson:"quarantined" json:"quarantined" yaml:"quarantined"`
+	// LastGC is the time of the catalog's last garbage collection,
+	// or zero if it has never been collected.
+	LastGC time.Time `bson:"last_gc" json:"last_gc" yaml:"last_gc"`
+}
+
+func (s *CatalogStats) String() string {
+	out := []string{fmt.Sprintf("%s: %d builds, %d bytes", s.Path, s.Total.Builds, s.Total.Bytes)}
+
+	for _, group := range []struct {
+		name  string
+		usage map[string]UsageStats
+	}{{"series", s.BySeries}, {"edition", s.ByEdition}} {
+		keys := make([]string, 0, len(group.usage))
+		for k := range group.usage {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			out = append(out, fmt.Sprintf("  %s %-12s %4d builds %14d bytes", group.name, k, group.usage[k].Builds, group.usage[k].Bytes))
+		}
+	}
+
+	if s.Oldest != nil {
+		out = append(out, fmt.Sprintf("  oldest: %s (%s)", s.Oldest.Version, s.Oldest.Modified.Format(time.RFC3339)))
+		out = append(out, fmt.Sprintf("  newest: %s (%s)", s.Newest.Version, s.Newest.Modified.Format(time.RFC3339)))
+	}
+
+	out = append(out, fmt.Sprintf("  quarantined: %d files", len(s.Quarantined)))
+	for _, q := range s.Quarantined {
+		out = append(out, fmt.Sprintf("    %s (%d bytes)", q.Path, q.Size))
+	}
+
+	if s.LastGC.IsZero() {
+		out = append(out, "  last garbage collection: never")
+	} else {
+		out = append(out, fmt.Sprintf("  last garbage collection: %s", s.LastGC.Format(time.RFC3339)))
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// Stats reports the disk usage of the catalog's builds, and the files
+// in the quarantine of the catalog's directory.
+func (c *BuildCatalog) Stats() (*CatalogStats, error) {
+	stats := &CatalogStats{
+		Path:      c.Path,
+		BySeries:  map[string]UsageStats{},
+		ByEdition: map[string]UsageStats{},
+	}
+
+	c.mutex.RLock()
+	for info, path := range c.table {
+		size := diskUsage(path)
+		build := &CachedBuild{Path: path, Version: info.Version}
+		if stat, err := os.Stat(path); err == nil {
+			build.Modified = stat.ModTime()
+		}
+
+		add := func(usage map[string]UsageStats, key string) {
+			u := usage[key]
+			u.Builds++
+			u.Bytes += size
+			usage[key] = u
+		}
+		add(stats.BySeries, releaseSeries(info.Version))
+		add(stats.ByEdition, string(info.Options.Edition))
+		stats.Total.Builds++
+		stats.Total.Bytes += size
+
+		if stats.Oldest == nil || build.Modified.Before(stats.Oldest.Modified) {
+			stats.Oldest = build
+		}
+		if stats.Newest == nil || build.Modified.After(stats.Newest.Modified) {
+			stats.Newest = build
+		}
+	}
+	c.mutex.RUnlock()
+
+	var err error
+	if stats.Quarantined, err = GetQuarantinedFiles(c.Path); err != nil {
+		return nil, err
+	}
+	stats.LastGC, _ = LastGC(c.Path)
+
+	return stats, nil
+}
@@ -0,0 +1,52 @@
+package bond
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatalogStats(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-catalog-stats")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	catalog := &BuildCatalog{Path: dir, table: map[BuildInfo]string{}, verified: map[string]Verification{}}
+	stats, err := catalog.Stats()
+	require.NoError(t, err)
+	assert.Equal(0, stats.Total.Builds)
+	assert.Nil(stats.Oldest)
+	assert.Contains(stats.String(), "last garbage collection: never")
+
+	old := writeTestBuild(t, dir, "mongodb-linux-x86_64-ubuntu1604-3.4.0")
+	require.NoError(t, os.Chtimes(old, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)))
+	writeTestBuild(t, dir, "mongodb-linux-x86_64-ubuntu1604-3.4.1")
+	writeTestBuild(t, dir, "mongodb-linux-x86_64-enterprise-ubuntu1604-3.6.0")
+	for _, name := range []string{"mongodb-linux-x86_64-ubuntu1604-3.4.0", "mongodb-linux-x86_64-ubuntu1604-3.4.1", "mongodb-linux-x86_64-enterprise-ubuntu1604-3.6.0"} {
+		require.NoError(t, catalog.Add(filepath.Join(dir, name)))
+	}
+
+	fn := filepath.Join(dir, "mongodb-linux-x86_64-ubuntu1604-3.6.1.tgz")
+	require.NoError(t, ioutil.WriteFile(fn, []byte("corrupt"), 0644))
+	_, err = Quarantine(fn)
+	require.NoError(t, err)
+
+	stats, err = catalog.Stats()
+	require.NoError(t, err)
+	assert.Equal(3, stats.Total.Builds)
+	assert.EqualValues(6*len("binary"), stats.Total.Bytes)
+	assert.Equal(2, stats.BySeries["3.4"].Builds)
+	assert.EqualValues(2*len("binary"), stats.BySeries["3.6"].Bytes)
+	assert.Equal(1, stats.ByEdition[string(Enterprise)].Builds)
+	assert.Equal("3.4.0", stats.Oldest.Version)
+	assert.NotEqual("3.4.0", stats.Newest.Version)
+	require.Len(t, stats.Quarantined, 1)
+	assert.Contains(stats.String(), "quarantined: 1 files")
+}
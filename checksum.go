@@ -0,0 +1,214 @@
+package bond
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ChecksumAlgorithm names a hash function used to publish checksums
+// of build archives.
+type ChecksumAlgorithm string
+
+// The supported checksum algorithms. Older releases in the feed only
+// publish MD5 or SHA1 checksums.
+const (
+	SHA512 ChecksumAlgorithm = "sha512"
+	SHA256 ChecksumAlgorithm = "sha256"
+	SHA1   ChecksumAlgorithm = "sha1"
+	MD5    ChecksumAlgorithm = "md5"
+)
+
+// ChecksumAlgorithms lists the supported algorithms, strongest first.
+var ChecksumAlgorithms = []ChecksumAlgorithm{SHA512, SHA256, SHA1, MD5}
+
+func (a ChecksumAlgorithm) hash() (hash.Hash, error) {
+	switch a {
+	case SHA512:
+		return sha512.New(), nil
+	case SHA256:
+		return sha256.New(), nil
+	case SHA1:
+		return sha1.New(), nil
+	case MD5:
+		return md5.New(), nil
+	default:
+		return nil, errors.Errorf("'%s' is not a supported checksum algorithm", a)
+	}
+}
+
+// Checksum is a published checksum of a file.
+type Checksum struct {
+	Algorithm ChecksumAlgorithm `bson:"algorithm" json:"algorithm" yaml:"algorithm"`
+	Value     string            `bson:"value" json:"value" yaml:"value"`
+}
+
+// FileChecksum computes the checksum of the file.
+func FileChecksum(fileName string, alg ChecksumAlgorithm) (Checksum, error) {
+	h, err := alg.hash()
+	if err != nil {
+		return Checksum{}, err
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return Checksum{}, errors.Wrapf(err, "problem opening %s", fileName)
+	}
+	defer f.Close()
+
+	if _, err = io.Copy(h, f); err != nil {
+		return Checksum{}, errors.Wrapf(err, "problem computing %s checksum of %s", alg, fileName)
+	}
+
+	return Checksum{Algorithm: alg, Value: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// Strongest returns the checksum with the strongest supported
+// algorithm. The second value is false if none of the checksums use a
+// supported algorithm.
+func Strongest(sums []Checksum) (Checksum, bool) {
+	for _, alg := range ChecksumAlgorithms {
+		for _, sum := range sums {
+			if sum.Algorithm == alg && sum.Value != "" {
+				return sum, true
+			}
+		}
+	}
+
+	return Checksum{}, false
+}
+
+// VerifyFile checks the file against the strongest of the checksums,
+// and returns the checksum that it verified. VerifyFile returns an
+// error wrapping ErrChecksumMismatch if the file does not match.
+func VerifyFile(fileName string, sums []Checksum) (Checksum, error) {
+	expected, ok := Strongest(sums)
+	if !ok {
+		return Checksum{}, errors.Errorf("no supported checksums to verify %s", fileName)
+	}
+
+	actual, err := FileChecksum(fileName, expected.Algorithm)
+	if err != nil {
+		return Checksum{}, err
+	}
+
+	if !strings.EqualFold(actual.Value, expected.Value) {
+		return Checksum{}, errors.Wrapf(ErrChecksumMismatch, "%s has %s checksum %s, expected %s",
+			fileName, expected.Algorithm, actual.Value, expected.Value)
+	}
+
+	return expected, nil
+}
+
+// Checksums returns the checksums that the feed publishes for the
+// download's archive, strongest first.
+func (dl ArtifactDownload) Checksums() []Checksum {
+	return publishedChecksums(dl.Archive.Sha512, dl.Archive.Sha256, dl.Archive.Sha1, dl.Archive.Md5)
+}
+
+// CryptSharedChecksums returns the checksums that the feed publishes
+// for the build's crypt_shared archive, strongest first.
+func (dl ArtifactDownload) CryptSharedChecksums() []Checksum {
+	return publishedChecksums(dl.CryptShared.Sha512, dl.CryptShared.Sha256, dl.CryptShared.Sha1, dl.CryptShared.Md5)
+}
+
+func publishedChecksums(sha512, sha256, sha1, md5 string) []Checksum {
+	out := []Checksum{}
+	for _, sum := range []Checksum{
+		{Algorithm: SHA512, Value: sha512},
+		{Algorithm: SHA256, Value: sha256},
+		{Algorithm: SHA1, Value: sha1},
+		{Algorithm: MD5, Value: md5},
+	} {
+		if sum.Value != "" {
+			out = append(out, sum)
+		}
+	}
+
+	return out
+}
+
+// Checksums returns the checksums that the feed publishes for the
+// archive (or crypt_shared archive) at the URL, or nil if the URL is
+// not in the feed. URLs
+// rendered by a URLOverride have the checksums of the archive that
+// they replace.
+func (feed *ArtifactsFeed) Checksums(url string) []Checksum {
+	feed.mutex.RLock()
+	defer feed.mutex.RUnlock()
+
+	for _, version := range feed.Versions {
+		for _, dl := range version.Downloads {
+			if dl.Archive.URL == url || feed.conf.MirrorURL(dl.Archive.URL) == url {
+				return dl.Checksums()
+			}
+			if overrideDownload(version.Version, dl.GetBuildOptions(), dl).Archive.URL == url {
+				return dl.Checksums()
+			}
+			if crypt := dl.CryptShared.URL; crypt != "" && (crypt == url || feed.conf.MirrorURL(crypt) == url) {
+				return dl.CryptSharedChecksums()
+			}
+		}
+	}
+
+	return nil
+}
+
+// VerificationFileName is the name of the file, within an extracted
+// build, that records how its archive was verified.
+const VerificationFileName = ".bond-verification.json"
+
+// Verification records how a build's archive was verified: the
+// checksum that verified it, if any, the verifiers that checked it,
+// and the verifiers that had nothing to check.
+type Verification struct {
+	Archive   string    `bson:"archive" json:"archive" yaml:"archive"`
+	Checksum  Checksum  `bson:"checksum" json:"checksum" yaml:"checksum"`
+	Verifiers []string  `bson:"verifiers,omitempty" json:"verifiers,omitempty" yaml:"verifiers,omitempty"`
+	Skipped   []string  `bson:"skipped,omitempty" json:"skipped,omitempty" yaml:"skipped,omitempty"`
+	Verified  time.Time `bson:"verified" json:"verified" yaml:"verified"`
+}
+
+// WriteVerification records the verification in the extracted build
+// directory, where the catalog reads it.
+func WriteVerification(buildDir string, v Verification) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "problem converting verification to json")
+	}
+
+	fn := filepath.Join(buildDir, VerificationFileName)
+	return errors.Wrapf(ioutil.WriteFile(fn, data, 0644), "problem writing %s", fn)
+}
+
+// ReadVerification reads the verification recorded in the extracted
+// build directory. The second value is false if the build has no
+// recorded verification.
+func ReadVerification(buildDir string) (Verification, bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(buildDir, VerificationFileName))
+	if os.IsNotExist(err) {
+		return Verification{}, false, nil
+	}
+	if err != nil {
+		return Verification{}, false, errors.Wrapf(err, "problem reading verification for %s", buildDir)
+	}
+
+	v := Verification{}
+	if err = json.Unmarshal(data, &v); err != nil {
+		return Verification{}, false, errors.Wrapf(err, "problem parsing verification for %s", buildDir)
+	}
+
+	return v, true, nil
+}
@@ -0,0 +1,96 @@
+package bond
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checksums of "hello"
+const (
+	helloMD5    = "5d41402abc4b2a76b9719d911017c592"
+	helloSHA1   = "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434d"
+	helloSHA256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+)
+
+func TestVerifyFileUsesStrongestChecksum(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-checksum")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "a.tgz")
+	require.NoError(t, ioutil.WriteFile(fn, []byte("hello"), 0644))
+
+	for _, alg := range ChecksumAlgorithms {
+		sum, err := FileChecksum(fn, alg)
+		require.NoError(t, err)
+		assert.Equal(alg, sum.Algorithm)
+	}
+	_, err = FileChecksum(fn, "crc32")
+	assert.Error(err)
+
+	sum, err := VerifyFile(fn, []Checksum{{MD5, helloMD5}, {SHA1, helloSHA1}})
+	require.NoError(t, err)
+	assert.Equal(SHA1, sum.Algorithm)
+
+	sum, err = VerifyFile(fn, []Checksum{{MD5, helloMD5}})
+	require.NoError(t, err)
+	assert.Equal(MD5, sum.Algorithm)
+
+	// a weaker checksum that matches does not rescue a stronger
+	// one that doesn't
+	_, err = VerifyFile(fn, []Checksum{{MD5, helloMD5}, {SHA256, helloSHA1}})
+	assert.True(Is(err, ErrChecksumMismatch))
+
+	_, err = VerifyFile(fn, []Checksum{{"crc32", "abc"}})
+	assert.Error(err)
+	assert.False(Is(err, ErrChecksumMismatch))
+}
+
+func TestFeedChecksums(t *testing.T) {
+	assert := assert.New(t)
+
+	feed, err := NewArtifactsFeed("")
+	require.NoError(t, err)
+	defer os.RemoveAll(feed.dir)
+	require.NoError(t, feed.Reload([]byte(`{"versions": [
+  {"version": "2.6.0", "downloads": [{"target": "linux", "arch": "x86_64", "edition": "base",
+    "archive": {"url": "https://example.net/old.tgz", "md5": "`+helloMD5+`"}}]},
+  {"version": "4.0.0", "downloads": [{"target": "linux", "arch": "x86_64", "edition": "base",
+    "archive": {"url": "https://example.net/new.tgz", "sha1": "`+helloSHA1+`", "sha256": "`+helloSHA256+`"}}]}
+]}`)))
+
+	assert.Equal([]Checksum{{MD5, helloMD5}}, feed.Checksums("https://example.net/old.tgz"))
+	assert.Equal([]Checksum{{SHA256, helloSHA256}, {SHA1, helloSHA1}}, feed.Checksums("https://example.net/new.tgz"))
+	assert.Nil(feed.Checksums("https://example.net/missing.tgz"))
+}
+
+func TestVerificationRecords(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-checksum")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	_, ok, err := ReadVerification(dir)
+	assert.NoError(err)
+	assert.False(ok)
+
+	v := Verification{Archive: "a.tgz", Checksum: Checksum{SHA1, helloSHA1}, Verified: time.Now().UTC().Round(time.Second)}
+	require.NoError(t, WriteVerification(dir, v))
+
+	out, ok, err := ReadVerification(dir)
+	require.NoError(t, err)
+	assert.True(ok)
+	assert.Equal(v, out)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, VerificationFileName), []byte("{"), 0644))
+	_, _, err = ReadVerification(dir)
+	assert.Error(err)
+}
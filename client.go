@@ -0,0 +1,199 @@
+package bond
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultUserAgent is the User-Agent of the requests that bond makes
+// for feeds and artifacts, unless the client options set one.
+const DefaultUserAgent = "bond"
+
+// ClientOptions configure the requests that bond makes for feeds and
+// artifacts, so that the operators of mirrors can attribute traffic
+// to the processes that make it.
+type ClientOptions struct {
+	// UserAgent replaces the default User-Agent.
+	UserAgent string `bson:"user_agent" json:"user_agent" yaml:"user_agent"`
+	// Header is added to every request, for tags such as a build
+	// ID or a team name. Headers that a request sets explicitly
+	// take precedence.
+	Header map[string]string `bson:"header" json:"header" yaml:"header"`
+	// AllowedHosts, if specified, are the only hosts that requests
+	// may be made to, so that a queue that runs jobs from
+	// untrusted submitters can't be used to make requests to
+	// internal services. Entries are host names or addresses,
+	// without ports, and entries that start with "*." also allow
+	// every subdomain; redirects must also be to allowed hosts.
+	// The hosts apply to the pooled clients, and to the requests
+	// of every Config, whatever its client (see
+	// Config.AllowedHosts).
+	AllowedHosts []string `bson:"allowed_hosts" json:"allowed_hosts" yaml:"allowed_hosts"`
+}
+
+// ErrHostNotAllowed is the cause of the errors of requests to hosts
+// that the client options, or a Config, do not allow.
+var ErrHostNotAllowed = errors.New("host not allowed")
+
+// Validate checks that the header names and values, and the allowed
+// hosts, are valid.
+func (opts ClientOptions) Validate() error {
+	for k, v := range opts.Header {
+		if k == "" || strings.ContainsAny(k, " :\r\n") {
+			return errors.Errorf("'%s' is not a valid header name", k)
+		}
+		if strings.ContainsAny(v, "\r\n") {
+			return errors.Errorf("value of header '%s' is not valid", k)
+		}
+	}
+
+	if strings.ContainsAny(opts.UserAgent, "\r\n") {
+		return errors.New("user agent is not valid")
+	}
+
+	for _, host := range opts.AllowedHosts {
+		name := strings.TrimPrefix(host, "*.")
+		if name == "" || (net.ParseIP(name) == nil && strings.ContainsAny(name, "*/:@[] \r\n")) {
+			return errors.Errorf("'%s' is not a valid allowed host", host)
+		}
+	}
+
+	return nil
+}
+
+// HostAllowed reports whether requests may be made to the host (with
+// or without a port): every host is allowed if the options do not
+// specify allowed hosts.
+func (opts ClientOptions) HostAllowed(host string) bool {
+	if len(opts.AllowedHosts) == 0 {
+		return true
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+
+	for _, allowed := range opts.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if strings.HasPrefix(allowed, "*.") {
+			if strings.HasSuffix(host, allowed[1:]) || host == allowed[2:] {
+				return true
+			}
+			continue
+		}
+		if host == allowed {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	clientOptionsMutex sync.RWMutex
+	clientOptions      = ClientOptions{}
+)
+
+// SetClientOptions replaces the options for all subsequent requests
+// for feeds and artifacts.
+func SetClientOptions(opts ClientOptions) error {
+	if err := opts.Validate(); err != nil {
+		return errors.Wrap(err, "invalid client options")
+	}
+
+	header := make(map[string]string, len(opts.Header))
+	for k, v := range opts.Header {
+		header[http.CanonicalHeaderKey(k)] = v
+	}
+	opts.Header = header
+	opts.AllowedHosts = append([]string(nil), opts.AllowedHosts...)
+
+	clientOptionsMutex.Lock()
+	defer clientOptionsMutex.Unlock()
+	clientOptions = opts
+
+	return nil
+}
+
+// GetClientOptions returns the current client options.
+func GetClientOptions() ClientOptions {
+	clientOptionsMutex.RLock()
+	defer clientOptionsMutex.RUnlock()
+
+	out := ClientOptions{
+		UserAgent:    clientOptions.UserAgent,
+		Header:       map[string]string{},
+		AllowedHosts: append([]string(nil), clientOptions.AllowedHosts...),
+	}
+	for k, v := range clientOptions.Header {
+		out.Header[k] = v
+	}
+
+	return out
+}
+
+// checkHost returns an error if any of the options do not allow the
+// host of the request.
+func checkHost(req *http.Request, opts ...ClientOptions) error {
+	for _, o := range opts {
+		if !o.HostAllowed(req.URL.Host) {
+			return errors.Wrapf(ErrHostNotAllowed, "cannot request %s", req.URL.Redacted())
+		}
+	}
+
+	return nil
+}
+
+// hostCheckingTransport rejects the requests of a Config's client,
+// including redirects, to the hosts that the client options or the
+// Config do not allow, since clients that a Config specifies do not
+// use a taggingTransport.
+type hostCheckingTransport struct {
+	base  http.RoundTripper
+	hosts []ClientOptions
+}
+
+func (t *hostCheckingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := checkHost(req, append(t.hosts, GetClientOptions())...); err != nil {
+		return nil, err
+	}
+
+	return t.base.RoundTrip(req)
+}
+
+// taggingTransport adds the User-Agent and headers from the client
+// options to the requests of the pooled HTTP clients, and rejects
+// requests to the hosts that the options do not allow. Clients that a
+// Config specifies (see WithHTTPClient) do not use it.
+type taggingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *taggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	opts := GetClientOptions()
+	if err := checkHost(req, opts); err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+
+	for k, v := range opts.Header {
+		if req.Header.Get(k) == "" {
+			req.Header.Set(k, v)
+		}
+	}
+
+	if req.Header.Get("User-Agent") == "" {
+		if opts.UserAgent != "" {
+			req.Header.Set("User-Agent", opts.UserAgent)
+		} else {
+			req.Header.Set("User-Agent", DefaultUserAgent)
+		}
+	}
+
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,159 @@
+package bond
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientOptionsTagRequests(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { require.NoError(t, SetClientOptions(ClientOptions{})) }()
+
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+	}))
+	defer srv.Close()
+
+	get := func(set map[string]string) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		require.NoError(t, err)
+		for k, v := range set {
+			req.Header.Set(k, v)
+		}
+		client := GetHTTPClient()
+		defer PutHTTPClient(client)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	get(nil)
+	assert.Equal(DefaultUserAgent, header.Get("User-Agent"))
+
+	require.NoError(t, SetClientOptions(ClientOptions{
+		UserAgent: "ci/1.0",
+		Header:    map[string]string{"x-build-id": "1234", "X-Team": "server"},
+	}))
+	get(map[string]string{"X-Team": "tools"})
+	assert.Equal("ci/1.0", header.Get("User-Agent"))
+	assert.Equal("1234", header.Get("X-Build-Id"))
+	assert.Equal("tools", header.Get("X-Team"))
+	assert.Equal("1234", GetClientOptions().Header["X-Build-Id"])
+
+	assert.Error(SetClientOptions(ClientOptions{Header: map[string]string{"bad name": "x"}}))
+	assert.Error(SetClientOptions(ClientOptions{Header: map[string]string{"X-Ok": "a\r\nb"}}))
+	assert.Error(SetClientOptions(ClientOptions{UserAgent: "a\nb"}))
+	assert.Equal("ci/1.0", GetClientOptions().UserAgent)
+}
+
+func TestClientOptionsAllowedHosts(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { require.NoError(t, SetClientOptions(ClientOptions{})) }()
+
+	opts := ClientOptions{AllowedHosts: []string{"downloads.mongodb.org", "*.example.net", "127.0.0.1"}}
+	assert.NoError(opts.Validate())
+	assert.True(opts.HostAllowed("downloads.mongodb.org"))
+	assert.True(opts.HostAllowed("Downloads.MongoDB.org:443"))
+	assert.True(opts.HostAllowed("mirror.us.example.net"))
+	assert.True(opts.HostAllowed("example.net"))
+	assert.True(opts.HostAllowed("127.0.0.1:8080"))
+	assert.False(opts.HostAllowed("fastdl.mongodb.org"))
+	assert.False(opts.HostAllowed("badexample.net"))
+	assert.False(opts.HostAllowed("169.254.169.254"))
+	assert.True(ClientOptions{}.HostAllowed("169.254.169.254"))
+
+	assert.Error(ClientOptions{AllowedHosts: []string{""}}.Validate())
+	assert.Error(ClientOptions{AllowedHosts: []string{"host:8080"}}.Validate())
+	assert.Error(ClientOptions{AllowedHosts: []string{"a.*.example.net"}}.Validate())
+	assert.NoError(ClientOptions{AllowedHosts: []string{"::1"}}.Validate())
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace(target.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	get := func(url string) error {
+		client := GetHTTPClient()
+		defer PutHTTPClient(client)
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	require.NoError(t, SetClientOptions(ClientOptions{AllowedHosts: []string{"downloads.mongodb.org"}}))
+	err := get(target.URL)
+	require.Error(t, err)
+	assert.Contains(err.Error(), ErrHostNotAllowed.Error())
+
+	require.NoError(t, SetClientOptions(ClientOptions{AllowedHosts: []string{"127.0.0.1"}}))
+	assert.NoError(get(target.URL))
+	// redirects to other hosts are rejected too
+	err = get(redirect.URL)
+	require.Error(t, err)
+	assert.Contains(err.Error(), ErrHostNotAllowed.Error())
+}
+
+func TestConfigAllowedHosts(t *testing.T) {
+	assert := assert.New(t)
+	defer func() { require.NoError(t, SetClientOptions(ClientOptions{})) }()
+
+	dir, err := ioutil.TempDir("", "bond-allowed-hosts")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer target.Close()
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace(target.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+	}))
+	defer redirect.Close()
+
+	count := 0
+	download := func(conf *Config, url string) error {
+		count++
+		return conf.DownloadFile(context.Background(), url, filepath.Join(dir, fmt.Sprintf("file-%d", count)))
+	}
+	notAllowed := func(err error) {
+		require.Error(t, err)
+		assert.Contains(err.Error(), ErrHostNotAllowed.Error())
+	}
+
+	// the client options apply to configured clients
+	custom := NewConfig(WithHTTPClient(&http.Client{}))
+	assert.NoError(download(custom, target.URL))
+	require.NoError(t, SetClientOptions(ClientOptions{AllowedHosts: []string{"downloads.mongodb.org"}}))
+	notAllowed(download(custom, target.URL))
+	require.NoError(t, SetClientOptions(ClientOptions{}))
+
+	// as do the Config's own hosts, with either client
+	for _, conf := range []*Config{
+		NewConfig(WithAllowedHosts("127.0.0.1")),
+		NewConfig(WithAllowedHosts("127.0.0.1"), WithHTTPClient(&http.Client{})),
+	} {
+		assert.NoError(download(conf, target.URL))
+		notAllowed(download(conf, redirect.URL))
+		notAllowed(download(conf.Restrict("localhost"), target.URL))
+		// restrictions narrow the Config's hosts without widening them
+		notAllowed(download(conf.Restrict("localhost"), redirect.URL))
+		assert.NoError(download(conf.Restrict("127.0.0.1", "localhost"), target.URL))
+	}
+
+	var conf *Config
+	notAllowed(download(conf.Restrict("downloads.mongodb.org"), target.URL))
+	assert.NoError(download(conf.Restrict("localhost", "127.0.0.1"), redirect.URL))
+}
@@ -0,0 +1,53 @@
+/*
+Package clock provides an interface to the current time and to
+timers, so that time-based behavior (backoff, aging, health checks,
+and time windows in reports) can use the system clock in production
+and a manually advanced Fake clock in tests and simulations.
+
+Types that accept a clock use the system clock when none is set. Job
+lock timeouts are implemented by amboy, and always use the system
+clock.
+*/
+package clock
+
+import "time"
+
+// Clock reports the current time and creates timers.
+type Clock interface {
+	Now() time.Time
+	Since(time.Time) time.Duration
+	NewTimer(time.Duration) Timer
+}
+
+// Timer is the subset of the time.Timer API that the Clock
+// implementations support.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(time.Duration) bool
+}
+
+// Real returns a Clock that uses the system clock.
+func Real() Clock { return realClock{} }
+
+// Or returns the clock, or the system clock if the clock is nil, for
+// use by types that accept an optional clock.
+func Or(c Clock) Clock {
+	if c == nil {
+		return Real()
+	}
+
+	return c
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                  { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration { return time.Since(t) }
+func (realClock) NewTimer(d time.Duration) Timer  { return &realTimer{t: time.NewTimer(d)} }
+
+type realTimer struct{ t *time.Timer }
+
+func (t *realTimer) C() <-chan time.Time        { return t.t.C }
+func (t *realTimer) Stop() bool                 { return t.t.Stop() }
+func (t *realTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
@@ -0,0 +1,53 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRealClock(t *testing.T) {
+	c := Or(nil)
+	start := c.Now()
+	timer := c.NewTimer(time.Millisecond)
+	<-timer.C()
+	assert.True(t, c.Since(start) >= time.Millisecond)
+	assert.False(t, timer.Stop())
+}
+
+func TestFakeClockTimers(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFake(start)
+	assert.Equal(c, Or(c))
+	assert.Equal(start, c.Now())
+
+	timer := c.NewTimer(time.Minute)
+	assert.Equal(1, c.Timers())
+
+	c.Advance(30 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+	assert.Equal(30*time.Second, c.Since(start))
+
+	c.Advance(30 * time.Second)
+	assert.Equal(start.Add(time.Minute), <-timer.C())
+	assert.Equal(0, c.Timers())
+
+	// reset timers fire again; stopped timers don't
+	assert.False(timer.Reset(time.Second))
+	assert.True(timer.Stop())
+	c.Advance(time.Hour)
+	select {
+	case <-timer.C():
+		t.Fatal("stopped timer fired")
+	default:
+	}
+
+	// timers with no duration fire immediately
+	<-c.NewTimer(0).C()
+}
@@ -0,0 +1,113 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a Clock whose time only changes when it's advanced. Timers
+// created by a Fake clock fire when the clock is advanced to or past
+// their deadline.
+type Fake struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers map[*fakeTimer]struct{}
+}
+
+// NewFake constructs a Fake clock set to the specified time.
+func NewFake(now time.Time) *Fake {
+	return &Fake{
+		now:    now,
+		timers: map[*fakeTimer]struct{}{},
+	}
+}
+
+// Now returns the clock's current time.
+func (c *Fake) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Since returns the time elapsed on the clock since t.
+func (c *Fake) Since(t time.Time) time.Duration { return c.Now().Sub(t) }
+
+// NewTimer creates a timer that fires once the clock has advanced by
+// the duration. Timers with durations of 0 or less fire immediately.
+func (c *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// Advance moves the clock forward by the duration, firing any timers
+// that are due.
+func (c *Fake) Advance(d time.Duration) { c.Set(c.Now().Add(d)) }
+
+// Set moves the clock to the specified time, firing any timers that
+// are due. The clock may be moved backward, which fires no timers.
+func (c *Fake) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+	for t := range c.timers {
+		if !t.deadline.After(now) {
+			t.fire(now)
+			delete(c.timers, t)
+		}
+	}
+}
+
+// Timers returns the number of timers that have not yet fired, which
+// tests can use to wait until code under test has started waiting on
+// the clock.
+func (c *Fake) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.timers)
+}
+
+type fakeTimer struct {
+	clock    *Fake
+	ch       chan time.Time
+	deadline time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+// fire sends the time without blocking; like a time.Timer, a timer
+// whose channel has not been drained does not fire again.
+func (t *fakeTimer) fire(now time.Time) {
+	select {
+	case t.ch <- now:
+	default:
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	_, active := t.clock.timers[t]
+	delete(t.clock.timers, t)
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	_, active := t.clock.timers[t]
+	t.deadline = t.clock.now.Add(d)
+	if d <= 0 {
+		delete(t.clock.timers, t)
+		t.fire(t.clock.now)
+		return active
+	}
+
+	t.clock.timers[t] = struct{}{}
+	return active
+}
@@ -0,0 +1,235 @@
+package bond
+
+import (
+	"bufio"
+	"bytes"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// HostInfo describes the properties of a host that determine which
+// builds it can run. Empty values are unknown, and aren't checked.
+type HostInfo struct {
+	OS     string
+	Arch   MongoDBArch
+	Target string
+	// Glibc is the version of the host's C library, e.g. "2.35".
+	Glibc string
+	// Libraries are the file names of the host's OpenSSL
+	// libraries, e.g. "libssl.so.3". A nil slice is unknown, and
+	// an empty slice means the host has none.
+	Libraries []string
+	// CPUFlags are the features of the host's processor, as
+	// /proc/cpuinfo reports them.
+	CPUFlags []string
+}
+
+// targetRequirements are the C library version and OpenSSL library
+// that the builds for a target are linked against.
+type targetRequirements struct {
+	glibc   string
+	openssl string
+}
+
+var buildRequirements = map[string]targetRequirements{
+	"ubuntu1604": {glibc: "2.23", openssl: "libssl.so.1.0.0"},
+	"ubuntu1804": {glibc: "2.27", openssl: "libssl.so.1.1"},
+	"ubuntu2004": {glibc: "2.31", openssl: "libssl.so.1.1"},
+	"ubuntu2204": {glibc: "2.35", openssl: "libssl.so.3"},
+	"ubuntu2404": {glibc: "2.39", openssl: "libssl.so.3"},
+	"debian81":   {glibc: "2.19", openssl: "libssl.so.1.0.0"},
+	"debian92":   {glibc: "2.24", openssl: "libssl.so.1.1"},
+	"debian10":   {glibc: "2.28", openssl: "libssl.so.1.1"},
+	"debian11":   {glibc: "2.31", openssl: "libssl.so.1.1"},
+	"debian12":   {glibc: "2.36", openssl: "libssl.so.3"},
+	"rhel62":     {glibc: "2.12", openssl: "libssl.so.10"},
+	"rhel70":     {glibc: "2.17", openssl: "libssl.so.10"},
+	"rhel80":     {glibc: "2.28", openssl: "libssl.so.1.1"},
+	"rhel90":     {glibc: "2.34", openssl: "libssl.so.3"},
+	"suse12":     {glibc: "2.22", openssl: "libssl.so.1.0.0"},
+	"suse15":     {glibc: "2.26", openssl: "libssl.so.1.1"},
+	"amazon":     {glibc: "2.17", openssl: "libssl.so.10"},
+	"amazon2":    {glibc: "2.26", openssl: "libssl.so.10"},
+	"amazon2023": {glibc: "2.34", openssl: "libssl.so.3"},
+}
+
+// The libraries directories that DetectHost searches for OpenSSL.
+var libraryDirs = []string{"/lib", "/lib64", "/usr/lib", "/usr/lib64", "/lib/*-linux-gnu", "/usr/lib/*-linux-gnu"}
+
+// DetectHost returns the properties of the current system. Properties
+// that cannot be determined are empty.
+func DetectHost() HostInfo {
+	host := HostInfo{OS: runtime.GOOS}
+	if arch, err := DetectArch(); err == nil {
+		host.Arch = arch
+	}
+
+	if runtime.GOOS != "linux" {
+		return host
+	}
+
+	if opts, err := DetectBuildOptions(CommunityTargeted); err == nil {
+		host.Target = opts.Target
+	}
+
+	if out, err := commandOutput("getconf", "GNU_LIBC_VERSION"); err == nil {
+		if fields := strings.Fields(out); len(fields) == 2 {
+			host.Glibc = fields[1]
+		}
+	}
+
+	host.Libraries = []string{}
+	seen := map[string]bool{}
+	for _, dir := range libraryDirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "libssl.so.*"))
+		for _, fn := range matches {
+			if name := filepath.Base(fn); !seen[name] {
+				seen[name] = true
+				host.Libraries = append(host.Libraries, name)
+			}
+		}
+	}
+	sort.Strings(host.Libraries)
+
+	if data, err := fileContents("/proc/cpuinfo"); err == nil {
+		host.CPUFlags = parseCPUFlags([]byte(data))
+	}
+
+	return host
+}
+
+// parseCPUFlags returns the features of the first processor in the
+// contents of /proc/cpuinfo, which x86 systems report as "flags" and
+// ARM systems as "Features".
+func parseCPUFlags(data []byte) []string {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		switch strings.TrimSpace(parts[0]) {
+		case "flags", "Features":
+			return strings.Fields(parts[1])
+		}
+	}
+
+	return nil
+}
+
+// CheckBuildCompatibility returns an error, which wraps
+// ErrIncompatibleHost, if the host cannot run the build: if its
+// architecture differs, its C library is older than the build's, it
+// lacks the build's OpenSSL library, or its processor lacks AVX,
+// which builds of MongoDB 5.0 and later require on x86_64. The error
+// describes every problem, and suggests a build that the host can
+// run.
+func CheckBuildCompatibility(info BuildInfo, host HostInfo) error {
+	problems := []string{}
+	suggestions := []string{}
+
+	if host.Arch != "" && info.Options.Arch != "" && host.Arch != info.Options.Arch {
+		problems = append(problems, "the build is for "+string(info.Options.Arch)+" but the host is "+string(host.Arch))
+		suggestions = append(suggestions, "download the "+string(host.Arch)+" build")
+	}
+
+	if req, ok := buildRequirements[info.Options.Target]; ok && host.OS == "linux" {
+		mismatched := false
+		if host.Glibc != "" && compareDottedVersions(host.Glibc, req.glibc) < 0 {
+			problems = append(problems, "the build requires glibc "+req.glibc+" but the host has "+host.Glibc)
+			mismatched = true
+		}
+		if host.Libraries != nil && !containsString(host.Libraries, req.openssl) {
+			problems = append(problems, "the build requires "+req.openssl+" but the host has "+describeLibraries(host.Libraries))
+			mismatched = true
+		}
+		if mismatched && host.Target != "" && host.Target != info.Options.Target {
+			suggestions = append(suggestions, "use the build for "+host.Target)
+		}
+	}
+
+	if host.CPUFlags != nil && info.Options.Arch == AMD64 && !containsString(host.CPUFlags, "avx") {
+		if v, err := NewMongoDBVersion(info.Version); err == nil && v.parsed.Major >= 5 {
+			problems = append(problems, "MongoDB "+info.Version+" requires a processor with AVX support, which the host lacks")
+			suggestions = append(suggestions, "use a 4.4 release, the last series that runs without AVX")
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	msg := "cannot run MongoDB " + info.Version + " for " + info.Options.Target + ": " + strings.Join(problems, "; ")
+	if len(suggestions) > 0 {
+		msg += " (" + strings.Join(suggestions, "; ") + ")"
+	}
+
+	return errors.Wrap(ErrIncompatibleHost, msg)
+}
+
+// CheckBinaryCompatibility checks that the current system can run the
+// binary at the path, before starting it, so that incompatible builds
+// fail with an error that describes the problem rather than an exec
+// error. The build is identified by the name of the archive or
+// directory that contains the binary; binaries in paths that don't
+// identify a build aren't checked.
+func CheckBinaryCompatibility(path string) error {
+	for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		info, err := GetInfoFromFileName(dir)
+		if err != nil {
+			continue
+		}
+
+		return errors.Wrapf(CheckBuildCompatibility(info, DetectHost()), "problem checking %s", path)
+	}
+
+	return nil
+}
+
+// compareDottedVersions compares versions of numeric components
+// separated by dots, like those of glibc, returning -1, 0, or 1.
+func compareDottedVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func describeLibraries(libs []string) string {
+	if len(libs) == 0 {
+		return "no OpenSSL library"
+	}
+
+	return strings.Join(libs, ", ")
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,110 @@
+package bond
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckBuildCompatibility(t *testing.T) {
+	assert := assert.New(t)
+
+	build := BuildInfo{
+		Version: "7.0.2",
+		Options: BuildOptions{Target: "ubuntu2204", Arch: AMD64, Edition: CommunityTargeted},
+	}
+	host := HostInfo{
+		OS:        "linux",
+		Arch:      AMD64,
+		Target:    "ubuntu2204",
+		Glibc:     "2.35",
+		Libraries: []string{"libssl.so.3"},
+		CPUFlags:  []string{"fpu", "sse4_2", "avx", "avx2"},
+	}
+	assert.NoError(CheckBuildCompatibility(build, host))
+
+	// unknown properties aren't checked
+	assert.NoError(CheckBuildCompatibility(build, HostInfo{OS: "linux"}))
+
+	old := host
+	old.Target, old.Glibc, old.Libraries = "ubuntu2004", "2.31", []string{"libssl.so.1.1"}
+	err := CheckBuildCompatibility(build, old)
+	require.Error(t, err)
+	assert.True(Is(err, ErrIncompatibleHost))
+	assert.Contains(err.Error(), "requires glibc 2.35 but the host has 2.31")
+	assert.Contains(err.Error(), "requires libssl.so.3 but the host has libssl.so.1.1")
+	assert.Contains(err.Error(), "use the build for ubuntu2004")
+
+	noSSL := host
+	noSSL.Libraries = []string{}
+	err = CheckBuildCompatibility(build, noSSL)
+	require.Error(t, err)
+	assert.Contains(err.Error(), "no OpenSSL library")
+
+	noAVX := host
+	noAVX.CPUFlags = []string{"fpu", "sse4_2"}
+	err = CheckBuildCompatibility(build, noAVX)
+	require.Error(t, err)
+	assert.Contains(err.Error(), "AVX")
+	assert.Contains(err.Error(), "use a 4.4 release")
+
+	// releases before 5.0 run without AVX
+	build44 := build
+	build44.Version = "4.4.25"
+	build44.Options.Target = "ubuntu2004"
+	noAVX.Libraries = []string{"libssl.so.1.1", "libssl.so.3"}
+	assert.NoError(CheckBuildCompatibility(build44, noAVX))
+
+	ppc := build
+	ppc.Options.Arch = POWER
+	err = CheckBuildCompatibility(ppc, host)
+	require.Error(t, err)
+	assert.Contains(err.Error(), "the build is for ppc64le but the host is x86_64")
+}
+
+func TestParseCPUFlags(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{"fpu", "avx"}, parseCPUFlags([]byte("processor\t: 0\nflags\t\t: fpu avx\n\nprocessor\t: 1\nflags\t\t: fpu\n")))
+	assert.Equal([]string{"fp", "asimd", "atomics"}, parseCPUFlags([]byte("processor\t: 0\nFeatures\t: fp asimd atomics\n")))
+	assert.Nil(parseCPUFlags([]byte("processor\t: 0\n")))
+}
+
+func TestCompareDottedVersions(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(0, compareDottedVersions("2.35", "2.35"))
+	assert.Equal(-1, compareDottedVersions("2.9", "2.17"))
+	assert.Equal(1, compareDottedVersions("2.35.1", "2.35"))
+}
+
+func TestCheckBinaryCompatibility(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bond-compat")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// paths that don't identify a build aren't checked
+	assert.NoError(t, CheckBinaryCompatibility(filepath.Join(dir, "bin", "mongod")))
+
+	host := DetectHost()
+	if host.Arch == "" {
+		t.Skip("no builds for this architecture")
+	}
+
+	var other MongoDBArch
+	for _, arch := range Architectures {
+		if arch != host.Arch {
+			other = arch
+			break
+		}
+	}
+
+	path := filepath.Join(dir, "mongodb-linux-"+string(other)+"-4.4.25", "bin", "mongod")
+	err = CheckBinaryCompatibility(path)
+	require.Error(t, err)
+	assert.True(t, Is(err, ErrIncompatibleHost))
+}
@@ -0,0 +1,275 @@
+package bond
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultConcurrency is the number of concurrent downloads of a
+// Config that does not specify one.
+const DefaultConcurrency = 4
+
+// mirroredHosts are the hosts of MongoDB's download servers, whose
+// URLs a Config with a mirror rewrites.
+var mirroredHosts = []string{
+	"downloads.mongodb.org",
+	"downloads.mongodb.com",
+	"fastdl.mongodb.org",
+}
+
+// Config holds the settings of feeds, catalogs, and downloads, so
+// that a process can use several differing configurations at once
+// rather than sharing package-level settings. Build a Config with
+// NewConfig and the With options; Configs are not modified after
+// they're built and are safe for concurrent use.
+//
+// A nil Config uses the defaults: the shared pool of HTTP clients, no
+// mirror, and DefaultConcurrency.
+type Config struct {
+	// CachePath is the directory of feeds and downloads, used when
+	// a constructor is given an empty path.
+	CachePath string
+	// HTTPClient, if specified, is used for all requests rather
+	// than a client from the shared pool.
+	HTTPClient *http.Client
+	// Mirror, if specified, is the base URL of a mirror of
+	// MongoDB's download servers: the scheme and host of feed and
+	// archive URLs are replaced with it.
+	Mirror string
+	// ClassMirrors, if specified, replace the mirror for classes
+	// of artifacts; a class with an empty base URL is downloaded
+	// from MongoDB's servers.
+	ClassMirrors map[ArtifactClass]string
+	// Mirrors, if specified, selects the mirror from several,
+	// replacing Mirror.
+	Mirrors *MirrorSelector
+	// Concurrency is the number of concurrent downloads.
+	Concurrency int
+	// Verifiers are the steps of the verification of downloaded
+	// archives, and default to DefaultVerifiers.
+	Verifiers []Verifier
+	// Processors are the steps of the post-processing of
+	// verified archives (see Processor).
+	Processors []Processor
+	// Source, if specified, is checked for archives before they're
+	// downloaded from their URLs.
+	Source ArtifactSource
+	// Sink, if specified, receives the archives that the Config
+	// downloads and verifies.
+	Sink ArtifactSink
+	// Progress, if specified, receives reports of the progress of
+	// downloads of archives.
+	Progress ProgressFunc
+	// ReadOnlyCatalog opens catalogs read-only, from their
+	// indexes.
+	ReadOnlyCatalog bool
+	// GenericLinuxFallback resolves missing community builds of
+	// Linux distributions to generic Linux builds.
+	GenericLinuxFallback bool
+	// LowMemoryFeed decodes feeds incrementally from their files
+	// on disk, rather than reading them into memory.
+	LowMemoryFeed bool
+	// AllowedHosts, if specified, are the only hosts that the
+	// Config's requests may be made to, with either client, in
+	// addition to the allowed hosts of the client options (see
+	// ClientOptions).
+	AllowedHosts []string
+
+	// restrictions are the allowed hosts of the Configs that
+	// Restrict derived this Config from.
+	restrictions [][]string
+}
+
+// Option configures a Config.
+type Option func(*Config)
+
+// WithCachePath sets the directory of feeds and downloads.
+func WithCachePath(path string) Option { return func(c *Config) { c.CachePath = path } }
+
+// WithHTTPClient sets the client for all requests.
+func WithHTTPClient(client *http.Client) Option { return func(c *Config) { c.HTTPClient = client } }
+
+// WithMirror sets the base URL of a mirror of MongoDB's download
+// servers (e.g. "https://mirror.example.net/mongodb").
+func WithMirror(base string) Option {
+	return func(c *Config) { c.Mirror = strings.TrimSuffix(base, "/") }
+}
+
+// WithAllowedHosts limits the hosts that the Config's requests may
+// be made to.
+func WithAllowedHosts(hosts ...string) Option {
+	return func(c *Config) { c.AllowedHosts = hosts }
+}
+
+// WithConcurrency sets the number of concurrent downloads.
+func WithConcurrency(n int) Option { return func(c *Config) { c.Concurrency = n } }
+
+// WithVerifiers sets the verification pipeline of downloaded
+// archives, replacing the default verifiers.
+func WithVerifiers(verifiers ...Verifier) Option {
+	return func(c *Config) { c.Verifiers = verifiers }
+}
+
+// NewConfig builds a Config from the options; later options override
+// earlier ones.
+func NewConfig(opts ...Option) *Config {
+	conf := &Config{Concurrency: DefaultConcurrency}
+	for _, opt := range opts {
+		opt(conf)
+	}
+
+	if conf.Concurrency <= 0 {
+		conf.Concurrency = DefaultConcurrency
+	}
+
+	return conf
+}
+
+// GetConcurrency returns the number of concurrent downloads.
+func (c *Config) GetConcurrency() int {
+	if c == nil || c.Concurrency <= 0 {
+		return DefaultConcurrency
+	}
+
+	return c.Concurrency
+}
+
+// Restrict returns a copy of the Config whose requests may only be
+// made to the hosts, as well as to the hosts that the Config allows,
+// so that a job can narrow the hosts of its process's Config without
+// widening them. A nil Config is restricted from the defaults.
+func (c *Config) Restrict(hosts ...string) *Config {
+	out := NewConfig()
+	if c != nil {
+		*out = *c
+		if len(c.AllowedHosts) > 0 {
+			out.restrictions = append(append([][]string(nil), c.restrictions...), c.AllowedHosts)
+		}
+	}
+	out.AllowedHosts = hosts
+
+	return out
+}
+
+// Client returns the configured client, or one from the pool, and a
+// function to release it. Requests with the client may only be made
+// to the hosts that the client options and the Config allow.
+func (c *Config) Client() (*http.Client, func()) {
+	var hosts []ClientOptions
+	if c != nil {
+		for _, r := range c.restrictions {
+			hosts = append(hosts, ClientOptions{AllowedHosts: r})
+		}
+		if len(c.AllowedHosts) > 0 {
+			hosts = append(hosts, ClientOptions{AllowedHosts: c.AllowedHosts})
+		}
+	}
+
+	if c == nil || c.HTTPClient == nil {
+		pooled := GetHTTPClient()
+		release := func() { PutHTTPClient(pooled) }
+		if len(hosts) == 0 {
+			// the pooled clients check the client options
+			return pooled, release
+		}
+		return withHostChecks(pooled, hosts), release
+	}
+
+	return withHostChecks(c.HTTPClient, hosts), func() {}
+}
+
+// withHostChecks returns a copy of the client that checks the hosts
+// of its requests.
+func withHostChecks(client *http.Client, hosts []ClientOptions) *http.Client {
+	out := *client
+	base := out.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	out.Transport = &hostCheckingTransport{base: base, hosts: hosts}
+
+	return &out
+}
+
+// MirrorURL rewrites a URL on MongoDB's download servers to the
+// mirror of its class, keeping its path. Other URLs, such as those of
+// URL overrides, and URLs of classes without a mirror, are returned
+// unchanged. With a MirrorSelector, URLs are rewritten to its best
+// mirror.
+func (c *Config) MirrorURL(addr string) string {
+	if c == nil || (c.Mirror == "" && len(c.ClassMirrors) == 0 && c.Mirrors == nil) {
+		return addr
+	}
+
+	parsed, err := url.Parse(addr)
+	if err != nil {
+		return addr
+	}
+
+	for _, host := range mirroredHosts {
+		if parsed.Host != host {
+			continue
+		}
+		if mirror := c.GetMirror(ClassifyURL(addr)); mirror != "" {
+			return mirror + parsed.EscapedPath()
+		}
+		return addr
+	}
+
+	return addr
+}
+
+// DownloadFile is DownloadFile, using the Config's client, unless the
+// Config's source has the file. With a MirrorSelector, the file is
+// downloaded from each mirror in turn until one succeeds.
+func (c *Config) DownloadFile(ctx context.Context, url, fileName string) error {
+	if c.fetchFromSource(ctx, url, fileName) {
+		return nil
+	}
+
+	client, release := c.Client()
+	defer release()
+
+	attempts := c.mirrorAttempts(ctx, url)
+	if len(attempts) > 1 {
+		if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+			return errors.Errorf("'%s' file exists", fileName)
+		}
+	}
+
+	return c.tryMirrors(ctx, attempts, func(url string) error {
+		err := downloadFile(ctx, client, c.getProgress(), url, fileName)
+		if err != nil && len(attempts) > 1 {
+			_ = os.Remove(fileName)
+		}
+		return err
+	})
+}
+
+// ResumeDownloadFile is ResumeDownloadFile, using the Config's
+// client, unless the Config's source has the file. With a
+// MirrorSelector, the file is downloaded from each mirror in turn
+// until one succeeds.
+func (c *Config) ResumeDownloadFile(ctx context.Context, url, fileName string, sums []Checksum) error {
+	if c.fetchFromSource(ctx, url, fileName) {
+		return nil
+	}
+
+	client, release := c.Client()
+	defer release()
+
+	return c.tryMirrors(ctx, c.mirrorAttempts(ctx, url), func(url string) error {
+		return resumeDownloadFile(ctx, client, c.getProgress(), url, fileName, sums)
+	})
+}
+
+// CacheDownload is CacheDownload, using the Config's client.
+func (c *Config) CacheDownload(ctx context.Context, ttl time.Duration, url, path string, force bool) ([]byte, error) {
+	return cacheDownload(ctx, c, ttl, url, path, force)
+}
@@ -0,0 +1,134 @@
+package bond
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigDefaults(t *testing.T) {
+	assert := assert.New(t)
+
+	var conf *Config
+	assert.Equal(DefaultConcurrency, conf.GetConcurrency())
+	assert.Equal("http://downloads.mongodb.org/full.json", conf.MirrorURL("http://downloads.mongodb.org/full.json"))
+
+	conf = NewConfig(WithConcurrency(-1), WithCachePath("/tmp/bond"))
+	assert.Equal(DefaultConcurrency, conf.GetConcurrency())
+	assert.Equal("/tmp/bond", conf.CachePath)
+	assert.Equal(2, NewConfig(WithConcurrency(8), WithConcurrency(2)).GetConcurrency())
+}
+
+func TestConfigMirrorURL(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := NewConfig(WithMirror("https://mirror.example.net/mongodb/"))
+	assert.Equal("https://mirror.example.net/mongodb/linux/mongodb-linux-x86_64-4.4.0.tgz",
+		conf.MirrorURL("https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-4.4.0.tgz"))
+	assert.Equal("https://mirror.example.net/mongodb/full.json",
+		conf.MirrorURL("http://downloads.mongodb.org/full.json"))
+	assert.Equal("https://builds.example.net/a.tgz", conf.MirrorURL("https://builds.example.net/a.tgz"))
+}
+
+func TestConfigClassMirrors(t *testing.T) {
+	assert := assert.New(t)
+
+	const (
+		server = "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-ubuntu2204-7.0.2.tgz"
+		debug  = "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-ubuntu2204-debugsymbols-7.0.2.tgz"
+		tools  = "https://fastdl.mongodb.org/tools/db/mongodb-database-tools-ubuntu2204-x86_64-100.9.0.tgz"
+		shell  = "https://downloads.mongodb.com/compass/mongosh-2.0.2-linux-x64.tgz"
+	)
+	for addr, class := range map[string]ArtifactClass{
+		FeedURL:      FeedArtifacts,
+		ToolsFeedURL: FeedArtifacts,
+		server:       ServerArtifacts,
+		debug:        DebugSymbolArtifacts,
+		tools:        ToolsArtifacts,
+		shell:        ShellArtifacts,
+	} {
+		assert.Equal(class, ClassifyURL(addr), addr)
+	}
+
+	conf := NewConfig(
+		WithMirror("https://mirror.internal/mongodb"),
+		WithClassMirror(DebugSymbolArtifacts, ""),
+		WithClassMirror(ToolsArtifacts, "https://bucket.s3.amazonaws.com/mongodb/"))
+	assert.Equal("https://mirror.internal/mongodb/linux/mongodb-linux-x86_64-ubuntu2204-7.0.2.tgz", conf.MirrorURL(server))
+	assert.Equal("https://mirror.internal/mongodb/full.json", conf.MirrorURL(FeedURL))
+	assert.Equal(debug, conf.MirrorURL(debug))
+	assert.Equal("https://bucket.s3.amazonaws.com/mongodb/tools/db/mongodb-database-tools-ubuntu2204-x86_64-100.9.0.tgz", conf.MirrorURL(tools))
+	assert.Equal("https://mirror.internal/mongodb/compass/mongosh-2.0.2-linux-x64.tgz", conf.MirrorURL(shell))
+
+	// class mirrors apply without a mirror for all artifacts
+	conf = NewConfig(WithClassMirror(ServerArtifacts, "https://mirror.internal/mongodb"))
+	assert.Equal("https://mirror.internal/mongodb/linux/mongodb-linux-x86_64-ubuntu2204-7.0.2.tgz", conf.MirrorURL(server))
+	assert.Equal(debug, conf.MirrorURL(debug))
+	assert.Equal("", conf.GetMirror(DebugSymbolArtifacts))
+
+	class, base, err := ParseClassMirror("tools=https://bucket.example.net")
+	assert.NoError(err)
+	assert.Equal(ToolsArtifacts, class)
+	assert.Equal("https://bucket.example.net", base)
+	class, base, err = ParseClassMirror("debug=")
+	assert.NoError(err)
+	assert.Equal(DebugSymbolArtifacts, class)
+	assert.Equal("", base)
+	for _, val := range []string{"debug", "symbols=https://example.net", ""} {
+		_, _, err = ParseClassMirror(val)
+		assert.Error(err, val)
+	}
+}
+
+func TestConfigsAreIndependent(t *testing.T) {
+	assert := assert.New(t)
+
+	mirror := func(version string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"versions": [{"version": %q, "current": true, "downloads": [
+{"target": "rhel80", "arch": "x86_64", "edition": "base",
+ "archive": {"url": "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-rhel80-%s.tgz", "sha256": "abc"}}]}]}`,
+				version, version)
+		}))
+	}
+	one, two := mirror("4.4.1"), mirror("4.2.9")
+	defer one.Close()
+	defer two.Close()
+
+	opts := BuildOptions{Target: "rhel80", Arch: AMD64, Edition: Base}
+	wg := &sync.WaitGroup{}
+	for _, srv := range []*httptest.Server{one, two} {
+		dir, err := ioutil.TempDir("", "bond-config")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		wg.Add(1)
+		go func(srv *httptest.Server, dir string) {
+			defer wg.Done()
+
+			feed, err := GetArtifactsFeed(context.Background(), "", WithCachePath(dir), WithMirror(srv.URL), WithHTTPClient(srv.Client()))
+			if !assert.NoError(err) {
+				return
+			}
+			assert.Equal(dir, feed.dir)
+			if !assert.Len(feed.Versions, 1) {
+				return
+			}
+
+			series := feed.Versions[0].Version[:3]
+			url, err := feed.GetCurrentArchive(series, opts)
+			assert.NoError(err)
+			assert.Equal(srv.URL+"/linux/mongodb-linux-x86_64-rhel80-"+feed.Versions[0].Version+".tgz", url)
+			assert.Len(feed.Checksums(url), 1)
+		}(srv, dir)
+	}
+	wg.Wait()
+}
@@ -1,5 +1,7 @@
 package bond
 
+import "strings"
+
 // MongoDBEdition provides values that appear in the "edition" field
 // of the feed, and map to specific builds of MongoDB.
 type MongoDBEdition string
@@ -18,7 +20,40 @@ type MongoDBArch string
 // Specific values for Architectures.
 const (
 	ZSeries MongoDBArch = "s390x"
-	POWER               = "ppc64le"
-	AMD64               = "x86_64"
-	X86                 = "i686"
+	POWER   MongoDBArch = "ppc64le"
+	AMD64   MongoDBArch = "x86_64"
+	X86     MongoDBArch = "i686"
 )
+
+// Architectures lists the architectures with specific values.
+var Architectures = []MongoDBArch{AMD64, X86, POWER, ZSeries}
+
+// archAliases maps other common names of architectures, as used by
+// Go, distributions, and vendors, onto the values in the feed.
+var archAliases = map[string]MongoDBArch{
+	"amd64":   AMD64,
+	"x64":     AMD64,
+	"386":     X86,
+	"i386":    X86,
+	"x86":     X86,
+	"power":   POWER,
+	"power8":  POWER,
+	"ppc64el": POWER,
+	"ppc64le": POWER,
+	"zseries": ZSeries,
+	"s390":    ZSeries,
+	"s390x":   ZSeries,
+}
+
+// ParseArch returns the architecture that the name refers to,
+// accepting the names in the feed as well as common aliases (e.g.
+// amd64, ppc64el, and zseries). Names that are neither are returned
+// unchanged, since the feed contains architectures that do not have
+// specific values.
+func ParseArch(name string) MongoDBArch {
+	if arch, ok := archAliases[strings.ToLower(name)]; ok {
+		return arch
+	}
+
+	return MongoDBArch(name)
+}
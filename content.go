@@ -0,0 +1,254 @@
+package bond
+
+import (
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// CacheLayout describes how archives are stored in a cache directory.
+type CacheLayout string
+
+// The supported cache layouts. In the FlatLayout (the default),
+// archives are stored by their file names. In the
+// ContentAddressedLayout, archives are stored in a ContentStore, by
+// the SHA256 checksums of their contents, and the file names are
+// symbolic links into the store.
+const (
+	FlatLayout             CacheLayout = "flat"
+	ContentAddressedLayout CacheLayout = "content-addressed"
+)
+
+// ObjectsDirectory is the directory, within a cache, that holds a
+// ContentStore's objects.
+const ObjectsDirectory = ".objects"
+
+// ContentStore stores the archives in a cache directory by the
+// SHA256 checksums of their contents, so that archives with the same
+// contents (e.g. the same build published for several targets) are
+// only stored once, and so that an archive can be verified by
+// checking its contents against its own name.
+//
+// Objects are stored in <path>/.objects/sha256/<xx>/<checksum>,
+// where <xx> is the first two characters of the checksum, and each
+// archive's file name in the cache is a relative symbolic link to its
+// object. Extracted builds are not affected by the layout.
+type ContentStore struct {
+	Path string
+}
+
+// NewContentStore returns a store for the cache directory.
+func NewContentStore(path string) (*ContentStore, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem resolving absolute path")
+	}
+
+	return &ContentStore{Path: path}, nil
+}
+
+// ObjectPath returns the path of the object with the checksum.
+func (s *ContentStore) ObjectPath(checksum string) string {
+	return filepath.Join(s.Path, ObjectsDirectory, "sha256", checksum[:2], checksum)
+}
+
+// Add moves the file into the store, unless the store already has an
+// object with the same contents, and replaces the file with a link to
+// the object. Add returns the checksum of the file's contents. Adding
+// a file that is already a link into the store does nothing.
+func (s *ContentStore) Add(fileName string) (string, error) {
+	fileName, err := filepath.Abs(fileName)
+	if err != nil {
+		return "", errors.Wrap(err, "problem resolving absolute path")
+	}
+
+	if checksum, err := s.linked(fileName); err != nil || checksum != "" {
+		return checksum, err
+	}
+
+	checksum, err := fileChecksum(fileName)
+	if err != nil {
+		return "", err
+	}
+
+	obj := s.ObjectPath(checksum)
+	if err = createDirectory(filepath.Dir(obj)); err != nil {
+		return "", errors.Wrapf(err, "problem creating object directory for %s", fileName)
+	}
+
+	if _, err = os.Stat(obj); os.IsNotExist(err) {
+		if err = os.Rename(fileName, obj); err != nil {
+			return "", errors.Wrapf(err, "problem moving %s into the content store", fileName)
+		}
+	} else if err = os.Remove(fileName); err != nil {
+		return "", errors.Wrapf(err, "problem removing duplicate of %s", checksum)
+	}
+
+	target, err := filepath.Rel(filepath.Dir(fileName), obj)
+	if err != nil {
+		return "", errors.Wrapf(err, "problem resolving link to %s", obj)
+	}
+
+	if err = os.Symlink(target, fileName); err != nil {
+		return "", errors.Wrapf(err, "problem linking %s to %s", fileName, obj)
+	}
+
+	return checksum, nil
+}
+
+// linked returns the checksum of the object that the file links to,
+// or an empty string if the file is not a link into the store.
+func (s *ContentStore) linked(fileName string) (string, error) {
+	fileName, err := filepath.Abs(fileName)
+	if err != nil {
+		return "", errors.Wrap(err, "problem resolving absolute path")
+	}
+
+	stat, err := os.Lstat(fileName)
+	if err != nil {
+		return "", errors.Wrapf(err, "problem finding %s", fileName)
+	}
+
+	if stat.Mode()&os.ModeSymlink == 0 {
+		return "", nil
+	}
+
+	target, err := os.Readlink(fileName)
+	if err != nil {
+		return "", errors.Wrapf(err, "problem reading link %s", fileName)
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(fileName), target)
+	}
+
+	checksum := filepath.Base(target)
+	if len(checksum) != sha256.Size*2 || filepath.Clean(target) != s.ObjectPath(checksum) {
+		return "", errors.Errorf("%s links outside of the content store, to %s", fileName, target)
+	}
+
+	return checksum, nil
+}
+
+// DownloadFile downloads the url into the store, and links fileName
+// to the resulting object.
+func (s *ContentStore) DownloadFile(ctx context.Context, url, fileName string) error {
+	if err := DownloadFile(ctx, url, fileName); err != nil {
+		return err
+	}
+
+	if _, err := s.Add(fileName); err != nil {
+		grip.Warning(os.Remove(fileName))
+		return errors.Wrapf(err, "problem storing %s", fileName)
+	}
+
+	return nil
+}
+
+// Verify checks that the file is a link to an object in the store,
+// and that the object's contents match its checksum. Verify returns
+// an error wrapping ErrChecksumMismatch if they do not.
+func (s *ContentStore) Verify(fileName string) error {
+	checksum, err := s.linked(fileName)
+	if err != nil {
+		return err
+	}
+	if checksum == "" {
+		return errors.Errorf("%s is not in the content store", fileName)
+	}
+
+	return s.verifyObject(s.ObjectPath(checksum))
+}
+
+func (s *ContentStore) verifyObject(obj string) error {
+	actual, err := fileChecksum(obj)
+	if err != nil {
+		return err
+	}
+
+	if actual != filepath.Base(obj) {
+		return errors.Wrapf(ErrChecksumMismatch, "object %s has checksum %s", obj, actual)
+	}
+
+	return nil
+}
+
+// VerifyAll checks the contents of every object in the store. If any
+// objects do not match their checksums, the error wraps
+// ErrChecksumMismatch and names them.
+func (s *ContentStore) VerifyAll(ctx context.Context) error {
+	objects, err := s.Objects()
+	if err != nil {
+		return err
+	}
+
+	catcher := grip.NewBasicCatcher()
+	mismatched := []string{}
+	for _, obj := range objects {
+		if ctx.Err() != nil {
+			catcher.Add(ctx.Err())
+			break
+		}
+
+		err = s.verifyObject(s.ObjectPath(obj))
+		if Is(err, ErrChecksumMismatch) {
+			mismatched = append(mismatched, obj)
+			continue
+		}
+		catcher.Add(err)
+	}
+
+	if len(mismatched) == 0 {
+		return catcher.Resolve()
+	}
+
+	err = errors.Wrapf(ErrChecksumMismatch, "objects %s", strings.Join(mismatched, ", "))
+	if catcher.HasErrors() {
+		err = errors.Wrap(err, catcher.Resolve().Error())
+	}
+
+	return err
+}
+
+// Objects returns the checksums of the objects in the store.
+func (s *ContentStore) Objects() ([]string, error) {
+	root := filepath.Join(s.Path, ObjectsDirectory, "sha256")
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return []string{}, nil
+	}
+
+	prefixes, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading %s", root)
+	}
+
+	out := []string{}
+	for _, prefix := range prefixes {
+		if !prefix.IsDir() {
+			continue
+		}
+
+		objects, err := ioutil.ReadDir(filepath.Join(root, prefix.Name()))
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem reading %s", prefix.Name())
+		}
+
+		for _, obj := range objects {
+			if obj.Mode().IsRegular() && strings.HasPrefix(obj.Name(), prefix.Name()) {
+				out = append(out, obj.Name())
+			}
+		}
+	}
+
+	return out, nil
+}
+
+func fileChecksum(fileName string) (string, error) {
+	sum, err := FileChecksum(fileName, SHA256)
+	return sum.Value, err
+}
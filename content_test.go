@@ -0,0 +1,98 @@
+package bond
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentStoreDeduplicatesArchives(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-content")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := NewContentStore(dir)
+	require.NoError(t, err)
+
+	first := filepath.Join(dir, "mongodb-linux-x86_64-ubuntu1604-4.0.1.tgz")
+	second := filepath.Join(dir, "mongodb-linux-x86_64-ubuntu1804-4.0.1.tgz")
+	require.NoError(t, ioutil.WriteFile(first, []byte("build"), 0644))
+	require.NoError(t, ioutil.WriteFile(second, []byte("build"), 0644))
+
+	sum, err := store.Add(first)
+	require.NoError(t, err)
+	again, err := store.Add(second)
+	require.NoError(t, err)
+	assert.Equal(sum, again)
+
+	// adding a link is a no-op
+	again, err = store.Add(first)
+	require.NoError(t, err)
+	assert.Equal(sum, again)
+
+	objects, err := store.Objects()
+	require.NoError(t, err)
+	assert.Equal([]string{sum}, objects)
+
+	for _, fn := range []string{first, second} {
+		stat, err := os.Lstat(fn)
+		require.NoError(t, err)
+		assert.True(stat.Mode()&os.ModeSymlink != 0)
+
+		data, err := ioutil.ReadFile(fn)
+		require.NoError(t, err)
+		assert.Equal("build", string(data))
+		assert.NoError(store.Verify(fn))
+	}
+	assert.NoError(store.VerifyAll(context.Background()))
+
+	// corrupt the shared object
+	require.NoError(t, ioutil.WriteFile(store.ObjectPath(sum), []byte("corrupt"), 0644))
+	assert.True(Is(store.Verify(first), ErrChecksumMismatch))
+	assert.True(Is(store.VerifyAll(context.Background()), ErrChecksumMismatch))
+
+	plain := filepath.Join(dir, "plain.tgz")
+	require.NoError(t, ioutil.WriteFile(plain, []byte("build"), 0644))
+	assert.Error(store.Verify(plain))
+
+	outside := filepath.Join(dir, "outside.tgz")
+	require.NoError(t, os.Symlink(plain, outside))
+	_, err = store.Add(outside)
+	assert.Error(err)
+}
+
+func TestContentStoreDownload(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("archive"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "bond-content")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := NewContentStore(dir)
+	require.NoError(t, err)
+
+	fn := filepath.Join(dir, "a.tgz")
+	require.NoError(t, store.DownloadFile(ctx, srv.URL+"/a.tgz", fn))
+	assert.NoError(store.Verify(fn))
+
+	objects, err := store.Objects()
+	require.NoError(t, err)
+	assert.Len(objects, 1)
+}
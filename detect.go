@@ -0,0 +1,215 @@
+package bond
+
+import (
+	"bufio"
+	"bytes"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// OSReleaseFile is the standard location of the os-release file,
+// which identifies the distribution of Linux systems.
+const OSReleaseFile = "/etc/os-release"
+
+// The distribution families for which the feed publishes builds.
+// Derivative distributions resolve to the targets of their family.
+const (
+	UbuntuFamily = "ubuntu"
+	DebianFamily = "debian"
+	RHELFamily   = "rhel"
+	SUSEFamily   = "suse"
+	AmazonFamily = "amzn"
+)
+
+var (
+	distroCompatibilityMutex sync.RWMutex
+	distroCompatibility      = map[string]string{
+		"ubuntu":        UbuntuFamily,
+		"linuxmint":     UbuntuFamily,
+		"pop":           UbuntuFamily,
+		"elementary":    UbuntuFamily,
+		"zorin":         UbuntuFamily,
+		"neon":          UbuntuFamily,
+		"debian":        DebianFamily,
+		"raspbian":      DebianFamily,
+		"rhel":          RHELFamily,
+		"centos":        RHELFamily,
+		"rocky":         RHELFamily,
+		"almalinux":     RHELFamily,
+		"ol":            RHELFamily,
+		"sles":          SUSEFamily,
+		"opensuse-leap": SUSEFamily,
+		"amzn":          AmazonFamily,
+	}
+)
+
+// ubuntuCodenames maps the codenames that Ubuntu derivatives report,
+// in UBUNTU_CODENAME, to the Ubuntu release they're based on.
+var ubuntuCodenames = map[string]string{
+	"xenial": "1604",
+	"bionic": "1804",
+	"focal":  "2004",
+	"jammy":  "2204",
+	"noble":  "2404",
+}
+
+// RegisterDistroCompatibility maps an os-release ID to one of the
+// distribution families, so that DetectBuildOptions resolves the
+// distribution to a target of the family.
+func RegisterDistroCompatibility(id, family string) error {
+	switch family {
+	case UbuntuFamily, DebianFamily, RHELFamily, SUSEFamily, AmazonFamily:
+	default:
+		return errors.Errorf("'%s' is not a supported distribution family", family)
+	}
+
+	distroCompatibilityMutex.Lock()
+	defer distroCompatibilityMutex.Unlock()
+	distroCompatibility[strings.ToLower(id)] = family
+
+	return nil
+}
+
+func getDistroFamily(id string) (string, bool) {
+	distroCompatibilityMutex.RLock()
+	defer distroCompatibilityMutex.RUnlock()
+
+	family, ok := distroCompatibility[strings.ToLower(id)]
+	return family, ok
+}
+
+// ParseOSRelease parses the contents of an os-release file into a
+// map of lower case keys to unquoted values.
+func ParseOSRelease(data []byte) map[string]string {
+	out := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		out[strings.ToLower(parts[0])] = strings.Trim(parts[1], "\"'")
+	}
+
+	return out
+}
+
+// TargetForOSRelease returns the target of the builds that run on the
+// distribution that the parsed os-release file describes. The ID of
+// the distribution, and then each of its ID_LIKE values, are looked
+// up in the compatibility map, so that derivatives, like Linux Mint or
+// Rocky Linux, resolve to the target of the distribution they're
+// based on.
+func TargetForOSRelease(info map[string]string) (string, error) {
+	ids := append([]string{info["id"]}, strings.Fields(info["id_like"])...)
+
+	for _, id := range ids {
+		family, ok := getDistroFamily(id)
+		if !ok {
+			continue
+		}
+
+		target, err := familyTarget(family, id, info)
+		if err != nil {
+			return "", errors.Wrapf(err, "problem resolving target for %s", info["id"])
+		}
+
+		return target, nil
+	}
+
+	return "", errors.Errorf("distribution '%s' is not compatible with any build target", info["id"])
+}
+
+func familyTarget(family, id string, info map[string]string) (string, error) {
+	version := info["version_id"]
+	major := strings.SplitN(version, ".", 2)[0]
+
+	switch family {
+	case UbuntuFamily:
+		if id == "ubuntu" && version != "" {
+			return "ubuntu" + cleanVersion(version), nil
+		}
+		// derivatives have their own versions
+		if v, ok := ubuntuCodenames[info["ubuntu_codename"]]; ok {
+			return "ubuntu" + v, nil
+		}
+		return "", errors.Errorf("unknown ubuntu codename '%s'", info["ubuntu_codename"])
+	case DebianFamily:
+		switch major {
+		case "":
+			return "", errors.New("os-release has no version")
+		case "7", "8":
+			return "debian" + major + "1", nil
+		case "9":
+			return "debian92", nil
+		default:
+			return "debian" + major, nil
+		}
+	case RHELFamily:
+		if major == "" {
+			return "", errors.New("os-release has no version")
+		}
+		return "rhel" + major + "0", nil
+	case SUSEFamily:
+		if major == "" {
+			return "", errors.New("os-release has no version")
+		}
+		return "suse" + major, nil
+	case AmazonFamily:
+		if major == "" {
+			return "amazon", nil
+		}
+		return "amazon" + major, nil
+	}
+
+	return "", errors.Errorf("'%s' is not a supported distribution family", family)
+}
+
+// DetectArch returns the architecture of the builds that run on the
+// current system.
+func DetectArch() (MongoDBArch, error) {
+	arch := ParseArch(runtime.GOARCH)
+	if !isArch(string(arch)) {
+		return "", errors.Errorf("there are no builds for the %s architecture", runtime.GOARCH)
+	}
+
+	return arch, nil
+}
+
+// DetectBuildOptions returns the options of the builds of the edition
+// that run on the current system. On Linux systems with an os-release
+// file, the target is resolved with TargetForOSRelease; otherwise,
+// DetectBuildOptions falls back to GetTargetDistro.
+func DetectBuildOptions(edition MongoDBEdition) (BuildOptions, error) {
+	arch, err := DetectArch()
+	if err != nil {
+		return BuildOptions{}, err
+	}
+
+	opts := BuildOptions{Arch: arch, Edition: edition}
+
+	if runtime.GOOS == "linux" && fileExists(OSReleaseFile) {
+		data, err := fileContents(OSReleaseFile)
+		if err != nil {
+			return BuildOptions{}, errors.Wrapf(err, "problem reading %s", OSReleaseFile)
+		}
+
+		opts.Target, err = TargetForOSRelease(ParseOSRelease([]byte(data)))
+		if err != nil {
+			return BuildOptions{}, err
+		}
+
+		return opts, nil
+	}
+
+	opts.Target = GetTargetDistro()
+	return opts, nil
+}
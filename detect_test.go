@@ -0,0 +1,45 @@
+package bond
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetForOSRelease(t *testing.T) {
+	assert := assert.New(t)
+
+	for target, data := range map[string]string{
+		"ubuntu1804": "NAME=\"Ubuntu\"\nID=ubuntu\nVERSION_ID=\"18.04\"\n",
+		"ubuntu2204": "NAME=\"Linux Mint\"\nID=linuxmint\nID_LIKE=\"ubuntu debian\"\nVERSION_ID=\"21.2\"\nUBUNTU_CODENAME=jammy\n",
+		"ubuntu2004": "ID=pop\nID_LIKE=\"ubuntu debian\"\nVERSION_ID=\"20.04\"\nUBUNTU_CODENAME=focal\n",
+		"rhel80":     "NAME=\"Rocky Linux\"\nID=\"rocky\"\nID_LIKE=\"rhel centos fedora\"\nVERSION_ID=\"8.6\"\n",
+		"rhel90":     "# comment\nID=\"almalinux\"\nVERSION_ID=\"9.1\"\n",
+		"rhel70":     "ID=\"unknownrebuild\"\nID_LIKE=\"rhel fedora\"\nVERSION_ID=\"7\"\n",
+		"debian92":   "ID=debian\nVERSION_ID=\"9\"\n",
+		"debian11":   "ID=raspbian\nID_LIKE=debian\nVERSION_ID=\"11\"\n",
+		"debian81":   "ID=debian\nVERSION_ID=\"8\"\n",
+		"suse15":     "ID=\"opensuse-leap\"\nVERSION_ID=\"15.4\"\n",
+		"amazon2":    "ID=\"amzn\"\nVERSION_ID=\"2\"\n",
+	} {
+		out, err := TargetForOSRelease(ParseOSRelease([]byte(data)))
+		require.NoError(t, err, target)
+		assert.Equal(target, out)
+	}
+
+	for _, data := range []string{
+		"ID=gentoo\n",
+		"ID=linuxmint\nID_LIKE=ubuntu\nUBUNTU_CODENAME=unknown\n",
+		"ID=rocky\n",
+	} {
+		_, err := TargetForOSRelease(ParseOSRelease([]byte(data)))
+		assert.Error(err, data)
+	}
+
+	assert.Error(RegisterDistroCompatibility("gentoo", "portage"))
+	require.NoError(t, RegisterDistroCompatibility("Eurolinux", RHELFamily))
+	out, err := TargetForOSRelease(ParseOSRelease([]byte("ID=eurolinux\nVERSION_ID=8.7\n")))
+	require.NoError(t, err)
+	assert.Equal("rhel80", out)
+}
@@ -9,10 +9,21 @@ type ArtifactDownload struct {
 	Target  string
 	Archive struct {
 		Debug  string `bson:"debug_symbols" json:"debug_symbols" yaml:"debug_symbols"`
+		Md5    string
 		Sha1   string
 		Sha256 string
+		Sha512 string
 		URL    string `bson:"url" json:"url" yaml:"url"`
 	}
+	// CryptShared is the archive of the build's crypt_shared
+	// library, which enterprise builds publish from 6.0.
+	CryptShared struct {
+		URL    string `bson:"url" json:"url" yaml:"url"`
+		Md5    string
+		Sha1   string
+		Sha256 string
+		Sha512 string
+	} `bson:"crypt_shared" json:"crypt_shared" yaml:"crypt_shared"`
 	Msi      string
 	Packages []string
 }
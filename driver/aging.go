@@ -0,0 +1,481 @@
+package driver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"github.com/tychoish/bond/clock"
+	"github.com/tychoish/bond/management"
+)
+
+// AgingOptions configures priority aging, in which pending jobs gain
+// priority the longer they wait, so that low priority jobs eventually
+// run even when high priority jobs are always available.
+type AgingOptions struct {
+	// Interval is how long a job must wait to gain Step priority.
+	// An Interval of 0 disables aging.
+	Interval time.Duration `bson:"interval" json:"interval" yaml:"interval"`
+	// Step defaults to 1.
+	Step int `bson:"step" json:"step" yaml:"step"`
+	// Cap is the most priority a job can gain by waiting. A Cap
+	// of 0 means that there is no limit.
+	Cap int `bson:"cap" json:"cap" yaml:"cap"`
+	// Clock defaults to the system clock.
+	Clock clock.Clock `bson:"-" json:"-" yaml:"-"`
+}
+
+// Validate returns an error if the options are invalid, and sets
+// defaults for unspecified values.
+func (o *AgingOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(o.Interval < 0, "interval must be 0 or positive")
+	catcher.NewWhen(o.Step < 0, "step must be 0 or positive")
+	catcher.NewWhen(o.Cap < 0, "cap must be 0 or positive")
+	if catcher.HasErrors() {
+		return catcher.Resolve()
+	}
+
+	if o.Step == 0 {
+		o.Step = 1
+	}
+	o.Clock = clock.Or(o.Clock)
+
+	return nil
+}
+
+// EffectivePriority returns the job's priority, increased according
+// to the options for a job that has waited for the duration.
+func EffectivePriority(j amboy.Job, waited time.Duration, opts AgingOptions) int {
+	priority := j.Priority()
+	if opts.Interval <= 0 || waited <= 0 {
+		return priority
+	}
+
+	bonus := int(waited/opts.Interval) * opts.Step
+	if opts.Cap > 0 && bonus > opts.Cap {
+		bonus = opts.Cap
+	}
+
+	return priority + bonus
+}
+
+// Aging is an in-memory queue.Driver that dispatches jobs in order of
+// effective priority (see EffectivePriority), which it computes from
+// how long each job has been pending. Jobs with the same effective
+// priority are dispatched in the order that they were added.
+//
+// Like amboy's internal and priority drivers, Aging does not persist
+// jobs outside of the process. Its keyed locks (see Locker) are also
+// only shared within the process.
+type Aging struct {
+	name string
+	opts AgingOptions
+
+	mu         sync.RWMutex
+	closed     bool
+	jobs       map[string]amboy.Job
+	written    map[string]amboy.JobStatusInfo
+	pending    map[string]time.Time
+	dispatched map[string]struct{}
+	*LockTable
+}
+
+// NewAging constructs a driver, returning an error if the options are
+// not valid.
+func NewAging(opts AgingOptions) (*Aging, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid aging options")
+	}
+
+	return &Aging{
+		name:       uuid.NewV4().String(),
+		opts:       opts,
+		jobs:       map[string]amboy.Job{},
+		written:    map[string]amboy.JobStatusInfo{},
+		pending:    map[string]time.Time{},
+		dispatched: map[string]struct{}{},
+		LockTable:  NewLockTable(opts.Clock),
+	}, nil
+}
+
+// NewAgingQueue constructs a remote, unordered queue, with the
+// specified number of workers, that uses an Aging driver.
+func NewAgingQueue(workers int, opts AgingOptions) (queue.Remote, error) {
+	d, err := NewAging(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	q := queue.NewRemoteUnordered(workers)
+	if err = q.SetDriver(d); err != nil {
+		return nil, errors.Wrap(err, "problem setting driver")
+	}
+
+	return q, nil
+}
+
+// ID returns the driver's ID.
+func (d *Aging) ID() string { return d.name }
+
+// Open reopens the driver if it has been closed. Closing the driver
+// does not discard its jobs.
+func (d *Aging) Open(context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = false
+	return nil
+}
+
+// Close causes subsequent calls to Put, Save, and UpdateStatuses to
+// return ErrDriverClosed, and Next to return nil, until the driver is
+// reopened.
+func (d *Aging) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.closed = true
+}
+
+// Get returns the job with the specified ID.
+func (d *Aging) Get(_ context.Context, id string) (amboy.Job, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	j, ok := d.jobs[id]
+	if !ok {
+		return nil, errors.Wrapf(ErrJobNotFound, "no job named %s exists", id)
+	}
+
+	return j, nil
+}
+
+// Put adds a job to the driver, returning an error if it already
+// exists. Jobs begin aging from their creation time, if set, or when
+// they're added.
+func (d *Aging) Put(_ context.Context, j amboy.Job) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	id := j.ID()
+	if d.closed {
+		return errors.Wrapf(ErrDriverClosed, "cannot add job %s", id)
+	}
+	if _, ok := d.jobs[id]; ok {
+		return errors.Wrapf(ErrDuplicateJob, "cannot add a duplicate job %s", id)
+	}
+
+	d.jobs[id] = j
+	d.written[id] = j.Status()
+	if !j.Status().Completed {
+		d.pending[id] = d.since(j)
+	}
+
+	return nil
+}
+
+func (d *Aging) since(j amboy.Job) time.Time {
+	if created := j.TimeInfo().Created; !created.IsZero() {
+		return created
+	}
+
+	return d.opts.Clock.Now()
+}
+
+// track records the status of a job that has been saved, and updates
+// the pending and dispatched jobs: completed jobs are neither, and jobs that are neither
+// complete nor in progress, e.g. because they were requeued, are
+// pending again. Must be called with the lock held.
+func (d *Aging) track(j amboy.Job) {
+	id, stat := j.ID(), j.Status()
+	d.written[id] = stat
+	switch {
+	case stat.Completed:
+		delete(d.pending, id)
+		delete(d.dispatched, id)
+	case !stat.InProgress:
+		if _, ok := d.pending[id]; !ok {
+			d.pending[id] = d.since(j)
+		}
+		delete(d.dispatched, id)
+	}
+}
+
+// Save updates the stored job, returning an error if the job does not
+// exist. Jobs that are saved as neither complete nor in progress are
+// pending again.
+func (d *Aging) Save(_ context.Context, j amboy.Job) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	id := j.ID()
+	if d.closed {
+		return errors.Wrapf(ErrDriverClosed, "cannot save job %s", id)
+	}
+	if _, ok := d.jobs[id]; !ok {
+		return errors.Wrapf(ErrJobNotFound, "cannot save job %s, which does not exist", id)
+	}
+
+	d.jobs[id] = j
+	d.track(j)
+
+	return nil
+}
+
+// SaveFenced updates the stored job, if it was last saved with the
+// owner and modification count and not as complete, and implements
+// FencedSaver. Since the driver stores jobs rather than copies of
+// them, the lock generation is checked against the status that the
+// job had when it was last written.
+func (d *Aging) SaveFenced(_ context.Context, j amboy.Job, owner string, modCount int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	id := j.ID()
+	if d.closed {
+		return errors.Wrapf(ErrDriverClosed, "cannot save job %s", id)
+	}
+	stored, ok := d.written[id]
+	if !ok {
+		return errors.Wrapf(ErrJobNotFound, "cannot save job %s, which does not exist", id)
+	}
+	if err := CheckGeneration(id, stored, owner, modCount); err != nil {
+		return err
+	}
+
+	d.jobs[id] = j
+	d.track(j)
+
+	return nil
+}
+
+// UpdateStatuses applies the transition to the jobs that match the
+// filter at once, and returns the IDs of the changed jobs. Requeued
+// jobs age from their creation time, as they did when they were
+// added.
+func (d *Aging) UpdateStatuses(ctx context.Context, f management.Filter, t management.StatusTransition, note string) ([]string, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	match, err := f.Matcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid filter")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, errors.Wrap(ErrDriverClosed, "cannot update jobs")
+	}
+
+	ids := []string{}
+	for id, j := range d.jobs {
+		if ctx.Err() != nil {
+			return ids, errors.Wrap(ctx.Err(), "operation canceled")
+		}
+		if !match(j) || !t.Apply(j, note) {
+			continue
+		}
+
+		d.track(j)
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// Next returns the pending job with the highest effective priority,
+// or nil if there are no pending jobs.
+func (d *Aging) Next(ctx context.Context) amboy.Job {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil
+	}
+
+	now := d.opts.Clock.Now()
+	var (
+		next     amboy.Job
+		nextAt   time.Time
+		priority int
+	)
+
+	for id, since := range d.pending {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		j := d.jobs[id]
+		p := EffectivePriority(j, now.Sub(since), d.opts)
+		if next == nil || p > priority || (p == priority && since.Before(nextAt)) {
+			next, nextAt, priority = j, since, p
+		}
+	}
+
+	if next == nil {
+		return nil
+	}
+
+	delete(d.pending, next.ID())
+	d.dispatched[next.ID()] = struct{}{}
+
+	return next
+}
+
+// FindJobs returns summaries of the jobs that match the filter,
+// without copying every job out of the driver.
+func (d *Aging) FindJobs(ctx context.Context, f management.Filter) ([]management.JobInfo, error) {
+	match, err := f.Matcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid filter")
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	out := []management.JobInfo{}
+	for _, j := range d.jobs {
+		if ctx.Err() != nil {
+			return nil, errors.Wrap(ctx.Err(), "operation canceled")
+		}
+		if match(j) {
+			out = append(out, management.NewJobInfo(j))
+		}
+	}
+
+	return management.Paginate(out, f), nil
+}
+
+// Jobs iterates over all jobs in the driver.
+func (d *Aging) Jobs(context.Context) <-chan amboy.Job {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	out := make(chan amboy.Job, len(d.jobs))
+	for _, j := range d.jobs {
+		out <- j
+	}
+	close(out)
+
+	return out
+}
+
+// JobStats iterates over the status of all jobs in the driver.
+func (d *Aging) JobStats(context.Context) <-chan amboy.JobStatusInfo {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	out := make(chan amboy.JobStatusInfo, len(d.jobs))
+	for id, j := range d.jobs {
+		stat := j.Status()
+		stat.ID = id
+		out <- stat
+	}
+	close(out)
+
+	return out
+}
+
+// StreamJobStats calls the function with batches of the statuses of
+// the jobs that match the options, holding the driver's lock only
+// while it reads each batch, so that the function may use the driver.
+func (d *Aging) StreamJobStats(ctx context.Context, opts management.StatsOptions, fn func([]amboy.JobStatusInfo) error) error {
+	match, err := opts.Matcher()
+	if err != nil {
+		return errors.Wrap(err, "invalid stats options")
+	}
+
+	d.mu.RLock()
+	ids := make([]string, 0, len(d.jobs))
+	for id := range d.jobs {
+		ids = append(ids, id)
+	}
+	d.mu.RUnlock()
+
+	size := opts.Size()
+	for len(ids) > 0 {
+		if ctx.Err() != nil {
+			return errors.Wrap(ctx.Err(), "operation canceled")
+		}
+
+		batch := make([]amboy.JobStatusInfo, 0, size)
+		d.mu.RLock()
+		for len(ids) > 0 && len(batch) < size {
+			id := ids[0]
+			ids = ids[1:]
+
+			j, ok := d.jobs[id]
+			if !ok {
+				continue
+			}
+			stat := j.Status()
+			stat.ID = id
+			if match(stat) {
+				batch = append(batch, stat)
+			}
+		}
+		d.mu.RUnlock()
+
+		if len(batch) == 0 {
+			continue
+		}
+		if err = fn(batch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CountJobs counts the jobs that match the filter, without copying
+// them out of the driver.
+func (d *Aging) CountJobs(ctx context.Context, f management.Filter) (int, error) {
+	match, err := f.Matcher()
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid filter")
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	count := 0
+	for _, j := range d.jobs {
+		if ctx.Err() != nil {
+			return 0, errors.Wrap(ctx.Err(), "operation canceled")
+		}
+		if match(j) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Stats counts the jobs in the driver.
+func (d *Aging) Stats(context.Context) amboy.QueueStats {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	stats := amboy.QueueStats{Total: len(d.jobs)}
+	for _, j := range d.jobs {
+		stat := j.Status()
+		switch {
+		case stat.Completed:
+			stats.Completed++
+		case stat.InProgress && stat.Owner != "":
+			stats.Running++
+		default:
+			stats.Pending++
+		}
+	}
+
+	return stats
+}
@@ -0,0 +1,236 @@
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/clock"
+	"github.com/tychoish/bond/management"
+)
+
+func agingJob(id string, priority int, created time.Time) amboy.Job {
+	j := job.NewShellJob("true", "")
+	j.SetID(id)
+	j.SetPriority(priority)
+	j.UpdateTimeInfo(amboy.JobTimeInfo{Created: created})
+	return j
+}
+
+func TestEffectivePriority(t *testing.T) {
+	assert := assert.New(t)
+	j := agingJob("a", 1, time.Time{})
+
+	assert.Equal(1, EffectivePriority(j, time.Hour, AgingOptions{}))
+	assert.Equal(4, EffectivePriority(j, 3*time.Minute, AgingOptions{Interval: time.Minute, Step: 1}))
+	assert.Equal(7, EffectivePriority(j, 3*time.Minute, AgingOptions{Interval: time.Minute, Step: 2}))
+	assert.Equal(3, EffectivePriority(j, time.Hour, AgingOptions{Interval: time.Minute, Step: 1, Cap: 2}))
+}
+
+func TestAgingOptionsValidate(t *testing.T) {
+	opts := AgingOptions{Interval: time.Minute}
+	require.NoError(t, opts.Validate())
+	assert.Equal(t, 1, opts.Step)
+
+	assert.Error(t, (&AgingOptions{Interval: -1}).Validate())
+	assert.Error(t, (&AgingOptions{Step: -1}).Validate())
+	assert.Error(t, (&AgingOptions{Cap: -1}).Validate())
+}
+
+func TestAgingDriverDispatchesLongWaitingJobs(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	d, err := NewAging(AgingOptions{Interval: time.Minute, Cap: 20})
+	require.NoError(t, err)
+	require.NoError(t, d.Open(ctx))
+	defer d.Close()
+
+	now := time.Now()
+	require.NoError(t, d.Put(ctx, agingJob("old-low", 1, now.Add(-time.Hour))))
+	require.NoError(t, d.Put(ctx, agingJob("new-high", 10, now)))
+	require.NoError(t, d.Put(ctx, agingJob("new-mid", 5, now)))
+	assert.Error(d.Put(ctx, agingJob("new-mid", 5, now)))
+	assert.Equal(3, d.Stats(ctx).Pending)
+
+	// the old job has gained the capped 20 priority
+	for _, id := range []string{"old-low", "new-high", "new-mid"} {
+		j := d.Next(ctx)
+		require.NotNil(t, j)
+		assert.Equal(id, j.ID())
+
+		stat := j.Status()
+		stat.Completed = true
+		j.SetStatus(stat)
+		require.NoError(t, d.Save(ctx, j))
+	}
+
+	assert.Nil(d.Next(ctx))
+	assert.Equal(3, d.Stats(ctx).Completed)
+	assert.Error(d.Save(ctx, agingJob("missing", 0, now)))
+}
+
+func TestAgingQueueRunsJobs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := NewAgingQueue(1, AgingOptions{Cap: -1})
+	assert.Error(t, err)
+
+	q, err := NewAgingQueue(2, AgingOptions{Interval: time.Second})
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, q.Put(ctx, job.NewShellJob("true", "")))
+	}
+	amboy.WaitInterval(ctx, q, 10*time.Millisecond)
+	assert.Equal(t, 4, q.Stats(ctx).Completed)
+}
+
+func TestAgingDriverUsesClock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c := clock.NewFake(time.Now())
+	d, err := NewAging(AgingOptions{Interval: time.Minute, Clock: c})
+	require.NoError(t, err)
+
+	require.NoError(t, d.Put(ctx, agingJob("low", 1, time.Time{})))
+	c.Advance(10 * time.Minute)
+	require.NoError(t, d.Put(ctx, agingJob("high", 5, time.Time{})))
+
+	// the low priority job has waited long enough to overtake
+	// the new job
+	next := d.Next(ctx)
+	require.NotNil(t, next)
+	assert.Equal(t, "low", next.ID())
+	assert.Equal(t, "high", d.Next(ctx).ID())
+	assert.Nil(t, d.Next(ctx))
+}
+
+func TestAgingDriverErrors(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	d, err := NewAging(AgingOptions{})
+	require.NoError(t, err)
+
+	_, err = d.Get(ctx, "missing")
+	assert.Equal(ErrJobNotFound, errors.Cause(err))
+	assert.Equal(ErrJobNotFound, errors.Cause(d.Save(ctx, agingJob("missing", 0, time.Time{}))))
+
+	require.NoError(t, d.Put(ctx, agingJob("a", 0, time.Time{})))
+	assert.Equal(ErrDuplicateJob, errors.Cause(d.Put(ctx, agingJob("a", 0, time.Time{}))))
+
+	d.Close()
+	assert.Equal(ErrDriverClosed, errors.Cause(d.Put(ctx, agingJob("b", 0, time.Time{}))))
+	assert.Nil(d.Next(ctx))
+
+	require.NoError(t, d.Open(ctx))
+	assert.NotNil(d.Next(ctx))
+}
+
+func TestAgingDriverFindsJobs(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	d, err := NewAging(AgingOptions{})
+	require.NoError(t, err)
+
+	now := time.Now()
+	for idx, id := range []string{"build-c", "build-a", "test-b", "build-b"} {
+		require.NoError(t, d.Put(ctx, agingJob(id, 0, now.Add(time.Duration(idx)*time.Minute))))
+	}
+
+	jobs, err := d.FindJobs(ctx, management.Filter{Pattern: "^build-", Skip: 1, Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal("build-a", jobs[0].ID)
+
+	jobs, err = management.New(d).FindJobs(ctx, management.Filter{Pattern: "^build-"})
+	require.NoError(t, err)
+	require.Len(t, jobs, 3)
+	assert.Equal("build-c", jobs[0].ID)
+	assert.Equal("build-b", jobs[2].ID)
+
+	_, err = d.FindJobs(ctx, management.Filter{Pattern: "["})
+	assert.Error(err)
+}
+
+func TestAgingDriverStreamsJobStats(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	d, err := NewAging(AgingOptions{})
+	require.NoError(t, err)
+	for _, id := range []string{"build-a", "build-b", "build-c", "test-a"} {
+		require.NoError(t, d.Put(ctx, agingJob(id, 0, time.Now())))
+	}
+
+	// the function may use the driver between batches
+	ids := map[string]bool{}
+	sizes := []int{}
+	err = d.StreamJobStats(ctx, management.StatsOptions{Pattern: "^build-", BatchSize: 2}, func(batch []amboy.JobStatusInfo) error {
+		sizes = append(sizes, len(batch))
+		for _, stat := range batch {
+			ids[stat.ID] = true
+			j, err := d.Get(ctx, stat.ID)
+			require.NoError(t, err)
+			j.SetStatus(amboy.JobStatusInfo{Completed: true})
+			require.NoError(t, d.Save(ctx, j))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(map[string]bool{"build-a": true, "build-b": true, "build-c": true}, ids)
+	assert.Equal(3, sizes[0]+sizes[1])
+	assert.Len(sizes, 2)
+
+	count, err := management.New(d).CountJobs(ctx, management.Filter{Status: management.StatusCompleted, Type: "shell"})
+	require.NoError(t, err)
+	assert.Equal(3, count)
+	_, err = d.CountJobs(ctx, management.Filter{Pattern: "["})
+	assert.Error(err)
+	assert.Error(d.StreamJobStats(ctx, management.StatsOptions{Pattern: "["}, nil))
+}
+
+func TestAgingDriverUpdatesStatuses(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	d, err := NewAging(AgingOptions{})
+	require.NoError(t, err)
+
+	for _, id := range []string{"build-a", "build-b", "test-a"} {
+		require.NoError(t, d.Put(ctx, agingJob(id, 0, time.Time{})))
+	}
+	for d.Next(ctx) != nil {
+	}
+
+	ids, err := management.New(d).UpdateStatuses(ctx, management.Filter{Pattern: "^build-"}, management.TransitionAborted, "cleanup")
+	require.NoError(t, err)
+	assert.Len(ids, 2)
+	assert.Equal(2, d.Stats(ctx).Completed)
+
+	// requeued jobs dispatch again
+	ids, err = d.UpdateStatuses(ctx, management.Filter{Status: management.StatusFailed}, management.TransitionPending, "")
+	require.NoError(t, err)
+	assert.Len(ids, 2)
+	assert.Equal(3, d.Stats(ctx).Pending)
+	assert.NotNil(d.Next(ctx))
+	assert.NotNil(d.Next(ctx))
+	assert.Nil(d.Next(ctx))
+
+	_, err = d.UpdateStatuses(ctx, management.Filter{}, "restart", "")
+	assert.Error(err)
+	d.Close()
+	_, err = d.UpdateStatuses(ctx, management.Filter{}, management.TransitionPending, "")
+	assert.Equal(ErrDriverClosed, errors.Cause(err))
+}
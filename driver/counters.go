@@ -0,0 +1,226 @@
+package driver
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+// Counters are cumulative totals of the work that queues have
+// completed. Completed counts every job that finished, including the
+// Failed jobs, which finished with errors. Runtime is the sum of the
+// time between the start and end of each completed job.
+type Counters struct {
+	Completed int           `bson:"completed" json:"completed" yaml:"completed"`
+	Failed    int           `bson:"failed" json:"failed" yaml:"failed"`
+	Runtime   time.Duration `bson:"runtime" json:"runtime" yaml:"runtime"`
+}
+
+// Add adds the other counters to these counters.
+func (c *Counters) Add(other Counters) {
+	c.Completed += other.Completed
+	c.Failed += other.Failed
+	c.Runtime += other.Runtime
+}
+
+// CountersFor returns the counters for a completed job, or zero
+// counters if the job is not complete.
+func CountersFor(j amboy.Job) Counters {
+	stat := j.Status()
+	if !stat.Completed {
+		return Counters{}
+	}
+
+	c := Counters{Completed: 1}
+	if stat.ErrorCount > 0 || j.Error() != nil {
+		c.Failed = 1
+	}
+
+	ti := j.TimeInfo()
+	if !ti.Start.IsZero() && ti.End.After(ti.Start) {
+		c.Runtime = ti.End.Sub(ti.Start)
+	}
+
+	return c
+}
+
+// CounterStore persists Counters outside of the process, so that they
+// accumulate over every run of a queue rather than resetting when the
+// process restarts. Drivers that can store the counters with the
+// queue's jobs may implement CounterStore.
+type CounterStore interface {
+	Counters(context.Context) (Counters, error)
+	AddCounters(context.Context, Counters) error
+}
+
+// LifetimeReporter is implemented by drivers that report the
+// cumulative counters of every run of their queue, such as Counted.
+type LifetimeReporter interface {
+	Lifetime(context.Context) (Counters, error)
+}
+
+// FileCounterStore is a CounterStore that keeps the counters in a JSON
+// file, for queues on a single host. The file is replaced on every
+// update, so a crash never leaves a partially written file, but
+// processes that share the file may lose each others' updates.
+type FileCounterStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileCounterStore constructs a store that keeps counters in the
+// file at the path. A missing file holds zero counters.
+func NewFileCounterStore(path string) (*FileCounterStore, error) {
+	if path == "" {
+		return nil, errors.New("must specify a path for the counters")
+	}
+
+	return &FileCounterStore{path: path}, nil
+}
+
+// Counters reads the counters from the file.
+func (s *FileCounterStore) Counters(context.Context) (Counters, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.read()
+}
+
+// AddCounters adds to the counters in the file.
+func (s *FileCounterStore) AddCounters(_ context.Context, c Counters) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total, err := s.read()
+	if err != nil {
+		return err
+	}
+	total.Add(c)
+
+	data, err := json.Marshal(total)
+	if err != nil {
+		return errors.Wrap(err, "problem encoding counters")
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".")
+	if err != nil {
+		return errors.Wrap(err, "problem creating counters file")
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(err)
+	catcher.Add(tmp.Close())
+	if catcher.HasErrors() {
+		return errors.Wrapf(catcher.Resolve(), "problem writing counters to '%s'", tmp.Name())
+	}
+
+	return errors.Wrapf(os.Rename(tmp.Name(), s.path), "problem replacing counters file '%s'", s.path)
+}
+
+func (s *FileCounterStore) read() (Counters, error) {
+	c := Counters{}
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, errors.Wrapf(err, "problem reading counters from '%s'", s.path)
+	}
+
+	return c, errors.Wrapf(json.Unmarshal(data, &c), "problem decoding counters from '%s'", s.path)
+}
+
+// Counted wraps a driver and adds the counters of every job that the
+// driver dispatches and then saves as complete to a CounterStore, so
+// that the lifetime totals of a queue survive restarts, unlike the
+// queue's Stats, which only describe the jobs that are currently
+// stored.
+//
+// Jobs are counted once, when the process that dispatched them saves
+// them as complete; jobs that are completed by other means (e.g.
+// management.Manager.Abort) are not counted. Problems updating the
+// counters are logged, and do not fail the save.
+type Counted struct {
+	queue.Driver
+
+	store      CounterStore
+	mu         sync.Mutex
+	dispatched map[string]struct{}
+}
+
+// NewCounted wraps the driver, counting jobs in the store. If the store
+// is nil, the driver itself must implement CounterStore.
+func NewCounted(d queue.Driver, store CounterStore) (*Counted, error) {
+	if d == nil {
+		return nil, errors.New("cannot wrap a nil driver")
+	}
+
+	if store == nil {
+		var ok bool
+		if store, ok = d.(CounterStore); !ok {
+			return nil, errors.Errorf("driver '%s' cannot store counters, and no store was specified", d.ID())
+		}
+	}
+
+	return &Counted{Driver: d, store: store, dispatched: map[string]struct{}{}}, nil
+}
+
+// Lifetime returns the counters from the store.
+func (d *Counted) Lifetime(ctx context.Context) (Counters, error) {
+	c, err := d.store.Counters(ctx)
+	return c, errors.Wrap(err, "problem reading counters")
+}
+
+// Next returns the next job from the wrapped driver, and records that
+// it was dispatched.
+func (d *Counted) Next(ctx context.Context) amboy.Job {
+	j := d.Driver.Next(ctx)
+	if j != nil {
+		d.mu.Lock()
+		d.dispatched[j.ID()] = struct{}{}
+		d.mu.Unlock()
+	}
+
+	return j
+}
+
+// Save writes the job to the wrapped driver, and counts dispatched
+// jobs that are saved as complete.
+func (d *Counted) Save(ctx context.Context, j amboy.Job) error {
+	if err := d.Driver.Save(ctx, j); err != nil {
+		return err
+	}
+
+	c := CountersFor(j)
+	if c.Completed == 0 {
+		return nil
+	}
+
+	d.mu.Lock()
+	_, ok := d.dispatched[j.ID()]
+	delete(d.dispatched, j.ID())
+	d.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	grip.Warning(message.WrapError(d.store.AddCounters(ctx, c), message.Fields{
+		"message": "problem updating lifetime counters",
+		"driver":  d.ID(),
+		"job_id":  j.ID(),
+	}))
+
+	return nil
+}
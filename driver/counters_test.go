@@ -0,0 +1,133 @@
+package driver
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileCounterStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	_, err := NewFileCounterStore("")
+	assert.Error(err)
+
+	dir, err := ioutil.TempDir("", "bond-counters")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "counters.json")
+
+	store, err := NewFileCounterStore(path)
+	require.NoError(t, err)
+	c, err := store.Counters(ctx)
+	require.NoError(t, err)
+	assert.Equal(Counters{}, c)
+
+	require.NoError(t, store.AddCounters(ctx, Counters{Completed: 2, Failed: 1, Runtime: time.Second}))
+	require.NoError(t, store.AddCounters(ctx, Counters{Completed: 1, Runtime: time.Second}))
+
+	// a new store reads the counters from the file
+	store, err = NewFileCounterStore(path)
+	require.NoError(t, err)
+	c, err = store.Counters(ctx)
+	require.NoError(t, err)
+	assert.Equal(Counters{Completed: 3, Failed: 1, Runtime: 2 * time.Second}, c)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("{"), 0600))
+	_, err = store.Counters(ctx)
+	assert.Error(err)
+	assert.Error(store.AddCounters(ctx, Counters{Completed: 1}))
+}
+
+func TestCountedDriverPersistsCountersAcrossRuns(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := NewCounted(nil, nil)
+	assert.Error(err)
+	_, err = NewCounted(queue.NewInternalDriver(), nil)
+	assert.Error(err)
+
+	dir, err := ioutil.TempDir("", "bond-counters")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store, err := NewFileCounterStore(filepath.Join(dir, "counters.json"))
+	require.NoError(t, err)
+
+	run := func(total int, cmds ...string) {
+		d, err := NewCounted(queue.NewInternalDriver(), store)
+		require.NoError(t, err)
+
+		qctx, qcancel := context.WithCancel(ctx)
+		defer qcancel()
+		q := queue.NewRemoteUnordered(2)
+		require.NoError(t, q.SetDriver(d))
+		require.NoError(t, q.Start(qctx))
+		for _, cmd := range cmds {
+			require.NoError(t, q.Put(qctx, job.NewShellJob(cmd, "")))
+		}
+		require.True(t, amboy.WaitInterval(qctx, q, 10*time.Millisecond))
+
+		// in-memory jobs are complete before the queue saves them
+		for {
+			c, err := d.Lifetime(qctx)
+			require.NoError(t, err)
+			if c.Completed == total {
+				return
+			}
+			select {
+			case <-qctx.Done():
+				require.FailNow(t, "jobs were not counted")
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+
+	run(2, "true", "false")
+	run(3, "true")
+
+	d, err := NewCounted(queue.NewInternalDriver(), store)
+	require.NoError(t, err)
+	c, err := d.Lifetime(ctx)
+	require.NoError(t, err)
+	assert.Equal(3, c.Completed)
+	assert.Equal(1, c.Failed)
+	assert.True(c.Runtime > 0)
+
+	// saving a job that the driver did not dispatch is not counted
+	require.NoError(t, d.Open(ctx))
+	j := job.NewShellJob("true", "")
+	require.NoError(t, d.Put(ctx, j))
+	j.Run(ctx)
+	require.NoError(t, d.Save(ctx, j))
+	c, err = d.Lifetime(ctx)
+	require.NoError(t, err)
+	assert.Equal(3, c.Completed)
+}
+
+func TestCountersFor(t *testing.T) {
+	assert := assert.New(t)
+
+	j := job.NewShellJob("true", "")
+	assert.Equal(Counters{}, CountersFor(j))
+
+	start := time.Now()
+	j.UpdateTimeInfo(amboy.JobTimeInfo{Start: start, End: start.Add(time.Second)})
+	j.MarkComplete()
+	assert.Equal(Counters{Completed: 1, Runtime: time.Second}, CountersFor(j))
+
+	j.AddError(errors.New("failed"))
+	assert.Equal(Counters{Completed: 1, Failed: 1, Runtime: time.Second}, CountersFor(j))
+}
@@ -0,0 +1,663 @@
+/*
+Package drivertest provides a queue.Driver for testing applications
+that use amboy queues, without a database or timing dependencies.
+
+The Driver dispatches jobs in a deterministic order (insertion order
+by default, or an order set by the test), can hold jobs until the test
+releases them, can fail operations on demand, and records every call
+so that tests can make assertions about how the queue used it.
+*/
+package drivertest
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/driver"
+	"github.com/tychoish/bond/management"
+)
+
+// Op identifies a driver operation.
+type Op string
+
+// Operations that the Driver records and can fail.
+const (
+	OpOpen   Op = "open"
+	OpGet    Op = "get"
+	OpFind   Op = "find"
+	OpPut    Op = "put"
+	OpSave   Op = "save"
+	OpNext   Op = "next"
+	OpUpdate Op = "update"
+	OpClose  Op = "close"
+	// OpLock is the operation of acquiring, renewing, and
+	// releasing keyed locks (see driver.Locker), which record and
+	// fail with the lock's key as the job ID.
+	OpLock Op = "lock"
+)
+
+// Call records one operation on the Driver. JobID is empty for
+// operations that don't concern a specific job.
+type Call struct {
+	Op    Op
+	JobID string
+	Err   error
+}
+
+// Failure decides whether an operation on a job should fail. Return
+// nil for the operation to proceed.
+type Failure func(op Op, id string) error
+
+// Driver is a deterministic, in-memory queue.Driver.
+type Driver struct {
+	name string
+
+	mu         sync.Mutex
+	closed     bool
+	jobs       map[string]amboy.Job
+	order      []string
+	dispatched map[string]struct{}
+	less       func(a, b amboy.Job) bool
+	holding    bool
+	released   []string
+	failures   map[Op][]Failure
+	calls      []Call
+	hooks      []func(Call)
+	counters   driver.Counters
+	locking    bool
+	written    map[string]amboy.JobStatusInfo
+	locks      *driver.LockTable
+}
+
+// New constructs a driver with the specified ID.
+func New(name string) *Driver {
+	return &Driver{
+		name:       name,
+		jobs:       map[string]amboy.Job{},
+		dispatched: map[string]struct{}{},
+		failures:   map[Op][]Failure{},
+		written:    map[string]amboy.JobStatusInfo{},
+		locks:      driver.NewLockTable(nil),
+	}
+}
+
+// EnforceLocks makes the driver respect job locks as amboy's MongoDB
+// drivers do: Save returns an error wrapping driver.ErrFenced for jobs
+// that are locked by an owner other than the driver's ID, and Next
+// does not dispatch locked jobs, until the locks are older than
+// amboy.LockTimeout. Since the driver stores jobs rather than copies
+// of them, locks are checked against the status that jobs had when
+// they were last written.
+func (d *Driver) EnforceLocks() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.locking = true
+}
+
+// locked must be called with the lock held, and reports whether the
+// most recent write of the job holds an unexpired lock.
+func (d *Driver) locked(id string) (string, bool) {
+	stat := d.written[id]
+	if !stat.InProgress || stat.Owner == "" || time.Since(stat.ModificationTime) >= amboy.LockTimeout {
+		return "", false
+	}
+
+	return stat.Owner, true
+}
+
+// write must be called with the lock held.
+func (d *Driver) write(j amboy.Job) {
+	id := j.ID()
+	d.jobs[id] = j
+	d.written[id] = j.Status()
+	if stat := j.Status(); !stat.Completed && !stat.InProgress {
+		delete(d.dispatched, id)
+	}
+}
+
+// SetOrder makes Next dispatch the pending job that sorts first
+// according to less. Jobs that compare equal are dispatched in
+// insertion order. A nil function restores insertion order.
+func (d *Driver) SetOrder(less func(a, b amboy.Job) bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.less = less
+}
+
+// Hold stops Next from dispatching jobs until they're released.
+func (d *Driver) Hold() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.holding = true
+}
+
+// Release allows held jobs to dispatch, in the order given. When no
+// IDs are given, Release stops holding jobs.
+func (d *Driver) Release(ids ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(ids) == 0 {
+		d.holding = false
+		d.released = nil
+		return
+	}
+
+	d.released = append(d.released, ids...)
+}
+
+// Fail makes every call of the operation fail with the error.
+func (d *Driver) Fail(op Op, err error) {
+	d.FailWith(op, func(Op, string) error { return err })
+}
+
+// FailNext makes the next call of the operation fail with the error.
+func (d *Driver) FailNext(op Op, err error) {
+	done := false
+	d.FailWith(op, func(Op, string) error {
+		if done {
+			return nil
+		}
+		done = true
+		return err
+	})
+}
+
+// FailJob makes every call of the operation fail for the job with
+// the specified ID.
+func (d *Driver) FailJob(op Op, id string, err error) {
+	d.FailWith(op, func(_ Op, jid string) error {
+		if jid == id {
+			return err
+		}
+		return nil
+	})
+}
+
+// FailWith adds a failure for the operation. Failures are consulted
+// in the order they were added, and the first error wins. Failures
+// for Next are consulted with the ID of the job that would have been
+// dispatched, and, if they return an error, Next returns nil and the
+// job remains pending.
+func (d *Driver) FailWith(op Op, f Failure) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.failures[op] = append(d.failures[op], f)
+}
+
+// Reset removes all failures.
+func (d *Driver) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.failures = map[Op][]Failure{}
+}
+
+// OnCall adds a hook that runs after every operation. Hooks run
+// without the driver's lock held, and may call the driver.
+func (d *Driver) OnCall(hook func(Call)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.hooks = append(d.hooks, hook)
+}
+
+// Calls returns every operation recorded so far, in order.
+func (d *Driver) Calls() []Call {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make([]Call, len(d.calls))
+	copy(out, d.calls)
+	return out
+}
+
+// CallsFor returns the recorded calls of the operation.
+func (d *Driver) CallsFor(op Op) []Call {
+	out := []Call{}
+	for _, c := range d.Calls() {
+		if c.Op == op {
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+// Dispatched returns the IDs of the jobs returned by Next, in order.
+func (d *Driver) Dispatched() []string {
+	out := []string{}
+	for _, c := range d.CallsFor(OpNext) {
+		if c.JobID != "" && c.Err == nil {
+			out = append(out, c.JobID)
+		}
+	}
+
+	return out
+}
+
+// failure must be called with the lock held.
+func (d *Driver) failure(op Op, id string) error {
+	for _, f := range d.failures[op] {
+		if err := f(op, id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// record must be called with the lock held, and returns the hooks to
+// run once the lock is released.
+func (d *Driver) record(op Op, id string, err error) (Call, []func(Call)) {
+	c := Call{Op: op, JobID: id, Err: err}
+	d.calls = append(d.calls, c)
+
+	hooks := make([]func(Call), len(d.hooks))
+	copy(hooks, d.hooks)
+	return c, hooks
+}
+
+func runHooks(c Call, hooks []func(Call)) {
+	for _, h := range hooks {
+		h(c)
+	}
+}
+
+// do runs an operation on a job with the lock held, applying
+// failures and recording the call.
+func (d *Driver) do(op Op, id string, fn func() error) error {
+	d.mu.Lock()
+	err := d.failure(op, id)
+	if err == nil && d.closed && (op == OpPut || op == OpSave || op == OpUpdate || op == OpLock) {
+		err = errors.Wrapf(driver.ErrDriverClosed, "cannot %s job %s", op, id)
+	}
+	if err == nil && fn != nil {
+		err = fn()
+	}
+	c, hooks := d.record(op, id, err)
+	d.mu.Unlock()
+
+	runHooks(c, hooks)
+	return err
+}
+
+// ID returns the driver's name.
+func (d *Driver) ID() string { return d.name }
+
+// Open records the call, and reopens the driver if it was closed.
+func (d *Driver) Open(context.Context) error {
+	return d.do(OpOpen, "", func() error { d.closed = false; return nil })
+}
+
+// Close records the call. Until the driver is reopened, Put, Save,
+// UpdateStatuses, and the lock operations return
+// driver.ErrDriverClosed.
+func (d *Driver) Close() {
+	_ = d.do(OpClose, "", func() error { d.closed = true; return nil })
+}
+
+// Get returns the job with the specified ID.
+func (d *Driver) Get(_ context.Context, id string) (amboy.Job, error) {
+	var j amboy.Job
+	err := d.do(OpGet, id, func() error {
+		var ok bool
+		if j, ok = d.jobs[id]; !ok {
+			return errors.Wrapf(driver.ErrJobNotFound, "no job named %s exists", id)
+		}
+		return nil
+	})
+
+	return j, err
+}
+
+// Put adds a job, returning an error if it already exists.
+func (d *Driver) Put(_ context.Context, j amboy.Job) error {
+	id := j.ID()
+	return d.do(OpPut, id, func() error {
+		if _, ok := d.jobs[id]; ok {
+			return errors.Wrapf(driver.ErrDuplicateJob, "cannot add a duplicate job %s", id)
+		}
+
+		d.jobs[id] = j
+		d.written[id] = j.Status()
+		d.order = append(d.order, id)
+		return nil
+	})
+}
+
+// Save updates a job, returning an error if it does not exist, or,
+// if the driver enforces locks, if another owner holds its lock.
+func (d *Driver) Save(_ context.Context, j amboy.Job) error {
+	id := j.ID()
+	return d.do(OpSave, id, func() error {
+		if _, ok := d.jobs[id]; !ok {
+			return errors.Wrapf(driver.ErrJobNotFound, "cannot save job %s, which does not exist", id)
+		}
+		if owner, ok := d.locked(id); ok && d.locking && owner != d.name {
+			return errors.Wrapf(driver.ErrFenced, "cannot save job %s, which is locked by '%s'", id, owner)
+		}
+
+		d.write(j)
+		return nil
+	})
+}
+
+// SaveFenced saves a job, as a recorded Save operation, if it was
+// last written with the owner and modification count and not as
+// complete, and implements driver.FencedSaver.
+func (d *Driver) SaveFenced(_ context.Context, j amboy.Job, owner string, modCount int) error {
+	id := j.ID()
+	return d.do(OpSave, id, func() error {
+		stored, ok := d.written[id]
+		if !ok {
+			return errors.Wrapf(driver.ErrJobNotFound, "cannot save job %s, which does not exist", id)
+		}
+		if err := driver.CheckGeneration(id, stored, owner, modCount); err != nil {
+			return err
+		}
+
+		d.write(j)
+		return nil
+	})
+}
+
+// AcquireLock takes the keyed lock, as a recorded Lock operation, and
+// implements driver.Locker.
+func (d *Driver) AcquireLock(ctx context.Context, key, owner string, ttl time.Duration) error {
+	return d.do(OpLock, key, func() error { return d.locks.AcquireLock(ctx, key, owner, ttl) })
+}
+
+// RenewLock extends the keyed lock, as a recorded Lock operation.
+func (d *Driver) RenewLock(ctx context.Context, key, owner string, ttl time.Duration) error {
+	return d.do(OpLock, key, func() error { return d.locks.RenewLock(ctx, key, owner, ttl) })
+}
+
+// ReleaseLock releases the keyed lock, as a recorded Lock operation.
+func (d *Driver) ReleaseLock(ctx context.Context, key, owner string) error {
+	return d.do(OpLock, key, func() error { return d.locks.ReleaseLock(ctx, key, owner) })
+}
+
+// Locks returns the keyed locks that are held.
+func (d *Driver) Locks() []driver.LockInfo { return d.locks.Locks() }
+
+// Reclaim saves a job, as a recorded Save operation, if it is locked
+// by an owner with the prefix, regardless of the age of the lock, and
+// implements management.Reclaimer.
+func (d *Driver) Reclaim(_ context.Context, j amboy.Job, prefix string) error {
+	id := j.ID()
+	return d.do(OpSave, id, func() error {
+		if _, ok := d.jobs[id]; !ok {
+			return errors.Wrapf(driver.ErrJobNotFound, "cannot reclaim job %s, which does not exist", id)
+		}
+		if stat := d.written[id]; !stat.InProgress || stat.Owner == "" || !strings.HasPrefix(stat.Owner, prefix) {
+			return errors.Wrapf(driver.ErrFenced, "cannot reclaim job %s, which is not locked by '%s*'", id, prefix)
+		}
+
+		d.write(j)
+		return nil
+	})
+}
+
+// FindJobs returns summaries of the jobs that match the filter, as
+// one recorded operation.
+func (d *Driver) FindJobs(_ context.Context, f management.Filter) ([]management.JobInfo, error) {
+	out := []management.JobInfo{}
+	err := d.do(OpFind, "", func() error {
+		match, err := f.Matcher()
+		if err != nil {
+			return errors.Wrap(err, "invalid filter")
+		}
+
+		for _, id := range d.order {
+			if j := d.jobs[id]; match(j) {
+				out = append(out, management.NewJobInfo(j))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return management.Paginate(out, f), nil
+}
+
+// StreamJobStats calls the function with batches of the statuses of
+// the jobs that match the options, in insertion order, reading each
+// batch as one recorded find operation, so that tests can fail a
+// stream after some of its batches.
+func (d *Driver) StreamJobStats(_ context.Context, opts management.StatsOptions, fn func([]amboy.JobStatusInfo) error) error {
+	match, err := opts.Matcher()
+	if err != nil {
+		return errors.Wrap(err, "invalid stats options")
+	}
+
+	size := opts.Size()
+	for pos, done := 0, false; !done; {
+		batch := make([]amboy.JobStatusInfo, 0, size)
+		err = d.do(OpFind, "", func() error {
+			for ; pos < len(d.order) && len(batch) < size; pos++ {
+				id := d.order[pos]
+				stat := d.jobs[id].Status()
+				stat.ID = id
+				if match(stat) {
+					batch = append(batch, stat)
+				}
+			}
+			done = pos >= len(d.order)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(batch) > 0 {
+			if err = fn(batch); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// CountJobs counts the jobs that match the filter, as one recorded
+// find operation.
+func (d *Driver) CountJobs(_ context.Context, f management.Filter) (int, error) {
+	count := 0
+	err := d.do(OpFind, "", func() error {
+		match, err := f.Matcher()
+		if err != nil {
+			return errors.Wrap(err, "invalid filter")
+		}
+
+		for _, id := range d.order {
+			if match(d.jobs[id]) {
+				count++
+			}
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// UpdateStatuses applies the transition to the jobs that match the
+// filter, in insertion order, as one recorded operation, and returns
+// the IDs of the changed jobs.
+func (d *Driver) UpdateStatuses(_ context.Context, f management.Filter, t management.StatusTransition, note string) ([]string, error) {
+	ids := []string{}
+	err := d.do(OpUpdate, "", func() error {
+		match, err := f.Matcher()
+		if err != nil {
+			return errors.Wrap(err, "invalid filter")
+		}
+
+		for _, id := range d.order {
+			j := d.jobs[id]
+			if !match(j) || !t.Apply(j, note) {
+				continue
+			}
+			d.write(j)
+			ids = append(ids, id)
+		}
+		return nil
+	})
+
+	return ids, err
+}
+
+// Counters returns the counters that were added to the driver, which
+// implements driver.CounterStore so that tests can restart queues
+// that use a driver.Counted with the same Driver.
+func (d *Driver) Counters(context.Context) (driver.Counters, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.counters, nil
+}
+
+// AddCounters adds to the driver's counters.
+func (d *Driver) AddCounters(_ context.Context, c driver.Counters) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.counters.Add(c)
+	return nil
+}
+
+// pending must be called with the lock held, and returns the IDs of
+// jobs that are neither complete nor in progress, in dispatch order.
+func (d *Driver) pending() []string {
+	ids := []string{}
+	for _, id := range d.order {
+		if _, ok := d.dispatched[id]; ok {
+			continue
+		}
+		if _, ok := d.locked(id); ok && d.locking {
+			continue
+		}
+		if !d.jobs[id].Status().Completed {
+			ids = append(ids, id)
+		}
+	}
+
+	if d.less != nil {
+		sort.SliceStable(ids, func(i, j int) bool { return d.less(d.jobs[ids[i]], d.jobs[ids[j]]) })
+	}
+
+	return ids
+}
+
+// candidate must be called with the lock held.
+func (d *Driver) candidate() string {
+	pending := d.pending()
+	if !d.holding {
+		if len(pending) == 0 {
+			return ""
+		}
+		return pending[0]
+	}
+
+	for len(d.released) > 0 {
+		id := d.released[0]
+		for _, p := range pending {
+			if p == id {
+				return id
+			}
+		}
+		// released jobs that aren't pending are dropped
+		d.released = d.released[1:]
+	}
+
+	return ""
+}
+
+// Next returns the next pending job, or nil if there is none. Only
+// calls to Next that find a job are recorded, since queues call Next
+// continuously. Dispatched jobs are not pending again unless they're
+// saved as neither in progress nor complete.
+func (d *Driver) Next(context.Context) amboy.Job {
+	d.mu.Lock()
+	id := d.candidate()
+	if id == "" {
+		d.mu.Unlock()
+		return nil
+	}
+
+	var j amboy.Job
+	err := d.failure(OpNext, id)
+	if err == nil {
+		j = d.jobs[id]
+		d.dispatched[id] = struct{}{}
+		if d.holding {
+			d.released = d.released[1:]
+		}
+	}
+	c, hooks := d.record(OpNext, id, err)
+	d.mu.Unlock()
+
+	runHooks(c, hooks)
+	return j
+}
+
+// Jobs iterates over all jobs, in insertion order.
+func (d *Driver) Jobs(context.Context) <-chan amboy.Job {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make(chan amboy.Job, len(d.order))
+	for _, id := range d.order {
+		out <- d.jobs[id]
+	}
+	close(out)
+
+	return out
+}
+
+// JobStats iterates over the status of all jobs, in insertion order.
+func (d *Driver) JobStats(context.Context) <-chan amboy.JobStatusInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make(chan amboy.JobStatusInfo, len(d.order))
+	for _, id := range d.order {
+		stat := d.jobs[id].Status()
+		stat.ID = id
+		out <- stat
+	}
+	close(out)
+
+	return out
+}
+
+// Stats counts the jobs in the driver.
+func (d *Driver) Stats(context.Context) amboy.QueueStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := amboy.QueueStats{Total: len(d.jobs)}
+	for _, j := range d.jobs {
+		stat := j.Status()
+		switch {
+		case stat.Completed:
+			stats.Completed++
+		case stat.InProgress:
+			stats.Running++
+		default:
+			stats.Pending++
+		}
+	}
+
+	return stats
+}
@@ -0,0 +1,322 @@
+package drivertest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/management"
+)
+
+func testJob(id string, priority int) amboy.Job {
+	j := job.NewShellJob("true", "")
+	j.SetID(id)
+	j.SetPriority(priority)
+	return j
+}
+
+func TestDriverDispatchOrder(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	d := New("test")
+	assert.Equal("test", d.ID())
+	require.NoError(t, d.Open(ctx))
+	for idx, id := range []string{"a", "b", "c"} {
+		require.NoError(t, d.Put(ctx, testJob(id, idx)))
+	}
+	assert.Error(d.Put(ctx, testJob("a", 0)))
+
+	assert.Equal("a", d.Next(ctx).ID())
+
+	// higher priority first
+	d.SetOrder(func(a, b amboy.Job) bool { return a.Priority() > b.Priority() })
+	assert.Equal("c", d.Next(ctx).ID())
+	assert.Equal("b", d.Next(ctx).ID())
+	assert.Nil(d.Next(ctx))
+	assert.Equal([]string{"a", "c", "b"}, d.Dispatched())
+
+	// jobs saved as pending are dispatched again
+	j, err := d.Get(ctx, "b")
+	require.NoError(t, err)
+	require.NoError(t, d.Save(ctx, j))
+	assert.Equal("b", d.Next(ctx).ID())
+
+	// held jobs dispatch in the order they're released
+	d.SetOrder(nil)
+	d.Hold()
+	for _, id := range []string{"d", "e", "f"} {
+		require.NoError(t, d.Put(ctx, testJob(id, 0)))
+	}
+	assert.Nil(d.Next(ctx))
+	d.Release("f", "missing", "d")
+	assert.Equal("f", d.Next(ctx).ID())
+	assert.Equal("d", d.Next(ctx).ID())
+	assert.Nil(d.Next(ctx))
+	d.Release()
+	assert.Equal("e", d.Next(ctx).ID())
+
+	assert.Equal(6, d.Stats(ctx).Total)
+	assert.Equal(6, len(d.JobStats(ctx)))
+	assert.Equal(6, len(d.Jobs(ctx)))
+}
+
+func TestDriverFailures(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	boom := errors.New("boom")
+
+	d := New("test")
+	d.FailNext(OpPut, boom)
+	assert.Equal(boom, d.Put(ctx, testJob("a", 0)))
+	require.NoError(t, d.Put(ctx, testJob("a", 0)))
+
+	d.FailJob(OpSave, "a", boom)
+	j, err := d.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(boom, d.Save(ctx, j))
+
+	d.Fail(OpGet, boom)
+	_, err = d.Get(ctx, "a")
+	assert.Equal(boom, err)
+
+	d.FailNext(OpNext, boom)
+	assert.Nil(d.Next(ctx))
+	assert.Equal("a", d.Next(ctx).ID())
+
+	d.Reset()
+	_, err = d.Get(ctx, "a")
+	assert.NoError(err)
+
+	calls := d.CallsFor(OpNext)
+	require.Len(t, calls, 2)
+	assert.Equal(boom, calls[0].Err)
+	assert.NoError(calls[1].Err)
+}
+
+func TestDriverUpdatesStatuses(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	d := New("test")
+	for _, id := range []string{"failed-0", "failed-1", "passed", "pending"} {
+		require.NoError(t, d.Put(ctx, testJob(id, 0)))
+	}
+	for _, id := range []string{"failed-0", "failed-1", "passed"} {
+		j := d.Next(ctx)
+		require.Equal(t, id, j.ID())
+		j.SetStatus(amboy.JobStatusInfo{Completed: true})
+		if id != "passed" {
+			j.AddError(errors.New("network"))
+		}
+	}
+
+	// a mass requeue is one operation, and requeued jobs are
+	// dispatched again
+	ids, err := management.New(d).RequeueFailed(ctx, management.Filter{})
+	require.NoError(t, err)
+	assert.Equal([]string{"failed-0", "failed-1"}, ids)
+	assert.Len(d.CallsFor(OpUpdate), 1)
+	assert.Empty(d.CallsFor(OpSave))
+	assert.Equal("failed-0", d.Next(ctx).ID())
+
+	ids, err = d.UpdateStatuses(ctx, management.Filter{}, management.TransitionAborted, "maintenance")
+	require.NoError(t, err)
+	assert.Equal([]string{"failed-0", "failed-1", "pending"}, ids)
+	j, err := d.Get(ctx, "pending")
+	require.NoError(t, err)
+	assert.True(j.Status().Completed)
+	assert.Error(j.Error())
+
+	d.Close()
+	_, err = d.UpdateStatuses(ctx, management.Filter{}, management.TransitionPending, "")
+	assert.Error(err)
+}
+
+func TestDriverStreamsJobStats(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	boom := errors.New("boom")
+
+	d := New("test")
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		require.NoError(t, d.Put(ctx, testJob(id, 0)))
+	}
+	j, err := d.Get(ctx, "c")
+	require.NoError(t, err)
+	j.SetStatus(amboy.JobStatusInfo{Completed: true})
+	require.NoError(t, d.Save(ctx, j))
+
+	// each batch is one find
+	batches := [][]string{}
+	err = d.StreamJobStats(ctx, management.StatsOptions{Status: management.StatusPending, BatchSize: 2}, func(batch []amboy.JobStatusInfo) error {
+		ids := []string{}
+		for _, stat := range batch {
+			ids = append(ids, stat.ID)
+		}
+		batches = append(batches, ids)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal([][]string{{"a", "b"}, {"d", "e"}}, batches)
+	assert.Len(d.CallsFor(OpFind), 2)
+
+	// streams fail at the batch that fails
+	calls := 0
+	err = d.StreamJobStats(ctx, management.StatsOptions{BatchSize: 2}, func([]amboy.JobStatusInfo) error {
+		calls++
+		d.FailNext(OpFind, boom)
+		return nil
+	})
+	assert.Equal(boom, err)
+	assert.Equal(1, calls)
+
+	count, err := management.CountJobs(ctx, d, management.Filter{Status: management.StatusPending})
+	require.NoError(t, err)
+	assert.Equal(4, count)
+	d.FailNext(OpFind, boom)
+	_, err = d.CountJobs(ctx, management.Filter{})
+	assert.Equal(boom, err)
+}
+
+func TestDriverEnforcesLocks(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	d := New("downloads.host-a.run-2")
+	d.EnforceLocks()
+	for id, owner := range map[string]string{"mine": "downloads.host-a.run-2", "crashed": "downloads.host-a.run-1", "expired": "downloads.host-b.run-1"} {
+		j := testJob(id, 0)
+		modified := time.Now()
+		if id == "expired" {
+			modified = modified.Add(-2 * amboy.LockTimeout)
+		}
+		j.SetStatus(amboy.JobStatusInfo{InProgress: true, Owner: owner, ModificationTime: modified})
+		require.NoError(t, d.Put(ctx, j))
+	}
+
+	// only the job whose lock expired dispatches
+	next := d.Next(ctx)
+	require.NotNil(t, next)
+	assert.Equal("expired", next.ID())
+	assert.Nil(d.Next(ctx))
+
+	for _, id := range []string{"mine", "expired"} {
+		j, err := d.Get(ctx, id)
+		require.NoError(t, err)
+		assert.NoError(d.Save(ctx, j), id)
+	}
+
+	j, err := d.Get(ctx, "crashed")
+	require.NoError(t, err)
+	err = d.Save(ctx, j)
+	require.Error(t, err)
+	assert.Contains(err.Error(), "locked by")
+
+	// reclaiming takes over the locks of matching owners only
+	assert.Error(d.Reclaim(ctx, j, "downloads.host-b."))
+	j.SetStatus(amboy.JobStatusInfo{})
+	assert.NoError(d.Reclaim(ctx, j, "downloads.host-a."))
+	assert.Error(d.Reclaim(ctx, j, "downloads.host-a."))
+	assert.Equal("crashed", d.Next(ctx).ID())
+	assert.Error(d.Reclaim(ctx, testJob("missing", 0), ""))
+}
+
+func TestDriverSavesFencedJobs(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	d := New("test")
+	j := testJob("job", 0)
+	require.NoError(t, d.Put(ctx, j))
+	require.NoError(t, j.Lock("worker"))
+	require.NoError(t, d.Save(ctx, j))
+
+	// the job changes in place, but is fenced by its last write
+	require.NoError(t, j.Lock("worker"))
+	assert.Error(d.SaveFenced(ctx, j, "worker", 2))
+	assert.Error(d.SaveFenced(ctx, j, "other", 1))
+	assert.NoError(d.SaveFenced(ctx, j, "worker", 1))
+	assert.NoError(d.SaveFenced(ctx, j, "worker", 2))
+	assert.Len(d.CallsFor(OpSave), 5)
+
+	j.SetStatus(amboy.JobStatusInfo{Completed: true, Owner: "worker", ModificationCount: 2})
+	assert.NoError(d.SaveFenced(ctx, j, "worker", 2))
+	assert.Error(d.SaveFenced(ctx, j, "worker", 2))
+	assert.Error(d.SaveFenced(ctx, testJob("missing", 0), "", 0))
+}
+
+func TestDriverLocks(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	boom := errors.New("boom")
+
+	d := New("test")
+	require.NoError(t, d.AcquireLock(ctx, "cache", "a", time.Minute))
+	assert.Error(d.AcquireLock(ctx, "cache", "b", time.Minute))
+	assert.NoError(d.RenewLock(ctx, "cache", "a", time.Minute))
+	require.Len(t, d.Locks(), 1)
+	assert.Equal("a", d.Locks()[0].Owner)
+
+	d.FailJob(OpLock, "cache", boom)
+	assert.Equal(boom, d.RenewLock(ctx, "cache", "a", time.Minute))
+	assert.NoError(d.AcquireLock(ctx, "mirror", "a", time.Minute))
+	d.Reset()
+
+	require.NoError(t, d.ReleaseLock(ctx, "cache", "a"))
+	require.NoError(t, d.ReleaseLock(ctx, "mirror", "a"))
+	assert.Len(d.Locks(), 0)
+
+	calls := d.CallsFor(OpLock)
+	require.Len(t, calls, 7)
+	assert.Equal("cache", calls[0].JobID)
+	assert.Equal(boom, calls[3].Err)
+
+	d.Close()
+	assert.Error(d.AcquireLock(ctx, "cache", "a", time.Minute))
+}
+
+func TestDriverWithRemoteQueue(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	d := New("test")
+	completed := make(chan string, 8)
+	d.OnCall(func(c Call) {
+		if c.Op != OpSave || c.Err != nil {
+			return
+		}
+		if j, err := d.Get(ctx, c.JobID); err == nil && j.Status().Completed {
+			completed <- c.JobID
+		}
+	})
+
+	q := queue.NewRemoteUnordered(1)
+	require.NoError(t, q.SetDriver(d))
+	d.Hold()
+	require.NoError(t, q.Start(ctx))
+
+	for _, id := range []string{"first", "second", "third"} {
+		require.NoError(t, q.Put(ctx, testJob(id, 0)))
+	}
+	d.Release("third", "first", "second")
+
+	order := []string{}
+	for len(order) < 3 {
+		select {
+		case id := <-completed:
+			order = append(order, id)
+		case <-ctx.Done():
+			t.Fatal("jobs did not complete")
+		}
+	}
+	assert.Equal([]string{"third", "first", "second"}, order)
+	assert.Equal([]string{"third", "first", "second"}, d.Dispatched())
+}
@@ -0,0 +1,127 @@
+package driver
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/clock"
+)
+
+// ElectionOptions configure an Election.
+type ElectionOptions struct {
+	// Key names the election, so that candidates that share a
+	// Locker can run several elections.
+	Key string
+	// Candidate identifies this candidate, and must be unique
+	// among the election's candidates.
+	Candidate string
+	// TTL is how long a leader that stops renewing its term (e.g.
+	// because its process died) remains the leader, which bounds
+	// the time of a failover, and defaults to 30 seconds.
+	TTL time.Duration
+	// Clock, if specified, times the campaigns and terms.
+	Clock clock.Clock
+}
+
+// Validate returns an error if the options are invalid, and sets
+// defaults for unspecified values.
+func (o *ElectionOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(o.Key == "", "must specify an election key")
+	catcher.NewWhen(o.Candidate == "", "must specify a candidate")
+	catcher.NewWhen(o.TTL < 0, "term ttl must not be negative")
+	if catcher.HasErrors() {
+		return catcher.Resolve()
+	}
+
+	if o.TTL == 0 {
+		o.TTL = 30 * time.Second
+	}
+	o.Clock = clock.Or(o.Clock)
+
+	return nil
+}
+
+// Election elects one leader among candidates that share a Locker,
+// such as daemons that share a queue's driver (see StoredLocker), so
+// that several processes can run for availability while only one of
+// them does singleton work, such as scheduling recurring jobs. The
+// leader holds the election's keyed lock, and the others wait for it;
+// when the leader stops renewing the lock, another candidate takes it
+// once its TTL passes.
+type Election struct {
+	lock    *KeyedLock
+	opts    ElectionOptions
+	leading int32
+}
+
+// NewElection constructs an election on the Locker.
+func NewElection(l Locker, opts ElectionOptions) (*Election, error) {
+	if l == nil {
+		return nil, errors.New("must specify a locker")
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid election options")
+	}
+
+	lock, err := NewLockerLock(l, KeyedLockOptions{
+		Key:   opts.Key,
+		Owner: opts.Candidate,
+		TTL:   opts.TTL,
+		Clock: opts.Clock,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Election{lock: lock, opts: opts}, nil
+}
+
+// Candidate returns the candidate of the election.
+func (e *Election) Candidate() string { return e.opts.Candidate }
+
+// IsLeader reports whether the candidate is the leader.
+func (e *Election) IsLeader() bool { return atomic.LoadInt32(&e.leading) == 1 }
+
+// Run campaigns until the context is done. Whenever the candidate is
+// elected, Run calls lead with a context that is canceled when the
+// candidate is no longer the leader, and the candidate's term lasts
+// until lead returns. Candidates campaign again after their terms end,
+// or after the Locker fails, after a tenth of the TTL, so that other
+// candidates may be elected in the meantime.
+func (e *Election) Run(ctx context.Context, lead func(context.Context) error) error {
+	for {
+		err := e.lock.Hold(ctx, func(lctx context.Context) error {
+			atomic.StoreInt32(&e.leading, 1)
+			defer atomic.StoreInt32(&e.leading, 0)
+
+			grip.Info(message.Fields{
+				"message":   "elected leader",
+				"election":  e.opts.Key,
+				"candidate": e.opts.Candidate,
+			})
+			return lead(lctx)
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		grip.Info(message.WrapError(err, message.Fields{
+			"message":   "candidate is not the leader",
+			"election":  e.opts.Key,
+			"candidate": e.opts.Candidate,
+		}))
+
+		timer := e.opts.Clock.NewTimer(e.opts.TTL / 10)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C():
+		}
+	}
+}
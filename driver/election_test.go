@@ -0,0 +1,136 @@
+package driver
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// partitionedLocker fails every operation once it's partitioned, as
+// the Locker of a process that has died or lost its connection does.
+type partitionedLocker struct {
+	Locker
+	partitioned int32
+}
+
+func (l *partitionedLocker) err() error {
+	if atomic.LoadInt32(&l.partitioned) == 1 {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (l *partitionedLocker) AcquireLock(ctx context.Context, key, owner string, ttl time.Duration) error {
+	if err := l.err(); err != nil {
+		return err
+	}
+	return l.Locker.AcquireLock(ctx, key, owner, ttl)
+}
+
+func (l *partitionedLocker) RenewLock(ctx context.Context, key, owner string, ttl time.Duration) error {
+	if err := l.err(); err != nil {
+		return err
+	}
+	return l.Locker.RenewLock(ctx, key, owner, ttl)
+}
+
+func (l *partitionedLocker) ReleaseLock(ctx context.Context, key, owner string) error {
+	if err := l.err(); err != nil {
+		return err
+	}
+	return l.Locker.ReleaseLock(ctx, key, owner)
+}
+
+func TestElectionOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	opts := ElectionOptions{Key: "daemon", Candidate: "a"}
+	require.NoError(t, opts.Validate())
+	assert.Equal(30*time.Second, opts.TTL)
+	assert.NotNil(opts.Clock)
+
+	assert.Error((&ElectionOptions{Key: "daemon"}).Validate())
+	assert.Error((&ElectionOptions{Candidate: "a"}).Validate())
+	assert.Error((&ElectionOptions{Key: "daemon", Candidate: "a", TTL: -1}).Validate())
+
+	_, err := NewElection(nil, ElectionOptions{Key: "daemon", Candidate: "a"})
+	assert.Error(err)
+	_, err = NewElection(NewLockTable(nil), ElectionOptions{Key: "daemon"})
+	assert.Error(err)
+}
+
+func TestElectionFailsOver(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	d, err := NewAging(AgingOptions{})
+	require.NoError(t, err)
+	stored, err := NewStoredLocker(d, nil)
+	require.NoError(t, err)
+
+	leaders := make(chan string, 4)
+	deposed := make(chan string, 4)
+	lead := func(name string) func(context.Context) error {
+		return func(ctx context.Context) error {
+			leaders <- name
+			<-ctx.Done()
+			deposed <- name
+			return nil
+		}
+	}
+
+	first := &partitionedLocker{Locker: stored}
+	a, err := NewElection(first, ElectionOptions{Key: "daemon", Candidate: "a", TTL: 150 * time.Millisecond})
+	require.NoError(t, err)
+	assert.Equal("a", a.Candidate())
+	actx, acancel := context.WithCancel(ctx)
+	defer acancel()
+	go func() { assert.NoError(a.Run(actx, lead("a"))) }()
+	assert.Equal("a", <-leaders)
+	assert.True(a.IsLeader())
+
+	b, err := NewElection(stored, ElectionOptions{Key: "daemon", Candidate: "b", TTL: 150 * time.Millisecond})
+	require.NoError(t, err)
+	bctx, bcancel := context.WithCancel(ctx)
+	bdone := make(chan struct{})
+	go func() {
+		defer close(bdone)
+		assert.NoError(b.Run(bctx, lead("b")))
+	}()
+
+	// the standby waits while the leader renews its term
+	select {
+	case name := <-leaders:
+		t.Fatalf("%s was elected while the leader was alive", name)
+	case <-time.After(300 * time.Millisecond):
+	}
+	assert.False(b.IsLeader())
+
+	// once the leader can no longer renew, it steps down, and the
+	// standby takes over once the term expires
+	atomic.StoreInt32(&first.partitioned, 1)
+	assert.Equal("a", <-deposed)
+	assert.Equal("b", <-leaders)
+	assert.False(a.IsLeader())
+	assert.True(b.IsLeader())
+
+	// leaders that stop resign, so that the others take over
+	// without waiting for the term to expire
+	atomic.StoreInt32(&first.partitioned, 0)
+	bcancel()
+	<-bdone
+	assert.Equal("b", <-deposed)
+	assert.False(b.IsLeader())
+	select {
+	case name := <-leaders:
+		assert.Equal("a", name)
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("standby was not elected after the leader resigned")
+	}
+}
@@ -0,0 +1,22 @@
+package driver
+
+import "github.com/pkg/errors"
+
+// Errors returned, wrapped with context, by the drivers in this
+// package (and in drivertest), so that callers can distinguish
+// failures without matching error strings. Use errors.Cause or
+// bond.Is to check for them. amboy's own drivers return untyped
+// errors.
+var (
+	// ErrJobNotFound is returned when the driver has no job with
+	// the requested ID.
+	ErrJobNotFound = errors.New("job not found")
+
+	// ErrDuplicateJob is returned when adding a job whose ID is
+	// already in use.
+	ErrDuplicateJob = errors.New("duplicate job")
+
+	// ErrDriverClosed is returned for operations on a driver that
+	// has been closed.
+	ErrDriverClosed = errors.New("driver is closed")
+)
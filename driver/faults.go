@@ -0,0 +1,224 @@
+package driver
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/amboy/registry"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/clock"
+)
+
+// duplicateWindow is the number of recently dispatched jobs that a
+// Faulty driver may dispatch again.
+const duplicateWindow = 16
+
+// FaultOptions configures the faults that a Faulty driver injects.
+// Each rate is the probability, from 0 to 1, that an operation has
+// the fault; faults with a rate of 0 are disabled.
+type FaultOptions struct {
+	// DropSaves is the rate of saves that return without writing
+	// the job, as when a write acknowledged by a primary is rolled
+	// back after a failover.
+	DropSaves float64
+	// DelayNext is the rate of calls to Next that wait, for a
+	// random time up to MaxNextDelay, before returning a job, as
+	// when the database is slow or a node is unreachable.
+	DelayNext float64
+	// MaxNextDelay defaults to one second.
+	MaxNextDelay time.Duration
+	// DuplicateDispatch is the rate of calls to Next that return a
+	// copy of a recently dispatched job, as when a job's lock
+	// expires while a worker still runs it. Only jobs of
+	// registered types can be copied.
+	DuplicateDispatch float64
+	// Seed seeds the source of the faults, so that tests can
+	// reproduce them. A zero seed uses the current time.
+	Seed int64
+	// Clock defaults to the system clock.
+	Clock clock.Clock
+}
+
+// Validate returns an error if the options are invalid, and sets
+// defaults for unspecified values.
+func (o *FaultOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.ErrorfWhen(invalidRate(o.DropSaves), "drop saves rate %f must be between 0 and 1", o.DropSaves)
+	catcher.ErrorfWhen(invalidRate(o.DelayNext), "delay next rate %f must be between 0 and 1", o.DelayNext)
+	catcher.ErrorfWhen(invalidRate(o.DuplicateDispatch), "duplicate dispatch rate %f must be between 0 and 1", o.DuplicateDispatch)
+	catcher.NewWhen(o.MaxNextDelay < 0, "maximum next delay must be 0 or positive")
+	if catcher.HasErrors() {
+		return catcher.Resolve()
+	}
+
+	if o.MaxNextDelay == 0 {
+		o.MaxNextDelay = time.Second
+	}
+	if o.Seed == 0 {
+		o.Seed = time.Now().UnixNano()
+	}
+	o.Clock = clock.Or(o.Clock)
+
+	return nil
+}
+
+func invalidRate(rate float64) bool { return rate < 0 || rate > 1 }
+
+// FaultCounts reports the faults that a Faulty driver has injected.
+type FaultCounts struct {
+	DroppedSaves        int `bson:"dropped_saves" json:"dropped_saves" yaml:"dropped_saves"`
+	DelayedNexts        int `bson:"delayed_nexts" json:"delayed_nexts" yaml:"delayed_nexts"`
+	DuplicateDispatches int `bson:"duplicate_dispatches" json:"duplicate_dispatches" yaml:"duplicate_dispatches"`
+}
+
+// Faulty wraps a driver and injects faults into its operations, so
+// that tests of queue consumers can exercise the failures of
+// production deployments: saves that are lost, jobs that are slow to
+// dispatch, and jobs that are dispatched to more than one worker.
+// Operations without a fault pass through to the wrapped driver.
+type Faulty struct {
+	wrapped
+	opts FaultOptions
+
+	mu     sync.Mutex
+	rand   *rand.Rand
+	recent []*registry.JobInterchange
+	counts FaultCounts
+}
+
+// NewFaulty wraps the driver.
+func NewFaulty(d queue.Driver, opts FaultOptions) (*Faulty, error) {
+	if d == nil {
+		return nil, errors.New("cannot inject faults into a nil driver")
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid fault options")
+	}
+
+	return &Faulty{
+		wrapped: wrap(d),
+		opts:    opts,
+		rand:    rand.New(rand.NewSource(opts.Seed)),
+	}, nil
+}
+
+// Faults returns the counts of the faults that the driver has
+// injected.
+func (d *Faulty) Faults() FaultCounts {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.counts
+}
+
+// fault reports whether an operation with the rate has a fault, and
+// counts the faults.
+func (d *Faulty) fault(rate float64, count *int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if rate == 0 || d.rand.Float64() >= rate {
+		return false
+	}
+
+	*count++
+	return true
+}
+
+// Save updates the job in the wrapped driver, unless the save is
+// dropped.
+func (d *Faulty) Save(ctx context.Context, j amboy.Job) error {
+	if d.fault(d.opts.DropSaves, &d.counts.DroppedSaves) {
+		return nil
+	}
+
+	return d.inner().Save(ctx, j)
+}
+
+// SaveFenced updates the job in the wrapped driver, which must
+// implement FencedSaver, if it has the lock generation, unless the
+// save is dropped.
+func (d *Faulty) SaveFenced(ctx context.Context, j amboy.Job, owner string, modCount int) error {
+	fs, err := asFencedSaver(d.inner())
+	if err != nil {
+		return err
+	}
+
+	if d.fault(d.opts.DropSaves, &d.counts.DroppedSaves) {
+		return nil
+	}
+
+	return fs.SaveFenced(ctx, j, owner, modCount)
+}
+
+// Next returns the next job from the wrapped driver, after a delay if
+// the call is delayed, or a copy of a recently dispatched job if the
+// call dispatches a duplicate.
+func (d *Faulty) Next(ctx context.Context) amboy.Job {
+	if d.fault(d.opts.DelayNext, &d.counts.DelayedNexts) {
+		d.mu.Lock()
+		delay := time.Duration(d.rand.Int63n(int64(d.opts.MaxNextDelay)) + 1)
+		d.mu.Unlock()
+
+		timer := d.opts.Clock.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C():
+		}
+	}
+
+	if j := d.duplicate(); j != nil {
+		return j
+	}
+
+	j := d.inner().Next(ctx)
+	if j != nil && d.opts.DuplicateDispatch > 0 {
+		d.dispatched(j)
+	}
+
+	return j
+}
+
+// dispatched records a copy of the job, as it was dispatched, so that
+// later calls to Next can dispatch it again.
+func (d *Faulty) dispatched(j amboy.Job) {
+	ji, err := registry.MakeJobInterchange(j, amboy.JSON)
+	if err != nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.recent = append(d.recent, ji)
+	if len(d.recent) > duplicateWindow {
+		d.recent = d.recent[1:]
+	}
+}
+
+// duplicate returns a copy of a recently dispatched job, if the call
+// dispatches a duplicate.
+func (d *Faulty) duplicate() amboy.Job {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.recent) == 0 || d.opts.DuplicateDispatch == 0 || d.rand.Float64() >= d.opts.DuplicateDispatch {
+		return nil
+	}
+
+	j, err := d.recent[d.rand.Intn(len(d.recent))].Resolve(amboy.JSON)
+	if err != nil {
+		return nil
+	}
+
+	d.counts.DuplicateDispatches++
+	return j
+}
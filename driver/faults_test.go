@@ -0,0 +1,116 @@
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/clock"
+)
+
+func TestFaultOptionsValidate(t *testing.T) {
+	opts := FaultOptions{}
+	require.NoError(t, opts.Validate())
+	assert.Equal(t, time.Second, opts.MaxNextDelay)
+	assert.NotZero(t, opts.Seed)
+	assert.NotNil(t, opts.Clock)
+
+	assert.Error(t, (&FaultOptions{DropSaves: -0.1}).Validate())
+	assert.Error(t, (&FaultOptions{DelayNext: 1.5}).Validate())
+	assert.Error(t, (&FaultOptions{DuplicateDispatch: 2}).Validate())
+	assert.Error(t, (&FaultOptions{MaxNextDelay: -1}).Validate())
+
+	_, err := NewFaulty(nil, FaultOptions{})
+	assert.Error(t, err)
+}
+
+func TestFaultyDriverDropsSaves(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	d, err := NewFaulty(queue.NewInternalDriver(), FaultOptions{DropSaves: 1})
+	require.NoError(t, err)
+	require.NoError(t, d.Open(ctx))
+	defer d.Close()
+
+	j := job.NewShellJob("true", "")
+	require.NoError(t, d.Put(ctx, j))
+
+	update := copyJob(t, j)
+	update.SetStatus(amboy.JobStatusInfo{Completed: true})
+	assert.NoError(d.Save(ctx, update))
+
+	stored, err := d.Get(ctx, j.ID())
+	require.NoError(t, err)
+	assert.False(stored.Status().Completed)
+	assert.Equal(FaultCounts{DroppedSaves: 1}, d.Faults())
+}
+
+func TestFaultyDriverDispatchesDuplicates(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	d, err := NewFaulty(queue.NewInternalDriver(), FaultOptions{DuplicateDispatch: 1})
+	require.NoError(t, err)
+	require.NoError(t, d.Open(ctx))
+	defer d.Close()
+
+	j := job.NewShellJob("true", "")
+	require.NoError(t, d.Put(ctx, j))
+
+	first := d.Next(ctx)
+	require.NotNil(t, first)
+	assert.Equal(j.ID(), first.ID())
+
+	// duplicates are copies, so workers don't share a job
+	dup := d.Next(ctx)
+	require.NotNil(t, dup)
+	assert.Equal(j.ID(), dup.ID())
+	assert.False(first == dup)
+	assert.Equal(FaultCounts{DuplicateDispatches: 1}, d.Faults())
+}
+
+func TestFaultyDriverDelaysNext(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c := clock.NewFake(time.Now())
+	d, err := NewFaulty(queue.NewInternalDriver(), FaultOptions{DelayNext: 1, MaxNextDelay: time.Minute, Clock: c})
+	require.NoError(t, err)
+	require.NoError(t, d.Open(ctx))
+	defer d.Close()
+
+	j := job.NewShellJob("true", "")
+	require.NoError(t, d.Put(ctx, j))
+
+	out := make(chan amboy.Job, 1)
+	go func() { out <- d.Next(ctx) }()
+
+	for c.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-out:
+		assert.Fail("next returned before its delay")
+	default:
+	}
+
+	c.Advance(time.Minute)
+	next := <-out
+	require.NotNil(t, next)
+	assert.Equal(j.ID(), next.ID())
+	assert.Equal(FaultCounts{DelayedNexts: 1}, d.Faults())
+
+	// delayed calls end with their contexts
+	cctx, ccancel := context.WithCancel(ctx)
+	ccancel()
+	assert.Nil(d.Next(cctx))
+}
@@ -0,0 +1,93 @@
+package driver
+
+import (
+	"context"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+)
+
+// ErrFenced is returned by a Fenced driver when a worker saves a job
+// that it no longer owns.
+var ErrFenced = errors.New("job lock is held by another owner")
+
+// FencedSaver is implemented by drivers that can write a job only if
+// the stored job has a lock generation, checking the stored job and
+// writing the job in one atomic operation (e.g. a conditional update
+// on the job's owner and modification count).
+//
+// SaveFenced must return an error wrapping ErrFenced, without writing
+// the job, if the stored job is complete, or its owner or
+// modification count differ from the ones given.
+type FencedSaver interface {
+	SaveFenced(ctx context.Context, j amboy.Job, owner string, modCount int) error
+}
+
+// asFencedSaver returns the driver as a FencedSaver, for wrappers
+// that pass fenced saves through.
+func asFencedSaver(d queue.Driver) (FencedSaver, error) {
+	fs, ok := d.(FencedSaver)
+	if !ok {
+		return nil, errors.Errorf("driver %T does not support fenced saves", d)
+	}
+
+	return fs, nil
+}
+
+// CheckGeneration returns an error wrapping ErrFenced if the stored
+// status of a job is complete, or does not have the lock generation.
+// FencedSaver implementations can use it to check stored jobs.
+func CheckGeneration(id string, stored amboy.JobStatusInfo, owner string, modCount int) error {
+	switch {
+	case stored.Completed:
+		return errors.Wrapf(ErrFenced, "job '%s' is already complete", id)
+	case stored.Owner != owner:
+		return errors.Wrapf(ErrFenced, "job '%s' is locked by '%s', not '%s'", id, stored.Owner, owner)
+	case stored.ModificationCount != modCount:
+		return errors.Wrapf(ErrFenced, "job '%s' has lock generation %d, not %d", id, stored.ModificationCount, modCount)
+	}
+
+	return nil
+}
+
+// Fenced wraps a driver and fences the completion of jobs, so that a
+// worker whose lock was reclaimed (e.g. because the job ran for
+// longer than amboy.LockTimeout without updating its lock) cannot
+// overwrite the status or results written by the job's new owner.
+//
+// The fencing token is the job's lock generation: the owner and
+// modification count that amboy's Lock method updates whenever a
+// worker takes or refreshes a job's lock. Saving a complete job
+// writes it only if the stored job is not complete, and still has
+// the job's lock generation, so jobs are completed exactly once, by
+// the worker that holds their lock. The wrapped driver checks the
+// generation as part of the write, and must implement FencedSaver.
+//
+// Saves of jobs that are not complete, including lock updates and
+// requeues, are not fenced. Remote queues retry failed saves when
+// completing jobs, and log an error once they stop retrying.
+type Fenced struct {
+	wrapped
+}
+
+// NewFenced wraps the driver, returning an error if the driver does
+// not implement FencedSaver.
+func NewFenced(d queue.Driver) (*Fenced, error) {
+	if _, err := asFencedSaver(d); err != nil {
+		return nil, err
+	}
+
+	return &Fenced{wrap(d)}, nil
+}
+
+// Save writes the job to the wrapped driver. Complete jobs are only
+// written if the stored job has the lock generation of the job.
+func (d *Fenced) Save(ctx context.Context, j amboy.Job) error {
+	stat := j.Status()
+	if !stat.Completed {
+		return d.inner().Save(ctx, j)
+	}
+
+	return d.SaveFenced(ctx, j, stat.Owner, stat.ModificationCount)
+}
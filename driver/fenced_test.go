@@ -0,0 +1,135 @@
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/amboy/registry"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/management"
+)
+
+func init() { job.RegisterDefaultJobs() }
+
+func copyJob(t *testing.T, j amboy.Job) amboy.Job {
+	ji, err := registry.MakeJobInterchange(j, amboy.JSON)
+	require.NoError(t, err)
+	out, err := ji.Resolve(amboy.JSON)
+	require.NoError(t, err)
+	return out
+}
+
+func TestFencedDriver(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := NewFenced(queue.NewInternalDriver())
+	assert.Error(err)
+
+	base, err := NewAging(AgingOptions{})
+	require.NoError(t, err)
+	d, err := NewFenced(base)
+	require.NoError(t, err)
+
+	j := job.NewShellJob("true", "")
+	require.NoError(t, d.Put(ctx, copyJob(t, j)))
+
+	// the first worker takes the lock
+	first := copyJob(t, j)
+	require.NoError(t, first.Lock("worker"))
+	require.NoError(t, d.Save(ctx, copyJob(t, first)))
+	require.NoError(t, d.Save(ctx, copyJob(t, first)))
+
+	// a second worker (in the same process) reclaims the lock
+	second := copyJob(t, first)
+	require.NoError(t, second.Lock("worker"))
+	require.NoError(t, d.Save(ctx, copyJob(t, second)))
+
+	// the first worker can no longer complete the job
+	complete := func(j amboy.Job) amboy.Job {
+		out := copyJob(t, j)
+		stat := out.Status()
+		stat.Completed = true
+		stat.InProgress = false
+		out.SetStatus(stat)
+		return out
+	}
+	err = d.Save(ctx, complete(first))
+	require.Error(t, err)
+	assert.Equal(ErrFenced, errors.Cause(err))
+
+	// a worker in another process can't either
+	other := copyJob(t, second)
+	stat := other.Status()
+	stat.Owner = "other"
+	other.SetStatus(stat)
+	assert.Equal(ErrFenced, errors.Cause(d.Save(ctx, complete(other))))
+
+	// once the new owner completes the job, it's complete exactly once
+	require.NoError(t, d.Save(ctx, complete(second)))
+	assert.Equal(ErrFenced, errors.Cause(d.Save(ctx, complete(second))))
+	stored, err := d.Get(ctx, j.ID())
+	require.NoError(t, err)
+	assert.True(stored.Status().Completed)
+	assert.Equal(second.Status().ModificationCount, stored.Status().ModificationCount)
+}
+
+func TestFencedDriverManagement(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	base, err := NewAging(AgingOptions{})
+	require.NoError(t, err)
+	d, err := NewFenced(base)
+	require.NoError(t, err)
+	m := management.New(d)
+
+	for _, id := range []string{"a", "b", "c"} {
+		j := job.NewShellJob("true", "")
+		j.SetID(id)
+		require.NoError(t, d.Put(ctx, copyJob(t, j)))
+	}
+
+	// operators complete and requeue jobs from fresh copies,
+	// which have the stored lock generation
+	require.NoError(t, m.ForceComplete(ctx, "a", ""))
+	require.NoError(t, m.RequeueByID(ctx, "a"))
+	require.NoError(t, m.ForceComplete(ctx, "a", ""))
+	require.NoError(t, m.Abort(ctx, "b", "maintenance"))
+
+	ids, err := m.UpdateStatuses(ctx, management.Filter{}, management.TransitionPending, "")
+	require.NoError(t, err)
+	assert.Len(ids, 3)
+	ids, err = m.UpdateStatuses(ctx, management.Filter{}, management.TransitionAborted, "")
+	require.NoError(t, err)
+	assert.Len(ids, 3)
+	assert.Equal(3, d.Stats(ctx).Completed)
+}
+
+func TestFencedQueueCompletesJobs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	base, err := NewAging(AgingOptions{})
+	require.NoError(t, err)
+	d, err := NewFenced(base)
+	require.NoError(t, err)
+
+	q := queue.NewRemoteUnordered(2)
+	require.NoError(t, q.SetDriver(d))
+	require.NoError(t, q.Start(ctx))
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, q.Put(ctx, job.NewShellJob("true", "")))
+	}
+	require.True(t, amboy.WaitInterval(ctx, q, 10*time.Millisecond))
+	assert.Equal(t, 5, d.Stats(ctx).Completed)
+}
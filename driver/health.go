@@ -0,0 +1,417 @@
+package driver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/mongodb/grip/recovery"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/clock"
+	"github.com/tychoish/bond/management"
+)
+
+// ErrUnreachable is returned by a Monitored driver's Put and Save
+// methods when the most recent check of the wrapped driver failed.
+var ErrUnreachable = errors.New("driver unreachable")
+
+// HealthState describes the state of a Monitored driver.
+type HealthState string
+
+// The states of a Monitored driver.
+const (
+	Healthy  HealthState = "healthy"
+	Degraded HealthState = "degraded: driver unreachable"
+)
+
+// Check reports whether a driver can reach its storage.
+type Check func(context.Context, queue.Driver) error
+
+// Connect constructs and opens a replacement for a driver that has
+// become unreachable.
+type Connect func(context.Context) (queue.Driver, error)
+
+// StatsCheck is the default Check, and fails if the driver does not
+// return its stats before the context is done. Use a check that
+// exercises the database directly (e.g. a ping) when one is
+// available, as drivers may not report errors from Stats.
+//
+// Stats runs with a context that StatsCheck cancels when it returns,
+// so that drivers which respect their contexts stop promptly after a
+// check times out, rather than accumulating with each check.
+func StatsCheck(ctx context.Context, d queue.Driver) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Stats(ctx)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return errors.Wrapf(ctx.Err(), "driver '%s' did not report stats", d.ID())
+	case <-done:
+		return nil
+	}
+}
+
+// HealthOptions configures a Monitored driver.
+type HealthOptions struct {
+	// Check is run every Interval, and defaults to StatsCheck.
+	Check Check
+	// Connect, if specified, replaces the driver when a check
+	// fails. Drivers that cannot be reopened after Close (e.g.
+	// amboy's MongoDB drivers) must be replaced to recover from
+	// a lost connection.
+	Connect Connect
+	// Interval defaults to 10 seconds.
+	Interval time.Duration
+	// Timeout limits each check and connection attempt, and
+	// defaults to 5 seconds.
+	Timeout time.Duration
+	// Clock defaults to the system clock.
+	Clock clock.Clock
+}
+
+// Validate returns an error if the options are invalid, and sets
+// defaults for unspecified values.
+func (o *HealthOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(o.Interval < 0, "interval must be 0 or positive")
+	catcher.NewWhen(o.Timeout < 0, "timeout must be 0 or positive")
+	if catcher.HasErrors() {
+		return catcher.Resolve()
+	}
+
+	if o.Check == nil {
+		o.Check = StatsCheck
+	}
+	if o.Interval == 0 {
+		o.Interval = 10 * time.Second
+	}
+	if o.Timeout == 0 {
+		o.Timeout = 5 * time.Second
+	}
+	o.Clock = clock.Or(o.Clock)
+
+	return nil
+}
+
+// HealthStatus reports the state of a Monitored driver.
+type HealthStatus struct {
+	State      HealthState `bson:"state" json:"state" yaml:"state"`
+	Error      string      `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+	Since      time.Time   `bson:"since" json:"since" yaml:"since"`
+	LastCheck  time.Time   `bson:"last_check" json:"last_check" yaml:"last_check"`
+	Reconnects int         `bson:"reconnects" json:"reconnects" yaml:"reconnects"`
+}
+
+// Monitored wraps a driver and checks it periodically once it's
+// opened. When a check fails, the driver is Degraded until a later
+// check succeeds: Put and Save return ErrUnreachable and Next waits
+// for the driver to recover, rather than letting the queue's workers
+// spin on a driver that cannot return jobs. If the options include
+// Connect, the Monitored driver replaces the wrapped driver with a
+// newly connected one after each failed check.
+type Monitored struct {
+	wrapped
+	opts HealthOptions
+
+	mu        sync.RWMutex
+	driver    queue.Driver
+	status    HealthStatus
+	recovered chan struct{}
+	cancel    context.CancelFunc
+}
+
+// NewMonitored wraps the driver.
+func NewMonitored(d queue.Driver, opts HealthOptions) (*Monitored, error) {
+	if d == nil {
+		return nil, errors.New("cannot monitor a nil driver")
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid health options")
+	}
+
+	m := &Monitored{
+		opts:   opts,
+		driver: d,
+		status: HealthStatus{State: Healthy, Since: opts.Clock.Now()},
+	}
+	m.wrapped = wrapped{inner: m.Driver}
+
+	return m, nil
+}
+
+// Driver returns the current wrapped driver.
+func (d *Monitored) Driver() queue.Driver {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.driver
+}
+
+// Health returns the current state of the driver.
+func (d *Monitored) Health() HealthStatus {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.status
+}
+
+// Open opens the wrapped driver and starts checking it until the
+// context is canceled or the driver is closed.
+func (d *Monitored) Open(ctx context.Context) error {
+	if err := d.Driver().Open(ctx); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel != nil {
+		return nil
+	}
+
+	ctx, d.cancel = context.WithCancel(ctx)
+	go d.monitor(ctx)
+
+	return nil
+}
+
+// Close stops checking the driver and closes the wrapped driver.
+// Reopening the driver restarts the checks.
+func (d *Monitored) Close() {
+	d.mu.Lock()
+	if d.cancel != nil {
+		d.cancel()
+		d.cancel = nil
+	}
+	drv := d.driver
+	d.mu.Unlock()
+
+	drv.Close()
+}
+
+func (d *Monitored) monitor(ctx context.Context) {
+	defer recovery.LogStackTraceAndContinue("driver health monitor")
+
+	timer := d.opts.Clock.NewTimer(d.opts.Interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C():
+			d.CheckNow(ctx)
+			timer.Reset(d.opts.Interval)
+		}
+	}
+}
+
+// CheckNow checks the wrapped driver, replacing it if the check fails
+// and the options include Connect, and returns the resulting state.
+func (d *Monitored) CheckNow(ctx context.Context) HealthStatus {
+	err := d.check(ctx, d.Driver())
+	if err != nil && d.opts.Connect != nil {
+		if rerr := d.reconnect(ctx); rerr != nil {
+			err = errors.Wrapf(err, "problem reconnecting: %s", rerr.Error())
+		} else {
+			err = nil
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.opts.Clock.Now()
+	d.status.LastCheck = now
+
+	if err != nil {
+		if d.status.State != Degraded {
+			grip.Warning(message.WrapError(err, message.Fields{
+				"message": "queue driver is unreachable",
+				"driver":  d.driver.ID(),
+			}))
+			d.status.State = Degraded
+			d.status.Since = now
+			d.recovered = make(chan struct{})
+		}
+		d.status.Error = err.Error()
+
+		return d.status
+	}
+
+	if d.status.State == Degraded {
+		grip.Info(message.Fields{
+			"message":  "queue driver recovered",
+			"driver":   d.driver.ID(),
+			"degraded": now.Sub(d.status.Since).String(),
+		})
+		d.status.State = Healthy
+		d.status.Since = now
+		d.status.Error = ""
+		close(d.recovered)
+		d.recovered = nil
+	}
+
+	return d.status
+}
+
+func (d *Monitored) check(ctx context.Context, drv queue.Driver) error {
+	ctx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+	defer cancel()
+
+	return d.opts.Check(ctx, drv)
+}
+
+func (d *Monitored) reconnect(ctx context.Context) error {
+	cctx, cancel := context.WithTimeout(ctx, d.opts.Timeout)
+	defer cancel()
+
+	drv, err := d.opts.Connect(cctx)
+	if err != nil {
+		return err
+	}
+	if drv == nil {
+		return errors.New("connect returned a nil driver")
+	}
+
+	if err = d.check(ctx, drv); err != nil {
+		drv.Close()
+		return errors.Wrap(err, "replacement driver is unreachable")
+	}
+
+	d.mu.Lock()
+	old := d.driver
+	d.driver = drv
+	d.status.Reconnects++
+	d.mu.Unlock()
+
+	old.Close()
+	return nil
+}
+
+// degraded returns a channel that is closed when the driver
+// recovers, or nil if the driver is healthy.
+func (d *Monitored) degraded() <-chan struct{} {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.status.State != Degraded {
+		return nil
+	}
+
+	return d.recovered
+}
+
+func (d *Monitored) unreachable(op string, j amboy.Job) error {
+	return errors.Wrapf(ErrUnreachable, "cannot %s job '%s'", op, j.ID())
+}
+
+func (d *Monitored) unreachableLock(op, key string) error {
+	return errors.Wrapf(ErrUnreachable, "cannot %s lock '%s'", op, key)
+}
+
+// Put adds the job to the wrapped driver, unless the driver is
+// degraded.
+func (d *Monitored) Put(ctx context.Context, j amboy.Job) error {
+	if d.degraded() != nil {
+		return d.unreachable("add", j)
+	}
+
+	return d.wrapped.Put(ctx, j)
+}
+
+// Save updates the job in the wrapped driver, unless the driver is
+// degraded.
+func (d *Monitored) Save(ctx context.Context, j amboy.Job) error {
+	if d.degraded() != nil {
+		return d.unreachable("save", j)
+	}
+
+	return d.wrapped.Save(ctx, j)
+}
+
+// UpdateStatuses applies the transition to the jobs in the wrapped
+// driver that match the filter, unless the driver is degraded.
+func (d *Monitored) UpdateStatuses(ctx context.Context, f management.Filter, t management.StatusTransition, note string) ([]string, error) {
+	if d.degraded() != nil {
+		return nil, errors.Wrap(ErrUnreachable, "cannot update jobs")
+	}
+
+	return d.wrapped.UpdateStatuses(ctx, f, t, note)
+}
+
+// SaveFenced updates the job in the wrapped driver, which must
+// implement FencedSaver, if it has the lock generation, unless the
+// driver is degraded.
+func (d *Monitored) SaveFenced(ctx context.Context, j amboy.Job, owner string, modCount int) error {
+	if d.degraded() != nil {
+		return d.unreachable("save", j)
+	}
+
+	return d.wrapped.SaveFenced(ctx, j, owner, modCount)
+}
+
+// AcquireLock takes the keyed lock in the wrapped driver, which must
+// implement Locker, unless the driver is degraded.
+func (d *Monitored) AcquireLock(ctx context.Context, key, owner string, ttl time.Duration) error {
+	if d.degraded() != nil {
+		return d.unreachableLock("acquire", key)
+	}
+
+	return d.wrapped.AcquireLock(ctx, key, owner, ttl)
+}
+
+// RenewLock extends the keyed lock in the wrapped driver, unless the
+// driver is degraded.
+func (d *Monitored) RenewLock(ctx context.Context, key, owner string, ttl time.Duration) error {
+	if d.degraded() != nil {
+		return d.unreachableLock("renew", key)
+	}
+
+	return d.wrapped.RenewLock(ctx, key, owner, ttl)
+}
+
+// ReleaseLock releases the keyed lock in the wrapped driver, unless
+// the driver is degraded.
+func (d *Monitored) ReleaseLock(ctx context.Context, key, owner string) error {
+	if d.degraded() != nil {
+		return d.unreachableLock("release", key)
+	}
+
+	return d.wrapped.ReleaseLock(ctx, key, owner)
+}
+
+// Reclaim writes a job that a previous run left locked to the wrapped
+// driver, unless the driver is degraded.
+func (d *Monitored) Reclaim(ctx context.Context, j amboy.Job, prefix string) error {
+	if d.degraded() != nil {
+		return d.unreachable("reclaim", j)
+	}
+
+	return d.wrapped.Reclaim(ctx, j, prefix)
+}
+
+// Next returns the next job from the wrapped driver. While the driver
+// is degraded, Next blocks until the driver recovers or the context
+// is canceled, and returns nil.
+func (d *Monitored) Next(ctx context.Context) amboy.Job {
+	if wait := d.degraded(); wait != nil {
+		select {
+		case <-ctx.Done():
+		case <-wait:
+		}
+		return nil
+	}
+
+	return d.wrapped.Next(ctx)
+}
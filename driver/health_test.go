@@ -0,0 +1,180 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	perrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type switchCheck struct{ failing int32 }
+
+func (c *switchCheck) set(failing bool) {
+	var v int32
+	if failing {
+		v = 1
+	}
+	atomic.StoreInt32(&c.failing, v)
+}
+
+func (c *switchCheck) check(ctx context.Context, d queue.Driver) error {
+	if atomic.LoadInt32(&c.failing) == 1 {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestHealthOptionsValidate(t *testing.T) {
+	opts := HealthOptions{}
+	require.NoError(t, opts.Validate())
+	assert.NotNil(t, opts.Check)
+	assert.Equal(t, 10*time.Second, opts.Interval)
+	assert.Equal(t, 5*time.Second, opts.Timeout)
+
+	assert.Error(t, (&HealthOptions{Interval: -1}).Validate())
+	assert.Error(t, (&HealthOptions{Timeout: -1}).Validate())
+
+	_, err := NewMonitored(nil, HealthOptions{})
+	assert.Error(t, err)
+}
+
+func TestMonitoredDriverDegradesAndRecovers(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c := &switchCheck{}
+	d, err := NewMonitored(queue.NewInternalDriver(), HealthOptions{Check: c.check, Interval: time.Hour})
+	require.NoError(t, err)
+	require.NoError(t, d.Open(ctx))
+	defer d.Close()
+
+	assert.Equal(Healthy, d.CheckNow(ctx).State)
+	require.NoError(t, d.Put(ctx, job.NewShellJob("true", "")))
+
+	c.set(true)
+	status := d.CheckNow(ctx)
+	assert.Equal(Degraded, status.State)
+	assert.Contains(status.Error, "connection refused")
+	assert.Equal(ErrUnreachable, perrors.Cause(d.Put(ctx, job.NewShellJob("true", ""))))
+
+	// Next blocks until the driver recovers
+	next := make(chan struct{})
+	go func() {
+		defer close(next)
+		assert.Nil(d.Next(ctx))
+	}()
+
+	select {
+	case <-next:
+		t.Fatal("next returned while the driver was degraded")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	c.set(false)
+	assert.Equal(Healthy, d.CheckNow(ctx).State)
+	<-next
+	assert.Empty(d.Health().Error)
+	assert.NotNil(d.Next(ctx))
+}
+
+func TestMonitoredDriverReconnects(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	first := queue.NewInternalDriver()
+	second := queue.NewInternalDriver()
+	d, err := NewMonitored(first, HealthOptions{
+		Interval: time.Millisecond,
+		Check: func(_ context.Context, drv queue.Driver) error {
+			if drv == first {
+				return errors.New("connection reset")
+			}
+			return nil
+		},
+		Connect: func(ctx context.Context) (queue.Driver, error) {
+			return second, second.Open(ctx)
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, d.Open(ctx))
+	defer d.Close()
+
+	for d.Health().Reconnects == 0 {
+		require.NoError(t, ctx.Err())
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.Equal(Healthy, d.Health().State)
+	assert.Equal(second.ID(), d.ID())
+
+	j := job.NewShellJob("true", "")
+	require.NoError(t, d.Put(ctx, j))
+	_, err = second.Get(ctx, j.ID())
+	assert.NoError(err)
+}
+
+// blockingStats blocks in Stats until its context is done.
+type blockingStats struct {
+	queue.Driver
+	returned chan struct{}
+}
+
+func (d *blockingStats) Stats(ctx context.Context) amboy.QueueStats {
+	defer close(d.returned)
+	<-ctx.Done()
+	return amboy.QueueStats{}
+}
+
+func TestStatsCheckStopsStatsOnTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	d := &blockingStats{Driver: queue.NewInternalDriver(), returned: make(chan struct{})}
+	assert.Error(t, StatsCheck(ctx, d))
+
+	select {
+	case <-d.returned:
+	case <-time.After(time.Second):
+		t.Fatal("stats did not return after the check")
+	}
+}
+
+func TestMonitoredDriverRestartsChecksWhenReopened(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var checks int32
+	d, err := NewMonitored(queue.NewInternalDriver(), HealthOptions{
+		Interval: time.Millisecond,
+		Check: func(context.Context, queue.Driver) error {
+			atomic.AddInt32(&checks, 1)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, d.Open(ctx))
+	d.Close()
+
+	// checks stop after Close, apart from one that may be running
+	time.Sleep(10 * time.Millisecond)
+	stopped := atomic.LoadInt32(&checks)
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, atomic.LoadInt32(&checks) <= stopped+1)
+
+	require.NoError(t, d.Open(ctx))
+	defer d.Close()
+	for atomic.LoadInt32(&checks) < stopped+3 {
+		require.NoError(t, ctx.Err())
+		time.Sleep(time.Millisecond)
+	}
+}
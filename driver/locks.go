@@ -0,0 +1,305 @@
+package driver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/clock"
+)
+
+// ErrLockHeld is returned by a Locker for operations on a keyed lock
+// that another owner holds, and for renewals of locks that the owner
+// no longer holds.
+var ErrLockHeld = errors.New("keyed lock is held by another owner")
+
+// Locker is implemented by drivers that store keyed locks alongside
+// their jobs, so that jobs on different workers can coordinate their
+// use of a shared resource (e.g. a cache directory, or a prefix of a
+// mirror's bucket) through the queue's storage, rather than through a
+// second coordination system. Locks expire once their TTL passes
+// without a renewal, so that the locks of workers that die are
+// released.
+//
+// Each operation must check and write the lock in one atomic
+// operation (e.g. a conditional upsert on the lock's key, owner, and
+// expiration).
+type Locker interface {
+	// AcquireLock takes the lock for the owner, returning an
+	// error wrapping ErrLockHeld if another owner holds it and it
+	// has not expired. Owners that hold the lock extend it.
+	AcquireLock(ctx context.Context, key, owner string, ttl time.Duration) error
+	// RenewLock extends the owner's lock, returning an error
+	// wrapping ErrLockHeld if the owner released it or another
+	// owner took it. Owners may renew locks that expired, if no
+	// other owner took them since.
+	RenewLock(ctx context.Context, key, owner string, ttl time.Duration) error
+	// ReleaseLock releases the owner's lock, returning an error
+	// wrapping ErrLockHeld if another owner holds it. Releasing a
+	// lock that no one holds is not an error.
+	ReleaseLock(ctx context.Context, key, owner string) error
+}
+
+// asLocker returns the driver as a Locker, for wrappers that pass
+// keyed locks through.
+func asLocker(d queue.Driver) (Locker, error) {
+	l, ok := d.(Locker)
+	if !ok {
+		return nil, errors.Errorf("driver %T does not support keyed locks", d)
+	}
+
+	return l, nil
+}
+
+// LockInfo describes a keyed lock.
+type LockInfo struct {
+	Key     string    `bson:"key" json:"key" yaml:"key"`
+	Owner   string    `bson:"owner" json:"owner" yaml:"owner"`
+	Expires time.Time `bson:"expires" json:"expires" yaml:"expires"`
+}
+
+// LockTable is an in-memory Locker, for drivers that keep their jobs
+// in memory (e.g. drivertest.Driver) and for tests. Tables are safe
+// for concurrent use.
+type LockTable struct {
+	clock clock.Clock
+	mutex sync.Mutex
+	locks map[string]LockInfo
+}
+
+// NewLockTable builds an empty table that expires locks by the
+// clock, or by the system clock if it's nil.
+func NewLockTable(c clock.Clock) *LockTable {
+	return &LockTable{clock: clock.Or(c), locks: map[string]LockInfo{}}
+}
+
+// AcquireLock takes the lock for the owner, unless another owner holds
+// it.
+func (t *LockTable) AcquireLock(_ context.Context, key, owner string, ttl time.Duration) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.clock.Now()
+	if lock, ok := t.locks[key]; ok && lock.Owner != owner && now.Before(lock.Expires) {
+		return errors.Wrapf(ErrLockHeld, "lock '%s' is held by '%s' until %s", key, lock.Owner, lock.Expires.Format(time.RFC3339))
+	}
+
+	t.locks[key] = LockInfo{Key: key, Owner: owner, Expires: now.Add(ttl)}
+	return nil
+}
+
+// RenewLock extends the owner's lock.
+func (t *LockTable) RenewLock(_ context.Context, key, owner string, ttl time.Duration) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	lock, ok := t.locks[key]
+	if !ok || lock.Owner != owner {
+		return errors.Wrapf(ErrLockHeld, "lock '%s' is not held by '%s'", key, owner)
+	}
+
+	lock.Expires = t.clock.Now().Add(ttl)
+	t.locks[key] = lock
+	return nil
+}
+
+// ReleaseLock releases the owner's lock.
+func (t *LockTable) ReleaseLock(_ context.Context, key, owner string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	lock, ok := t.locks[key]
+	switch {
+	case !ok:
+		return nil
+	case lock.Owner != owner && t.clock.Now().Before(lock.Expires):
+		return errors.Wrapf(ErrLockHeld, "lock '%s' is held by '%s'", key, lock.Owner)
+	}
+
+	delete(t.locks, key)
+	return nil
+}
+
+// Locks returns the locks of the table that have not expired.
+func (t *LockTable) Locks() []LockInfo {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.clock.Now()
+	out := []LockInfo{}
+	for _, lock := range t.locks {
+		if now.Before(lock.Expires) {
+			out = append(out, lock)
+		}
+	}
+
+	return out
+}
+
+// KeyedLockOptions configure a KeyedLock.
+type KeyedLockOptions struct {
+	// Key names the shared resource.
+	Key string
+	// Owner identifies the holder, such as the job's ID, and
+	// must be unique among the lock's users.
+	Owner string
+	// TTL is how long the lock lasts without a renewal.
+	TTL time.Duration
+	// RetryInterval is how often Acquire retries locks that
+	// another owner holds, and defaults to a tenth of the TTL, or
+	// a second, whichever is shorter.
+	RetryInterval time.Duration
+	// Clock, if specified, times the retries and renewals.
+	Clock clock.Clock
+}
+
+// Validate returns an error if the options are incomplete.
+func (o KeyedLockOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(o.Key == "", "must specify a lock key")
+	catcher.NewWhen(o.Owner == "", "must specify a lock owner")
+	catcher.NewWhen(o.TTL <= 0, "lock ttl must be positive")
+	catcher.NewWhen(o.RetryInterval < 0, "lock retry interval must not be negative")
+	return catcher.Resolve()
+}
+
+// KeyedLock is a lock on a key of a Locker, for use from inside jobs:
+//
+//	lock, err := driver.NewKeyedLock(d, driver.KeyedLockOptions{Key: "cache:/srv/build", Owner: j.ID(), TTL: time.Minute})
+//	...
+//	err = lock.Hold(ctx, func(ctx context.Context) error { return sync(ctx) })
+type KeyedLock struct {
+	locker Locker
+	opts   KeyedLockOptions
+}
+
+// NewKeyedLock builds a lock on the key of the options in the driver,
+// which must implement Locker.
+func NewKeyedLock(d queue.Driver, opts KeyedLockOptions) (*KeyedLock, error) {
+	l, err := asLocker(d)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLockerLock(l, opts)
+}
+
+// NewLockerLock builds a lock on the key of the options in the Locker.
+func NewLockerLock(l Locker, opts KeyedLockOptions) (*KeyedLock, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid keyed lock options")
+	}
+	if opts.RetryInterval == 0 {
+		opts.RetryInterval = opts.TTL / 10
+		if opts.RetryInterval > time.Second {
+			opts.RetryInterval = time.Second
+		}
+	}
+	opts.Clock = clock.Or(opts.Clock)
+
+	return &KeyedLock{locker: l, opts: opts}, nil
+}
+
+// Key returns the key of the lock.
+func (l *KeyedLock) Key() string { return l.opts.Key }
+
+// TryAcquire takes the lock, returning an error wrapping ErrLockHeld
+// if another owner holds it.
+func (l *KeyedLock) TryAcquire(ctx context.Context) error {
+	return l.locker.AcquireLock(ctx, l.opts.Key, l.opts.Owner, l.opts.TTL)
+}
+
+// Acquire takes the lock, waiting for other owners to release it (or
+// for their locks to expire) until the context is done.
+func (l *KeyedLock) Acquire(ctx context.Context) error {
+	for {
+		err := l.TryAcquire(ctx)
+		if errors.Cause(err) != ErrLockHeld {
+			return err
+		}
+
+		timer := l.opts.Clock.NewTimer(l.opts.RetryInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Wrapf(ctx.Err(), "stopped waiting for lock '%s' (%s)", l.opts.Key, err)
+		case <-timer.C():
+		}
+	}
+}
+
+// Renew extends the lock.
+func (l *KeyedLock) Renew(ctx context.Context) error {
+	return l.locker.RenewLock(ctx, l.opts.Key, l.opts.Owner, l.opts.TTL)
+}
+
+// Release releases the lock.
+func (l *KeyedLock) Release(ctx context.Context) error {
+	return l.locker.ReleaseLock(ctx, l.opts.Key, l.opts.Owner)
+}
+
+// Hold acquires the lock, runs the function while renewing the lock
+// every third of its TTL, and releases the lock. If a renewal fails,
+// the function's context is canceled, and Hold returns the renewal's
+// error, so that the function stops using the resource once the lock
+// may be held by another owner.
+func (l *KeyedLock) Hold(ctx context.Context, fn func(context.Context) error) error {
+	if err := l.Acquire(ctx); err != nil {
+		return err
+	}
+
+	fctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	lost := make(chan error, 1)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			timer := l.opts.Clock.NewTimer(l.opts.TTL / 3)
+			select {
+			case <-fctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C():
+			}
+
+			if err := l.Renew(fctx); err != nil {
+				if fctx.Err() != nil {
+					return
+				}
+				lost <- errors.Wrapf(err, "lost lock '%s'", l.opts.Key)
+				cancel()
+				return
+			}
+		}
+	}()
+
+	err := fn(fctx)
+	cancel()
+	<-stopped
+
+	select {
+	case lerr := <-lost:
+		return lerr
+	default:
+	}
+
+	// release with a fresh context, since the caller's may be
+	// done, bounded by the TTL, after which the lock expires anyway
+	rctx, rcancel := context.WithTimeout(context.Background(), l.opts.TTL)
+	defer rcancel()
+	if rerr := l.Release(rctx); rerr != nil {
+		grip.Warning(message.WrapError(rerr, message.Fields{
+			"message": "problem releasing keyed lock",
+			"key":     l.opts.Key,
+			"owner":   l.opts.Owner,
+		}))
+	}
+
+	return err
+}
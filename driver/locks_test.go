@@ -0,0 +1,213 @@
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/clock"
+)
+
+func TestLockTable(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	c := clock.NewFake(time.Now())
+	table := NewLockTable(c)
+
+	require.NoError(t, table.AcquireLock(ctx, "cache", "a", time.Minute))
+	assert.NoError(table.AcquireLock(ctx, "cache", "a", time.Minute))
+	assert.Equal(ErrLockHeld, errors.Cause(table.AcquireLock(ctx, "cache", "b", time.Minute)))
+	assert.Equal(ErrLockHeld, errors.Cause(table.RenewLock(ctx, "cache", "b", time.Minute)))
+	assert.Equal(ErrLockHeld, errors.Cause(table.ReleaseLock(ctx, "cache", "b")))
+	assert.NoError(table.AcquireLock(ctx, "mirror", "b", time.Minute))
+	assert.Len(table.Locks(), 2)
+
+	// renewals extend locks past their original expiration
+	c.Advance(50 * time.Second)
+	require.NoError(t, table.RenewLock(ctx, "cache", "a", time.Minute))
+	c.Advance(50 * time.Second)
+	assert.Equal(ErrLockHeld, errors.Cause(table.AcquireLock(ctx, "cache", "b", time.Minute)))
+	locks := table.Locks()
+	require.Len(t, locks, 1)
+	assert.Equal(LockInfo{Key: "cache", Owner: "a", Expires: c.Now().Add(10 * time.Second)}, locks[0])
+
+	// expired locks go to the next owner, and the previous owner
+	// can no longer renew or release them
+	c.Advance(10 * time.Second)
+	require.NoError(t, table.AcquireLock(ctx, "cache", "b", time.Minute))
+	assert.Equal(ErrLockHeld, errors.Cause(table.RenewLock(ctx, "cache", "a", time.Minute)))
+	assert.Equal(ErrLockHeld, errors.Cause(table.ReleaseLock(ctx, "cache", "a")))
+
+	require.NoError(t, table.ReleaseLock(ctx, "cache", "b"))
+	assert.NoError(table.ReleaseLock(ctx, "cache", "b"))
+	assert.Equal(ErrLockHeld, errors.Cause(table.RenewLock(ctx, "cache", "b", time.Minute)))
+	assert.NoError(table.AcquireLock(ctx, "cache", "a", time.Minute))
+}
+
+func TestKeyedLockOptions(t *testing.T) {
+	assert := assert.New(t)
+	table := NewLockTable(nil)
+
+	assert.Error(KeyedLockOptions{}.Validate())
+	assert.Error(KeyedLockOptions{Key: "k", Owner: "o"}.Validate())
+	assert.Error(KeyedLockOptions{Key: "k", TTL: time.Second}.Validate())
+	assert.Error(KeyedLockOptions{Key: "k", Owner: "o", TTL: time.Second, RetryInterval: -1}.Validate())
+	assert.NoError(KeyedLockOptions{Key: "k", Owner: "o", TTL: time.Second}.Validate())
+
+	_, err := NewLockerLock(table, KeyedLockOptions{Key: "k"})
+	assert.Error(err)
+	_, err = NewKeyedLock(queue.NewInternalDriver(), KeyedLockOptions{Key: "k", Owner: "o", TTL: time.Second})
+	assert.Error(err)
+
+	d, err := NewAging(AgingOptions{})
+	require.NoError(t, err)
+	l, err := NewKeyedLock(d, KeyedLockOptions{Key: "k", Owner: "o", TTL: time.Second})
+	require.NoError(t, err)
+	assert.Equal("k", l.Key())
+	assert.NoError(l.TryAcquire(context.Background()))
+	assert.Len(d.Locks(), 1)
+}
+
+func TestKeyedLockAcquireWaits(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c := clock.NewFake(time.Now())
+	table := NewLockTable(c)
+	first, err := NewLockerLock(table, KeyedLockOptions{Key: "cache", Owner: "a", TTL: time.Minute, Clock: c})
+	require.NoError(t, err)
+	second, err := NewLockerLock(table, KeyedLockOptions{Key: "cache", Owner: "b", TTL: time.Minute, Clock: c})
+	require.NoError(t, err)
+
+	require.NoError(t, first.Acquire(ctx))
+	assert.Equal(ErrLockHeld, errors.Cause(second.TryAcquire(ctx)))
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- second.Acquire(ctx) }()
+	for c.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-acquired:
+		assert.Fail("acquired a held lock")
+	default:
+	}
+
+	require.NoError(t, first.Release(ctx))
+	c.Advance(time.Second)
+	assert.NoError(<-acquired)
+	assert.Equal(ErrLockHeld, errors.Cause(first.TryAcquire(ctx)))
+
+	// waits end with their contexts
+	cctx, ccancel := context.WithCancel(ctx)
+	ccancel()
+	err = first.Acquire(cctx)
+	assert.Error(err)
+	assert.Equal(context.Canceled, errors.Cause(err))
+}
+
+func TestKeyedLockHold(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c := clock.NewFake(time.Now())
+	table := NewLockTable(c)
+	l, err := NewLockerLock(table, KeyedLockOptions{Key: "cache", Owner: "a", TTL: 30 * time.Second, Clock: c})
+	require.NoError(t, err)
+
+	t.Run("RenewsAndReleases", func(t *testing.T) {
+		start := c.Now()
+		err := l.Hold(ctx, func(ctx context.Context) error {
+			for c.Timers() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			c.Advance(10 * time.Second)
+			for c.Timers() == 0 || len(table.Locks()) == 0 || !table.Locks()[0].Expires.After(start.Add(30*time.Second)) {
+				time.Sleep(time.Millisecond)
+			}
+			return errors.New("failed")
+		})
+		assert.EqualError(err, "failed")
+		assert.Len(table.Locks(), 0)
+	})
+	t.Run("CancelsLostLocks", func(t *testing.T) {
+		err := l.Hold(ctx, func(fctx context.Context) error {
+			require.NoError(t, table.ReleaseLock(ctx, "cache", "a"))
+			require.NoError(t, table.AcquireLock(ctx, "cache", "b", time.Minute))
+			for c.Timers() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			c.Advance(10 * time.Second)
+			<-fctx.Done()
+			return fctx.Err()
+		})
+		assert.Error(err)
+		assert.Equal(ErrLockHeld, errors.Cause(err))
+
+		locks := table.Locks()
+		require.Len(t, locks, 1)
+		assert.Equal("b", locks[0].Owner)
+	})
+}
+
+func TestLockerWrappers(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	first, err := NewAging(AgingOptions{})
+	require.NoError(t, err)
+	second, err := NewAging(AgingOptions{})
+	require.NoError(t, err)
+	sharded, err := NewSharded(first, second)
+	require.NoError(t, err)
+
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	for _, key := range keys {
+		require.NoError(t, sharded.AcquireLock(ctx, key, "owner", time.Minute))
+		assert.Equal(ErrLockHeld, errors.Cause(sharded.AcquireLock(ctx, key, "other", time.Minute)))
+		assert.NoError(sharded.RenewLock(ctx, key, "owner", time.Minute))
+	}
+	assert.Len(first.Locks(), len(keys)-len(second.Locks()))
+	for _, key := range keys {
+		assert.NoError(sharded.Shard(key).(Locker).RenewLock(ctx, key, "owner", time.Minute))
+		assert.NoError(sharded.ReleaseLock(ctx, key, "owner"))
+	}
+	assert.Len(first.Locks(), 0)
+	assert.Len(second.Locks(), 0)
+
+	faulty, err := NewFaulty(first, FaultOptions{})
+	require.NoError(t, err)
+	fenced, err := NewFenced(first)
+	require.NoError(t, err)
+	for _, l := range []Locker{faulty, fenced} {
+		require.NoError(t, l.AcquireLock(ctx, "cache", "owner", time.Minute))
+		assert.NoError(l.RenewLock(ctx, "cache", "owner", time.Minute))
+		assert.Len(first.Locks(), 1)
+		assert.NoError(l.ReleaseLock(ctx, "cache", "owner"))
+	}
+
+	// monitored drivers refuse locks while they're degraded
+	check := &switchCheck{}
+	monitored, err := NewMonitored(first, HealthOptions{Check: check.check, Interval: time.Hour})
+	require.NoError(t, err)
+	require.NoError(t, monitored.AcquireLock(ctx, "cache", "owner", time.Minute))
+	check.set(true)
+	assert.Equal(Degraded, monitored.CheckNow(ctx).State)
+	assert.Equal(ErrUnreachable, errors.Cause(monitored.RenewLock(ctx, "cache", "owner", time.Minute)))
+	check.set(false)
+	assert.Equal(Healthy, monitored.CheckNow(ctx).State)
+	assert.NoError(monitored.ReleaseLock(ctx, "cache", "owner"))
+
+	unsupported, err := NewSharded(queue.NewInternalDriver())
+	require.NoError(t, err)
+	assert.Error(unsupported.AcquireLock(ctx, "cache", "owner", time.Minute))
+	faulty, err = NewFaulty(queue.NewInternalDriver(), FaultOptions{})
+	require.NoError(t, err)
+	assert.Error(faulty.ReleaseLock(ctx, "cache", "owner"))
+}
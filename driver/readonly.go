@@ -0,0 +1,77 @@
+package driver
+
+import (
+	"context"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/management"
+)
+
+// ErrReadOnly is returned by read-only drivers and queues for all
+// operations that would modify jobs.
+var ErrReadOnly = errors.New("queue is read-only")
+
+// ReadOnly wraps a driver so that jobs may be read, but not added,
+// modified, or dispatched, which allows dashboards and reporting
+// services to attach to a production queue's storage without any
+// risk of running or mutating its jobs.
+//
+// Put, Save, and the other operations that write jobs or keyed locks
+// return ErrReadOnly, and Next blocks until the context is canceled
+// without returning a job, so that queues using the driver never
+// dispatch work.
+type ReadOnly struct {
+	wrapped
+}
+
+// NewReadOnly wraps the driver.
+func NewReadOnly(d queue.Driver) *ReadOnly { return &ReadOnly{wrap(d)} }
+
+// Put returns ErrReadOnly.
+func (d *ReadOnly) Put(_ context.Context, j amboy.Job) error {
+	return errors.Wrapf(ErrReadOnly, "cannot add job '%s'", j.ID())
+}
+
+// Save returns ErrReadOnly.
+func (d *ReadOnly) Save(_ context.Context, j amboy.Job) error {
+	return errors.Wrapf(ErrReadOnly, "cannot save job '%s'", j.ID())
+}
+
+// SaveFenced returns ErrReadOnly.
+func (d *ReadOnly) SaveFenced(_ context.Context, j amboy.Job, _ string, _ int) error {
+	return errors.Wrapf(ErrReadOnly, "cannot save job '%s'", j.ID())
+}
+
+// Reclaim returns ErrReadOnly.
+func (d *ReadOnly) Reclaim(_ context.Context, j amboy.Job, _ string) error {
+	return errors.Wrapf(ErrReadOnly, "cannot reclaim job '%s'", j.ID())
+}
+
+// UpdateStatuses returns ErrReadOnly.
+func (d *ReadOnly) UpdateStatuses(context.Context, management.Filter, management.StatusTransition, string) ([]string, error) {
+	return nil, errors.Wrap(ErrReadOnly, "cannot update jobs")
+}
+
+// AcquireLock returns ErrReadOnly.
+func (d *ReadOnly) AcquireLock(_ context.Context, key, _ string, _ time.Duration) error {
+	return errors.Wrapf(ErrReadOnly, "cannot acquire lock '%s'", key)
+}
+
+// RenewLock returns ErrReadOnly.
+func (d *ReadOnly) RenewLock(_ context.Context, key, _ string, _ time.Duration) error {
+	return errors.Wrapf(ErrReadOnly, "cannot renew lock '%s'", key)
+}
+
+// ReleaseLock returns ErrReadOnly.
+func (d *ReadOnly) ReleaseLock(_ context.Context, key, _ string) error {
+	return errors.Wrapf(ErrReadOnly, "cannot release lock '%s'", key)
+}
+
+// Next blocks until the context is canceled, and returns nil.
+func (d *ReadOnly) Next(ctx context.Context) amboy.Job {
+	<-ctx.Done()
+	return nil
+}
@@ -0,0 +1,70 @@
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/management"
+)
+
+func TestReadOnlyDriver(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	base := queue.NewInternalDriver()
+	require.NoError(t, base.Open(ctx))
+	j := job.NewShellJob("true", "")
+	j.SetID("existing")
+	require.NoError(t, base.Put(ctx, j))
+
+	d := NewReadOnly(base)
+	require.NoError(t, d.Open(ctx))
+	defer d.Close()
+	assert.Equal(base.ID(), d.ID())
+
+	out, err := d.Get(ctx, "existing")
+	require.NoError(t, err)
+	assert.Equal("existing", out.ID())
+	assert.Equal(1, d.Stats(ctx).Total)
+
+	assert.Equal(ErrReadOnly, errors.Cause(d.Put(ctx, job.NewShellJob("true", ""))))
+	assert.Equal(ErrReadOnly, errors.Cause(d.Save(ctx, out)))
+	_, err = management.New(d).UpdateStatuses(ctx, management.Filter{}, management.TransitionAborted, "")
+	assert.Equal(ErrReadOnly, errors.Cause(err))
+	assert.Equal(ErrReadOnly, errors.Cause(d.SaveFenced(ctx, out, "", 0)))
+	assert.Equal(ErrReadOnly, errors.Cause(management.Reclaim(ctx, d, out, "")))
+	assert.Equal(ErrReadOnly, errors.Cause(d.AcquireLock(ctx, "cache", "owner", time.Minute)))
+
+	count := 0
+	for range d.Jobs(ctx) {
+		count++
+	}
+	for range d.JobStats(ctx) {
+		count++
+	}
+	assert.Equal(2, count)
+
+	// a queue using the driver never dispatches the job
+	q := queue.NewRemoteUnordered(1)
+	require.NoError(t, q.SetDriver(d))
+	qctx, qcancel := context.WithCancel(ctx)
+	require.NoError(t, q.Start(qctx))
+	time.Sleep(50 * time.Millisecond)
+	qcancel()
+
+	out, err = base.Get(ctx, "existing")
+	require.NoError(t, err)
+	assert.False(out.Status().Completed)
+	assert.False(out.Status().InProgress)
+
+	short, cancelShort := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancelShort()
+	assert.Nil(d.Next(short))
+}
@@ -0,0 +1,296 @@
+/*
+Package driver provides queue.Driver implementations that wrap other
+drivers, for use with amboy's remote queues (see
+queue.NewRemoteUnordered and queue.Remote.SetDriver).
+*/
+package driver
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/management"
+)
+
+// Sharded is a queue.Driver that spreads jobs across several
+// underlying drivers (e.g. drivers for different collections or
+// databases) by hashing job IDs, to distribute write load while
+// presenting a single queue. Stats and JobStats merge the results
+// from all shards, and Next takes jobs from the shards in turn.
+//
+// The assignment of jobs to shards depends on the number and order
+// of the shards: changing either makes existing jobs unreachable.
+type Sharded struct {
+	shards []queue.Driver
+	next   uint64
+}
+
+// NewSharded constructs a sharded driver from one or more drivers.
+func NewSharded(shards ...queue.Driver) (*Sharded, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("must specify at least one shard")
+	}
+
+	for idx, d := range shards {
+		if d == nil {
+			return nil, errors.Errorf("shard %d is nil", idx)
+		}
+	}
+
+	return &Sharded{shards: shards}, nil
+}
+
+// NewShardedQueue constructs a remote, unordered queue, with the
+// specified number of workers, that stores its jobs in the shards.
+func NewShardedQueue(workers int, shards ...queue.Driver) (queue.Remote, error) {
+	d, err := NewSharded(shards...)
+	if err != nil {
+		return nil, err
+	}
+
+	q := queue.NewRemoteUnordered(workers)
+	if err = q.SetDriver(d); err != nil {
+		return nil, errors.Wrap(err, "problem setting driver")
+	}
+
+	return q, nil
+}
+
+// Shard returns the driver that stores the job with the specified ID.
+func (d *Sharded) Shard(id string) queue.Driver {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return d.shards[h.Sum32()%uint32(len(d.shards))]
+}
+
+// ID returns an identifier composed of the shards' IDs.
+func (d *Sharded) ID() string {
+	ids := make([]string, len(d.shards))
+	for idx, s := range d.shards {
+		ids[idx] = s.ID()
+	}
+
+	return "sharded[" + strings.Join(ids, ",") + "]"
+}
+
+// Open opens all shards, and returns an error if any fail to open.
+func (d *Sharded) Open(ctx context.Context) error {
+	catcher := grip.NewBasicCatcher()
+	for _, s := range d.shards {
+		catcher.Add(errors.Wrapf(s.Open(ctx), "problem opening shard '%s'", s.ID()))
+	}
+
+	return catcher.Resolve()
+}
+
+// Close closes all shards.
+func (d *Sharded) Close() {
+	for _, s := range d.shards {
+		s.Close()
+	}
+}
+
+// Get retrieves the job from its shard.
+func (d *Sharded) Get(ctx context.Context, id string) (amboy.Job, error) {
+	return d.Shard(id).Get(ctx, id)
+}
+
+// Put adds the job to its shard.
+func (d *Sharded) Put(ctx context.Context, j amboy.Job) error {
+	return d.Shard(j.ID()).Put(ctx, j)
+}
+
+// Save saves the job in its shard.
+func (d *Sharded) Save(ctx context.Context, j amboy.Job) error {
+	return d.Shard(j.ID()).Save(ctx, j)
+}
+
+// SaveFenced saves the job in its shard, which must implement
+// FencedSaver, if it has the lock generation.
+func (d *Sharded) SaveFenced(ctx context.Context, j amboy.Job, owner string, modCount int) error {
+	fs, err := asFencedSaver(d.Shard(j.ID()))
+	if err != nil {
+		return err
+	}
+
+	return fs.SaveFenced(ctx, j, owner, modCount)
+}
+
+// AcquireLock takes the keyed lock in the key's shard, which must
+// implement Locker.
+func (d *Sharded) AcquireLock(ctx context.Context, key, owner string, ttl time.Duration) error {
+	l, err := asLocker(d.Shard(key))
+	if err != nil {
+		return err
+	}
+
+	return l.AcquireLock(ctx, key, owner, ttl)
+}
+
+// RenewLock extends the keyed lock in the key's shard.
+func (d *Sharded) RenewLock(ctx context.Context, key, owner string, ttl time.Duration) error {
+	l, err := asLocker(d.Shard(key))
+	if err != nil {
+		return err
+	}
+
+	return l.RenewLock(ctx, key, owner, ttl)
+}
+
+// ReleaseLock releases the keyed lock in the key's shard.
+func (d *Sharded) ReleaseLock(ctx context.Context, key, owner string) error {
+	l, err := asLocker(d.Shard(key))
+	if err != nil {
+		return err
+	}
+
+	return l.ReleaseLock(ctx, key, owner)
+}
+
+// Reclaim writes a job that a previous run left locked to its shard.
+func (d *Sharded) Reclaim(ctx context.Context, j amboy.Job, prefix string) error {
+	return management.Reclaim(ctx, d.Shard(j.ID()), j, prefix)
+}
+
+// Next returns a job from the first shard, starting from the shard
+// after the one checked first in the previous call, that has a job to
+// dispatch. Returns nil if no shard has a job.
+func (d *Sharded) Next(ctx context.Context) amboy.Job {
+	start := int(atomic.AddUint64(&d.next, 1) % uint64(len(d.shards)))
+	for i := 0; i < len(d.shards); i++ {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if j := d.shards[(start+i)%len(d.shards)].Next(ctx); j != nil {
+			return j
+		}
+	}
+
+	return nil
+}
+
+// Stats returns the sum of the shards' stats.
+func (d *Sharded) Stats(ctx context.Context) amboy.QueueStats {
+	out := amboy.QueueStats{}
+	for _, s := range d.shards {
+		stats := s.Stats(ctx)
+		out.Running += stats.Running
+		out.Completed += stats.Completed
+		out.Pending += stats.Pending
+		out.Blocked += stats.Blocked
+		out.Total += stats.Total
+	}
+
+	return out
+}
+
+// Jobs iterates over the jobs in all shards.
+func (d *Sharded) Jobs(ctx context.Context) <-chan amboy.Job {
+	out := make(chan amboy.Job)
+	go func() {
+		defer close(out)
+		for _, s := range d.shards {
+			for j := range s.Jobs(ctx) {
+				select {
+				case <-ctx.Done():
+					return
+				case out <- j:
+				}
+			}
+		}
+	}()
+
+	return out
+}
+
+// JobStats iterates over the status of the jobs in all shards.
+func (d *Sharded) JobStats(ctx context.Context) <-chan amboy.JobStatusInfo {
+	out := make(chan amboy.JobStatusInfo)
+	go func() {
+		defer close(out)
+		for _, s := range d.shards {
+			for stat := range s.JobStats(ctx) {
+				select {
+				case <-ctx.Done():
+					return
+				case out <- stat:
+				}
+			}
+		}
+	}()
+
+	return out
+}
+
+// FindJobs returns summaries of the jobs in all shards that match the
+// filter, with management.FindJobs, so that shards that implement
+// management.JobFinder filter their own jobs. Each shard returns at most the jobs on the requested page
+// and the pages before it, and the results are merged and paginated.
+func (d *Sharded) FindJobs(ctx context.Context, f management.Filter) ([]management.JobInfo, error) {
+	page := f
+	page.Skip = 0
+	if f.Limit > 0 {
+		page.Limit = f.Skip + f.Limit
+	}
+
+	out := []management.JobInfo{}
+	for idx, s := range d.shards {
+		jobs, err := management.FindJobs(ctx, s, page)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem finding jobs in shard %d", idx)
+		}
+		out = append(out, jobs...)
+	}
+
+	return management.Paginate(out, f), nil
+}
+
+// StreamJobStats calls the function with batches of the statuses of
+// the jobs in each shard that match the options, which shards that
+// implement management.JobStatsStreamer read in storage.
+func (d *Sharded) StreamJobStats(ctx context.Context, opts management.StatsOptions, fn func([]amboy.JobStatusInfo) error) error {
+	for idx, s := range d.shards {
+		if err := management.StreamJobStats(ctx, s, opts, fn); err != nil {
+			return errors.Wrapf(err, "problem reading job stats of shard %d", idx)
+		}
+	}
+
+	return nil
+}
+
+// CountJobs counts the jobs in all shards that match the filter.
+func (d *Sharded) CountJobs(ctx context.Context, f management.Filter) (int, error) {
+	count := 0
+	for idx, s := range d.shards {
+		n, err := management.CountJobs(ctx, s, f)
+		if err != nil {
+			return 0, errors.Wrapf(err, "problem counting jobs in shard %d", idx)
+		}
+		count += n
+	}
+
+	return count, nil
+}
+
+// UpdateStatuses applies the transition to the jobs that match the
+// filter in each shard, in one operation for shards that implement
+// management.StatusUpdater, and returns the IDs of the changed jobs.
+func (d *Sharded) UpdateStatuses(ctx context.Context, f management.Filter, t management.StatusTransition, note string) ([]string, error) {
+	catcher := grip.NewBasicCatcher()
+	out := []string{}
+	for idx, s := range d.shards {
+		ids, err := management.UpdateStatuses(ctx, s, f, t, note)
+		catcher.Wrapf(err, "problem updating jobs in shard %d", idx)
+		out = append(out, ids...)
+	}
+
+	return out, catcher.Resolve()
+}
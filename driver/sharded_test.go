@@ -0,0 +1,151 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/management"
+)
+
+func TestShardedDriverConstructor(t *testing.T) {
+	_, err := NewSharded()
+	assert.Error(t, err)
+	_, err = NewSharded(queue.NewInternalDriver(), nil)
+	assert.Error(t, err)
+	_, err = NewShardedQueue(2)
+	assert.Error(t, err)
+}
+
+func TestShardedQueueSpreadsJobs(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	shards := []queue.Driver{queue.NewInternalDriver(), queue.NewInternalDriver(), queue.NewInternalDriver()}
+	q, err := NewShardedQueue(4, shards...)
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	const num = 60
+	for i := 0; i < num; i++ {
+		j := job.NewShellJob("true", "")
+		j.SetID(fmt.Sprintf("job-%d", i))
+		require.NoError(t, q.Put(ctx, j))
+	}
+
+	require.True(t, amboy.WaitInterval(ctx, q, 10*time.Millisecond))
+
+	stats := q.Stats(ctx)
+	assert.Equal(num, stats.Total)
+	assert.Equal(num, stats.Completed)
+
+	for idx, s := range shards {
+		assert.True(s.Stats(ctx).Total > 0, "shard %d is empty", idx)
+	}
+
+	seen := 0
+	for stat := range q.JobStats(ctx) {
+		assert.True(stat.Completed)
+		seen++
+	}
+	assert.Equal(num, seen)
+
+	sharded := q.Driver().(*Sharded)
+	count := 0
+	for range sharded.Jobs(ctx) {
+		count++
+	}
+	assert.Equal(num, count)
+
+	j, ok := q.Get(ctx, "job-7")
+	require.True(t, ok)
+	assert.Equal("job-7", j.ID())
+	_, err = sharded.Shard("job-7").Get(ctx, "job-7")
+	assert.NoError(err)
+	assert.Contains(sharded.ID(), "sharded[")
+}
+
+func TestShardedDriverUpdatesStatuses(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	shards := []queue.Driver{queue.NewInternalDriver(), queue.NewInternalDriver()}
+	d, err := NewSharded(shards...)
+	require.NoError(t, err)
+	require.NoError(t, d.Open(ctx))
+
+	const num = 10
+	for i := 0; i < num; i++ {
+		j := job.NewShellJob("true", "")
+		j.SetID(fmt.Sprintf("job-%d", i))
+		require.NoError(t, d.Put(ctx, j))
+	}
+
+	ids, err := management.New(d).UpdateStatuses(ctx, management.Filter{Pattern: "^job-[0-4]$"}, management.TransitionAborted, "")
+	require.NoError(t, err)
+	assert.Len(ids, 5)
+
+	stats := d.Stats(ctx)
+	assert.Equal(5, stats.Completed)
+	assert.Equal(5, stats.Pending)
+}
+
+func TestShardedDriverFindsJobs(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	shards := []queue.Driver{}
+	for i := 0; i < 3; i++ {
+		s, err := NewAging(AgingOptions{})
+		require.NoError(t, err)
+		shards = append(shards, s)
+	}
+	d, err := NewSharded(shards...)
+	require.NoError(t, err)
+	require.NoError(t, d.Open(ctx))
+
+	now := time.Now()
+	const num = 10
+	for i := 0; i < num; i++ {
+		j := job.NewShellJob("true", "")
+		j.SetID(fmt.Sprintf("job-%d", i))
+		j.UpdateTimeInfo(amboy.JobTimeInfo{Created: now.Add(time.Duration(i) * time.Second)})
+		require.NoError(t, d.Put(ctx, j))
+	}
+
+	jobs, err := management.New(d).FindJobs(ctx, management.Filter{Skip: 3, Limit: 4})
+	require.NoError(t, err)
+	ids := []string{}
+	for _, j := range jobs {
+		ids = append(ids, j.ID)
+	}
+	assert.Equal([]string{"job-3", "job-4", "job-5", "job-6"}, ids)
+
+	jobs, err = d.FindJobs(ctx, management.Filter{Pattern: "^job-[0-4]$"})
+	require.NoError(t, err)
+	assert.Len(jobs, 5)
+
+	_, err = d.FindJobs(ctx, management.Filter{Limit: -1})
+	assert.Error(err)
+
+	// statuses and counts are merged from every shard
+	streamed := 0
+	require.NoError(t, d.StreamJobStats(ctx, management.StatsOptions{BatchSize: 2}, func(batch []amboy.JobStatusInfo) error {
+		assert.True(len(batch) <= 2)
+		streamed += len(batch)
+		return nil
+	}))
+	assert.Equal(num, streamed)
+	count, err := management.New(d).CountJobs(ctx, management.Filter{Pattern: "^job-[0-4]$"})
+	require.NoError(t, err)
+	assert.Equal(5, count)
+}
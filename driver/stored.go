@@ -0,0 +1,232 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/dependency"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/amboy/registry"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/clock"
+	"github.com/tychoish/bond/management"
+)
+
+// LockRecordTypeName is the job type of the records in which a
+// StoredLocker stores keyed locks.
+const LockRecordTypeName = "bond-keyed-lock"
+
+func init() {
+	registry.AddJobType(LockRecordTypeName, func() amboy.Job { return makeLockRecord() })
+}
+
+// lockRecord is a term of a keyed lock: each owner that takes a free
+// lock adds the record of the next term, which no other owner can add,
+// and renews the lock by saving its record. Records are stored as
+// complete, so that queues never dispatch them.
+type lockRecord struct {
+	Key       string    `bson:"key" json:"key" yaml:"key"`
+	Owner     string    `bson:"owner" json:"owner" yaml:"owner"`
+	Term      int       `bson:"term" json:"term" yaml:"term"`
+	Expires   time.Time `bson:"expires" json:"expires" yaml:"expires"`
+	Released  bool      `bson:"released" json:"released" yaml:"released"`
+	*job.Base `bson:"metadata" json:"metadata" yaml:"metadata"`
+}
+
+func makeLockRecord() *lockRecord {
+	return &lockRecord{
+		Base: &job.Base{
+			JobType: amboy.JobType{
+				Name:    LockRecordTypeName,
+				Version: 0,
+			},
+		},
+	}
+}
+
+// Run is a noop: records are never dispatched.
+func (r *lockRecord) Run(context.Context) { r.MarkComplete() }
+
+// StoredLocker is a Locker that stores keyed locks as jobs in a
+// queue.Driver, for drivers that do not implement Locker, such as
+// amboy's MongoDB driver, so that processes that share a queue share
+// its locks. It only relies on the driver rejecting jobs with an ID it
+// already has: each owner that takes a free lock adds the record of
+// the lock's next term, and renews and releases the lock by saving
+// its record. Owners that find a record of a later term than theirs
+// no longer hold the lock.
+//
+// Locks expire by the clocks of the processes that renew them, so the
+// processes' clocks should be much closer than the locks' TTLs. The
+// records of past terms stay in the driver, as completed jobs of type
+// LockRecordTypeName, and may be removed by a retention policy whose
+// ages are longer than the locks' TTLs. Since saves of complete jobs
+// through a Fenced driver are refused, use the driver that a Fenced
+// driver wraps.
+type StoredLocker struct {
+	driver queue.Driver
+	clock  clock.Clock
+
+	mutex sync.Mutex
+	terms map[string]int
+}
+
+// NewStoredLocker stores locks in the driver, and expires them by the
+// clock, or by the system clock if it's nil.
+func NewStoredLocker(d queue.Driver, c clock.Clock) (*StoredLocker, error) {
+	if d == nil {
+		return nil, errors.New("must specify a driver")
+	}
+
+	return &StoredLocker{driver: d, clock: clock.Or(c), terms: map[string]int{}}, nil
+}
+
+func lockRecordPrefix(key string) string { return fmt.Sprintf("%s-%s-", LockRecordTypeName, key) }
+
+func lockRecordID(key string, term int) string { return lockRecordPrefix(key) + strconv.Itoa(term) }
+
+// current must be called with the lock held, and returns the record
+// of the latest term of the key, which is nil if the key has never
+// been locked, or if the record was removed, along with the term.
+// Drivers do not distinguish missing jobs from failed reads, so a
+// record that cannot be read ends the search for later terms.
+func (l *StoredLocker) current(ctx context.Context, key string) (*lockRecord, int, error) {
+	term, ok := l.terms[key]
+	if !ok {
+		term = -1
+		prefix := lockRecordPrefix(key)
+		opts := management.StatsOptions{Pattern: "^" + regexp.QuoteMeta(prefix) + "[0-9]+$"}
+		err := management.StreamJobStats(ctx, l.driver, opts, func(batch []amboy.JobStatusInfo) error {
+			for _, stat := range batch {
+				if n, err := strconv.Atoi(strings.TrimPrefix(stat.ID, prefix)); err == nil && n > term {
+					term = n
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "problem finding the records of lock '%s'", key)
+		}
+	}
+
+	var rec *lockRecord
+	if term >= 0 {
+		if j, err := l.driver.Get(ctx, lockRecordID(key, term)); err == nil {
+			rec, _ = j.(*lockRecord)
+		}
+	}
+	for {
+		j, err := l.driver.Get(ctx, lockRecordID(key, term+1))
+		if err != nil {
+			break
+		}
+		term++
+		rec, _ = j.(*lockRecord)
+	}
+	l.terms[key] = term
+
+	return rec, term, nil
+}
+
+// save stores a copy of the record, so that drivers that store jobs
+// in memory only change when the save succeeds.
+func (l *StoredLocker) save(ctx context.Context, rec *lockRecord, update func(*lockRecord)) error {
+	out := makeLockRecord()
+	out.SetID(rec.ID())
+	out.Key, out.Owner, out.Term, out.Expires, out.Released = rec.Key, rec.Owner, rec.Term, rec.Expires, rec.Released
+	out.SetDependency(dependency.NewAlways())
+	out.SetStatus(rec.Status())
+	update(out)
+	out.UpdateTimeInfo(amboy.JobTimeInfo{Created: rec.TimeInfo().Created, Start: rec.TimeInfo().Start, End: l.clock.Now()})
+
+	return errors.Wrapf(l.driver.Save(ctx, out), "problem saving lock '%s'", rec.Key)
+}
+
+// AcquireLock takes the lock for the owner, by adding the record of
+// the lock's next term, or, if the owner holds it, extends it.
+func (l *StoredLocker) AcquireLock(ctx context.Context, key, owner string, ttl time.Duration) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	rec, term, err := l.current(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	now := l.clock.Now()
+	if rec != nil && !rec.Released && now.Before(rec.Expires) {
+		if rec.Owner != owner {
+			return errors.Wrapf(ErrLockHeld, "lock '%s' is held by '%s' until %s", key, rec.Owner, rec.Expires.Format(time.RFC3339))
+		}
+
+		return l.save(ctx, rec, func(out *lockRecord) { out.Expires = now.Add(ttl) })
+	}
+
+	next := makeLockRecord()
+	next.SetID(lockRecordID(key, term+1))
+	next.SetDependency(dependency.NewAlways())
+	next.Key, next.Owner, next.Term, next.Expires = key, owner, term+1, now.Add(ttl)
+	next.SetStatus(amboy.JobStatusInfo{
+		Completed:         true,
+		Owner:             l.driver.ID(),
+		ModificationTime:  now,
+		ModificationCount: 1,
+	})
+	next.UpdateTimeInfo(amboy.JobTimeInfo{Created: now, Start: now, End: now})
+
+	if err = l.driver.Put(ctx, next); err != nil {
+		if _, gerr := l.driver.Get(ctx, next.ID()); gerr == nil {
+			return errors.Wrapf(ErrLockHeld, "another owner took lock '%s'", key)
+		}
+		return errors.Wrapf(err, "problem taking lock '%s'", key)
+	}
+	l.terms[key] = term + 1
+
+	return nil
+}
+
+// RenewLock extends the owner's lock, if the owner holds its latest
+// term.
+func (l *StoredLocker) RenewLock(ctx context.Context, key, owner string, ttl time.Duration) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	rec, _, err := l.current(ctx, key)
+	if err != nil {
+		return err
+	}
+	if rec == nil || rec.Released || rec.Owner != owner {
+		return errors.Wrapf(ErrLockHeld, "lock '%s' is not held by '%s'", key, owner)
+	}
+
+	expires := l.clock.Now().Add(ttl)
+	return l.save(ctx, rec, func(out *lockRecord) { out.Expires = expires })
+}
+
+// ReleaseLock releases the owner's lock, which marks the record of its
+// term released.
+func (l *StoredLocker) ReleaseLock(ctx context.Context, key, owner string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	rec, _, err := l.current(ctx, key)
+	switch {
+	case err != nil:
+		return err
+	case rec == nil || rec.Released:
+		return nil
+	case rec.Owner != owner && l.clock.Now().Before(rec.Expires):
+		return errors.Wrapf(ErrLockHeld, "lock '%s' is held by '%s'", key, rec.Owner)
+	case rec.Owner != owner:
+		return nil
+	}
+
+	return l.save(ctx, rec, func(out *lockRecord) { out.Released = true })
+}
@@ -0,0 +1,117 @@
+package driver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/clock"
+)
+
+func TestStoredLocker(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	_, err := NewStoredLocker(nil, nil)
+	assert.Error(err)
+
+	d, err := NewAging(AgingOptions{})
+	require.NoError(t, err)
+	c := clock.NewFake(time.Now())
+
+	// lockers in separate processes share the driver's records
+	first, err := NewStoredLocker(d, c)
+	require.NoError(t, err)
+	second, err := NewStoredLocker(d, c)
+	require.NoError(t, err)
+
+	require.NoError(t, first.AcquireLock(ctx, "cache", "a", time.Minute))
+	assert.NoError(first.AcquireLock(ctx, "cache", "a", time.Minute))
+	assert.Equal(ErrLockHeld, errors.Cause(second.AcquireLock(ctx, "cache", "b", time.Minute)))
+	assert.Equal(ErrLockHeld, errors.Cause(second.RenewLock(ctx, "cache", "b", time.Minute)))
+	assert.Equal(ErrLockHeld, errors.Cause(second.ReleaseLock(ctx, "cache", "b")))
+	assert.NoError(second.AcquireLock(ctx, "cache-b", "b", time.Minute))
+
+	c.Advance(50 * time.Second)
+	require.NoError(t, first.RenewLock(ctx, "cache", "a", time.Minute))
+	c.Advance(50 * time.Second)
+	assert.Equal(ErrLockHeld, errors.Cause(second.AcquireLock(ctx, "cache", "b", time.Minute)))
+
+	// expired locks go to the next owner, in the next term
+	c.Advance(20 * time.Second)
+	require.NoError(t, second.AcquireLock(ctx, "cache", "b", time.Minute))
+	assert.Equal(ErrLockHeld, errors.Cause(first.RenewLock(ctx, "cache", "a", time.Minute)))
+	assert.Equal(ErrLockHeld, errors.Cause(first.ReleaseLock(ctx, "cache", "a")))
+
+	require.NoError(t, second.ReleaseLock(ctx, "cache", "b"))
+	assert.NoError(second.ReleaseLock(ctx, "cache", "b"))
+	assert.Equal(ErrLockHeld, errors.Cause(second.RenewLock(ctx, "cache", "b", time.Minute)))
+	require.NoError(t, first.AcquireLock(ctx, "cache", "a", time.Minute))
+
+	// a locker that starts later finds the latest term
+	third, err := NewStoredLocker(d, c)
+	require.NoError(t, err)
+	assert.Equal(ErrLockHeld, errors.Cause(third.AcquireLock(ctx, "cache", "c", time.Minute)))
+	assert.NoError(third.AcquireLock(ctx, "cache-b", "b", time.Minute))
+	assert.Equal(1, third.terms["cache-b"])
+
+	// records are stored as complete jobs, which queues never
+	// dispatch or wait for
+	records := 0
+	for j := range d.Jobs(ctx) {
+		assert.Equal(LockRecordTypeName, j.Type().Name)
+		assert.True(j.Status().Completed)
+		records++
+	}
+	assert.Equal(5, records)
+	assert.True(d.Stats(ctx).IsComplete())
+	assert.Nil(d.Next(ctx))
+}
+
+func TestStoredLockerWithSerializingDriver(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	d, err := NewAging(AgingOptions{})
+	require.NoError(t, err)
+	sd := &copyingDriver{Driver: d, t: t}
+
+	l, err := NewStoredLocker(sd, nil)
+	require.NoError(t, err)
+	require.NoError(t, l.AcquireLock(ctx, "cache", "a", time.Minute))
+	require.NoError(t, l.RenewLock(ctx, "cache", "a", time.Minute))
+	require.NoError(t, l.ReleaseLock(ctx, "cache", "a"))
+
+	other, err := NewStoredLocker(sd, nil)
+	require.NoError(t, err)
+	assert.NoError(other.AcquireLock(ctx, "cache", "b", time.Minute))
+	assert.Equal(ErrLockHeld, errors.Cause(l.AcquireLock(ctx, "cache", "a", time.Minute)))
+}
+
+// copyingDriver round trips jobs through their interchange format, as
+// drivers that store jobs outside of the process do.
+type copyingDriver struct {
+	queue.Driver
+	t *testing.T
+}
+
+func (d *copyingDriver) Put(ctx context.Context, j amboy.Job) error {
+	return d.Driver.Put(ctx, copyJob(d.t, j))
+}
+
+func (d *copyingDriver) Save(ctx context.Context, j amboy.Job) error {
+	return d.Driver.Save(ctx, copyJob(d.t, j))
+}
+
+func (d *copyingDriver) Get(ctx context.Context, id string) (amboy.Job, error) {
+	j, err := d.Driver.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return copyJob(d.t, j), nil
+}
@@ -0,0 +1,133 @@
+package driver
+
+import (
+	"context"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/tychoish/bond/management"
+)
+
+// wrapped is embedded by the drivers that wrap another driver, and
+// passes the operations that the wrapper does not override through
+// to the wrapped driver, including the optional interfaces (Locker,
+// FencedSaver, and management's JobFinder, StatsStreamer,
+// JobCounter, StatusUpdater, and Reclaimer). Optional operations
+// that the wrapped driver does not implement fall back to the
+// management package's helpers, or return an error.
+//
+// The wrapped driver is read through a function, so that wrappers
+// that replace their driver (e.g. Monitored) can embed it.
+type wrapped struct {
+	inner func() queue.Driver
+}
+
+func wrap(d queue.Driver) wrapped { return wrapped{inner: func() queue.Driver { return d }} }
+
+// ID returns the ID of the wrapped driver.
+func (w wrapped) ID() string { return w.inner().ID() }
+
+// Open opens the wrapped driver.
+func (w wrapped) Open(ctx context.Context) error { return w.inner().Open(ctx) }
+
+// Close closes the wrapped driver.
+func (w wrapped) Close() { w.inner().Close() }
+
+// Get retrieves a job from the wrapped driver.
+func (w wrapped) Get(ctx context.Context, id string) (amboy.Job, error) {
+	return w.inner().Get(ctx, id)
+}
+
+// Put adds the job to the wrapped driver.
+func (w wrapped) Put(ctx context.Context, j amboy.Job) error { return w.inner().Put(ctx, j) }
+
+// Save updates the job in the wrapped driver.
+func (w wrapped) Save(ctx context.Context, j amboy.Job) error { return w.inner().Save(ctx, j) }
+
+// SaveFenced updates the job in the wrapped driver, which must
+// implement FencedSaver, if it has the lock generation.
+func (w wrapped) SaveFenced(ctx context.Context, j amboy.Job, owner string, modCount int) error {
+	fs, err := asFencedSaver(w.inner())
+	if err != nil {
+		return err
+	}
+
+	return fs.SaveFenced(ctx, j, owner, modCount)
+}
+
+// AcquireLock takes the keyed lock in the wrapped driver, which must
+// implement Locker.
+func (w wrapped) AcquireLock(ctx context.Context, key, owner string, ttl time.Duration) error {
+	l, err := asLocker(w.inner())
+	if err != nil {
+		return err
+	}
+
+	return l.AcquireLock(ctx, key, owner, ttl)
+}
+
+// RenewLock extends the keyed lock in the wrapped driver.
+func (w wrapped) RenewLock(ctx context.Context, key, owner string, ttl time.Duration) error {
+	l, err := asLocker(w.inner())
+	if err != nil {
+		return err
+	}
+
+	return l.RenewLock(ctx, key, owner, ttl)
+}
+
+// ReleaseLock releases the keyed lock in the wrapped driver.
+func (w wrapped) ReleaseLock(ctx context.Context, key, owner string) error {
+	l, err := asLocker(w.inner())
+	if err != nil {
+		return err
+	}
+
+	return l.ReleaseLock(ctx, key, owner)
+}
+
+// UpdateStatuses applies the transition to the jobs in the wrapped
+// driver that match the filter.
+func (w wrapped) UpdateStatuses(ctx context.Context, f management.Filter, t management.StatusTransition, note string) ([]string, error) {
+	return management.UpdateStatuses(ctx, w.inner(), f, t, note)
+}
+
+// Reclaim writes a job that a previous run left locked to the wrapped
+// driver.
+func (w wrapped) Reclaim(ctx context.Context, j amboy.Job, prefix string) error {
+	return management.Reclaim(ctx, w.inner(), j, prefix)
+}
+
+// Next returns the next job from the wrapped driver.
+func (w wrapped) Next(ctx context.Context) amboy.Job { return w.inner().Next(ctx) }
+
+// FindJobs returns summaries of the jobs in the wrapped driver that
+// match the filter.
+func (w wrapped) FindJobs(ctx context.Context, f management.Filter) ([]management.JobInfo, error) {
+	return management.FindJobs(ctx, w.inner(), f)
+}
+
+// StreamJobStats calls the function with batches of the statuses of
+// the jobs in the wrapped driver that match the options.
+func (w wrapped) StreamJobStats(ctx context.Context, opts management.StatsOptions, fn func([]amboy.JobStatusInfo) error) error {
+	return management.StreamJobStats(ctx, w.inner(), opts, fn)
+}
+
+// CountJobs counts the jobs in the wrapped driver that match the
+// filter.
+func (w wrapped) CountJobs(ctx context.Context, f management.Filter) (int, error) {
+	return management.CountJobs(ctx, w.inner(), f)
+}
+
+// Jobs iterates over the jobs in the wrapped driver.
+func (w wrapped) Jobs(ctx context.Context) <-chan amboy.Job { return w.inner().Jobs(ctx) }
+
+// Stats returns the stats of the wrapped driver.
+func (w wrapped) Stats(ctx context.Context) amboy.QueueStats { return w.inner().Stats(ctx) }
+
+// JobStats iterates over the status of the jobs in the wrapped
+// driver.
+func (w wrapped) JobStats(ctx context.Context) <-chan amboy.JobStatusInfo {
+	return w.inner().JobStats(ctx)
+}
@@ -0,0 +1,88 @@
+package bond
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ShellSyntax is the syntax of the environment exports that
+// EnvExports prints.
+type ShellSyntax string
+
+// The supported shell syntaxes. POSIXShell is for sh, bash, and zsh.
+const (
+	POSIXShell ShellSyntax = "posix"
+	FishShell  ShellSyntax = "fish"
+)
+
+// BinariesEnvVar is the environment variable that EnvExports sets to
+// the bin directory of a build.
+const BinariesEnvVar = "MONGODB_BINARIES"
+
+// Resolve returns the path of the newest cached build of the version,
+// which is a release (e.g. 7.0.2) or a series (e.g. 7.0). If the
+// build options are empty, the catalog must have exactly one build of
+// the release, otherwise only builds with the options are considered.
+func (c *BuildCatalog) Resolve(version string, build BuildOptions) (string, error) {
+	if strings.Count(version, ".") != 1 || strings.ContainsAny(version, "-~") {
+		return c.find(version, build)
+	}
+
+	var newest *MongoDBVersion
+	c.mutex.RLock()
+	for info := range c.table {
+		if releaseSeries(info.Version) != version {
+			continue
+		}
+		if build != (BuildOptions{}) && info.Options != build {
+			continue
+		}
+
+		v, err := NewMongoDBVersion(info.Version)
+		if err != nil || !v.IsRelease() {
+			continue
+		}
+		if newest == nil || v.IsGreaterThan(newest) {
+			newest = v
+		}
+	}
+	c.mutex.RUnlock()
+
+	if newest == nil {
+		return "", errors.Wrapf(ErrVersionNotFound, "could not find a release of %s in %s", version, c.Path)
+	}
+
+	return c.find(newest.String(), build)
+}
+
+// EnvExports returns the shell commands that put the bin directory of
+// the build first on the PATH and set BinariesEnvVar to it, for a
+// shell to evaluate (e.g. eval "$(recall env 7.0)").
+func EnvExports(buildDir string, shell ShellSyntax) (string, error) {
+	bin, err := filepath.Abs(filepath.Join(buildDir, "bin"))
+	if err != nil {
+		return "", errors.Wrap(err, "problem resolving absolute path")
+	}
+
+	switch shell {
+	case "", POSIXShell:
+		quoted := posixQuote(bin)
+		return fmt.Sprintf("export PATH=%s:\"$PATH\"\nexport %s=%s\n", quoted, BinariesEnvVar, quoted), nil
+	case FishShell:
+		quoted := fishQuote(bin)
+		return fmt.Sprintf("set -gx PATH %s $PATH;\nset -gx %s %s;\n", quoted, BinariesEnvVar, quoted), nil
+	default:
+		return "", errors.Errorf("'%s' is not a supported shell", shell)
+	}
+}
+
+func posixQuote(val string) string {
+	return "'" + strings.Replace(val, "'", `'\''`, -1) + "'"
+}
+
+func fishQuote(val string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(val) + "'"
+}
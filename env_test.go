@@ -0,0 +1,65 @@
+package bond
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatalogResolve(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-catalog-resolve")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+
+	catalog := &BuildCatalog{Path: dir, table: map[BuildInfo]string{}, verified: map[string]Verification{}}
+	for _, name := range []string{
+		"mongodb-linux-x86_64-ubuntu1604-3.4.2",
+		"mongodb-linux-x86_64-ubuntu1604-3.4.10",
+		"mongodb-linux-x86_64-ubuntu1604-3.6.0",
+		"mongodb-linux-x86_64-enterprise-ubuntu1604-3.6.1",
+	} {
+		require.NoError(t, catalog.Add(writeTestBuild(t, dir, name)))
+	}
+
+	path, err := catalog.Resolve("3.4", BuildOptions{})
+	require.NoError(t, err)
+	assert.Equal(filepath.Join(dir, "mongodb-linux-x86_64-ubuntu1604-3.4.10"), path)
+
+	path, err = catalog.Resolve("3.4.2", BuildOptions{})
+	require.NoError(t, err)
+	assert.Equal(filepath.Join(dir, "mongodb-linux-x86_64-ubuntu1604-3.4.2"), path)
+
+	path, err = catalog.Resolve("3.6", BuildOptions{Target: "ubuntu1604", Arch: AMD64, Edition: CommunityTargeted})
+	require.NoError(t, err)
+	assert.Equal(filepath.Join(dir, "mongodb-linux-x86_64-ubuntu1604-3.6.0"), path)
+
+	_, err = catalog.Resolve("4.0", BuildOptions{})
+	assert.True(Is(err, ErrVersionNotFound))
+}
+
+func TestEnvExports(t *testing.T) {
+	assert := assert.New(t)
+
+	out, err := EnvExports("/cache/mongodb-7.0.2", POSIXShell)
+	require.NoError(t, err)
+	assert.Equal("export PATH='/cache/mongodb-7.0.2/bin':\"$PATH\"\nexport MONGODB_BINARIES='/cache/mongodb-7.0.2/bin'\n", out)
+
+	out, err = EnvExports("/cache/it's", "")
+	require.NoError(t, err)
+	assert.Contains(out, `'/cache/it'\''s/bin'`)
+
+	out, err = EnvExports("/cache/mongodb-7.0.2", FishShell)
+	require.NoError(t, err)
+	assert.Equal("set -gx PATH '/cache/mongodb-7.0.2/bin' $PATH;\nset -gx MONGODB_BINARIES '/cache/mongodb-7.0.2/bin';\n", out)
+
+	_, err = EnvExports("/cache", "csh")
+	assert.Error(err)
+}
@@ -0,0 +1,65 @@
+package bond
+
+import (
+	stderrors "errors"
+
+	"github.com/pkg/errors"
+)
+
+// Errors returned (wrapped with context) by the feed, catalog, and
+// download operations, so that callers can distinguish failures
+// without matching error strings. Use Is to check for them.
+var (
+	// ErrVersionNotFound is returned when a feed or catalog has no
+	// entry for a requested version or series.
+	ErrVersionNotFound = errors.New("version not found")
+
+	// ErrChecksumMismatch is returned when a downloaded file does
+	// not match the checksum published for it.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrVerificationFailed is returned when a verifier rejects a
+	// downloaded archive.
+	ErrVerificationFailed = errors.New("verification failed")
+
+	// ErrVerificationSkipped is returned by verifiers that have
+	// nothing to check for an archive.
+	ErrVerificationSkipped = errors.New("verification skipped")
+
+	// ErrInsufficientSpace is returned when the disk does not have
+	// room for a download of a known size.
+	ErrInsufficientSpace = errors.New("insufficient disk space")
+
+	// ErrReadOnlyCatalog is returned by operations that would
+	// change a catalog opened read-only.
+	ErrReadOnlyCatalog = errors.New("catalog is read-only")
+
+	// ErrIncompatibleHost is returned when the current system
+	// cannot run a build.
+	ErrIncompatibleHost = errors.New("incompatible host")
+)
+
+// Is reports whether any error in err's chain matches target. Unlike
+// the standard library's errors.Is, Is follows both the Cause method
+// of errors wrapped by github.com/pkg/errors (which this project uses
+// for all wrapping, and which does not implement Unwrap in the
+// vendored version) and the Unwrap method of standard library
+// errors.
+func Is(err, target error) bool {
+	for err != nil {
+		if stderrors.Is(err, target) {
+			return true
+		}
+
+		switch e := err.(type) {
+		case interface{ Cause() error }:
+			err = e.Cause()
+		case interface{ Unwrap() error }:
+			err = e.Unwrap()
+		default:
+			return false
+		}
+	}
+
+	return false
+}
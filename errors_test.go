@@ -0,0 +1,37 @@
+package bond
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsFollowsCauseAndUnwrap(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(Is(ErrVersionNotFound, ErrVersionNotFound))
+	assert.True(Is(errors.Wrap(ErrVersionNotFound, "outer"), ErrVersionNotFound))
+	assert.True(Is(errors.Wrap(fmt.Errorf("middle: %w", errors.WithStack(ErrChecksumMismatch)), "outer"), ErrChecksumMismatch))
+	assert.False(Is(errors.Wrap(ErrVersionNotFound, "outer"), ErrChecksumMismatch))
+	assert.False(Is(nil, ErrVersionNotFound))
+	assert.False(Is(errors.New("version not found"), ErrVersionNotFound))
+}
+
+func TestFeedLookupsReturnVersionNotFound(t *testing.T) {
+	feed, err := NewArtifactsFeed("")
+	require.NoError(t, err)
+	defer os.RemoveAll(feed.dir)
+
+	_, err = feed.GetStableRelease("3.2")
+	assert.True(t, Is(err, ErrVersionNotFound))
+
+	_, err = feed.GetLatestArchive("3.2", BuildOptions{})
+	assert.True(t, Is(err, ErrVersionNotFound))
+
+	_, err = feed.GetCurrentArchive("3.2", BuildOptions{})
+	assert.True(t, Is(err, ErrVersionNotFound))
+}
@@ -0,0 +1,107 @@
+package bond
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+)
+
+// WithGenericLinuxFallback resolves requests for community builds of
+// Linux distributions that a release doesn't publish to the release's
+// generic Linux build for the architecture, where it has one, rather
+// than failing. Resolutions that fall back have a warning, which the
+// feed reports for the archive's URL with Warnings, and which
+// downloads record in the build's provenance.
+func WithGenericLinuxFallback() Option { return func(c *Config) { c.GenericLinuxFallback = true } }
+
+// genericLinuxOptions returns the options of the generic Linux build
+// that replaces the requested build, if the options are for a
+// community build of a Linux distribution.
+func genericLinuxOptions(options BuildOptions) (BuildOptions, bool) {
+	if options.Edition != CommunityTargeted || options.Target == "" {
+		return BuildOptions{}, false
+	}
+
+	for _, prefix := range []string{"linux", "windows", "osx", "macos", "sunos", "src", "auto"} {
+		if strings.HasPrefix(options.Target, prefix) {
+			return BuildOptions{}, false
+		}
+	}
+
+	return BuildOptions{Target: "linux", Arch: options.Arch, Edition: Base, Debug: options.Debug}, true
+}
+
+// fallbackWarning describes the replacement of a build with the
+// generic Linux build.
+func fallbackWarning(version string, options BuildOptions) string {
+	return fmt.Sprintf("MongoDB %s has no %s build for %s (%s); using the generic linux build instead",
+		version, options.Edition, options.Target, options.Arch)
+}
+
+// getDownload returns the version's download for the options, or,
+// if the version has none and the feed falls back to generic Linux
+// builds, its generic Linux download and a warning. Other errors are
+// returned unchanged.
+func (feed *ArtifactsFeed) getDownload(version *ArtifactVersion, options BuildOptions) (ArtifactDownload, string, error) {
+	dl, err := version.GetDownload(options)
+	if err == nil || feed.conf == nil || !feed.conf.GenericLinuxFallback {
+		return dl, "", err
+	}
+
+	if _, ok := AsBuildNotFound(err); !ok {
+		return dl, "", err
+	}
+
+	generic, ok := genericLinuxOptions(options)
+	if !ok {
+		return dl, "", err
+	}
+
+	fallback, ferr := version.GetDownload(generic)
+	if ferr != nil {
+		return dl, "", err
+	}
+
+	warning := fallbackWarning(version.Version, options)
+	grip.Warning(message.Fields{
+		"message": "falling back to generic linux build",
+		"version": version.Version,
+		"target":  options.Target,
+		"arch":    options.Arch,
+		"url":     fallback.Archive.URL,
+	})
+
+	return fallback, warning, nil
+}
+
+// recordWarning records the warning of the resolution of the archive.
+func (feed *ArtifactsFeed) recordWarning(url, warning string) {
+	if warning == "" {
+		return
+	}
+
+	feed.warningsMutex.Lock()
+	defer feed.warningsMutex.Unlock()
+
+	if feed.warnings == nil {
+		feed.warnings = map[string][]string{}
+	}
+	for _, w := range feed.warnings[url] {
+		if w == warning {
+			return
+		}
+	}
+	feed.warnings[url] = append(feed.warnings[url], warning)
+}
+
+// Warnings returns the warnings of the resolutions of the archive at
+// the URL, as the feed resolved it, such as a fallback to a generic
+// Linux build.
+func (feed *ArtifactsFeed) Warnings(url string) []string {
+	feed.warningsMutex.Lock()
+	defer feed.warningsMutex.Unlock()
+
+	return append([]string(nil), feed.warnings[url]...)
+}
@@ -0,0 +1,83 @@
+package bond
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fallbackTestFeed = `{"versions": [
+  {"version": "4.0.28", "current": true, "downloads": [
+    {"target": "linux_x86_64", "arch": "x86_64", "edition": "base",
+     "archive": {"url": "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-4.0.28.tgz"}},
+    {"target": "ubuntu1804", "arch": "x86_64", "edition": "targeted",
+     "archive": {"url": "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-ubuntu1804-4.0.28.tgz"}}]}
+]}`
+
+func TestGenericLinuxFallback(t *testing.T) {
+	assert := assert.New(t)
+	opts := BuildOptions{Target: "ubuntu2204", Arch: AMD64, Edition: CommunityTargeted}
+	generic := "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-4.0.28.tgz"
+
+	strict, err := NewArtifactsFeed("")
+	require.NoError(t, err)
+	defer os.RemoveAll(strict.dir)
+	require.NoError(t, strict.Reload([]byte(fallbackTestFeed)))
+	_, err = strict.Resolve("4.0.28", opts)
+	assert.True(Is(err, ErrBuildNotFound))
+
+	feed, err := NewArtifactsFeed("", WithGenericLinuxFallback())
+	require.NoError(t, err)
+	defer os.RemoveAll(feed.dir)
+	require.NoError(t, feed.Reload([]byte(fallbackTestFeed)))
+
+	resolved, err := feed.Resolve("4.0.28", opts)
+	require.NoError(t, err)
+	require.Len(t, resolved, 1)
+	assert.Equal(generic, resolved[0].URL)
+	assert.Contains(resolved[0].Warning, "no targeted build for ubuntu2204")
+	assert.Equal([]string{resolved[0].Warning}, feed.Warnings(generic))
+
+	url, err := feed.GetCurrentArchive("4.0", opts)
+	require.NoError(t, err)
+	assert.Equal(generic, url)
+	assert.Len(feed.Warnings(generic), 1)
+
+	// published builds, and enterprise builds, never fall back
+	opts.Target = "ubuntu1804"
+	resolved, err = feed.Resolve("4.0.28", opts)
+	require.NoError(t, err)
+	assert.Equal("", resolved[0].Warning)
+	assert.Len(feed.Warnings(resolved[0].URL), 0)
+
+	_, err = feed.Resolve("4.0.28", BuildOptions{Target: "ubuntu2204", Arch: AMD64, Edition: Enterprise})
+	assert.True(Is(err, ErrBuildNotFound))
+	_, err = feed.Resolve("4.0.28", BuildOptions{Target: "ubuntu2204", Arch: POWER, Edition: CommunityTargeted})
+	assert.True(Is(err, ErrBuildNotFound))
+}
+
+func TestCatalogGenericLinuxFallback(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir := newTestSharedCatalogDir(t)
+	defer os.RemoveAll(dir)
+	build := writeTestBuild(t, dir, "mongodb-linux-x86_64-4.0.28")
+
+	strict, err := NewCatalog(ctx, dir)
+	require.NoError(t, err)
+	_, err = strict.Get("4.0.28", string(CommunityTargeted), "ubuntu2204", string(AMD64), false)
+	assert.True(Is(err, ErrVersionNotFound))
+
+	catalog, err := NewCatalog(ctx, dir, WithGenericLinuxFallback())
+	require.NoError(t, err)
+	path, err := catalog.Get("4.0.28", string(CommunityTargeted), "ubuntu2204", string(AMD64), false)
+	require.NoError(t, err)
+	assert.Equal(build, path)
+
+	_, err = catalog.Get("4.0.28", string(Enterprise), "ubuntu2204", string(AMD64), false)
+	assert.True(Is(err, ErrVersionNotFound))
+}
@@ -2,36 +2,51 @@ package bond
 
 import (
 	"context"
-	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/blang/semver"
 	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
 	"github.com/pkg/errors"
 )
 
+// FeedURL is the MongoDB server's build information feed.
+const FeedURL = "http://downloads.mongodb.org/full.json"
+
 // ArtifactsFeed represents the entire structure of the MongoDB build information feed.
 // See http://downloads.mongodb.org/full.json for an example.
 type ArtifactsFeed struct {
 	Versions []*ArtifactVersion
 
 	mutex sync.RWMutex
-	table map[string]*ArtifactVersion
-	dir   string
-	path  string
+	// populating serializes Populate, so that feeds that share
+	// the ArtifactsFeed (e.g. a ServerFeed and a CryptSharedFeed)
+	// download it once.
+	populating sync.Mutex
+	table      map[string]*ArtifactVersion
+	dir        string
+	path       string
+	strict     bool
+	schema     *FeedSchemaReport
+	conf       *Config
+	// warnings are the warnings of resolutions, by archive URL.
+	warnings      map[string][]string
+	warningsMutex sync.Mutex
 }
 
 // GetArtifactsFeed parses a ArtifactsFeed object from a file on the file system.
 // This operation will automatically refresh the feed from
 // http://downloads.mongodb.org/full.json if the modification time of
 // the file on the file system is more than 48 hours old.
-func GetArtifactsFeed(ctx context.Context, path string) (*ArtifactsFeed, error) {
-	feed, err := NewArtifactsFeed(path)
+func GetArtifactsFeed(ctx context.Context, path string, opts ...Option) (*ArtifactsFeed, error) {
+	feed, err := NewArtifactsFeed(path, opts...)
 	if err != nil {
 		return nil, errors.Wrap(err, "problem building feed")
 	}
@@ -45,11 +60,18 @@ func GetArtifactsFeed(ctx context.Context, path string) (*ArtifactsFeed, error)
 
 // NewArtifactsFeed takes the path of a file and returns an empty
 // ArtifactsFeed object. You may specify an empty string as an argument
-// to return a feed object homed on a temporary directory.
-func NewArtifactsFeed(path string) (*ArtifactsFeed, error) {
+// to return a feed object homed on a temporary directory, unless the
+// options specify a cache path.
+func NewArtifactsFeed(path string, opts ...Option) (*ArtifactsFeed, error) {
+	conf := NewConfig(opts...)
+	if path == "" {
+		path = conf.CachePath
+	}
+
 	f := &ArtifactsFeed{
 		table: make(map[string]*ArtifactVersion),
 		path:  path,
+		conf:  conf,
 	}
 
 	if path == "" {
@@ -84,7 +106,18 @@ func NewArtifactsFeed(path string) (*ArtifactsFeed, error) {
 // specified TTL. Additional Populate parses the data feed, using the
 // Reload method.
 func (feed *ArtifactsFeed) Populate(ctx context.Context, ttl time.Duration) error {
-	data, err := CacheDownload(ctx, ttl, "http://downloads.mongodb.org/full.json", feed.path, false)
+	feed.populating.Lock()
+	defer feed.populating.Unlock()
+
+	if feed.conf != nil && feed.conf.LowMemoryFeed {
+		if err := cacheFile(ctx, feed.conf, ttl, FeedURL, feed.path, false); err != nil {
+			return errors.Wrap(err, "problem getting feed data")
+		}
+
+		return errors.Wrap(feed.ReloadFile(feed.path), "problem reloading feed")
+	}
+
+	data, err := feed.conf.CacheDownload(ctx, ttl, FeedURL, feed.path, false)
 
 	if err != nil {
 		return errors.Wrap(err, "problem getting feed data")
@@ -104,11 +137,28 @@ func (feed *ArtifactsFeed) Reload(data []byte) error {
 	feed.mutex.Lock()
 	defer feed.mutex.Unlock()
 
-	err := json.Unmarshal(data, feed)
+	versions, report, err := DecodeFeed(data, FeedDecodeOptions{Strict: feed.strict})
 	if err != nil {
-		return errors.Wrap(err, "problem converting data from json")
+		return errors.WithStack(err)
 	}
 
+	feed.install(versions, report)
+	return nil
+}
+
+// install replaces the feed's versions with the decoded versions. The
+// caller must hold the feed's lock.
+func (feed *ArtifactsFeed) install(versions []*ArtifactVersion, report *FeedSchemaReport) {
+	feed.Versions = versions
+	feed.schema = report
+
+	grip.WarningWhen(!report.Empty(), message.Fields{
+		"message":        "feed does not match the expected schema",
+		"path":           feed.path,
+		"report":         report.String(),
+		"unknown_fields": report.UnknownFields,
+	})
+
 	// this is a reload rather than a new load, and we shoiuld
 	if len(feed.table) > 0 {
 		feed.table = make(map[string]*ArtifactVersion)
@@ -118,8 +168,23 @@ func (feed *ArtifactsFeed) Reload(data []byte) error {
 		feed.table[version.Version] = version
 		version.refresh()
 	}
+}
+
+// SetStrictSchema configures whether Reload fails when the feed has
+// fields that bond does not know about.
+func (feed *ArtifactsFeed) SetStrictSchema(strict bool) {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+	feed.strict = strict
+}
 
-	return err
+// SchemaReport returns the differences between the most recently
+// loaded feed data and the expected schema, or nil if no data has
+// been loaded.
+func (feed *ArtifactsFeed) SchemaReport() *FeedSchemaReport {
+	feed.mutex.RLock()
+	defer feed.mutex.RUnlock()
+	return feed.schema
 }
 
 // GetVersion takes a version string and returns the entire Artifacts version.
@@ -145,10 +210,10 @@ func (feed *ArtifactsFeed) GetLatestArchive(series string, options BuildOptions)
 
 	version, ok := feed.GetVersion(series + ".0")
 	if !ok {
-		return "", errors.Errorf("there is no .0 release for series '%s' in the feed", series)
+		return "", errors.Wrapf(ErrVersionNotFound, "there is no .0 release for series '%s' in the feed", series)
 	}
 
-	dl, err := version.GetDownload(options)
+	dl, warning, err := feed.getDownload(version, options)
 	if err != nil {
 		return "", errors.Wrapf(err, "problem fetching download information for series '%s'", series)
 	}
@@ -163,12 +228,16 @@ func (feed *ArtifactsFeed) GetLatestArchive(series string, options BuildOptions)
 		return "", errors.Wrapf(err, "version specification is invalid")
 	}
 
+	var url string
 	if seriesNum%2 == 1 {
-		return strings.Replace(dl.Archive.URL, version.Version, "latest", -1), nil
+		url = feed.conf.MirrorURL(strings.Replace(dl.Archive.URL, version.Version, "latest", -1))
+	} else {
+		// if it's a stable version we just replace the version with the word latest.
+		url = feed.conf.MirrorURL(strings.Replace(dl.Archive.URL, version.Version, "v"+series+"-latest", -1))
 	}
+	feed.recordWarning(url, warning)
 
-	// if it's a stable version we just replace the version with the word latest.
-	return strings.Replace(dl.Archive.URL, version.Version, "v"+series+"-latest", -1), nil
+	return url, nil
 }
 
 // GetCurrentArchive is a helper to download the latest stable release for a specific series.
@@ -181,12 +250,15 @@ func (feed *ArtifactsFeed) GetCurrentArchive(series string, options BuildOptions
 		return "", errors.Wrap(err, "could not find version for: "+series)
 	}
 
-	dl, err := version.GetDownload(options)
+	dl, warning, err := feed.getDownload(version, options)
 	if err != nil {
-		return "", errors.Wrap(err, "problem finding version")
+		return "", errors.Wrap(feed.explainMissingBuild(err), "problem finding version")
 	}
 
-	return dl.Archive.URL, nil
+	url := feed.conf.MirrorURL(dl.Archive.URL)
+	feed.recordWarning(url, warning)
+
+	return url, nil
 
 }
 
@@ -197,7 +269,7 @@ func (feed *ArtifactsFeed) GetStableRelease(series string) (*ArtifactVersion, er
 	if series == "2.4" {
 		version, ok := feed.GetVersion("2.4.14")
 		if !ok {
-			return nil, errors.Errorf("could not find current version 2.4.14")
+			return nil, errors.Wrap(ErrVersionNotFound, "could not find current version 2.4.14")
 		}
 		return version, nil
 	}
@@ -208,11 +280,12 @@ func (feed *ArtifactsFeed) GetStableRelease(series string) (*ArtifactVersion, er
 		}
 	}
 
-	return nil, errors.Errorf("could not find a current version for series: %s", series)
+	return nil, errors.Wrapf(ErrVersionNotFound, "could not find a current version for series: %s", series)
 }
 
 // GetArchives provides an iterator for all archives given a list of
-// releases (versions) for a specific set of build operations.
+// releases (versions, or other version specifiers, which are
+// resolved with Resolve) for a specific set of build operations.
 // Returns channels of urls (strings) and errors. Read from the error channel,
 // after completing all results.
 func (feed *ArtifactsFeed) GetArchives(releases []string, options BuildOptions) (<-chan string, <-chan error) {
@@ -222,49 +295,15 @@ func (feed *ArtifactsFeed) GetArchives(releases []string, options BuildOptions)
 	go func() {
 		catcher := grip.NewCatcher()
 		for _, rel := range releases {
-			// this is a series, have to handle it differently
-			hasLatest := strings.Contains(rel, "latest")
-			if len(rel) == 3 || hasLatest {
-				if hasLatest {
-					rel = strings.Split(rel, "-")[0]
-				}
-
-				url, err := feed.GetLatestArchive(rel, options)
-				if err != nil {
-					catcher.Add(err)
-					continue
-				}
-				output <- url
-				continue
-			}
-
-			if strings.HasSuffix(rel, "-current") || strings.HasSuffix(rel, "-stable") {
-				rel = strings.Split(rel, "-")[0]
-				url, err := feed.GetCurrentArchive(rel, options)
-				if err != nil {
-					catcher.Add(err)
-					continue
-				}
-				output <- url
-				continue
-			}
-
-			version, ok := feed.GetVersion(rel)
-			if !ok {
-				catcher.Add(errors.Errorf("no version defined for %s", rel))
-				continue
-			}
-			dl, err := version.GetDownload(options)
+			resolved, err := feed.Resolve(rel, options)
 			if err != nil {
 				catcher.Add(err)
 				continue
 			}
 
-			if options.Debug {
-				output <- dl.Archive.Debug
-				continue
+			for _, r := range resolved {
+				output <- r.URL
 			}
-			output <- dl.Archive.URL
 		}
 		close(output)
 		if catcher.HasErrors() {
@@ -276,6 +315,113 @@ func (feed *ArtifactsFeed) GetArchives(releases []string, options BuildOptions)
 	return output, errOut
 }
 
+// Span returns every release in the feed between the from and to
+// versions, inclusive, in ascending order. Development builds are
+// never included, and release candidates are only included if one of
+// the bounds is a release candidate. Span returns an error wrapping
+// ErrVersionNotFound if there are no releases in the range.
+func (feed *ArtifactsFeed) Span(from, to string) ([]*ArtifactVersion, error) {
+	lower, err := NewMongoDBVersion(from)
+	if err != nil {
+		return nil, errors.Wrapf(err, "'%s' is not a valid version", from)
+	}
+
+	upper, err := NewMongoDBVersion(to)
+	if err != nil {
+		return nil, errors.Wrapf(err, "'%s' is not a valid version", to)
+	}
+
+	if upper.IsLessThan(lower) {
+		return nil, errors.Errorf("version %s is before %s", to, from)
+	}
+
+	includeRCs := lower.IsReleaseCandidate() || upper.IsReleaseCandidate()
+
+	feed.mutex.RLock()
+	defer feed.mutex.RUnlock()
+
+	type spanVersion struct {
+		parsed  *MongoDBVersion
+		version *ArtifactVersion
+	}
+
+	span := []spanVersion{}
+	for _, version := range feed.Versions {
+		parsed, err := NewMongoDBVersion(version.Version)
+		if err != nil || parsed.IsDevelopmentBuild() {
+			continue
+		}
+
+		if parsed.IsReleaseCandidate() && !includeRCs {
+			continue
+		}
+
+		if parsed.IsLessThan(lower) || parsed.IsGreaterThan(upper) {
+			continue
+		}
+
+		span = append(span, spanVersion{parsed: parsed, version: version})
+	}
+
+	if len(span) == 0 {
+		return nil, errors.Wrapf(ErrVersionNotFound, "no releases between %s and %s", from, to)
+	}
+
+	sort.Slice(span, func(i, j int) bool { return span[i].parsed.IsLessThan(span[j].parsed) })
+
+	out := make([]*ArtifactVersion, len(span))
+	for idx := range span {
+		out[idx] = span[idx].version
+	}
+
+	return out, nil
+}
+
+// Match returns every release in the feed that satisfies the
+// constraint, a semantic version range (e.g. ">=4.4.0 <4.4.10" or
+// ">=6.0.0 || 7.0.2"), in ascending order. Development builds and
+// release candidates are never included. Match returns an error
+// wrapping ErrVersionNotFound if no release satisfies the constraint.
+func (feed *ArtifactsFeed) Match(constraint string) ([]*ArtifactVersion, error) {
+	match, err := semver.ParseRange(constraint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "'%s' is not a valid version constraint", constraint)
+	}
+
+	feed.mutex.RLock()
+	defer feed.mutex.RUnlock()
+
+	type matchVersion struct {
+		parsed  *MongoDBVersion
+		version *ArtifactVersion
+	}
+
+	matches := []matchVersion{}
+	for _, version := range feed.Versions {
+		parsed, err := NewMongoDBVersion(version.Version)
+		if err != nil || parsed.IsDevelopmentBuild() || parsed.IsReleaseCandidate() {
+			continue
+		}
+
+		if match(parsed.parsed) {
+			matches = append(matches, matchVersion{parsed: parsed, version: version})
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, errors.Wrapf(ErrVersionNotFound, "no releases match '%s'", constraint)
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].parsed.IsLessThan(matches[j].parsed) })
+
+	out := make([]*ArtifactVersion, len(matches))
+	for idx := range matches {
+		out[idx] = matches[idx].version
+	}
+
+	return out, nil
+}
+
 func coerceSeries(series string) string {
 	if series[0] == 'v' {
 		series = series[1:]
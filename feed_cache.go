@@ -0,0 +1,122 @@
+package bond
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultFeedCacheTTL is how long GetCachedArtifactsFeed reuses a
+// parsed feed before it loads the feed again.
+const DefaultFeedCacheTTL = 10 * time.Minute
+
+// FeedCache memoizes parsed feeds in memory, by path, so that
+// processes that resolve builds many times do not re-read and
+// re-parse the feed for each resolution. Feeds are loaded with
+// GetArtifactsFeed, which refreshes the file on disk as needed.
+//
+// FeedCache is safe for concurrent use: concurrent callers for the
+// same path wait for a single load.
+type FeedCache struct {
+	ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[string]*feedCacheEntry
+	load    func(context.Context, string) (*ArtifactsFeed, error)
+}
+
+type feedCacheEntry struct {
+	mutex  sync.Mutex
+	feed   *ArtifactsFeed
+	loaded time.Time
+}
+
+// NewFeedCache returns an empty cache that reuses feeds for the TTL.
+// A TTL of zero or less disables memoization.
+func NewFeedCache(ttl time.Duration) *FeedCache {
+	return &FeedCache{
+		ttl:     ttl,
+		entries: map[string]*feedCacheEntry{},
+		load: func(ctx context.Context, path string) (*ArtifactsFeed, error) {
+			return GetArtifactsFeed(ctx, path)
+		},
+	}
+}
+
+// SetTTL changes how long the cache reuses feeds, including feeds
+// that are already cached.
+func (c *FeedCache) SetTTL(ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.ttl = ttl
+}
+
+// Get returns the feed at the path, loading it if it's not cached or
+// if the cached feed is older than the TTL. Failed loads are not
+// cached.
+func (c *FeedCache) Get(ctx context.Context, path string) (*ArtifactsFeed, error) {
+	key := path
+	if abs, err := filepath.Abs(path); err == nil && path != "" {
+		key = abs
+	}
+
+	c.mutex.Lock()
+	ttl := c.ttl
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &feedCacheEntry{}
+		c.entries[key] = entry
+	}
+	c.mutex.Unlock()
+
+	entry.mutex.Lock()
+	defer entry.mutex.Unlock()
+
+	if entry.feed != nil && ttl > 0 && time.Since(entry.loaded) < ttl {
+		return entry.feed, nil
+	}
+
+	feed, err := c.load(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.feed = feed
+	entry.loaded = time.Now()
+
+	return feed, nil
+}
+
+// Invalidate removes the feed at the path from the cache.
+func (c *FeedCache) Invalidate(path string) {
+	if abs, err := filepath.Abs(path); err == nil && path != "" {
+		path = abs
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, path)
+}
+
+// Reset removes all feeds from the cache.
+func (c *FeedCache) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = map[string]*feedCacheEntry{}
+}
+
+var feedCache = NewFeedCache(DefaultFeedCacheTTL)
+
+// GetCachedArtifactsFeed is a memoized GetArtifactsFeed, which
+// returns the same feed for a path until the feed cache's TTL
+// elapses. Use SetFeedCacheTTL to configure the TTL.
+func GetCachedArtifactsFeed(ctx context.Context, path string) (*ArtifactsFeed, error) {
+	return feedCache.Get(ctx, path)
+}
+
+// SetFeedCacheTTL configures how long GetCachedArtifactsFeed reuses
+// feeds. A TTL of zero or less disables memoization.
+func SetFeedCacheTTL(ttl time.Duration) { feedCache.SetTTL(ttl) }
+
+// ResetFeedCache removes all feeds memoized by GetCachedArtifactsFeed.
+func ResetFeedCache() { feedCache.Reset() }
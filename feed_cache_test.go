@@ -0,0 +1,85 @@
+package bond
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedCacheMemoizesFeeds(t *testing.T) {
+	assert := assert.New(t)
+
+	var (
+		mutex sync.Mutex
+		loads int
+		fail  bool
+	)
+	cache := NewFeedCache(time.Hour)
+	cache.load = func(ctx context.Context, path string) (*ArtifactsFeed, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		loads++
+		if fail {
+			return nil, errors.New("feed unavailable")
+		}
+		return &ArtifactsFeed{path: path}, nil
+	}
+	getLoads := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return loads
+	}
+
+	ctx := context.Background()
+	wg := &sync.WaitGroup{}
+	feeds := make([]*ArtifactsFeed, 10)
+	for i := range feeds {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			feed, err := cache.Get(ctx, "build/full.json")
+			assert.NoError(err)
+			feeds[i] = feed
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(1, getLoads())
+	for _, feed := range feeds {
+		assert.True(feed == feeds[0])
+	}
+
+	other, err := cache.Get(ctx, "other/full.json")
+	require.NoError(t, err)
+	assert.False(other == feeds[0])
+	assert.Equal(2, getLoads())
+
+	cache.Invalidate("build/full.json")
+	feed, err := cache.Get(ctx, "build/full.json")
+	require.NoError(t, err)
+	assert.False(feed == feeds[0])
+	assert.Equal(3, getLoads())
+
+	cache.SetTTL(0)
+	mutex.Lock()
+	fail = true
+	mutex.Unlock()
+	_, err = cache.Get(ctx, "build/full.json")
+	assert.Error(err)
+	assert.Equal(4, getLoads())
+
+	cache.SetTTL(time.Hour)
+	mutex.Lock()
+	fail = false
+	mutex.Unlock()
+	cache.Reset()
+	_, err = cache.Get(ctx, "build/full.json")
+	require.NoError(t, err)
+	_, err = cache.Get(ctx, "build/full.json")
+	require.NoError(t, err)
+	assert.Equal(5, getLoads())
+}
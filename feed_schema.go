@@ -0,0 +1,196 @@
+package bond
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrFeedSchema is returned, when decoding a feed strictly, if the
+// feed has fields that bond does not know about.
+var ErrFeedSchema = errors.New("feed has unknown fields")
+
+// FeedDecodeOptions control the decoding of feeds.
+type FeedDecodeOptions struct {
+	// Strict causes decoding to fail if the feed has fields that
+	// bond does not know about, so that changes to the upstream
+	// feed are noticed rather than silently ignored.
+	Strict bool `bson:"strict" json:"strict" yaml:"strict"`
+}
+
+// FeedSchemaReport describes the differences between a decoded feed
+// and the schema that bond expects.
+type FeedSchemaReport struct {
+	// UnknownFields are the paths of fields that bond ignores
+	// (e.g. "versions[].downloads[].signature").
+	UnknownFields []string `bson:"unknown_fields" json:"unknown_fields" yaml:"unknown_fields"`
+	// Normalized describes the values that were missing or
+	// inconsistent, and were corrected, as for old releases.
+	Normalized []string `bson:"normalized" json:"normalized" yaml:"normalized"`
+	// Dropped is the number of downloads and versions that were
+	// unusable, and removed.
+	Dropped int `bson:"dropped" json:"dropped" yaml:"dropped"`
+}
+
+// Empty reports whether the feed matched the expected schema.
+func (r *FeedSchemaReport) Empty() bool {
+	return len(r.UnknownFields) == 0 && len(r.Normalized) == 0 && r.Dropped == 0
+}
+
+func (r *FeedSchemaReport) String() string {
+	return fmt.Sprintf("%d unknown fields, %d normalized values, %d dropped entries",
+		len(r.UnknownFields), len(r.Normalized), r.Dropped)
+}
+
+// knownFeedFields are the fields of each level of the feed. Some are
+// not used by bond, but are expected.
+var knownFeedFields = map[string][]string{
+	"":                                    {"versions"},
+	"versions[]":                          {"version", "downloads", "githash", "production_release", "development_release", "release_candidate", "current", "lts", "changes", "notes", "date"},
+	"versions[].downloads[]":              {"arch", "archive", "crypt_shared", "edition", "target", "msi", "packages", "title"},
+	"versions[].downloads[].archive":      {"url", "debug_symbols", "md5", "sha1", "sha256", "sha512"},
+	"versions[].downloads[].crypt_shared": {"url", "md5", "sha1", "sha256", "sha512"},
+}
+
+// DecodeFeed decodes the data of a feed, tolerating the known
+// variations of its schema: fields that old releases omit are
+// filled in, unusable entries are dropped, and unknown fields are
+// ignored, unless the options are strict.
+func DecodeFeed(data []byte, opts FeedDecodeOptions) ([]*ArtifactVersion, *FeedSchemaReport, error) {
+	doc := struct {
+		Versions []*ArtifactVersion
+	}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, errors.Wrap(err, "problem converting data from json")
+	}
+
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, errors.Wrap(err, "problem converting data from json")
+	}
+
+	report := &FeedSchemaReport{}
+	unknown := map[string]struct{}{}
+	findUnknownFields("", raw, unknown)
+	for path := range unknown {
+		report.UnknownFields = append(report.UnknownFields, path)
+	}
+	sort.Strings(report.UnknownFields)
+
+	if opts.Strict && len(report.UnknownFields) > 0 {
+		return nil, report, errors.Wrapf(ErrFeedSchema, "%s", strings.Join(report.UnknownFields, ", "))
+	}
+
+	n := newFeedNormalizer(report, len(doc.Versions))
+	for _, version := range doc.Versions {
+		n.add(version)
+	}
+
+	return n.versions, report, nil
+}
+
+// feedNormalizer fills in the fields that old releases omit and drops
+// unusable entries, as versions are decoded, recording the changes in
+// the report.
+type feedNormalizer struct {
+	report   *FeedSchemaReport
+	versions []*ArtifactVersion
+	seen     map[string]struct{}
+}
+
+func newFeedNormalizer(report *FeedSchemaReport, size int) *feedNormalizer {
+	return &feedNormalizer{
+		report:   report,
+		versions: make([]*ArtifactVersion, 0, size),
+		seen:     map[string]struct{}{},
+	}
+}
+
+func (n *feedNormalizer) add(version *ArtifactVersion) {
+	report := n.report
+	if version == nil {
+		report.Dropped++
+		return
+	}
+
+	if trimmed := strings.TrimSpace(version.Version); trimmed != version.Version {
+		report.Normalized = append(report.Normalized, fmt.Sprintf("version '%s' has surrounding space", version.Version))
+		version.Version = trimmed
+	}
+	if version.Version == "" {
+		report.Dropped++
+		return
+	}
+	if _, ok := n.seen[version.Version]; ok {
+		report.Normalized = append(report.Normalized, fmt.Sprintf("version %s is duplicated", version.Version))
+		report.Dropped++
+		return
+	}
+	n.seen[version.Version] = struct{}{}
+
+	downloads := version.Downloads[:0]
+	for _, dl := range version.Downloads {
+		// without a target and arch, builds cannot be
+		// resolved.
+		if dl.Target == "" && dl.Arch == "" {
+			report.Dropped++
+			continue
+		}
+
+		// the oldest releases do not specify editions
+		if dl.Edition == "" {
+			report.Normalized = append(report.Normalized, fmt.Sprintf("%s download for %s has no edition", version.Version, dl.Target))
+			dl.Edition = Base
+		}
+
+		downloads = append(downloads, dl)
+	}
+	version.Downloads = downloads
+
+	n.versions = append(n.versions, version)
+}
+
+func findUnknownFields(path string, value interface{}, unknown map[string]struct{}) {
+	switch v := value.(type) {
+	case []interface{}:
+		for _, elem := range v {
+			findUnknownFields(path+"[]", elem, unknown)
+		}
+	case map[string]interface{}:
+		known, ok := knownFeedFields[path]
+		if !ok {
+			return
+		}
+
+		for key, elem := range v {
+			if !containsFold(known, key) {
+				if path == "" {
+					unknown[key] = struct{}{}
+				} else {
+					unknown[path+"."+key] = struct{}{}
+				}
+				continue
+			}
+
+			child := strings.ToLower(key)
+			if path != "" {
+				child = path + "." + child
+			}
+			findUnknownFields(child, elem, unknown)
+		}
+	}
+}
+
+// containsFold matches keys as encoding/json does, ignoring case.
+func containsFold(values []string, key string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, key) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,73 @@
+package bond
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const schemaTestFeed = `{"versions": [
+  {"version": "4.4.0", "lts": true, "future_field": 1, "downloads": [
+    {"target": "rhel80", "arch": "x86_64", "edition": "enterprise", "signature": "abc",
+     "archive": {"url": "https://example.net/a.tgz", "sha256": "123", "blake3": "456"}}]},
+  {"version": " 2.2.0 ", "downloads": [
+    {"target": "linux_x86_64", "arch": "x86_64", "archive": {"url": "https://example.net/old.tgz"}},
+    {"archive": {"url": "https://example.net/unknown.tgz"}}]},
+  {"version": "4.4.0"},
+  null
+], "generated": "today"}`
+
+func TestDecodeFeedToleratesSchemaVariations(t *testing.T) {
+	assert := assert.New(t)
+
+	versions, report, err := DecodeFeed([]byte(schemaTestFeed), FeedDecodeOptions{})
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal("4.4.0", versions[0].Version)
+	assert.Equal("2.2.0", versions[1].Version)
+	require.Len(t, versions[1].Downloads, 1)
+	assert.Equal(MongoDBEdition(Base), versions[1].Downloads[0].Edition)
+
+	assert.Equal([]string{
+		"generated",
+		"versions[].downloads[].archive.blake3",
+		"versions[].downloads[].signature",
+		"versions[].future_field",
+	}, report.UnknownFields)
+	assert.Len(report.Normalized, 3)
+	assert.Equal(3, report.Dropped)
+	assert.False(report.Empty())
+
+	_, report, err = DecodeFeed([]byte(schemaTestFeed), FeedDecodeOptions{Strict: true})
+	assert.True(Is(err, ErrFeedSchema))
+	assert.Contains(err.Error(), "versions[].future_field")
+	assert.Len(report.UnknownFields, 4)
+
+	_, report, err = DecodeFeed([]byte(`{"Versions": [{"Version": "4.0.0", "Current": true}]}`), FeedDecodeOptions{Strict: true})
+	require.NoError(t, err)
+	assert.True(report.Empty())
+
+	_, _, err = DecodeFeed([]byte(`{"versions": {}}`), FeedDecodeOptions{})
+	assert.Error(err)
+}
+
+func TestFeedReloadStrictSchema(t *testing.T) {
+	assert := assert.New(t)
+
+	feed, err := NewArtifactsFeed("")
+	require.NoError(t, err)
+	defer os.RemoveAll(feed.dir)
+	assert.Nil(feed.SchemaReport())
+
+	require.NoError(t, feed.Reload([]byte(schemaTestFeed)))
+	_, ok := feed.GetVersion("2.2.0")
+	assert.True(ok)
+	assert.Len(feed.SchemaReport().UnknownFields, 4)
+
+	feed.SetStrictSchema(true)
+	assert.True(Is(feed.Reload([]byte(schemaTestFeed)), ErrFeedSchema))
+	_, ok = feed.GetVersion("2.2.0")
+	assert.True(ok, "failed reload keeps the previous data")
+}
@@ -0,0 +1,143 @@
+package bond
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// WithLowMemoryFeed decodes feeds incrementally, one version at a
+// time, from their files on disk, which are memory-mapped where the
+// platform supports it, rather than reading each feed into memory and
+// decoding it whole. Decoding is slower, but the peak memory of
+// loading a feed is little more than the decoded versions, which
+// matters for processes with small memory limits that load several
+// feeds at once.
+func WithLowMemoryFeed() Option { return func(c *Config) { c.LowMemoryFeed = true } }
+
+// DecodeFeedStream decodes a feed from the reader as DecodeFeed does,
+// one version at a time, so that only the decoded versions, and not
+// the feed's data, are held in memory.
+func DecodeFeedStream(r io.Reader, opts FeedDecodeOptions) ([]*ArtifactVersion, *FeedSchemaReport, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, nil, err
+	}
+
+	report := &FeedSchemaReport{}
+	unknown := map[string]struct{}{}
+	n := newFeedNormalizer(report, 0)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "problem converting data from json")
+		}
+		key, _ := tok.(string)
+
+		if !strings.EqualFold(key, "versions") {
+			unknown[key] = struct{}{}
+			var skip json.RawMessage
+			if err = dec.Decode(&skip); err != nil {
+				return nil, nil, errors.Wrap(err, "problem converting data from json")
+			}
+			continue
+		}
+
+		if err = decodeVersions(dec, n, unknown); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, nil, err
+	}
+
+	for path := range unknown {
+		report.UnknownFields = append(report.UnknownFields, path)
+	}
+	sort.Strings(report.UnknownFields)
+
+	if opts.Strict && len(report.UnknownFields) > 0 {
+		return nil, report, errors.Wrapf(ErrFeedSchema, "%s", strings.Join(report.UnknownFields, ", "))
+	}
+
+	return n.versions, report, nil
+}
+
+// decodeVersions decodes the elements of the versions array, each of
+// which is decoded from its own buffer and then released.
+func decodeVersions(dec *json.Decoder, n *feedNormalizer, unknown map[string]struct{}) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return errors.Wrap(err, "problem converting data from json")
+	}
+	if tok == nil {
+		return nil
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return errors.Errorf("problem converting data from json: versions is not an array")
+	}
+
+	for dec.More() {
+		var raw json.RawMessage
+		if err = dec.Decode(&raw); err != nil {
+			return errors.Wrap(err, "problem converting data from json")
+		}
+
+		var version *ArtifactVersion
+		if err = json.Unmarshal(raw, &version); err != nil {
+			return errors.Wrap(err, "problem converting data from json")
+		}
+
+		var fields interface{}
+		if err = json.Unmarshal(raw, &fields); err != nil {
+			return errors.Wrap(err, "problem converting data from json")
+		}
+		findUnknownFields("versions[]", fields, unknown)
+
+		n.add(version)
+	}
+
+	return expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return errors.Wrap(err, "problem converting data from json")
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != want {
+		return errors.Errorf("problem converting data from json: expected '%s'", want)
+	}
+
+	return nil
+}
+
+// ReloadFile loads the feed from the file at the path, as Reload
+// does, decoding it incrementally (see DecodeFeedStream) so that the
+// file's data is never held in memory.
+func (feed *ArtifactsFeed) ReloadFile(path string) error {
+	feed.mutex.RLock()
+	strict := feed.strict
+	feed.mutex.RUnlock()
+
+	r, err := openMapped(path)
+	if err != nil {
+		return errors.Wrapf(err, "problem opening feed %s", path)
+	}
+	defer r.Close()
+
+	versions, report, err := DecodeFeedStream(r, FeedDecodeOptions{Strict: strict})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+	feed.install(versions, report)
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package bond
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeFeedStreamMatchesDecodeFeed(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, data := range []string{
+		schemaTestFeed,
+		`{"Versions": [{"Version": "4.0.0", "Current": true}]}`,
+		`{"versions": null}`,
+		`{}`,
+	} {
+		expected, expectedReport, err := DecodeFeed([]byte(data), FeedDecodeOptions{})
+		require.NoError(t, err, data)
+		versions, report, err := DecodeFeedStream(strings.NewReader(data), FeedDecodeOptions{})
+		require.NoError(t, err, data)
+
+		assert.Equal(expected, versions, data)
+		assert.Equal(expectedReport, report, data)
+	}
+
+	_, report, err := DecodeFeedStream(strings.NewReader(schemaTestFeed), FeedDecodeOptions{Strict: true})
+	assert.True(Is(err, ErrFeedSchema))
+	assert.Len(report.UnknownFields, 4)
+
+	for _, data := range []string{`{"versions": {}}`, `[]`, `{"versions": [`, ``} {
+		_, _, err = DecodeFeedStream(strings.NewReader(data), FeedDecodeOptions{})
+		assert.Error(err, data)
+	}
+}
+
+func TestFeedReloadFile(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-feed-stream")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "full.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(schemaTestFeed), 0644))
+
+	feed, err := NewArtifactsFeed(path, WithLowMemoryFeed())
+	require.NoError(t, err)
+	require.NoError(t, feed.ReloadFile(path))
+	_, ok := feed.GetVersion("2.2.0")
+	assert.True(ok)
+	assert.Len(feed.SchemaReport().UnknownFields, 4)
+
+	feed.SetStrictSchema(true)
+	assert.True(Is(feed.ReloadFile(path), ErrFeedSchema))
+	_, ok = feed.GetVersion("2.2.0")
+	assert.True(ok, "failed reload keeps the previous data")
+
+	// a fresh file on disk is decoded without downloading the feed
+	feed.SetStrictSchema(false)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	require.NoError(t, feed.Populate(ctx, time.Hour))
+	assert.Len(feed.Versions, 2)
+
+	empty := filepath.Join(dir, "empty.json")
+	require.NoError(t, ioutil.WriteFile(empty, nil, 0644))
+	assert.Error(feed.ReloadFile(empty))
+	assert.Error(feed.ReloadFile(filepath.Join(dir, "missing.json")))
+}
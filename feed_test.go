@@ -0,0 +1,138 @@
+package bond
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const spanTestFeed = `{"versions": [
+  {"version": "4.4.2"},
+  {"version": "4.4.1"},
+  {"version": "4.4.1-rc0"},
+  {"version": "4.4.0"},
+  {"version": "4.4.0-rc13"},
+  {"version": "4.4.3-12-g1234567"},
+  {"version": "4.2.9"},
+  {"version": "4.9.0-alpha"}
+]}`
+
+func spanVersions(versions []*ArtifactVersion) []string {
+	out := []string{}
+	for _, v := range versions {
+		out = append(out, v.Version)
+	}
+	return out
+}
+
+func TestFeedSpan(t *testing.T) {
+	assert := assert.New(t)
+
+	feed, err := NewArtifactsFeed("")
+	require.NoError(t, err)
+	defer os.RemoveAll(feed.dir)
+	require.NoError(t, feed.Reload([]byte(spanTestFeed)))
+
+	span, err := feed.Span("4.4.0", "4.4.29")
+	require.NoError(t, err)
+	assert.Equal([]string{"4.4.0", "4.4.1", "4.4.2"}, spanVersions(span))
+
+	span, err = feed.Span("4.2.0", "4.4.1")
+	require.NoError(t, err)
+	assert.Equal([]string{"4.2.9", "4.4.0", "4.4.1"}, spanVersions(span))
+
+	span, err = feed.Span("4.4.0-rc13", "4.4.1")
+	require.NoError(t, err)
+	assert.Equal([]string{"4.4.0-rc13", "4.4.0", "4.4.1-rc0", "4.4.1"}, spanVersions(span))
+
+	span, err = feed.Span("4.4.1", "4.4.1")
+	require.NoError(t, err)
+	assert.Equal([]string{"4.4.1"}, spanVersions(span))
+
+	_, err = feed.Span("4.4.2", "4.4.0")
+	assert.Error(err)
+
+	_, err = feed.Span("4.4", "4.4.2")
+	assert.Error(err)
+
+	_, err = feed.Span("5.0.0", "5.0.9")
+	assert.True(Is(err, ErrVersionNotFound))
+}
+
+func TestFeedMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	feed, err := NewArtifactsFeed("")
+	require.NoError(t, err)
+	defer os.RemoveAll(feed.dir)
+	require.NoError(t, feed.Reload([]byte(spanTestFeed)))
+
+	matches, err := feed.Match(">=4.4.0 <4.4.2")
+	require.NoError(t, err)
+	assert.Equal([]string{"4.4.0", "4.4.1"}, spanVersions(matches))
+
+	matches, err = feed.Match("<4.4.0 || >4.4.1")
+	require.NoError(t, err)
+	assert.Equal([]string{"4.2.9", "4.4.2"}, spanVersions(matches))
+
+	_, err = feed.Match(">=5.0.0")
+	assert.True(Is(err, ErrVersionNotFound))
+	_, err = feed.Match("four")
+	assert.Error(err)
+}
+
+func TestFeedPowerAndZSeriesArchives(t *testing.T) {
+	assert := assert.New(t)
+
+	feed, err := NewArtifactsFeed("")
+	require.NoError(t, err)
+	defer os.RemoveAll(feed.dir)
+
+	require.NoError(t, feed.Reload([]byte(`{"versions": [
+  {"version": "6.0.5", "current": true, "downloads": [
+    {"target": "rhel83", "arch": "s390x", "edition": "enterprise",
+     "archive": {"url": "https://downloads.mongodb.com/linux/mongodb-linux-s390x-enterprise-rhel83-6.0.5.tgz",
+                 "debug_symbols": "https://downloads.mongodb.com/linux/mongodb-linux-s390x-enterprise-rhel83-debugsymbols-6.0.5.tgz"}},
+    {"target": "rhel81", "arch": "ppc64le", "edition": "enterprise",
+     "archive": {"url": "https://downloads.mongodb.com/linux/mongodb-linux-ppc64le-enterprise-rhel81-6.0.5.tgz"}}]},
+  {"version": "4.0.0", "downloads": [
+    {"target": "rhel72", "arch": "s390x", "edition": "enterprise",
+     "archive": {"url": "https://downloads.mongodb.com/linux/mongodb-linux-s390x-enterprise-rhel72-4.0.0.tgz"}},
+    {"target": "rhel71", "arch": "ppc64le", "edition": "enterprise",
+     "archive": {"url": "https://downloads.mongodb.com/linux/mongodb-linux-ppc64le-enterprise-rhel71-4.0.0.tgz"}}]}
+]}`)))
+
+	for opts, expected := range map[BuildOptions][]string{
+		{Target: "rhel83", Arch: ZSeries, Edition: Enterprise}: {
+			"https://downloads.mongodb.com/linux/mongodb-linux-s390x-enterprise-rhel83-6.0.5.tgz"},
+		{Target: "rhel83", Arch: ZSeries, Edition: Enterprise, Debug: true}: {
+			"https://downloads.mongodb.com/linux/mongodb-linux-s390x-enterprise-rhel83-debugsymbols-6.0.5.tgz"},
+		{Target: "rhel81", Arch: POWER, Edition: Enterprise}: {
+			"https://downloads.mongodb.com/linux/mongodb-linux-ppc64le-enterprise-rhel81-6.0.5.tgz"},
+	} {
+		urls, errs := feed.GetArchives([]string{"6.0.5"}, opts)
+		out := []string{}
+		for url := range urls {
+			out = append(out, url)
+		}
+		assert.NoError(<-errs)
+		assert.Equal(expected, out)
+
+		info, err := GetInfoFromFileName(out[0][:len(out[0])-4])
+		require.NoError(t, err)
+		assert.Equal(opts, info.Options)
+	}
+
+	url, err := feed.GetCurrentArchive("6.0", BuildOptions{Target: "rhel81", Arch: POWER, Edition: Enterprise})
+	require.NoError(t, err)
+	assert.Equal("https://downloads.mongodb.com/linux/mongodb-linux-ppc64le-enterprise-rhel81-6.0.5.tgz", url)
+
+	url, err = feed.GetLatestArchive("4.0", BuildOptions{Target: "rhel72", Arch: ZSeries, Edition: Enterprise})
+	require.NoError(t, err)
+	assert.Equal("https://downloads.mongodb.com/linux/mongodb-linux-s390x-enterprise-rhel72-v4.0-latest.tgz", url)
+
+	_, err = feed.GetCurrentArchive("6.0", BuildOptions{Target: "rhel83", Arch: POWER, Edition: Enterprise})
+	assert.Error(err)
+}
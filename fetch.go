@@ -34,6 +34,27 @@ func createDirectory(path string) error {
 // the file, unless local file is older than the ttl, or the force
 // option is specified. CacheDownload returns the contents of the file.
 func CacheDownload(ctx context.Context, ttl time.Duration, url, path string, force bool) ([]byte, error) {
+	return cacheDownload(ctx, nil, ttl, url, path, force)
+}
+
+func cacheDownload(ctx context.Context, conf *Config, ttl time.Duration, url, path string, force bool) ([]byte, error) {
+	if err := cacheFile(ctx, conf, ttl, url, path, force); err != nil {
+		return nil, err
+	}
+
+	// TODO: we're effectively reading the file into memory twice
+	// to write it to disk and read it out again.
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// cacheFile downloads the url to the path, unless the file at the
+// path is younger than the ttl.
+func cacheFile(ctx context.Context, conf *Config, ttl time.Duration, url, path string, force bool) error {
 	if ttl == 0 {
 		force = true
 	}
@@ -44,31 +65,28 @@ func CacheDownload(ctx context.Context, ttl time.Duration, url, path string, for
 		if (ttl > 0 && age > ttl) || force {
 			grip.Infof("removing stale (%s) file (%s)", age, path)
 			if err = os.Remove(path); err != nil {
-				return nil, errors.Wrap(err, "problem removing stale feed.")
+				return errors.Wrap(err, "problem removing stale feed.")
 			}
 		}
 	}
 
-	// TODO: we're effectively reading the file into memory twice
-	// to write it to disk and read it out again.
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		err := DownloadFile(ctx, url, path)
-		if err != nil {
-			return nil, err
-		}
+		return conf.DownloadFile(ctx, url, path)
 	}
 
-	data, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-
-	return data, nil
+	return nil
 }
 
 // DownloadFile downloads a resource (url) into a file specified by
 // fileName. Also creates enclosing directories as needed.
 func DownloadFile(ctx context.Context, url, fileName string) error {
+	client := GetHTTPClient()
+	defer PutHTTPClient(client)
+
+	return downloadFile(ctx, client, nil, url, fileName)
+}
+
+func downloadFile(ctx context.Context, client *http.Client, progress ProgressFunc, url, fileName string) error {
 	if err := createDirectory(filepath.Dir(fileName)); err != nil {
 		return errors.Wrapf(err, "problem creating enclosing directory for %s", fileName)
 	}
@@ -89,27 +107,37 @@ func DownloadFile(ctx context.Context, url, fileName string) error {
 	}
 	defer output.Close()
 
-	client := GetHTTPClient()
-	defer PutHTTPClient(client)
-
 	grip.Noticeln("downloading:", fileName)
+	recordDownloadStart()
 	resp, err := client.Do(req)
 	if err != nil {
+		recordDownloadFailure()
 		return errors.Wrap(err, "problem downloading file")
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
+		recordDownloadFailure()
 		grip.Warning(os.Remove(fileName))
 		return errors.Errorf("encountered error %d (%s) for %s", resp.StatusCode, resp.Status, url)
 	}
 
-	n, err := io.Copy(output, resp.Body)
+	if err = preallocate(output, 0, resp.ContentLength); err != nil {
+		recordDownloadFailure()
+		grip.Warning(os.Remove(fileName))
+		return errors.Wrapf(err, "problem downloading %s", url)
+	}
+
+	w := newProgressWriter(output, progress, DownloadProgress{URL: url, FileName: fileName, Total: resp.ContentLength})
+	n, err := io.Copy(w, resp.Body)
 	if err != nil {
+		recordDownloadFailure()
 		grip.Warning(os.Remove(fileName))
 		return errors.Wrapf(err, "problem writing %s to file %s", url, fileName)
 	}
+	complete(w)
 
+	recordDownloadSuccess(n)
 	grip.Debugf("%d bytes downloaded. (%s)", n, fileName)
 	return nil
 }
@@ -0,0 +1,33 @@
+package bond
+
+import "sync/atomic"
+
+// DownloadStats reports cumulative counters for all downloads
+// performed by this process using DownloadFile (and therefore
+// CacheDownload and the recall jobs).
+type DownloadStats struct {
+	Started   int64 `bson:"started" json:"started" yaml:"started"`
+	Succeeded int64 `bson:"succeeded" json:"succeeded" yaml:"succeeded"`
+	Failed    int64 `bson:"failed" json:"failed" yaml:"failed"`
+	Bytes     int64 `bson:"bytes" json:"bytes" yaml:"bytes"`
+}
+
+var downloadCounters DownloadStats
+
+// GetDownloadStats returns a snapshot of the process' download
+// counters.
+func GetDownloadStats() DownloadStats {
+	return DownloadStats{
+		Started:   atomic.LoadInt64(&downloadCounters.Started),
+		Succeeded: atomic.LoadInt64(&downloadCounters.Succeeded),
+		Failed:    atomic.LoadInt64(&downloadCounters.Failed),
+		Bytes:     atomic.LoadInt64(&downloadCounters.Bytes),
+	}
+}
+
+func recordDownloadStart()   { atomic.AddInt64(&downloadCounters.Started, 1) }
+func recordDownloadFailure() { atomic.AddInt64(&downloadCounters.Failed, 1) }
+func recordDownloadSuccess(n int64) {
+	atomic.AddInt64(&downloadCounters.Succeeded, 1)
+	atomic.AddInt64(&downloadCounters.Bytes, n)
+}
@@ -0,0 +1,194 @@
+package bond
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+// InstallMethod determines how Install places the files of a build
+// in the destination.
+type InstallMethod string
+
+// The install methods. Hardlink, the default, shares the storage of
+// the files with the catalog, and falls back to copying files when
+// the destination is on another file system.
+const (
+	Hardlink InstallMethod = "hardlink"
+	Copy     InstallMethod = "copy"
+	Symlink  InstallMethod = "symlink"
+)
+
+// InstallOptions control the installation of a build from the
+// catalog.
+type InstallOptions struct {
+	// Link is the method of installing files, and defaults to
+	// Hardlink.
+	Link InstallMethod `bson:"link" json:"link" yaml:"link"`
+	// Build selects the build of the version to install. If it's
+	// empty, the catalog must have exactly one build of the
+	// version.
+	Build BuildOptions `bson:"build" json:"build" yaml:"build"`
+	// BinariesOnly installs only the contents of the build's bin
+	// directory, directly into the destination, rather than the
+	// build's whole tree.
+	BinariesOnly bool `bson:"binaries_only" json:"binaries_only" yaml:"binaries_only"`
+	// Overwrite replaces existing files in the destination.
+	Overwrite bool `bson:"overwrite" json:"overwrite" yaml:"overwrite"`
+}
+
+// Validate checks that the install method is known.
+func (opts InstallOptions) Validate() error {
+	switch opts.Link {
+	case "", Hardlink, Copy, Symlink:
+		return nil
+	default:
+		return errors.Errorf("'%s' is not a valid install method", opts.Link)
+	}
+}
+
+// Install places the files of a build of the version in the
+// destination directory, without extracting the build's archive
+// again.
+func (c *BuildCatalog) Install(version, destDir string, opts InstallOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if opts.Link == "" {
+		opts.Link = Hardlink
+	}
+
+	source, err := c.find(version, opts.Build)
+	if err != nil {
+		return err
+	}
+	if opts.BinariesOnly {
+		source = filepath.Join(source, "bin")
+	}
+
+	if err = os.MkdirAll(destDir, 0755); err != nil {
+		return errors.Wrapf(err, "problem creating %s", destDir)
+	}
+
+	catcher := grip.NewBasicCatcher()
+	err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destDir, rel)
+
+		if info.IsDir() {
+			return errors.Wrapf(os.MkdirAll(target, 0755), "problem creating %s", target)
+		}
+
+		// the verification and provenance records describe
+		// the catalog's copy, not the installation
+		if rel == VerificationFileName || rel == ProvenanceFileName {
+			return nil
+		}
+
+		catcher.Add(installFile(path, target, info, opts))
+		return nil
+	})
+	catcher.Add(errors.Wrapf(err, "problem installing %s", source))
+
+	return errors.Wrapf(catcher.Resolve(), "problem installing %s into %s", version, destDir)
+}
+
+// find returns the path of the build of the version with the options,
+// or the only build of the version if the options are empty.
+func (c *BuildCatalog) find(version string, build BuildOptions) (string, error) {
+	if build != (BuildOptions{}) {
+		return c.Get(version, string(build.Edition), build.Target, string(build.Arch), build.Debug)
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	matches := []string{}
+	for info, path := range c.table {
+		if info.Version == version {
+			matches = append(matches, path)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", errors.Wrapf(ErrVersionNotFound, "could not find version %s in %s", version, c.Path)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", errors.Errorf("catalog has %d builds of %s, specify the build to install", len(matches), version)
+	}
+}
+
+func installFile(source, target string, info os.FileInfo, opts InstallOptions) error {
+	if _, err := os.Lstat(target); err == nil {
+		if !opts.Overwrite {
+			return errors.Errorf("%s exists", target)
+		}
+		if err = os.Remove(target); err != nil {
+			return errors.Wrapf(err, "problem replacing %s", target)
+		}
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		// links within a build are relative, so recreate them
+		link, err := os.Readlink(source)
+		if err != nil {
+			return errors.Wrapf(err, "problem reading link %s", source)
+		}
+		return errors.Wrapf(os.Symlink(link, target), "problem creating link %s", target)
+	}
+
+	switch opts.Link {
+	case Symlink:
+		abs, err := filepath.Abs(source)
+		if err != nil {
+			return errors.Wrapf(err, "problem resolving %s", source)
+		}
+		return errors.Wrapf(os.Symlink(abs, target), "problem linking %s", target)
+	case Hardlink:
+		err := os.Link(source, target)
+		if err == nil {
+			return nil
+		}
+
+		grip.Debug(message.WrapError(err, message.Fields{
+			"message": "could not hard link, copying instead",
+			"source":  source,
+			"target":  target,
+		}))
+	}
+
+	return copyFile(source, target, info.Mode())
+}
+
+func copyFile(source, target string, mode os.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return errors.Wrapf(err, "problem opening %s", source)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode.Perm())
+	if err != nil {
+		return errors.Wrapf(err, "problem creating %s", target)
+	}
+
+	_, err = io.Copy(out, in)
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(errors.Wrapf(err, "problem copying %s", source))
+	catcher.Add(errors.Wrapf(out.Close(), "problem closing %s", target))
+
+	return catcher.Resolve()
+}
@@ -0,0 +1,71 @@
+package bond
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCatalogInstall(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-install")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+	cache := filepath.Join(dir, "cache")
+
+	catalog := &BuildCatalog{Path: cache, table: map[BuildInfo]string{}, verified: map[string]Verification{}}
+	build := writeTestBuild(t, cache, "mongodb-linux-x86_64-ubuntu1604-3.4.0")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(build, "README"), []byte("readme"), 0644))
+	require.NoError(t, os.Symlink("bin/mongod", filepath.Join(build, "current")))
+	require.NoError(t, catalog.Add(build))
+
+	mongod := filepath.Join(build, "bin", "mongod")
+	source, err := os.Stat(mongod)
+	require.NoError(t, err)
+
+	for _, method := range []InstallMethod{"", Hardlink, Copy, Symlink} {
+		dest := filepath.Join(dir, "dest-"+string(method))
+		require.NoError(t, catalog.Install("3.4.0", dest, InstallOptions{Link: method}), method)
+
+		data, err := ioutil.ReadFile(filepath.Join(dest, "current"))
+		require.NoError(t, err)
+		assert.Equal("binary", string(data))
+
+		installed, err := os.Lstat(filepath.Join(dest, "bin", "mongod"))
+		require.NoError(t, err)
+		switch method {
+		case "", Hardlink:
+			assert.True(os.SameFile(source, installed), method)
+		case Copy:
+			assert.False(os.SameFile(source, installed))
+			assert.Equal(source.Mode(), installed.Mode())
+		case Symlink:
+			assert.True(installed.Mode()&os.ModeSymlink != 0)
+		}
+	}
+
+	dest := filepath.Join(dir, "bin")
+	require.NoError(t, catalog.Install("3.4.0", dest, InstallOptions{
+		Link:         Copy,
+		BinariesOnly: true,
+		Build:        BuildOptions{Target: "ubuntu1604", Arch: AMD64, Edition: CommunityTargeted},
+	}))
+	files, err := ioutil.ReadDir(dest)
+	require.NoError(t, err)
+	assert.Len(files, 2)
+
+	assert.Error(catalog.Install("3.4.0", dest, InstallOptions{BinariesOnly: true}))
+	assert.NoError(catalog.Install("3.4.0", dest, InstallOptions{BinariesOnly: true, Overwrite: true}))
+	assert.Error(catalog.Install("3.4.0", dest, InstallOptions{Link: "rsync"}))
+	assert.True(Is(catalog.Install("3.6.0", dest, InstallOptions{}), ErrVersionNotFound))
+
+	require.NoError(t, catalog.Add(writeTestBuild(t, cache, "mongodb-linux-x86_64-enterprise-ubuntu1604-3.4.0")))
+	assert.Error(catalog.Install("3.4.0", filepath.Join(dir, "ambiguous"), InstallOptions{}))
+}
@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"context"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/dependency"
+)
+
+// LegacyJob describes jobs written against the pre-context amboy.Job
+// interface, whose Run method takes no arguments. amboy itself now
+// passes a context to Job.Run, so that cancellation and deadlines
+// reach job bodies; use FromLegacy to run older jobs in current
+// queues while they're ported.
+type LegacyJob interface {
+	ID() string
+	Run()
+	Type() amboy.JobType
+	Dependency() dependency.Manager
+	SetDependency(dependency.Manager)
+	Status() amboy.JobStatusInfo
+	SetStatus(amboy.JobStatusInfo)
+	TimeInfo() amboy.JobTimeInfo
+	UpdateTimeInfo(amboy.JobTimeInfo)
+	Priority() int
+	SetPriority(int)
+	AddError(error)
+	Error() error
+	Lock(string) error
+	Unlock(string)
+}
+
+// FromLegacy adapts a LegacyJob to the amboy.Job interface. Legacy
+// jobs cannot observe the context, so an adapted job only checks for
+// cancellation before it starts, and records the context's error
+// rather than running if the context is already done.
+//
+// Adapted jobs are intended for local queues. Remote queues serialize
+// jobs and resolve them through the registry, which only produces
+// amboy.Job values, so legacy jobs must be ported before they can be
+// stored in a remote queue.
+func FromLegacy(j LegacyJob) amboy.Job { return &legacyJob{LegacyJob: j} }
+
+type legacyJob struct {
+	LegacyJob
+}
+
+func (j *legacyJob) Run(ctx context.Context) {
+	if err := ctx.Err(); err != nil {
+		j.AddError(err)
+		stat := j.Status()
+		stat.Completed = true
+		j.SetStatus(stat)
+		return
+	}
+
+	j.LegacyJob.Run()
+}
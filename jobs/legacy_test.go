@@ -0,0 +1,54 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type oldJob struct {
+	*job.Base
+	ran bool
+}
+
+func newOldJob(id string) *oldJob {
+	j := &oldJob{Base: &job.Base{JobType: amboy.JobType{Name: "old", Version: 0}}}
+	j.SetID(id)
+	return j
+}
+
+func (j *oldJob) Run() {
+	defer j.MarkComplete()
+	j.ran = true
+}
+
+func TestFromLegacy(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q := queue.NewLocalLimitedSize(1, 16)
+	require.NoError(t, q.Start(ctx))
+
+	old := newOldJob("legacy")
+	out, err := RunJob(ctx, q, FromLegacy(old))
+	require.NoError(t, err)
+	assert.True(out.Status().Completed)
+	assert.True(old.ran)
+
+	// canceled jobs don't run
+	canceled, cancelJob := context.WithCancel(ctx)
+	cancelJob()
+	old = newOldJob("canceled")
+	j := FromLegacy(old)
+	j.Run(canceled)
+	assert.False(old.ran)
+	assert.True(j.Status().Completed)
+	assert.Error(j.Error())
+}
@@ -0,0 +1,62 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// Populate adds all jobs from the channel to the queue, using up to
+// the specified number of concurrent Put operations (at least one),
+// and returns an error that aggregates all failed Puts. Populate
+// consumes the entire channel unless the context is canceled, so
+// producers never block on a failed submission.
+func Populate(ctx context.Context, q amboy.Queue, jobs <-chan amboy.Job, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	catcher := grip.NewCatcher()
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j, ok := <-jobs:
+					if !ok {
+						return
+					}
+
+					catcher.Add(errors.Wrapf(q.Put(ctx, j), "problem adding job '%s'", j.ID()))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		catcher.Add(errors.Wrap(ctx.Err(), "stopped adding jobs"))
+	}
+
+	return catcher.Resolve()
+}
+
+// PopulateSlice adds the jobs to the queue, with the same semantics
+// as Populate.
+func PopulateSlice(ctx context.Context, q amboy.Queue, jobs []amboy.Job, concurrency int) error {
+	source := make(chan amboy.Job, len(jobs))
+	for _, j := range jobs {
+		source <- j
+	}
+	close(source)
+
+	return Populate(ctx, q, source, concurrency)
+}
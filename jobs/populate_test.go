@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeJobs(prefix string, n int) []amboy.Job {
+	out := make([]amboy.Job, n)
+	for i := range out {
+		j := job.NewShellJob("true", "")
+		j.SetID(fmt.Sprintf("%s-%d", prefix, i))
+		out[i] = j
+	}
+	return out
+}
+
+func TestPopulate(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q := queue.NewLocalLimitedSize(4, 512)
+	require.NoError(t, q.Start(ctx))
+
+	require.NoError(t, PopulateSlice(ctx, q, makeJobs("slice", 100), 8))
+
+	source := make(chan amboy.Job)
+	go func() {
+		for _, j := range makeJobs("chan", 100) {
+			source <- j
+		}
+		close(source)
+	}()
+	require.NoError(t, Populate(ctx, q, source, 0))
+
+	require.NoError(t, Wait(ctx, q, Backoff{}))
+	assert.Equal(200, q.Stats(ctx).Total)
+
+	// duplicates are reported, but don't stop the other jobs
+	err := PopulateSlice(ctx, q, append(makeJobs("slice", 2), makeJobs("new", 3)...), 2)
+	require.Error(t, err)
+	assert.Contains(err.Error(), "slice-0")
+	assert.Contains(err.Error(), "slice-1")
+	assert.Equal(203, q.Stats(ctx).Total)
+
+	canceled, cancelPopulate := context.WithCancel(ctx)
+	cancelPopulate()
+	assert.Error(PopulateSlice(canceled, q, makeJobs("canceled", 1), 1))
+}
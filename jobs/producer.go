@@ -0,0 +1,191 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/clock"
+)
+
+// ProducerOptions configure the backpressure of a Producer.
+type ProducerOptions struct {
+	// High is the number of pending jobs at which the producer
+	// pauses submissions.
+	High int `bson:"high" json:"high" yaml:"high"`
+	// Low is the number of pending jobs at which a paused producer
+	// resumes, and defaults to half of High.
+	Low int `bson:"low" json:"low" yaml:"low"`
+	// Interval is the longest time between checks of the queue's
+	// stats while the producer is not paused, and defaults to one
+	// second. Between checks, the producer adds its own
+	// submissions to the pending jobs of the last check.
+	Interval time.Duration `bson:"interval" json:"interval" yaml:"interval"`
+	// Backoff is the polling interval of the queue's stats while
+	// the producer is paused; a zero Backoff uses DefaultBackoff.
+	Backoff Backoff `bson:"backoff" json:"backoff" yaml:"backoff"`
+}
+
+// Validate returns an error if the options are invalid, and sets
+// defaults for unspecified values.
+func (o *ProducerOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(o.High <= 0, "high threshold must be positive")
+	catcher.NewWhen(o.Low < 0, "low threshold must be 0 or positive")
+	catcher.NewWhen(o.Low >= o.High && o.High > 0, "low threshold must be less than the high threshold")
+	catcher.NewWhen(o.Interval < 0, "interval must be 0 or positive")
+	if catcher.HasErrors() {
+		return catcher.Resolve()
+	}
+
+	if o.Low == 0 {
+		o.Low = o.High / 2
+	}
+	if o.Interval == 0 {
+		o.Interval = time.Second
+	}
+
+	return nil
+}
+
+// Producer wraps a queue and applies backpressure to submissions:
+// Put blocks while the queue has High or more pending jobs, and
+// resumes once the workers have reduced them to Low, so that bulk
+// submissions don't grow the queue faster than a small pool of
+// workers can drain it. Pass a Producer to Populate to throttle a
+// bulk submission.
+//
+// Other methods pass through to the wrapped queue.
+type Producer struct {
+	amboy.Queue
+
+	opts     ProducerOptions
+	clock    clock.Clock
+	mu       sync.Mutex
+	pending  int
+	reserved int
+	draining bool
+	checked  time.Time
+	paused   int
+	pauses   int
+}
+
+// NewProducer wraps the queue, returning an error if the options are
+// not valid.
+func NewProducer(q amboy.Queue, opts ProducerOptions) (*Producer, error) {
+	if q == nil {
+		return nil, errors.New("cannot wrap a nil queue")
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid producer options")
+	}
+
+	return &Producer{Queue: q, opts: opts, clock: clock.Or(opts.Backoff.Clock)}, nil
+}
+
+// Paused reports whether any submission is waiting for the queue to
+// drain.
+func (p *Producer) Paused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.paused > 0
+}
+
+// Pauses returns the number of times that submissions have paused.
+func (p *Producer) Pauses() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.pauses
+}
+
+// Put adds the job to the wrapped queue once the queue has fewer
+// than High pending jobs, or returns an error if the context is
+// canceled first.
+func (p *Producer) Put(ctx context.Context, j amboy.Job) error {
+	if err := p.wait(ctx); err != nil {
+		return errors.Wrapf(err, "problem submitting job '%s'", j.ID())
+	}
+
+	err := p.Queue.Put(ctx, j)
+
+	p.mu.Lock()
+	p.reserved--
+	if err == nil {
+		p.pending++
+	}
+	p.mu.Unlock()
+
+	return err
+}
+
+// wait returns when the queue has fewer than High pending jobs, and
+// reserves a place for the caller's submission, so that concurrent
+// submissions that resume together don't exceed High.
+func (p *Producer) wait(ctx context.Context) error {
+	p.mu.Lock()
+	if p.load() >= p.opts.High || p.clock.Since(p.checked) >= p.opts.Interval {
+		p.check(ctx)
+	}
+	if p.reserve() {
+		p.mu.Unlock()
+		return nil
+	}
+	if p.paused == 0 {
+		p.pauses++
+		grip.Info(message.Fields{
+			"message": "pausing submissions until workers catch up",
+			"pending": p.load(),
+			"resume":  p.opts.Low,
+		})
+	}
+	p.paused++
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		p.paused--
+		p.mu.Unlock()
+	}()
+
+	return poll(ctx, p.opts.Backoff, func() (bool, error) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		p.check(ctx)
+		return p.reserve(), nil
+	})
+}
+
+// load must be called with the lock held, and returns the pending
+// jobs including submissions in progress.
+func (p *Producer) load() int { return p.pending + p.reserved }
+
+// reserve must be called with the lock held, and reserves a place for
+// a submission if the queue has room. Once the queue reaches High,
+// no submission has room until the queue drains to Low.
+func (p *Producer) reserve() bool {
+	if p.draining && p.load() <= p.opts.Low {
+		p.draining = false
+	}
+	if p.draining || p.load() >= p.opts.High {
+		p.draining = true
+		return false
+	}
+
+	p.reserved++
+	return true
+}
+
+// check must be called with the lock held, and refreshes the pending
+// jobs from the queue's stats.
+func (p *Producer) check(ctx context.Context) {
+	p.pending = p.Queue.Stats(ctx).Pending
+	p.checked = p.clock.Now()
+}
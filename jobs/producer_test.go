@@ -0,0 +1,153 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type blockingJob struct {
+	*job.Base
+	release <-chan struct{}
+}
+
+func newBlockingJob(id string, release <-chan struct{}) *blockingJob {
+	j := &blockingJob{Base: &job.Base{JobType: amboy.JobType{Name: "blocking"}}, release: release}
+	j.SetID(id)
+	j.SetDependency(nil)
+	return j
+}
+
+func (j *blockingJob) Run(ctx context.Context) {
+	defer j.MarkComplete()
+
+	select {
+	case <-ctx.Done():
+	case <-j.release:
+	}
+}
+
+func TestProducerOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&ProducerOptions{}).Validate())
+	assert.Error((&ProducerOptions{High: 4, Low: 4}).Validate())
+	assert.Error((&ProducerOptions{High: 4, Low: -1}).Validate())
+	assert.Error((&ProducerOptions{High: 4, Interval: -1}).Validate())
+
+	opts := ProducerOptions{High: 4}
+	require.NoError(t, opts.Validate())
+	assert.Equal(2, opts.Low)
+	assert.Equal(time.Second, opts.Interval)
+
+	_, err := NewProducer(nil, opts)
+	assert.Error(err)
+	_, err = NewProducer(queue.NewLocalLimitedSize(1, 16), ProducerOptions{})
+	assert.Error(err)
+}
+
+func TestProducerPausesUntilWorkersCatchUp(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q := queue.NewLocalLimitedSize(1, 64)
+	require.NoError(t, q.Start(ctx))
+	p, err := NewProducer(q, ProducerOptions{High: 4, Low: 1})
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	submissions := make([]amboy.Job, 20)
+	for i := range submissions {
+		submissions[i] = newBlockingJob(fmt.Sprintf("job-%d", i), release)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- PopulateSlice(ctx, p, submissions, 1) }()
+
+	for !p.Paused() {
+		select {
+		case <-ctx.Done():
+			require.FailNow(t, "producer did not pause")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	assert.True(q.Stats(ctx).Total < len(submissions))
+
+	close(release)
+	require.NoError(t, <-done)
+	require.NoError(t, Wait(ctx, q, Backoff{}))
+	assert.Equal(len(submissions), q.Stats(ctx).Total)
+	assert.False(p.Paused())
+	assert.True(p.Pauses() >= 1)
+
+	// a new producer checks the queue before its first submission
+	p, err = NewProducer(q, ProducerOptions{High: 4})
+	require.NoError(t, err)
+	canceled, cancelPut := context.WithCancel(ctx)
+	cancelPut()
+	held := make(chan struct{})
+	defer close(held)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, q.Put(ctx, newBlockingJob(fmt.Sprintf("held-%d", i), held)))
+	}
+	assert.Error(p.Put(canceled, newBlockingJob("canceled", held)))
+	assert.Equal(1, p.Pauses())
+}
+
+// slowPutQueue delays submissions, as remote queues do.
+type slowPutQueue struct{ amboy.Queue }
+
+func (q slowPutQueue) Put(ctx context.Context, j amboy.Job) error {
+	time.Sleep(5 * time.Millisecond)
+	return q.Queue.Put(ctx, j)
+}
+
+func TestProducerConcurrentSubmissionsRespectHigh(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q := queue.NewLocalLimitedSize(1, 128)
+	require.NoError(t, q.Start(ctx))
+	p, err := NewProducer(slowPutQueue{Queue: q}, ProducerOptions{High: 4, Low: 2, Backoff: Backoff{Initial: time.Millisecond, Max: time.Millisecond, Factor: 1}})
+	require.NoError(t, err)
+
+	release := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		require.NoError(t, p.Put(ctx, newBlockingJob(fmt.Sprintf("first-%d", i), release)))
+	}
+
+	// many submitters wait for the queue to drain
+	submissions := make([]amboy.Job, 16)
+	for i := range submissions {
+		submissions[i] = newBlockingJob(fmt.Sprintf("job-%d", i), release)
+	}
+	done := make(chan error, 1)
+	go func() { done <- PopulateSlice(ctx, p, submissions, len(submissions)) }()
+
+	time.Sleep(20 * time.Millisecond)
+	pending := q.Stats(ctx).Pending
+	require.True(t, pending <= 4, "queue reached %d pending jobs", pending)
+
+	// releasing jobs makes room for some of the waiting
+	// submissions, but never more than High
+	for released := 0; released < 4+len(submissions); released++ {
+		select {
+		case release <- struct{}{}:
+		case <-ctx.Done():
+			require.FailNow(t, "jobs did not run")
+		}
+		time.Sleep(20 * time.Millisecond)
+		pending = q.Stats(ctx).Pending
+		require.True(t, pending <= 4, "queue reached %d pending jobs", pending)
+	}
+	require.NoError(t, <-done)
+	assert.True(t, p.Pauses() >= 1)
+}
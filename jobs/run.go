@@ -0,0 +1,42 @@
+package jobs
+
+import (
+	"context"
+
+	"github.com/mongodb/amboy"
+	"github.com/pkg/errors"
+)
+
+// RunJob adds the job to the queue, which must be running, waits for
+// it to complete, and returns the completed job as stored by the
+// queue. The error reports problems adding or waiting for the
+// job, or, if the job ran, the job's own error.
+//
+// The returned job may be a different object from the submitted job
+// (e.g. for remote queues); use it rather than the original to read
+// the job's results.
+func RunJob(ctx context.Context, q amboy.Queue, j amboy.Job) (amboy.Job, error) {
+	return RunJobBackoff(ctx, q, j, Backoff{})
+}
+
+// RunJobBackoff is RunJob with a configurable polling backoff.
+func RunJobBackoff(ctx context.Context, q amboy.Queue, j amboy.Job, b Backoff) (amboy.Job, error) {
+	if !q.Started() {
+		return nil, errors.Errorf("cannot run job '%s' in a queue that is not running", j.ID())
+	}
+
+	if err := q.Put(ctx, j); err != nil {
+		return nil, errors.Wrapf(err, "problem adding job '%s'", j.ID())
+	}
+
+	if err := WaitJob(ctx, q, j.ID(), b); err != nil {
+		return nil, errors.Wrapf(err, "problem waiting for job '%s'", j.ID())
+	}
+
+	out, ok := q.Get(ctx, j.ID())
+	if !ok {
+		return nil, errors.Errorf("job '%s' was removed from the queue", j.ID())
+	}
+
+	return out, out.Error()
+}
@@ -0,0 +1,39 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunJob(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q := queue.NewLocalLimitedSize(2, 16)
+	_, err := RunJob(ctx, q, job.NewShellJob("true", ""))
+	assert.Error(err)
+	require.NoError(t, q.Start(ctx))
+
+	out, err := RunJob(ctx, q, job.NewShellJob("echo hello", ""))
+	require.NoError(t, err)
+	require.IsType(t, &job.ShellJob{}, out)
+	assert.Equal("hello", out.(*job.ShellJob).Output)
+	assert.True(out.Status().Completed)
+
+	failing := job.NewShellJob("false", "")
+	out, err = RunJob(ctx, q, failing)
+	assert.Error(err)
+	require.NotNil(t, out)
+	assert.True(out.Status().Completed)
+
+	// duplicate jobs cannot be added
+	_, err = RunJob(ctx, q, failing)
+	assert.Error(err)
+}
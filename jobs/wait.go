@@ -0,0 +1,177 @@
+/*
+Package jobs provides helpers for submitting jobs to amboy queues and
+waiting for them to complete, as alternatives to the fixed-interval
+polling helpers in the amboy package.
+
+The wait helpers poll with exponential backoff: checks start at a
+short interval, so that quick jobs return promptly, and slow down for
+long waits, which reduces load on remote queues' databases.
+*/
+package jobs
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/clock"
+)
+
+// Backoff configures the polling interval for the wait helpers. The
+// first check happens immediately; subsequent checks wait Initial,
+// then Initial*Factor, and so on up to Max. Jitter randomizes each
+// interval by up to the given fraction (between 0 and 1) to avoid
+// many waiters polling in lockstep. Clock, if set, replaces the
+// system clock (e.g. with a clock.Fake in tests).
+type Backoff struct {
+	Initial time.Duration `bson:"initial" json:"initial" yaml:"initial"`
+	Max     time.Duration `bson:"max" json:"max" yaml:"max"`
+	Factor  float64       `bson:"factor" json:"factor" yaml:"factor"`
+	Jitter  float64       `bson:"jitter" json:"jitter" yaml:"jitter"`
+	Clock   clock.Clock   `bson:"-" json:"-" yaml:"-"`
+}
+
+// DefaultBackoff returns the backoff used when the wait helpers
+// receive a zero Backoff: starting at 10 milliseconds and doubling
+// up to one second, with 10% jitter.
+func DefaultBackoff() Backoff {
+	return Backoff{
+		Initial: 10 * time.Millisecond,
+		Max:     time.Second,
+		Factor:  2,
+		Jitter:  0.1,
+	}
+}
+
+// Validate returns an error if the backoff is not valid.
+func (b Backoff) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(b.Initial <= 0, "initial interval must be positive")
+	catcher.NewWhen(b.Max < b.Initial, "maximum interval must not be less than the initial interval")
+	catcher.NewWhen(b.Factor < 1, "factor must be at least 1")
+	catcher.NewWhen(b.Jitter < 0 || b.Jitter > 1, "jitter must be between 0 and 1")
+	return catcher.Resolve()
+}
+
+// isZero reports whether the backoff has no intervals configured,
+// ignoring the clock, which may not be comparable.
+func (b Backoff) isZero() bool {
+	return b.Initial == 0 && b.Max == 0 && b.Factor == 0 && b.Jitter == 0
+}
+
+func (b Backoff) orDefault() (Backoff, error) {
+	if b.isZero() {
+		out := DefaultBackoff()
+		out.Clock = b.Clock
+		return out, nil
+	}
+
+	return b, errors.Wrap(b.Validate(), "invalid backoff")
+}
+
+// next returns the interval that follows the current interval.
+func (b Backoff) next(cur time.Duration) time.Duration {
+	if cur == 0 {
+		return b.Initial
+	}
+
+	next := time.Duration(float64(cur) * b.Factor)
+	if next > b.Max {
+		next = b.Max
+	}
+
+	return next
+}
+
+func (b Backoff) jitter(d time.Duration) time.Duration {
+	if b.Jitter == 0 {
+		return d
+	}
+
+	return d + time.Duration((rand.Float64()*2-1)*b.Jitter*float64(d))
+}
+
+// poll calls check, with backoff between calls, until it returns true
+// or an error, or the context is canceled.
+func poll(ctx context.Context, b Backoff, check func() (bool, error)) error {
+	b, err := b.orDefault()
+	if err != nil {
+		return err
+	}
+
+	timer := clock.Or(b.Clock).NewTimer(0)
+	defer timer.Stop()
+
+	var interval time.Duration
+	for {
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "stopped waiting")
+		case <-timer.C():
+			done, err := check()
+			if err != nil || done {
+				return err
+			}
+
+			interval = b.next(interval)
+			timer.Reset(b.jitter(interval))
+		}
+	}
+}
+
+// Wait blocks until all jobs in the queue are complete (with the
+// same semantics as amboy.Wait), or the context is canceled. A zero
+// Backoff uses DefaultBackoff.
+func Wait(ctx context.Context, q amboy.Queue, b Backoff) error {
+	return poll(ctx, b, func() (bool, error) {
+		return q.Stats(ctx).IsComplete(), nil
+	})
+}
+
+// WaitJob blocks until the job with the specified ID is complete, and
+// returns an error if the job does not exist or the context is
+// canceled. The error does not reflect the job's own error.
+func WaitJob(ctx context.Context, q amboy.Queue, id string, b Backoff) error {
+	_, err := WaitN(ctx, q, []string{id}, 1, b)
+	return err
+}
+
+// WaitN blocks until at least n of the jobs with the specified IDs
+// are complete, and returns the IDs of the completed jobs. WaitN
+// returns an error if any of the jobs does not exist, if n is more
+// than the number of jobs, or if the context is canceled before
+// enough jobs complete; in the last case, it also returns the IDs of
+// the jobs that completed.
+func WaitN(ctx context.Context, q amboy.Queue, ids []string, n int, b Backoff) ([]string, error) {
+	if n < 0 || n > len(ids) {
+		return nil, errors.Errorf("cannot wait for %d of %d jobs", n, len(ids))
+	}
+
+	done := make(map[string]struct{}, len(ids))
+	completed := []string{}
+
+	err := poll(ctx, b, func() (bool, error) {
+		for _, id := range ids {
+			if _, ok := done[id]; ok {
+				continue
+			}
+
+			j, ok := q.Get(ctx, id)
+			if !ok {
+				return false, errors.Errorf("job '%s' does not exist", id)
+			}
+
+			if j.Status().Completed {
+				done[id] = struct{}{}
+				completed = append(completed, id)
+			}
+		}
+
+		return len(completed) >= n, nil
+	})
+
+	return completed, err
+}
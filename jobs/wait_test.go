@@ -0,0 +1,130 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/clock"
+)
+
+func TestBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	b := DefaultBackoff()
+	assert.NoError(b.Validate())
+	assert.Equal(b.Initial, b.next(0))
+	assert.Equal(2*b.Initial, b.next(b.Initial))
+	assert.Equal(b.Max, b.next(b.Max))
+
+	for i := 0; i < 100; i++ {
+		d := b.jitter(time.Second)
+		assert.True(d >= 900*time.Millisecond && d <= 1100*time.Millisecond)
+	}
+
+	assert.Error(Backoff{Max: time.Second, Factor: 2}.Validate())
+	assert.Error(Backoff{Initial: time.Second, Max: time.Millisecond, Factor: 2}.Validate())
+	assert.Error(Backoff{Initial: time.Second, Max: time.Second, Factor: 0.5}.Validate())
+	assert.Error(Backoff{Initial: time.Second, Max: time.Second, Factor: 2, Jitter: 2}.Validate())
+
+	got, err := Backoff{}.orDefault()
+	assert.NoError(err)
+	assert.Equal(DefaultBackoff(), got)
+}
+
+func TestWaitHelpers(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q := queue.NewLocalLimitedSize(2, 16)
+	require.NoError(t, q.Start(ctx))
+
+	fast := job.NewShellJob("true", "")
+	fast.SetID("fast")
+	slow := job.NewShellJob("sleep 10", "")
+	slow.SetID("slow")
+	require.NoError(t, q.Put(ctx, fast))
+	require.NoError(t, q.Put(ctx, slow))
+
+	require.NoError(t, WaitJob(ctx, q, "fast", Backoff{}))
+
+	done, err := WaitN(ctx, q, []string{"fast", "slow"}, 1, Backoff{})
+	require.NoError(t, err)
+	assert.Equal([]string{"fast"}, done)
+
+	_, err = WaitN(ctx, q, []string{"fast"}, 2, Backoff{})
+	assert.Error(err)
+	assert.Error(WaitJob(ctx, q, "does-not-exist", Backoff{}))
+	assert.Error(WaitJob(ctx, q, "fast", Backoff{Initial: -1}))
+
+	short, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	done, err = WaitN(short, q, []string{"fast", "slow"}, 2, Backoff{})
+	assert.Error(err)
+	assert.Equal([]string{"fast"}, done)
+
+	short, cancelShort = context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	assert.Error(Wait(short, q, DefaultBackoff()))
+}
+
+func TestPollUsesClock(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c := clock.NewFake(time.Now())
+	b := Backoff{Initial: time.Hour, Max: time.Hour, Factor: 1, Clock: c}
+
+	checks := make(chan struct{}, 4)
+	done := make(chan error)
+	go func() {
+		count := 0
+		done <- poll(ctx, b, func() (bool, error) {
+			count++
+			checks <- struct{}{}
+			return count == 2, nil
+		})
+	}()
+
+	// the first check is immediate, the second waits for the
+	// clock to advance by the initial interval
+	<-checks
+	for c.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c.Advance(time.Hour)
+	select {
+	case err := <-done:
+		assert.NoError(err)
+	case <-ctx.Done():
+		t.Fatal("poll did not return")
+	}
+
+	got, err := Backoff{Clock: c}.orDefault()
+	assert.NoError(err)
+	assert.Equal(DefaultBackoff().Initial, got.Initial)
+	assert.Equal(c, got.Clock)
+}
+
+// sliceClock is a clock value that is not comparable.
+type sliceClock struct {
+	clock.Clock
+	calls []string
+}
+
+func TestBackoffWithNonComparableClock(t *testing.T) {
+	c := sliceClock{Clock: clock.Real()}
+	got, err := Backoff{Clock: c}.orDefault()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultBackoff().Initial, got.Initial)
+
+	got, err = Backoff{Initial: time.Millisecond, Max: time.Second, Factor: 2, Clock: c}.orDefault()
+	require.NoError(t, err)
+	assert.Equal(t, time.Millisecond, got.Initial)
+}
@@ -0,0 +1,112 @@
+package bond
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Lifecycle describes the support window of a release series.
+type Lifecycle struct {
+	Series    string    `bson:"series" json:"series" yaml:"series"`
+	EndOfLife time.Time `bson:"end_of_life" json:"end_of_life" yaml:"end_of_life"`
+}
+
+// IsEOLAt reports whether the series is past its end of life at the
+// time.
+func (l Lifecycle) IsEOLAt(t time.Time) bool { return !t.Before(l.EndOfLife) }
+
+func endOfLife(year int, month time.Month) time.Time {
+	// series are supported through the last day of the month
+	return time.Date(year, month+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// The published end of life dates of the MongoDB release series. Use
+// LoadLifecycles to add later series, or to correct these.
+var (
+	lifecycleMutex sync.RWMutex
+	lifecycles     = map[string]Lifecycle{
+		"2.4": {Series: "2.4", EndOfLife: endOfLife(2016, time.March)},
+		"2.6": {Series: "2.6", EndOfLife: endOfLife(2016, time.October)},
+		"3.0": {Series: "3.0", EndOfLife: endOfLife(2018, time.February)},
+		"3.2": {Series: "3.2", EndOfLife: endOfLife(2018, time.September)},
+		"3.4": {Series: "3.4", EndOfLife: endOfLife(2020, time.January)},
+		"3.6": {Series: "3.6", EndOfLife: endOfLife(2021, time.April)},
+		"4.0": {Series: "4.0", EndOfLife: endOfLife(2022, time.April)},
+		"4.2": {Series: "4.2", EndOfLife: endOfLife(2023, time.April)},
+		"4.4": {Series: "4.4", EndOfLife: endOfLife(2024, time.February)},
+		"5.0": {Series: "5.0", EndOfLife: endOfLife(2024, time.October)},
+		"6.0": {Series: "6.0", EndOfLife: endOfLife(2025, time.July)},
+		"7.0": {Series: "7.0", EndOfLife: endOfLife(2027, time.August)},
+		"8.0": {Series: "8.0", EndOfLife: endOfLife(2029, time.October)},
+	}
+)
+
+// GetLifecycle returns the lifecycle of the series of a release
+// (e.g. 4.0 or 4.0.3). The second value is false if the series has
+// no lifecycle metadata, as for development series.
+func GetLifecycle(release string) (Lifecycle, bool) {
+	lifecycleMutex.RLock()
+	defer lifecycleMutex.RUnlock()
+
+	l, ok := lifecycles[releaseSeries(release)]
+	return l, ok
+}
+
+// LoadLifecycles adds the lifecycles, as a JSON array, to the known
+// lifecycles, replacing the metadata of any series that are already
+// known.
+func LoadLifecycles(data []byte) error {
+	update := []Lifecycle{}
+	if err := json.Unmarshal(data, &update); err != nil {
+		return errors.Wrap(err, "problem converting lifecycle data from json")
+	}
+
+	for _, l := range update {
+		if l.Series == "" || l.EndOfLife.IsZero() {
+			return errors.Errorf("lifecycle '%s' must specify a series and end of life", l.Series)
+		}
+	}
+
+	lifecycleMutex.Lock()
+	defer lifecycleMutex.Unlock()
+	for _, l := range update {
+		lifecycles[releaseSeries(l.Series)] = l
+	}
+
+	return nil
+}
+
+// releaseSeries returns the major and minor components of a release,
+// without relying on them being single digits.
+func releaseSeries(release string) string {
+	release = strings.TrimPrefix(release, "v")
+	parts := strings.SplitN(release, ".", 3)
+	if len(parts) < 2 {
+		return release
+	}
+
+	minor := parts[1]
+	if idx := strings.IndexAny(minor, "-~"); idx >= 0 {
+		minor = minor[:idx]
+	}
+
+	return parts[0] + "." + minor
+}
+
+// SupportedUntil returns the end of life of the version's series.
+// The second value is false if the series has no lifecycle metadata.
+func (version *ArtifactVersion) SupportedUntil() (time.Time, bool) {
+	l, ok := GetLifecycle(version.Version)
+	return l.EndOfLife, ok
+}
+
+// IsEOL reports whether the version's series is past its end of
+// life. Versions in series without lifecycle metadata are not EOL.
+func (version *ArtifactVersion) IsEOL() bool {
+	l, ok := GetLifecycle(version.Version)
+	return ok && l.IsEOLAt(time.Now())
+}
@@ -0,0 +1,59 @@
+package bond
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleaseSeries(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("4.0", releaseSeries("4.0"))
+	assert.Equal("4.0", releaseSeries("v4.0.3"))
+	assert.Equal("4.0", releaseSeries("4.0-latest"))
+	assert.Equal("4.0", releaseSeries("4.0.0-rc1"))
+	assert.Equal("10.2", releaseSeries("10.2.1"))
+	assert.Equal("latest", releaseSeries("latest"))
+}
+
+func TestLifecycle(t *testing.T) {
+	assert := assert.New(t)
+
+	l, ok := GetLifecycle("4.0.3")
+	require.True(t, ok)
+	assert.Equal("4.0", l.Series)
+	assert.False(l.IsEOLAt(time.Date(2022, time.April, 30, 23, 0, 0, 0, time.UTC)))
+	assert.True(l.IsEOLAt(time.Date(2022, time.May, 1, 0, 0, 0, 0, time.UTC)))
+
+	_, ok = GetLifecycle("4.1.1")
+	assert.False(ok)
+
+	old := &ArtifactVersion{Version: "3.2.22"}
+	assert.True(old.IsEOL())
+	until, ok := old.SupportedUntil()
+	assert.True(ok)
+	assert.Equal(time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC), until)
+
+	dev := &ArtifactVersion{Version: "4.3.1"}
+	assert.False(dev.IsEOL())
+	_, ok = dev.SupportedUntil()
+	assert.False(ok)
+}
+
+func TestLoadLifecycles(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(LoadLifecycles([]byte("{")))
+	assert.Error(LoadLifecycles([]byte(`[{"series": "99.0"}]`)))
+	_, ok := GetLifecycle("99.0")
+	assert.False(ok)
+
+	require.NoError(t, LoadLifecycles([]byte(`[{"series": "99.0", "end_of_life": "2099-01-01T00:00:00Z"}]`)))
+	l, ok := GetLifecycle("99.0.1")
+	assert.True(ok)
+	assert.False((&ArtifactVersion{Version: "99.0.1"}).IsEOL())
+	assert.Equal(2099, l.EndOfLife.Year())
+}
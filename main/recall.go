@@ -0,0 +1,1777 @@
+// Command recall provides operator tools for bond and recall. The
+// "queue" command manages the jobs in an amboy queue, either through
+// a bond REST service or directly through the queue's MongoDB driver:
+//
+//	recall queue -service http://localhost:8080 status
+//	recall queue -mongodb-uri mongodb://localhost:27017 -db amboy -name downloads list -status failed
+//
+// With direct access to the driver, "replay" runs a copy of a stored
+// job in the local process, and reports its result and how the local
+// environment differs from the worker's that last ran it:
+//
+//	recall queue -mongodb-uri mongodb://localhost:27017 -db amboy -name downloads replay <id>
+//
+// The "download" command downloads builds into a cache directory,
+// either by version or series, or for every release in a span of
+// versions:
+//
+//	recall download -target ubuntu1804 4.0 4.2.1
+//	recall download -target ubuntu1804 -from 4.4.0 -to 4.4.29
+//
+// The commands that download builds run them through a queue, whose
+// concurrency and rate are configurable, and which can be stored in
+// MongoDB so that an interrupted download resumes on the next run:
+//
+//	recall download -workers 8 -rate-limit 250ms 4.4 5.0 6.0
+//	recall fetch -f manifest.yaml -queue-driver mongodb://localhost:27017
+//
+// Failed downloads are retried only with a retry budget, which limits
+// the retries of all of a run's downloads, so that on a degraded
+// network the run fails once the budget is spent:
+//
+//	recall download -retries 20 -retry-time 5m 6.0 7.0
+//
+// With a shared cache, which defaults to the BOND_SHARED_CACHE
+// environment variable, they download archives from a team's cache
+// server, and only from the download servers when it misses:
+//
+//	recall download -shared-cache http://cache.example.net:8080 7.0
+//
+// They download from a mirror of the download servers with -mirror,
+// and from a mirror for a class of artifacts (the feed, server builds,
+// debug symbols, tools, or shells) with -class-mirror, where an empty
+// URL downloads the class from the download servers:
+//
+//	recall download -mirror https://mirror.internal/mongodb -class-mirror debug= 7.0
+//
+// With several mirrors, such as a mirror in each region, they probe
+// the mirrors' latency and download from the nearest mirror that
+// works, trying the others when a download fails:
+//
+//	recall download -mirror https://us.mirror.internal/mongodb -mirror https://eu.mirror.internal/mongodb 7.0
+//
+// On hosts whose disks are shared with other processes, they limit
+// the write throughput of all of their extractions together, in MiB
+// per second, and flush extracted files to disk as they go:
+//
+//	recall download -workers 4 -extract-rate 50 -extract-sync file 6.0 7.0
+//
+// With -progress, they print the progress of each download, and on
+// hosts with little memory, -low-memory-feed decodes the feed
+// incrementally from its file rather than reading it into memory.
+//
+// With -generic-linux-fallback, releases that have no community build
+// for the target are downloaded as the generic linux build for the
+// architecture, where there is one, and the substitution is recorded
+// in the build's provenance:
+//
+//	recall download -target ubuntu2204 -edition targeted -generic-linux-fallback 4.0.28
+//
+// Submitters that share a persistent queue tag their downloads, and
+// -quota limits the pending and running downloads of a tag, in the
+// form tag=pending:running:
+//
+//	recall download -queue-driver mongodb://queue.internal -tag ci -quota ci=200:4 7.0
+//
+// Workers only run the downloads whose required capabilities (-require,
+// as key=value or a key alone) they have: their host's os and arch,
+// and any that -capability adds. With a persistent queue, the other
+// downloads are left for the workers of other hosts:
+//
+//	recall download -queue-driver mongodb://queue.internal -require os=linux -require has-docker 7.0
+//
+// Workers of queues that run downloads from untrusted submitters limit
+// the hosts that the downloads may request with -allowed-host:
+//
+//	recall download -queue-driver mongodb://queue.internal -allowed-host fastdl.mongodb.org -allowed-host "*.example.net" 7.0
+//
+// Organizations that normalize archives before their consumers use
+// them run commands on each downloaded, verified archive with
+// -post-process, such as scripts that strip binaries or re-compress
+// the archive, and write a metadata file next to each archive with
+// -write-metadata. The archives are processed by jobs in the queue
+// once the downloads complete, and are not verified again:
+//
+//	recall download -post-process "/usr/local/bin/strip-archive --keep-debug" -write-metadata 7.0
+//
+// Agents of a fleet that each serve their cache fetch archives from
+// each other with -peer (experimental), before the shared cache and
+// the download servers, and verify them against the peers' manifests:
+//
+//	recall download -peer http://agent-2:8080 -peer http://agent-3:8080 7.0
+//
+// With -shared-cache-upload, they also upload the archives that they
+// download and verify, so the next machine finds them in the cache.
+// The "serve-cache" command runs a shared cache server for a cache
+// directory; its token defaults to the BOND_SHARED_CACHE_TOKEN
+// environment variable:
+//
+//	recall serve-cache -path build -addr :8080 -allow-uploads
+//
+// Each download is recorded in the cache directory, and the "history"
+// command shows the past runs:
+//
+//	recall history -n 5 -failed
+//
+// The "doctor" command checks the network, the cache directory, and
+// partial downloads, and suggests fixes for the problems it finds:
+//
+//	recall doctor -path build -mirror https://mirror.example.net/mongodb
+//
+// The "upgrade-path" command downloads the newest release of each
+// series that an upgrade between two series passes through:
+//
+//	recall upgrade-path -target ubuntu2004 4.2 6.0
+//
+// The "matrix" command resolves the current release of series for
+// targets, as a CI matrix with cache keys:
+//
+//	recall matrix -series 6.0,7.0 -targets ubuntu2204,rhel90 -format github
+//
+// Releases are versions or version specifiers: "latest" and "rc" (the
+// newest release and release candidate), a series with a -stable, -rc,
+// or -latest suffix (its newest release, newest release candidate, or
+// nightly build), or a version range. The "resolve" command prints the
+// builds that specifiers resolve to, without downloading them:
+//
+//	recall resolve -target ubuntu2204 latest 7.0-rc v7.0-latest-nightly ">=5.0 <6.0"
+//
+// The "stats" command reports the disk usage of a cache, its hit rate
+// since the last garbage collection, and its quarantined files:
+//
+//	recall stats -path build
+//
+// The "fetch" command downloads the builds of a manifest, a JSON or
+// YAML list of versions, constraints, and build options, and fails if
+// any of its builds cannot be downloaded:
+//
+//	recall fetch -f manifest.yaml
+//
+// The "provision-cluster" command downloads the builds of a test
+// cluster's topology, a JSON or YAML file of the versions of its
+// shards, config servers, and routers, and prints the binary of each
+// node as JSON:
+//
+//	recall provision-cluster -f topology.yaml > nodes.json
+//
+// The "toolchain" command downloads a release of the server with the
+// database tools, mongosh, and, for enterprise builds, the crypt_shared
+// library, each at its newest version or at a version pinned with
+// -component-version:
+//
+//	recall toolchain -edition enterprise -component-version database-tools=100.9 -component crypt_shared 7.0.2
+//
+// The "checksum" command prints the published and actual checksums of
+// the archives of a cached version, and the "compare" command shows
+// the differences between the binaries of two cached builds:
+//
+//	recall checksum -path build 7.0.2
+//	recall compare -target ubuntu2204 6.0.9 7.0.2
+//
+// Each download records a provenance document, an in-toto statement of
+// the archive's source URL, checksums, download times, and verifier
+// results, in its build directory. The "provenance" command prints the
+// documents of a cache's builds for auditing, and with -missing fails
+// if any build has none:
+//
+//	recall provenance -path build -missing
+//
+// The "self-update" command replaces recall with the newest release
+// from a release endpoint, after verifying its signature and checksum.
+// Updating without a public key requires -insecure, which skips the
+// signature. The endpoint and key default to the
+// RECALL_UPDATE_ENDPOINT and RECALL_UPDATE_PUBLIC_KEY environment
+// variables, so that a fleet of machines can share them:
+//
+//	recall self-update -endpoint https://releases.example.net/recall.json -check
+//
+// The "env" command prints the shell commands that put the binaries of
+// the newest cached build of a release or series first on the PATH:
+//
+//	eval "$(recall env 7.0)"
+//
+// The "sync-cache" command reconciles a cache with another machine's,
+// copying the archives that each is missing from the other, from a
+// mounted directory or a base URL. For a URL, the remote cache's
+// manifest is a file that the other machine writes with
+// -write-manifest:
+//
+//	recall sync-cache -path build -write-manifest lab.json
+//	recall sync-cache -path build -remote-manifest lab.json -dry-run https://lab.example.net/build
+//	recall sync-cache -path build -prefer local /mnt/lab/build
+//
+// For very large caches, -verify-sample fully verifies only a fraction
+// of the new archives (and every changed archive), checks the rest by
+// size, and, with -verify-service, submits a job that verifies the
+// rest to a bond queue service that shares the cache directory:
+//
+//	recall sync-cache -path build -verify-sample 0.05 -verify-service http://localhost:8080 /mnt/lab/build
+//
+// The "daemon" command runs the workers of a queue until it's
+// interrupted, refreshes the cache's feed, and, with -prune, collects
+// the cache's garbage periodically. Several daemons can share a
+// persistent queue for availability: they elect a leader, and only the
+// leader schedules the refreshes and collections. When the leader
+// stops, another daemon takes over once the leader's term, -leader-ttl,
+// expires:
+//
+//	recall daemon -path /mnt/shared/build -queue-driver mongodb://queue.internal -prune 24h
+//
+// With -notify, the commands that run a queue send notifications of
+// its jobs, of the releases that appear in the daemon's refreshed
+// feed, and of the releases that they cache, through Slack, email, or
+// webhooks, to the senders of the rules that match them:
+//
+//	recall daemon -path /mnt/shared/build -notify notify.yaml
+//
+// where notify.yaml notifies #builds when a release candidate appears
+// and is cached:
+//
+//	senders:
+//	  - name: builds
+//	    type: slack
+//	    slack:
+//	      webhook_url: https://hooks.slack.com/services/T000/B000/XXXX
+//	      channel: '#builds'
+//	rules:
+//	  - events: [release-available, release-cached]
+//	    versions: '^8\.0\.0-rc0$'
+//	    senders: [builds]
+//
+// The "export-cache" command packages cached builds as a container
+// image layer, so that CI systems bake them into their builder images,
+// and prints the Dockerfile instructions that add the layer. With
+// -format oci, it writes an OCI image layout, which tools such as
+// skopeo push to a registry:
+//
+//	recall export-cache -path build -o mongodb.tar.gz 6.0 7.0
+//	recall export-cache -path build -format oci -tag mongodb-7.0 -o mongodb.oci.tar 7.0
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/management"
+	"github.com/tychoish/bond/middleware"
+	"github.com/tychoish/bond/mirror"
+	"github.com/tychoish/bond/recall"
+	"github.com/tychoish/bond/rest"
+	"github.com/tychoish/bond/sharedcache"
+)
+
+const usage = `usage: recall <command> [arguments]
+
+commands:
+  queue     manage the jobs in a queue (run "recall queue -h" for details)
+  download  download builds into a cache (run "recall download -h" for details)
+  history   show the past downloads into a cache (run "recall history -h" for details)
+  doctor    diagnose problems with the network and the cache (run "recall doctor -h" for details)
+  upgrade-path
+            download each step of an upgrade (run "recall upgrade-path -h" for details)
+  matrix    resolve builds as a CI matrix (run "recall matrix -h" for details)
+  resolve   resolve version specifiers to builds (run "recall resolve -h" for details)
+  stats     report the usage of a cache (run "recall stats -h" for details)
+  fetch     download the builds of a manifest (run "recall fetch -h" for details)
+  provision-cluster
+            download the builds of a cluster's nodes (run "recall provision-cluster -h" for details)
+  toolchain download a server release with its tools and shell (run "recall toolchain -h" for details)
+  checksum  check the archives of a cached version (run "recall checksum -h" for details)
+  compare   compare the binaries of two cached builds (run "recall compare -h" for details)
+  provenance
+            print the provenance of cached builds (run "recall provenance -h" for details)
+  self-update
+            update recall from a release endpoint (run "recall self-update -h" for details)
+  env       print shell exports for a cached build (run "recall env -h" for details)
+  serve-cache
+            serve a cache to other machines (run "recall serve-cache -h" for details)
+  sync-cache
+            reconcile a cache with another machine's (run "recall sync-cache -h" for details)
+  daemon    run a queue's workers and the cache's recurring jobs (run "recall daemon -h" for details)
+  export-cache
+            export cached builds as a container image layer (run "recall export-cache -h" for details)
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "queue":
+		err = queueCommand(ctx, os.Args[2:])
+	case "download":
+		err = downloadCommand(ctx, os.Args[2:])
+	case "history":
+		err = historyCommand(ctx, os.Args[2:], os.Stdout)
+	case "doctor":
+		err = doctorCommand(ctx, os.Args[2:], os.Stdout)
+	case "upgrade-path":
+		err = upgradePathCommand(ctx, os.Args[2:], os.Stdout)
+	case "matrix":
+		err = matrixCommand(ctx, os.Args[2:], os.Stdout)
+	case "resolve":
+		err = resolveCommand(ctx, os.Args[2:], os.Stdout)
+	case "stats":
+		err = statsCommand(ctx, os.Args[2:], os.Stdout)
+	case "fetch":
+		err = fetchCommand(ctx, os.Args[2:])
+	case "provision-cluster":
+		err = provisionClusterCommand(ctx, os.Args[2:], os.Stdout)
+	case "toolchain":
+		err = toolchainCommand(ctx, os.Args[2:], os.Stdout)
+	case "checksum":
+		err = checksumCommand(ctx, os.Args[2:], os.Stdout)
+	case "compare":
+		err = compareCommand(ctx, os.Args[2:], os.Stdout)
+	case "provenance":
+		err = provenanceCommand(ctx, os.Args[2:], os.Stdout)
+	case "self-update":
+		err = selfUpdateCommand(ctx, os.Args[2:], os.Stdout)
+	case "env":
+		err = envCommand(ctx, os.Args[2:], os.Stdout)
+	case "serve-cache":
+		err = serveCacheCommand(ctx, os.Args[2:])
+	case "sync-cache":
+		err = syncCacheCommand(ctx, os.Args[2:], os.Stdout)
+	case "daemon":
+		err = daemonCommand(ctx, os.Args[2:])
+	case "export-cache":
+		err = exportCacheCommand(ctx, os.Args[2:], os.Stdout)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		err = errors.Errorf("'%s' is not a valid command\n%s", os.Args[1], usage)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func queueCommand(ctx context.Context, args []string) error {
+	opts := queue.DefaultMongoDBOptions()
+	var service, name string
+
+	fs := flag.NewFlagSet("queue", flag.ContinueOnError)
+	fs.StringVar(&service, "service", "", "base URL of a bond management service")
+	fs.StringVar(&opts.URI, "mongodb-uri", opts.URI, "MongoDB connection string, for direct access to the queue's driver")
+	fs.StringVar(&opts.DB, "db", opts.DB, "name of the queue's database")
+	fs.StringVar(&name, "name", "", "name of the queue, for direct access to the queue's driver")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: recall queue [flags] <command> [arguments]")
+		fs.PrintDefaults()
+		fmt.Fprintln(fs.Output(), management.CommandUsage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var admin management.Admin
+	switch {
+	case service != "" && name != "":
+		return errors.New("specify either a service or a queue name, not both")
+	case service != "":
+		admin = rest.NewClient(service, nil)
+	case name != "":
+		driver := queue.NewMongoDriver(name, opts)
+		if err := driver.Open(ctx); err != nil {
+			return errors.Wrapf(err, "problem connecting to %s", opts.URI)
+		}
+		defer driver.Close()
+
+		admin = management.New(driver)
+	default:
+		return errors.New("must specify a service or a queue name")
+	}
+
+	return management.RunCommand(ctx, admin, fs.Args(), os.Stdout)
+}
+
+func downloadCommand(ctx context.Context, args []string) error {
+	var (
+		path, from, to string
+		client         = bond.ClientOptions{Header: map[string]string{}}
+	)
+
+	fs := flag.NewFlagSet("download", flag.ContinueOnError)
+	fs.StringVar(&path, "path", "build", "cache directory for the builds")
+	build := addBuildFlags(fs)
+	qflags := addQueueFlags(fs)
+	fs.StringVar(&from, "from", "", "download every release from this version, inclusive (requires -to)")
+	fs.StringVar(&to, "to", "", "download every release to this version, inclusive (requires -from)")
+	fs.StringVar(&client.UserAgent, "user-agent", "", "User-Agent of requests for feeds and builds")
+	fs.Var(headerFlag(client.Header), "header", "header to add to requests, as name=value (repeatable)")
+	fs.Var((*allowedHostFlag)(&client.AllowedHosts), "allowed-host", "only host that requests may be made to, where *.example.net allows subdomains; may be repeated")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: recall download [flags] [release...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	opts, err := build.options()
+	if err != nil {
+		return err
+	}
+	qopts, err := qflags.options()
+	if err != nil {
+		return err
+	}
+	if err := bond.SetClientOptions(client); err != nil {
+		return err
+	}
+
+	releases := fs.Args()
+	if (from == "") != (to == "") {
+		return errors.New("must specify both -from and -to")
+	}
+
+	if from != "" {
+		feed, err := bond.GetArtifactsFeed(ctx, path)
+		if err != nil {
+			return errors.Wrap(err, "problem loading feed")
+		}
+
+		span, err := feed.Span(from, to)
+		if err != nil {
+			return err
+		}
+
+		for _, version := range span {
+			releases = append(releases, version.Version)
+		}
+	}
+
+	if len(releases) == 0 {
+		return errors.New("must specify releases to download, or -from and -to")
+	}
+
+	history := recall.NewFileHistory(filepath.Join(path, recall.HistoryFileName))
+	return recall.FetchReleasesWithHistory(ctx, history, qopts, releases, path, opts, qflags.configs()...)
+}
+
+func historyCommand(ctx context.Context, args []string, out io.Writer) error {
+	var (
+		path   string
+		limit  int
+		failed bool
+		jobs   bool
+	)
+
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.StringVar(&path, "path", "build", "cache directory of the downloads")
+	fs.IntVar(&limit, "n", 20, "number of runs to show, or 0 for all runs")
+	fs.BoolVar(&failed, "failed", false, "only show runs that failed")
+	fs.BoolVar(&jobs, "jobs", false, "show the download jobs of each run")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	runs, err := recall.NewFileHistory(filepath.Join(path, recall.HistoryFileName)).Runs(ctx, 0)
+	if err != nil {
+		return err
+	}
+
+	shown := 0
+	for _, run := range runs {
+		if limit > 0 && shown >= limit {
+			break
+		}
+		if failed && !run.Failed() {
+			continue
+		}
+		shown++
+
+		fmt.Fprintln(out, run.String())
+		if run.Error != "" {
+			fmt.Fprintln(out, "    error:", run.Error)
+		}
+		if !jobs {
+			continue
+		}
+		for _, j := range run.Jobs {
+			status := "ok"
+			if j.Error != "" {
+				status = j.Error
+			}
+			fmt.Fprintf(out, "    %s  %s  %s\n", j.URL, j.Finished.Sub(j.Started).Round(time.Millisecond), status)
+		}
+	}
+
+	if shown == 0 {
+		fmt.Fprintln(out, "no runs recorded in", path)
+	}
+
+	return nil
+}
+
+func fetchCommand(ctx context.Context, args []string) error {
+	var path, manifest string
+
+	fs := flag.NewFlagSet("fetch", flag.ContinueOnError)
+	fs.StringVar(&path, "path", "build", "cache directory for the builds")
+	fs.StringVar(&manifest, "f", "", "manifest of the builds to download")
+	qflags := addQueueFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if manifest == "" {
+		return errors.New("must specify a manifest with -f")
+	}
+	qopts, err := qflags.options()
+	if err != nil {
+		return err
+	}
+
+	m, err := recall.ReadManifest(manifest)
+	if err != nil {
+		return err
+	}
+	if m.Defaults.Target == "" || m.Defaults.Arch == "" {
+		detected, err := bond.DetectBuildOptions(bond.MongoDBEdition(m.Defaults.Edition))
+		if err != nil {
+			return errors.Wrap(err, "problem detecting the build, specify a default target and arch in the manifest")
+		}
+		if m.Defaults.Target == "" {
+			m.Defaults.Target = detected.Target
+		}
+		if m.Defaults.Arch == "" {
+			m.Defaults.Arch = string(detected.Arch)
+		}
+	}
+
+	history := recall.NewFileHistory(filepath.Join(path, recall.HistoryFileName))
+	return recall.FetchManifest(ctx, history, qopts, m, path, qflags.configs()...)
+}
+
+func provisionClusterCommand(ctx context.Context, args []string, out io.Writer) error {
+	var path, topology string
+
+	fs := flag.NewFlagSet("provision-cluster", flag.ContinueOnError)
+	fs.StringVar(&path, "path", "build", "cache directory for the builds")
+	fs.StringVar(&topology, "f", "", "topology of the cluster")
+	qflags := addQueueFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if topology == "" {
+		return errors.New("must specify a topology with -f")
+	}
+	qopts, err := qflags.options()
+	if err != nil {
+		return err
+	}
+
+	t, err := recall.ReadClusterTopology(topology)
+	if err != nil {
+		return err
+	}
+	if t.Options.Target == "" || t.Options.Arch == "" {
+		detected, err := bond.DetectBuildOptions(t.Options.Edition)
+		if err != nil {
+			return errors.Wrap(err, "problem detecting the build, specify a target and arch in the topology")
+		}
+		if t.Options.Target == "" {
+			t.Options.Target = detected.Target
+		}
+		if t.Options.Arch == "" {
+			t.Options.Arch = detected.Arch
+		}
+	}
+
+	m, err := recall.ProvisionCluster(ctx, qopts, *t, path, qflags.configs()...)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+func toolchainCommand(ctx context.Context, args []string, out io.Writer) error {
+	var (
+		path     string
+		extra    componentsFlag
+		versions = componentVersionFlag{}
+	)
+
+	fs := flag.NewFlagSet("toolchain", flag.ContinueOnError)
+	fs.StringVar(&path, "path", "build", "cache directory for the toolchain")
+	build := addBuildFlags(fs)
+	qflags := addQueueFlags(fs)
+	fs.Var(&extra, "component", "component to add to the default server, tools, and shell (repeatable)")
+	fs.Var(versions, "component-version", "version or series of a component, as component=version (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: recall toolchain [flags] release")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("must specify one server release")
+	}
+	opts, err := build.options()
+	if err != nil {
+		return err
+	}
+	qopts, err := qflags.options()
+	if err != nil {
+		return err
+	}
+
+	// pinning a component's version doesn't drop the others, so
+	// fetch the defaults and added components at their newest
+	// versions unless they're pinned.
+	for _, c := range append(append([]bond.Component{}, bond.DefaultComponents...), extra...) {
+		if _, ok := versions[c]; !ok {
+			versions[c] = ""
+		}
+	}
+
+	history := recall.NewFileHistory(filepath.Join(path, recall.HistoryFileName))
+	tc, err := recall.FetchToolchain(ctx, history, qopts, fs.Arg(0), versions, path, opts, qflags.configs()...)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range bond.Components {
+		if artifact, ok := tc.Artifacts[c]; ok {
+			fmt.Fprintf(out, "%s\t%s\t%s\n", artifact.Component, artifact.Version, artifact.URL)
+		}
+	}
+
+	return nil
+}
+
+func upgradePathCommand(ctx context.Context, args []string, out io.Writer) error {
+	var (
+		path   string
+		dryRun bool
+	)
+
+	fs := flag.NewFlagSet("upgrade-path", flag.ContinueOnError)
+	fs.StringVar(&path, "path", "build", "cache directory for the builds")
+	build := addBuildFlags(fs)
+	fs.BoolVar(&dryRun, "dry-run", false, "print the plan without downloading the builds")
+	qflags := addQueueFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: recall upgrade-path [flags] <from> <to>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("must specify the series to upgrade from and to")
+	}
+	opts, err := build.options()
+	if err != nil {
+		return err
+	}
+	qopts, err := qflags.options()
+	if err != nil {
+		return err
+	}
+
+	feed, err := bond.GetArtifactsFeed(ctx, path)
+	if err != nil {
+		return errors.Wrap(err, "problem loading feed")
+	}
+
+	plan, err := feed.UpgradePlan(fs.Arg(0), fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	releases := make([]string, 0, len(plan))
+	fmt.Fprintf(out, "upgrade from %s to %s:\n", fs.Arg(0), fs.Arg(1))
+	for idx, version := range plan {
+		fmt.Fprintf(out, "  %d. %s\n", idx+1, version.Version)
+		releases = append(releases, version.Version)
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	history := recall.NewFileHistory(filepath.Join(path, recall.HistoryFileName))
+	return recall.FetchReleasesWithHistory(ctx, history, qopts, releases, path, opts, qflags.configs()...)
+}
+
+func matrixCommand(ctx context.Context, args []string, out io.Writer) error {
+	var path, series, targets, arch, edition, format string
+
+	fs := flag.NewFlagSet("matrix", flag.ContinueOnError)
+	fs.StringVar(&path, "path", "build", "cache directory of the feed")
+	fs.StringVar(&series, "series", "", "comma separated release series (e.g. 6.0,7.0)")
+	fs.StringVar(&targets, "targets", "", "comma separated target distributions (e.g. ubuntu2204,rhel90)")
+	fs.StringVar(&arch, "arch", string(bond.AMD64), "architecture of the builds")
+	fs.StringVar(&edition, "edition", string(bond.Enterprise), "edition of the builds")
+	fs.StringVar(&format, "format", string(recall.JSONMatrix), "output format: json or github")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if series == "" || targets == "" {
+		return errors.New("must specify -series and -targets")
+	}
+
+	feed, err := bond.GetArtifactsFeed(ctx, path)
+	if err != nil {
+		return errors.Wrap(err, "problem loading feed")
+	}
+
+	opts := bond.BuildOptions{Arch: bond.ParseArch(arch), Edition: bond.MongoDBEdition(edition)}
+	entries, err := recall.BuildMatrix(feed, splitList(series), splitList(targets), opts)
+	if err != nil {
+		return err
+	}
+
+	return recall.WriteMatrix(out, entries, recall.MatrixFormat(format))
+}
+
+func resolveCommand(ctx context.Context, args []string, out io.Writer) error {
+	var (
+		path   string
+		asJSON bool
+	)
+
+	fs := flag.NewFlagSet("resolve", flag.ContinueOnError)
+	fs.StringVar(&path, "path", "build", "cache directory of the feed")
+	build := addBuildFlags(fs)
+	fs.BoolVar(&asJSON, "json", false, "print the resolved builds as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: recall resolve [flags] specifier...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("must specify version specifiers to resolve")
+	}
+	opts, err := build.options()
+	if err != nil {
+		return err
+	}
+
+	feed, err := bond.GetArtifactsFeed(ctx, path)
+	if err != nil {
+		return errors.Wrap(err, "problem loading feed")
+	}
+
+	resolved := []bond.Resolution{}
+	for _, spec := range fs.Args() {
+		r, err := feed.Resolve(spec, opts)
+		if err != nil {
+			return err
+		}
+		resolved = append(resolved, r...)
+	}
+
+	if asJSON {
+		type build struct {
+			Specifier string            `json:"specifier"`
+			Version   string            `json:"version"`
+			Build     bond.BuildOptions `json:"build"`
+			URL       string            `json:"url"`
+			Nightly   bool              `json:"nightly,omitempty"`
+		}
+		builds := []build{}
+		for _, r := range resolved {
+			builds = append(builds, build{Specifier: r.Specifier, Version: r.Version.Version, Build: opts, URL: r.URL, Nightly: r.Nightly})
+		}
+
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(builds)
+	}
+
+	for _, r := range resolved {
+		version := r.Version.Version
+		if r.Nightly {
+			version += " (nightly)"
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\n", r.Specifier, version, r.URL)
+	}
+
+	return nil
+}
+
+func statsCommand(ctx context.Context, args []string, out io.Writer) error {
+	var path string
+
+	fs := flag.NewFlagSet("stats", flag.ContinueOnError)
+	fs.StringVar(&path, "path", "build", "cache directory to report on")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	catalog, err := bond.NewCatalog(ctx, path)
+	if err != nil {
+		return errors.Wrap(err, "problem loading catalog")
+	}
+
+	stats, err := catalog.Stats()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, stats.String())
+
+	runs, err := recall.NewFileHistory(filepath.Join(catalog.Path, recall.HistoryFileName)).Runs(ctx, 0)
+	if err != nil {
+		return err
+	}
+
+	hits, total := recall.CacheHits(runs, stats.LastGC)
+	if total == 0 {
+		fmt.Fprintln(out, "  hit rate: no downloads recorded")
+		return nil
+	}
+	fmt.Fprintf(out, "  hit rate: %d of %d downloads (%.1f%%) were cached\n", hits, total, 100*float64(hits)/float64(total))
+
+	return nil
+}
+
+func checksumCommand(ctx context.Context, args []string, out io.Writer) error {
+	var path string
+
+	fs := flag.NewFlagSet("checksum", flag.ContinueOnError)
+	fs.StringVar(&path, "path", "build", "cache directory of the builds")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: recall checksum [flags] <version>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("must specify a version")
+	}
+
+	catalog, err := bond.NewCatalog(ctx, path)
+	if err != nil {
+		return errors.Wrap(err, "problem loading catalog")
+	}
+
+	sums, err := catalog.Checksums(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	mismatched := 0
+	for _, sum := range sums {
+		fmt.Fprintln(out, sum.String())
+		if sum.Archive != "" && !sum.OK() {
+			mismatched++
+		}
+	}
+	if mismatched > 0 {
+		return errors.Errorf("%d of %d archives do not match their checksums", mismatched, len(sums))
+	}
+
+	return nil
+}
+
+func provenanceCommand(ctx context.Context, args []string, out io.Writer) error {
+	var path string
+	var missing bool
+
+	fs := flag.NewFlagSet("provenance", flag.ContinueOnError)
+	fs.StringVar(&path, "path", "build", "cache directory of the builds")
+	fs.BoolVar(&missing, "missing", false, "fail if any build has no recorded provenance")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: recall provenance [flags] [version]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	catalog, err := bond.NewCatalog(ctx, path)
+	if err != nil {
+		return errors.Wrap(err, "problem loading catalog")
+	}
+
+	builds := catalog.Provenances(fs.Arg(0))
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(builds); err != nil {
+		return errors.Wrap(err, "problem writing provenance")
+	}
+
+	if missing {
+		count := 0
+		for _, b := range builds {
+			if b.Provenance == nil {
+				count++
+			}
+		}
+		if count > 0 {
+			return errors.Errorf("%d of %d builds have no recorded provenance", count, len(builds))
+		}
+	}
+
+	return nil
+}
+
+func compareCommand(ctx context.Context, args []string, out io.Writer) error {
+	var path string
+
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	fs.StringVar(&path, "path", "build", "cache directory of the builds")
+	build := addBuildFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: recall compare [flags] <version> <version>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("must specify two versions to compare")
+	}
+	opts, err := build.options()
+	if err != nil {
+		return err
+	}
+
+	catalog, err := bond.NewCatalog(ctx, path)
+	if err != nil {
+		return errors.Wrap(err, "problem loading catalog")
+	}
+
+	builds := make([]string, 0, 2)
+	for _, version := range fs.Args() {
+		dir, err := catalog.Get(version, string(opts.Edition), opts.Target, string(opts.Arch), opts.Debug)
+		if err != nil {
+			return err
+		}
+		builds = append(builds, dir)
+	}
+
+	cmp, err := bond.CompareBuilds(builds[0], builds[1])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, cmp.String())
+
+	return nil
+}
+
+func selfUpdateCommand(ctx context.Context, args []string, out io.Writer) error {
+	opts := recall.SelfUpdateOptions{}
+
+	fs := flag.NewFlagSet("self-update", flag.ContinueOnError)
+	fs.StringVar(&opts.Endpoint, "endpoint", os.Getenv("RECALL_UPDATE_ENDPOINT"), "URL of the release document")
+	fs.StringVar(&opts.PublicKey, "public-key", os.Getenv("RECALL_UPDATE_PUBLIC_KEY"), "base64 ed25519 key that signs releases")
+	fs.BoolVar(&opts.CheckOnly, "check", false, "report whether there is a newer release without installing it")
+	fs.BoolVar(&opts.Force, "force", false, "install the release even if it is not newer")
+	fs.BoolVar(&opts.Insecure, "insecure", false, "install releases without verifying their signatures, if there is no public key")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: recall self-update [flags] (current version: %s)\n", recall.Version)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	res, err := recall.SelfUpdate(ctx, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, res.String())
+
+	return nil
+}
+
+func serveCacheCommand(ctx context.Context, args []string) error {
+	var path, addr string
+	opts := sharedcache.ServerOptions{}
+
+	fs := flag.NewFlagSet("serve-cache", flag.ContinueOnError)
+	fs.StringVar(&path, "path", "build", "cache directory to serve")
+	fs.StringVar(&addr, "addr", ":8080", "address to listen on")
+	fs.StringVar(&opts.Token, "token", os.Getenv("BOND_SHARED_CACHE_TOKEN"), "bearer token that clients must present")
+	fs.BoolVar(&opts.AllowUploads, "allow-uploads", false, "accept archives that clients upload")
+	fs.Int64Var(&opts.MaxUploadSize, "max-upload-size", sharedcache.DefaultMaxUploadSize, "size limit of uploads, in bytes")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return errors.Wrapf(err, "problem creating cache directory %s", path)
+	}
+
+	srv := &http.Server{Addr: addr, Handler: sharedcache.NewServer(path, opts).Handler()}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "serving %s on %s\n", path, addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return errors.Wrap(err, "problem running shared cache server")
+	}
+
+	return nil
+}
+
+func daemonCommand(ctx context.Context, args []string) error {
+	var path string
+	opts := recall.DaemonOptions{}
+
+	fs := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	fs.StringVar(&path, "path", "build", "cache directory of the builds")
+	qflags := addQueueFlags(fs)
+	fs.StringVar(&opts.Candidate, "candidate", "", "name of the daemon in the election of the daemons that share the queue (default host name and pid)")
+	fs.DurationVar(&opts.LeaderTTL, "leader-ttl", 30*time.Second, "time after which the daemons replace a leader that stopped renewing its term")
+	fs.DurationVar(&opts.FeedRefresh, "refresh-feed", 4*time.Hour, "interval of the feed refreshes")
+	fs.DurationVar(&opts.Prune, "prune", 0, "interval of the cache's garbage collections, which removes files that are not builds, archives, or feeds (0 disables it)")
+	fs.DurationVar(&opts.PruneMinAge, "prune-min-age", 24*time.Hour, "age of the files that garbage collections may remove")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	qopts, err := qflags.options()
+	if err != nil {
+		return err
+	}
+
+	// leaders that are interrupted resign, so that another daemon
+	// takes over without waiting for the term to expire
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return recall.RunDaemon(ctx, qopts, path, opts, qflags.configs()...)
+}
+
+func syncCacheCommand(ctx context.Context, args []string, out io.Writer) error {
+	var manifest, writeManifest, verifyService string
+	opts := mirror.ReconcileOptions{}
+	header := headerFlag{}
+
+	fs := flag.NewFlagSet("sync-cache", flag.ContinueOnError)
+	fs.StringVar(&opts.Path, "path", "build", "cache directory of the builds")
+	fs.StringVar(&manifest, "remote-manifest", "", "manifest file of the remote cache, required for a URL")
+	fs.StringVar(&writeManifest, "write-manifest", "", "write the manifest of the cache to a file, and exit")
+	fs.StringVar(&opts.Prefer, "prefer", "", "copy archives that differ from the 'local' or 'remote' cache")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "report the archives to copy in each direction without copying them")
+	fs.Float64Var(&opts.Sample, "verify-sample", 0, "fraction of the new archives to verify by checksum as they're copied, checking the rest by size (0 verifies every archive)")
+	fs.StringVar(&verifyService, "verify-service", "", "base URL of a queue service to submit the verification of the archives checked by size to")
+	fs.Var(header, "header", "header to add to requests, as name=value (repeatable)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: recall sync-cache [flags] <directory or url>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if writeManifest != "" {
+		local, err := mirror.LocalManifest(opts.Path)
+		if err != nil {
+			return err
+		}
+
+		f, err := os.Create(writeManifest)
+		if err != nil {
+			return errors.Wrapf(err, "problem creating %s", writeManifest)
+		}
+		if err = mirror.WriteManifest(f, local); err != nil {
+			f.Close()
+			return err
+		}
+		return errors.Wrapf(f.Close(), "problem closing %s", writeManifest)
+	}
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("must specify the remote cache")
+	}
+	remote := fs.Arg(0)
+
+	var err error
+	if strings.HasPrefix(remote, "http://") || strings.HasPrefix(remote, "https://") {
+		peer := mirror.HTTPPeer{BaseURL: remote, Header: http.Header{}}
+		for k, v := range header {
+			peer.Header.Set(k, v)
+		}
+		opts.Peer = peer
+		if manifest == "" {
+			return errors.New("must specify the manifest of a remote cache at a url")
+		}
+	} else {
+		opts.Peer = mirror.DirectoryPeer{Path: remote}
+	}
+
+	if manifest != "" {
+		opts.Remote, err = mirror.ReadManifestFile(manifest)
+	} else {
+		opts.Remote, err = mirror.LocalManifest(remote)
+	}
+	if err != nil {
+		return err
+	}
+
+	report, err := mirror.Reconcile(ctx, opts)
+	if report != nil {
+		for _, c := range report.Conflicts {
+			fmt.Fprintf(out, "conflict: %s differs between the caches\n", c.Name)
+		}
+		fmt.Fprintln(out, report.String())
+	}
+	if err != nil || report == nil || len(report.Deferred) == 0 || opts.DryRun {
+		return err
+	}
+
+	if verifyService == "" {
+		fmt.Fprintf(out, "%d archives were checked by size only; sync again without -verify-sample to verify them\n", len(report.Deferred))
+		return nil
+	}
+
+	id, err := rest.NewQueueClient(verifyService, nil).Submit(ctx, mirror.NewVerifyJob(opts.Path, report.Deferred))
+	if err != nil {
+		return errors.Wrap(err, "problem submitting verification of deferred archives")
+	}
+	fmt.Fprintf(out, "submitted verification of %d archives as job %s\n", len(report.Deferred), id)
+
+	return nil
+}
+
+func envCommand(ctx context.Context, args []string, out io.Writer) error {
+	var path, shell string
+
+	defaultShell := bond.POSIXShell
+	if filepath.Base(os.Getenv("SHELL")) == "fish" {
+		defaultShell = bond.FishShell
+	}
+
+	fs := flag.NewFlagSet("env", flag.ContinueOnError)
+	fs.StringVar(&path, "path", "build", "cache directory of the builds")
+	fs.StringVar(&shell, "shell", string(defaultShell), "syntax of the exports: posix or fish")
+	build := addBuildFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: recall env [flags] <version>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("must specify a release or series")
+	}
+
+	// the build flags only select a build when one is specified,
+	// otherwise the cache must have a single build of the release.
+	selected := false
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "target", "arch", "edition", "debug":
+			selected = true
+		}
+	})
+	opts := bond.BuildOptions{}
+	if selected {
+		var err error
+		if opts, err = build.options(); err != nil {
+			return err
+		}
+	}
+
+	catalog, err := bond.NewCatalog(ctx, path)
+	if err != nil {
+		return errors.Wrap(err, "problem loading catalog")
+	}
+
+	dir, err := catalog.Resolve(fs.Arg(0), opts)
+	if err != nil {
+		return err
+	}
+
+	exports, err := bond.EnvExports(dir, bond.ShellSyntax(shell))
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(out, exports)
+
+	return nil
+}
+
+func exportCacheCommand(ctx context.Context, args []string, out io.Writer) error {
+	var path, output, format string
+	opts := bond.CatalogExportOptions{}
+
+	fs := flag.NewFlagSet("export-cache", flag.ContinueOnError)
+	fs.StringVar(&path, "path", "build", "cache directory of the builds")
+	fs.StringVar(&output, "o", "", "file to write the export to")
+	fs.StringVar(&format, "format", string(bond.LayerTarball), "format of the export: layer or oci")
+	fs.StringVar(&opts.Path, "image-path", bond.DefaultExportPath, "directory of the builds in the image")
+	fs.StringVar(&opts.Tag, "tag", "latest", "reference name of the image in an OCI layout")
+	fs.BoolVar(&opts.IncludeFeed, "include-feed", false, "add the cache's feed to the layer")
+	build := addBuildFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: recall export-cache [flags] [version...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if output == "" {
+		fs.Usage()
+		return errors.New("must specify the file to write the export to")
+	}
+	opts.Format = bond.ExportFormat(format)
+	opts.Versions = fs.Args()
+
+	// as with env, the build flags only select builds when one is
+	// specified
+	selected := false
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "target", "arch", "edition", "debug":
+			selected = true
+		}
+	})
+	if selected {
+		var err error
+		if opts.Build, err = build.options(); err != nil {
+			return err
+		}
+	}
+
+	catalog, err := bond.NewCatalog(ctx, path)
+	if err != nil {
+		return errors.Wrap(err, "problem loading catalog")
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return errors.Wrapf(err, "problem creating %s", output)
+	}
+	export, err := catalog.Export(ctx, file, opts)
+	if cerr := file.Close(); err == nil {
+		err = errors.Wrapf(cerr, "problem closing %s", output)
+	}
+	if err != nil {
+		_ = os.Remove(output)
+		return err
+	}
+
+	source := filepath.Base(output)
+	if export.Format == bond.OCILayout {
+		source = opts.Tag
+	}
+	fmt.Fprintln(out, export)
+	fmt.Fprint(out, export.Dockerfile(source))
+
+	return nil
+}
+
+// splitList splits a comma separated flag value, ignoring empty
+// elements.
+func splitList(val string) []string {
+	out := []string{}
+	for _, elem := range strings.Split(val, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			out = append(out, elem)
+		}
+	}
+	return out
+}
+
+func doctorCommand(ctx context.Context, args []string, out io.Writer) error {
+	var (
+		opts  recall.DoctorOptions
+		minGB float64
+	)
+
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	fs.StringVar(&opts.Path, "path", "build", "cache directory to check")
+	mirrors := addMirrorFlags(fs)
+	fs.Float64Var(&minGB, "min-free", float64(recall.DefaultMinFreeSpace)/(1<<30), "free disk space, in GiB, that the cache needs")
+	fs.DurationVar(&opts.Timeout, "timeout", 10*time.Second, "timeout of each network check")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	opts.MinFreeSpace = uint64(minGB * (1 << 30))
+
+	failed := 0
+	for _, d := range recall.Diagnose(ctx, opts, mirrors.options()...) {
+		fmt.Fprintln(out, d.String())
+		if !d.OK {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d checks failed", failed)
+	}
+
+	return nil
+}
+
+// buildFlags are the flags that select the builds of a command.
+type buildFlags struct {
+	target, arch, edition string
+	debug                 bool
+}
+
+func addBuildFlags(fs *flag.FlagSet) *buildFlags {
+	f := &buildFlags{}
+	fs.StringVar(&f.target, "target", "", "target distribution of the builds (e.g. ubuntu1804), detected by default")
+	fs.StringVar(&f.arch, "arch", string(bond.AMD64), "architecture of the builds")
+	fs.StringVar(&f.edition, "edition", string(bond.Enterprise), "edition of the builds")
+	fs.BoolVar(&f.debug, "debug", false, "download debug symbols rather than builds")
+	return f
+}
+
+// options returns the build options of the flags, detecting the
+// target if it's not specified.
+func (f *buildFlags) options() (bond.BuildOptions, error) {
+	opts := bond.BuildOptions{
+		Target:  f.target,
+		Arch:    bond.ParseArch(f.arch),
+		Edition: bond.MongoDBEdition(f.edition),
+		Debug:   f.debug,
+	}
+
+	if opts.Target == "" {
+		detected, err := bond.DetectBuildOptions(opts.Edition)
+		if err != nil {
+			return opts, errors.Wrap(err, "problem detecting target, specify -target")
+		}
+		opts.Target = detected.Target
+	}
+
+	return opts, nil
+}
+
+// queueFlags are the flags that configure how downloads run: the
+// queue that they run through, their retry budget, the mirrors they
+// download from, the shared cache that they check first, and the
+// throttling of their extraction.
+type queueFlags struct {
+	workers          int
+	rateLimit        time.Duration
+	driver, name, db string
+	sharedCache      string
+	upload           bool
+	retries          int
+	retryTime        time.Duration
+	retryBackoff     time.Duration
+	extractRate      float64
+	extractSync      string
+	progress         bool
+	tag              string
+	quotas           quotaFlag
+	maxPending       int
+	labels           labelFlag
+	requires         capabilityFlag
+	capabilities     capabilityFlag
+	genericFallback  bool
+	lowMemoryFeed    bool
+	peers            peerFlag
+	processors       processorFlag
+	metadata         bool
+	notify           string
+	mirrors          *mirrorFlags
+}
+
+func addQueueFlags(fs *flag.FlagSet) *queueFlags {
+	f := &queueFlags{quotas: quotaFlag{}, labels: labelFlag{}, requires: capabilityFlag{}, capabilities: capabilityFlag{}}
+	fs.IntVar(&f.workers, "workers", bond.DefaultConcurrency, "number of concurrent downloads")
+	fs.DurationVar(&f.rateLimit, "rate-limit", 0, "time each worker waits between downloads (e.g. 500ms)")
+	fs.StringVar(&f.driver, "queue-driver", string(recall.LocalQueue), "queue storage: local, or a MongoDB connection string for a queue that resumes interrupted downloads")
+	fs.StringVar(&f.name, "queue-name", recall.DefaultQueueName, "name of a persistent queue")
+	fs.StringVar(&f.db, "queue-db", queue.DefaultMongoDBOptions().DB, "database of a persistent queue")
+	fs.IntVar(&f.retries, "retries", 0, "total number of retries of failed downloads, across all downloads")
+	fs.DurationVar(&f.retryTime, "retry-time", 0, "total time that retries of failed downloads may take, across all downloads")
+	fs.DurationVar(&f.retryBackoff, "retry-backoff", recall.DefaultRetryBackoff, "wait before the first retry of a download, which doubles for each later retry")
+	fs.StringVar(&f.sharedCache, "shared-cache", os.Getenv("BOND_SHARED_CACHE"), "base URL of a shared cache to check before the download servers (the token is read from BOND_SHARED_CACHE_TOKEN)")
+	fs.Var(&f.peers, "peer", "base URL of another agent's cache server (see serve-cache) to fetch archives from before the shared cache and download servers, preferring peers on the local network; may be repeated (experimental)")
+	fs.BoolVar(&f.upload, "shared-cache-upload", false, "upload verified downloads to the shared cache")
+	fs.Float64Var(&f.extractRate, "extract-rate", 0, "limit, in MiB per second, of the disk writes of all concurrent extractions")
+	fs.StringVar(&f.extractSync, "extract-sync", string(recall.SyncNone), "when to flush extracted files to disk: none, file (after each file), or archive (after each archive)")
+	fs.BoolVar(&f.progress, "progress", false, "log the progress of each download")
+	fs.StringVar(&f.tag, "tag", "", "tag of the submitter of the downloads, for quotas")
+	fs.Var(f.quotas, "quota", "tag=pending:running limits of the pending and running downloads of a tag, where an empty limit is unlimited; may be repeated")
+	fs.Var(f.labels, "label", "key=value label to set on the download jobs, for management filters; may be repeated")
+	fs.Var(f.requires, "require", "key=value (or key) capability that the workers of the downloads must have, e.g. os=linux; may be repeated")
+	fs.Var(f.capabilities, "capability", "key=value (or key) capability of this process's workers, in addition to their os and arch; may be repeated")
+	fs.IntVar(&f.maxPending, "max-pending", 0, "pause submitting downloads while the queue has this many pending jobs (0 is unlimited)")
+	fs.BoolVar(&f.genericFallback, "generic-linux-fallback", false, "download the generic linux build of releases that have no build for the target")
+	fs.BoolVar(&f.lowMemoryFeed, "low-memory-feed", false, "decode the feed incrementally from disk, to limit memory use")
+	fs.Var(&f.processors, "post-process", "command to run on each downloaded, verified archive, with the archive's path as its last argument, e.g. a script that strips binaries; may be repeated, and the commands run in order")
+	fs.BoolVar(&f.metadata, "write-metadata", false, "write a metadata file next to each processed archive, after the -post-process commands")
+	fs.StringVar(&f.notify, "notify", "", "JSON or YAML file of the senders and rules of notifications of the queue's jobs and of new and cached releases")
+	f.mirrors = addMirrorFlags(fs)
+	return f
+}
+
+// configs returns the download configuration of the flags.
+func (f *queueFlags) configs() []bond.Option {
+	opts := f.mirrors.options()
+	if f.progress {
+		opts = append(opts, bond.WithProgress(logProgress))
+	}
+	if f.genericFallback {
+		opts = append(opts, bond.WithGenericLinuxFallback())
+	}
+	if f.lowMemoryFeed {
+		opts = append(opts, bond.WithLowMemoryFeed())
+	}
+
+	sources := []bond.ArtifactSource{}
+	if len(f.peers) > 0 {
+		// the peers are validated as the flags are parsed
+		peers, err := sharedcache.NewPeerSource(sharedcache.PeerOptions{
+			Peers: f.peers,
+			Token: os.Getenv("BOND_SHARED_CACHE_TOKEN"),
+		})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ignoring peers:", err)
+		} else {
+			sources = append(sources, peers)
+		}
+	}
+
+	if f.sharedCache != "" {
+		client := sharedcache.NewClient(f.sharedCache, os.Getenv("BOND_SHARED_CACHE_TOKEN"), nil)
+		sources = append(sources, client)
+		if f.upload {
+			opts = append(opts, bond.WithArtifactSink(client))
+		}
+	}
+
+	switch len(sources) {
+	case 0:
+	case 1:
+		opts = append(opts, bond.WithArtifactSource(sources[0]))
+	default:
+		opts = append(opts, bond.WithArtifactSource(bond.ChainSources(sources...)))
+	}
+
+	processors := []bond.Processor{}
+	for _, command := range f.processors {
+		processors = append(processors, &bond.CommandProcessor{Command: strings.Fields(command)})
+	}
+	if f.metadata {
+		processors = append(processors, &bond.MetadataProcessor{})
+	}
+	if len(processors) > 0 {
+		opts = append(opts, bond.WithProcessors(processors...))
+	}
+
+	return opts
+}
+
+// logProgress prints the progress of a download to standard error.
+func logProgress(p bond.DownloadProgress) {
+	status := "downloading"
+	if p.Complete {
+		status = "downloaded"
+	}
+	if p.Resumed {
+		status += " (resumed)"
+	}
+
+	if p.Total > 0 {
+		fmt.Fprintf(os.Stderr, "%s %s: %d of %d bytes (%.1f%%)\n", status, p.FileName, p.Written, p.Total, 100*float64(p.Written)/float64(p.Total))
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "%s %s: %d bytes\n", status, p.FileName, p.Written)
+}
+
+// options returns the queue options of the flags.
+func (f *queueFlags) options() (recall.QueueOptions, error) {
+	opts := recall.QueueOptions{
+		Workers:      f.workers,
+		RateLimit:    f.rateLimit,
+		Name:         f.name,
+		Retries:      f.retries,
+		RetryTime:    f.retryTime,
+		RetryBackoff: f.retryBackoff,
+		Extract: recall.ExtractOptions{
+			WriteRate: int64(f.extractRate * (1 << 20)),
+			Sync:      recall.SyncPolicy(f.extractSync),
+		},
+		Tag:          f.tag,
+		Quotas:       f.quotas,
+		MaxPending:   f.maxPending,
+		Labels:       f.labels,
+		Requires:     middleware.Capabilities(f.requires),
+		Capabilities: middleware.Capabilities(f.capabilities),
+	}
+	opts.MongoDB.DB = f.db
+	if err := opts.ParseQueueDriver(f.driver); err != nil {
+		return opts, err
+	}
+	if f.notify != "" {
+		n, err := recall.ReadNotifier(f.notify)
+		if err != nil {
+			return opts, err
+		}
+		opts.Notifier = n
+	}
+
+	return opts, opts.Validate()
+}
+
+// capabilityFlag collects repeated key=value (or key) flags into
+// capabilities.
+type capabilityFlag map[string]string
+
+func (c capabilityFlag) String() string { return middleware.Capabilities(c).String() }
+
+func (c capabilityFlag) Set(val string) error {
+	caps, err := middleware.ParseCapabilities(val)
+	if err != nil {
+		return err
+	}
+	for key, value := range caps {
+		c[key] = value
+	}
+	return nil
+}
+
+// mirrorFlags are the flags that configure the mirrors of the
+// download servers: one for all artifacts, and any number of
+// class=url mirrors for classes of artifacts.
+type mirrorFlags struct {
+	mirrors mirrorListFlag
+	classes classMirrorFlag
+}
+
+func addMirrorFlags(fs *flag.FlagSet) *mirrorFlags {
+	f := &mirrorFlags{classes: classMirrorFlag{}}
+	fs.Var(&f.mirrors, "mirror", "base URL of a mirror of the download servers; may be repeated, to download from the nearest mirror that works (by probing their latency)")
+	fs.Var(f.classes, "class-mirror", "class=url mirror of a class of artifacts (feed, server, debug, tools, or shell), where an empty url uses the download servers; may be repeated")
+	return f
+}
+
+func (f *mirrorFlags) options() []bond.Option {
+	opts := []bond.Option{}
+	switch len(f.mirrors) {
+	case 0:
+	case 1:
+		opts = append(opts, bond.WithMirror(f.mirrors[0]))
+	default:
+		s, err := bond.NewMirrorSelector(bond.MirrorSelectorOptions{Mirrors: f.mirrors})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ignoring mirrors:", err)
+			break
+		}
+		opts = append(opts, bond.WithMirrorSelector(s))
+	}
+	for class, base := range f.classes {
+		opts = append(opts, bond.WithClassMirror(class, base))
+	}
+
+	return opts
+}
+
+// classMirrorFlag collects repeated class=url flags into the mirrors
+// of artifact classes.
+type classMirrorFlag map[bond.ArtifactClass]string
+
+func (m classMirrorFlag) String() string {
+	out := make([]string, 0, len(m))
+	for k, v := range m {
+		out = append(out, string(k)+"="+v)
+	}
+	return strings.Join(out, ",")
+}
+
+func (m classMirrorFlag) Set(val string) error {
+	class, base, err := bond.ParseClassMirror(val)
+	if err != nil {
+		return err
+	}
+	m[class] = base
+	return nil
+}
+
+// quotaFlag collects repeated tag=pending:running flags into quotas.
+type quotaFlag map[string]middleware.Quota
+
+func (q quotaFlag) String() string {
+	out := make([]string, 0, len(q))
+	for tag, quota := range q {
+		out = append(out, fmt.Sprintf("%s=%d:%d", tag, quota.MaxPending, quota.MaxRunning))
+	}
+	return strings.Join(out, ",")
+}
+
+func (q quotaFlag) Set(val string) error {
+	tag, quota, err := middleware.ParseQuota(val)
+	if err != nil {
+		return err
+	}
+	q[tag] = quota
+	return nil
+}
+
+// mirrorListFlag collects repeated mirror URL flags.
+type mirrorListFlag []string
+
+func (m *mirrorListFlag) String() string { return strings.Join(*m, ",") }
+
+func (m *mirrorListFlag) Set(val string) error {
+	if err := (bond.MirrorSelectorOptions{Mirrors: []string{val}}).Validate(); err != nil {
+		return err
+	}
+	*m = append(*m, val)
+	return nil
+}
+
+// peerFlag collects repeated peer URL flags.
+type peerFlag []string
+
+func (p *peerFlag) String() string { return strings.Join(*p, ",") }
+
+func (p *peerFlag) Set(val string) error {
+	if err := (sharedcache.PeerOptions{Peers: []string{val}}).Validate(); err != nil {
+		return err
+	}
+	*p = append(*p, val)
+	return nil
+}
+
+// allowedHostFlag collects repeated allowed host flags.
+type allowedHostFlag []string
+
+func (h *allowedHostFlag) String() string { return strings.Join(*h, ",") }
+
+func (h *allowedHostFlag) Set(val string) error {
+	if err := (bond.ClientOptions{AllowedHosts: []string{val}}).Validate(); err != nil {
+		return err
+	}
+	*h = append(*h, val)
+	return nil
+}
+
+// processorFlag collects repeated post-processing commands.
+type processorFlag []string
+
+func (p *processorFlag) String() string { return strings.Join(*p, ";") }
+
+func (p *processorFlag) Set(val string) error {
+	if len(strings.Fields(val)) == 0 {
+		return errors.New("post-processing command must not be empty")
+	}
+	*p = append(*p, val)
+	return nil
+}
+
+// labelFlag collects repeated key=value flags into labels.
+type labelFlag map[string]string
+
+func (l labelFlag) String() string { return management.FormatLabels(l) }
+
+func (l labelFlag) Set(val string) error {
+	labels, err := management.ParseLabels(val)
+	if err != nil {
+		return err
+	}
+	for key, value := range labels {
+		l[key] = value
+	}
+	return nil
+}
+
+// componentsFlag collects repeated component flags.
+type componentsFlag []bond.Component
+
+func (c *componentsFlag) String() string {
+	out := make([]string, 0, len(*c))
+	for _, component := range *c {
+		out = append(out, string(component))
+	}
+	return strings.Join(out, ",")
+}
+
+func (c *componentsFlag) Set(val string) error {
+	component := bond.Component(strings.TrimSpace(val))
+	if err := component.Validate(); err != nil {
+		return err
+	}
+	*c = append(*c, component)
+	return nil
+}
+
+// componentVersionFlag collects repeated component=version flags into
+// the pinned versions of a toolchain.
+type componentVersionFlag map[bond.Component]string
+
+func (v componentVersionFlag) String() string {
+	out := make([]string, 0, len(v))
+	for component, version := range v {
+		out = append(out, string(component)+"="+version)
+	}
+	return strings.Join(out, ",")
+}
+
+func (v componentVersionFlag) Set(val string) error {
+	component, version, err := bond.ParseComponentVersion(val)
+	if err != nil {
+		return err
+	}
+	v[component] = version
+	return nil
+}
+
+// headerFlag collects repeated name=value flags into a header map.
+type headerFlag map[string]string
+
+func (h headerFlag) String() string {
+	out := make([]string, 0, len(h))
+	for k, v := range h {
+		out = append(out, k+"="+v)
+	}
+	return strings.Join(out, ",")
+}
+
+func (h headerFlag) Set(val string) error {
+	parts := strings.SplitN(val, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return errors.Errorf("header '%s' must be name=value", val)
+	}
+	h[parts[0]] = parts[1]
+	return nil
+}
@@ -0,0 +1,40 @@
+package management
+
+import (
+	"context"
+
+	"github.com/mongodb/amboy"
+	"github.com/pkg/errors"
+)
+
+// Admin describes the management operations used by the queue
+// administration commands. The Manager implements Admin for direct
+// access to a driver, and the rest package provides a client that
+// implements Admin for queues managed over HTTP.
+type Admin interface {
+	Stats(context.Context) (amboy.QueueStats, error)
+	FindJobs(context.Context, Filter) ([]JobInfo, error)
+	Job(context.Context, string) (JobInfo, error)
+	RequeueByID(context.Context, string) error
+	Abort(context.Context, string, string) error
+}
+
+// Stats returns the driver's stats.
+func (m *Manager) Stats(ctx context.Context) (amboy.QueueStats, error) {
+	stats := m.driver.Stats(ctx)
+	if ctx.Err() != nil {
+		return stats, errors.Wrap(ctx.Err(), "operation canceled")
+	}
+
+	return stats, nil
+}
+
+// Job returns a summary of the job with the specified ID.
+func (m *Manager) Job(ctx context.Context, id string) (JobInfo, error) {
+	j, err := m.driver.Get(ctx, id)
+	if err != nil {
+		return JobInfo{}, errors.Wrapf(err, "problem finding job '%s'", id)
+	}
+
+	return NewJobInfo(j), nil
+}
@@ -0,0 +1,156 @@
+package management
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AuditEntry records a single management action taken on a job, or a
+// state transition of a job.
+type AuditEntry struct {
+	Time   time.Time `bson:"ts" json:"ts" yaml:"ts"`
+	JobID  string    `bson:"job_id" json:"job_id" yaml:"job_id"`
+	Action string    `bson:"action" json:"action" yaml:"action"`
+	Actor  string    `bson:"actor,omitempty" json:"actor,omitempty" yaml:"actor,omitempty"`
+	Note   string    `bson:"note,omitempty" json:"note,omitempty" yaml:"note,omitempty"`
+	// Environment is the process that dispatched or completed
+	// the job, for transitions.
+	Environment *Environment `bson:"env,omitempty" json:"env,omitempty" yaml:"env,omitempty"`
+}
+
+// Audit actions recorded by the Manager.
+const (
+	ActionRequeue       = "requeue"
+	ActionForceComplete = "force-complete"
+	ActionAbort         = "abort"
+	ActionDelete        = "delete"
+	ActionRecover       = "recover"
+)
+
+// Audit actions for job state transitions, which are recorded by
+// queues that report their transitions to an audit log (see the
+// middleware package.)
+const (
+	ActionDispatch = "dispatch"
+	ActionComplete = "complete"
+	ActionFail     = "fail"
+)
+
+// AuditLog receives a record of every management action. The
+// default log discards all entries. Implementations should be
+// append-only.
+type AuditLog interface {
+	Record(context.Context, AuditEntry) error
+}
+
+// AuditReader is implemented by audit logs that support queries.
+type AuditReader interface {
+	AuditLog
+	Entries(context.Context, AuditQuery) ([]AuditEntry, error)
+}
+
+// AuditQuery selects entries from an audit log. Zero values match
+// all entries.
+type AuditQuery struct {
+	JobID  string    `bson:"job_id" json:"job_id" yaml:"job_id"`
+	Action string    `bson:"action" json:"action" yaml:"action"`
+	Actor  string    `bson:"actor" json:"actor" yaml:"actor"`
+	Since  time.Time `bson:"since" json:"since" yaml:"since"`
+	Until  time.Time `bson:"until" json:"until" yaml:"until"`
+
+	// Limit is the maximum number of entries to return. When
+	// set, queries return the most recent matching entries.
+	Limit int `bson:"limit" json:"limit" yaml:"limit"`
+}
+
+// Validate returns an error if the query is not valid.
+func (q AuditQuery) Validate() error {
+	if q.Limit < 0 {
+		return errors.New("limit must not be negative")
+	}
+
+	if !q.Since.IsZero() && !q.Until.IsZero() && q.Until.Before(q.Since) {
+		return errors.New("until must not be before since")
+	}
+
+	return nil
+}
+
+// Matches reports if the entry is selected by the query, ignoring
+// the limit.
+func (q AuditQuery) Matches(e AuditEntry) bool {
+	switch {
+	case q.JobID != "" && e.JobID != q.JobID:
+		return false
+	case q.Action != "" && e.Action != q.Action:
+		return false
+	case q.Actor != "" && e.Actor != q.Actor:
+		return false
+	case !q.Since.IsZero() && e.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && e.Time.After(q.Until):
+		return false
+	default:
+		return true
+	}
+}
+
+// apply filters entries, which must be in the order they were
+// recorded, and applies the limit.
+func (q AuditQuery) apply(entries []AuditEntry) []AuditEntry {
+	out := []AuditEntry{}
+	for _, e := range entries {
+		if q.Matches(e) {
+			out = append(out, e)
+		}
+	}
+
+	if q.Limit > 0 && len(out) > q.Limit {
+		out = out[len(out)-q.Limit:]
+	}
+
+	return out
+}
+
+type noopAuditLog struct{}
+
+func (noopAuditLog) Record(context.Context, AuditEntry) error { return nil }
+
+// SetAuditLog configures the log that receives entries for every
+// management action, attributed to the specified actor.
+func (m *Manager) SetAuditLog(log AuditLog, actor string) {
+	if log == nil {
+		log = noopAuditLog{}
+	}
+
+	m.audit = log
+	m.actor = actor
+}
+
+// AuditTrail returns the entries in the manager's audit log that
+// match the query, oldest first. The audit log must implement
+// AuditReader.
+func (m *Manager) AuditTrail(ctx context.Context, q AuditQuery) ([]AuditEntry, error) {
+	if err := q.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid audit query")
+	}
+
+	reader, ok := m.audit.(AuditReader)
+	if !ok {
+		return nil, errors.Errorf("audit log %T does not support queries", m.audit)
+	}
+
+	return reader.Entries(ctx, q)
+}
+
+func (m *Manager) record(ctx context.Context, id, action, note string) error {
+	return m.audit.Record(ctx, AuditEntry{
+		Time:   m.clock.Now(),
+		JobID:  id,
+		Action: action,
+		Actor:  m.actor,
+		Note:   note,
+	})
+}
@@ -0,0 +1,110 @@
+package management
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// MemoryAuditLog is an append-only AuditReader that holds entries in
+// memory, for tests and for processes that do not need the trail to
+// outlive them.
+type MemoryAuditLog struct {
+	mu      sync.RWMutex
+	entries []AuditEntry
+}
+
+// NewMemoryAuditLog constructs an empty in-memory audit log.
+func NewMemoryAuditLog() *MemoryAuditLog { return &MemoryAuditLog{} }
+
+// Record appends an entry to the log.
+func (l *MemoryAuditLog) Record(_ context.Context, e AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, e)
+	return nil
+}
+
+// Entries returns the matching entries, oldest first.
+func (l *MemoryAuditLog) Entries(_ context.Context, q AuditQuery) ([]AuditEntry, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return q.apply(l.entries), nil
+}
+
+// FileAuditLog is an append-only AuditReader that persists entries to
+// a file, one JSON document per line. The file is opened for each
+// operation, so multiple processes on the same host may share a log.
+type FileAuditLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileAuditLog constructs an audit log that writes to the file at
+// path, which is created if it does not exist.
+func NewFileAuditLog(path string) *FileAuditLog { return &FileAuditLog{path: path} }
+
+// Record appends an entry to the file.
+func (l *FileAuditLog) Record(_ context.Context, e AuditEntry) error {
+	doc, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "problem encoding audit entry")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "problem opening audit log '%s'", l.path)
+	}
+
+	if _, err = f.Write(append(doc, '\n')); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "problem writing to audit log '%s'", l.path)
+	}
+
+	return errors.Wrapf(f.Close(), "problem closing audit log '%s'", l.path)
+}
+
+// Entries reads the file and returns the matching entries, oldest
+// first. A log that has no file yet has no entries.
+func (l *FileAuditLog) Entries(ctx context.Context, q AuditQuery) ([]AuditEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return []AuditEntry{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem opening audit log '%s'", l.path)
+	}
+	defer f.Close()
+
+	entries := []AuditEntry{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		e := AuditEntry{}
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, errors.Wrapf(err, "problem parsing line %d of audit log '%s'", line, l.path)
+		}
+		entries = append(entries, e)
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "problem reading audit log '%s'", l.path)
+	}
+
+	return q.apply(entries), nil
+}
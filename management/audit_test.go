@@ -0,0 +1,109 @@
+package management
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testAuditReader(t *testing.T, log AuditReader) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	start := time.Now().Round(time.Millisecond)
+	for i, action := range []string{ActionDispatch, ActionFail, ActionRequeue, ActionDispatch, ActionComplete} {
+		require.NoError(t, log.Record(ctx, AuditEntry{
+			Time:   start.Add(time.Duration(i) * time.Minute),
+			JobID:  "download",
+			Action: action,
+		}))
+	}
+	require.NoError(t, log.Record(ctx, AuditEntry{Time: start, JobID: "other", Action: ActionDispatch, Actor: "ops"}))
+
+	entries, err := log.Entries(ctx, AuditQuery{})
+	require.NoError(t, err)
+	assert.Len(entries, 6)
+
+	entries, err = log.Entries(ctx, AuditQuery{JobID: "download", Action: ActionDispatch})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.True(entries[0].Time.Before(entries[1].Time))
+
+	entries, err = log.Entries(ctx, AuditQuery{JobID: "download", Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(ActionComplete, entries[1].Action)
+
+	entries, err = log.Entries(ctx, AuditQuery{Since: start.Add(90 * time.Second), Until: start.Add(3 * time.Minute)})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(ActionRequeue, entries[0].Action)
+
+	entries, err = log.Entries(ctx, AuditQuery{Actor: "ops"})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal("other", entries[0].JobID)
+}
+
+func TestMemoryAuditLog(t *testing.T) {
+	testAuditReader(t, NewMemoryAuditLog())
+}
+
+func TestFileAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bond-audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.jsonl")
+	entries, err := NewFileAuditLog(path).Entries(context.Background(), AuditQuery{})
+	require.NoError(t, err)
+	assert.Len(t, entries, 0)
+
+	testAuditReader(t, NewFileAuditLog(path))
+
+	// entries persist across instances
+	entries, err = NewFileAuditLog(path).Entries(context.Background(), AuditQuery{})
+	require.NoError(t, err)
+	assert.Len(t, entries, 6)
+}
+
+func TestAuditQueryValidation(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+
+	assert.NoError(AuditQuery{}.Validate())
+	assert.Error(AuditQuery{Limit: -1}.Validate())
+	assert.Error(AuditQuery{Since: now, Until: now.Add(-time.Hour)}.Validate())
+}
+
+// auditingDriver stores the audit trail alongside the jobs.
+type auditingDriver struct {
+	queue.Driver
+	*MemoryAuditLog
+}
+
+func (s *ManagerSuite) TestAuditTrailUsesDriverLog() {
+	// the default log does not support queries
+	_, err := s.manager.AuditTrail(s.ctx, AuditQuery{})
+	s.Error(err)
+
+	m := New(&auditingDriver{Driver: s.driver, MemoryAuditLog: NewMemoryAuditLog()})
+	s.addJob("failed", amboy.JobStatusInfo{Completed: true, Errors: []string{"err"}})
+	s.NoError(m.RequeueByID(s.ctx, "failed"))
+
+	entries, err := m.AuditTrail(s.ctx, AuditQuery{JobID: "failed"})
+	s.NoError(err)
+	s.Require().Len(entries, 1)
+	s.Equal(ActionRequeue, entries[0].Action)
+
+	_, err = m.AuditTrail(s.ctx, AuditQuery{Limit: -1})
+	s.Error(err)
+}
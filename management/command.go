@@ -0,0 +1,260 @@
+package management
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// CommandUsage describes the queue administration commands
+// implemented by RunCommand.
+const CommandUsage = `commands:
+  status                    report the queue's stats
+  list [flags]              list jobs (-type, -status, -pattern, -label, -skip, -limit)
+  inspect <id>              print a job's status and timing as JSON
+  requeue <id>...           reset jobs so that they run again
+  abort [-note] <id>...     mark jobs as failed without running them
+  drain [-timeout]          wait until no jobs are pending or running
+  replay [-timeout] <id>    run a copy of a job locally and report the result as JSON`
+
+// RunCommand runs a single queue administration command, where args
+// is the command name followed by its arguments, and writes the
+// output to out. Command line tools can use RunCommand to expose the
+// management API to operators.
+func RunCommand(ctx context.Context, admin Admin, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.Errorf("must specify a command\n%s", CommandUsage)
+	}
+
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "status":
+		return statusCommand(ctx, admin, out)
+	case "list":
+		return listCommand(ctx, admin, args, out)
+	case "inspect":
+		return inspectCommand(ctx, admin, args, out)
+	case "requeue":
+		return requeueCommand(ctx, admin, args, out)
+	case "abort":
+		return abortCommand(ctx, admin, args, out)
+	case "drain":
+		return drainCommand(ctx, admin, args, out)
+	case "replay":
+		return replayCommand(ctx, admin, args, out)
+	default:
+		return errors.Errorf("'%s' is not a valid command\n%s", cmd, CommandUsage)
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return fs
+}
+
+func statusCommand(ctx context.Context, admin Admin, out io.Writer) error {
+	stats, err := admin.Stats(ctx)
+	if err != nil {
+		return errors.Wrap(err, "problem getting queue stats")
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "total:\t%d\n", stats.Total)
+	fmt.Fprintf(w, "pending:\t%d\n", stats.Pending)
+	fmt.Fprintf(w, "running:\t%d\n", stats.Running)
+	fmt.Fprintf(w, "completed:\t%d\n", stats.Completed)
+	fmt.Fprintf(w, "blocked:\t%d\n", stats.Blocked)
+	return w.Flush()
+}
+
+func listCommand(ctx context.Context, admin Admin, args []string, out io.Writer) error {
+	f := Filter{}
+	var status, labels string
+
+	fs := newFlagSet("list")
+	fs.StringVar(&f.Type, "type", "", "only list jobs of this type")
+	fs.StringVar(&f.Pattern, "pattern", "", "only list jobs whose IDs match this regular expression")
+	fs.StringVar(&status, "status", "", "only list jobs with this status (pending, in-progress, completed, failed)")
+	fs.StringVar(&labels, "label", "", "only list jobs with these comma-separated key=value labels")
+	fs.IntVar(&f.Skip, "skip", 0, "number of jobs to skip")
+	fs.IntVar(&f.Limit, "limit", 100, "maximum number of jobs to list (0 for all)")
+	if err := fs.Parse(args); err != nil {
+		return errors.Wrap(err, "problem parsing arguments")
+	}
+	f.Status = JobStatus(status)
+	var err error
+	if f.Labels, err = ParseLabels(labels); err != nil {
+		return err
+	}
+
+	jobs, err := admin.FindJobs(ctx, f)
+	if err != nil {
+		return errors.Wrap(err, "problem finding jobs")
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTYPE\tSTATUS\tCREATED")
+	for _, j := range jobs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", j.ID, j.Type.Name, describeStatus(j), j.TimeInfo.Created.Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+func describeStatus(j JobInfo) JobStatus {
+	switch {
+	case j.Status.Completed && len(j.Status.Errors) > 0:
+		return StatusFailed
+	case j.Status.Completed:
+		return StatusCompleted
+	case j.Status.InProgress:
+		return StatusInProgress
+	default:
+		return StatusPending
+	}
+}
+
+func inspectCommand(ctx context.Context, admin Admin, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("inspect requires exactly one job id")
+	}
+
+	info, err := admin.Job(ctx, args[0])
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(info), "problem rendering job")
+}
+
+func requeueCommand(ctx context.Context, admin Admin, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("requeue requires at least one job id")
+	}
+
+	catcher := grip.NewBasicCatcher()
+	for _, id := range args {
+		if err := admin.RequeueByID(ctx, id); err != nil {
+			catcher.Add(err)
+			continue
+		}
+		fmt.Fprintf(out, "requeued %s\n", id)
+	}
+
+	return catcher.Resolve()
+}
+
+func abortCommand(ctx context.Context, admin Admin, args []string, out io.Writer) error {
+	var note string
+	fs := newFlagSet("abort")
+	fs.StringVar(&note, "note", "", "reason for aborting, recorded in the audit log")
+	if err := fs.Parse(args); err != nil {
+		return errors.Wrap(err, "problem parsing arguments")
+	}
+
+	if fs.NArg() == 0 {
+		return errors.New("abort requires at least one job id")
+	}
+
+	catcher := grip.NewBasicCatcher()
+	for _, id := range fs.Args() {
+		if err := admin.Abort(ctx, id, note); err != nil {
+			catcher.Add(err)
+			continue
+		}
+		fmt.Fprintf(out, "aborted %s\n", id)
+	}
+
+	return catcher.Resolve()
+}
+
+func drainCommand(ctx context.Context, admin Admin, args []string, out io.Writer) error {
+	var timeout, interval time.Duration
+	fs := newFlagSet("drain")
+	fs.DurationVar(&timeout, "timeout", 0, "maximum time to wait (0 waits indefinitely)")
+	fs.DurationVar(&interval, "interval", time.Second, "how often to check the queue")
+	if err := fs.Parse(args); err != nil {
+		return errors.Wrap(err, "problem parsing arguments")
+	}
+	if interval <= 0 {
+		return errors.New("interval must be positive")
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		stats, err := admin.Stats(ctx)
+		if err != nil {
+			return errors.Wrap(err, "problem getting queue stats")
+		}
+
+		remaining := stats.Pending + stats.Running
+		if remaining <= 0 {
+			fmt.Fprintln(out, "queue is drained")
+			return nil
+		}
+		fmt.Fprintf(out, "waiting for %d jobs (%d pending, %d running)\n", remaining, stats.Pending, stats.Running)
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "queue did not drain")
+		case <-ticker.C:
+		}
+	}
+}
+
+func replayCommand(ctx context.Context, admin Admin, args []string, out io.Writer) error {
+	var timeout time.Duration
+	fs := newFlagSet("replay")
+	fs.DurationVar(&timeout, "timeout", 0, "maximum time to run the job (0 runs it to completion)")
+	if err := fs.Parse(args); err != nil {
+		return errors.Wrap(err, "problem parsing arguments")
+	}
+	if fs.NArg() != 1 {
+		return errors.New("replay requires exactly one job id")
+	}
+
+	replayer, ok := admin.(Replayer)
+	if !ok {
+		return errors.New("replay requires direct access to the queue's driver")
+	}
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	report, err := replayer.ReplayJob(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(report); err != nil {
+		return errors.Wrap(err, "problem rendering replay")
+	}
+	if report.Failed() {
+		return errors.Errorf("replay of job '%s' failed", report.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package management
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/mongodb/amboy"
+)
+
+func (s *ManagerSuite) runCommand(args ...string) (string, error) {
+	out := &bytes.Buffer{}
+	err := RunCommand(s.ctx, s.manager, args, out)
+	return out.String(), err
+}
+
+func (s *ManagerSuite) TestCommandsRequireValidCommand() {
+	_, err := s.runCommand()
+	s.Error(err)
+	_, err = s.runCommand("explode")
+	s.Error(err)
+}
+
+func (s *ManagerSuite) TestStatusAndListCommands() {
+	s.addJob("download-one", amboy.JobStatusInfo{Completed: true, Errors: []string{"404"}})
+	s.addJob("download-two", amboy.JobStatusInfo{Completed: true})
+	s.addJob("extract-one", amboy.JobStatusInfo{InProgress: true})
+
+	out, err := s.runCommand("status")
+	s.NoError(err)
+	s.Contains(out, "total:")
+	s.Contains(out, "3")
+
+	out, err = s.runCommand("list", "-status", "failed")
+	s.NoError(err)
+	s.Contains(out, "download-one")
+	s.Contains(out, "failed")
+	s.NotContains(out, "download-two")
+
+	out, err = s.runCommand("list", "-pattern", "^extract")
+	s.NoError(err)
+	s.Contains(out, "extract-one")
+	s.Contains(out, "in-progress")
+
+	_, err = s.runCommand("list", "-status", "broken")
+	s.Error(err)
+	_, err = s.runCommand("list", "-unknown-flag")
+	s.Error(err)
+}
+
+func (s *ManagerSuite) TestInspectCommand() {
+	s.addJob("download-one", amboy.JobStatusInfo{Completed: true})
+
+	out, err := s.runCommand("inspect", "download-one")
+	s.NoError(err)
+	info := JobInfo{}
+	s.NoError(json.Unmarshal([]byte(out), &info))
+	s.Equal("download-one", info.ID)
+	s.True(info.Status.Completed)
+
+	_, err = s.runCommand("inspect")
+	s.Error(err)
+	_, err = s.runCommand("inspect", "does-not-exist")
+	s.Error(err)
+}
+
+func (s *ManagerSuite) TestRequeueAndAbortCommands() {
+	s.addJob("failed", amboy.JobStatusInfo{Completed: true, Errors: []string{"err"}})
+	s.addJob("wedged", amboy.JobStatusInfo{InProgress: true})
+
+	out, err := s.runCommand("requeue", "failed", "does-not-exist")
+	s.Error(err)
+	s.Contains(out, "requeued failed")
+	s.False(s.jobStatus("failed").Completed)
+
+	out, err = s.runCommand("abort", "-note", "mirror down", "wedged")
+	s.NoError(err)
+	s.Contains(out, "aborted wedged")
+	s.Equal([]string{"aborted: mirror down"}, s.jobStatus("wedged").Errors)
+
+	_, err = s.runCommand("requeue")
+	s.Error(err)
+	_, err = s.runCommand("abort", "-note", "x")
+	s.Error(err)
+}
+
+func (s *ManagerSuite) TestDrainCommand() {
+	out, err := s.runCommand("drain")
+	s.NoError(err)
+	s.Contains(out, "drained")
+
+	s.addJob("pending", amboy.JobStatusInfo{})
+	_, err = s.runCommand("drain", "-timeout", "20ms", "-interval", "5ms")
+	s.Error(err)
+
+	_, err = s.runCommand("drain", "-interval", "0")
+	s.Error(err)
+}
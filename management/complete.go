@@ -0,0 +1,85 @@
+package management
+
+import (
+	"context"
+
+	"github.com/mongodb/amboy"
+	"github.com/pkg/errors"
+)
+
+// Deleter is implemented by drivers that can remove jobs from their
+// storage. None of the amboy drivers support deleting jobs, but
+// drivers may implement this interface to support Manager.Delete.
+type Deleter interface {
+	Delete(context.Context, string) error
+}
+
+// ForceComplete marks the job with the specified ID complete
+// without running it, which clears "poison" jobs that will never
+// succeed. The note is recorded in the audit log.
+func (m *Manager) ForceComplete(ctx context.Context, id, note string) error {
+	j, err := m.driver.Get(ctx, id)
+	if err != nil {
+		return errors.Wrapf(err, "problem finding job '%s'", id)
+	}
+
+	stat := j.Status()
+	stat.Completed = true
+	stat.InProgress = false
+	j.SetStatus(stat)
+
+	if err = m.driver.Save(ctx, j); err != nil {
+		return errors.Wrapf(err, "problem saving job '%s'", id)
+	}
+
+	return errors.Wrap(m.record(ctx, id, ActionForceComplete, note), "problem recording audit entry")
+}
+
+// Abort marks the job with the specified ID complete, with an error
+// recording that it was aborted, so that it is reported as failed
+// and can be requeued later. Abort does not interrupt a running job:
+// use the queue's runner (amboy.AbortableRunner) for that. The note
+// is recorded in the audit log.
+func (m *Manager) Abort(ctx context.Context, id, note string) error {
+	j, err := m.driver.Get(ctx, id)
+	if err != nil {
+		return errors.Wrapf(err, "problem finding job '%s'", id)
+	}
+
+	abortStatus(j, note)
+
+	if err = m.driver.Save(ctx, j); err != nil {
+		return errors.Wrapf(err, "problem saving job '%s'", id)
+	}
+
+	return errors.Wrap(m.record(ctx, id, ActionAbort, note), "problem recording audit entry")
+}
+
+func abortStatus(j amboy.Job, note string) {
+	stat := j.Status()
+	stat.Completed = true
+	stat.InProgress = false
+	j.SetStatus(stat)
+
+	if note == "" {
+		j.AddError(errors.New("aborted"))
+	} else {
+		j.AddError(errors.Errorf("aborted: %s", note))
+	}
+}
+
+// Delete removes the job with the specified ID from the driver, if
+// the driver implements the Deleter interface. The note is recorded
+// in the audit log.
+func (m *Manager) Delete(ctx context.Context, id, note string) error {
+	d, ok := m.driver.(Deleter)
+	if !ok {
+		return errors.Errorf("driver %T does not support deleting jobs", m.driver)
+	}
+
+	if err := d.Delete(ctx, id); err != nil {
+		return errors.Wrapf(err, "problem deleting job '%s'", id)
+	}
+
+	return errors.Wrap(m.record(ctx, id, ActionDelete, note), "problem recording audit entry")
+}
@@ -0,0 +1,109 @@
+package management
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+)
+
+// deletingDriver adds support for deleting jobs to the internal
+// driver, by hiding deleted jobs.
+type deletingDriver struct {
+	queue.Driver
+	deleted map[string]struct{}
+	mu      sync.Mutex
+}
+
+func (d *deletingDriver) Delete(ctx context.Context, id string) error {
+	if _, err := d.Get(ctx, id); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deleted[id] = struct{}{}
+	return nil
+}
+
+func (d *deletingDriver) Get(ctx context.Context, id string) (amboy.Job, error) {
+	d.mu.Lock()
+	_, ok := d.deleted[id]
+	d.mu.Unlock()
+	if ok {
+		return nil, errors.Errorf("no job named %s exists", id)
+	}
+
+	return d.Driver.Get(ctx, id)
+}
+
+func (s *ManagerSuite) TestForceCompleteRecordsAuditEntry() {
+	log := NewMemoryAuditLog()
+	s.manager.SetAuditLog(log, "operator")
+	s.addJob("poison", amboy.JobStatusInfo{InProgress: true})
+
+	s.NoError(s.manager.ForceComplete(s.ctx, "poison", "bad url, will never succeed"))
+	stat := s.jobStatus("poison")
+	s.True(stat.Completed)
+	s.False(stat.InProgress)
+
+	s.Require().Len(log.entries, 1)
+	s.Equal(ActionForceComplete, log.entries[0].Action)
+	s.Equal("poison", log.entries[0].JobID)
+	s.Equal("operator", log.entries[0].Actor)
+	s.Equal("bad url, will never succeed", log.entries[0].Note)
+
+	s.Error(s.manager.ForceComplete(s.ctx, "does-not-exist", ""))
+	s.Len(log.entries, 1)
+}
+
+func (s *ManagerSuite) TestRequeueRecordsAuditEntries() {
+	log := NewMemoryAuditLog()
+	s.manager.SetAuditLog(log, "")
+	s.addJob("failed", amboy.JobStatusInfo{Completed: true, Errors: []string{"err"}})
+
+	_, err := s.manager.RequeueFailed(s.ctx, Filter{})
+	s.NoError(err)
+	s.Require().Len(log.entries, 1)
+	s.Equal(ActionRequeue, log.entries[0].Action)
+}
+
+func (s *ManagerSuite) TestAbortMarksJobFailed() {
+	log := NewMemoryAuditLog()
+	s.manager.SetAuditLog(log, "operator")
+	s.addJob("wedged", amboy.JobStatusInfo{InProgress: true})
+
+	s.NoError(s.manager.Abort(s.ctx, "wedged", "mirror is down"))
+	stat := s.jobStatus("wedged")
+	s.True(stat.Completed)
+	s.False(stat.InProgress)
+	s.Equal([]string{"aborted: mirror is down"}, stat.Errors)
+
+	s.Require().Len(log.entries, 1)
+	s.Equal(ActionAbort, log.entries[0].Action)
+
+	s.Error(s.manager.Abort(s.ctx, "does-not-exist", ""))
+}
+
+func (s *ManagerSuite) TestDeleteRequiresDriverSupport() {
+	s.addJob("poison", amboy.JobStatusInfo{})
+	s.Error(s.manager.Delete(s.ctx, "poison", ""))
+}
+
+func (s *ManagerSuite) TestDelete() {
+	log := NewMemoryAuditLog()
+	m := New(&deletingDriver{Driver: s.driver, deleted: map[string]struct{}{}})
+	m.SetAuditLog(log, "operator")
+	s.addJob("poison", amboy.JobStatusInfo{})
+
+	s.NoError(m.Delete(s.ctx, "poison", "cleanup"))
+	_, err := m.Driver().Get(s.ctx, "poison")
+	s.Error(err)
+	s.Require().Len(log.entries, 1)
+	s.Equal(ActionDelete, log.entries[0].Action)
+
+	s.Error(m.Delete(s.ctx, "poison", "cleanup"))
+	s.Len(log.entries, 1)
+}
@@ -0,0 +1,129 @@
+package management
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// The versions of bond and of the queue that the process runs, which
+// builds may set with -ldflags (e.g. "-X
+// github.com/tychoish/bond/management.BondVersion=v1.2.0"). When
+// unset, they're read from the binary's module information, if it
+// has any, and are otherwise "unknown".
+var (
+	BondVersion  string
+	QueueVersion string
+)
+
+const (
+	bondModule  = "github.com/tychoish/bond"
+	queueModule = "github.com/mongodb/amboy"
+)
+
+// Environment describes the process that dispatched or completed a
+// job, so that failures of jobs in distributed queues can be traced
+// to the machine and the build of the binary that ran them.
+type Environment struct {
+	Time         time.Time `bson:"ts" json:"ts" yaml:"ts"`
+	Host         string    `bson:"host" json:"host" yaml:"host"`
+	PID          int       `bson:"pid" json:"pid" yaml:"pid"`
+	GoVersion    string    `bson:"go_version" json:"go_version" yaml:"go_version"`
+	Platform     string    `bson:"platform" json:"platform" yaml:"platform"`
+	BondVersion  string    `bson:"bond_version" json:"bond_version" yaml:"bond_version"`
+	QueueVersion string    `bson:"queue_version" json:"queue_version" yaml:"queue_version"`
+	// Fingerprint is a short hash of the Go version, platform, and
+	// versions of bond and the queue, so that environments that
+	// would run a job the same way have the same fingerprint.
+	Fingerprint string `bson:"fingerprint,omitempty" json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+}
+
+// fingerprinted are the fields of environments that affect how jobs
+// run, unlike the host, process, and time.
+func (e Environment) fingerprinted() [][2]string {
+	return [][2]string{
+		{"go_version", e.GoVersion},
+		{"platform", e.Platform},
+		{"bond_version", e.BondVersion},
+		{"queue_version", e.QueueVersion},
+	}
+}
+
+func (e Environment) fingerprint() string {
+	h := sha256.New()
+	for _, field := range e.fingerprinted() {
+		fmt.Fprintf(h, "%s=%s\n", field[0], field[1])
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// Differences describes the fields of the fingerprints of the
+// environments that differ, as "field: this != other", in order.
+func (e Environment) Differences(other Environment) []string {
+	theirs := other.fingerprinted()
+	out := []string{}
+	for idx, field := range e.fingerprinted() {
+		if field[1] != theirs[idx][1] {
+			out = append(out, fmt.Sprintf("%s: %s != %s", field[0], field[1], theirs[idx][1]))
+		}
+	}
+
+	return out
+}
+
+var (
+	environmentOnce sync.Once
+	environment     Environment
+)
+
+// CurrentEnvironment returns the environment of the process, at the
+// current time.
+func CurrentEnvironment() Environment {
+	environmentOnce.Do(func() {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "unknown"
+		}
+
+		environment = Environment{
+			Host:         host,
+			PID:          os.Getpid(),
+			GoVersion:    runtime.Version(),
+			Platform:     runtime.GOOS + "/" + runtime.GOARCH,
+			BondVersion:  moduleVersion(BondVersion, bondModule),
+			QueueVersion: moduleVersion(QueueVersion, queueModule),
+		}
+		environment.Fingerprint = environment.fingerprint()
+	})
+
+	env := environment
+	env.Time = time.Now()
+	return env
+}
+
+// moduleVersion returns the version, if it's set, or the version of
+// the module in the binary's build information.
+func moduleVersion(version, module string) string {
+	if version != "" {
+		return version
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if info.Main.Path == module && info.Main.Version != "" {
+			return info.Main.Version
+		}
+		for _, dep := range info.Deps {
+			if dep.Path == module {
+				return dep.Version
+			}
+		}
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,122 @@
+package management
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/pkg/errors"
+)
+
+// maxErrorExamples is the number of example job IDs retained for
+// each group of errors.
+const maxErrorExamples = 5
+
+// ErrorGroup summarizes failed jobs, of a single type, that
+// reported the same (normalized) error.
+type ErrorGroup struct {
+	JobType  string    `bson:"job_type" json:"job_type" yaml:"job_type"`
+	Message  string    `bson:"message" json:"message" yaml:"message"`
+	Count    int       `bson:"count" json:"count" yaml:"count"`
+	Examples []string  `bson:"examples" json:"examples" yaml:"examples"`
+	Latest   time.Time `bson:"latest" json:"latest" yaml:"latest"`
+}
+
+// ErrorReport groups jobs that failed within the window by job type
+// and normalized error message, answering "what is failing and why"
+// in one call. Groups are ordered by count, largest first. A window
+// of zero includes all failed jobs.
+func (m *Manager) ErrorReport(ctx context.Context, window time.Duration) ([]ErrorGroup, error) {
+	var cutoff time.Time
+	if window > 0 {
+		cutoff = m.clock.Now().Add(-window)
+	}
+
+	jobs, err := m.find(ctx, Filter{Status: StatusFailed}, func(j amboy.Job) bool {
+		return cutoff.IsZero() || finishedAt(j).After(cutoff)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "problem finding failed jobs")
+	}
+
+	type groupKey struct{ jobType, msg string }
+	groups := map[groupKey]*ErrorGroup{}
+
+	for _, j := range jobs {
+		messages := j.Status().Errors
+		if len(messages) == 0 && j.Error() != nil {
+			messages = []string{j.Error().Error()}
+		}
+
+		seen := map[string]struct{}{}
+		for _, msg := range messages {
+			key := groupKey{jobType: j.Type().Name, msg: NormalizeError(msg)}
+			if _, ok := seen[key.msg]; ok {
+				continue
+			}
+			seen[key.msg] = struct{}{}
+
+			group, ok := groups[key]
+			if !ok {
+				group = &ErrorGroup{JobType: key.jobType, Message: key.msg}
+				groups[key] = group
+			}
+
+			group.Count++
+			if len(group.Examples) < maxErrorExamples {
+				group.Examples = append(group.Examples, j.ID())
+			}
+			if ts := finishedAt(j); ts.After(group.Latest) {
+				group.Latest = ts
+			}
+		}
+	}
+
+	out := make([]ErrorGroup, 0, len(groups))
+	for _, g := range groups {
+		sort.Strings(g.Examples)
+		out = append(out, *g)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		if out[i].JobType != out[j].JobType {
+			return out[i].JobType < out[j].JobType
+		}
+		return out[i].Message < out[j].Message
+	})
+
+	return out, nil
+}
+
+var (
+	quotedStrings = regexp.MustCompile(`'[^']*'|"[^"]*"`)
+	hexStrings    = regexp.MustCompile(`\b[0-9a-fA-F]{8,}\b`)
+	numbers       = regexp.MustCompile(`\d+`)
+	whitespace    = regexp.MustCompile(`\s+`)
+)
+
+// NormalizeError removes the variable parts of an error message
+// (quoted values, hashes and identifiers, and numbers), so that
+// errors with the same cause can be grouped together.
+func NormalizeError(msg string) string {
+	msg = quotedStrings.ReplaceAllString(msg, "'*'")
+	msg = hexStrings.ReplaceAllString(msg, "*")
+	msg = numbers.ReplaceAllString(msg, "N")
+	msg = whitespace.ReplaceAllString(msg, " ")
+
+	return strings.TrimSpace(msg)
+}
+
+func finishedAt(j amboy.Job) time.Time {
+	if end := j.TimeInfo().End; !end.IsZero() {
+		return end
+	}
+
+	return j.Status().ModificationTime
+}
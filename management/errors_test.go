@@ -0,0 +1,59 @@
+package management
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeError(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("encountered error N (N Not Found) for '*'",
+		NormalizeError("encountered error 404 (404 Not Found) for 'http://example.net/foo.tgz'"))
+	assert.Equal("checksum * does not match",
+		NormalizeError("checksum 8f2c3a9b1d4e5f60 does not match"))
+	assert.Equal("a b", NormalizeError("  a \n b  "))
+}
+
+func (s *ManagerSuite) TestErrorReportGroupsByTypeAndMessage() {
+	now := time.Now()
+	for i := 0; i < 7; i++ {
+		s.addJob(fmt.Sprintf("download-%d", i), amboy.JobStatusInfo{
+			Completed:        true,
+			ModificationTime: now,
+			Errors:           []string{fmt.Sprintf("encountered error 404 for 'mongodb-%d.tgz'", i)},
+		})
+	}
+	s.addJob("timeout", amboy.JobStatusInfo{
+		Completed:        true,
+		ModificationTime: now,
+		Errors:           []string{"context deadline exceeded"},
+	})
+	s.addJob("old", amboy.JobStatusInfo{
+		Completed:        true,
+		ModificationTime: now.Add(-48 * time.Hour),
+		Errors:           []string{"old failure"},
+	})
+	s.addJob("succeeded", amboy.JobStatusInfo{Completed: true, ModificationTime: now})
+
+	report, err := s.manager.ErrorReport(s.ctx, time.Hour)
+	s.NoError(err)
+	s.Require().Len(report, 2)
+
+	s.Equal("shell", report[0].JobType)
+	s.Equal("encountered error N for '*'", report[0].Message)
+	s.Equal(7, report[0].Count)
+	s.Len(report[0].Examples, maxErrorExamples)
+
+	s.Equal("context deadline exceeded", report[1].Message)
+	s.Equal(1, report[1].Count)
+	s.Equal([]string{"timeout"}, report[1].Examples)
+
+	report, err = s.manager.ErrorReport(s.ctx, 0)
+	s.NoError(err)
+	s.Len(report, 3)
+}
@@ -0,0 +1,107 @@
+package management
+
+import (
+	"context"
+	"sort"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+)
+
+// JobInfo is a summary of a job, without the job's payload.
+type JobInfo struct {
+	ID       string              `bson:"id" json:"id" yaml:"id"`
+	Type     amboy.JobType       `bson:"type" json:"type" yaml:"type"`
+	Status   amboy.JobStatusInfo `bson:"status" json:"status" yaml:"status"`
+	TimeInfo amboy.JobTimeInfo   `bson:"time_info" json:"time_info" yaml:"time_info"`
+	Labels   map[string]string   `bson:"labels,omitempty" json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// NewJobInfo builds a JobInfo document from a job.
+func NewJobInfo(j amboy.Job) JobInfo {
+	stat := j.Status()
+	stat.ID = j.ID()
+
+	return JobInfo{
+		ID:       j.ID(),
+		Type:     j.Type(),
+		Status:   stat,
+		TimeInfo: j.TimeInfo(),
+		Labels:   LabelsOf(j),
+	}
+}
+
+// JobFinder is implemented by drivers that filter and paginate jobs
+// themselves, rather than returning every job from Jobs to be
+// filtered by FindJobs. Implementations must return an error for
+// invalid filters (Filter.Matcher compiles and validates a filter
+// once), must return results ordered by creation time and then ID,
+// and must respect the filter's Skip and Limit.
+//
+// Only the in-memory drivers (driver.Aging and drivertest.Driver)
+// filter jobs themselves; the driver package's wrappers pass FindJobs
+// through to the drivers they wrap, and other drivers, including
+// amboy's MongoDB drivers, fall back to reading every job.
+type JobFinder interface {
+	FindJobs(context.Context, Filter) ([]JobInfo, error)
+}
+
+// FindJobs returns summaries of the jobs that match the filter,
+// ordered by creation time (oldest first) and ID, and paginated
+// according to the filter's Skip and Limit values. If the driver
+// implements JobFinder, the driver filters its jobs, otherwise the
+// manager filters all of the driver's jobs.
+func (m *Manager) FindJobs(ctx context.Context, f Filter) ([]JobInfo, error) {
+	return FindJobs(ctx, m.driver, f)
+}
+
+// FindJobs returns summaries of the jobs in the driver that match
+// the filter, as Manager.FindJobs does. Drivers that combine other
+// drivers (e.g. shards) can use FindJobs to search each of them.
+func FindJobs(ctx context.Context, d queue.Driver, f Filter) ([]JobInfo, error) {
+	if finder, ok := d.(JobFinder); ok {
+		return finder.FindJobs(ctx, f)
+	}
+
+	match, err := f.Matcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid filter")
+	}
+
+	out := []JobInfo{}
+	for j := range d.Jobs(ctx) {
+		if match(j) {
+			out = append(out, NewJobInfo(j))
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, errors.Wrap(ctx.Err(), "operation canceled")
+	}
+
+	return Paginate(out, f), nil
+}
+
+// Paginate sorts job summaries by creation time and ID, and returns
+// the page of results described by the filter's Skip and Limit
+// values. Paginate is useful for JobFinder implementations.
+func Paginate(jobs []JobInfo, f Filter) []JobInfo {
+	sort.SliceStable(jobs, func(i, j int) bool {
+		left, right := jobs[i].TimeInfo.Created, jobs[j].TimeInfo.Created
+		if left.Equal(right) {
+			return jobs[i].ID < jobs[j].ID
+		}
+		return left.Before(right)
+	})
+
+	if f.Skip >= len(jobs) {
+		return []JobInfo{}
+	}
+	jobs = jobs[f.Skip:]
+
+	if f.Limit > 0 && f.Limit < len(jobs) {
+		jobs = jobs[:f.Limit]
+	}
+
+	return jobs
+}
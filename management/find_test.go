@@ -0,0 +1,154 @@
+package management
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+)
+
+func (s *ManagerSuite) addJobCreatedAt(id string, created time.Time, stat amboy.JobStatusInfo) {
+	j := job.NewShellJob("true", "")
+	j.SetID(id)
+	j.SetStatus(stat)
+	j.UpdateTimeInfo(amboy.JobTimeInfo{Created: created})
+	s.require.NoError(s.driver.Put(s.ctx, j))
+}
+
+func (s *ManagerSuite) TestFindJobsFiltersByStatus() {
+	now := time.Now()
+	s.addJobCreatedAt("pending", now, amboy.JobStatusInfo{})
+	s.addJobCreatedAt("running", now, amboy.JobStatusInfo{InProgress: true})
+	s.addJobCreatedAt("succeeded", now, amboy.JobStatusInfo{Completed: true})
+	s.addJobCreatedAt("failed", now, amboy.JobStatusInfo{Completed: true, Errors: []string{"err"}})
+
+	for status, expected := range map[JobStatus][]string{
+		StatusAny:        {"failed", "pending", "running", "succeeded"},
+		StatusPending:    {"pending"},
+		StatusInProgress: {"running"},
+		StatusCompleted:  {"failed", "succeeded"},
+		StatusFailed:     {"failed"},
+	} {
+		jobs, err := s.manager.FindJobs(s.ctx, Filter{Status: status})
+		s.NoError(err)
+		ids := []string{}
+		for _, j := range jobs {
+			ids = append(ids, j.ID)
+		}
+		s.Equal(expected, ids, "status=%s", status)
+	}
+}
+
+func (s *ManagerSuite) TestFindJobsFiltersBySubmissionTime() {
+	now := time.Now()
+	s.addJobCreatedAt("old", now.Add(-time.Hour), amboy.JobStatusInfo{})
+	s.addJobCreatedAt("new", now, amboy.JobStatusInfo{})
+
+	jobs, err := s.manager.FindJobs(s.ctx, Filter{SubmittedAfter: now.Add(-time.Minute)})
+	s.NoError(err)
+	s.Require().Len(jobs, 1)
+	s.Equal("new", jobs[0].ID)
+	s.Equal("shell", jobs[0].Type.Name)
+	s.Equal("new", jobs[0].Status.ID)
+}
+
+func (s *ManagerSuite) TestFindJobsPaginatesInCreationOrder() {
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 10; i++ {
+		s.addJobCreatedAt(fmt.Sprintf("job-%d", i), start.Add(time.Duration(i)*time.Minute), amboy.JobStatusInfo{})
+	}
+
+	jobs, err := s.manager.FindJobs(s.ctx, Filter{Pattern: "^job-", Limit: 3})
+	s.NoError(err)
+	s.Require().Len(jobs, 3)
+	s.Equal("job-0", jobs[0].ID)
+	s.Equal("job-2", jobs[2].ID)
+
+	jobs, err = s.manager.FindJobs(s.ctx, Filter{Skip: 8, Limit: 3})
+	s.NoError(err)
+	s.Require().Len(jobs, 2)
+	s.Equal("job-8", jobs[0].ID)
+
+	jobs, err = s.manager.FindJobs(s.ctx, Filter{Skip: 20})
+	s.NoError(err)
+	s.Len(jobs, 0)
+}
+
+type labeledJob struct {
+	*job.ShellJob
+	labels map[string]string
+}
+
+func (j *labeledJob) Labels() map[string]string  { return j.labels }
+func (j *labeledJob) SetLabel(key, value string) { j.labels[key] = value }
+
+func (s *ManagerSuite) TestFindJobsFiltersByLabels() {
+	for id, labels := range map[string]map[string]string{
+		"v70":            {"series": "7.0"},
+		"v70-enterprise": {"series": "7.0", "edition": "enterprise"},
+		"v60":            {"series": "6.0"},
+	} {
+		j := &labeledJob{ShellJob: job.NewShellJob("true", ""), labels: map[string]string{}}
+		j.SetID(id)
+		for key, value := range labels {
+			j.SetLabel(key, value)
+		}
+		s.require.NoError(s.driver.Put(s.ctx, j))
+	}
+	s.addJob("unlabeled", amboy.JobStatusInfo{})
+
+	for selector, expected := range map[string][]string{
+		"series=7.0":                    {"v70", "v70-enterprise"},
+		"series=7.0,edition=enterprise": {"v70-enterprise"},
+		"series=8.0":                    {},
+	} {
+		labels, err := ParseLabels(selector)
+		s.require.NoError(err)
+		jobs, err := s.manager.FindJobs(s.ctx, Filter{Labels: labels})
+		s.NoError(err)
+		ids := []string{}
+		for _, j := range jobs {
+			ids = append(ids, j.ID)
+			s.Equal(labels["series"], j.Labels["series"])
+		}
+		s.Equal(expected, ids, "labels=%s", selector)
+	}
+
+	jobs, err := s.manager.FindJobs(s.ctx, Filter{})
+	s.NoError(err)
+	s.Len(jobs, 4)
+}
+
+func (s *ManagerSuite) TestFindJobsRejectsInvalidFilters() {
+	for _, f := range []Filter{
+		{Status: "bogus"},
+		{Skip: -1},
+		{Limit: -1},
+		{Pattern: "("},
+		{Labels: map[string]string{"": "value"}},
+	} {
+		_, err := s.manager.FindJobs(s.ctx, f)
+		s.Error(err)
+	}
+}
+
+type findingDriver struct {
+	*deletingDriver
+	calls int
+}
+
+func (d *findingDriver) FindJobs(context.Context, Filter) ([]JobInfo, error) {
+	d.calls++
+	return []JobInfo{{ID: "from-driver"}}, nil
+}
+
+func (s *ManagerSuite) TestFindJobsUsesDriverFiltering() {
+	d := &findingDriver{deletingDriver: &deletingDriver{Driver: s.driver}}
+	jobs, err := New(d).FindJobs(s.ctx, Filter{})
+	s.NoError(err)
+	s.Equal(1, d.calls)
+	s.Require().Len(jobs, 1)
+	s.Equal("from-driver", jobs[0].ID)
+}
@@ -0,0 +1,99 @@
+package management
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// Labeled is implemented by jobs that carry labels: arbitrary key and
+// value pairs, set by the submitter and stored with the job, which
+// filters can select (e.g. series=7.0) so that operators can slice the
+// jobs of a queue without encoding metadata into job IDs.
+type Labeled interface {
+	Labels() map[string]string
+	SetLabel(key, value string)
+}
+
+// LabelsOf returns the labels of the job, or nil if the job does not
+// have labels.
+func LabelsOf(j amboy.Job) map[string]string {
+	if lj, ok := j.(Labeled); ok {
+		return lj.Labels()
+	}
+
+	return nil
+}
+
+// ValidateLabels returns an error if any label has an empty key, or a
+// key or value that can't be written by FormatLabels.
+func ValidateLabels(labels map[string]string) error {
+	catcher := grip.NewBasicCatcher()
+	for key, value := range labels {
+		catcher.NewWhen(key == "", "label keys must not be empty")
+		catcher.ErrorfWhen(strings.ContainsAny(key, "=,"), "label key '%s' must not contain '=' or ','", key)
+		catcher.ErrorfWhen(strings.Contains(value, ","), "value of label '%s' must not contain ','", key)
+	}
+
+	return catcher.Resolve()
+}
+
+// ParseLabels parses comma-separated key=value labels, as written by
+// FormatLabels (e.g. "series=7.0,edition=enterprise"). An empty
+// string has no labels.
+func ParseLabels(val string) (map[string]string, error) {
+	if val == "" {
+		return nil, nil
+	}
+
+	labels := map[string]string{}
+	for _, pair := range strings.Split(val, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("label '%s' is not of the form key=value", pair)
+		}
+		labels[parts[0]] = parts[1]
+	}
+
+	if err := ValidateLabels(labels); err != nil {
+		return nil, errors.Wrapf(err, "invalid labels '%s'", val)
+	}
+
+	return labels, nil
+}
+
+// FormatLabels writes labels in the form parsed by ParseLabels, with
+// the keys in order.
+func FormatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+labels[key])
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// MatchLabels reports whether the job has every one of the labels.
+func MatchLabels(j amboy.Job, labels map[string]string) bool {
+	if len(labels) == 0 {
+		return true
+	}
+
+	have := LabelsOf(j)
+	for key, value := range labels {
+		if v, ok := have[key]; !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
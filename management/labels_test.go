@@ -0,0 +1,30 @@
+package management
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	labels, err := ParseLabels("")
+	require.NoError(t, err)
+	assert.Nil(labels)
+
+	labels, err = ParseLabels("series=7.0,edition=enterprise,empty=")
+	require.NoError(t, err)
+	assert.Equal(map[string]string{"series": "7.0", "edition": "enterprise", "empty": ""}, labels)
+	assert.Equal("edition=enterprise,empty=,series=7.0", FormatLabels(labels))
+
+	for _, val := range []string{"series", "=7.0", "series=7.0,"} {
+		_, err = ParseLabels(val)
+		assert.Error(err, val)
+	}
+
+	assert.NoError(ValidateLabels(nil))
+	assert.Error(ValidateLabels(map[string]string{"a=b": "c"}))
+	assert.Error(ValidateLabels(map[string]string{"a": "b,c"}))
+}
@@ -0,0 +1,226 @@
+/*
+Package management provides operator-facing tools for inspecting and
+repairing the jobs stored by an amboy queue driver, so that recovering
+from outages doesn't require editing the database by hand.
+
+All operations work through the queue.Driver interface, and have the
+same consistency properties as the driver: in particular, remote
+drivers only permit modifications to jobs that this process owns or
+whose locks have expired.
+*/
+package management
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/clock"
+)
+
+// Manager wraps a queue.Driver and provides management operations
+// on the jobs that it stores.
+type Manager struct {
+	driver queue.Driver
+	audit  AuditLog
+	actor  string
+	clock  clock.Clock
+}
+
+// New constructs a Manager for the driver. The driver should
+// already be open. If the driver implements AuditLog, the manager
+// records its audit trail in the driver; otherwise the trail is
+// discarded unless a log is configured with SetAuditLog.
+func New(d queue.Driver) *Manager {
+	m := &Manager{
+		driver: d,
+		audit:  noopAuditLog{},
+		clock:  clock.Real(),
+	}
+
+	if log, ok := d.(AuditLog); ok {
+		m.audit = log
+	}
+
+	return m
+}
+
+// Driver returns the underlying driver.
+func (m *Manager) Driver() queue.Driver { return m.driver }
+
+// SetClock replaces the clock that the manager uses for time windows,
+// stuck job durations, and audit timestamps. A nil clock restores the
+// system clock.
+func (m *Manager) SetClock(c clock.Clock) { m.clock = clock.Or(c) }
+
+// JobStatus describes the state of a job, for filtering.
+type JobStatus string
+
+// Values for JobStatus. An empty JobStatus matches all jobs.
+const (
+	StatusAny        JobStatus = ""
+	StatusPending    JobStatus = "pending"
+	StatusInProgress JobStatus = "in-progress"
+	StatusCompleted  JobStatus = "completed"
+	StatusFailed     JobStatus = "failed"
+)
+
+// Validate returns an error if the status is not a known value.
+func (s JobStatus) Validate() error {
+	switch s {
+	case StatusAny, StatusPending, StatusInProgress, StatusCompleted, StatusFailed:
+		return nil
+	default:
+		return errors.Errorf("'%s' is not a valid job status", s)
+	}
+}
+
+// Matches reports if the job matches the status. Completed matches
+// all completed jobs, while failed only matches completed jobs with
+// errors.
+func (s JobStatus) Matches(j amboy.Job) bool {
+	stat := j.Status()
+
+	switch s {
+	case StatusPending:
+		return !stat.Completed && !stat.InProgress
+	case StatusInProgress:
+		return !stat.Completed && stat.InProgress
+	case StatusCompleted:
+		return stat.Completed
+	case StatusFailed:
+		return stat.Completed && (len(stat.Errors) > 0 || j.Error() != nil)
+	default:
+		return true
+	}
+}
+
+// Filter describes a selection of jobs. The zero value matches all
+// jobs.
+type Filter struct {
+	// Type, if specified, selects only jobs of this type.
+	Type string `bson:"type,omitempty" json:"type,omitempty" yaml:"type,omitempty"`
+
+	// Pattern, if specified, is a regular expression that job
+	// IDs must match.
+	Pattern string `bson:"pattern,omitempty" json:"pattern,omitempty" yaml:"pattern,omitempty"`
+
+	// Status, if specified, selects only jobs in this state.
+	Status JobStatus `bson:"status,omitempty" json:"status,omitempty" yaml:"status,omitempty"`
+
+	// SubmittedAfter, if specified, selects only jobs created
+	// after this time.
+	SubmittedAfter time.Time `bson:"submitted_after,omitempty" json:"submitted_after,omitempty" yaml:"submitted_after,omitempty"`
+
+	// Labels, if specified, selects only jobs that have all of
+	// these labels (see Labeled).
+	Labels map[string]string `bson:"labels,omitempty" json:"labels,omitempty" yaml:"labels,omitempty"`
+
+	// Skip and Limit paginate the results of FindJobs, and are
+	// ignored by other operations. A zero Limit returns all
+	// results.
+	Skip  int `bson:"skip,omitempty" json:"skip,omitempty" yaml:"skip,omitempty"`
+	Limit int `bson:"limit,omitempty" json:"limit,omitempty" yaml:"limit,omitempty"`
+}
+
+// Validate returns an error for invalid filters.
+func (f Filter) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(f.Status.Validate())
+	catcher.NewWhen(f.Skip < 0, "skip must not be negative")
+	catcher.NewWhen(f.Limit < 0, "limit must not be negative")
+	if f.Pattern != "" {
+		_, err := regexp.Compile(f.Pattern)
+		catcher.Add(errors.Wrapf(err, "invalid pattern '%s'", f.Pattern))
+	}
+	catcher.Add(ValidateLabels(f.Labels))
+
+	return catcher.Resolve()
+}
+
+// Matches reports if the job matches the filter. Matches ignores
+// invalid patterns; use Validate to check filters before use.
+func (f Filter) Matches(j amboy.Job) bool {
+	match, err := f.compile()
+	if err != nil {
+		return false
+	}
+
+	return match(j)
+}
+
+// Matcher compiles the filter into a function that reports if jobs
+// match it, returning an error if the filter is invalid. Matcher is
+// useful for drivers that implement JobFinder or StatusUpdater, which
+// test many jobs against one filter.
+func (f Filter) Matcher() (func(amboy.Job) bool, error) {
+	match, err := f.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	return match, nil
+}
+
+type matcher func(amboy.Job) bool
+
+func (f Filter) compile() (matcher, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	var re *regexp.Regexp
+	if f.Pattern != "" {
+		re = regexp.MustCompile(f.Pattern)
+	}
+
+	return func(j amboy.Job) bool {
+		if f.Type != "" && j.Type().Name != f.Type {
+			return false
+		}
+
+		if re != nil && !re.MatchString(j.ID()) {
+			return false
+		}
+
+		if !f.Status.Matches(j) {
+			return false
+		}
+
+		if !f.SubmittedAfter.IsZero() && !j.TimeInfo().Created.After(f.SubmittedAfter) {
+			return false
+		}
+
+		if !MatchLabels(j, f.Labels) {
+			return false
+		}
+
+		return true
+	}, nil
+}
+
+// find iterates over all jobs in the driver and returns those that
+// match both the filter and the predicate.
+func (m *Manager) find(ctx context.Context, f Filter, pred matcher) ([]amboy.Job, error) {
+	match, err := f.compile()
+	if err != nil {
+		return nil, err
+	}
+
+	out := []amboy.Job{}
+	for j := range m.driver.Jobs(ctx) {
+		if match(j) && pred(j) {
+			out = append(out, j)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil, errors.Wrap(ctx.Err(), "operation canceled")
+	}
+
+	return out, nil
+}
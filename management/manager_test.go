@@ -0,0 +1,210 @@
+package management
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ManagerSuite struct {
+	manager *Manager
+	driver  queue.Driver
+	ctx     context.Context
+	cancel  context.CancelFunc
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestManagerSuite(t *testing.T) {
+	suite.Run(t, new(ManagerSuite))
+}
+
+func (s *ManagerSuite) SetupTest() {
+	s.require = s.Require()
+	s.ctx, s.cancel = context.WithTimeout(context.Background(), time.Minute)
+	s.driver = queue.NewInternalDriver()
+	s.require.NoError(s.driver.Open(s.ctx))
+	s.manager = New(s.driver)
+}
+
+func (s *ManagerSuite) TearDownTest() {
+	s.driver.Close()
+	s.cancel()
+}
+
+// addJob puts a shell job into the driver, with the specified
+// status.
+func (s *ManagerSuite) addJob(id string, stat amboy.JobStatusInfo) amboy.Job {
+	j := job.NewShellJob("true", "")
+	j.SetID(id)
+	j.SetStatus(stat)
+	s.require.NoError(s.driver.Put(s.ctx, j))
+	return j
+}
+
+func (s *ManagerSuite) jobStatus(id string) amboy.JobStatusInfo {
+	j, err := s.driver.Get(s.ctx, id)
+	s.require.NoError(err)
+	return j.Status()
+}
+
+func (s *ManagerSuite) TestRequeueFailedOnlyTouchesFailedJobs() {
+	s.addJob("download-one", amboy.JobStatusInfo{Completed: true, Errors: []string{"network"}})
+	s.addJob("download-two", amboy.JobStatusInfo{Completed: true})
+	s.addJob("extract-one", amboy.JobStatusInfo{Completed: true, Errors: []string{"disk"}})
+	s.addJob("pending", amboy.JobStatusInfo{})
+
+	ids, err := s.manager.RequeueFailed(s.ctx, Filter{Pattern: "^download"})
+	s.NoError(err)
+	s.Equal([]string{"download-one"}, ids)
+
+	stat := s.jobStatus("download-one")
+	s.False(stat.Completed)
+	s.Empty(stat.Errors)
+
+	s.True(s.jobStatus("download-two").Completed)
+	s.True(s.jobStatus("extract-one").Completed)
+
+	ids, err = s.manager.RequeueFailed(s.ctx, Filter{})
+	s.NoError(err)
+	s.Equal([]string{"extract-one"}, ids)
+}
+
+func (s *ManagerSuite) TestRequeueFailedFiltersByType() {
+	s.addJob("failed", amboy.JobStatusInfo{Completed: true, Errors: []string{"err"}})
+
+	ids, err := s.manager.RequeueFailed(s.ctx, Filter{Type: "not-shell"})
+	s.NoError(err)
+	s.Empty(ids)
+
+	ids, err = s.manager.RequeueFailed(s.ctx, Filter{Type: "shell"})
+	s.NoError(err)
+	s.Len(ids, 1)
+}
+
+func (s *ManagerSuite) TestInvalidPatternIsAnError() {
+	_, err := s.manager.RequeueFailed(s.ctx, Filter{Pattern: "["})
+	s.Error(err)
+}
+
+func (s *ManagerSuite) TestRequeueByID() {
+	s.addJob("complete", amboy.JobStatusInfo{Completed: true})
+
+	s.NoError(s.manager.RequeueByID(s.ctx, "complete"))
+	s.False(s.jobStatus("complete").Completed)
+
+	s.Error(s.manager.RequeueByID(s.ctx, "does-not-exist"))
+}
+
+func (s *ManagerSuite) TestReleaseStuck() {
+	s.addJob("stuck", amboy.JobStatusInfo{
+		InProgress:       true,
+		Owner:            "crashed-worker",
+		ModificationTime: time.Now().Add(-time.Hour),
+	})
+	s.addJob("running", amboy.JobStatusInfo{
+		InProgress:       true,
+		Owner:            "live-worker",
+		ModificationTime: time.Now(),
+	})
+
+	ids, err := s.manager.ReleaseStuck(s.ctx, 10*time.Minute)
+	s.NoError(err)
+	s.Equal([]string{"stuck"}, ids)
+
+	stat := s.jobStatus("stuck")
+	s.False(stat.InProgress)
+	s.Empty(stat.Owner)
+	s.True(s.jobStatus("running").InProgress)
+}
+
+func (s *ManagerSuite) TestUpdateStatuses() {
+	log := NewMemoryAuditLog()
+	s.manager.SetAuditLog(log, "operator")
+	s.addJob("download-pending", amboy.JobStatusInfo{})
+	s.addJob("download-running", amboy.JobStatusInfo{InProgress: true})
+	s.addJob("download-passed", amboy.JobStatusInfo{Completed: true})
+	s.addJob("extract-pending", amboy.JobStatusInfo{})
+
+	// aborting leaves completed jobs unchanged
+	ids, err := s.manager.UpdateStatuses(s.ctx, Filter{Pattern: "^download"}, TransitionAborted, "maintenance")
+	s.NoError(err)
+	s.Len(ids, 2)
+	s.Contains(ids, "download-pending")
+	s.Contains(ids, "download-running")
+	stat := s.jobStatus("download-running")
+	s.True(stat.Completed)
+	s.False(stat.InProgress)
+	s.False(s.jobStatus("extract-pending").Completed)
+
+	entries, err := s.manager.AuditTrail(s.ctx, AuditQuery{Action: ActionAbort})
+	s.NoError(err)
+	s.Len(entries, 2)
+
+	ids, err = s.manager.UpdateStatuses(s.ctx, Filter{Status: StatusCompleted}, TransitionPending, "")
+	s.NoError(err)
+	s.Len(ids, 3)
+	s.False(s.jobStatus("download-passed").Completed)
+
+	_, err = s.manager.UpdateStatuses(s.ctx, Filter{}, StatusTransition("done"), "")
+	s.Error(err)
+}
+
+func (s *ManagerSuite) TestCanceledContext() {
+	s.addJob("failed", amboy.JobStatusInfo{Completed: true, Errors: []string{"err"}})
+	s.cancel()
+
+	_, err := s.manager.RequeueFailed(s.ctx, Filter{})
+	s.Error(err)
+}
+
+func (s *ManagerSuite) TestRecover() {
+	locked := func(owner string) amboy.JobStatusInfo {
+		return amboy.JobStatusInfo{InProgress: true, Owner: owner, ModificationTime: time.Now(), Errors: []string{"partial"}}
+	}
+	s.addJob("previous-run", locked("downloads.host-a.run-1"))
+	s.addJob("other-host", locked("downloads.host-b.run-1"))
+	s.addJob("other-queue", locked("extracts.host-a.run-1"))
+	s.addJob("pending", amboy.JobStatusInfo{})
+
+	ids, err := s.manager.Recover(s.ctx, "downloads.host-a.run-2", RecoveryPolicy{})
+	s.NoError(err)
+	s.Equal([]string{"previous-run"}, ids)
+	stat := s.jobStatus("previous-run")
+	s.False(stat.InProgress)
+	s.Empty(stat.Owner)
+	s.Empty(stat.Errors)
+	s.True(s.jobStatus("other-host").InProgress)
+	s.True(s.jobStatus("other-queue").InProgress)
+
+	// resumed jobs keep their errors
+	s.addJob("resumed", locked("downloads.host-b.run-1"))
+	ids, err = s.manager.Recover(s.ctx, "downloads.host-b.run-2", RecoveryPolicy{Types: map[string]RecoveryAction{"shell": RecoverResume}})
+	s.NoError(err)
+	s.Len(ids, 2)
+	stat = s.jobStatus("resumed")
+	s.False(stat.InProgress)
+	s.Equal([]string{"partial"}, stat.Errors)
+
+	// recent locks are within the grace period
+	s.addJob("recent", locked("extracts.host-a.run-1"))
+	ids, err = s.manager.Recover(s.ctx, "extracts.host-a.run-2", RecoveryPolicy{Default: RecoverAbort, Grace: time.Hour})
+	s.NoError(err)
+	s.Empty(ids)
+	ids, err = s.manager.Recover(s.ctx, "extracts.host-a.run-2", RecoveryPolicy{Default: RecoverAbort})
+	s.NoError(err)
+	s.Len(ids, 2)
+	s.True(s.jobStatus("recent").Completed)
+
+	_, err = s.manager.Recover(s.ctx, "id", RecoveryPolicy{Default: "restart"})
+	s.Error(err)
+
+	s.Equal("downloads.host.", InstancePrefix("downloads.host.6f1c"))
+	s.Equal("6f1c", InstancePrefix("6f1c"))
+}
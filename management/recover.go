@@ -0,0 +1,183 @@
+package management
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// RecoveryAction is what happens to a job that a previous run of a
+// queue left locked when it crashed.
+type RecoveryAction string
+
+// Values for RecoveryAction.
+const (
+	// RecoverReset resets jobs to a pending state, clearing their
+	// errors, as RequeueByID does.
+	RecoverReset RecoveryAction = "reset"
+	// RecoverResume releases the jobs' locks, keeping their errors
+	// and progress, so that jobs that record their progress resume
+	// where they stopped.
+	RecoverResume RecoveryAction = "resume"
+	// RecoverAbort marks jobs failed, as Abort does, so that an
+	// operator decides whether to requeue them.
+	RecoverAbort RecoveryAction = "abort"
+	// RecoverNone leaves jobs locked until their locks time out.
+	RecoverNone RecoveryAction = "none"
+)
+
+// Validate returns an error if the action is not a known value.
+func (a RecoveryAction) Validate() error {
+	switch a {
+	case RecoverReset, RecoverResume, RecoverAbort, RecoverNone:
+		return nil
+	default:
+		return errors.Errorf("'%s' is not a valid recovery action", a)
+	}
+}
+
+// RecoveryPolicy configures the recovery of the jobs that previous
+// runs of a queue left locked. Actions for a job's type replace the
+// default for jobs of that type.
+type RecoveryPolicy struct {
+	// Default defaults to RecoverReset.
+	Default RecoveryAction            `bson:"default,omitempty" json:"default,omitempty" yaml:"default,omitempty"`
+	Types   map[string]RecoveryAction `bson:"types,omitempty" json:"types,omitempty" yaml:"types,omitempty"`
+	// Grace, if specified, only recovers jobs whose locks have not
+	// been updated for this long, for hosts where several
+	// processes run queues with the same name.
+	Grace time.Duration `bson:"grace,omitempty" json:"grace,omitempty" yaml:"grace,omitempty"`
+}
+
+// Validate returns an error if any action is invalid.
+func (p RecoveryPolicy) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	if p.Default != "" {
+		catcher.Wrap(p.Default.Validate(), "invalid default action")
+	}
+	for name, a := range p.Types {
+		catcher.Wrapf(a.Validate(), "invalid action for '%s' jobs", name)
+	}
+	catcher.NewWhen(p.Grace < 0, "grace must not be negative")
+
+	return catcher.Resolve()
+}
+
+// Action returns the action for jobs of the specified type.
+func (p RecoveryPolicy) Action(jobType string) RecoveryAction {
+	if a, ok := p.Types[jobType]; ok {
+		return a
+	}
+	if p.Default == "" {
+		return RecoverReset
+	}
+
+	return p.Default
+}
+
+// InstancePrefix returns the part of a driver ID that is the same
+// for every run of a queue on a host. amboy's MongoDB drivers have
+// IDs of the form name.host.uuid, with a new uuid for each instance,
+// so the prefix of "downloads.build-01.6f1c..." is
+// "downloads.build-01." IDs without an instance suffix are their own
+// prefix.
+func InstancePrefix(id string) string {
+	idx := strings.LastIndex(id, ".")
+	if idx < 0 {
+		return id
+	}
+
+	return id[:idx+1]
+}
+
+// Reclaimer is implemented by drivers that can take over the jobs that
+// previous runs of a queue left locked. Drivers like amboy's MongoDB
+// drivers only save jobs whose locks they hold, or whose locks have
+// timed out, so they reject changes to the jobs of a crashed run,
+// which are locked by the run's driver ID, until the locks time out.
+// Implementations must save the job regardless of the lock's age and
+// of the driver's own ID, but only if the stored job is still locked
+// by an owner with the prefix, and return an error otherwise.
+type Reclaimer interface {
+	Reclaim(ctx context.Context, j amboy.Job, prefix string) error
+}
+
+// Reclaim writes a job that a previous run of a queue left locked, in
+// one operation if the driver implements Reclaimer, and otherwise
+// saves it. Drivers that combine other drivers (e.g. shards) can use
+// Reclaim to write to each of them.
+func Reclaim(ctx context.Context, d queue.Driver, j amboy.Job, prefix string) error {
+	if r, ok := d.(Reclaimer); ok {
+		return r.Reclaim(ctx, j, prefix)
+	}
+
+	return d.Save(ctx, j)
+}
+
+// Recover finds the jobs that are locked by previous runs of the queue
+// whose driver has the specified ID (that is, by owners with the ID's
+// InstancePrefix), and resets, resumes, or aborts them according to
+// the policy, so that a restart does not leave jobs that appear to be
+// running until their locks time out. Call Recover before the queue
+// starts, as it also recovers the jobs locked by the ID itself. If the
+// driver implements Reclaimer, the recovered jobs are reclaimed, and
+// otherwise they're saved. Each recovered job is recorded in the audit
+// log. Returns the IDs of the recovered jobs.
+func (m *Manager) Recover(ctx context.Context, id string, p RecoveryPolicy) ([]string, error) {
+	if err := p.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid recovery policy")
+	}
+
+	prefix := InstancePrefix(id)
+	cutoff := m.clock.Now().Add(-p.Grace)
+	jobs, err := m.find(ctx, Filter{Status: StatusInProgress}, func(j amboy.Job) bool {
+		stat := j.Status()
+		if stat.Owner == "" || !strings.HasPrefix(stat.Owner, prefix) {
+			return false
+		}
+
+		return p.Grace == 0 || stat.ModificationTime.Before(cutoff)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "problem finding locked jobs")
+	}
+
+	catcher := grip.NewBasicCatcher()
+	ids := []string{}
+	for _, j := range jobs {
+		action := p.Action(j.Type().Name)
+		note := "locked by " + j.Status().Owner
+
+		switch action {
+		case RecoverReset:
+			resetStatus(j)
+		case RecoverResume:
+			releaseLock(j)
+		case RecoverAbort:
+			abortStatus(j, "recovered from a crashed run, "+note)
+		default:
+			continue
+		}
+
+		if err := Reclaim(ctx, m.driver, j, prefix); err != nil {
+			catcher.Wrapf(err, "problem recovering job '%s'", j.ID())
+			continue
+		}
+		ids = append(ids, j.ID())
+		catcher.Wrap(m.record(ctx, j.ID(), ActionRecover, string(action)+": "+note), "problem recording audit entry")
+	}
+
+	return ids, catcher.Resolve()
+}
+
+func releaseLock(j amboy.Job) {
+	stat := j.Status()
+	stat.InProgress = false
+	stat.Owner = ""
+	j.SetStatus(stat)
+}
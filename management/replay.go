@@ -0,0 +1,103 @@
+package management
+
+import (
+	"context"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/registry"
+	"github.com/pkg/errors"
+)
+
+// EnvironmentReporter is implemented by jobs that store the
+// environment of the process that last ran them (see the middleware
+// package's JobEnvironments), so that replays can report how the
+// local environment differs.
+type EnvironmentReporter interface {
+	RecordedEnvironment() (Environment, bool)
+}
+
+// Replayer is implemented by the Admin implementations that can
+// replay jobs locally.
+type Replayer interface {
+	ReplayJob(context.Context, string) (ReplayReport, error)
+}
+
+// ReplayReport describes the local replay of a job.
+type ReplayReport struct {
+	ID   string        `bson:"id" json:"id" yaml:"id"`
+	Type amboy.JobType `bson:"type" json:"type" yaml:"type"`
+	// Recorded is the environment of the process that last ran
+	// the job, if the job stores it.
+	Recorded *Environment `bson:"recorded,omitempty" json:"recorded,omitempty" yaml:"recorded,omitempty"`
+	// Local is the environment of the replay.
+	Local Environment `bson:"local" json:"local" yaml:"local"`
+	// Differences are the fields of the fingerprints of the
+	// recorded and local environments that differ.
+	Differences    []string      `bson:"differences,omitempty" json:"differences,omitempty" yaml:"differences,omitempty"`
+	OriginalErrors []string      `bson:"original_errors,omitempty" json:"original_errors,omitempty" yaml:"original_errors,omitempty"`
+	Errors         []string      `bson:"errors,omitempty" json:"errors,omitempty" yaml:"errors,omitempty"`
+	Duration       time.Duration `bson:"duration" json:"duration" yaml:"duration"`
+}
+
+// Failed reports whether the replay of the job failed.
+func (r ReplayReport) Failed() bool { return len(r.Errors) > 0 }
+
+// ReplayJob runs a copy of the stored job with the specified ID in
+// this process, and reports its result and how this process's
+// environment differs from the environment that last ran the job, so
+// that a failure on a worker can be reproduced and investigated
+// locally. The stored job is not modified, and the replay is not
+// recorded in the audit trail.
+func (m *Manager) ReplayJob(ctx context.Context, id string) (ReplayReport, error) {
+	j, err := m.driver.Get(ctx, id)
+	if err != nil {
+		return ReplayReport{}, errors.Wrapf(err, "problem finding job '%s'", id)
+	}
+
+	return Replay(ctx, j)
+}
+
+// Replay runs a copy of the job, decoded from its serialized payload,
+// in this process, as ReplayJob does. The job's type must be
+// registered with amboy's registry, and the copy runs outside of any
+// queue, with a pending status, so it does not run its queue's
+// middleware (e.g. signature checks or the resolution of
+// parameters, whose results are stored with the job).
+func Replay(ctx context.Context, j amboy.Job) (ReplayReport, error) {
+	payload, err := registry.MakeJobInterchange(j, amboy.JSON)
+	if err != nil {
+		return ReplayReport{}, errors.Wrapf(err, "problem serializing job '%s'", j.ID())
+	}
+
+	replay, err := payload.Resolve(amboy.JSON)
+	if err != nil {
+		return ReplayReport{}, errors.Wrapf(err, "problem copying job '%s'", j.ID())
+	}
+	resetStatus(replay)
+
+	report := ReplayReport{
+		ID:             j.ID(),
+		Type:           j.Type(),
+		Local:          CurrentEnvironment(),
+		OriginalErrors: j.Status().Errors,
+	}
+	if rec, ok := j.(EnvironmentReporter); ok {
+		if env, ok := rec.RecordedEnvironment(); ok {
+			report.Recorded = &env
+			report.Differences = env.Differences(report.Local)
+		}
+	}
+
+	start := time.Now()
+	replay.Run(ctx)
+	report.Duration = time.Since(start)
+	if err := replay.Error(); err != nil {
+		report.Errors = replay.Status().Errors
+		if len(report.Errors) == 0 {
+			report.Errors = []string{err.Error()}
+		}
+	}
+
+	return report, nil
+}
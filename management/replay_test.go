@@ -0,0 +1,68 @@
+package management
+
+import (
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+)
+
+func init() { job.RegisterDefaultJobs() }
+
+func (s *ManagerSuite) TestReplayJobRunsCopy() {
+	s.addJob("worked", amboy.JobStatusInfo{Completed: true})
+	failed := s.addJob("failed-on-worker", amboy.JobStatusInfo{Completed: true, Errors: []string{"exit status 1"}})
+
+	report, err := s.manager.ReplayJob(s.ctx, "failed-on-worker")
+	s.require.NoError(err)
+	s.Equal("failed-on-worker", report.ID)
+	s.Equal(failed.Type(), report.Type)
+	s.Equal([]string{"exit status 1"}, report.OriginalErrors)
+	s.False(report.Failed())
+	s.NotEmpty(report.Local.Fingerprint)
+	s.Nil(report.Recorded)
+
+	// the stored job is unchanged
+	stat := s.jobStatus("failed-on-worker")
+	s.True(stat.Completed)
+	s.Equal([]string{"exit status 1"}, stat.Errors)
+
+	_, err = s.manager.ReplayJob(s.ctx, "does-not-exist")
+	s.Error(err)
+}
+
+func (s *ManagerSuite) TestReplayCommand() {
+	s.addJob("failed-on-worker", amboy.JobStatusInfo{Completed: true, Errors: []string{"exit status 1"}})
+
+	out, err := s.runCommand("replay", "failed-on-worker")
+	s.NoError(err)
+	s.Contains(out, `"id": "failed-on-worker"`)
+	s.Contains(out, "exit status 1")
+
+	failing := job.NewShellJob("false", "")
+	failing.SetID("still-failing")
+	s.require.NoError(s.driver.Put(s.ctx, failing))
+	out, err = s.runCommand("replay", "still-failing")
+	s.Error(err)
+	s.Contains(out, `"errors"`)
+
+	_, err = s.runCommand("replay")
+	s.Error(err)
+	_, err = s.runCommand("replay", "-timeout", "1m", "does-not-exist")
+	s.Error(err)
+}
+
+func (s *ManagerSuite) TestEnvironmentDifferences() {
+	env := CurrentEnvironment()
+	s.Len(env.Fingerprint, 16)
+	s.Equal(env.Fingerprint, CurrentEnvironment().Fingerprint)
+	s.Empty(env.Differences(CurrentEnvironment()))
+
+	worker := env
+	worker.Host = "worker"
+	worker.GoVersion = "go0.1"
+	worker.Platform = "plan9/386"
+	s.NotEqual(env.Fingerprint, worker.fingerprint())
+	s.Equal([]string{
+		"go_version: go0.1 != " + env.GoVersion,
+		"platform: plan9/386 != " + env.Platform,
+	}, worker.Differences(env))
+}
@@ -0,0 +1,86 @@
+package management
+
+import (
+	"context"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// RequeueFailed resets all completed jobs that match the filter and
+// have errors to a pending state, so that the queue will dispatch
+// them again, in one operation if the driver implements
+// StatusUpdater. Returns the IDs of the requeued jobs.
+func (m *Manager) RequeueFailed(ctx context.Context, f Filter) ([]string, error) {
+	switch f.Status {
+	case StatusAny, StatusCompleted, StatusFailed:
+		f.Status = StatusFailed
+	default:
+		// pending and running jobs have not failed
+		if err := f.Validate(); err != nil {
+			return nil, errors.Wrap(err, "invalid filter")
+		}
+		return []string{}, nil
+	}
+
+	ids, err := m.UpdateStatuses(ctx, f, TransitionPending, "")
+	return ids, errors.Wrap(err, "problem requeueing failed jobs")
+}
+
+// RequeueByID resets the job with the specified ID to a pending
+// state, regardless of its current state.
+func (m *Manager) RequeueByID(ctx context.Context, id string) error {
+	j, err := m.driver.Get(ctx, id)
+	if err != nil {
+		return errors.Wrapf(err, "problem finding job '%s'", id)
+	}
+
+	_, err = m.requeue(ctx, []amboy.Job{j})
+	return err
+}
+
+// ReleaseStuck resets all jobs that are marked in progress but whose
+// status has not been modified (i.e. their lock has not been
+// refreshed) within the specified duration. Returns the IDs of the
+// released jobs.
+func (m *Manager) ReleaseStuck(ctx context.Context, olderThan time.Duration) ([]string, error) {
+	cutoff := m.clock.Now().Add(-olderThan)
+	jobs, err := m.find(ctx, Filter{}, func(j amboy.Job) bool {
+		stat := j.Status()
+		return stat.InProgress && !stat.Completed && stat.ModificationTime.Before(cutoff)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "problem finding stuck jobs")
+	}
+
+	return m.requeue(ctx, jobs)
+}
+
+func (m *Manager) requeue(ctx context.Context, jobs []amboy.Job) ([]string, error) {
+	catcher := grip.NewBasicCatcher()
+	ids := []string{}
+
+	for _, j := range jobs {
+		resetStatus(j)
+		if err := m.driver.Save(ctx, j); err != nil {
+			catcher.Add(errors.Wrapf(err, "problem requeueing job '%s'", j.ID()))
+			continue
+		}
+		ids = append(ids, j.ID())
+		catcher.Add(m.record(ctx, j.ID(), ActionRequeue, ""))
+	}
+
+	return ids, catcher.Resolve()
+}
+
+func resetStatus(j amboy.Job) {
+	stat := j.Status()
+	stat.Completed = false
+	stat.InProgress = false
+	stat.Owner = ""
+	stat.Errors = nil
+	stat.ErrorCount = 0
+	j.SetStatus(stat)
+}
@@ -0,0 +1,143 @@
+package management
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/pkg/errors"
+)
+
+// RetentionRule defines how long completed jobs are kept. Successful
+// and failed jobs have separate ages, so that failures can be kept
+// for longer than successes. Zero values keep jobs indefinitely.
+type RetentionRule struct {
+	// MaxAge is how long successful jobs are kept after they
+	// finish.
+	MaxAge time.Duration `bson:"max_age" json:"max_age" yaml:"max_age"`
+	// FailedMaxAge is how long failed jobs are kept after they
+	// finish.
+	FailedMaxAge time.Duration `bson:"failed_max_age" json:"failed_max_age" yaml:"failed_max_age"`
+	// KeepLast, if positive, keeps at most the most recent
+	// KeepLast successful jobs, and the most recent KeepLast failed
+	// jobs, regardless of their age.
+	KeepLast int `bson:"keep_last" json:"keep_last" yaml:"keep_last"`
+}
+
+// Validate returns an error if any value is negative.
+func (r RetentionRule) Validate() error {
+	if r.MaxAge < 0 || r.FailedMaxAge < 0 || r.KeepLast < 0 {
+		return errors.New("retention values must not be negative")
+	}
+
+	return nil
+}
+
+// RetentionPolicy configures how long completed jobs are kept. Rules
+// for a job's type replace the default for jobs of that type, so
+// that, for example, download jobs can be kept for months while the
+// jobs that check archives are kept for hours.
+type RetentionPolicy struct {
+	Default RetentionRule            `bson:"default" json:"default" yaml:"default"`
+	Types   map[string]RetentionRule `bson:"types,omitempty" json:"types,omitempty" yaml:"types,omitempty"`
+}
+
+// Validate returns an error if any rule is invalid.
+func (p RetentionPolicy) Validate() error {
+	if err := p.Default.Validate(); err != nil {
+		return errors.Wrap(err, "invalid default retention")
+	}
+
+	for name, r := range p.Types {
+		if err := r.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid retention for '%s' jobs", name)
+		}
+	}
+
+	return nil
+}
+
+// Rule returns the rule for jobs of the specified type.
+func (p RetentionPolicy) Rule(jobType string) RetentionRule {
+	if r, ok := p.Types[jobType]; ok {
+		return r
+	}
+
+	return p.Default
+}
+
+// ExpiredJobs returns the completed jobs that the policy no longer
+// keeps, oldest first, without removing them.
+func (m *Manager) ExpiredJobs(ctx context.Context, p RetentionPolicy) ([]JobInfo, error) {
+	if err := p.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid retention policy")
+	}
+
+	jobs, err := m.find(ctx, Filter{}, func(j amboy.Job) bool {
+		stat := j.Status()
+		return stat.Completed && !stat.InProgress
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "problem finding completed jobs")
+	}
+
+	// most recent first, so that the jobs within KeepLast of
+	// their type and outcome come first
+	sort.Slice(jobs, func(i, j int) bool {
+		if ti, tj := finishedAt(jobs[i]), finishedAt(jobs[j]); !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return jobs[i].ID() < jobs[j].ID()
+	})
+
+	now := m.clock.Now()
+	kept := map[string]int{}
+	out := []JobInfo{}
+	for _, j := range jobs {
+		rule := p.Rule(j.Type().Name)
+		failed := j.Status().ErrorCount > 0 || len(j.Status().Errors) > 0
+
+		maxAge, key := rule.MaxAge, j.Type().Name+"/succeeded"
+		if failed {
+			maxAge, key = rule.FailedMaxAge, j.Type().Name+"/failed"
+		}
+		kept[key]++
+
+		if (rule.KeepLast > 0 && kept[key] > rule.KeepLast) || (maxAge > 0 && now.Sub(finishedAt(j)) > maxAge) {
+			out = append(out, NewJobInfo(j))
+		}
+	}
+
+	// oldest first
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+
+	return out, nil
+}
+
+// ApplyRetention removes the completed jobs that the policy no longer
+// keeps (see ExpiredJobs), if the driver implements the Deleter
+// interface, and records each removal in the audit log. Returns the
+// IDs of the removed jobs.
+func (m *Manager) ApplyRetention(ctx context.Context, p RetentionPolicy) ([]string, error) {
+	if _, ok := m.driver.(Deleter); !ok {
+		return nil, errors.Errorf("driver %T does not support deleting jobs", m.driver)
+	}
+
+	expired, err := m.ExpiredJobs(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, j := range expired {
+		if err = m.Delete(ctx, j.ID, "retention policy"); err != nil {
+			return ids, errors.Wrap(err, "problem applying retention policy")
+		}
+		ids = append(ids, j.ID)
+	}
+
+	return ids, nil
+}
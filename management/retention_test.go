@@ -0,0 +1,101 @@
+package management
+
+import (
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/tychoish/bond/clock"
+)
+
+// addFinishedJob puts a completed job of the type into the driver,
+// which finished at the time.
+func (s *ManagerSuite) addFinishedJob(id, jobType string, failed bool, end time.Time) {
+	j := job.NewShellJob("true", "")
+	j.SetID(id)
+	j.JobType.Name = jobType
+	stat := amboy.JobStatusInfo{Completed: true}
+	if failed {
+		stat.Errors = []string{"exit status 1"}
+		stat.ErrorCount = 1
+	}
+	j.SetStatus(stat)
+	j.UpdateTimeInfo(amboy.JobTimeInfo{Created: end.Add(-time.Minute), Start: end.Add(-time.Minute), End: end})
+	s.require.NoError(s.driver.Put(s.ctx, j))
+}
+
+func expiredIDs(jobs []JobInfo) []string {
+	ids := []string{}
+	for _, j := range jobs {
+		ids = append(ids, j.ID)
+	}
+	return ids
+}
+
+func (s *ManagerSuite) TestExpiredJobsByType() {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	s.manager.SetClock(clock.NewFake(now))
+	defer s.manager.SetClock(nil)
+
+	s.addFinishedJob("download-old", "download", false, now.Add(-60*24*time.Hour))
+	s.addFinishedJob("download-older", "download", false, now.Add(-120*24*time.Hour))
+	s.addFinishedJob("download-failed", "download", true, now.Add(-120*24*time.Hour))
+	s.addFinishedJob("check-recent", "check", false, now.Add(-time.Hour))
+	s.addFinishedJob("check-old", "check", false, now.Add(-3*time.Hour))
+	s.addFinishedJob("check-failed", "check", true, now.Add(-3*time.Hour))
+	s.addJob("pending", amboy.JobStatusInfo{})
+
+	policy := RetentionPolicy{
+		Default: RetentionRule{MaxAge: 90 * 24 * time.Hour, FailedMaxAge: 365 * 24 * time.Hour},
+		Types:   map[string]RetentionRule{"check": {MaxAge: 2 * time.Hour, FailedMaxAge: 24 * time.Hour}},
+	}
+
+	expired, err := s.manager.ExpiredJobs(s.ctx, policy)
+	s.require.NoError(err)
+	s.Equal([]string{"download-older", "check-old"}, expiredIDs(expired))
+
+	// nothing expires without a policy
+	expired, err = s.manager.ExpiredJobs(s.ctx, RetentionPolicy{})
+	s.NoError(err)
+	s.Len(expired, 0)
+
+	_, err = s.manager.ExpiredJobs(s.ctx, RetentionPolicy{Types: map[string]RetentionRule{"check": {KeepLast: -1}}})
+	s.Error(err)
+}
+
+func (s *ManagerSuite) TestExpiredJobsKeepLast() {
+	now := time.Now()
+	for i, id := range []string{"first", "second", "third"} {
+		s.addFinishedJob(id, "check", false, now.Add(time.Duration(i-3)*time.Minute))
+	}
+	s.addFinishedJob("failed", "check", true, now.Add(-time.Hour))
+	s.addFinishedJob("download", "download", false, now.Add(-time.Hour))
+
+	expired, err := s.manager.ExpiredJobs(s.ctx, RetentionPolicy{Types: map[string]RetentionRule{"check": {KeepLast: 1}}})
+	s.require.NoError(err)
+	s.Equal([]string{"first", "second"}, expiredIDs(expired))
+}
+
+func (s *ManagerSuite) TestApplyRetention() {
+	now := time.Now()
+	s.addFinishedJob("expired", "check", false, now.Add(-3*time.Hour))
+	s.addFinishedJob("kept", "check", false, now)
+	policy := RetentionPolicy{Default: RetentionRule{MaxAge: time.Hour}}
+
+	_, err := s.manager.ApplyRetention(s.ctx, policy)
+	s.Error(err)
+
+	log := NewMemoryAuditLog()
+	m := New(&deletingDriver{Driver: s.driver, deleted: map[string]struct{}{}})
+	m.SetAuditLog(log, "retention")
+
+	ids, err := m.ApplyRetention(s.ctx, policy)
+	s.require.NoError(err)
+	s.Equal([]string{"expired"}, ids)
+	_, err = m.Driver().Get(s.ctx, "expired")
+	s.Error(err)
+	_, err = m.Driver().Get(s.ctx, "kept")
+	s.NoError(err)
+	s.Require().Len(log.entries, 1)
+	s.Equal(ActionDelete, log.entries[0].Action)
+}
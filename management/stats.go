@@ -0,0 +1,212 @@
+package management
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// DefaultStatsBatchSize is the number of job statuses that
+// StreamJobStats reads at a time, by default.
+const DefaultStatsBatchSize = 1000
+
+// StatsOptions select the job statuses that StreamJobStats reads.
+// Unlike a Filter, they only select jobs by their statuses, so that
+// drivers can read the statuses without reading the jobs.
+type StatsOptions struct {
+	// Status, if specified, selects only jobs in this state.
+	Status JobStatus `bson:"status,omitempty" json:"status,omitempty" yaml:"status,omitempty"`
+
+	// Pattern, if specified, is a regular expression that job
+	// IDs must match.
+	Pattern string `bson:"pattern,omitempty" json:"pattern,omitempty" yaml:"pattern,omitempty"`
+
+	// BatchSize is the largest number of statuses that are read,
+	// and passed to the callback, at a time, and defaults to
+	// DefaultStatsBatchSize.
+	BatchSize int `bson:"batch_size,omitempty" json:"batch_size,omitempty" yaml:"batch_size,omitempty"`
+}
+
+// Validate returns an error for invalid options.
+func (o StatsOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(o.Status.Validate())
+	catcher.NewWhen(o.BatchSize < 0, "batch size must not be negative")
+	if o.Pattern != "" {
+		_, err := regexp.Compile(o.Pattern)
+		catcher.Add(errors.Wrapf(err, "invalid pattern '%s'", o.Pattern))
+	}
+
+	return catcher.Resolve()
+}
+
+// Size returns the batch size of the options, or the default.
+func (o StatsOptions) Size() int {
+	if o.BatchSize == 0 {
+		return DefaultStatsBatchSize
+	}
+	return o.BatchSize
+}
+
+// Matcher compiles the options into a function that reports if job
+// statuses match them, returning an error if the options are invalid.
+// Matcher is useful for drivers that implement JobStatsStreamer.
+func (o StatsOptions) Matcher() (func(amboy.JobStatusInfo) bool, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	var re *regexp.Regexp
+	if o.Pattern != "" {
+		re = regexp.MustCompile(o.Pattern)
+	}
+
+	return func(stat amboy.JobStatusInfo) bool {
+		if re != nil && !re.MatchString(stat.ID) {
+			return false
+		}
+		return o.Status.MatchesStatus(stat)
+	}, nil
+}
+
+// MatchesStatus reports if the job's status matches the status, as
+// Matches does, from the status alone: failed jobs are the completed
+// jobs whose statuses record errors.
+func (s JobStatus) MatchesStatus(stat amboy.JobStatusInfo) bool {
+	switch s {
+	case StatusPending:
+		return !stat.Completed && !stat.InProgress
+	case StatusInProgress:
+		return !stat.Completed && stat.InProgress
+	case StatusCompleted:
+		return stat.Completed
+	case StatusFailed:
+		return stat.Completed && (stat.ErrorCount > 0 || len(stat.Errors) > 0)
+	default:
+		return true
+	}
+}
+
+// JobStatsStreamer is implemented by drivers that read the statuses of
+// their jobs in batches, without reading the jobs' payloads, and that
+// select the statuses in the storage layer. Implementations call the
+// function with each batch, in any order, stop at the first error
+// that it returns, and return that error.
+type JobStatsStreamer interface {
+	StreamJobStats(context.Context, StatsOptions, func([]amboy.JobStatusInfo) error) error
+}
+
+// JobCounter is implemented by drivers that count the jobs that match
+// a filter in the storage layer, without reading them. Implementations
+// ignore the filter's Skip and Limit.
+type JobCounter interface {
+	CountJobs(context.Context, Filter) (int, error)
+}
+
+// StreamJobStats calls the function with batches of the statuses of
+// the jobs in the manager's driver that match the options (see the
+// StreamJobStats function).
+func (m *Manager) StreamJobStats(ctx context.Context, opts StatsOptions, fn func([]amboy.JobStatusInfo) error) error {
+	return StreamJobStats(ctx, m.driver, opts, fn)
+}
+
+// StreamJobStats calls the function with batches of the statuses of
+// the jobs in the driver that match the options, so that callers that
+// monitor queues with many jobs hold at most a batch of statuses at a
+// time. If the driver implements JobStatsStreamer, the driver reads
+// and selects the statuses, otherwise StreamJobStats selects and
+// batches the statuses from the driver's JobStats, which amboy's
+// drivers read without the jobs' payloads. StreamJobStats stops at,
+// and returns, the first error of the function.
+func StreamJobStats(ctx context.Context, d queue.Driver, opts StatsOptions, fn func([]amboy.JobStatusInfo) error) error {
+	match, err := opts.Matcher()
+	if err != nil {
+		return errors.Wrap(err, "invalid stats options")
+	}
+
+	if streamer, ok := d.(JobStatsStreamer); ok {
+		return streamer.StreamJobStats(ctx, opts, fn)
+	}
+
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	size := opts.Size()
+	batch := make([]amboy.JobStatusInfo, 0, size)
+	for stat := range d.JobStats(sctx) {
+		if !match(stat) {
+			continue
+		}
+
+		batch = append(batch, stat)
+		if len(batch) == size {
+			if err = fn(batch); err != nil {
+				return err
+			}
+			batch = make([]amboy.JobStatusInfo, 0, size)
+		}
+	}
+	if ctx.Err() != nil {
+		return errors.Wrap(ctx.Err(), "operation canceled")
+	}
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+
+	return nil
+}
+
+// CountJobs counts the jobs in the manager's driver that match the
+// filter (see the CountJobs function).
+func (m *Manager) CountJobs(ctx context.Context, f Filter) (int, error) {
+	return CountJobs(ctx, m.driver, f)
+}
+
+// CountJobs counts the jobs in the driver that match the filter,
+// ignoring its Skip and Limit, without returning them. If the driver
+// implements JobCounter, the driver counts the jobs. Otherwise, the
+// counts of all jobs and of completed jobs come from the driver's
+// Stats, the counts of filters that only select jobs by status and ID
+// come from their statuses (see StreamJobStats), and only the counts
+// of other filters read the jobs. Drivers disagree on whether Stats
+// counts running jobs as pending, so the counts of pending and
+// running jobs come from their statuses.
+func CountJobs(ctx context.Context, d queue.Driver, f Filter) (int, error) {
+	if err := f.Validate(); err != nil {
+		return 0, errors.Wrap(err, "invalid filter")
+	}
+	f.Skip, f.Limit = 0, 0
+
+	if counter, ok := d.(JobCounter); ok {
+		return counter.CountJobs(ctx, f)
+	}
+
+	byStatus := f.Type == "" && f.SubmittedAfter.IsZero() && len(f.Labels) == 0
+	if byStatus && f.Pattern == "" && (f.Status == StatusAny || f.Status == StatusCompleted) {
+		stats := d.Stats(ctx)
+		if ctx.Err() != nil {
+			return 0, errors.Wrap(ctx.Err(), "operation canceled")
+		}
+
+		if f.Status == StatusCompleted {
+			return stats.Completed, nil
+		}
+		return stats.Total, nil
+	}
+
+	if byStatus {
+		count := 0
+		err := StreamJobStats(ctx, d, StatsOptions{Status: f.Status, Pattern: f.Pattern}, func(batch []amboy.JobStatusInfo) error {
+			count += len(batch)
+			return nil
+		})
+		return count, err
+	}
+
+	jobs, err := FindJobs(ctx, d, f)
+	return len(jobs), err
+}
@@ -0,0 +1,146 @@
+package management
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+)
+
+// readCountingDriver counts the iterations over the driver's jobs and
+// over their statuses.
+type readCountingDriver struct {
+	queue.Driver
+	jobs  int
+	stats int
+}
+
+func (d *readCountingDriver) Jobs(ctx context.Context) <-chan amboy.Job {
+	d.jobs++
+	return d.Driver.Jobs(ctx)
+}
+
+func (d *readCountingDriver) JobStats(ctx context.Context) <-chan amboy.JobStatusInfo {
+	d.stats++
+	return d.Driver.JobStats(ctx)
+}
+
+func (s *ManagerSuite) addStatusJobs() {
+	for i := 0; i < 5; i++ {
+		s.addJob(fmt.Sprintf("pending-%d", i), amboy.JobStatusInfo{})
+	}
+	s.addJob("running", amboy.JobStatusInfo{InProgress: true, Owner: "worker"})
+	s.addJob("succeeded", amboy.JobStatusInfo{Completed: true})
+	s.addJob("failed", amboy.JobStatusInfo{Completed: true, Errors: []string{"err"}, ErrorCount: 1})
+}
+
+func (s *ManagerSuite) TestStreamJobStatsBatchesStatuses() {
+	s.addStatusJobs()
+	d := &readCountingDriver{Driver: s.driver}
+
+	sizes := []int{}
+	ids := map[string]bool{}
+	err := New(d).StreamJobStats(s.ctx, StatsOptions{Pattern: "^pending-", BatchSize: 2}, func(batch []amboy.JobStatusInfo) error {
+		sizes = append(sizes, len(batch))
+		for _, stat := range batch {
+			ids[stat.ID] = true
+		}
+		return nil
+	})
+	s.NoError(err)
+	s.Equal([]int{2, 2, 1}, sizes)
+	s.Len(ids, 5)
+	s.Equal(0, d.jobs)
+	s.Equal(1, d.stats)
+
+	for status, expected := range map[JobStatus]int{
+		StatusAny:        8,
+		StatusPending:    5,
+		StatusInProgress: 1,
+		StatusCompleted:  2,
+		StatusFailed:     1,
+	} {
+		count := 0
+		s.NoError(s.manager.StreamJobStats(s.ctx, StatsOptions{Status: status}, func(batch []amboy.JobStatusInfo) error {
+			count += len(batch)
+			return nil
+		}))
+		s.Equal(expected, count, "status=%s", status)
+	}
+
+	// the function's errors stop the stream
+	calls := 0
+	err = s.manager.StreamJobStats(s.ctx, StatsOptions{BatchSize: 1}, func([]amboy.JobStatusInfo) error {
+		calls++
+		return errors.New("stop")
+	})
+	s.Error(err)
+	s.Equal(1, calls)
+
+	for _, opts := range []StatsOptions{{Status: "done"}, {Pattern: "["}, {BatchSize: -1}} {
+		s.Error(s.manager.StreamJobStats(s.ctx, opts, func([]amboy.JobStatusInfo) error { return nil }))
+	}
+}
+
+func (s *ManagerSuite) TestCountJobsReadsOnlyWhatTheFilterNeeds() {
+	s.addStatusJobs()
+	d := &readCountingDriver{Driver: s.driver}
+	m := New(d)
+
+	// all and completed jobs are counted from the driver's stats
+	count, err := m.CountJobs(s.ctx, Filter{Limit: 1})
+	s.NoError(err)
+	s.Equal(8, count)
+	count, err = m.CountJobs(s.ctx, Filter{Status: StatusCompleted})
+	s.NoError(err)
+	s.Equal(2, count)
+	s.Equal(0, d.jobs)
+	s.Equal(0, d.stats)
+
+	// status and ID filters are counted from the statuses
+	for _, tc := range []struct {
+		filter   Filter
+		expected int
+	}{
+		{Filter{Status: StatusPending}, 5},
+		{Filter{Status: StatusInProgress}, 1},
+		{Filter{Status: StatusFailed}, 1},
+		{Filter{Pattern: "^pending-[0-2]$", Skip: 2}, 3},
+		{Filter{Pattern: "ed$", Status: StatusCompleted}, 2},
+		{Filter{Pattern: "^running$", Status: StatusFailed}, 0},
+	} {
+		count, err = m.CountJobs(s.ctx, tc.filter)
+		s.NoError(err)
+		s.Equal(tc.expected, count, "filter=%+v", tc.filter)
+	}
+	s.Equal(0, d.jobs)
+
+	// other filters read the jobs
+	count, err = m.CountJobs(s.ctx, Filter{Type: "shell", Status: StatusPending})
+	s.NoError(err)
+	s.Equal(5, count)
+	s.Equal(1, d.jobs)
+
+	_, err = m.CountJobs(s.ctx, Filter{Pattern: "["})
+	s.Error(err)
+}
+
+type countingDriver struct {
+	*deletingDriver
+	calls int
+}
+
+func (d *countingDriver) CountJobs(context.Context, Filter) (int, error) {
+	d.calls++
+	return 42, nil
+}
+
+func (s *ManagerSuite) TestCountJobsUsesDriverCounting() {
+	d := &countingDriver{deletingDriver: &deletingDriver{Driver: s.driver}}
+	count, err := New(d).CountJobs(s.ctx, Filter{Type: "shell"})
+	s.NoError(err)
+	s.Equal(1, d.calls)
+	s.Equal(42, count)
+}
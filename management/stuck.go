@@ -0,0 +1,124 @@
+package management
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/pkg/errors"
+)
+
+// StuckThreshold defines how long a job may remain in a state before
+// it is considered stuck. Zero values disable the check for that
+// state.
+type StuckThreshold struct {
+	Pending time.Duration `bson:"pending" json:"pending" yaml:"pending"`
+	Running time.Duration `bson:"running" json:"running" yaml:"running"`
+}
+
+// Validate returns an error if either threshold is negative.
+func (t StuckThreshold) Validate() error {
+	if t.Pending < 0 || t.Running < 0 {
+		return errors.New("stuck thresholds must not be negative")
+	}
+
+	return nil
+}
+
+// StuckPolicy configures stuck-job detection. Thresholds for a job's
+// type replace the defaults for jobs of that type.
+type StuckPolicy struct {
+	Default StuckThreshold            `bson:"default" json:"default" yaml:"default"`
+	Types   map[string]StuckThreshold `bson:"types,omitempty" json:"types,omitempty" yaml:"types,omitempty"`
+}
+
+// Validate returns an error if any threshold is invalid.
+func (p StuckPolicy) Validate() error {
+	if err := p.Default.Validate(); err != nil {
+		return errors.Wrap(err, "invalid default threshold")
+	}
+
+	for name, t := range p.Types {
+		if err := t.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid threshold for '%s' jobs", name)
+		}
+	}
+
+	return nil
+}
+
+// Threshold returns the threshold for jobs of the specified type.
+func (p StuckPolicy) Threshold(jobType string) StuckThreshold {
+	if t, ok := p.Types[jobType]; ok {
+		return t
+	}
+
+	return p.Default
+}
+
+// StuckJob describes a job that has been pending or running for
+// longer than its threshold.
+type StuckJob struct {
+	JobInfo   `bson:"job" json:"job" yaml:"job"`
+	State     JobStatus     `bson:"state" json:"state" yaml:"state"`
+	Duration  time.Duration `bson:"duration" json:"duration" yaml:"duration"`
+	Threshold time.Duration `bson:"threshold" json:"threshold" yaml:"threshold"`
+}
+
+// StuckJobs returns the jobs that have been pending (since they were
+// created) or in progress (since they started) for longer than the
+// policy allows, longest first.
+func (m *Manager) StuckJobs(ctx context.Context, p StuckPolicy) ([]StuckJob, error) {
+	if err := p.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid stuck job policy")
+	}
+
+	now := m.clock.Now()
+	out := []StuckJob{}
+
+	_, err := m.find(ctx, Filter{}, func(j amboy.Job) bool {
+		if sj, ok := checkStuck(j, p.Threshold(j.Type().Name), now); ok {
+			out = append(out, sj)
+		}
+
+		return false
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "problem finding stuck jobs")
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Duration != out[j].Duration {
+			return out[i].Duration > out[j].Duration
+		}
+		return out[i].ID < out[j].ID
+	})
+
+	return out, nil
+}
+
+func checkStuck(j amboy.Job, t StuckThreshold, now time.Time) (StuckJob, bool) {
+	stat := j.Status()
+	ti := j.TimeInfo()
+	sj := StuckJob{JobInfo: NewJobInfo(j)}
+
+	switch {
+	case stat.Completed:
+		return sj, false
+	case stat.InProgress:
+		start := ti.Start
+		if start.IsZero() {
+			start = stat.ModificationTime
+		}
+		sj.State = StatusInProgress
+		sj.Threshold = t.Running
+		sj.Duration = now.Sub(start)
+	default:
+		sj.State = StatusPending
+		sj.Threshold = t.Pending
+		sj.Duration = now.Sub(ti.Created)
+	}
+
+	return sj, sj.Threshold > 0 && sj.Duration > sj.Threshold
+}
@@ -0,0 +1,70 @@
+package management
+
+import (
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/tychoish/bond/clock"
+)
+
+func (s *ManagerSuite) addTimedJob(id string, stat amboy.JobStatusInfo, ti amboy.JobTimeInfo) {
+	j := job.NewShellJob("true", "")
+	j.SetID(id)
+	j.SetStatus(stat)
+	j.UpdateTimeInfo(ti)
+	s.require.NoError(s.driver.Put(s.ctx, j))
+}
+
+func (s *ManagerSuite) TestStuckJobs() {
+	now := time.Now()
+	s.addTimedJob("wedged", amboy.JobStatusInfo{InProgress: true}, amboy.JobTimeInfo{Created: now.Add(-3 * time.Hour), Start: now.Add(-2 * time.Hour)})
+	s.addTimedJob("running", amboy.JobStatusInfo{InProgress: true}, amboy.JobTimeInfo{Created: now.Add(-3 * time.Hour), Start: now.Add(-time.Minute)})
+	s.addTimedJob("waiting", amboy.JobStatusInfo{}, amboy.JobTimeInfo{Created: now.Add(-time.Hour)})
+	s.addTimedJob("new", amboy.JobStatusInfo{}, amboy.JobTimeInfo{Created: now})
+	s.addTimedJob("done", amboy.JobStatusInfo{Completed: true}, amboy.JobTimeInfo{Created: now.Add(-24 * time.Hour)})
+
+	stuck, err := s.manager.StuckJobs(s.ctx, StuckPolicy{
+		Default: StuckThreshold{Pending: 30 * time.Minute, Running: 30 * time.Minute},
+	})
+	s.NoError(err)
+	s.Require().Len(stuck, 2)
+	s.Equal("wedged", stuck[0].ID)
+	s.Equal(StatusInProgress, stuck[0].State)
+	s.True(stuck[0].Duration > 2*time.Hour-time.Minute)
+	s.Equal("waiting", stuck[1].ID)
+	s.Equal(StatusPending, stuck[1].State)
+
+	// per-type thresholds replace the defaults
+	stuck, err = s.manager.StuckJobs(s.ctx, StuckPolicy{
+		Default: StuckThreshold{Pending: 30 * time.Minute},
+		Types:   map[string]StuckThreshold{"shell": {Running: 3 * time.Hour}},
+	})
+	s.NoError(err)
+	s.Len(stuck, 0)
+
+	_, err = s.manager.StuckJobs(s.ctx, StuckPolicy{Default: StuckThreshold{Running: -1}})
+	s.Error(err)
+	_, err = s.manager.StuckJobs(s.ctx, StuckPolicy{Types: map[string]StuckThreshold{"shell": {Pending: -1}}})
+	s.Error(err)
+}
+
+func (s *ManagerSuite) TestStuckJobsUseManagerClock() {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := clock.NewFake(start)
+	s.manager.SetClock(c)
+	defer s.manager.SetClock(nil)
+
+	s.addTimedJob("queued", amboy.JobStatusInfo{}, amboy.JobTimeInfo{Created: start})
+	policy := StuckPolicy{Default: StuckThreshold{Pending: time.Hour}}
+
+	stuck, err := s.manager.StuckJobs(s.ctx, policy)
+	s.NoError(err)
+	s.Len(stuck, 0)
+
+	c.Advance(2 * time.Hour)
+	stuck, err = s.manager.StuckJobs(s.ctx, policy)
+	s.NoError(err)
+	s.Require().Len(stuck, 1)
+	s.Equal(2*time.Hour, stuck[0].Duration)
+}
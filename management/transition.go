@@ -0,0 +1,137 @@
+package management
+
+import (
+	"context"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// StatusTransition is a change of status that the manager applies to
+// every job that matches a filter.
+type StatusTransition string
+
+// Values for StatusTransition.
+const (
+	// TransitionPending resets jobs to a pending state, so that
+	// the queue dispatches them again, as RequeueByID does.
+	TransitionPending StatusTransition = "pending"
+	// TransitionAborted marks jobs that are not complete as
+	// complete, with an error recording that they were aborted, as
+	// Abort does. Completed jobs are not changed.
+	TransitionAborted StatusTransition = "aborted"
+)
+
+// Validate returns an error if the transition is not a known value.
+func (t StatusTransition) Validate() error {
+	switch t {
+	case TransitionPending, TransitionAborted:
+		return nil
+	default:
+		return errors.Errorf("'%s' is not a valid status transition", t)
+	}
+}
+
+// Apply changes the status of the job, and reports whether the
+// transition applies to the job. The note is the reason for aborting
+// jobs.
+func (t StatusTransition) Apply(j amboy.Job, note string) bool {
+	switch t {
+	case TransitionPending:
+		resetStatus(j)
+		return true
+	case TransitionAborted:
+		if j.Status().Completed {
+			return false
+		}
+		abortStatus(j, note)
+		return true
+	default:
+		return false
+	}
+}
+
+func (t StatusTransition) action() string {
+	if t == TransitionAborted {
+		return ActionAbort
+	}
+	return ActionRequeue
+}
+
+// StatusUpdater is implemented by drivers that can apply a status
+// transition to every job that matches a filter in one operation,
+// which avoids a round trip per job during mass requeues and aborts.
+// Implementations must change jobs as StatusTransition.Apply does,
+// must ignore the filter's Skip and Limit, and return the IDs of the
+// jobs that they changed.
+type StatusUpdater interface {
+	UpdateStatuses(context.Context, Filter, StatusTransition, string) ([]string, error)
+}
+
+// UpdateStatuses applies the transition to every job in the driver
+// that matches the filter, and returns the IDs of the changed jobs.
+// If the driver implements StatusUpdater, the driver updates the jobs
+// at once, and otherwise each job is saved. Drivers that combine
+// other drivers (e.g. shards) can use UpdateStatuses to update each
+// of them.
+func UpdateStatuses(ctx context.Context, d queue.Driver, f Filter, t StatusTransition, note string) ([]string, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+
+	match, err := f.compile()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid filter")
+	}
+
+	if updater, ok := d.(StatusUpdater); ok {
+		return updater.UpdateStatuses(ctx, f, t, note)
+	}
+
+	jobs := []amboy.Job{}
+	for j := range d.Jobs(ctx) {
+		if match(j) {
+			jobs = append(jobs, j)
+		}
+	}
+	if ctx.Err() != nil {
+		return nil, errors.Wrap(ctx.Err(), "operation canceled")
+	}
+
+	catcher := grip.NewBasicCatcher()
+	ids := []string{}
+	for _, j := range jobs {
+		if !t.Apply(j, note) {
+			continue
+		}
+		if err := d.Save(ctx, j); err != nil {
+			catcher.Add(errors.Wrapf(err, "problem saving job '%s'", j.ID()))
+			continue
+		}
+		ids = append(ids, j.ID())
+	}
+
+	return ids, catcher.Resolve()
+}
+
+// UpdateStatuses applies the transition to every job that matches
+// the filter, as the package's UpdateStatuses does, records each
+// changed job in the audit log, and returns the IDs of the changed
+// jobs. The note is recorded in the audit log, and is the reason for
+// aborting jobs.
+func (m *Manager) UpdateStatuses(ctx context.Context, f Filter, t StatusTransition, note string) ([]string, error) {
+	ids, err := UpdateStatuses(ctx, m.driver, f, t, note)
+
+	catcher := grip.NewBasicCatcher()
+	for _, id := range ids {
+		catcher.Wrap(m.record(ctx, id, t.action(), note), "problem recording audit entry")
+	}
+	if !catcher.HasErrors() {
+		return ids, err
+	}
+
+	catcher.Add(err)
+	return ids, catcher.Resolve()
+}
@@ -0,0 +1,347 @@
+/*
+Package metrics exports operational metrics about amboy queues and
+bond downloads, for consumption by monitoring systems.
+*/
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/driver"
+	"github.com/tychoish/bond/management"
+)
+
+// PrometheusExporter collects metrics from a set of queues and from
+// bond's download counters and renders them in the Prometheus text
+// exposition format. The exporter implements http.Handler and can be
+// mounted directly at /metrics.
+//
+// Queues with drivers that report lifetime counters (see
+// driver.Counted) also export the totals of every run of the queue.
+//
+// Per-type metrics require reading every job in the queue, so the
+// exporter counts the jobs of each type at most once per interval
+// (see SetTypeInterval), and reuses the counts between collections.
+// The jobs of remote queues are read from their drivers with
+// management.FindJobs, in one pass.
+type PrometheusExporter struct {
+	namespace string
+	queues    map[string]amboy.Queue
+	mutex     sync.RWMutex
+
+	interval time.Duration
+	typesMu  sync.Mutex
+	types    map[string]typeSnapshot
+}
+
+// DefaultTypeInterval is how long exporters reuse the per-type counts
+// of each queue, by default.
+const DefaultTypeInterval = 30 * time.Second
+
+// NewPrometheusExporter constructs an exporter. All metric names
+// are prefixed with the namespace, which defaults to "bond".
+func NewPrometheusExporter(namespace string) *PrometheusExporter {
+	if namespace == "" {
+		namespace = "bond"
+	}
+
+	return &PrometheusExporter{
+		namespace: namespace,
+		queues:    map[string]amboy.Queue{},
+		interval:  DefaultTypeInterval,
+		types:     map[string]typeSnapshot{},
+	}
+}
+
+// SetTypeInterval sets how long the exporter reuses the per-type
+// counts of each queue. A zero interval counts the jobs on every
+// collection.
+func (e *PrometheusExporter) SetTypeInterval(interval time.Duration) {
+	e.typesMu.Lock()
+	defer e.typesMu.Unlock()
+
+	e.interval = interval
+}
+
+// AddQueue registers a queue with the exporter. The name is used as
+// the value of the "queue" label for all of the queue's metrics.
+func (e *PrometheusExporter) AddQueue(name string, q amboy.Queue) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if _, ok := e.queues[name]; ok {
+		return errors.Errorf("queue '%s' is already registered", name)
+	}
+
+	e.queues[name] = q
+	return nil
+}
+
+// ServeHTTP renders the current metrics.
+func (e *PrometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	buf := &bytes.Buffer{}
+	if err := e.Write(r.Context(), buf); err != nil {
+		grip.Error(errors.Wrap(err, "problem collecting metrics"))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, err := w.Write(buf.Bytes())
+	grip.Debug(errors.Wrap(err, "problem writing metrics"))
+}
+
+type typeCounts struct {
+	pending      int
+	running      int
+	completed    int
+	failed       int
+	dispatchSum  float64
+	dispatchJobs int
+}
+
+type typeSnapshot struct {
+	counts    map[string]*typeCounts
+	collected time.Time
+}
+
+// typeCounts returns the per-type counts of the queue, counting the
+// jobs again if the counts are older than the exporter's interval.
+func (e *PrometheusExporter) typeCounts(ctx context.Context, name string, q amboy.Queue) (map[string]*typeCounts, error) {
+	e.typesMu.Lock()
+	defer e.typesMu.Unlock()
+
+	if snap, ok := e.types[name]; ok && e.interval > 0 && time.Since(snap.collected) < e.interval {
+		return snap.counts, nil
+	}
+
+	jobs, err := jobInfos(ctx, q)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading jobs of queue '%s'", name)
+	}
+
+	byType := map[string]*typeCounts{}
+	for _, j := range jobs {
+		counts, ok := byType[j.Type.Name]
+		if !ok {
+			counts = &typeCounts{}
+			byType[j.Type.Name] = counts
+		}
+
+		stat := j.Status
+		switch {
+		case stat.Completed && (stat.ErrorCount > 0 || len(stat.Errors) > 0):
+			counts.failed++
+		case stat.Completed:
+			counts.completed++
+		case stat.InProgress:
+			counts.running++
+		default:
+			counts.pending++
+		}
+
+		ti := j.TimeInfo
+		if !ti.Start.IsZero() && !ti.Created.IsZero() && ti.Start.After(ti.Created) {
+			counts.dispatchSum += ti.Start.Sub(ti.Created).Seconds()
+			counts.dispatchJobs++
+		}
+	}
+
+	e.types[name] = typeSnapshot{counts: byType, collected: time.Now()}
+	return byType, nil
+}
+
+// jobInfos returns summaries of every job in the queue, from the
+// driver of remote queues.
+func jobInfos(ctx context.Context, q amboy.Queue) ([]management.JobInfo, error) {
+	if rq, ok := q.(queue.Remote); ok && rq.Driver() != nil {
+		return management.FindJobs(ctx, rq.Driver(), management.Filter{})
+	}
+
+	out := []management.JobInfo{}
+	for stat := range q.JobStats(ctx) {
+		if j, ok := q.Get(ctx, stat.ID); ok {
+			out = append(out, management.NewJobInfo(j))
+		}
+	}
+
+	return out, errors.Wrap(ctx.Err(), "operation canceled")
+}
+
+// Write collects all metrics, and then writes them to the writer,
+// with the samples of each metric, for every queue, in one group.
+func (e *PrometheusExporter) Write(ctx context.Context, w io.Writer) error {
+	e.mutex.RLock()
+	names := make([]string, 0, len(e.queues))
+	for name := range e.queues {
+		names = append(names, name)
+	}
+	e.mutex.RUnlock()
+	sort.Strings(names)
+
+	out := &metricWriter{namespace: e.namespace}
+
+	for _, name := range names {
+		e.mutex.RLock()
+		q := e.queues[name]
+		e.mutex.RUnlock()
+
+		stats := q.Stats(ctx)
+		out.add("queue_jobs", "gauge", "Number of jobs in the queue by state.",
+			float64(stats.Pending), "queue", name, "state", "pending")
+		out.add("queue_jobs", "gauge", "", float64(stats.Running), "queue", name, "state", "running")
+		out.add("queue_jobs", "gauge", "", float64(stats.Completed), "queue", name, "state", "completed")
+		out.add("queue_jobs", "gauge", "", float64(stats.Blocked), "queue", name, "state", "blocked")
+		out.add("queue_jobs_total", "gauge", "Total number of jobs in the queue.",
+			float64(stats.Total), "queue", name)
+
+		if c, ok := lifetime(ctx, q); ok {
+			out.add("queue_lifetime_jobs_total", "counter", "Number of jobs completed over every run of the queue.",
+				float64(c.Completed), "queue", name, "state", "completed")
+			out.add("queue_lifetime_jobs_total", "counter", "", float64(c.Failed), "queue", name, "state", "failed")
+			out.add("queue_lifetime_runtime_seconds_total", "counter", "Time spent running jobs over every run of the queue.",
+				c.Runtime.Seconds(), "queue", name)
+		}
+
+		byType, err := e.typeCounts(ctx, name, q)
+		if err != nil {
+			return err
+		}
+
+		types := make([]string, 0, len(byType))
+		for jt := range byType {
+			types = append(types, jt)
+		}
+		sort.Strings(types)
+
+		for _, jt := range types {
+			c := byType[jt]
+			out.add("queue_type_jobs", "gauge", "Number of jobs in the queue by type and state.",
+				float64(c.pending), "queue", name, "type", jt, "state", "pending")
+			out.add("queue_type_jobs", "gauge", "", float64(c.running), "queue", name, "type", jt, "state", "running")
+			out.add("queue_type_jobs", "gauge", "", float64(c.completed), "queue", name, "type", jt, "state", "completed")
+			out.add("queue_type_jobs", "gauge", "", float64(c.failed), "queue", name, "type", jt, "state", "failed")
+			out.add("queue_dispatch_latency_seconds_sum", "", "",
+				c.dispatchSum, "queue", name, "type", jt)
+			out.add("queue_dispatch_latency_seconds_count", "", "",
+				float64(c.dispatchJobs), "queue", name, "type", jt)
+		}
+	}
+
+	dl := bond.GetDownloadStats()
+	out.add("downloads_started_total", "counter", "Number of downloads started.", float64(dl.Started))
+	out.add("downloads_succeeded_total", "counter", "Number of downloads that completed successfully.", float64(dl.Succeeded))
+	out.add("downloads_failed_total", "counter", "Number of downloads that failed.", float64(dl.Failed))
+	out.add("download_bytes_total", "counter", "Number of bytes downloaded.", float64(dl.Bytes))
+
+	_, err := io.WriteString(w, out.String())
+	return errors.Wrap(err, "problem writing metrics")
+}
+
+// lifetime returns the lifetime counters of a remote queue whose driver
+// reports them. Problems reading the counters are logged.
+func lifetime(ctx context.Context, q amboy.Queue) (driver.Counters, bool) {
+	rq, ok := q.(queue.Remote)
+	if !ok {
+		return driver.Counters{}, false
+	}
+	reporter, ok := rq.Driver().(driver.LifetimeReporter)
+	if !ok {
+		return driver.Counters{}, false
+	}
+
+	c, err := reporter.Lifetime(ctx)
+	if err != nil {
+		grip.Warning(errors.Wrapf(err, "problem reading lifetime counters for driver '%s'", rq.Driver().ID()))
+		return driver.Counters{}, false
+	}
+
+	return c, true
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Support for rendering the text exposition format.
+
+type metricWriter struct {
+	namespace string
+	families  map[string]*metricFamily
+	order     []string
+}
+
+// metricFamily holds the samples of a metric, which the exposition
+// format requires to follow the family's help and type lines, once.
+type metricFamily struct {
+	help    string
+	kind    string
+	samples bytes.Buffer
+}
+
+// add records a single sample. Help and type are taken from the
+// first sample of each metric name; labels are pairs of names and
+// values. Metrics whose names end in _sum and _count share the
+// header of a summary-typed base metric.
+func (m *metricWriter) add(name, kind, help string, value float64, labels ...string) {
+	if m.families == nil {
+		m.families = map[string]*metricFamily{}
+	}
+
+	name = m.namespace + "_" + name
+
+	header := name
+	if kind == "" {
+		header = strings.TrimSuffix(strings.TrimSuffix(name, "_sum"), "_count")
+		kind = "summary"
+		help = "Time between job creation and dispatch."
+	}
+
+	family, ok := m.families[header]
+	if !ok {
+		family = &metricFamily{help: help, kind: kind}
+		m.families[header] = family
+		m.order = append(m.order, header)
+	}
+
+	family.samples.WriteString(name)
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], escapeLabel(labels[i+1])))
+		}
+		family.samples.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	fmt.Fprintf(&family.samples, " %v\n", value)
+}
+
+func (m *metricWriter) String() string {
+	buf := &bytes.Buffer{}
+	for _, header := range m.order {
+		family := m.families[header]
+		if family.help != "" {
+			fmt.Fprintf(buf, "# HELP %s %s\n", header, family.help)
+		}
+		fmt.Fprintf(buf, "# TYPE %s %s\n", header, family.kind)
+		buf.Write(family.samples.Bytes())
+	}
+
+	return buf.String()
+}
+
+func escapeLabel(val string) string {
+	val = strings.Replace(val, `\`, `\\`, -1)
+	val = strings.Replace(val, "\n", `\n`, -1)
+	return strings.Replace(val, `"`, `\"`, -1)
+}
@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/driver"
+	"github.com/tychoish/bond/driver/drivertest"
+)
+
+func TestPrometheusExporter(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q := queue.NewLocalLimitedSize(2, 128)
+	require.NoError(t, q.Start(ctx))
+
+	for _, cmd := range []string{"true", "false"} {
+		j := job.NewShellJob(cmd, "")
+		require.NoError(t, q.Put(ctx, j))
+	}
+	require.True(t, amboy.WaitInterval(ctx, q, 10*time.Millisecond))
+
+	exporter := NewPrometheusExporter("")
+	require.NoError(t, exporter.AddQueue("downloads", q))
+	assert.Error(exporter.AddQueue("downloads", q))
+
+	srv := httptest.NewServer(exporter)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	out := string(data)
+
+	assert.Contains(out, "# TYPE bond_queue_jobs gauge\n")
+	assert.Contains(out, `bond_queue_jobs{queue="downloads",state="completed"} 2`)
+	assert.Contains(out, `bond_queue_jobs_total{queue="downloads"} 2`)
+	assert.Contains(out, `bond_queue_type_jobs{queue="downloads",type="shell",state="completed"} 1`)
+	assert.Contains(out, `bond_queue_type_jobs{queue="downloads",type="shell",state="failed"} 1`)
+	assert.Contains(out, "# TYPE bond_queue_dispatch_latency_seconds summary\n")
+	assert.Contains(out, `bond_queue_dispatch_latency_seconds_count{queue="downloads",type="shell"}`)
+	assert.Contains(out, "# TYPE bond_downloads_started_total counter\n")
+	assert.Contains(out, "bond_download_bytes_total ")
+}
+
+func TestEscapeLabel(t *testing.T) {
+	assert.Equal(t, `a\"b\\c\nd`, escapeLabel("a\"b\\c\nd"))
+}
+
+func TestPrometheusExporterLifetimeCounters(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	store := drivertest.New("lifetime")
+	require.NoError(t, store.AddCounters(ctx, driver.Counters{Completed: 5, Failed: 2, Runtime: 3 * time.Second}))
+	d, err := driver.NewCounted(store, nil)
+	require.NoError(t, err)
+
+	q := queue.NewRemoteUnordered(1)
+	require.NoError(t, q.SetDriver(d))
+
+	exporter := NewPrometheusExporter("")
+	require.NoError(t, exporter.AddQueue("downloads", q))
+	buf := &bytes.Buffer{}
+	require.NoError(t, exporter.Write(ctx, buf))
+	out := buf.String()
+
+	assert.Contains(out, "# TYPE bond_queue_lifetime_jobs_total counter\n")
+	assert.Contains(out, `bond_queue_lifetime_jobs_total{queue="downloads",state="completed"} 5`)
+	assert.Contains(out, `bond_queue_lifetime_jobs_total{queue="downloads",state="failed"} 2`)
+	assert.Contains(out, `bond_queue_lifetime_runtime_seconds_total{queue="downloads"} 3`)
+}
+
+func TestPrometheusExporterGroupsQueues(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	exporter := NewPrometheusExporter("")
+	stores := map[string]*drivertest.Driver{}
+	for _, name := range []string{"builds", "downloads"} {
+		stores[name] = drivertest.New(name)
+		q := queue.NewRemoteUnordered(1)
+		require.NoError(t, q.SetDriver(stores[name]))
+		require.NoError(t, q.Put(ctx, job.NewShellJob("true", "")))
+		require.NoError(t, exporter.AddQueue(name, q))
+	}
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, exporter.Write(ctx, buf))
+	out := buf.String()
+
+	// each family has one header, followed by the samples of
+	// every queue
+	assert.Equal(1, strings.Count(out, "# TYPE bond_queue_jobs gauge\n"))
+	assert.Equal(1, strings.Count(out, "# HELP bond_queue_type_jobs "))
+	assert.Equal(1, strings.Count(out, "# TYPE bond_queue_dispatch_latency_seconds summary\n"))
+	assert.Contains(out, `bond_queue_jobs_total{queue="builds"} 1`+"\n"+`bond_queue_jobs_total{queue="downloads"} 1`)
+	assert.Contains(out, `bond_queue_type_jobs{queue="builds",type="shell",state="pending"} 1`)
+	assert.Contains(out, `bond_queue_type_jobs{queue="downloads",type="shell",state="pending"} 1`)
+
+	// jobs are read from the drivers in one pass
+	for name, d := range stores {
+		assert.Len(d.CallsFor(drivertest.OpFind), 1, name)
+		assert.Empty(d.CallsFor(drivertest.OpGet), name)
+	}
+
+	// per-type counts are reused until the interval passes
+	require.NoError(t, exporter.Write(ctx, &bytes.Buffer{}))
+	assert.Len(stores["builds"].CallsFor(drivertest.OpFind), 1)
+	exporter.SetTypeInterval(0)
+	require.NoError(t, exporter.Write(ctx, &bytes.Buffer{}))
+	assert.Len(stores["builds"].CallsFor(drivertest.OpFind), 2)
+}
@@ -0,0 +1,236 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+)
+
+// EmitterFormat describes the wire protocol that an Emitter uses.
+type EmitterFormat string
+
+const (
+	// StatsdFormat sends metrics in the statsd line protocol over
+	// UDP. Queue stats are sent as gauges, and download counters
+	// are sent as counters of the change since the previous push.
+	StatsdFormat EmitterFormat = "statsd"
+
+	// GraphiteFormat sends metrics in the graphite plaintext
+	// protocol over TCP. All values are sent as-is, so download
+	// counters are cumulative.
+	GraphiteFormat EmitterFormat = "graphite"
+)
+
+// Validate returns an error if the format is not supported.
+func (f EmitterFormat) Validate() error {
+	switch f {
+	case StatsdFormat, GraphiteFormat:
+		return nil
+	default:
+		return errors.Errorf("'%s' is not a supported emitter format", f)
+	}
+}
+
+func (f EmitterFormat) network() string {
+	if f == GraphiteFormat {
+		return "tcp"
+	}
+
+	return "udp"
+}
+
+// EmitterOptions configures an Emitter.
+type EmitterOptions struct {
+	Format  EmitterFormat `bson:"format" json:"format" yaml:"format"`
+	Address string        `bson:"address" json:"address" yaml:"address"`
+
+	// Prefix is prepended to every metric name, and defaults to
+	// "bond".
+	Prefix string `bson:"prefix" json:"prefix" yaml:"prefix"`
+
+	// Interval is how often the emitter pushes metrics, and
+	// defaults to one minute.
+	Interval time.Duration `bson:"interval" json:"interval" yaml:"interval"`
+}
+
+// Validate checks the options and sets default values.
+func (opts *EmitterOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(opts.Format.Validate())
+	catcher.NewWhen(opts.Address == "", "must specify an address")
+	catcher.NewWhen(opts.Interval < 0, "interval must not be negative")
+
+	if opts.Prefix == "" {
+		opts.Prefix = "bond"
+	}
+	if opts.Interval == 0 {
+		opts.Interval = time.Minute
+	}
+
+	return catcher.Resolve()
+}
+
+// Emitter periodically pushes queue stats and bond's download
+// counters to a statsd or graphite server, as an alternative to
+// PrometheusExporter for deployments that collect metrics by push.
+//
+// Queue metrics are named <prefix>.queue.<name>.<state>, and
+// download metrics are named <prefix>.downloads.<counter>. Queues
+// with drivers that report lifetime counters (see driver.Counted)
+// also send <prefix>.queue.<name>.lifetime.<counter> gauges.
+type Emitter struct {
+	opts   EmitterOptions
+	queues map[string]amboy.Queue
+	last   bond.DownloadStats
+	mutex  sync.Mutex
+}
+
+// NewEmitter constructs an emitter, returning an error if the options
+// are not valid.
+func NewEmitter(opts EmitterOptions) (*Emitter, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid emitter options")
+	}
+
+	return &Emitter{
+		opts:   opts,
+		queues: map[string]amboy.Queue{},
+	}, nil
+}
+
+// AddQueue registers a queue with the emitter. The name is used in the
+// metric names for the queue's stats.
+func (e *Emitter) AddQueue(name string, q amboy.Queue) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if _, ok := e.queues[name]; ok {
+		return errors.Errorf("queue '%s' is already registered", name)
+	}
+
+	e.queues[name] = q
+	return nil
+}
+
+// Start pushes metrics on the configured interval, in a background
+// goroutine, until the context is canceled. Errors are logged.
+func (e *Emitter) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(e.opts.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				grip.Warning(errors.Wrap(e.Emit(ctx), "problem emitting metrics"))
+			}
+		}
+	}()
+}
+
+// Emit collects and pushes metrics once.
+func (e *Emitter) Emit(ctx context.Context) error {
+	payload := e.collect(ctx, time.Now())
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, e.opts.Format.network(), e.opts.Address)
+	if err != nil {
+		return errors.Wrapf(err, "problem connecting to %s", e.opts.Address)
+	}
+	defer conn.Close()
+
+	if e.opts.Format == GraphiteFormat {
+		_, err = conn.Write(payload)
+		return errors.Wrap(err, "problem sending metrics")
+	}
+
+	// statsd servers read one datagram at a time, so send a
+	// metric per write to stay below the packet size limit.
+	catcher := grip.NewBasicCatcher()
+	for _, line := range bytes.SplitAfter(payload, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		_, err = conn.Write(line)
+		catcher.Add(err)
+	}
+
+	return errors.Wrap(catcher.Resolve(), "problem sending metrics")
+}
+
+func (e *Emitter) collect(ctx context.Context, now time.Time) []byte {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	names := make([]string, 0, len(e.queues))
+	for name := range e.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := &bytes.Buffer{}
+	add := func(name, kind string, value int64) {
+		name = e.opts.Prefix + "." + name
+		if e.opts.Format == GraphiteFormat {
+			fmt.Fprintf(buf, "%s %d %d\n", name, value, now.Unix())
+			return
+		}
+		fmt.Fprintf(buf, "%s:%d|%s\n", name, value, kind)
+	}
+
+	for _, name := range names {
+		stats := e.queues[name].Stats(ctx)
+		path := "queue." + metricPathElement(name) + "."
+		add(path+"pending", "g", int64(stats.Pending))
+		add(path+"running", "g", int64(stats.Running))
+		add(path+"completed", "g", int64(stats.Completed))
+		add(path+"blocked", "g", int64(stats.Blocked))
+		add(path+"total", "g", int64(stats.Total))
+
+		if c, ok := lifetime(ctx, e.queues[name]); ok {
+			add(path+"lifetime.completed", "g", int64(c.Completed))
+			add(path+"lifetime.failed", "g", int64(c.Failed))
+			add(path+"lifetime.runtime_ms", "g", int64(c.Runtime/time.Millisecond))
+		}
+	}
+
+	dl := bond.GetDownloadStats()
+	reported := dl
+	if e.opts.Format == StatsdFormat {
+		reported = bond.DownloadStats{
+			Started:   dl.Started - e.last.Started,
+			Succeeded: dl.Succeeded - e.last.Succeeded,
+			Failed:    dl.Failed - e.last.Failed,
+			Bytes:     dl.Bytes - e.last.Bytes,
+		}
+	}
+	e.last = dl
+
+	add("downloads.started", "c", reported.Started)
+	add("downloads.succeeded", "c", reported.Succeeded)
+	add("downloads.failed", "c", reported.Failed)
+	add("downloads.bytes", "c", reported.Bytes)
+
+	return buf.Bytes()
+}
+
+var invalidPathChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// metricPathElement makes a name safe to use as a single element of
+// a dot-separated metric path.
+func metricPathElement(name string) string {
+	return strings.Trim(invalidPathChars.ReplaceAllString(name, "_"), "_")
+}
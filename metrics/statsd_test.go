@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmitterOptionsValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	opts := EmitterOptions{Format: StatsdFormat, Address: "localhost:8125"}
+	assert.NoError(opts.Validate())
+	assert.Equal("bond", opts.Prefix)
+	assert.Equal(time.Minute, opts.Interval)
+
+	assert.Error((&EmitterOptions{Format: "carbon", Address: "localhost:8125"}).Validate())
+	assert.Error((&EmitterOptions{Format: GraphiteFormat}).Validate())
+	assert.Error((&EmitterOptions{Format: GraphiteFormat, Address: "localhost:2003", Interval: -1}).Validate())
+
+	_, err := NewEmitter(EmitterOptions{})
+	assert.Error(err)
+}
+
+func TestStatsdEmitter(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	e, err := NewEmitter(EmitterOptions{Format: StatsdFormat, Address: conn.LocalAddr().String(), Prefix: "test"})
+	require.NoError(t, err)
+	q := queue.NewLocalLimitedSize(1, 16)
+	require.NoError(t, e.AddQueue("mongodb.downloads", q))
+	assert.Error(e.AddQueue("mongodb.downloads", q))
+
+	require.NoError(t, e.Emit(ctx))
+
+	seen := map[string]bool{}
+	buf := make([]byte, 1024)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for len(seen) < 9 {
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		seen[strings.TrimSpace(string(buf[:n]))] = true
+	}
+
+	assert.True(seen["test.queue.mongodb_downloads.pending:0|g"])
+	assert.True(seen["test.queue.mongodb_downloads.total:0|g"])
+	assert.True(seen["test.downloads.started:0|c"])
+}
+
+func TestGraphiteEmitter(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	lines := make(chan []string, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			close(lines)
+			return
+		}
+		defer c.Close()
+
+		out := []string{}
+		scanner := bufio.NewScanner(c)
+		for scanner.Scan() {
+			out = append(out, scanner.Text())
+		}
+		lines <- out
+	}()
+
+	e, err := NewEmitter(EmitterOptions{Format: GraphiteFormat, Address: ln.Addr().String()})
+	require.NoError(t, err)
+	require.NoError(t, e.AddQueue("local", queue.NewLocalLimitedSize(1, 16)))
+	require.NoError(t, e.Emit(ctx))
+
+	out := <-lines
+	require.Len(t, out, 9)
+	assert.True(strings.HasPrefix(out[0], "bond.queue.local.pending 0 "))
+	assert.True(strings.HasPrefix(out[8], "bond.downloads.bytes "))
+	assert.Len(strings.Fields(out[0]), 3)
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"context"
+	"io"
+
+	"github.com/mongodb/amboy"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/blob"
+)
+
+// ArtifactQueue wraps a queue and runs every job that it dispatches
+// with a blob store in its context (see blob.StoreFrom), so that jobs
+// can attach large results without storing them in the queue.
+type ArtifactQueue struct {
+	amboy.Queue
+
+	store blob.Store
+}
+
+// NewArtifactQueue wraps a queue, which must not have started, and
+// provides the store to its jobs. Start the returned queue rather
+// than the wrapped queue.
+func NewArtifactQueue(q amboy.Queue, store blob.Store) (*ArtifactQueue, error) {
+	if store == nil {
+		return nil, errors.New("must specify a blob store")
+	}
+
+	aq := &ArtifactQueue{Queue: q, store: store}
+	if err := attach(q, aq); err != nil {
+		return nil, err
+	}
+
+	return aq, nil
+}
+
+// Store returns the store that the queue provides to its jobs.
+func (q *ArtifactQueue) Store() blob.Store { return q.store }
+
+// Next returns the next job from the wrapped queue, wrapped so that
+// it runs with the store.
+func (q *ArtifactQueue) Next(ctx context.Context) amboy.Job {
+	j := q.Queue.Next(ctx)
+	if j == nil {
+		return nil
+	}
+
+	return &artifactJob{Job: j, store: q.store}
+}
+
+// Save saves the job in the wrapped queue.
+func (q *ArtifactQueue) Save(ctx context.Context, j amboy.Job) error {
+	return q.Queue.Save(ctx, unwrapArtifact(j))
+}
+
+// Complete marks the job complete in the wrapped queue.
+func (q *ArtifactQueue) Complete(ctx context.Context, j amboy.Job) {
+	q.Queue.Complete(ctx, unwrapArtifact(j))
+}
+
+// SetRunner sets the runner of the wrapped queue.
+func (q *ArtifactQueue) SetRunner(r amboy.Runner) error { return setRunner(q.Queue, q, r) }
+
+// Artifact returns a reader of the artifact, with the name, of the
+// job with the id. Callers must close the reader.
+func (q *ArtifactQueue) Artifact(ctx context.Context, id, name string) (io.ReadCloser, error) {
+	j, ok := q.Queue.Get(ctx, id)
+	if !ok {
+		return nil, errors.Errorf("no job '%s'", id)
+	}
+
+	ref, ok := blob.Find(j, name)
+	if !ok {
+		return nil, errors.Wrapf(blob.ErrNotFound, "job '%s' has no artifact '%s'", id, name)
+	}
+
+	return blob.Open(ctx, q.store, ref)
+}
+
+// artifactJob adds the store to the context of the job's Run method.
+// As with loggedJob, the queue unwraps jobs before storing them.
+type artifactJob struct {
+	amboy.Job
+	store blob.Store
+}
+
+func (j *artifactJob) Run(ctx context.Context) { j.Job.Run(blob.WithStore(ctx, j.store)) }
+
+func unwrapArtifact(j amboy.Job) amboy.Job {
+	if aj, ok := j.(*artifactJob); ok {
+		return aj.Job
+	}
+
+	return j
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/blob"
+	"github.com/tychoish/bond/jobs"
+)
+
+type artifactTestJob struct {
+	*job.Base
+	blob.JobArtifacts
+}
+
+func newArtifactTestJob(id string) *artifactTestJob {
+	j := &artifactTestJob{Base: &job.Base{JobType: amboy.JobType{Name: "artifact-test"}}}
+	j.SetID(id)
+	j.SetDependency(nil)
+	return j
+}
+
+func (j *artifactTestJob) Run(ctx context.Context) {
+	defer j.MarkComplete()
+
+	store, ok := blob.StoreFrom(ctx)
+	if !ok {
+		j.AddError(errors.New("no blob store"))
+		return
+	}
+
+	_, err := blob.Attach(ctx, store, j, "report.txt", strings.NewReader("report of "+j.ID()))
+	j.AddError(err)
+}
+
+func TestArtifactQueueProvidesStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "bond-artifact-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	store := blob.DirectoryStore{Path: dir}
+
+	_, err = NewArtifactQueue(queue.NewLocalLimitedSize(1, 16), nil)
+	assert.Error(err)
+
+	q, err := NewArtifactQueue(queue.NewLocalLimitedSize(2, 16), store)
+	require.NoError(t, err)
+	assert.Equal(store, q.Store())
+	require.NoError(t, q.Start(ctx))
+
+	out, err := jobs.RunJob(ctx, q, newArtifactTestJob("one"))
+	require.NoError(t, err)
+	require.IsType(t, &artifactTestJob{}, out)
+	refs := out.(*artifactTestJob).ArtifactReferences()
+	require.Len(t, refs, 1)
+	assert.Equal("report.txt", refs[0].Name)
+	assert.EqualValues(len("report of one"), refs[0].Size)
+
+	r, err := q.Artifact(ctx, "one", "report.txt")
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(r)
+	assert.NoError(r.Close())
+	assert.NoError(err)
+	assert.Equal("report of one", string(data))
+
+	_, err = q.Artifact(ctx, "one", "missing.txt")
+	assert.Equal(blob.ErrNotFound, errors.Cause(err))
+	_, err = q.Artifact(ctx, "missing", "report.txt")
+	assert.Error(err)
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/management"
+)
+
+// RecordTransitions registers hooks on the queue that record every
+// job dispatch, completion and failure in the audit log, attributed
+// to the actor (typically the process or host name), with the
+// environment of the process (see management.CurrentEnvironment).
+// Errors writing to the log are logged and do not affect the job.
+func RecordTransitions(q *HookedQueue, log management.AuditLog, actor string) {
+	record := func(action string) Hook {
+		return func(ctx context.Context, j amboy.Job, stat amboy.JobStatusInfo) {
+			env := management.CurrentEnvironment()
+			entry := management.AuditEntry{
+				Time:        env.Time,
+				JobID:       j.ID(),
+				Action:      action,
+				Actor:       actor,
+				Environment: &env,
+			}
+			if action == management.ActionFail {
+				entry.Note = strings.Join(stat.Errors, "; ")
+			}
+
+			grip.Warning(errors.Wrapf(log.Record(ctx, entry),
+				"problem recording %s of job '%s'", action, j.ID()))
+		}
+	}
+
+	q.OnDispatch(record(management.ActionDispatch))
+	q.OnComplete(record(management.ActionComplete))
+	q.OnError(record(management.ActionFail))
+}
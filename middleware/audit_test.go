@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/management"
+)
+
+func TestRecordTransitions(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q, err := NewHookedQueue(queue.NewLocalLimitedSize(1, 16))
+	require.NoError(t, err)
+	log := management.NewMemoryAuditLog()
+	RecordTransitions(q, log, "worker-1")
+	require.NoError(t, q.Start(ctx))
+
+	failing := job.NewShellJob("false", "")
+	failing.SetID("failing")
+	require.NoError(t, q.Put(ctx, failing))
+
+	var entries []management.AuditEntry
+	for len(entries) < 2 && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+		entries, err = log.Entries(ctx, management.AuditQuery{JobID: "failing"})
+		require.NoError(t, err)
+	}
+
+	require.Len(t, entries, 2)
+	assert.Equal(management.ActionDispatch, entries[0].Action)
+	assert.Equal(management.ActionFail, entries[1].Action)
+	assert.Equal("worker-1", entries[1].Actor)
+	assert.NotEmpty(entries[1].Note)
+	require.NotNil(t, entries[1].Environment)
+	assert.NotEmpty(entries[1].Environment.Host)
+}
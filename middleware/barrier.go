@@ -0,0 +1,179 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/dependency"
+	"github.com/mongodb/amboy/registry"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/management"
+)
+
+const (
+	barrierName = "bond-barrier"
+
+	// BarrierLabelPrefix prefixes the keys of the labels that
+	// register jobs with barriers.
+	BarrierLabelPrefix = "barrier."
+)
+
+func init() {
+	registry.AddDependencyType(barrierName, func() dependency.Manager {
+		return makeBarrierDependency()
+	})
+}
+
+// Barrier joins the completion of a group of jobs: Size jobs register
+// against the barrier's Key, and jobs with the barrier's Dependency
+// become dispatchable when all of them have completed, with or
+// without errors. For example, a manifest job can wait for every
+// download of a version.
+//
+// Registrations are labels of the jobs, so they're stored by the
+// queue's driver, and any process can register, run, or wait for the
+// jobs of a barrier in a shared remote queue. Dispatch dependents
+// through a DependencyQueue, which holds them until their barriers
+// are complete.
+type Barrier struct {
+	Key  string `bson:"key" json:"key" yaml:"key"`
+	Size int    `bson:"size" json:"size" yaml:"size"`
+}
+
+// BarrierStatus reports the progress of a barrier's registrants.
+type BarrierStatus struct {
+	Registered int `bson:"registered" json:"registered" yaml:"registered"`
+	Completed  int `bson:"completed" json:"completed" yaml:"completed"`
+}
+
+// NewBarrier constructs a barrier, returning an error if the key is
+// not a valid label key or the size is not positive.
+func NewBarrier(key string, size int) (*Barrier, error) {
+	b := &Barrier{Key: key, Size: size}
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Validate returns an error if the barrier is not valid.
+func (b *Barrier) Validate() error {
+	if b.Key == "" {
+		return errors.New("barriers must have a key")
+	}
+	if b.Size <= 0 {
+		return errors.Errorf("size of barrier '%s' must be positive", b.Key)
+	}
+
+	return errors.Wrapf(management.ValidateLabels(map[string]string{b.label(): "true"}),
+		"invalid key for barrier '%s'", b.Key)
+}
+
+func (b *Barrier) label() string { return BarrierLabelPrefix + b.Key }
+
+// Register adds the job to the barrier's registrants. The job must
+// carry labels (see management.Labeled), and must be registered
+// before it's added to the queue.
+func (b *Barrier) Register(j amboy.Job) error {
+	lj, ok := j.(management.Labeled)
+	if !ok {
+		return errors.Errorf("job '%s' of type '%s' cannot register with barrier '%s'", j.ID(), j.Type().Name, b.Key)
+	}
+
+	lj.SetLabel(b.label(), "true")
+	return nil
+}
+
+// Dependency returns a dependency manager that is Blocked until the
+// barrier is complete in the queue.
+func (b *Barrier) Dependency(q amboy.Queue) *BarrierDependency {
+	d := makeBarrierDependency()
+	d.Key = b.Key
+	d.Size = b.Size
+	d.queue = q
+
+	return d
+}
+
+// Status counts the barrier's registrants in the queue.
+func (b *Barrier) Status(ctx context.Context, q amboy.Queue) BarrierStatus {
+	out := BarrierStatus{}
+	label := b.label()
+
+	for stat := range q.JobStats(ctx) {
+		j, ok := q.Get(ctx, stat.ID)
+		if !ok {
+			continue
+		}
+		if _, ok := management.LabelsOf(j)[label]; !ok {
+			continue
+		}
+
+		out.Registered++
+		if j.Status().Completed {
+			out.Completed++
+		}
+	}
+
+	return out
+}
+
+// Complete reports whether the queue has all of the barrier's
+// registrants, and all of them have completed.
+func (b *Barrier) Complete(ctx context.Context, q amboy.Queue) bool {
+	stat := b.Status(ctx, q)
+	return stat.Registered >= b.Size && stat.Completed == stat.Registered
+}
+
+// BarrierDependency is a dependency.Manager implementation that is
+// Blocked until its Barrier is complete, and Ready afterwards.
+//
+// The queue is not serialized with the dependency; a DependencyQueue
+// attaches its own queue to the dependencies of the jobs that it
+// dispatches. Without a queue, the dependency is always Blocked, so
+// that dependents never run before their barrier.
+type BarrierDependency struct {
+	Key  string              `bson:"key" json:"key" yaml:"key"`
+	Size int                 `bson:"size" json:"size" yaml:"size"`
+	T    dependency.TypeInfo `bson:"type" json:"type" yaml:"type"`
+	dependency.JobEdges
+
+	queue amboy.Queue
+}
+
+func makeBarrierDependency() *BarrierDependency {
+	return &BarrierDependency{
+		T: dependency.TypeInfo{
+			Name:    barrierName,
+			Version: 0,
+		},
+		JobEdges: dependency.NewJobEdges(),
+	}
+}
+
+// SetQueue attaches a queue to the dependency, which is required for
+// the dependency to resolve to any state other than Blocked.
+func (d *BarrierDependency) SetQueue(q amboy.Queue) { d.queue = q }
+
+// State returns Ready if the barrier is complete, and Blocked
+// otherwise.
+func (d *BarrierDependency) State() dependency.State {
+	if d.queue == nil {
+		return dependency.Blocked
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b := Barrier{Key: d.Key, Size: d.Size}
+	if b.Complete(ctx, d.queue) {
+		return dependency.Ready
+	}
+
+	return dependency.Blocked
+}
+
+// Type returns the TypeInfo for the dependency, to support
+// serialization.
+func (d *BarrierDependency) Type() dependency.TypeInfo { return d.T }
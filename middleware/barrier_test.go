@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/dependency"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/jobs"
+)
+
+type barrierTestJob struct {
+	*job.ShellJob
+	labels map[string]string
+}
+
+func newBarrierTestJob(id, cmd string) *barrierTestJob {
+	j := &barrierTestJob{ShellJob: job.NewShellJob(cmd, ""), labels: map[string]string{}}
+	j.SetID(id)
+	return j
+}
+
+func (j *barrierTestJob) Labels() map[string]string  { return j.labels }
+func (j *barrierTestJob) SetLabel(key, value string) { j.labels[key] = value }
+
+func TestBarrierValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := NewBarrier("", 1)
+	assert.Error(err)
+	_, err = NewBarrier("7.0.5", 0)
+	assert.Error(err)
+	_, err = NewBarrier("a=b", 1)
+	assert.Error(err)
+
+	b, err := NewBarrier("7.0.5", 2)
+	require.NoError(t, err)
+	assert.Error(b.Register(job.NewShellJob("true", "")))
+
+	j := newBarrierTestJob("download", "true")
+	require.NoError(t, b.Register(j))
+	assert.Equal("true", j.Labels()["barrier.7.0.5"])
+}
+
+func TestBarrierDependency(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q := queue.NewLocalLimitedSize(2, 128)
+	require.NoError(t, q.Start(ctx))
+
+	b, err := NewBarrier("7.0.5", 2)
+	require.NoError(t, err)
+	dep := b.Dependency(q)
+	assert.Equal(barrierName, dep.Type().Name)
+
+	// no registrants
+	assert.Equal(dependency.Blocked, dep.State())
+
+	// other jobs don't count
+	other := job.NewShellJob("true", "")
+	other.SetID("unrelated")
+	_, err = jobs.RunJob(ctx, q, other)
+	require.NoError(t, err)
+
+	first := newBarrierTestJob("download-0", "true")
+	require.NoError(t, b.Register(first))
+	_, err = jobs.RunJob(ctx, q, first)
+	require.NoError(t, err)
+	assert.Equal(BarrierStatus{Registered: 1, Completed: 1}, b.Status(ctx, q))
+	assert.Equal(dependency.Blocked, dep.State())
+
+	// all registrants must complete, with or without errors
+	second := newBarrierTestJob("download-1", "false")
+	require.NoError(t, b.Register(second))
+	_, err = jobs.RunJob(ctx, q, second)
+	require.Error(t, err)
+	assert.Equal(BarrierStatus{Registered: 2, Completed: 2}, b.Status(ctx, q))
+	assert.True(b.Complete(ctx, q))
+	assert.Equal(dependency.Ready, dep.State())
+
+	// without a queue, the dependency is always blocked
+	dep = b.Dependency(nil)
+	assert.Equal(dependency.Blocked, dep.State())
+	dep.SetQueue(q)
+	assert.Equal(dependency.Ready, dep.State())
+}
+
+func TestDependencyQueueHoldsBarrierDependents(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q, err := NewDependencyQueue(queue.NewLocalLimitedSize(4, 128), 10*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	b, err := NewBarrier("manifest", 3)
+	require.NoError(t, err)
+
+	manifest := job.NewShellJob("true", "")
+	manifest.SetID("manifest")
+	manifest.SetDependency(b.Dependency(nil))
+	require.NoError(t, q.Put(ctx, manifest))
+
+	// the manifest is held until the registrants are submitted
+	// and complete
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal([]string{"manifest"}, q.Held())
+	assert.False(manifest.Status().Completed)
+
+	registrants := []*barrierTestJob{}
+	for _, id := range []string{"a", "b", "c"} {
+		j := newBarrierTestJob(id, "sleep 0.1")
+		require.NoError(t, b.Register(j))
+		require.NoError(t, q.Put(ctx, j))
+		registrants = append(registrants, j)
+	}
+
+	require.NoError(t, jobs.WaitJob(ctx, q, "manifest", jobs.Backoff{}))
+	assert.NoError(manifest.Error())
+	assert.Len(q.Held(), 0)
+	for _, j := range registrants {
+		require.True(t, j.Status().Completed)
+		assert.False(manifest.TimeInfo().Start.Before(j.TimeInfo().End), j.ID())
+	}
+
+	// jobs without barriers are not held
+	plain := job.NewShellJob("true", "")
+	_, err = jobs.RunJob(ctx, q, plain)
+	assert.NoError(err)
+
+	_, err = NewDependencyQueue(queue.NewLocalLimitedSize(1, 1), -time.Second)
+	assert.Error(err)
+}
+
+var _ amboy.Job = &barrierTestJob{}
@@ -0,0 +1,234 @@
+package middleware
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/management"
+)
+
+// CapabilityLabelPrefix prefixes the keys of the labels that declare
+// the capabilities that jobs require of their workers.
+const CapabilityLabelPrefix = "requires."
+
+// Capabilities are the key=value capabilities of a worker (e.g.
+// os=linux), or the capabilities that a job requires. Capabilities
+// that a worker either has or doesn't (e.g. has-docker) have the
+// value "true".
+type Capabilities map[string]string
+
+// HostCapabilities returns the capabilities of the current host: its
+// operating system, as "os", and architecture, as "arch", with the
+// names that Go uses (e.g. os=linux, arch=arm64).
+func HostCapabilities() Capabilities {
+	return Capabilities{"os": runtime.GOOS, "arch": runtime.GOARCH}
+}
+
+// ParseCapabilities parses comma-separated capabilities, each a
+// key=value pair or a key alone, which has the value "true" (e.g.
+// "os=linux,has-docker"). An empty string has no capabilities.
+func ParseCapabilities(val string) (Capabilities, error) {
+	if val == "" {
+		return nil, nil
+	}
+
+	caps := Capabilities{}
+	for _, item := range strings.Split(val, ",") {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) == 1 {
+			parts = append(parts, "true")
+		}
+		caps[parts[0]] = parts[1]
+	}
+
+	if err := caps.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid capabilities '%s'", val)
+	}
+
+	return caps, nil
+}
+
+// Validate returns an error if any capability can't be stored as a
+// label.
+func (c Capabilities) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	for key, value := range c {
+		catcher.NewWhen(key == "", "capabilities must have a name")
+		catcher.Wrapf(management.ValidateLabels(map[string]string{CapabilityLabelPrefix + key: value}),
+			"invalid capability '%s'", key)
+	}
+
+	return catcher.Resolve()
+}
+
+// Merge returns the capabilities with those of the other, whose
+// values take precedence.
+func (c Capabilities) Merge(other Capabilities) Capabilities {
+	out := Capabilities{}
+	for key, value := range c {
+		out[key] = value
+	}
+	for key, value := range other {
+		out[key] = value
+	}
+
+	return out
+}
+
+// Missing returns the required capabilities, as key=value, that these
+// capabilities lack or have with a different value, in order.
+func (c Capabilities) Missing(required Capabilities) []string {
+	missing := []string{}
+	for key, value := range required {
+		if have, ok := c[key]; !ok || have != value {
+			missing = append(missing, key+"="+value)
+		}
+	}
+	sort.Strings(missing)
+
+	return missing
+}
+
+// Satisfies reports whether these capabilities include all of the
+// required capabilities.
+func (c Capabilities) Satisfies(required Capabilities) bool { return len(c.Missing(required)) == 0 }
+
+func (c Capabilities) String() string {
+	out := make(map[string]string, len(c))
+	for key, value := range c {
+		out[key] = value
+	}
+
+	return management.FormatLabels(out)
+}
+
+// Require declares that the job requires the capabilities of the
+// workers that run it. Like barrier registrations, requirements are
+// labels of the job (see management.Labeled), so they're stored by
+// the queue's driver, and must be declared before the job is added to
+// the queue.
+func Require(j amboy.Job, required Capabilities) error {
+	if err := required.Validate(); err != nil {
+		return err
+	}
+
+	lj, ok := j.(management.Labeled)
+	if !ok {
+		return errors.Errorf("job '%s' of type '%s' cannot require capabilities", j.ID(), j.Type().Name)
+	}
+
+	for key, value := range required {
+		lj.SetLabel(CapabilityLabelPrefix+key, value)
+	}
+
+	return nil
+}
+
+// Required returns the capabilities that the job requires of its
+// workers.
+func Required(j amboy.Job) Capabilities {
+	required := Capabilities{}
+	for key, value := range management.LabelsOf(j) {
+		if strings.HasPrefix(key, CapabilityLabelPrefix) {
+			required[strings.TrimPrefix(key, CapabilityLabelPrefix)] = value
+		}
+	}
+
+	return required
+}
+
+// CapabilityQueue wraps a queue and dispatches only the jobs whose
+// required capabilities (see Require) its workers have. Other jobs
+// stay in the queue's storage, unchanged, for the workers of other
+// processes that share a remote queue, so that a queue's jobs can run
+// on hosts with different operating systems or tools. Jobs that
+// don't require capabilities dispatch to every worker.
+//
+// A job that no process's workers can run stays pending; wrap only
+// queues whose storage other workers share, or check requirements
+// when submitting jobs to queues that run in one process.
+type CapabilityQueue struct {
+	amboy.Queue
+
+	caps    Capabilities
+	mu      sync.Mutex
+	skipped map[string]int
+}
+
+// NewCapabilityQueue wraps a queue, which must not have started, whose
+// workers have the capabilities. Start the returned queue rather than
+// the wrapped queue.
+func NewCapabilityQueue(q amboy.Queue, caps Capabilities) (*CapabilityQueue, error) {
+	if err := caps.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid worker capabilities")
+	}
+
+	cq := &CapabilityQueue{Queue: q, caps: caps.Merge(nil), skipped: map[string]int{}}
+	if err := attach(q, cq); err != nil {
+		return nil, err
+	}
+
+	return cq, nil
+}
+
+// Capabilities returns the capabilities of the queue's workers.
+func (q *CapabilityQueue) Capabilities() Capabilities { return q.caps.Merge(nil) }
+
+// Skipped returns the IDs of the jobs that the queue did not dispatch
+// because its workers lack their capabilities, in order.
+func (q *CapabilityQueue) Skipped() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ids := make([]string, 0, len(q.skipped))
+	for id := range q.skipped {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Next returns the next job from the wrapped queue that the queue's
+// workers can run.
+func (q *CapabilityQueue) Next(ctx context.Context) amboy.Job {
+	for {
+		j := q.Queue.Next(ctx)
+		if j == nil {
+			return nil
+		}
+
+		missing := q.caps.Missing(Required(j))
+		if len(missing) == 0 {
+			return j
+		}
+
+		q.skip(j, missing)
+	}
+}
+
+// SetRunner sets the runner of the wrapped queue.
+func (q *CapabilityQueue) SetRunner(r amboy.Runner) error { return setRunner(q.Queue, q, r) }
+
+func (q *CapabilityQueue) skip(j amboy.Job, missing []string) {
+	q.mu.Lock()
+	q.skipped[j.ID()]++
+	first := q.skipped[j.ID()] == 1
+	q.mu.Unlock()
+
+	// remote queues dispatch skipped jobs again, so only log the
+	// first skip of each job.
+	grip.InfoWhen(first, message.Fields{
+		"message":  "skipping job that requires capabilities the workers lack",
+		"job":      j.ID(),
+		"job_type": j.Type().Name,
+		"missing":  missing,
+	})
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	assert := assert.New(t)
+
+	caps, err := ParseCapabilities("os=linux,has-docker")
+	require.NoError(t, err)
+	assert.Equal(Capabilities{"os": "linux", "has-docker": "true"}, caps)
+	assert.Equal("has-docker=true,os=linux", caps.String())
+
+	caps, err = ParseCapabilities("")
+	assert.NoError(err)
+	assert.Len(caps, 0)
+
+	_, err = ParseCapabilities("=linux")
+	assert.Error(err)
+
+	host := HostCapabilities()
+	assert.Equal(runtime.GOOS, host["os"])
+	assert.Equal(runtime.GOARCH, host["arch"])
+}
+
+func TestCapabilitiesMissing(t *testing.T) {
+	assert := assert.New(t)
+
+	worker := Capabilities{"os": "linux", "arch": "amd64"}
+	assert.True(worker.Satisfies(nil))
+	assert.True(worker.Satisfies(Capabilities{"os": "linux"}))
+	assert.False(worker.Satisfies(Capabilities{"os": "windows"}))
+	assert.Equal([]string{"has-docker=true", "os=windows"},
+		worker.Missing(Capabilities{"os": "windows", "arch": "amd64", "has-docker": "true"}))
+
+	merged := worker.Merge(Capabilities{"has-docker": "true", "os": "darwin"})
+	assert.Equal(Capabilities{"os": "darwin", "arch": "amd64", "has-docker": "true"}, merged)
+	assert.Equal("linux", worker["os"])
+}
+
+func TestRequireStoresLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(Require(job.NewShellJob("true", ""), Capabilities{"os": "linux"}))
+
+	j := newBarrierTestJob("docker", "true")
+	assert.Len(Required(j), 0)
+	require.NoError(t, Require(j, Capabilities{"os": "linux", "has-docker": "true"}))
+	assert.Equal("linux", j.Labels()["requires.os"])
+	assert.Equal(Capabilities{"os": "linux", "has-docker": "true"}, Required(j))
+
+	assert.Error(Require(j, Capabilities{"a,b": "c"}))
+}
+
+func TestCapabilityQueueDispatchesMatchingJobs(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := NewCapabilityQueue(queue.NewLocalLimitedSize(1, 8), Capabilities{"": "x"})
+	assert.Error(err)
+
+	q, err := NewCapabilityQueue(queue.NewLocalLimitedSize(2, 16), Capabilities{"os": "linux", "has-docker": "true"})
+	require.NoError(t, err)
+	assert.Equal("linux", q.Capabilities()["os"])
+	require.NoError(t, q.Start(ctx))
+
+	plain := newBarrierTestJob("plain", "true")
+	docker := newBarrierTestJob("docker", "true")
+	require.NoError(t, Require(docker, Capabilities{"os": "linux", "has-docker": "true"}))
+	windows := newBarrierTestJob("windows", "true")
+	require.NoError(t, Require(windows, Capabilities{"os": "windows"}))
+
+	for _, j := range []*barrierTestJob{windows, plain, docker} {
+		require.NoError(t, q.Put(ctx, j))
+	}
+
+	for ctx.Err() == nil && !(plain.Status().Completed && docker.Status().Completed && len(q.Skipped()) == 1) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.NoError(t, ctx.Err())
+
+	assert.NoError(plain.Error())
+	assert.NoError(docker.Error())
+	assert.Equal([]string{"windows"}, q.Skipped())
+
+	// skipped jobs stay pending for other workers
+	stored, ok := q.Get(ctx, "windows")
+	require.True(t, ok)
+	assert.False(stored.Status().Completed)
+	assert.False(stored.Status().InProgress)
+}
@@ -0,0 +1,225 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+// ErrIDCollision is returned by a CollisionCheckingQueue for jobs
+// whose ID is the ID of a job in the queue with a different type or
+// payload.
+var ErrIDCollision = errors.New("job id collision")
+
+// payloader is the part of Signed that describes a job's work.
+type payloader interface {
+	SigningPayload() ([]byte, error)
+}
+
+// JobPayload returns the parameters of the job: the payload of jobs
+// that implement Signed, and otherwise the job serialized as JSON
+// without its ID. The serialization includes fields that change as
+// the job runs (e.g. the output of an amboy ShellJob), so the
+// payloads of jobs that do not implement Signed are only stable
+// before they're submitted.
+func JobPayload(j amboy.Job) ([]byte, error) {
+	if pj, ok := j.(payloader); ok {
+		payload, err := pj.SigningPayload()
+		return payload, errors.Wrapf(err, "problem serializing payload of job '%s'", j.ID())
+	}
+
+	data, err := json.Marshal(j)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem serializing job '%s'", j.ID())
+	}
+	var doc interface{}
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrapf(err, "problem serializing job '%s'", j.ID())
+	}
+
+	payload, err := json.Marshal(withoutJobID(doc, j.ID()))
+	return payload, errors.Wrapf(err, "problem serializing job '%s'", j.ID())
+}
+
+// withoutJobID removes the ID from the serialized job: the name of
+// the object that has the job's type, which is how amboy's job.Base
+// serializes.
+func withoutJobID(doc interface{}, id string) interface{} {
+	switch val := doc.(type) {
+	case map[string]interface{}:
+		if _, ok := val["job_type"]; ok && val["name"] == id {
+			delete(val, "name")
+		}
+		for key, field := range val {
+			val[key] = withoutJobID(field, id)
+		}
+	case []interface{}:
+		for idx, elem := range val {
+			val[idx] = withoutJobID(elem, id)
+		}
+	}
+
+	return doc
+}
+
+// JobDigest returns the hex-encoded SHA256 of the job's type, the
+// version of its type, and its payload (see JobPayload).
+func JobDigest(j amboy.Job) (string, error) {
+	payload, err := JobPayload(j)
+	if err != nil {
+		return "", err
+	}
+
+	return contentDigest(j.Type(), payload), nil
+}
+
+// contentDigest hashes the job type and the payload, each followed
+// by a zero byte so that fields cannot run together.
+func contentDigest(jt amboy.JobType, payload []byte) string {
+	h := sha256.New()
+	for _, field := range [][]byte{[]byte(jt.Name), []byte(strconv.Itoa(jt.Version)), payload} {
+		_, _ = h.Write(field)
+		_, _ = h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ContentID returns an ID derived from the job's content: its type's
+// name followed by the first 128 bits of its digest (see JobDigest).
+// Producers that derive the IDs of their jobs with ContentID submit
+// the same ID for the same work, so that queues, which reject jobs
+// whose ID they already have, do the work once however many
+// producers submit it.
+func ContentID(j amboy.Job) (string, error) {
+	digest, err := JobDigest(j)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s-%s", j.Type().Name, digest[:32]), nil
+}
+
+// SetContentID sets the ID of the job to its ContentID. Jobs must be
+// able to set their IDs, as jobs that embed amboy's job.Base can.
+func SetContentID(j amboy.Job) error {
+	sj, ok := j.(interface{ SetID(string) })
+	if !ok {
+		return errors.Errorf("cannot set the id of job '%s'", j.ID())
+	}
+
+	id, err := ContentID(j)
+	if err != nil {
+		return err
+	}
+
+	sj.SetID(id)
+	return nil
+}
+
+// CollisionCheckingQueue wraps a queue and, at Put, compares jobs with
+// the job in the queue that has the same ID, if there is one. Jobs
+// with the same type and payload pass through, so that the wrapped
+// queue rejects them as duplicates, while jobs with a different type
+// or payload are rejected with ErrIDCollision, with the fields of
+// their payloads that differ, and logged, so that producers whose IDs
+// do not capture all of a job's parameters (e.g. a download's URL but
+// not its checksums) find out rather than losing work silently.
+// Jobs that do not implement Signed are compared as serialized (see
+// JobPayload), so a job that has run, and recorded its output,
+// collides with a copy that has not.
+//
+// Like the IdempotentQueue, the CollisionCheckingQueue only changes
+// Put.
+type CollisionCheckingQueue struct {
+	amboy.Queue
+}
+
+// NewCollisionCheckingQueue wraps the queue.
+func NewCollisionCheckingQueue(q amboy.Queue) (*CollisionCheckingQueue, error) {
+	if q == nil {
+		return nil, errors.New("cannot wrap a nil queue")
+	}
+
+	return &CollisionCheckingQueue{Queue: q}, nil
+}
+
+// Put adds the job to the wrapped queue, unless the queue has a
+// different job with the job's ID.
+func (q *CollisionCheckingQueue) Put(ctx context.Context, j amboy.Job) error {
+	existing, ok := q.Queue.Get(ctx, j.ID())
+	if !ok {
+		return q.Queue.Put(ctx, j)
+	}
+	existing = unwrap(existing)
+
+	payload, err := JobPayload(j)
+	if err != nil {
+		return err
+	}
+	queued, err := JobPayload(existing)
+	if err != nil {
+		return errors.Wrapf(err, "problem comparing job '%s' with the queued job", j.ID())
+	}
+
+	digest, queuedDigest := contentDigest(j.Type(), payload), contentDigest(existing.Type(), queued)
+	if digest == queuedDigest {
+		return q.Queue.Put(ctx, j)
+	}
+
+	fields := payloadDifferences(payload, queued)
+	grip.Warning(message.Fields{
+		"message":       "rejecting job whose id collides with a different queued job",
+		"job":           j.ID(),
+		"type":          j.Type().Name,
+		"queued_type":   existing.Type().Name,
+		"digest":        digest,
+		"queued_digest": queuedDigest,
+		"fields":        fields,
+	})
+
+	if j.Type() != existing.Type() {
+		return errors.Wrapf(ErrIDCollision, "job '%s' of type %s (v%d) has the id of a queued job of type %s (v%d)",
+			j.ID(), j.Type().Name, j.Type().Version, existing.Type().Name, existing.Type().Version)
+	}
+	if len(fields) == 0 {
+		return errors.Wrapf(ErrIDCollision, "job '%s' has the id of a queued job with a different payload", j.ID())
+	}
+	return errors.Wrapf(ErrIDCollision, "job '%s' has the id of a queued job whose payload differs in %s",
+		j.ID(), strings.Join(fields, ", "))
+}
+
+// payloadDifferences returns the sorted names of the top-level fields
+// that differ between two payloads that are JSON objects, or nothing
+// if either is not.
+func payloadDifferences(a, b []byte) []string {
+	fa, fb := map[string]json.RawMessage{}, map[string]json.RawMessage{}
+	if json.Unmarshal(a, &fa) != nil || json.Unmarshal(b, &fb) != nil {
+		return nil
+	}
+
+	out := []string{}
+	for name, value := range fa {
+		if other, ok := fb[name]; !ok || string(other) != string(value) {
+			out = append(out, name)
+		}
+	}
+	for name := range fb {
+		if _, ok := fa[name]; !ok {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+
+	return out
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentID(t *testing.T) {
+	assert := assert.New(t)
+
+	// signed jobs use their payload, and other jobs their
+	// serialization without their ids
+	a, b := newSignedTestJob("a", "true"), newSignedTestJob("b", "true")
+	idA, err := ContentID(a)
+	require.NoError(t, err)
+	idB, err := ContentID(b)
+	require.NoError(t, err)
+	assert.Equal(idA, idB)
+	assert.Contains(idA, "signed-test-")
+	assert.Len(idA, len("signed-test-")+32)
+
+	other, err := ContentID(newSignedTestJob("a", "false"))
+	require.NoError(t, err)
+	assert.NotEqual(idA, other)
+
+	first, second := job.NewShellJob("echo hello", ""), job.NewShellJob("echo hello", "")
+	require.NotEqual(t, first.ID(), second.ID())
+	require.NoError(t, SetContentID(first))
+	require.NoError(t, SetContentID(second))
+	assert.Equal(first.ID(), second.ID())
+
+	// the content id is stable once set
+	id := first.ID()
+	require.NoError(t, SetContentID(first))
+	assert.Equal(id, first.ID())
+
+	// the version of the type is part of the content
+	second.JobType.Version++
+	require.NoError(t, SetContentID(second))
+	assert.NotEqual(first.ID(), second.ID())
+}
+
+func TestCollisionCheckingQueue(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := NewCollisionCheckingQueue(nil)
+	assert.Error(err)
+
+	q, err := NewCollisionCheckingQueue(queue.NewLocalLimitedSize(1, 16))
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	require.NoError(t, q.Put(ctx, newIdempotentJob("download", "url-a")))
+
+	// the same work is a duplicate, which the wrapped queue rejects
+	err = q.Put(ctx, newIdempotentJob("download", "url-a"))
+	require.Error(t, err)
+	assert.NotEqual(ErrIDCollision, errors.Cause(err))
+
+	err = q.Put(ctx, newIdempotentJob("download", "url-b"))
+	require.Error(t, err)
+	assert.Equal(ErrIDCollision, errors.Cause(err))
+	assert.Contains(err.Error(), "differs in Key")
+
+	err = q.Put(ctx, newSignedTestJob("download", "true"))
+	require.Error(t, err)
+	assert.Equal(ErrIDCollision, errors.Cause(err))
+	assert.Contains(err.Error(), "of type signed-test")
+
+	assert.NoError(q.Put(ctx, newIdempotentJob("other", "url-b")))
+}
+
+func TestPayloadDifferences(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{"b", "c", "d"}, payloadDifferences([]byte(`{"a":1,"b":2,"c":3}`), []byte(`{"a":1,"b":3,"d":4}`)))
+	assert.Empty(payloadDifferences([]byte(`{"a":1}`), []byte(`{"a":1}`)))
+	assert.Nil(payloadDifferences([]byte(`true`), []byte(`{"a":1}`)))
+}
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// AttemptLimiter is implemented by jobs that retry themselves, or
+// that run in queues that retry them, up to a maximum number of
+// attempts. A value of 0 means that the job does not specify a limit.
+type AttemptLimiter interface {
+	MaxAttempts() int
+	SetMaxAttempts(int)
+}
+
+// Scoped is implemented by jobs that hold named scopes, which
+// queues use to prevent jobs that share a scope from running at the
+// same time.
+type Scoped interface {
+	Scopes() []string
+	SetScopes([]string)
+}
+
+// JobDefaults holds the queue-level policy that a DefaultsQueue
+// applies to jobs when they're submitted. Zero values are not
+// applied.
+type JobDefaults struct {
+	// Priority is set on jobs with a priority of 0.
+	Priority int `bson:"priority" json:"priority" yaml:"priority"`
+
+	// MaxTime is set on jobs that do not have a MaxTime in their
+	// TimeInfo.
+	MaxTime time.Duration `bson:"max_time" json:"max_time" yaml:"max_time"`
+
+	// MaxAttempts is set on jobs that implement AttemptLimiter
+	// and report 0 attempts.
+	MaxAttempts int `bson:"max_attempts" json:"max_attempts" yaml:"max_attempts"`
+
+	// ScopePrefix is prepended to every scope of jobs that
+	// implement Scoped, unless the scope already has the prefix,
+	// so that jobs in different queues sharing storage don't
+	// contend for scopes.
+	ScopePrefix string `bson:"scope_prefix" json:"scope_prefix" yaml:"scope_prefix"`
+}
+
+// Validate returns an error if any of the defaults are invalid.
+func (d JobDefaults) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(d.MaxTime < 0, "max time must be 0 or positive")
+	catcher.NewWhen(d.MaxAttempts < 0, "max attempts must be 0 or positive")
+	return catcher.Resolve()
+}
+
+// Apply sets the defaults on the job for every value that the job
+// does not specify.
+func (d JobDefaults) Apply(j amboy.Job) {
+	if d.Priority != 0 && j.Priority() == 0 {
+		j.SetPriority(d.Priority)
+	}
+
+	if d.MaxTime > 0 && j.TimeInfo().MaxTime == 0 {
+		j.UpdateTimeInfo(amboy.JobTimeInfo{MaxTime: d.MaxTime})
+	}
+
+	if al, ok := j.(AttemptLimiter); ok && d.MaxAttempts > 0 && al.MaxAttempts() == 0 {
+		al.SetMaxAttempts(d.MaxAttempts)
+	}
+
+	if sj, ok := j.(Scoped); ok && d.ScopePrefix != "" {
+		scopes := sj.Scopes()
+		if len(scopes) == 0 {
+			return
+		}
+
+		out := make([]string, 0, len(scopes))
+		for _, s := range scopes {
+			if !strings.HasPrefix(s, d.ScopePrefix) {
+				s = d.ScopePrefix + s
+			}
+			out = append(out, s)
+		}
+		sj.SetScopes(out)
+	}
+}
+
+// DefaultsQueue wraps a queue and applies a JobDefaults policy to
+// every job passed to Put, so that the policy lives with the queue
+// rather than in every job constructor call.
+//
+// Unlike the other wrappers, the DefaultsQueue only changes Put, and
+// may wrap a queue that has already started.
+type DefaultsQueue struct {
+	amboy.Queue
+	defaults JobDefaults
+}
+
+// NewDefaultsQueue wraps the queue, returning an error if the
+// defaults are not valid.
+func NewDefaultsQueue(q amboy.Queue, defaults JobDefaults) (*DefaultsQueue, error) {
+	if q == nil {
+		return nil, errors.New("cannot wrap a nil queue")
+	}
+
+	if err := defaults.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid job defaults")
+	}
+
+	return &DefaultsQueue{Queue: q, defaults: defaults}, nil
+}
+
+// Defaults returns the policy that the queue applies to jobs.
+func (q *DefaultsQueue) Defaults() JobDefaults { return q.defaults }
+
+// Put applies the defaults to the job and adds it to the wrapped
+// queue.
+func (q *DefaultsQueue) Put(ctx context.Context, j amboy.Job) error {
+	q.defaults.Apply(j)
+	return q.Queue.Put(ctx, j)
+}
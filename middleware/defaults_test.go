@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type defaultsJob struct {
+	*job.ShellJob
+	attempts int
+	scopes   []string
+}
+
+func (j *defaultsJob) MaxAttempts() int     { return j.attempts }
+func (j *defaultsJob) SetMaxAttempts(n int) { j.attempts = n }
+func (j *defaultsJob) Scopes() []string     { return j.scopes }
+func (j *defaultsJob) SetScopes(s []string) { j.scopes = s }
+
+func TestJobDefaultsValidate(t *testing.T) {
+	assert.NoError(t, JobDefaults{}.Validate())
+	assert.Error(t, JobDefaults{MaxTime: -1}.Validate())
+	assert.Error(t, JobDefaults{MaxAttempts: -1}.Validate())
+}
+
+func TestJobDefaultsApply(t *testing.T) {
+	assert := assert.New(t)
+	defaults := JobDefaults{
+		Priority:    5,
+		MaxTime:     time.Minute,
+		MaxAttempts: 3,
+		ScopePrefix: "bond.",
+	}
+
+	j := &defaultsJob{ShellJob: job.NewShellJob("true", ""), scopes: []string{"a", "bond.b"}}
+	defaults.Apply(j)
+	assert.Equal(5, j.Priority())
+	assert.Equal(time.Minute, j.TimeInfo().MaxTime)
+	assert.Equal(3, j.MaxAttempts())
+	assert.Equal([]string{"bond.a", "bond.b"}, j.Scopes())
+
+	// values the job specifies are left alone
+	j = &defaultsJob{ShellJob: job.NewShellJob("true", ""), attempts: 1}
+	j.SetPriority(1)
+	j.UpdateTimeInfo(amboy.JobTimeInfo{MaxTime: time.Second})
+	defaults.Apply(j)
+	assert.Equal(1, j.Priority())
+	assert.Equal(time.Second, j.TimeInfo().MaxTime)
+	assert.Equal(1, j.MaxAttempts())
+	assert.Len(j.Scopes(), 0)
+}
+
+func TestDefaultsQueue(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := NewDefaultsQueue(nil, JobDefaults{})
+	assert.Error(err)
+	_, err = NewDefaultsQueue(queue.NewLocalLimitedSize(1, 16), JobDefaults{MaxAttempts: -1})
+	assert.Error(err)
+
+	base := queue.NewLocalLimitedSize(1, 16)
+	require.NoError(t, base.Start(ctx))
+	q, err := NewDefaultsQueue(base, JobDefaults{Priority: 2, MaxTime: time.Minute})
+	require.NoError(t, err)
+	assert.Equal(2, q.Defaults().Priority)
+
+	j := job.NewShellJob("true", "")
+	require.NoError(t, q.Put(ctx, j))
+
+	out, ok := base.Get(ctx, j.ID())
+	require.True(t, ok)
+	assert.Equal(2, out.Priority())
+	assert.Equal(time.Minute, out.TimeInfo().MaxTime)
+}
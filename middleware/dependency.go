@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/dependency"
+	"github.com/pkg/errors"
+)
+
+// QueueDependency is implemented by dependency managers that resolve
+// their state from a queue, such as BarrierDependency, and recall's
+// OncePerPeriod and UnlessCompleted. The queue is not serialized with
+// the manager, so the managers of jobs read from a remote driver have
+// no queue until a DependencyQueue attaches its own.
+type QueueDependency interface {
+	dependency.Manager
+	SetQueue(amboy.Queue)
+}
+
+// DependencyQueue wraps a queue and resolves the dependencies of the
+// jobs that it dispatches that resolve from a queue (see
+// QueueDependency), after attaching the wrapped queue to them: jobs
+// whose dependencies are Ready run, jobs whose dependencies Passed
+// complete without running, as in ordered queues, and the queue holds
+// jobs whose dependencies are Blocked until they are not. Jobs with
+// other dependencies dispatch unchanged.
+//
+// Held jobs stay in the queue's storage, unchanged, so other processes
+// that share a remote queue can still dispatch them, and a held job
+// dispatches once from whichever process resolves its dependency
+// first.
+//
+// Wrap unordered queues, which dispatch jobs regardless of their
+// dependencies: ordered queues check dependencies themselves, and
+// don't dispatch blocked jobs again.
+type DependencyQueue struct {
+	amboy.Queue
+
+	interval time.Duration
+	mu       sync.Mutex
+	held     []amboy.Job
+	checked  time.Time
+}
+
+// NewDependencyQueue wraps a queue, which must not have started, and
+// checks the dependencies of held jobs on the interval, which
+// defaults to one second. Start the returned queue rather than the
+// wrapped queue.
+func NewDependencyQueue(q amboy.Queue, interval time.Duration) (*DependencyQueue, error) {
+	if interval < 0 {
+		return nil, errors.New("dependency check interval must not be negative")
+	}
+	if interval == 0 {
+		interval = time.Second
+	}
+
+	dq := &DependencyQueue{Queue: q, interval: interval}
+	if err := attach(q, dq); err != nil {
+		return nil, err
+	}
+
+	return dq, nil
+}
+
+// Held returns the IDs of the jobs that the queue is holding.
+func (q *DependencyQueue) Held() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ids := make([]string, 0, len(q.held))
+	for _, j := range q.held {
+		ids = append(ids, j.ID())
+	}
+
+	return ids
+}
+
+// Next returns the next job from the wrapped queue whose dependency,
+// if it resolves from a queue, is Ready. Next returns held jobs once
+// their dependencies are ready, before new jobs.
+func (q *DependencyQueue) Next(ctx context.Context) amboy.Job {
+	for {
+		if j := q.release(ctx); j != nil {
+			return j
+		}
+
+		nctx, cancel := context.WithTimeout(ctx, q.interval)
+		j := q.Queue.Next(nctx)
+		cancel()
+
+		if ctx.Err() != nil {
+			if j != nil {
+				q.hold(j)
+			}
+			return nil
+		}
+		if j == nil {
+			continue
+		}
+
+		switch q.state(j) {
+		case dependency.Blocked:
+			q.hold(j)
+		case dependency.Passed:
+			q.pass(ctx, j)
+		default:
+			return j
+		}
+	}
+}
+
+// SetRunner sets the runner of the wrapped queue.
+func (q *DependencyQueue) SetRunner(r amboy.Runner) error { return setRunner(q.Queue, q, r) }
+
+// state attaches the wrapped queue to the job's dependency, if it
+// resolves from a queue, and returns the dependency's state.
+func (q *DependencyQueue) state(j amboy.Job) dependency.State {
+	d, ok := j.Dependency().(QueueDependency)
+	if !ok {
+		return dependency.Ready
+	}
+
+	d.SetQueue(q.Queue)
+	return d.State()
+}
+
+// pass completes the job, whose dependency passed, without running it.
+func (q *DependencyQueue) pass(ctx context.Context, j amboy.Job) {
+	stat := j.Status()
+	stat.Completed = true
+	stat.InProgress = false
+	j.SetStatus(stat)
+
+	now := time.Now()
+	j.UpdateTimeInfo(amboy.JobTimeInfo{Start: now, End: now})
+	q.Queue.Complete(ctx, j)
+}
+
+func (q *DependencyQueue) hold(j amboy.Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.held = append(q.held, j)
+}
+
+// release returns a held job whose dependency is ready, checking the
+// held jobs at most once per interval, and completes the held jobs
+// whose dependencies passed.
+func (q *DependencyQueue) release(ctx context.Context) amboy.Job {
+	j, passed := q.check(ctx)
+	for _, pj := range passed {
+		q.pass(ctx, pj)
+	}
+
+	return j
+}
+
+// check removes held jobs whose dependencies are no longer blocked,
+// returning the first that is ready and those that passed. Jobs that
+// other processes started or completed while they were held are
+// dropped.
+func (q *DependencyQueue) check(ctx context.Context) (amboy.Job, []amboy.Job) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.held) == 0 || time.Since(q.checked) < q.interval {
+		return nil, nil
+	}
+	q.checked = time.Now()
+
+	var passed []amboy.Job
+	for idx := 0; idx < len(q.held); idx++ {
+		j := q.held[idx]
+		if stored, ok := q.Queue.Get(ctx, j.ID()); ok && stored != j && (stored.Status().Completed || stored.Status().InProgress) {
+			q.held = append(q.held[:idx], q.held[idx+1:]...)
+			idx--
+			continue
+		}
+
+		switch q.state(j) {
+		case dependency.Blocked:
+			continue
+		case dependency.Passed:
+			q.held = append(q.held[:idx], q.held[idx+1:]...)
+			idx--
+			passed = append(passed, j)
+		default:
+			q.held = append(q.held[:idx], q.held[idx+1:]...)
+			return j, passed
+		}
+	}
+
+	return nil, passed
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/dependency"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/jobs"
+)
+
+// stateDependency resolves to its state, once it has a queue.
+type stateDependency struct {
+	dependency.Manager
+
+	mu    sync.Mutex
+	state dependency.State
+	queue amboy.Queue
+}
+
+func newStateDependency(state dependency.State) *stateDependency {
+	return &stateDependency{Manager: dependency.NewAlways(), state: state}
+}
+
+func (d *stateDependency) SetQueue(q amboy.Queue) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.queue = q
+}
+
+func (d *stateDependency) set(state dependency.State) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.state = state
+}
+
+func (d *stateDependency) State() dependency.State {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.queue == nil {
+		return dependency.Unresolved
+	}
+	return d.state
+}
+
+func TestDependencyQueueResolvesQueueDependencies(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	wrapped := queue.NewLocalLimitedSize(2, 128)
+	q, err := NewDependencyQueue(wrapped, 10*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	// jobs whose dependencies passed complete without running
+	passed := job.NewShellJob("false", "")
+	passed.SetID("passed")
+	passedDep := newStateDependency(dependency.Passed)
+	passed.SetDependency(passedDep)
+	require.NoError(t, q.Put(ctx, passed))
+	require.NoError(t, jobs.WaitJob(ctx, q, "passed", jobs.Backoff{}))
+	assert.True(passed.Status().Completed)
+	assert.NoError(passed.Error())
+	assert.True(passedDep.queue == wrapped)
+
+	// blocked jobs are held until their dependency is ready
+	blocked := job.NewShellJob("true", "")
+	blocked.SetID("blocked")
+	blockedDep := newStateDependency(dependency.Blocked)
+	blocked.SetDependency(blockedDep)
+	require.NoError(t, q.Put(ctx, blocked))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal([]string{"blocked"}, q.Held())
+	assert.False(blocked.Status().Completed)
+
+	blockedDep.set(dependency.Ready)
+	require.NoError(t, jobs.WaitJob(ctx, q, "blocked", jobs.Backoff{}))
+	assert.NoError(blocked.Error())
+	assert.Len(q.Held(), 0)
+
+	// held jobs may pass, too
+	later := job.NewShellJob("false", "")
+	later.SetID("later")
+	laterDep := newStateDependency(dependency.Blocked)
+	later.SetDependency(laterDep)
+	require.NoError(t, q.Put(ctx, later))
+	time.Sleep(50 * time.Millisecond)
+	laterDep.set(dependency.Passed)
+	require.NoError(t, jobs.WaitJob(ctx, q, "later", jobs.Backoff{}))
+	assert.NoError(later.Error())
+
+	_, err = NewDependencyQueue(queue.NewLocalLimitedSize(1, 1), -time.Second)
+	assert.Error(err)
+}
@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/tychoish/bond/management"
+)
+
+// EnvironmentRecorder is implemented by jobs that store the
+// environments of the processes that dispatch and complete them, so
+// that the environments persist with the job in the queue's storage.
+type EnvironmentRecorder interface {
+	RecordEnvironment(action string, env management.Environment)
+}
+
+// JobEnvironments stores a job's environments, and implements
+// EnvironmentRecorder for the jobs that embed it.
+type JobEnvironments struct {
+	Dispatched *management.Environment `bson:"dispatched,omitempty" json:"dispatched,omitempty" yaml:"dispatched,omitempty"`
+	Completed  *management.Environment `bson:"completed,omitempty" json:"completed,omitempty" yaml:"completed,omitempty"`
+}
+
+// RecordEnvironment stores the environment of the dispatch or of the
+// completion (or failure) of the job.
+func (e *JobEnvironments) RecordEnvironment(action string, env management.Environment) {
+	switch action {
+	case management.ActionDispatch:
+		e.Dispatched = &env
+	case management.ActionComplete, management.ActionFail:
+		e.Completed = &env
+	}
+}
+
+// RecordedEnvironment returns the environment of the job's
+// completion, or of its dispatch if it has not completed, for
+// replays (see management.EnvironmentReporter).
+func (e *JobEnvironments) RecordedEnvironment() (management.Environment, bool) {
+	switch {
+	case e.Completed != nil:
+		return *e.Completed, true
+	case e.Dispatched != nil:
+		return *e.Dispatched, true
+	default:
+		return management.Environment{}, false
+	}
+}
+
+// EnvironmentQueue wraps a queue and records the environment of the
+// worker's process in jobs that implement EnvironmentRecorder when
+// they're dispatched and before they're marked complete. The queue
+// saves dispatched jobs, so that the dispatching environment is in
+// the queue's storage while the job runs, including for jobs whose
+// workers never complete them. Other jobs pass through unchanged.
+type EnvironmentQueue struct {
+	amboy.Queue
+}
+
+// NewEnvironmentQueue wraps a queue, which must not have started.
+// Start the returned queue rather than the wrapped queue.
+func NewEnvironmentQueue(q amboy.Queue) (*EnvironmentQueue, error) {
+	eq := &EnvironmentQueue{Queue: q}
+	if err := attach(q, eq); err != nil {
+		return nil, err
+	}
+
+	return eq, nil
+}
+
+// Next returns the next job from the wrapped queue, after recording
+// the dispatching environment.
+func (q *EnvironmentQueue) Next(ctx context.Context) amboy.Job {
+	j := q.Queue.Next(ctx)
+	if j == nil {
+		return nil
+	}
+
+	if rec, ok := j.(EnvironmentRecorder); ok {
+		rec.RecordEnvironment(management.ActionDispatch, management.CurrentEnvironment())
+		grip.Warning(message.WrapError(q.Queue.Save(ctx, j), message.Fields{
+			"message": "problem saving the environment of a dispatched job",
+			"job":     j.ID(),
+		}))
+	}
+
+	return j
+}
+
+// Complete records the completing environment, and then marks the
+// job complete in the wrapped queue.
+func (q *EnvironmentQueue) Complete(ctx context.Context, j amboy.Job) {
+	if rec, ok := j.(EnvironmentRecorder); ok {
+		action := management.ActionComplete
+		if j.Error() != nil {
+			action = management.ActionFail
+		}
+		rec.RecordEnvironment(action, management.CurrentEnvironment())
+	}
+
+	q.Queue.Complete(ctx, j)
+}
+
+// SetRunner sets the runner of the wrapped queue.
+func (q *EnvironmentQueue) SetRunner(r amboy.Runner) error { return setRunner(q.Queue, q, r) }
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/management"
+)
+
+type environmentJob struct {
+	*job.ShellJob
+	JobEnvironments
+}
+
+func TestEnvironmentQueueRecordsEnvironments(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q, err := NewEnvironmentQueue(queue.NewLocalLimitedSize(1, 16))
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	passing := &environmentJob{ShellJob: job.NewShellJob("true", "")}
+	passing.SetID("passing")
+	failing := &environmentJob{ShellJob: job.NewShellJob("false", "")}
+	failing.SetID("failing")
+	plain := job.NewShellJob("true", "")
+	plain.SetID("plain")
+	for _, j := range []amboy.Job{passing, failing, plain} {
+		require.NoError(t, q.Put(ctx, j))
+	}
+
+	amboy.WaitInterval(ctx, q, 10*time.Millisecond)
+
+	for _, j := range []*environmentJob{passing, failing} {
+		require.NotNil(t, j.Dispatched, j.ID())
+		require.NotNil(t, j.Completed, j.ID())
+		assert.Equal(os.Getpid(), j.Completed.PID)
+		assert.Equal(runtime.Version(), j.Completed.GoVersion)
+		assert.NotEmpty(j.Completed.Host)
+		assert.NotEmpty(j.Completed.BondVersion)
+		assert.False(j.Completed.Time.Before(j.Dispatched.Time))
+	}
+}
+
+func TestEnvironmentQueueRequiresStoppedQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := queue.NewLocalLimitedSize(1, 16)
+	require.NoError(t, q.Start(ctx))
+
+	_, err := NewEnvironmentQueue(q)
+	assert.Error(t, err)
+}
+
+func TestJobEnvironmentsRecordActions(t *testing.T) {
+	assert := assert.New(t)
+	env := management.CurrentEnvironment()
+
+	rec := &JobEnvironments{}
+	rec.RecordEnvironment(management.ActionRequeue, env)
+	assert.Nil(rec.Dispatched)
+	assert.Nil(rec.Completed)
+	_, ok := rec.RecordedEnvironment()
+	assert.False(ok)
+
+	rec.RecordEnvironment(management.ActionDispatch, env)
+	recorded, ok := rec.RecordedEnvironment()
+	assert.True(ok)
+	assert.Equal(env, recorded)
+
+	completed := env
+	completed.Host = "worker"
+	rec.RecordEnvironment(management.ActionFail, completed)
+	require.NotNil(t, rec.Dispatched)
+	require.NotNil(t, rec.Completed)
+	assert.Equal(completed, *rec.Completed)
+	recorded, _ = rec.RecordedEnvironment()
+	assert.Equal("worker", recorded.Host)
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip/recovery"
+)
+
+// Hook is a callback that runs at a point in a job's lifecycle,
+// receiving the job and its status at that point.
+type Hook func(context.Context, amboy.Job, amboy.JobStatusInfo)
+
+// HookedQueue wraps a queue and runs registered hooks when jobs are
+// dispatched to a worker (OnDispatch), and when they complete
+// successfully (OnComplete) or with errors (OnError). Use hooks to
+// send notifications or update external systems for all jobs in a
+// queue, without wrapping every job type.
+//
+// Hooks run synchronously in the worker that processes the job, in
+// the order they were registered, and should return quickly. Panics
+// in hooks are logged and do not affect the job or the queue.
+type HookedQueue struct {
+	amboy.Queue
+
+	mu       sync.RWMutex
+	dispatch []Hook
+	complete []Hook
+	errored  []Hook
+	stuck    []Hook
+}
+
+// NewHookedQueue wraps a queue, which must not have started, so that
+// hooks may be registered for its jobs. Start the returned queue
+// rather than the wrapped queue.
+func NewHookedQueue(q amboy.Queue) (*HookedQueue, error) {
+	hq := &HookedQueue{Queue: q}
+	if err := attach(q, hq); err != nil {
+		return nil, err
+	}
+
+	return hq, nil
+}
+
+// OnDispatch registers a hook that runs when a job is dispatched to a
+// worker, before the job runs.
+func (q *HookedQueue) OnDispatch(h Hook) { q.addHook(&q.dispatch, h) }
+
+// OnComplete registers a hook that runs after a job completes without
+// errors.
+func (q *HookedQueue) OnComplete(h Hook) { q.addHook(&q.complete, h) }
+
+// OnError registers a hook that runs after a job completes with
+// errors.
+func (q *HookedQueue) OnError(h Hook) { q.addHook(&q.errored, h) }
+
+// OnStuck registers a hook that runs when a stuck job monitor (see
+// MonitorStuck) first detects that a job is stuck.
+func (q *HookedQueue) OnStuck(h Hook) { q.addHook(&q.stuck, h) }
+
+func (q *HookedQueue) addHook(hooks *[]Hook, h Hook) {
+	if h == nil {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	*hooks = append(*hooks, h)
+}
+
+// Next returns the next job from the wrapped queue, after running
+// the dispatch hooks.
+func (q *HookedQueue) Next(ctx context.Context) amboy.Job {
+	j := q.Queue.Next(ctx)
+	if j != nil {
+		q.run(ctx, &q.dispatch, j)
+	}
+
+	return j
+}
+
+// Complete marks the job complete in the wrapped queue, and then
+// runs either the completion or the error hooks.
+func (q *HookedQueue) Complete(ctx context.Context, j amboy.Job) {
+	q.Queue.Complete(ctx, j)
+
+	if j.Error() != nil {
+		q.run(ctx, &q.errored, j)
+		return
+	}
+
+	q.run(ctx, &q.complete, j)
+}
+
+// SetRunner sets the runner of the wrapped queue.
+func (q *HookedQueue) SetRunner(r amboy.Runner) error { return setRunner(q.Queue, q, r) }
+
+func (q *HookedQueue) run(ctx context.Context, registered *[]Hook, j amboy.Job) {
+	q.mu.RLock()
+	hooks := append([]Hook(nil), *registered...)
+	q.mu.RUnlock()
+
+	stat := j.Status()
+	for _, h := range hooks {
+		func() {
+			defer recovery.LogStackTraceAndContinue("lifecycle hook", j.ID())
+			h(ctx, j, stat)
+		}()
+	}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type hookRecorder struct {
+	mu     sync.Mutex
+	events map[string][]string
+}
+
+func (r *hookRecorder) hook(name string) Hook {
+	return func(_ context.Context, j amboy.Job, _ amboy.JobStatusInfo) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.events[name] = append(r.events[name], j.ID())
+	}
+}
+
+func (r *hookRecorder) get(name string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.events[name]
+}
+
+func TestHookedQueueRunsLifecycleHooks(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q, err := NewHookedQueue(queue.NewLocalLimitedSize(1, 128))
+	require.NoError(t, err)
+
+	rec := &hookRecorder{events: map[string][]string{}}
+	q.OnDispatch(rec.hook("dispatch"))
+	q.OnComplete(rec.hook("complete"))
+	q.OnError(rec.hook("error"))
+	q.OnComplete(func(context.Context, amboy.Job, amboy.JobStatusInfo) { panic("hook panic") })
+	q.OnError(nil)
+
+	require.NoError(t, q.Start(ctx))
+
+	passing := job.NewShellJob("true", "")
+	passing.SetID("passing")
+	failing := job.NewShellJob("false", "")
+	failing.SetID("failing")
+	require.NoError(t, q.Put(ctx, passing))
+	require.NoError(t, q.Put(ctx, failing))
+
+	// completion hooks run after the queue records the job as
+	// complete, so wait for the hooks rather than the queue.
+	for len(rec.get("complete"))+len(rec.get("error")) < 2 && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	dispatched := rec.get("dispatch")
+	assert.Len(dispatched, 2)
+	assert.Contains(dispatched, "passing")
+	assert.Contains(dispatched, "failing")
+	assert.Equal([]string{"passing"}, rec.get("complete"))
+	assert.Equal([]string{"failing"}, rec.get("error"))
+}
+
+func TestHookedQueueRequiresStoppedQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := queue.NewLocalLimitedSize(1, 128)
+	require.NoError(t, q.Start(ctx))
+
+	_, err := NewHookedQueue(q)
+	assert.Error(t, err)
+
+	_, err = NewHookedQueue(nil)
+	assert.Error(t, err)
+}
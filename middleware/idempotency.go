@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/pkg/errors"
+)
+
+// ErrDuplicateSubmission is returned by an IdempotentQueue for jobs
+// whose idempotency key was submitted within the queue's window.
+var ErrDuplicateSubmission = errors.New("duplicate submission")
+
+// Idempotent is implemented by jobs that carry an idempotency key,
+// set by the submitter, that identifies a submission independently of
+// the job's ID, so that submitters can retry a submission with a new
+// job (and ID) without creating duplicate work.
+type Idempotent interface {
+	IdempotencyKey() string
+	SetIdempotencyKey(string)
+}
+
+// IdempotentQueue wraps a queue and rejects jobs at Put, with
+// ErrDuplicateSubmission, whose idempotency key was submitted within
+// the queue's window, so that a submitter that can't tell whether a
+// submission succeeded (e.g. after a timeout from a remote queue) may
+// safely submit it again. Jobs without a key pass through unchanged.
+//
+// When the wrapped queue's Put fails, the queue records the key, and
+// a retry with the key is only rejected if the job of the failed
+// submission is in the wrapped queue. Keys are recorded by the
+// process, so processes sharing a queue's storage each check their
+// own submissions.
+//
+// Like the DefaultsQueue, the IdempotentQueue only changes Put.
+type IdempotentQueue struct {
+	amboy.Queue
+
+	window      time.Duration
+	mu          sync.Mutex
+	submissions map[string]submission
+}
+
+type submission struct {
+	id        string
+	submitted time.Time
+	confirmed bool
+}
+
+// NewIdempotentQueue wraps the queue, rejecting the keys of
+// submissions made within the window.
+func NewIdempotentQueue(q amboy.Queue, window time.Duration) (*IdempotentQueue, error) {
+	if q == nil {
+		return nil, errors.New("cannot wrap a nil queue")
+	}
+
+	if window <= 0 {
+		return nil, errors.New("idempotency window must be positive")
+	}
+
+	return &IdempotentQueue{Queue: q, window: window, submissions: map[string]submission{}}, nil
+}
+
+// Window returns the time for which the queue rejects the keys of
+// submissions.
+func (q *IdempotentQueue) Window() time.Duration { return q.window }
+
+// Submission returns the ID of the job submitted with the key within
+// the window, if any.
+func (q *IdempotentQueue) Submission(key string) (string, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	sub, ok := q.submissions[key]
+	if !ok || time.Since(sub.submitted) > q.window {
+		return "", false
+	}
+
+	return sub.id, true
+}
+
+// Put adds the job to the wrapped queue, unless its idempotency key
+// was submitted within the window.
+func (q *IdempotentQueue) Put(ctx context.Context, j amboy.Job) error {
+	ij, ok := j.(Idempotent)
+	if !ok || ij.IdempotencyKey() == "" {
+		return q.Queue.Put(ctx, j)
+	}
+	key := ij.IdempotencyKey()
+
+	// hold the lock across the wrapped Put, so that concurrent
+	// retries of a submission cannot both add their jobs.
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	for k, sub := range q.submissions {
+		if now.Sub(sub.submitted) > q.window {
+			delete(q.submissions, k)
+		}
+	}
+
+	if sub, ok := q.submissions[key]; ok {
+		if !sub.confirmed {
+			_, sub.confirmed = q.Queue.Get(ctx, sub.id)
+			q.submissions[key] = sub
+		}
+		if sub.confirmed {
+			return errors.Wrapf(ErrDuplicateSubmission, "job '%s' has the idempotency key '%s' of job '%s'",
+				j.ID(), key, sub.id)
+		}
+	}
+
+	err := q.Queue.Put(ctx, j)
+	q.submissions[key] = submission{id: j.ID(), submitted: now, confirmed: err == nil}
+	return err
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type idempotentJob struct {
+	*job.Base
+	Key string
+}
+
+func newIdempotentJob(id, key string) *idempotentJob {
+	j := &idempotentJob{Base: &job.Base{JobType: amboy.JobType{Name: "idempotent-test"}}, Key: key}
+	j.SetID(id)
+	j.SetDependency(nil)
+	return j
+}
+
+func (j *idempotentJob) IdempotencyKey() string       { return j.Key }
+func (j *idempotentJob) SetIdempotencyKey(key string) { j.Key = key }
+func (j *idempotentJob) Run(context.Context)          { j.MarkComplete() }
+
+// ambiguousQueue, while failing, reports that Puts failed, after
+// adding the jobs if it adds them, like a remote queue whose reply
+// was lost.
+type ambiguousQueue struct {
+	amboy.Queue
+	failing bool
+	add     bool
+}
+
+func (q *ambiguousQueue) Put(ctx context.Context, j amboy.Job) error {
+	if !q.failing || q.add {
+		if err := q.Queue.Put(ctx, j); err != nil {
+			return err
+		}
+	}
+	if q.failing {
+		return errors.New("connection reset")
+	}
+	return nil
+}
+
+func TestNewIdempotentQueue(t *testing.T) {
+	_, err := NewIdempotentQueue(nil, time.Minute)
+	assert.Error(t, err)
+	_, err = NewIdempotentQueue(queue.NewLocalLimitedSize(1, 16), 0)
+	assert.Error(t, err)
+
+	q, err := NewIdempotentQueue(queue.NewLocalLimitedSize(1, 16), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, q.Window())
+}
+
+func TestIdempotentQueueRejectsDuplicateSubmissions(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q, err := NewIdempotentQueue(queue.NewLocalLimitedSize(1, 16), time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	require.NoError(t, q.Put(ctx, newIdempotentJob("first", "submission")))
+	err = q.Put(ctx, newIdempotentJob("retry", "submission"))
+	require.Error(t, err)
+	assert.Equal(ErrDuplicateSubmission, errors.Cause(err))
+	_, ok := q.Get(ctx, "retry")
+	assert.False(ok)
+
+	id, ok := q.Submission("submission")
+	assert.True(ok)
+	assert.Equal("first", id)
+
+	// jobs with other keys, or without keys, are not rejected
+	assert.NoError(q.Put(ctx, newIdempotentJob("other", "other")))
+	assert.NoError(q.Put(ctx, newIdempotentJob("unkeyed-0", "")))
+	assert.NoError(q.Put(ctx, newIdempotentJob("unkeyed-1", "")))
+	assert.NoError(q.Put(ctx, newLoggingJob("untyped")))
+}
+
+func TestIdempotentQueueExpiresKeys(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q, err := NewIdempotentQueue(queue.NewLocalLimitedSize(1, 16), 50*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	require.NoError(t, q.Put(ctx, newIdempotentJob("first", "submission")))
+	time.Sleep(100 * time.Millisecond)
+
+	_, ok := q.Submission("submission")
+	assert.False(ok)
+	assert.NoError(q.Put(ctx, newIdempotentJob("second", "submission")))
+}
+
+func TestIdempotentQueueChecksFailedSubmissions(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// a submission that failed before reaching the queue may be
+	// retried
+	wrapped := &ambiguousQueue{Queue: queue.NewLocalLimitedSize(1, 16), failing: true}
+	q, err := NewIdempotentQueue(wrapped, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	assert.Error(q.Put(ctx, newIdempotentJob("lost", "submission")))
+	wrapped.failing = false
+	assert.NoError(q.Put(ctx, newIdempotentJob("retry", "submission")))
+
+	// a submission whose reply was lost is not repeated
+	wrapped = &ambiguousQueue{Queue: queue.NewLocalLimitedSize(1, 16), failing: true, add: true}
+	q, err = NewIdempotentQueue(wrapped, time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	err = q.Put(ctx, newIdempotentJob("added", "submission"))
+	require.Error(t, err)
+	assert.NotEqual(ErrDuplicateSubmission, errors.Cause(err))
+	wrapped.failing = false
+	err = q.Put(ctx, newIdempotentJob("retry", "submission"))
+	assert.Equal(ErrDuplicateSubmission, errors.Cause(err))
+	_, ok := q.Get(ctx, "retry")
+	assert.False(ok)
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/driver"
+)
+
+type lockerCtxKey struct{}
+
+// WithLocker returns a context that carries the Locker, for use by
+// jobs during Run.
+func WithLocker(ctx context.Context, l driver.Locker) context.Context {
+	return context.WithValue(ctx, lockerCtxKey{}, l)
+}
+
+// Locker returns the Locker attached to the context by a LockingQueue,
+// if any.
+func Locker(ctx context.Context) (driver.Locker, bool) {
+	l, ok := ctx.Value(lockerCtxKey{}).(driver.Locker)
+	return l, ok && l != nil
+}
+
+// JobLock returns a keyed lock (see driver.KeyedLock) on the key of
+// the context's Locker, owned by the job as run by the worker that
+// holds its lock, so that a run of the job on another worker, after
+// this one stopped, does not take over its keyed locks.
+func JobLock(ctx context.Context, j amboy.Job, key string, ttl time.Duration) (*driver.KeyedLock, error) {
+	l, ok := Locker(ctx)
+	if !ok {
+		return nil, errors.Errorf("job '%s' was not run by a locking queue", j.ID())
+	}
+
+	owner := j.ID()
+	if worker := j.Status().Owner; worker != "" {
+		owner = fmt.Sprintf("%s@%s", owner, worker)
+	}
+
+	return driver.NewLockerLock(l, driver.KeyedLockOptions{Key: key, Owner: owner, TTL: ttl})
+}
+
+// LockingQueue wraps a queue and provides every job that it runs with
+// a Locker (see Locker and JobLock), typically the driver of a remote
+// queue, so that jobs on different workers can coordinate their use
+// of shared resources, such as a cache directory or a prefix of a
+// mirror's bucket, through the queue's storage.
+type LockingQueue struct {
+	amboy.Queue
+
+	locker driver.Locker
+}
+
+// NewLockingQueue wraps a queue, which must not have started, so that
+// its jobs run with the Locker. Start the returned queue rather than
+// the wrapped queue.
+func NewLockingQueue(q amboy.Queue, l driver.Locker) (*LockingQueue, error) {
+	if l == nil {
+		return nil, errors.New("must specify a locker")
+	}
+
+	lq := &LockingQueue{Queue: q, locker: l}
+	if err := attach(q, lq); err != nil {
+		return nil, err
+	}
+
+	return lq, nil
+}
+
+// Next returns the next job from the wrapped queue, wrapped so that
+// it runs with the Locker.
+func (q *LockingQueue) Next(ctx context.Context) amboy.Job {
+	j := q.Queue.Next(ctx)
+	if j == nil {
+		return nil
+	}
+
+	return &lockingJob{Job: j, locker: q.locker}
+}
+
+// Save saves the job in the wrapped queue.
+func (q *LockingQueue) Save(ctx context.Context, j amboy.Job) error {
+	return q.Queue.Save(ctx, unwrapLocking(j))
+}
+
+// Complete marks the job complete in the wrapped queue.
+func (q *LockingQueue) Complete(ctx context.Context, j amboy.Job) {
+	q.Queue.Complete(ctx, unwrapLocking(j))
+}
+
+// SetRunner sets the runner of the wrapped queue.
+func (q *LockingQueue) SetRunner(r amboy.Runner) error { return setRunner(q.Queue, q, r) }
+
+// lockingJob adds the Locker to the context passed to the job's Run
+// method. As with loggedJob, the queue unwraps jobs before storing
+// them.
+type lockingJob struct {
+	amboy.Job
+	locker driver.Locker
+}
+
+func (j *lockingJob) Run(ctx context.Context) { j.Job.Run(WithLocker(ctx, j.locker)) }
+
+func unwrapLocking(j amboy.Job) amboy.Job {
+	if lj, ok := j.(*lockingJob); ok {
+		return lj.Job
+	}
+
+	return j
+}
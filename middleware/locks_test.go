@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/driver"
+)
+
+// lockedResource records the most users that it had at once.
+type lockedResource struct {
+	mu    sync.Mutex
+	users int
+	most  int
+}
+
+func (r *lockedResource) use() {
+	r.mu.Lock()
+	r.users++
+	if r.users > r.most {
+		r.most = r.users
+	}
+	r.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	r.mu.Lock()
+	r.users--
+	r.mu.Unlock()
+}
+
+type lockJob struct {
+	*job.Base
+	resource *lockedResource
+}
+
+func newLockJob(id string, r *lockedResource) *lockJob {
+	j := &lockJob{Base: &job.Base{JobType: amboy.JobType{Name: "lock-test"}}, resource: r}
+	j.SetID(id)
+	j.SetDependency(nil)
+	return j
+}
+
+func (j *lockJob) Run(ctx context.Context) {
+	defer j.MarkComplete()
+
+	lock, err := JobLock(ctx, j, "resource", 500*time.Millisecond)
+	if err != nil {
+		j.AddError(err)
+		return
+	}
+	j.AddError(lock.Hold(ctx, func(context.Context) error {
+		j.resource.use()
+		return nil
+	}))
+}
+
+func TestLockingQueueSerializesSharedResources(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := NewLockingQueue(queue.NewLocalLimitedSize(1, 16), nil)
+	assert.Error(err)
+
+	locks := driver.NewLockTable(nil)
+	q, err := NewLockingQueue(queue.NewLocalLimitedSize(4, 16), locks)
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	r := &lockedResource{}
+	ids := []string{"a", "b", "c", "d", "e", "f"}
+	for _, id := range ids {
+		require.NoError(t, q.Put(ctx, newLockJob(id, r)))
+	}
+	require.True(t, amboy.WaitInterval(ctx, q, 10*time.Millisecond))
+
+	for _, id := range ids {
+		out, ok := q.Get(ctx, id)
+		require.True(t, ok)
+		require.IsType(t, &lockJob{}, out)
+		assert.NoError(out.Error())
+	}
+	assert.Equal(1, r.most)
+	assert.Len(locks.Locks(), 0)
+}
+
+func TestJobLockWithoutLockingQueue(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	j := newLockJob("job", &lockedResource{})
+	_, ok := Locker(ctx)
+	assert.False(ok)
+	_, err := JobLock(ctx, j, "resource", time.Minute)
+	assert.Error(err)
+
+	locks := driver.NewLockTable(nil)
+	require.NoError(t, j.Lock("worker"))
+	lock, err := JobLock(WithLocker(ctx, locks), j, "resource", time.Minute)
+	require.NoError(t, err)
+	require.NoError(t, lock.TryAcquire(ctx))
+	require.Len(t, locks.Locks(), 1)
+	assert.Equal("job@worker", locks.Locks()[0].Owner)
+}
@@ -0,0 +1,198 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/logging"
+	"github.com/mongodb/grip/message"
+	"github.com/mongodb/grip/send"
+	"github.com/pkg/errors"
+)
+
+type loggerCtxKey struct{}
+
+// WithLogger returns a context that carries the logger, for use by
+// jobs (and the code they call) during Run.
+func WithLogger(ctx context.Context, logger grip.Journaler) context.Context {
+	return context.WithValue(ctx, loggerCtxKey{}, logger)
+}
+
+// Logger returns the logger attached to the context by a
+// LoggingQueue, or a logger that uses grip's global sender if the
+// context has no logger. Jobs should use this logger rather than the
+// global grip functions, so that their messages are annotated and
+// filtered according to the queue's configuration.
+func Logger(ctx context.Context) grip.Journaler {
+	if logger, ok := ctx.Value(loggerCtxKey{}).(grip.Journaler); ok {
+		return logger
+	}
+
+	return logging.MakeGrip(grip.GetSender())
+}
+
+// LoggingQueue wraps a queue and provides every job that it runs
+// with a logger (see Logger) that attaches the job's ID and type to
+// every message, and that filters messages using a threshold set for
+// the queue, the job's type, or the job itself.
+//
+// The thresholds take the place of the sender's threshold, so the
+// sender should be configured to accept all messages (e.g. with a
+// threshold of level.Trace).
+type LoggingQueue struct {
+	amboy.Queue
+
+	sender   send.Sender
+	mu       sync.RWMutex
+	defLevel level.Priority
+	types    map[string]level.Priority
+	jobs     map[string]level.Priority
+}
+
+// NewLoggingQueue wraps a queue, which must not have started, so that
+// its jobs log to the sender at the specified default threshold. If
+// the sender is nil, the queue uses grip's global sender. Start the
+// returned queue rather than the wrapped queue.
+func NewLoggingQueue(q amboy.Queue, sender send.Sender, threshold level.Priority) (*LoggingQueue, error) {
+	if !level.IsValidPriority(threshold) {
+		return nil, errors.Errorf("%d is not a valid log level", threshold)
+	}
+
+	if sender == nil {
+		sender = grip.GetSender()
+	}
+
+	lq := &LoggingQueue{
+		Queue:    q,
+		sender:   sender,
+		defLevel: threshold,
+		types:    map[string]level.Priority{},
+		jobs:     map[string]level.Priority{},
+	}
+	if err := attach(q, lq); err != nil {
+		return nil, err
+	}
+
+	return lq, nil
+}
+
+// SetTypeLevel sets the threshold for jobs of the specified type,
+// replacing the queue's default.
+func (q *LoggingQueue) SetTypeLevel(jobType string, threshold level.Priority) error {
+	return q.setLevel(q.types, jobType, threshold)
+}
+
+// SetJobLevel sets the threshold for the job with the specified ID,
+// replacing the queue and type thresholds. This is useful to collect
+// debugging output for a single problematic job.
+func (q *LoggingQueue) SetJobLevel(id string, threshold level.Priority) error {
+	return q.setLevel(q.jobs, id, threshold)
+}
+
+func (q *LoggingQueue) setLevel(levels map[string]level.Priority, key string, threshold level.Priority) error {
+	if !level.IsValidPriority(threshold) {
+		return errors.Errorf("%d is not a valid log level", threshold)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	levels[key] = threshold
+	return nil
+}
+
+// Threshold returns the logging threshold for the job.
+func (q *LoggingQueue) Threshold(j amboy.Job) level.Priority {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if p, ok := q.jobs[j.ID()]; ok {
+		return p
+	}
+	if p, ok := q.types[j.Type().Name]; ok {
+		return p
+	}
+
+	return q.defLevel
+}
+
+// JobLogger returns the logger that the job receives when it runs.
+func (q *LoggingQueue) JobLogger(j amboy.Job) grip.Journaler {
+	return logging.MakeGrip(&jobSender{
+		Sender:    q.sender,
+		threshold: q.Threshold(j),
+		id:        j.ID(),
+		jobType:   j.Type().Name,
+	})
+}
+
+// Next returns the next job from the wrapped queue, wrapped so that
+// it runs with its logger.
+func (q *LoggingQueue) Next(ctx context.Context) amboy.Job {
+	j := q.Queue.Next(ctx)
+	if j == nil {
+		return nil
+	}
+
+	return &loggedJob{Job: j, logger: q.JobLogger(j)}
+}
+
+// Save saves the job in the wrapped queue.
+func (q *LoggingQueue) Save(ctx context.Context, j amboy.Job) error {
+	return q.Queue.Save(ctx, unwrapLogged(j))
+}
+
+// Complete marks the job complete in the wrapped queue.
+func (q *LoggingQueue) Complete(ctx context.Context, j amboy.Job) {
+	q.Queue.Complete(ctx, unwrapLogged(j))
+}
+
+// SetRunner sets the runner of the wrapped queue.
+func (q *LoggingQueue) SetRunner(r amboy.Runner) error { return setRunner(q.Queue, q, r) }
+
+// loggedJob adds the logger to the context passed to the job's Run
+// method. The queue unwraps jobs before storing them, so that
+// drivers only ever see the original job.
+type loggedJob struct {
+	amboy.Job
+	logger grip.Journaler
+}
+
+func (j *loggedJob) Run(ctx context.Context) { j.Job.Run(WithLogger(ctx, j.logger)) }
+
+func unwrapLogged(j amboy.Job) amboy.Job {
+	if lj, ok := j.(*loggedJob); ok {
+		return lj.Job
+	}
+
+	return j
+}
+
+// jobSender filters messages by the job's threshold and annotates
+// them with the job's ID and type before passing them to the
+// underlying sender.
+type jobSender struct {
+	send.Sender
+	threshold level.Priority
+	id        string
+	jobType   string
+}
+
+func (s *jobSender) Send(m message.Composer) {
+	if !m.Loggable() || m.Priority() < s.threshold {
+		return
+	}
+
+	// annotation only fails if the key exists, in which case
+	// the message's own value wins.
+	_ = m.Annotate("job", s.id)
+	_ = m.Annotate("job_type", s.jobType)
+
+	s.Sender.Send(m)
+}
+
+// Close is a noop: the underlying sender belongs to the queue, and
+// outlives the job.
+func (s *jobSender) Close() error { return nil }
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/grip/level"
+	"github.com/mongodb/grip/message"
+	"github.com/mongodb/grip/send"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type loggingJob struct {
+	*job.Base
+}
+
+func newLoggingJob(id string) *loggingJob {
+	j := &loggingJob{Base: &job.Base{JobType: amboy.JobType{Name: "logging-test"}}}
+	j.SetID(id)
+	j.SetDependency(nil)
+	return j
+}
+
+func (j *loggingJob) Run(ctx context.Context) {
+	defer j.MarkComplete()
+
+	logger := Logger(ctx)
+	logger.Debug(message.Fields{"message": "debug"})
+	logger.Info(message.Fields{"message": "info"})
+}
+
+func TestLoggingQueueAnnotatesAndFiltersMessages(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	sender, err := send.NewInMemorySender("test", send.LevelInfo{Default: level.Info, Threshold: level.Trace}, 100)
+	require.NoError(t, err)
+
+	_, err = NewLoggingQueue(queue.NewLocalLimitedSize(1, 16), sender, 0)
+	assert.Error(err)
+
+	q, err := NewLoggingQueue(queue.NewLocalLimitedSize(1, 16), sender, level.Info)
+	require.NoError(t, err)
+	require.NoError(t, q.SetJobLevel("verbose", level.Debug))
+	require.NoError(t, q.SetTypeLevel("quiet-type", level.Error))
+	assert.Error(q.SetJobLevel("verbose", 0))
+	require.NoError(t, q.Start(ctx))
+
+	for _, id := range []string{"normal", "verbose"} {
+		require.NoError(t, q.Put(ctx, newLoggingJob(id)))
+	}
+	require.True(t, amboy.WaitInterval(ctx, q, 10*time.Millisecond))
+
+	msgs := sender.(*send.InMemorySender).Get()
+	require.Len(t, msgs, 3)
+
+	counts := map[string]int{}
+	for _, m := range msgs {
+		fields := m.Raw().(message.Fields)
+		assert.Equal("logging-test", fields["job_type"])
+		counts[fields["job"].(string)]++
+	}
+	assert.Equal(map[string]int{"normal": 1, "verbose": 2}, counts)
+
+	// completed jobs are stored unwrapped
+	j, ok := q.Get(ctx, "normal")
+	require.True(t, ok)
+	assert.IsType(&loggingJob{}, j)
+	assert.True(j.Status().Completed)
+
+	assert.Equal(level.Error, q.Threshold(&loggingJob{Base: &job.Base{JobType: amboy.JobType{Name: "quiet-type"}}}))
+}
+
+func TestLoggerWithoutQueue(t *testing.T) {
+	assert.NotNil(t, Logger(context.Background()))
+}
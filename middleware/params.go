@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/pkg/errors"
+)
+
+// Parameterized is implemented by jobs whose parameters (e.g. output
+// paths) may contain expressions, which a ParamsQueue resolves when it
+// dispatches the job. Jobs call expand on each parameter that may
+// contain expressions, and replace the parameter with the result.
+type Parameterized interface {
+	ExpandParameters(expand func(string) (string, error)) error
+}
+
+// Expander resolves the expressions in job parameters. Expressions
+// are text/template actions, with the functions:
+//
+//	{{ date "2006-01-02" }}  the current UTC time, in a Go time layout
+//	{{ hostname }}           the worker's hostname
+//	{{ env "NAME" }}         an environment variable, which must be allowed
+//	{{ .ID }}, {{ .Type }}   the job's ID and type
+//
+// For example, "/cache/{{ date "2006/01/02" }}/{{ hostname }}" is a
+// directory for each day and worker. Expressions can only read these
+// values: the template functions that format or call arbitrary values
+// are not available, and reading an environment variable that the
+// expander does not allow is an error, so that jobs submitted to a
+// shared queue can't read the workers' secrets.
+type Expander struct {
+	// Env lists the environment variables that expressions may
+	// read.
+	Env []string
+	// Hostname is the worker's hostname, and defaults to the
+	// hostname of the host.
+	Hostname string
+	// Now returns the current time, and defaults to time.Now.
+	Now func() time.Time
+	// Lookup reads environment variables, and defaults to
+	// os.LookupEnv.
+	Lookup func(string) (string, bool)
+}
+
+// NewExpander returns an expander for the current host that allows
+// expressions to read the environment variables.
+func NewExpander(env ...string) *Expander { return &Expander{Env: env} }
+
+// expansionData are the values of a job that expressions read.
+type expansionData struct {
+	ID   string
+	Type string
+}
+
+// Expand resolves the expressions in the value for the job. Values
+// without expressions are returned unchanged.
+func (e *Expander) Expand(j amboy.Job, value string) (string, error) {
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+
+	tmpl, err := template.New("parameter").Funcs(e.funcs()).Parse(value)
+	if err != nil {
+		return "", errors.Wrapf(err, "problem parsing expression '%s'", value)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, expansionData{ID: j.ID(), Type: j.Type().Name}); err != nil {
+		return "", errors.Wrapf(err, "problem resolving expression '%s'", value)
+	}
+
+	return buf.String(), nil
+}
+
+func (e *Expander) funcs() template.FuncMap {
+	now := e.Now
+	if now == nil {
+		now = time.Now
+	}
+	lookup := e.Lookup
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+
+	funcs := template.FuncMap{
+		"date": func(layout string) string { return now().UTC().Format(layout) },
+		"hostname": func() (string, error) {
+			if e.Hostname != "" {
+				return e.Hostname, nil
+			}
+			return os.Hostname()
+		},
+		"env": func(name string) (string, error) {
+			for _, allowed := range e.Env {
+				if name == allowed {
+					value, _ := lookup(name)
+					return value, nil
+				}
+			}
+			return "", errors.Errorf("environment variable '%s' is not allowed", name)
+		},
+	}
+	for _, name := range []string{"call", "html", "js", "print", "printf", "println", "urlquery"} {
+		funcs[name] = disallowed(name)
+	}
+
+	return funcs
+}
+
+func disallowed(name string) func(...interface{}) (string, error) {
+	return func(...interface{}) (string, error) {
+		return "", errors.Errorf("function '%s' is not available in parameters", name)
+	}
+}
+
+// ParamsQueue wraps a queue and resolves the expressions in the
+// parameters of the jobs that it dispatches (see Parameterized), with
+// its expander, so that recurring jobs can vary their parameters
+// (e.g. write to a directory for the day) without changes to the
+// code that submits them. Parameters are resolved once, when the job
+// is dispatched, and stored with the job. A job whose parameters
+// can't be resolved does not run, and fails with the error. Other
+// jobs pass through unchanged.
+//
+// Resolving parameters changes the job, so wrap a SigningQueue in the
+// ParamsQueue, rather than the reverse, to verify signatures before
+// parameters are resolved.
+type ParamsQueue struct {
+	amboy.Queue
+
+	expander *Expander
+}
+
+// NewParamsQueue wraps a queue, which must not have started, to
+// resolve the parameters of jobs with the expander. Start the
+// returned queue rather than the wrapped queue.
+func NewParamsQueue(q amboy.Queue, e *Expander) (*ParamsQueue, error) {
+	if e == nil {
+		return nil, errors.New("must specify an expander")
+	}
+
+	pq := &ParamsQueue{Queue: q, expander: e}
+	if err := attach(q, pq); err != nil {
+		return nil, err
+	}
+
+	return pq, nil
+}
+
+// Next returns the next job from the wrapped queue, with its
+// parameters resolved.
+func (q *ParamsQueue) Next(ctx context.Context) amboy.Job {
+	j := q.Queue.Next(ctx)
+	if j == nil {
+		return nil
+	}
+
+	pj, ok := unwrap(j).(Parameterized)
+	if !ok {
+		return j
+	}
+
+	err := pj.ExpandParameters(func(value string) (string, error) { return q.expander.Expand(j, value) })
+	if err != nil {
+		return &unresolvedJob{Job: j, err: errors.Wrapf(err, "problem resolving parameters of job '%s'", j.ID())}
+	}
+
+	return j
+}
+
+// Save saves the job in the wrapped queue.
+func (q *ParamsQueue) Save(ctx context.Context, j amboy.Job) error {
+	return q.Queue.Save(ctx, unwrapUnresolved(j))
+}
+
+// Complete marks the job complete in the wrapped queue.
+func (q *ParamsQueue) Complete(ctx context.Context, j amboy.Job) {
+	q.Queue.Complete(ctx, unwrapUnresolved(j))
+}
+
+// SetRunner sets the runner of the wrapped queue.
+func (q *ParamsQueue) SetRunner(r amboy.Runner) error { return setRunner(q.Queue, q, r) }
+
+// unresolvedJob fails, without running, a job whose parameters the
+// queue could not resolve.
+type unresolvedJob struct {
+	amboy.Job
+	err error
+}
+
+func (j *unresolvedJob) Run(_ context.Context) {
+	stat := j.Status()
+	stat.Completed = true
+	stat.InProgress = false
+	j.SetStatus(stat)
+	j.AddError(j.err)
+}
+
+func unwrapUnresolved(j amboy.Job) amboy.Job {
+	if uj, ok := j.(*unresolvedJob); ok {
+		return uj.Job
+	}
+
+	return j
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type paramsTestJob struct {
+	*job.Base
+	Output string
+	Ran    string
+}
+
+func newParamsTestJob(id, output string) *paramsTestJob {
+	j := &paramsTestJob{Base: &job.Base{JobType: amboy.JobType{Name: "params-test"}}, Output: output}
+	j.SetID(id)
+	j.SetDependency(nil)
+	return j
+}
+
+func (j *paramsTestJob) ExpandParameters(expand func(string) (string, error)) error {
+	out, err := expand(j.Output)
+	if err != nil {
+		return err
+	}
+	j.Output = out
+	return nil
+}
+
+func (j *paramsTestJob) Run(ctx context.Context) {
+	defer j.MarkComplete()
+	j.Ran = j.Output
+}
+
+func testExpander() *Expander {
+	return &Expander{
+		Env:      []string{"BUILD_ID"},
+		Hostname: "worker-1",
+		Now:      func() time.Time { return time.Date(2026, 10, 14, 23, 30, 0, 0, time.FixedZone("x", -3600)) },
+		Lookup: func(name string) (string, bool) {
+			value, ok := map[string]string{"BUILD_ID": "42", "SECRET": "hunter2"}[name]
+			return value, ok
+		},
+	}
+}
+
+func TestExpanderExpand(t *testing.T) {
+	assert := assert.New(t)
+	e := testExpander()
+	j := newParamsTestJob("nightly", "")
+
+	for value, expected := range map[string]string{
+		"/cache/plain":                                    "/cache/plain",
+		`/cache/{{ date "2006-01-02" }}`:                  "/cache/2026-10-15",
+		"/cache/{{ hostname }}/{{ .ID }}":                 "/cache/worker-1/nightly",
+		`/cache/{{ env "BUILD_ID" }}/{{ .Type }}`:         "/cache/42/params-test",
+		`{{ if env "BUILD_ID" }}ci{{ else }}dev{{ end }}`: "ci",
+	} {
+		out, err := e.Expand(j, value)
+		require.NoError(t, err, value)
+		assert.Equal(expected, out, value)
+	}
+
+	for _, value := range []string{
+		`{{ env "SECRET" }}`,
+		`{{ printf "%999999999s" "x" }}`,
+		"{{ exec }}",
+		"{{ .Missing }}",
+		"{{ unterminated",
+	} {
+		_, err := e.Expand(j, value)
+		assert.Error(err, value)
+	}
+}
+
+func TestParamsQueueResolvesAtDispatch(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := NewParamsQueue(queue.NewLocalLimitedSize(1, 8), nil)
+	assert.Error(err)
+
+	q, err := NewParamsQueue(queue.NewLocalLimitedSize(2, 16), testExpander())
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	resolved := newParamsTestJob("resolved", `/cache/{{ date "2006/01/02" }}/{{ hostname }}`)
+	forbidden := newParamsTestJob("forbidden", `/cache/{{ env "SECRET" }}`)
+	plain := job.NewShellJob("true", "")
+	require.NoError(t, q.Put(ctx, resolved))
+	require.NoError(t, q.Put(ctx, forbidden))
+	require.NoError(t, q.Put(ctx, plain))
+	require.True(t, amboy.WaitInterval(ctx, q, 10*time.Millisecond))
+
+	assert.NoError(resolved.Error())
+	assert.Equal("/cache/2026/10/15/worker-1", resolved.Ran)
+	assert.Equal("/cache/2026/10/15/worker-1", resolved.Output)
+
+	assert.Equal("", forbidden.Ran)
+	assert.True(forbidden.Status().Completed)
+	require.Error(t, forbidden.Error())
+	assert.Contains(forbidden.Error().Error(), "not allowed")
+
+	assert.NoError(plain.Error())
+
+	out, ok := q.Get(ctx, "forbidden")
+	require.True(t, ok)
+	assert.IsType(&paramsTestJob{}, out)
+}
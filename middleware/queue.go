@@ -0,0 +1,64 @@
+/*
+Package middleware provides amboy.Queue implementations that wrap
+other queues to add behavior at the points where jobs are submitted,
+dispatched to workers, and completed, without requiring changes to
+the job implementations or the underlying queue.
+
+Wrappers must be constructed before the underlying queue is started:
+the wrapper takes the place of the queue in the queue's runner, so
+that the workers see the wrapper's Next and Complete methods.
+Setting a runner on a wrapper likewise sets it on the underlying
+queue and attaches it to the wrapper.
+*/
+package middleware
+
+import (
+	"github.com/mongodb/amboy"
+	"github.com/pkg/errors"
+)
+
+// attach points the runner of the wrapped queue at the wrapper, so
+// that workers dispatch and complete jobs through the wrapper.
+func attach(wrapped, wrapper amboy.Queue) error {
+	if wrapped == nil {
+		return errors.New("cannot wrap a nil queue")
+	}
+
+	if wrapped.Started() {
+		return errors.New("cannot wrap a running queue")
+	}
+
+	if r := wrapped.Runner(); r != nil {
+		return errors.Wrap(r.SetQueue(wrapper), "problem attaching runner to wrapper")
+	}
+
+	return nil
+}
+
+// setRunner sets the runner on the wrapped queue and points the
+// runner at the wrapper.
+func setRunner(wrapped, wrapper amboy.Queue, r amboy.Runner) error {
+	if err := wrapped.SetRunner(r); err != nil {
+		return err
+	}
+
+	return errors.Wrap(r.SetQueue(wrapper), "problem attaching runner to wrapper")
+}
+
+// Unwrap returns the job within the wrappers that middleware
+// dispatches jobs in, so that hooks can check the interfaces that the
+// job implements.
+func Unwrap(j amboy.Job) amboy.Job { return unwrap(j) }
+
+// unwrap returns the job within the wrappers that middleware
+// dispatches jobs in, for checking the interfaces that the job
+// implements.
+func unwrap(j amboy.Job) amboy.Job {
+	for {
+		inner := unwrapLocking(unwrapGrouped(unwrapArtifact(unwrapTraced(unwrapSandboxed(unwrapLogged(unwrapVerified(unwrapUnresolved(j))))))))
+		if inner == j {
+			return j
+		}
+		j = inner
+	}
+}
@@ -0,0 +1,303 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// ErrQuotaExceeded is returned by a QuotaQueue for jobs whose tag has
+// reached its limit of pending jobs.
+var ErrQuotaExceeded = errors.New("tag quota exceeded")
+
+// Tagged is implemented by jobs that carry a tag, set by the
+// submitter, that identifies the tenant or submitter that the job
+// counts against in a QuotaQueue.
+type Tagged interface {
+	Tag() string
+	SetTag(string)
+}
+
+// Quota limits the jobs of a tag. Zero values are not limited.
+type Quota struct {
+	// MaxPending is the most jobs of the tag that may be waiting
+	// to run, including jobs held because the tag is at its
+	// MaxRunning limit.
+	MaxPending int `bson:"max_pending" json:"max_pending" yaml:"max_pending"`
+	// MaxRunning is the most jobs of the tag that may run at the
+	// same time.
+	MaxRunning int `bson:"max_running" json:"max_running" yaml:"max_running"`
+}
+
+// Validate returns an error if the limits are negative.
+func (q Quota) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(q.MaxPending < 0, "max pending must be 0 or positive")
+	catcher.NewWhen(q.MaxRunning < 0, "max running must be 0 or positive")
+	return catcher.Resolve()
+}
+
+// ParseQuota parses the quota of a tag, in the form
+// tag=pending:running (e.g. "ci=100:4"), where either limit may be
+// empty or 0 to leave it unlimited (e.g. "ci=:4").
+func ParseQuota(val string) (string, Quota, error) {
+	parts := strings.SplitN(val, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+		return "", Quota{}, errors.Errorf("'%s' is not in the form tag=pending:running", val)
+	}
+
+	limits := strings.SplitN(parts[1], ":", 2)
+	if len(limits) != 2 {
+		return "", Quota{}, errors.Errorf("'%s' is not in the form tag=pending:running", val)
+	}
+
+	out := Quota{}
+	for idx, dest := range []*int{&out.MaxPending, &out.MaxRunning} {
+		limit := strings.TrimSpace(limits[idx])
+		if limit == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return "", Quota{}, errors.Wrapf(err, "'%s' is not a valid quota", val)
+		}
+		*dest = n
+	}
+
+	if err := out.Validate(); err != nil {
+		return "", Quota{}, errors.Wrapf(err, "'%s' is not a valid quota", val)
+	}
+
+	return strings.TrimSpace(parts[0]), out, nil
+}
+
+// QuotaQueue wraps a queue and enforces per-tag quotas, so that one
+// submitter flooding a shared queue cannot starve the others. Put
+// rejects jobs whose tag has MaxPending jobs waiting with
+// ErrQuotaExceeded, and Next holds jobs whose tag has MaxRunning jobs
+// running, dispatching other jobs in their place, until one of the
+// tag's jobs completes. Jobs without a tag, or whose tag has no
+// quota, are not limited.
+//
+// Quotas count the jobs that pass through the wrapper, so that
+// processes sharing a queue's storage each enforce their quotas on
+// the jobs they submit and run.
+type QuotaQueue struct {
+	amboy.Queue
+
+	quotas  map[string]Quota
+	mu      sync.Mutex
+	pending map[string]map[string]struct{}
+	running map[string]map[string]struct{}
+	held    []amboy.Job
+	// freed is closed, and replaced, when a job with a quota
+	// completes, to wake the workers waiting on the wrapped queue
+	// so that they check for held jobs.
+	freed chan struct{}
+}
+
+// NewQuotaQueue wraps a queue, which must not have started, with the
+// quotas of each tag. Start the returned queue rather than the
+// wrapped queue.
+func NewQuotaQueue(q amboy.Queue, quotas map[string]Quota) (*QuotaQueue, error) {
+	catcher := grip.NewBasicCatcher()
+	for tag, quota := range quotas {
+		catcher.Wrapf(quota.Validate(), "invalid quota for tag '%s'", tag)
+	}
+	if catcher.HasErrors() {
+		return nil, catcher.Resolve()
+	}
+
+	qq := &QuotaQueue{
+		Queue:   q,
+		quotas:  make(map[string]Quota, len(quotas)),
+		pending: map[string]map[string]struct{}{},
+		running: map[string]map[string]struct{}{},
+		freed:   make(chan struct{}),
+	}
+	for tag, quota := range quotas {
+		qq.quotas[tag] = quota
+	}
+
+	if err := attach(q, qq); err != nil {
+		return nil, err
+	}
+
+	return qq, nil
+}
+
+// Quota returns the quota of the tag, and whether it has one.
+func (q *QuotaQueue) Quota(tag string) (Quota, bool) {
+	quota, ok := q.quotas[tag]
+	return quota, ok
+}
+
+// Usage returns the number of the tag's jobs that are pending and
+// running.
+func (q *QuotaQueue) Usage(tag string) (pending, running int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.pending[tag]), len(q.running[tag])
+}
+
+// Put adds the job to the wrapped queue, unless its tag has reached
+// its limit of pending jobs.
+func (q *QuotaQueue) Put(ctx context.Context, j amboy.Job) error {
+	tag, quota, ok := q.quotaOf(j)
+	if !ok {
+		return q.Queue.Put(ctx, j)
+	}
+
+	// hold the lock across the wrapped Put, so that concurrent
+	// submitters cannot exceed the limit together.
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if quota.MaxPending > 0 && len(q.pending[tag]) >= quota.MaxPending {
+		return errors.Wrapf(ErrQuotaExceeded, "tag '%s' has %d pending jobs, cannot add job '%s'",
+			tag, len(q.pending[tag]), j.ID())
+	}
+
+	if err := q.Queue.Put(ctx, j); err != nil {
+		return err
+	}
+
+	track(q.pending, tag, j.ID())
+	return nil
+}
+
+// Next returns the next job that its tag's quota allows to run. Jobs
+// that the wrapped queue dispatches while their tag is at its limit
+// are held, and returned by later calls once the tag has room.
+func (q *QuotaQueue) Next(ctx context.Context) amboy.Job {
+	for {
+		if j := q.release(); j != nil {
+			return j
+		}
+
+		j := q.next(ctx)
+		if j == nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			continue
+		}
+
+		if q.admit(j) {
+			return j
+		}
+	}
+}
+
+// Complete marks the job complete in the wrapped queue, and frees
+// its place in its tag's quota.
+func (q *QuotaQueue) Complete(ctx context.Context, j amboy.Job) {
+	q.Queue.Complete(ctx, j)
+
+	if tag, _, ok := q.quotaOf(j); ok {
+		q.mu.Lock()
+		untrack(q.running, tag, j.ID())
+		close(q.freed)
+		q.freed = make(chan struct{})
+		q.mu.Unlock()
+	}
+}
+
+// SetRunner sets the runner of the wrapped queue.
+func (q *QuotaQueue) SetRunner(r amboy.Runner) error { return setRunner(q.Queue, q, r) }
+
+// next returns the next job from the wrapped queue, or nil if a job
+// with a quota completes first.
+func (q *QuotaQueue) next(ctx context.Context) amboy.Job {
+	q.mu.Lock()
+	freed := q.freed
+	q.mu.Unlock()
+
+	nctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-freed:
+			cancel()
+		case <-nctx.Done():
+		}
+	}()
+
+	return q.Queue.Next(nctx)
+}
+
+// admit marks the job running, if its tag has room, and otherwise
+// holds it.
+func (q *QuotaQueue) admit(j amboy.Job) bool {
+	tag, quota, ok := q.quotaOf(j)
+	if !ok {
+		return true
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if quota.MaxRunning > 0 && len(q.running[tag]) >= quota.MaxRunning {
+		q.held = append(q.held, j)
+		return false
+	}
+
+	untrack(q.pending, tag, j.ID())
+	track(q.running, tag, j.ID())
+	return true
+}
+
+// release returns the first held job whose tag has room to run, if
+// any, and marks it running.
+func (q *QuotaQueue) release() amboy.Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for idx, j := range q.held {
+		tag, quota, _ := q.quotaOf(j)
+		if len(q.running[tag]) >= quota.MaxRunning {
+			continue
+		}
+
+		q.held = append(q.held[:idx], q.held[idx+1:]...)
+		untrack(q.pending, tag, j.ID())
+		track(q.running, tag, j.ID())
+		return j
+	}
+
+	return nil
+}
+
+// quotaOf returns the tag and quota of the job, if the job has a tag
+// with a quota.
+func (q *QuotaQueue) quotaOf(j amboy.Job) (string, Quota, bool) {
+	tj, ok := j.(Tagged)
+	if !ok {
+		return "", Quota{}, false
+	}
+
+	tag := tj.Tag()
+	quota, ok := q.quotas[tag]
+	return tag, quota, ok
+}
+
+func track(jobs map[string]map[string]struct{}, tag, id string) {
+	if jobs[tag] == nil {
+		jobs[tag] = map[string]struct{}{}
+	}
+	jobs[tag][id] = struct{}{}
+}
+
+func untrack(jobs map[string]map[string]struct{}, tag, id string) {
+	delete(jobs[tag], id)
+	if len(jobs[tag]) == 0 {
+		delete(jobs, tag)
+	}
+}
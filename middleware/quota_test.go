@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type concurrencyTracker struct {
+	mu      sync.Mutex
+	running map[string]int
+	max     map[string]int
+}
+
+func (c *concurrencyTracker) enter(tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running[tag]++
+	if c.running[tag] > c.max[tag] {
+		c.max[tag] = c.running[tag]
+	}
+}
+
+func (c *concurrencyTracker) exit(tag string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running[tag]--
+}
+
+func (c *concurrencyTracker) getMax(tag string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.max[tag]
+}
+
+type quotaJob struct {
+	*job.Base
+	tag     string
+	tracker *concurrencyTracker
+	started chan struct{}
+	block   chan struct{}
+}
+
+func newQuotaJob(id, tag string, tracker *concurrencyTracker) *quotaJob {
+	j := &quotaJob{Base: &job.Base{JobType: amboy.JobType{Name: "quota-test"}}, tag: tag, tracker: tracker}
+	j.SetID(id)
+	j.SetDependency(nil)
+	return j
+}
+
+func (j *quotaJob) Tag() string       { return j.tag }
+func (j *quotaJob) SetTag(tag string) { j.tag = tag }
+
+func (j *quotaJob) Run(ctx context.Context) {
+	defer j.MarkComplete()
+
+	if j.block != nil {
+		close(j.started)
+		<-j.block
+	}
+	if j.tracker != nil {
+		j.tracker.enter(j.tag)
+		defer j.tracker.exit(j.tag)
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestQuotaValidate(t *testing.T) {
+	assert.NoError(t, Quota{}.Validate())
+	assert.NoError(t, Quota{MaxPending: 1, MaxRunning: 1}.Validate())
+	assert.Error(t, Quota{MaxPending: -1}.Validate())
+	assert.Error(t, Quota{MaxRunning: -1}.Validate())
+
+	_, err := NewQuotaQueue(queue.NewLocalLimitedSize(1, 16), map[string]Quota{"a": {MaxRunning: -1}})
+	assert.Error(t, err)
+	_, err = NewQuotaQueue(nil, nil)
+	assert.Error(t, err)
+}
+
+func TestParseQuota(t *testing.T) {
+	assert := assert.New(t)
+
+	for val, expected := range map[string]Quota{
+		"ci=100:4":  {MaxPending: 100, MaxRunning: 4},
+		"ci=:4":     {MaxRunning: 4},
+		"ci=10:":    {MaxPending: 10},
+		" ci = 0:0": {},
+	} {
+		tag, quota, err := ParseQuota(val)
+		require.NoError(t, err, val)
+		assert.Equal("ci", tag)
+		assert.Equal(expected, quota, val)
+	}
+
+	for _, val := range []string{"", "ci", "ci=4", "=1:1", "ci=a:1", "ci=-1:1"} {
+		_, _, err := ParseQuota(val)
+		assert.Error(err, val)
+	}
+}
+
+func TestQuotaQueueLimitsPendingJobs(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q, err := NewQuotaQueue(queue.NewLocalLimitedSize(1, 64), map[string]Quota{"flood": {MaxPending: 2}})
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	// occupy the only worker, so that the other jobs stay pending
+	blocker := newQuotaJob("blocker", "", nil)
+	blocker.started, blocker.block = make(chan struct{}), make(chan struct{})
+	require.NoError(t, q.Put(ctx, blocker))
+	<-blocker.started
+
+	require.NoError(t, q.Put(ctx, newQuotaJob("flood-0", "flood", nil)))
+	require.NoError(t, q.Put(ctx, newQuotaJob("flood-1", "flood", nil)))
+	err = q.Put(ctx, newQuotaJob("flood-2", "flood", nil))
+	require.Error(t, err)
+	assert.Equal(ErrQuotaExceeded, errors.Cause(err))
+
+	// a rejected duplicate does not count against the quota
+	assert.Error(q.Put(ctx, newQuotaJob("flood-0", "flood", nil)))
+	pending, running := q.Usage("flood")
+	assert.Equal(2, pending)
+	assert.Equal(0, running)
+
+	// other tags, and jobs without tags, are not limited
+	for i := 0; i < 5; i++ {
+		require.NoError(t, q.Put(ctx, newQuotaJob(fmt.Sprintf("other-%d", i), "other", nil)))
+		require.NoError(t, q.Put(ctx, newLoggingJob(fmt.Sprintf("untagged-%d", i))))
+	}
+	_, ok := q.Quota("other")
+	assert.False(ok)
+
+	// dispatched jobs no longer count as pending
+	close(blocker.block)
+	require.True(t, amboy.WaitInterval(ctx, q, 10*time.Millisecond))
+	assert.NoError(q.Put(ctx, newQuotaJob("flood-2", "flood", nil)))
+}
+
+func TestQuotaQueueLimitsRunningJobs(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q, err := NewQuotaQueue(queue.NewLocalLimitedSize(4, 64), map[string]Quota{"flood": {MaxRunning: 1}})
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	tracker := &concurrencyTracker{running: map[string]int{}, max: map[string]int{}}
+	for i := 0; i < 6; i++ {
+		require.NoError(t, q.Put(ctx, newQuotaJob(fmt.Sprintf("flood-%d", i), "flood", tracker)))
+	}
+	for i := 0; i < 4; i++ {
+		require.NoError(t, q.Put(ctx, newQuotaJob(fmt.Sprintf("other-%d", i), "other", tracker)))
+	}
+
+	require.True(t, amboy.WaitInterval(ctx, q, 10*time.Millisecond))
+	assert.Equal(1, tracker.getMax("flood"))
+	assert.True(tracker.getMax("other") > 1)
+
+	pending, running := q.Usage("flood")
+	assert.Equal(0, pending)
+	assert.Equal(0, running)
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/mongodb/amboy"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/driver"
+)
+
+// ReadOnlyQueue wraps a queue so that Get, Results, Stats and
+// JobStats pass through to the wrapped queue, but operations that
+// add, dispatch, or modify jobs fail (or, for Next and Complete, do
+// nothing). Operations return driver.ErrReadOnly.
+//
+// A ReadOnlyQueue cannot be started: wrap a queue that is running
+// elsewhere in the process, or, to attach to a remote queue's
+// storage, use a remote queue with a driver.ReadOnly driver.
+type ReadOnlyQueue struct {
+	amboy.Queue
+}
+
+// NewReadOnlyQueue wraps the queue.
+func NewReadOnlyQueue(q amboy.Queue) *ReadOnlyQueue { return &ReadOnlyQueue{Queue: q} }
+
+// Put returns driver.ErrReadOnly.
+func (q *ReadOnlyQueue) Put(_ context.Context, j amboy.Job) error {
+	return errors.Wrapf(driver.ErrReadOnly, "cannot add job '%s'", j.ID())
+}
+
+// Save returns driver.ErrReadOnly.
+func (q *ReadOnlyQueue) Save(_ context.Context, j amboy.Job) error {
+	return errors.Wrapf(driver.ErrReadOnly, "cannot save job '%s'", j.ID())
+}
+
+// Next blocks until the context is canceled, and returns nil.
+func (q *ReadOnlyQueue) Next(ctx context.Context) amboy.Job {
+	<-ctx.Done()
+	return nil
+}
+
+// Complete is a noop.
+func (q *ReadOnlyQueue) Complete(context.Context, amboy.Job) {}
+
+// SetRunner returns driver.ErrReadOnly.
+func (q *ReadOnlyQueue) SetRunner(amboy.Runner) error {
+	return errors.Wrap(driver.ErrReadOnly, "cannot set runner")
+}
+
+// Start returns driver.ErrReadOnly.
+func (q *ReadOnlyQueue) Start(context.Context) error {
+	return errors.Wrap(driver.ErrReadOnly, "cannot start queue")
+}
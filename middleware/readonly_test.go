@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/driver"
+)
+
+func TestReadOnlyQueue(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	base := queue.NewLocalLimitedSize(1, 16)
+	require.NoError(t, base.Start(ctx))
+	j := job.NewShellJob("true", "")
+	require.NoError(t, base.Put(ctx, j))
+
+	q := NewReadOnlyQueue(base)
+	_, ok := q.Get(ctx, j.ID())
+	assert.True(ok)
+	assert.Equal(1, q.Stats(ctx).Total)
+
+	assert.Equal(driver.ErrReadOnly, errors.Cause(q.Put(ctx, job.NewShellJob("true", ""))))
+	assert.Equal(driver.ErrReadOnly, errors.Cause(q.Save(ctx, j)))
+	assert.Equal(driver.ErrReadOnly, errors.Cause(q.Start(ctx)))
+	assert.Equal(driver.ErrReadOnly, errors.Cause(q.SetRunner(nil)))
+	q.Complete(ctx, j)
+
+	short, cancelShort := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancelShort()
+	assert.Nil(q.Next(short))
+}
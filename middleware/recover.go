@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/management"
+)
+
+// RecoveringQueue wraps a remote queue and, when it starts, recovers
+// the jobs that previous runs of the queue left locked when they
+// crashed (see management.Manager.Recover), before the queue
+// dispatches any jobs, so that restarts don't leave jobs that appear
+// to be running until their locks time out.
+//
+// Problems recovering jobs are logged, and do not prevent the queue
+// from starting. Drivers that only save jobs whose locks they hold or
+// whose locks have timed out, like amboy's MongoDB drivers, reject
+// the changes to the recovered jobs unless they implement
+// management.Reclaimer.
+//
+// Like the DefaultsQueue, the RecoveringQueue does not change how
+// jobs are dispatched.
+type RecoveringQueue struct {
+	queue.Remote
+
+	policy    management.RecoveryPolicy
+	audit     management.AuditLog
+	actor     string
+	recovered []string
+}
+
+// NewRecoveringQueue wraps the queue, which must have a driver,
+// recovering jobs according to the policy.
+func NewRecoveringQueue(q queue.Remote, p management.RecoveryPolicy) (*RecoveringQueue, error) {
+	if q == nil {
+		return nil, errors.New("cannot wrap a nil queue")
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid recovery policy")
+	}
+
+	return &RecoveringQueue{Remote: q, policy: p}, nil
+}
+
+// SetAuditLog records the recovered jobs in the log, with the actor,
+// rather than in the driver's audit log.
+func (q *RecoveringQueue) SetAuditLog(log management.AuditLog, actor string) {
+	q.audit, q.actor = log, actor
+}
+
+// Recovered returns the IDs of the jobs that the queue recovered when
+// it started.
+func (q *RecoveringQueue) Recovered() []string { return q.recovered }
+
+// Start recovers the jobs of previous runs, and then starts the
+// wrapped queue. Starting a queue that has started does not recover
+// jobs again.
+func (q *RecoveringQueue) Start(ctx context.Context) error {
+	if q.Started() {
+		return nil
+	}
+
+	d := q.Driver()
+	if d == nil {
+		return errors.New("cannot start queue with an uninitialized driver")
+	}
+
+	m := management.New(d)
+	if q.audit != nil {
+		m.SetAuditLog(q.audit, q.actor)
+	}
+
+	ids, err := m.Recover(ctx, d.ID(), q.policy)
+	q.recovered = ids
+	grip.Warning(message.WrapError(err, message.Fields{
+		"message":   "problem recovering jobs from a previous run",
+		"queue":     d.ID(),
+		"recovered": len(ids),
+	}))
+	grip.InfoWhen(len(ids) > 0, message.Fields{
+		"message":   "recovered jobs from a previous run",
+		"queue":     d.ID(),
+		"recovered": ids,
+	})
+
+	return q.Remote.Start(ctx)
+}
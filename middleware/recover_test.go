@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/driver"
+	"github.com/tychoish/bond/driver/drivertest"
+	"github.com/tychoish/bond/management"
+)
+
+func TestRecoveringQueueRecoversJobsOnStart(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	d := drivertest.New("downloads.host-a.run-2")
+	require.NoError(t, d.Open(ctx))
+	for id, owner := range map[string]string{"crashed": "downloads.host-a.run-1", "elsewhere": "downloads.host-b.run-1"} {
+		j := job.NewShellJob("true", "")
+		j.SetID(id)
+		j.SetStatus(amboy.JobStatusInfo{InProgress: true, Owner: owner, ModificationTime: time.Now()})
+		require.NoError(t, d.Put(ctx, j))
+	}
+
+	rq := queue.NewRemoteUnordered(1)
+	require.NoError(t, rq.SetDriver(d))
+	q, err := NewRecoveringQueue(rq, management.RecoveryPolicy{})
+	require.NoError(t, err)
+	log := management.NewMemoryAuditLog()
+	q.SetAuditLog(log, "restart")
+	require.NoError(t, q.Start(ctx))
+	assert.Equal([]string{"crashed"}, q.Recovered())
+
+	// the recovered job runs again, and the other host's job waits
+	// for its lock
+	j, err := d.Get(ctx, "crashed")
+	require.NoError(t, err)
+	assert.True(amboy.WaitJobInterval(ctx, j, q, 10*time.Millisecond))
+	j, err = d.Get(ctx, "elsewhere")
+	require.NoError(t, err)
+	assert.True(j.Status().InProgress)
+	assert.False(j.Status().Completed)
+
+	entries, err := log.Entries(ctx, management.AuditQuery{Action: management.ActionRecover})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal("crashed", entries[0].JobID)
+	assert.Equal("restart", entries[0].Actor)
+
+	// restarting a started queue does not recover jobs again
+	require.NoError(t, q.Start(ctx))
+	assert.Equal([]string{"crashed"}, q.Recovered())
+
+	_, err = NewRecoveringQueue(nil, management.RecoveryPolicy{})
+	assert.Error(err)
+	_, err = NewRecoveringQueue(rq, management.RecoveryPolicy{Default: "restart"})
+	assert.Error(err)
+}
+
+func TestRecoveringQueueReclaimsJobsFromLockingDrivers(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	d := drivertest.New("downloads.host-a.run-2")
+	d.EnforceLocks()
+	require.NoError(t, d.Open(ctx))
+	for _, id := range []string{"first", "second"} {
+		j := job.NewShellJob("true", "")
+		j.SetID(id)
+		j.SetStatus(amboy.JobStatusInfo{InProgress: true, Owner: "downloads.host-a.run-1", ModificationTime: time.Now()})
+		require.NoError(t, d.Put(ctx, j))
+	}
+
+	// the driver rejects saves of jobs that the crashed run locked
+	j, err := d.Get(ctx, "first")
+	require.NoError(t, err)
+	assert.Equal(driver.ErrFenced, errors.Cause(d.Save(ctx, j)))
+
+	rq := queue.NewRemoteUnordered(1)
+	require.NoError(t, rq.SetDriver(d))
+	q, err := NewRecoveringQueue(rq, management.RecoveryPolicy{})
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+	assert.Len(q.Recovered(), 2)
+
+	for _, id := range []string{"first", "second"} {
+		j, err := d.Get(ctx, id)
+		require.NoError(t, err)
+		assert.True(amboy.WaitJobInterval(ctx, j, q, 10*time.Millisecond), id)
+		assert.True(j.Status().Completed, id)
+	}
+}
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+type sandboxCtxKey struct{}
+
+// WithSandbox returns a context that carries the path of a job's
+// sandbox directory, for use by jobs during Run.
+func WithSandbox(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, sandboxCtxKey{}, dir)
+}
+
+// Sandbox returns the path of the sandbox directory attached to the
+// context by a SandboxQueue, if any. Jobs should write temporary
+// files in the sandbox rather than in a shared temporary directory,
+// so that concurrent jobs cannot collide.
+func Sandbox(ctx context.Context) (string, bool) {
+	dir, ok := ctx.Value(sandboxCtxKey{}).(string)
+	return dir, ok && dir != ""
+}
+
+// SandboxQueue wraps a queue and runs every job that it dispatches
+// with a new, empty directory (see Sandbox), which is removed when
+// the job's Run method returns. Shell jobs without a working
+// directory run in their sandbox.
+//
+// A job whose sandbox cannot be created does not run, and fails with
+// the error. Problems removing sandboxes are logged.
+type SandboxQueue struct {
+	amboy.Queue
+
+	root string
+}
+
+// NewSandboxQueue wraps a queue, which must not have started, and
+// creates sandboxes in the root directory, which defaults to the
+// system's temporary directory. Start the returned queue rather than
+// the wrapped queue.
+func NewSandboxQueue(q amboy.Queue, root string) (*SandboxQueue, error) {
+	if root == "" {
+		root = os.TempDir()
+	}
+
+	sq := &SandboxQueue{Queue: q, root: root}
+	if err := attach(q, sq); err != nil {
+		return nil, err
+	}
+
+	return sq, nil
+}
+
+// Root returns the directory in which the queue creates sandboxes.
+func (q *SandboxQueue) Root() string { return q.root }
+
+// Next returns the next job from the wrapped queue, wrapped so that
+// it runs in a sandbox.
+func (q *SandboxQueue) Next(ctx context.Context) amboy.Job {
+	j := q.Queue.Next(ctx)
+	if j == nil {
+		return nil
+	}
+
+	return &sandboxedJob{Job: j, root: q.root}
+}
+
+// Save saves the job in the wrapped queue.
+func (q *SandboxQueue) Save(ctx context.Context, j amboy.Job) error {
+	return q.Queue.Save(ctx, unwrapSandboxed(j))
+}
+
+// Complete marks the job complete in the wrapped queue.
+func (q *SandboxQueue) Complete(ctx context.Context, j amboy.Job) {
+	q.Queue.Complete(ctx, unwrapSandboxed(j))
+}
+
+// SetRunner sets the runner of the wrapped queue.
+func (q *SandboxQueue) SetRunner(r amboy.Runner) error { return setRunner(q.Queue, q, r) }
+
+// sandboxedJob creates the sandbox before the job runs and removes it
+// afterwards. As with loggedJob, the queue unwraps jobs before
+// storing them.
+type sandboxedJob struct {
+	amboy.Job
+	root string
+}
+
+func (j *sandboxedJob) Run(ctx context.Context) {
+	dir, err := ioutil.TempDir(j.root, sandboxPrefix(j.Job))
+	if err != nil {
+		stat := j.Status()
+		stat.Completed = true
+		stat.InProgress = false
+		j.SetStatus(stat)
+		j.AddError(errors.Wrapf(err, "problem creating sandbox for job '%s'", j.ID()))
+		return
+	}
+	defer func() {
+		grip.Warning(message.WrapError(os.RemoveAll(dir), message.Fields{
+			"message": "problem removing job sandbox",
+			"job":     j.ID(),
+			"sandbox": dir,
+		}))
+	}()
+
+	// shell jobs are stored with their working directory, so only
+	// use the sandbox for the run.
+	if sj, ok := unwrapGrouped(unwrapLogged(unwrapVerified(j.Job))).(*job.ShellJob); ok && sj.WorkingDir == "" {
+		sj.WorkingDir = dir
+		defer func() { sj.WorkingDir = "" }()
+	}
+
+	j.Job.Run(WithSandbox(ctx, dir))
+}
+
+// sandboxPrefix names sandboxes after their jobs, to make leftover
+// sandboxes (e.g. from crashed processes) easy to attribute.
+func sandboxPrefix(j amboy.Job) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		default:
+			return '-'
+		}
+	}, j.Type().Name)
+
+	return "bond-" + name + "."
+}
+
+func unwrapSandboxed(j amboy.Job) amboy.Job {
+	if sj, ok := j.(*sandboxedJob); ok {
+		return sj.Job
+	}
+
+	return j
+}
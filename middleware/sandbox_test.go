@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/jobs"
+)
+
+type sandboxJob struct {
+	*job.Base
+	Sandbox string
+}
+
+func newSandboxJob(id string) *sandboxJob {
+	j := &sandboxJob{Base: &job.Base{JobType: amboy.JobType{Name: "sandbox-test"}}}
+	j.SetID(id)
+	j.SetDependency(nil)
+	return j
+}
+
+func (j *sandboxJob) Run(ctx context.Context) {
+	defer j.MarkComplete()
+
+	dir, ok := Sandbox(ctx)
+	if !ok {
+		return
+	}
+	j.Sandbox = dir
+	j.AddError(ioutil.WriteFile(filepath.Join(dir, "scratch"), []byte(j.ID()), 0600))
+}
+
+func TestSandboxQueueRunsJobsInSeparateDirectories(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	root, err := ioutil.TempDir("", "bond-sandbox-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	q, err := NewSandboxQueue(queue.NewLocalLimitedSize(4, 16), root)
+	require.NoError(t, err)
+	assert.Equal(root, q.Root())
+	require.NoError(t, q.Start(ctx))
+
+	for _, id := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, q.Put(ctx, newSandboxJob(id)))
+	}
+	shell := job.NewShellJob("pwd", "")
+	shell.SetID("shell")
+	require.NoError(t, q.Put(ctx, shell))
+	require.True(t, amboy.WaitInterval(ctx, q, 10*time.Millisecond))
+
+	dirs := map[string]struct{}{}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		out, ok := q.Get(ctx, id)
+		require.True(t, ok)
+		require.IsType(t, &sandboxJob{}, out)
+		j := out.(*sandboxJob)
+		assert.NoError(j.Error())
+		assert.Equal(root, filepath.Dir(j.Sandbox))
+		assert.True(strings.HasPrefix(filepath.Base(j.Sandbox), "bond-sandbox-test."))
+		dirs[j.Sandbox] = struct{}{}
+	}
+	assert.Len(dirs, 4)
+
+	// shell jobs run in the sandbox, which isn't stored with the job
+	assert.NoError(shell.Error())
+	assert.Equal(root, filepath.Dir(strings.TrimSpace(shell.Output)))
+	assert.Equal("", shell.WorkingDir)
+
+	// sandboxes are removed after the jobs run
+	entries, err := ioutil.ReadDir(root)
+	require.NoError(t, err)
+	assert.Len(entries, 0)
+}
+
+func TestSandboxQueueFailsJobsWithoutSandboxes(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q, err := NewSandboxQueue(queue.NewLocalLimitedSize(1, 16), filepath.Join(os.TempDir(), "bond-missing", "sandboxes"))
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	out, err := jobs.RunJob(ctx, q, newSandboxJob("missing"))
+	assert.Error(err)
+	require.IsType(t, &sandboxJob{}, out)
+	j := out.(*sandboxJob)
+	assert.True(j.Status().Completed)
+	assert.Equal("", j.Sandbox)
+}
+
+func TestSandboxWithoutQueue(t *testing.T) {
+	_, ok := Sandbox(context.Background())
+	assert.False(t, ok)
+}
@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidSignature is the error of jobs that a SigningQueue does not
+// run, because they have no signature, or a signature that none of the
+// queue's keys produced.
+var ErrInvalidSignature = errors.New("invalid job signature")
+
+// Signed is implemented by jobs that carry a signature of their work.
+// SigningPayload returns the serialized parts of the job that the
+// signature covers: everything that determines what the job does
+// when it runs, and nothing that changes after submission (such as
+// its status or the records of other middleware).
+type Signed interface {
+	SigningPayload() ([]byte, error)
+	Signature() string
+	SetSignature(string)
+}
+
+// SigningQueue wraps a queue and signs the jobs submitted with Put,
+// with an HMAC-SHA256 of the job's ID, type, and payload (see
+// Signed), and verifies the signatures of the jobs that it dispatches
+// before they run. Jobs without a valid signature do not run, and
+// fail with ErrInvalidSignature, so that a producer that shares a
+// remote queue's storage without the key, whether compromised or
+// buggy, cannot have the queue's workers run arbitrary jobs, such as
+// shell commands, with the workers' privileges.
+//
+// Put rejects jobs that can't carry a signature. Every process that
+// submits to or runs the jobs of the queue must wrap it in a
+// SigningQueue with a shared key.
+type SigningQueue struct {
+	amboy.Queue
+
+	key  []byte
+	keys [][]byte
+}
+
+// NewSigningQueue wraps a queue, which must not have started, to sign
+// jobs with the key. Dispatched jobs are verified with the key and
+// any previous keys, so that keys can be rotated without failing the
+// jobs that were signed before the rotation. Start the returned queue
+// rather than the wrapped queue.
+func NewSigningQueue(q amboy.Queue, key []byte, previous ...[]byte) (*SigningQueue, error) {
+	if len(key) == 0 {
+		return nil, errors.New("must specify a signing key")
+	}
+
+	keys := [][]byte{key}
+	for _, k := range previous {
+		if len(k) == 0 {
+			return nil, errors.New("previous signing keys must not be empty")
+		}
+		keys = append(keys, k)
+	}
+
+	sq := &SigningQueue{Queue: q, key: key, keys: keys}
+	if err := attach(q, sq); err != nil {
+		return nil, err
+	}
+
+	return sq, nil
+}
+
+// Put signs the job and adds it to the wrapped queue.
+func (q *SigningQueue) Put(ctx context.Context, j amboy.Job) error {
+	sj, ok := j.(Signed)
+	if !ok {
+		return errors.Errorf("job '%s' of type '%s' cannot be signed", j.ID(), j.Type().Name)
+	}
+
+	sig, err := sign(q.key, sj, j)
+	if err != nil {
+		return errors.Wrapf(err, "problem signing job '%s'", j.ID())
+	}
+	sj.SetSignature(sig)
+
+	return q.Queue.Put(ctx, j)
+}
+
+// Next returns the next job from the wrapped queue, wrapped so that
+// it only runs if its signature is valid.
+func (q *SigningQueue) Next(ctx context.Context) amboy.Job {
+	j := q.Queue.Next(ctx)
+	if j == nil {
+		return nil
+	}
+
+	return &verifiedJob{Job: j, err: q.verify(j)}
+}
+
+// Save saves the job in the wrapped queue.
+func (q *SigningQueue) Save(ctx context.Context, j amboy.Job) error {
+	return q.Queue.Save(ctx, unwrapVerified(j))
+}
+
+// Complete marks the job complete in the wrapped queue.
+func (q *SigningQueue) Complete(ctx context.Context, j amboy.Job) {
+	q.Queue.Complete(ctx, unwrapVerified(j))
+}
+
+// SetRunner sets the runner of the wrapped queue.
+func (q *SigningQueue) SetRunner(r amboy.Runner) error { return setRunner(q.Queue, q, r) }
+
+// verify returns an error wrapping ErrInvalidSignature if the job's
+// signature was not produced by one of the queue's keys.
+func (q *SigningQueue) verify(j amboy.Job) error {
+	sj, ok := unwrap(j).(Signed)
+	if !ok {
+		return errors.Wrapf(ErrInvalidSignature, "job '%s' of type '%s' cannot be signed", j.ID(), j.Type().Name)
+	}
+
+	got, err := hex.DecodeString(sj.Signature())
+	if err != nil || len(got) == 0 {
+		return errors.Wrapf(ErrInvalidSignature, "job '%s' is not signed", j.ID())
+	}
+
+	for _, key := range q.keys {
+		want, err := mac(key, sj, j)
+		if err != nil {
+			return errors.Wrapf(err, "problem verifying job '%s'", j.ID())
+		}
+		if hmac.Equal(got, want) {
+			return nil
+		}
+	}
+
+	return errors.Wrapf(ErrInvalidSignature, "signature of job '%s' does not match", j.ID())
+}
+
+func sign(key []byte, sj Signed, j amboy.Job) (string, error) {
+	sum, err := mac(key, sj, j)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(sum), nil
+}
+
+// mac computes the HMAC of the job's ID, type, and payload, each
+// followed by a zero byte so that fields cannot run together.
+func mac(key []byte, sj Signed, j amboy.Job) ([]byte, error) {
+	payload, err := sj.SigningPayload()
+	if err != nil {
+		return nil, errors.Wrap(err, "problem serializing job payload")
+	}
+
+	h := hmac.New(sha256.New, key)
+	for _, field := range [][]byte{[]byte(j.ID()), []byte(j.Type().Name), payload} {
+		_, _ = h.Write(field)
+		_, _ = h.Write([]byte{0})
+	}
+
+	return h.Sum(nil), nil
+}
+
+// verifiedJob fails, without running, jobs whose signatures the queue
+// could not verify. As with loggedJob, the queue unwraps jobs before
+// storing them.
+type verifiedJob struct {
+	amboy.Job
+	err error
+}
+
+func (j *verifiedJob) Run(ctx context.Context) {
+	if j.err != nil {
+		grip.Warning(message.WrapError(j.err, message.Fields{
+			"message":  "refusing to run job without a valid signature",
+			"job":      j.ID(),
+			"job_type": j.Type().Name,
+		}))
+
+		stat := j.Status()
+		stat.Completed = true
+		stat.InProgress = false
+		j.SetStatus(stat)
+		j.AddError(j.err)
+		return
+	}
+
+	j.Job.Run(ctx)
+}
+
+func unwrapVerified(j amboy.Job) amboy.Job {
+	if vj, ok := j.(*verifiedJob); ok {
+		return vj.Job
+	}
+
+	return j
+}
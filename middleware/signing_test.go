@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type signedTestJob struct {
+	*job.Base
+	Command string
+	Sig     string
+	Ran     bool
+}
+
+func newSignedTestJob(id, command string) *signedTestJob {
+	j := &signedTestJob{Base: &job.Base{JobType: amboy.JobType{Name: "signed-test"}}, Command: command}
+	j.SetID(id)
+	j.SetDependency(nil)
+	return j
+}
+
+func (j *signedTestJob) SigningPayload() ([]byte, error) { return []byte(j.Command), nil }
+func (j *signedTestJob) Signature() string               { return j.Sig }
+func (j *signedTestJob) SetSignature(sig string)         { j.Sig = sig }
+
+func (j *signedTestJob) Run(ctx context.Context) {
+	defer j.MarkComplete()
+	j.Ran = true
+}
+
+func TestSigningQueueRequiresKey(t *testing.T) {
+	_, err := NewSigningQueue(queue.NewLocalLimitedSize(1, 8), nil)
+	assert.Error(t, err)
+	_, err = NewSigningQueue(queue.NewLocalLimitedSize(1, 8), []byte("key"), []byte{})
+	assert.Error(t, err)
+}
+
+func TestSigningQueueRunsOnlySignedJobs(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q, err := NewSigningQueue(queue.NewLocalLimitedSize(2, 16), []byte("current"), []byte("previous"))
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	// jobs that can't carry a signature are rejected at Put
+	assert.Error(q.Put(ctx, job.NewShellJob("true", "")))
+
+	signed := newSignedTestJob("signed", "download")
+	require.NoError(t, q.Put(ctx, signed))
+	assert.NotEqual("", signed.Signature())
+
+	// jobs signed with a previous key still run
+	rotated := newSignedTestJob("rotated", "download")
+	sig, err := sign([]byte("previous"), rotated, rotated)
+	require.NoError(t, err)
+	rotated.SetSignature(sig)
+	require.NoError(t, q.Queue.Put(ctx, rotated))
+
+	// a producer without the key writes to the queue's storage
+	unsigned := newSignedTestJob("unsigned", "rm -rf /")
+	require.NoError(t, q.Queue.Put(ctx, unsigned))
+
+	tampered := newSignedTestJob("tampered", "download")
+	sig, err = sign([]byte("current"), tampered, tampered)
+	require.NoError(t, err)
+	tampered.SetSignature(sig)
+	tampered.Command = "rm -rf /"
+	require.NoError(t, q.Queue.Put(ctx, tampered))
+
+	shell := job.NewShellJob("echo injected", "")
+	require.NoError(t, q.Queue.Put(ctx, shell))
+
+	require.True(t, amboy.WaitInterval(ctx, q, 10*time.Millisecond))
+
+	assert.True(signed.Ran)
+	assert.NoError(signed.Error())
+	assert.True(rotated.Ran)
+	assert.NoError(rotated.Error())
+
+	for _, j := range []*signedTestJob{unsigned, tampered} {
+		assert.False(j.Ran, j.ID())
+		assert.True(j.Status().Completed, j.ID())
+		require.Error(t, j.Error(), j.ID())
+		assert.Contains(j.Error().Error(), ErrInvalidSignature.Error(), j.ID())
+	}
+
+	assert.Equal("", shell.Output)
+	require.Error(t, shell.Error())
+	assert.Contains(shell.Error().Error(), ErrInvalidSignature.Error())
+
+	// stored jobs are not wrapped
+	out, ok := q.Get(ctx, "signed")
+	require.True(t, ok)
+	assert.IsType(&signedTestJob{}, out)
+}
@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/registry"
+	"github.com/pkg/errors"
+)
+
+// MaxMongoDBJobSize is the largest job that can be stored in a
+// single MongoDB document, less room for the driver's bookkeeping.
+const MaxMongoDBJobSize = 16*1024*1024 - 64*1024
+
+// ErrJobTooLarge is returned by a SizeLimitedQueue for jobs whose
+// serialized form exceeds the queue's limit.
+var ErrJobTooLarge = errors.New("job exceeds maximum size")
+
+// BlobStore holds data that is too large to store in a job, so that
+// jobs can store a key in place of the data.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// Spiller is implemented by jobs that can move large fields into a
+// BlobStore, replacing them with references, and that restore the
+// fields from the store when they run.
+type Spiller interface {
+	Spill(context.Context, BlobStore) error
+}
+
+// JobSize returns the size, in bytes, of the job serialized in the
+// specified format, along with the metadata that queues store with
+// it.
+func JobSize(j amboy.Job, f amboy.Format) (int, error) {
+	ji, err := registry.MakeJobInterchange(j, f)
+	if err != nil {
+		return 0, errors.Wrapf(err, "problem serializing job '%s'", j.ID())
+	}
+
+	size := len(ji.Raw())
+	ji.Job = nil
+	meta, err := json.Marshal(ji)
+	if err != nil {
+		return 0, errors.Wrapf(err, "problem serializing metadata for job '%s'", j.ID())
+	}
+
+	return size + len(meta), nil
+}
+
+// SizeLimitedQueue wraps a queue and rejects jobs at Put that are
+// larger than the limit when serialized, so that oversized jobs fail
+// with a clear error when they're submitted rather than from inside
+// the driver. If the queue has a BlobStore and an oversized job
+// implements Spiller, the queue spills the job's large fields into
+// the store and checks the size again before rejecting it.
+//
+// Like the DefaultsQueue, the SizeLimitedQueue only changes Put.
+type SizeLimitedQueue struct {
+	amboy.Queue
+
+	limit  int
+	format amboy.Format
+	store  BlobStore
+}
+
+// NewSizeLimitedQueue wraps the queue, limiting jobs to the size, in
+// bytes, when serialized in the format (which should match the
+// format of the queue's driver). The store is optional.
+func NewSizeLimitedQueue(q amboy.Queue, limit int, f amboy.Format, store BlobStore) (*SizeLimitedQueue, error) {
+	if q == nil {
+		return nil, errors.New("cannot wrap a nil queue")
+	}
+
+	if limit <= 0 {
+		return nil, errors.New("size limit must be positive")
+	}
+
+	if !f.IsValid() {
+		return nil, errors.Errorf("%s is not a valid format", f)
+	}
+
+	return &SizeLimitedQueue{Queue: q, limit: limit, format: f, store: store}, nil
+}
+
+// Limit returns the maximum size of jobs in the queue.
+func (q *SizeLimitedQueue) Limit() int { return q.limit }
+
+// Check returns an error if the job is too large for the queue,
+// spilling its fields into the blob store first if possible.
+func (q *SizeLimitedQueue) Check(ctx context.Context, j amboy.Job) error {
+	size, err := JobSize(j, q.format)
+	if err != nil {
+		return err
+	}
+
+	if size <= q.limit {
+		return nil
+	}
+
+	if sj, ok := j.(Spiller); ok && q.store != nil {
+		if err = sj.Spill(ctx, q.store); err != nil {
+			return errors.Wrapf(err, "problem spilling job '%s' to blob store", j.ID())
+		}
+
+		if size, err = JobSize(j, q.format); err != nil {
+			return err
+		}
+
+		if size <= q.limit {
+			return nil
+		}
+	}
+
+	return errors.Wrapf(ErrJobTooLarge, "job '%s' (%s) is %d bytes, limit is %d",
+		j.ID(), j.Type().Name, size, q.limit)
+}
+
+// Put adds the job to the wrapped queue if it's within the limit.
+func (q *SizeLimitedQueue) Put(ctx context.Context, j amboy.Job) error {
+	if err := q.Check(ctx, j); err != nil {
+		return err
+	}
+
+	return q.Queue.Put(ctx, j)
+}
+
+// DirectoryBlobStore is a BlobStore that stores blobs as files in a
+// directory, which should be shared by all of the processes that run
+// jobs from the queue.
+type DirectoryBlobStore struct {
+	path string
+}
+
+// NewDirectoryBlobStore creates the directory, if needed, and returns
+// a store that uses it.
+func NewDirectoryBlobStore(path string) (*DirectoryBlobStore, error) {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return nil, errors.Wrapf(err, "problem creating blob directory '%s'", path)
+	}
+
+	return &DirectoryBlobStore{path: path}, nil
+}
+
+func (s *DirectoryBlobStore) file(key string) (string, error) {
+	if key == "" || strings.ContainsAny(key, `/\`) || key == "." || key == ".." {
+		return "", errors.Errorf("'%s' is not a valid blob key", key)
+	}
+
+	return filepath.Join(s.path, key), nil
+}
+
+// Put writes the data to the file for the key.
+func (s *DirectoryBlobStore) Put(ctx context.Context, key string, data []byte) error {
+	fn, err := s.file(key)
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrapf(ioutil.WriteFile(fn, data, 0644), "problem writing blob '%s'", key)
+}
+
+// Get reads the data from the file for the key.
+func (s *DirectoryBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	fn, err := s.file(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading blob '%s'", key)
+	}
+
+	return data, nil
+}
+
+// BlobKey returns a key for a field of a job, for use by Spiller
+// implementations.
+func BlobKey(j amboy.Job, field string) string {
+	return strings.NewReplacer("/", "_", `\`, "_").Replace(fmt.Sprintf("%s.%s", j.ID(), field))
+}
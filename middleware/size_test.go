@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type spillJob struct {
+	*job.ShellJob
+	Data    string `json:"data"`
+	DataRef string `json:"data_ref"`
+}
+
+func (j *spillJob) Spill(ctx context.Context, store BlobStore) error {
+	key := BlobKey(j, "data")
+	if err := store.Put(ctx, key, []byte(j.Data)); err != nil {
+		return err
+	}
+	j.Data = ""
+	j.DataRef = key
+	return nil
+}
+
+func TestJobSize(t *testing.T) {
+	small, err := JobSize(job.NewShellJob("true", ""), amboy.JSON)
+	require.NoError(t, err)
+	assert.True(t, small > 0)
+
+	big, err := JobSize(job.NewShellJob("echo "+strings.Repeat("a", 1024), ""), amboy.JSON)
+	require.NoError(t, err)
+	assert.True(t, big >= small+1024)
+}
+
+func TestSizeLimitedQueue(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	base := queue.NewLocalLimitedSize(1, 16)
+	_, err := NewSizeLimitedQueue(nil, 1024, amboy.JSON, nil)
+	assert.Error(err)
+	_, err = NewSizeLimitedQueue(base, 0, amboy.JSON, nil)
+	assert.Error(err)
+
+	require.NoError(t, base.Start(ctx))
+	q, err := NewSizeLimitedQueue(base, 2048, amboy.JSON, nil)
+	require.NoError(t, err)
+	assert.Equal(2048, q.Limit())
+
+	require.NoError(t, q.Put(ctx, job.NewShellJob("true", "")))
+
+	err = q.Put(ctx, job.NewShellJob("echo "+strings.Repeat("a", 4096), ""))
+	require.Error(t, err)
+	assert.Equal(ErrJobTooLarge, errors.Cause(err))
+	assert.Equal(1, base.Stats(ctx).Total)
+
+	// jobs that can't spill are still rejected
+	sj := &spillJob{ShellJob: job.NewShellJob("true", ""), Data: strings.Repeat("b", 4096)}
+	assert.Equal(ErrJobTooLarge, errors.Cause(q.Put(ctx, sj)))
+}
+
+func TestSizeLimitedQueueSpillsToBlobStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "bond-blobs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := NewDirectoryBlobStore(dir)
+	require.NoError(t, err)
+
+	base := queue.NewLocalLimitedSize(1, 16)
+	require.NoError(t, base.Start(ctx))
+	q, err := NewSizeLimitedQueue(base, 2048, amboy.JSON, store)
+	require.NoError(t, err)
+
+	data := strings.Repeat("b", 4096)
+	sj := &spillJob{ShellJob: job.NewShellJob("true", ""), Data: data}
+	require.NoError(t, q.Put(ctx, sj))
+	assert.Empty(sj.Data)
+	require.NotEmpty(t, sj.DataRef)
+
+	out, err := store.Get(ctx, sj.DataRef)
+	require.NoError(t, err)
+	assert.Equal(data, string(out))
+
+	assert.Error(store.Put(ctx, "../escape", nil))
+	_, err = store.Get(ctx, "missing")
+	assert.Error(err)
+}
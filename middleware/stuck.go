@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/management"
+)
+
+// MonitorStuck checks for stuck jobs on the specified interval, until
+// the context is canceled, and runs the queue's OnStuck hooks for
+// each job the first time it is found to be stuck. Every stuck job
+// is also logged as a warning. The manager should wrap the queue's
+// driver.
+func (q *HookedQueue) MonitorStuck(ctx context.Context, m *management.Manager, p management.StuckPolicy, interval time.Duration) error {
+	if err := p.Validate(); err != nil {
+		return errors.Wrap(err, "invalid stuck job policy")
+	}
+	if interval <= 0 {
+		return errors.New("monitor interval must be positive")
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		reported := map[string]struct{}{}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				reported = q.checkStuck(ctx, m, p, reported)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// checkStuck runs the stuck hooks for newly stuck jobs, and returns
+// the set of jobs that are currently stuck, so that jobs that stop
+// being stuck are reported again if they become stuck later.
+func (q *HookedQueue) checkStuck(ctx context.Context, m *management.Manager, p management.StuckPolicy, reported map[string]struct{}) map[string]struct{} {
+	stuck, err := m.StuckJobs(ctx, p)
+	if err != nil {
+		grip.Warning(errors.Wrap(err, "problem checking for stuck jobs"))
+		return reported
+	}
+
+	current := make(map[string]struct{}, len(stuck))
+	for _, sj := range stuck {
+		current[sj.ID] = struct{}{}
+		if _, ok := reported[sj.ID]; ok {
+			continue
+		}
+
+		grip.Warning(message.Fields{
+			"message":   "job is stuck",
+			"job":       sj.ID,
+			"job_type":  sj.Type.Name,
+			"state":     sj.State,
+			"duration":  sj.Duration.String(),
+			"threshold": sj.Threshold.String(),
+			"queue":     q.ID(),
+		})
+
+		j, ok := q.Get(ctx, sj.ID)
+		if !ok {
+			continue
+		}
+
+		q.run(ctx, &q.stuck, j)
+	}
+
+	return current
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/management"
+)
+
+func TestStuckJobHooks(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	driver := queue.NewInternalDriver()
+	require.NoError(t, driver.Open(ctx))
+	defer driver.Close()
+
+	rq := queue.NewRemoteUnordered(1)
+	require.NoError(t, rq.SetDriver(driver))
+	q, err := NewHookedQueue(rq)
+	require.NoError(t, err)
+
+	rec := &hookRecorder{events: map[string][]string{}}
+	q.OnStuck(rec.hook("stuck"))
+
+	// the queue isn't started, so the job remains pending.
+	j := job.NewShellJob("true", "")
+	j.SetID("wedged")
+	require.NoError(t, q.Put(ctx, j))
+
+	m := management.New(driver)
+	policy := management.StuckPolicy{Default: management.StuckThreshold{Pending: time.Nanosecond}}
+
+	assert.Error(q.MonitorStuck(ctx, m, policy, 0))
+	assert.Error(q.MonitorStuck(ctx, m, management.StuckPolicy{Default: management.StuckThreshold{Pending: -1}}, time.Second))
+
+	reported := q.checkStuck(ctx, m, policy, map[string]struct{}{})
+	assert.Len(reported, 1)
+	assert.Equal([]string{"wedged"}, rec.get("stuck"))
+
+	// jobs are only reported once while they remain stuck
+	reported = q.checkStuck(ctx, m, policy, reported)
+	assert.Len(reported, 1)
+	assert.Len(rec.get("stuck"), 1)
+
+	// and again once they become stuck again
+	q.checkStuck(ctx, m, policy, map[string]struct{}{})
+	assert.Len(rec.get("stuck"), 2)
+
+	require.NoError(t, q.MonitorStuck(ctx, m, policy, 10*time.Millisecond))
+	for len(rec.get("stuck")) < 3 && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Len(rec.get("stuck"), 3)
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/subprocess"
+)
+
+// ProcessGroupQueue wraps a queue and runs the shell jobs that it
+// dispatches in their own process groups (see the subprocess
+// package), so that when the queue's context is canceled or a job's
+// MaxTime passes, the job's command and every process that it
+// started (such as a mongod, or the tools of an extraction) are
+// stopped, rather than only the command. The output that a stopped
+// job's command wrote before it stopped is kept in the job's Output.
+//
+// The ProcessGroupQueue replaces the shell jobs from the wrapped
+// queue, so it must wrap the queue before any other middleware does:
+// the other wrappers then dispatch the replacements. Other jobs are
+// not changed.
+type ProcessGroupQueue struct {
+	amboy.Queue
+
+	grace time.Duration
+}
+
+// NewProcessGroupQueue wraps a queue, which must not have started. The
+// processes of stopped jobs have the grace period (or
+// subprocess.DefaultGracePeriod, if it's zero) to exit after they're
+// signaled to terminate, before they're killed. Start the returned
+// queue rather than the wrapped queue.
+func NewProcessGroupQueue(q amboy.Queue, grace time.Duration) (*ProcessGroupQueue, error) {
+	if grace < 0 {
+		return nil, errors.New("grace period must not be negative")
+	}
+	if grace == 0 {
+		grace = subprocess.DefaultGracePeriod
+	}
+
+	pq := &ProcessGroupQueue{Queue: q, grace: grace}
+	if err := attach(q, pq); err != nil {
+		return nil, err
+	}
+
+	return pq, nil
+}
+
+// Next returns the next job from the wrapped queue, replacing shell
+// jobs so that they run in their own process groups.
+func (q *ProcessGroupQueue) Next(ctx context.Context) amboy.Job {
+	j := q.Queue.Next(ctx)
+	if sj, ok := j.(*job.ShellJob); ok {
+		return &groupShellJob{ShellJob: sj, grace: q.grace}
+	}
+
+	return j
+}
+
+// Save saves the job in the wrapped queue.
+func (q *ProcessGroupQueue) Save(ctx context.Context, j amboy.Job) error {
+	return q.Queue.Save(ctx, unwrapGrouped(j))
+}
+
+// Complete marks the job complete in the wrapped queue.
+func (q *ProcessGroupQueue) Complete(ctx context.Context, j amboy.Job) {
+	q.Queue.Complete(ctx, unwrapGrouped(j))
+}
+
+// SetRunner sets the runner of the wrapped queue.
+func (q *ProcessGroupQueue) SetRunner(r amboy.Runner) error { return setRunner(q.Queue, q, r) }
+
+// groupShellJob runs a shell job's command as the ShellJob does, but
+// in its own process group. As with loggedJob, the queue unwraps jobs
+// before storing them.
+type groupShellJob struct {
+	*job.ShellJob
+	grace time.Duration
+}
+
+func (j *groupShellJob) Run(ctx context.Context) {
+	defer j.MarkComplete()
+
+	args := strings.Split(j.Command, " ")
+	cmd := exec.Command(args[0], args[1:]...) // nolint
+	cmd.Dir = j.WorkingDir
+	// like the ShellJob, the command only has the job's
+	// environment
+	cmd.Env = []string{}
+	for k, v := range j.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	out, err := subprocess.Run(ctx, cmd, j.grace)
+	j.AddError(err)
+	j.Output = strings.TrimSpace(string(out))
+}
+
+func unwrapGrouped(j amboy.Job) amboy.Job {
+	if gj, ok := j.(*groupShellJob); ok {
+		return gj.ShellJob
+	}
+
+	return j
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessGroupQueueStopsShellJobs(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "bond-process-group-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "script.sh")
+	require.NoError(t, ioutil.WriteFile(script, []byte("sleep 30 &\necho started\nwait\n"), 0755))
+
+	_, err = NewProcessGroupQueue(queue.NewLocalLimitedSize(1, 16), -time.Second)
+	assert.Error(err)
+
+	base, err := NewProcessGroupQueue(queue.NewLocalLimitedSize(2, 16), time.Millisecond)
+	require.NoError(t, err)
+	// other middleware wraps the ProcessGroupQueue
+	q, err := NewSandboxQueue(base, dir)
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	slow := job.NewShellJob("sh "+script, "")
+	slow.UpdateTimeInfo(amboy.JobTimeInfo{MaxTime: 500 * time.Millisecond})
+	quick := job.NewShellJob("echo done", "")
+	require.NoError(t, q.Put(ctx, slow))
+	require.NoError(t, q.Put(ctx, quick))
+
+	// amboy's queues don't count jobs that exceed their MaxTime
+	// as complete, so wait for the jobs themselves
+	start := time.Now()
+	require.True(t, amboy.WaitJobInterval(ctx, slow, q, 10*time.Millisecond))
+	require.True(t, amboy.WaitJobInterval(ctx, quick, q, 10*time.Millisecond))
+	assert.True(time.Since(start) < 20*time.Second)
+
+	out, ok := q.Get(ctx, slow.ID())
+	require.True(t, ok)
+	require.IsType(t, &job.ShellJob{}, out)
+	require.Error(t, out.Error())
+	assert.Contains(out.Error().Error(), "context deadline exceeded")
+	// the output from before the job was stopped is kept
+	assert.Equal("started", out.(*job.ShellJob).Output)
+	assert.Equal("", out.(*job.ShellJob).WorkingDir)
+
+	out, ok = q.Get(ctx, quick.ID())
+	require.True(t, ok)
+	assert.NoError(out.Error())
+	assert.Equal("done", out.(*job.ShellJob).Output)
+}
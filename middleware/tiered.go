@@ -0,0 +1,264 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// The tiers of a TieredQueue.
+const (
+	LocalTier  = "local"
+	RemoteTier = "remote"
+)
+
+// TieredQueueOptions configure a TieredQueue. Jobs run in the local
+// tier unless the Tier function, if specified, assigns them to the
+// remote tier, or their type is one of the RemoteTypes, or they're
+// larger than MaxLocalSize when serialized.
+type TieredQueueOptions struct {
+	// Local is the queue of small, fast jobs, typically an
+	// in-memory queue.
+	Local amboy.Queue
+	// Remote is the queue of large or durable jobs, typically a
+	// driver-backed queue whose workers may run in other
+	// processes.
+	Remote amboy.Queue
+	// RemoteTypes are the names of the job types that always run
+	// in the remote tier.
+	RemoteTypes []string
+	// MaxLocalSize, if positive, is the size in bytes, when
+	// serialized as JSON, of the largest jobs that run in the
+	// local tier.
+	MaxLocalSize int
+	// Tier, if specified, assigns jobs to a tier (LocalTier or
+	// RemoteTier) before the other rules; jobs that it returns an
+	// empty tier for use the other rules.
+	Tier func(amboy.Job) string
+}
+
+// Validate returns an error if the options are incomplete.
+func (o TieredQueueOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(o.Local == nil, "must specify a local queue")
+	catcher.NewWhen(o.Remote == nil, "must specify a remote queue")
+	catcher.NewWhen(o.Local != nil && o.Local == o.Remote, "local and remote queues must differ")
+	catcher.NewWhen(o.MaxLocalSize < 0, "maximum local job size must not be negative")
+	return catcher.Resolve()
+}
+
+// TieredQueue presents a local queue and a remote queue as one queue,
+// so that applications get the low latency of an in-memory queue for
+// small, fast jobs without giving up durability for heavy work: Put
+// assigns each job to a tier (see TieredQueueOptions), and Get, Save,
+// Complete, and the reports of jobs and stats span both tiers.
+//
+// Each tier keeps its own runner, and any middleware of its own, so
+// unlike the other wrappers, the TieredQueue does not take the place
+// of the queues in their runners: Next and Runner are those of the
+// local tier, SetRunner is not supported, and Start starts both tiers.
+type TieredQueue struct {
+	local        amboy.Queue
+	remote       amboy.Queue
+	remoteTypes  map[string]bool
+	maxLocalSize int
+	tier         func(amboy.Job) string
+}
+
+// NewTieredQueue builds a queue that spans the tiers of the options.
+func NewTieredQueue(opts TieredQueueOptions) (*TieredQueue, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid tiered queue options")
+	}
+
+	q := &TieredQueue{
+		local:        opts.Local,
+		remote:       opts.Remote,
+		remoteTypes:  map[string]bool{},
+		maxLocalSize: opts.MaxLocalSize,
+		tier:         opts.Tier,
+	}
+	for _, name := range opts.RemoteTypes {
+		q.remoteTypes[name] = true
+	}
+
+	return q, nil
+}
+
+// Local returns the queue of the local tier.
+func (q *TieredQueue) Local() amboy.Queue { return q.local }
+
+// Remote returns the queue of the remote tier.
+func (q *TieredQueue) Remote() amboy.Queue { return q.remote }
+
+// Tier returns the tier that the job runs in.
+func (q *TieredQueue) Tier(j amboy.Job) (string, error) {
+	if q.tier != nil {
+		switch tier := q.tier(j); tier {
+		case LocalTier, RemoteTier:
+			return tier, nil
+		case "":
+		default:
+			return "", errors.Errorf("job '%s' has unknown tier '%s'", j.ID(), tier)
+		}
+	}
+
+	if q.remoteTypes[j.Type().Name] {
+		return RemoteTier, nil
+	}
+
+	if q.maxLocalSize > 0 {
+		size, err := JobSize(j, amboy.JSON)
+		if err != nil {
+			return "", err
+		}
+		if size > q.maxLocalSize {
+			return RemoteTier, nil
+		}
+	}
+
+	return LocalTier, nil
+}
+
+// ID returns an identifier composed of the tiers' IDs.
+func (q *TieredQueue) ID() string {
+	return "tiered[" + q.local.ID() + "," + q.remote.ID() + "]"
+}
+
+// Put adds the job to the queue of its tier.
+func (q *TieredQueue) Put(ctx context.Context, j amboy.Job) error {
+	tier, err := q.Tier(j)
+	if err != nil {
+		return errors.Wrapf(err, "problem assigning job '%s' to a tier", j.ID())
+	}
+
+	if tier == RemoteTier {
+		return q.remote.Put(ctx, j)
+	}
+
+	return q.local.Put(ctx, j)
+}
+
+// Get returns the job with the ID from either tier, checking the local
+// tier first.
+func (q *TieredQueue) Get(ctx context.Context, id string) (amboy.Job, bool) {
+	if j, ok := q.local.Get(ctx, id); ok {
+		return j, true
+	}
+
+	return q.remote.Get(ctx, id)
+}
+
+// owner returns the tier's queue that has the job, or nil.
+func (q *TieredQueue) owner(ctx context.Context, j amboy.Job) amboy.Queue {
+	for _, tier := range []amboy.Queue{q.local, q.remote} {
+		if _, ok := tier.Get(ctx, j.ID()); ok {
+			return tier
+		}
+	}
+
+	return nil
+}
+
+// Next returns the next job of the local tier.
+func (q *TieredQueue) Next(ctx context.Context) amboy.Job { return q.local.Next(ctx) }
+
+// Complete marks the job complete in the tier that has it.
+func (q *TieredQueue) Complete(ctx context.Context, j amboy.Job) {
+	if tier := q.owner(ctx, j); tier != nil {
+		tier.Complete(ctx, j)
+	}
+}
+
+// Save saves the job in the tier that has it.
+func (q *TieredQueue) Save(ctx context.Context, j amboy.Job) error {
+	tier := q.owner(ctx, j)
+	if tier == nil {
+		return errors.Errorf("job '%s' is not in either tier", j.ID())
+	}
+
+	return tier.Save(ctx, j)
+}
+
+// Started reports whether both tiers have started.
+func (q *TieredQueue) Started() bool { return q.local.Started() && q.remote.Started() }
+
+// Start starts the tiers that have not started.
+func (q *TieredQueue) Start(ctx context.Context) error {
+	if !q.remote.Started() {
+		if err := q.remote.Start(ctx); err != nil {
+			return errors.Wrap(err, "problem starting remote tier")
+		}
+	}
+
+	if !q.local.Started() {
+		return errors.Wrap(q.local.Start(ctx), "problem starting local tier")
+	}
+
+	return nil
+}
+
+// Runner returns the runner of the local tier.
+func (q *TieredQueue) Runner() amboy.Runner { return q.local.Runner() }
+
+// SetRunner returns an error: the tiers keep their own runners.
+func (q *TieredQueue) SetRunner(amboy.Runner) error {
+	return errors.New("cannot set the runner of a tiered queue; set the runners of its tiers")
+}
+
+// Results returns the completed jobs of the local tier, and then of
+// the remote tier.
+func (q *TieredQueue) Results(ctx context.Context) <-chan amboy.Job {
+	out := make(chan amboy.Job)
+	go func() {
+		defer close(out)
+		for _, tier := range []amboy.Queue{q.local, q.remote} {
+			for j := range tier.Results(ctx) {
+				select {
+				case <-ctx.Done():
+					return
+				case out <- j:
+				}
+			}
+		}
+	}()
+
+	return out
+}
+
+// JobStats returns the status of the jobs of the local tier, and then
+// of the remote tier.
+func (q *TieredQueue) JobStats(ctx context.Context) <-chan amboy.JobStatusInfo {
+	out := make(chan amboy.JobStatusInfo)
+	go func() {
+		defer close(out)
+		for _, tier := range []amboy.Queue{q.local, q.remote} {
+			for stat := range tier.JobStats(ctx) {
+				select {
+				case <-ctx.Done():
+					return
+				case out <- stat:
+				}
+			}
+		}
+	}()
+
+	return out
+}
+
+// Stats returns the sums of the stats of the tiers.
+func (q *TieredQueue) Stats(ctx context.Context) amboy.QueueStats {
+	out := amboy.QueueStats{}
+	for _, tier := range []amboy.Queue{q.local, q.remote} {
+		stats := tier.Stats(ctx)
+		out.Running += stats.Running
+		out.Completed += stats.Completed
+		out.Pending += stats.Pending
+		out.Blocked += stats.Blocked
+		out.Total += stats.Total
+	}
+
+	return out
+}
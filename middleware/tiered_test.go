@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTieredTestQueue(t *testing.T, opts TieredQueueOptions) *TieredQueue {
+	remote := queue.NewRemoteUnordered(1)
+	require.NoError(t, remote.SetDriver(queue.NewInternalDriver()))
+	opts.Local = queue.NewLocalLimitedSize(1, 16)
+	opts.Remote = remote
+
+	q, err := NewTieredQueue(opts)
+	require.NoError(t, err)
+	return q
+}
+
+func TestTieredQueueOptionsValidate(t *testing.T) {
+	assert := assert.New(t)
+	local := queue.NewLocalLimitedSize(1, 16)
+
+	assert.Error(TieredQueueOptions{}.Validate())
+	assert.Error(TieredQueueOptions{Local: local}.Validate())
+	assert.Error(TieredQueueOptions{Local: local, Remote: local}.Validate())
+	assert.Error(TieredQueueOptions{Local: local, Remote: queue.NewLocalLimitedSize(1, 16), MaxLocalSize: -1}.Validate())
+	assert.NoError(TieredQueueOptions{Local: local, Remote: queue.NewLocalLimitedSize(1, 16)}.Validate())
+}
+
+func TestTieredQueueAssignsTiers(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q := newTieredTestQueue(t, TieredQueueOptions{
+		RemoteTypes:  []string{"durable"},
+		MaxLocalSize: 2048,
+		Tier: func(j amboy.Job) string {
+			if strings.HasPrefix(j.ID(), "forced-") {
+				return RemoteTier
+			}
+			return ""
+		},
+	})
+	assert.Error(q.SetRunner(nil))
+	require.NoError(t, q.Start(ctx))
+	assert.True(q.Started())
+
+	small := job.NewShellJob("true", "")
+	big := job.NewShellJob("echo "+strings.Repeat("a", 4096), "")
+	durable := job.NewShellJob("true", "")
+	durable.JobType.Name = "durable"
+	forced := job.NewShellJob("true", "")
+	forced.SetID("forced-" + forced.ID())
+
+	for _, tc := range []struct {
+		j    amboy.Job
+		tier string
+	}{{small, LocalTier}, {big, RemoteTier}, {durable, RemoteTier}, {forced, RemoteTier}} {
+		tier, err := q.Tier(tc.j)
+		require.NoError(t, err)
+		assert.Equal(tc.tier, tier, tc.j.ID())
+		require.NoError(t, q.Put(ctx, tc.j))
+	}
+
+	_, ok := q.Local().Get(ctx, small.ID())
+	assert.True(ok)
+	_, ok = q.Remote().Get(ctx, big.ID())
+	assert.True(ok)
+	_, ok = q.Local().Get(ctx, durable.ID())
+	assert.False(ok)
+
+	// both tiers run their jobs, and the queue reports them together
+	amboy.WaitInterval(ctx, q, 10*time.Millisecond)
+	assert.Equal(4, q.Stats(ctx).Completed)
+	for _, j := range []amboy.Job{small, big, durable, forced} {
+		got, ok := q.Get(ctx, j.ID())
+		require.True(t, ok, j.ID())
+		assert.True(got.Status().Completed, j.ID())
+	}
+
+	stats := 0
+	for range q.JobStats(ctx) {
+		stats++
+	}
+	assert.Equal(4, stats)
+
+	results := 0
+	for range q.Results(ctx) {
+		results++
+	}
+	assert.Equal(4, results)
+}
+
+func TestTieredQueueRejectsUnknownTiers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q := newTieredTestQueue(t, TieredQueueOptions{Tier: func(amboy.Job) string { return "elsewhere" }})
+	require.NoError(t, q.Start(ctx))
+
+	err := q.Put(ctx, job.NewShellJob("true", ""))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown tier 'elsewhere'")
+	assert.Equal(t, 0, q.Stats(ctx).Total)
+}
@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/mongodb/amboy"
+	"github.com/pkg/errors"
+)
+
+// Names of the spans that a TracingQueue starts.
+const (
+	SpanPut = "amboy.put"
+	SpanRun = "amboy.run"
+)
+
+// TraceContext holds the propagation fields of a span, which are the
+// W3C Trace Context traceparent and tracestate headers, which jobs
+// store so that the workers that run them, in any process, continue
+// the trace of the process that submitted them.
+//
+// bond does not depend on OpenTelemetry, or any other tracing library:
+// the TracingQueue only propagates these fields with jobs, and starts
+// and ends spans through a Tracer, which the caller provides.
+type TraceContext map[string]string
+
+// Traced is implemented by jobs that store a trace context.
+type Traced interface {
+	TraceContext() TraceContext
+	SetTraceContext(TraceContext)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// TraceContext returns the propagation fields of the span.
+	TraceContext() TraceContext
+	// End ends the span, recording the error, if any.
+	End(error)
+}
+
+// Tracer starts spans for a TracingQueue, and adapts a tracing
+// library to the queue. The package provides no implementation: an
+// adapter for OpenTelemetry, for example, would extract the parent
+// from the trace context with a W3C propagator, start the span with a
+// trace.Tracer, and inject the span's context into the TraceContext
+// that the span returns.
+type Tracer interface {
+	// StartSpan starts a span that is a child of the parent trace
+	// context, if it has one, and otherwise of the span in the
+	// context, if any. The returned context contains the span.
+	StartSpan(ctx context.Context, name string, parent TraceContext, attrs map[string]string) (context.Context, Span)
+}
+
+// TracingQueue wraps a queue and traces the jobs that store a trace
+// context (see Traced): Put starts a span for the submission, in the
+// submitter's trace, and stores the span's context with the job, and
+// jobs that the queue dispatches run in a span that continues the
+// job's trace, from dispatch until the worker completes the job.
+// Other jobs pass through unchanged.
+//
+// Since the trace context is stored with the job, traces continue in
+// remote queues whose workers run in other processes, as long as
+// every process's queue is a TracingQueue.
+type TracingQueue struct {
+	amboy.Queue
+
+	tracer Tracer
+}
+
+// NewTracingQueue wraps a queue, which must not have started, and
+// traces its jobs with the tracer. Start the returned queue rather
+// than the wrapped queue.
+func NewTracingQueue(q amboy.Queue, t Tracer) (*TracingQueue, error) {
+	if t == nil {
+		return nil, errors.New("must specify a tracer")
+	}
+
+	tq := &TracingQueue{Queue: q, tracer: t}
+	if err := attach(q, tq); err != nil {
+		return nil, err
+	}
+
+	return tq, nil
+}
+
+// Put adds the job to the wrapped queue in a span, and stores the
+// span's trace context with the job.
+func (q *TracingQueue) Put(ctx context.Context, j amboy.Job) error {
+	tj, ok := j.(Traced)
+	if !ok {
+		return q.Queue.Put(ctx, j)
+	}
+
+	ctx, span := q.tracer.StartSpan(ctx, SpanPut, tj.TraceContext(), spanAttributes(j))
+	tj.SetTraceContext(span.TraceContext())
+
+	err := q.Queue.Put(ctx, j)
+	span.End(err)
+
+	return err
+}
+
+// Next returns the next job from the wrapped queue, wrapped so that,
+// if it stores a trace context, it runs in a span.
+func (q *TracingQueue) Next(ctx context.Context) amboy.Job {
+	j := q.Queue.Next(ctx)
+	if j == nil {
+		return nil
+	}
+
+	tj, ok := j.(Traced)
+	if !ok || len(tj.TraceContext()) == 0 {
+		return j
+	}
+
+	runCtx, span := q.tracer.StartSpan(context.Background(), SpanRun, tj.TraceContext(), spanAttributes(j))
+	return &tracedJob{Job: j, ctx: runCtx, span: span}
+}
+
+// Save saves the job in the wrapped queue.
+func (q *TracingQueue) Save(ctx context.Context, j amboy.Job) error {
+	return q.Queue.Save(ctx, unwrapTraced(j))
+}
+
+// Complete marks the job complete in the wrapped queue, and then ends
+// the job's span, with the job's error.
+func (q *TracingQueue) Complete(ctx context.Context, j amboy.Job) {
+	q.Queue.Complete(ctx, unwrapTraced(j))
+
+	if tj, ok := j.(*tracedJob); ok {
+		tj.span.End(tj.Error())
+	}
+}
+
+// SetRunner sets the runner of the wrapped queue.
+func (q *TracingQueue) SetRunner(r amboy.Runner) error { return setRunner(q.Queue, q, r) }
+
+func spanAttributes(j amboy.Job) map[string]string {
+	return map[string]string{
+		"job.id":   j.ID(),
+		"job.type": j.Type().Name,
+	}
+}
+
+// tracedJob runs the job in its span: the span's values, such as the
+// active span of a tracing library, are available from the context
+// of the job's Run method, which is canceled with the worker's
+// context. The queue unwraps jobs before storing them.
+type tracedJob struct {
+	amboy.Job
+	ctx  context.Context
+	span Span
+}
+
+func (j *tracedJob) Run(ctx context.Context) { j.Job.Run(spanContext{Context: ctx, values: j.ctx}) }
+
+// spanContext is a context with the cancellation and deadline of the
+// worker's context and the values of the span's context, before the
+// worker's values.
+type spanContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c spanContext) Value(key interface{}) interface{} {
+	if v := c.values.Value(key); v != nil {
+		return v
+	}
+
+	return c.Context.Value(key)
+}
+
+func unwrapTraced(j amboy.Job) amboy.Job {
+	if tj, ok := j.(*tracedJob); ok {
+		return tj.Job
+	}
+
+	return j
+}
@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type spanKey struct{}
+
+type testSpan struct {
+	tracer *testTracer
+	name   string
+	id     string
+	parent string
+	attrs  map[string]string
+	ended  bool
+	err    error
+}
+
+func (s *testSpan) TraceContext() TraceContext { return TraceContext{"traceparent": s.id} }
+
+func (s *testSpan) End(err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+
+	s.ended = true
+	s.err = err
+}
+
+type testTracer struct {
+	mu    sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) StartSpan(ctx context.Context, name string, parent TraceContext, attrs map[string]string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := &testSpan{tracer: t, name: name, parent: parent["traceparent"], attrs: attrs}
+	if s.parent == "" {
+		if ps, ok := ctx.Value(spanKey{}).(*testSpan); ok {
+			s.parent = ps.id
+		}
+	}
+	s.id = fmt.Sprintf("span-%d", len(t.spans))
+	t.spans = append(t.spans, s)
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// wait waits for the queue's spans with the name to end, since
+// TracingQueue ends run spans after the wrapped queue completes their
+// jobs.
+func (t *testTracer) wait(ctx context.Context, name string, n int) bool {
+	for {
+		ended := 0
+		for _, s := range t.named(name) {
+			t.mu.Lock()
+			if s.ended {
+				ended++
+			}
+			t.mu.Unlock()
+		}
+		if ended >= n {
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func (t *testTracer) named(name string) []*testSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := []*testSpan{}
+	for _, s := range t.spans {
+		if s.name == name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+type tracingJob struct {
+	*job.Base
+	Trace TraceContext `bson:"trace" json:"trace" yaml:"trace"`
+	fail  bool
+	span  *testSpan
+}
+
+func newTracingJob(id string, fail bool) *tracingJob {
+	j := &tracingJob{Base: &job.Base{JobType: amboy.JobType{Name: "tracing-test"}}, fail: fail}
+	j.SetID(id)
+	j.SetDependency(nil)
+	return j
+}
+
+func (j *tracingJob) TraceContext() TraceContext      { return j.Trace }
+func (j *tracingJob) SetTraceContext(tc TraceContext) { j.Trace = tc }
+
+func (j *tracingJob) Run(ctx context.Context) {
+	defer j.MarkComplete()
+
+	j.span, _ = ctx.Value(spanKey{}).(*testSpan)
+	if j.fail {
+		j.AddError(errors.New("failed"))
+	}
+}
+
+func TestTracingQueueTracesJobLifecycles(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := NewTracingQueue(queue.NewLocalLimitedSize(1, 16), nil)
+	assert.Error(err)
+
+	tracer := &testTracer{}
+	q, err := NewTracingQueue(queue.NewLocalLimitedSize(1, 16), tracer)
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	submitCtx, root := tracer.StartSpan(ctx, "submit", nil, nil)
+	ok := newTracingJob("ok", false)
+	failed := newTracingJob("failed", true)
+	require.NoError(t, q.Put(submitCtx, ok))
+	require.NoError(t, q.Put(submitCtx, failed))
+	require.NoError(t, q.Put(ctx, job.NewShellJob("true", "")))
+	require.True(t, amboy.WaitInterval(ctx, q, 10*time.Millisecond))
+	require.True(t, tracer.wait(ctx, SpanRun, 2))
+
+	puts := tracer.named(SpanPut)
+	require.Len(t, puts, 2)
+	for _, s := range puts {
+		assert.Equal(root.TraceContext()["traceparent"], s.parent)
+		assert.True(s.ended)
+		assert.NoError(s.err)
+	}
+	assert.Equal(puts[0].TraceContext(), ok.Trace)
+	assert.Equal(puts[1].TraceContext(), failed.Trace)
+
+	runs := tracer.named(SpanRun)
+	require.Len(t, runs, 2)
+	byID := map[string]*testSpan{}
+	for _, s := range runs {
+		assert.True(s.ended)
+		byID[s.attrs["job.id"]] = s
+	}
+	require.Len(t, byID, 2)
+
+	// runs continue the trace of the submission, and jobs run in
+	// their spans
+	assert.Equal(puts[0].id, byID["ok"].parent)
+	assert.Equal(puts[1].id, byID["failed"].parent)
+	assert.Equal("tracing-test", byID["ok"].attrs["job.type"])
+	assert.NoError(byID["ok"].err)
+	assert.Error(byID["failed"].err)
+	assert.True(byID["ok"] == ok.span)
+
+	// completed jobs are stored unwrapped
+	j, found := q.Get(ctx, "ok")
+	require.True(t, found)
+	assert.IsType(&tracingJob{}, j)
+	assert.True(j.Status().Completed)
+}
+
+func TestTracingQueueContinuesStoredTraces(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// a job that carries the trace context of another process's put
+	tracer := &testTracer{}
+	q, err := NewTracingQueue(queue.NewLocalLimitedSize(1, 16), tracer)
+	require.NoError(t, err)
+
+	require.NoError(t, q.Start(ctx))
+
+	j := newTracingJob("remote", false)
+	j.Trace = TraceContext{"traceparent": "remote-put"}
+	require.NoError(t, q.Queue.Put(ctx, j))
+	require.True(t, amboy.WaitInterval(ctx, q, 10*time.Millisecond))
+	require.True(t, tracer.wait(ctx, SpanRun, 1))
+
+	runs := tracer.named(SpanRun)
+	require.Len(t, runs, 1)
+	assert.Equal("remote-put", runs[0].parent)
+	assert.True(runs[0].ended)
+}
@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mongodb/amboy"
+)
+
+// DefaultTypeStatsWindow is the number of recent executions of each
+// job type that a TypeStatsQueue keeps, when it is not specified.
+const DefaultTypeStatsWindow = 100
+
+// TypeStats reports the executions of the jobs of a type: the counts
+// and mean duration of all executions since the queue started, and
+// the failure rate and durations of the most recent executions, so
+// that changes in a type's behavior, such as extraction jobs that
+// take ten times as long after a change to the cache's filesystem,
+// stand out from its history.
+type TypeStats struct {
+	Type       string `bson:"type" json:"type" yaml:"type"`
+	Executions int    `bson:"executions" json:"executions" yaml:"executions"`
+	Failures   int    `bson:"failures" json:"failures" yaml:"failures"`
+	// MeanDuration is the mean duration of all executions.
+	MeanDuration time.Duration `bson:"mean_duration" json:"mean_duration" yaml:"mean_duration"`
+	// Recent is the number of recent executions, at most the
+	// queue's window, that the other fields describe.
+	Recent             int           `bson:"recent" json:"recent" yaml:"recent"`
+	RecentFailureRate  float64       `bson:"recent_failure_rate" json:"recent_failure_rate" yaml:"recent_failure_rate"`
+	RecentMeanDuration time.Duration `bson:"recent_mean_duration" json:"recent_mean_duration" yaml:"recent_mean_duration"`
+	RecentP50Duration  time.Duration `bson:"recent_p50_duration" json:"recent_p50_duration" yaml:"recent_p50_duration"`
+	RecentP95Duration  time.Duration `bson:"recent_p95_duration" json:"recent_p95_duration" yaml:"recent_p95_duration"`
+	RecentMaxDuration  time.Duration `bson:"recent_max_duration" json:"recent_max_duration" yaml:"recent_max_duration"`
+	LastCompleted      time.Time     `bson:"last_completed" json:"last_completed" yaml:"last_completed"`
+}
+
+// Slowdown returns the ratio of the mean duration of the recent
+// executions to the mean duration of all executions, which is greater
+// than 1 when the type's jobs have recently become slower, or 0 if
+// the type has no durations.
+func (s TypeStats) Slowdown() float64 {
+	if s.MeanDuration <= 0 {
+		return 0
+	}
+
+	return float64(s.RecentMeanDuration) / float64(s.MeanDuration)
+}
+
+// TypeStatsReporter is implemented by queues that report the stats
+// of their job types, such as TypeStatsQueue.
+type TypeStatsReporter interface {
+	TypeStats() []TypeStats
+}
+
+// execution is a completed run of a job.
+type execution struct {
+	duration time.Duration
+	failed   bool
+}
+
+// typeRecord is the history of the executions of a job type. Recent
+// executions are kept in a ring of the window's size.
+type typeRecord struct {
+	executions    int
+	failures      int
+	totalDuration time.Duration
+	recent        []execution
+	next          int
+	lastCompleted time.Time
+}
+
+func (r *typeRecord) add(e execution, window int, completed time.Time) {
+	r.executions++
+	r.totalDuration += e.duration
+	if e.failed {
+		r.failures++
+	}
+	if completed.After(r.lastCompleted) {
+		r.lastCompleted = completed
+	}
+
+	if len(r.recent) < window {
+		r.recent = append(r.recent, e)
+		return
+	}
+	r.recent[r.next] = e
+	r.next = (r.next + 1) % window
+}
+
+func (r *typeRecord) stats(name string) TypeStats {
+	out := TypeStats{
+		Type:          name,
+		Executions:    r.executions,
+		Failures:      r.failures,
+		Recent:        len(r.recent),
+		LastCompleted: r.lastCompleted,
+	}
+	if r.executions > 0 {
+		out.MeanDuration = r.totalDuration / time.Duration(r.executions)
+	}
+	if len(r.recent) == 0 {
+		return out
+	}
+
+	durations := make([]time.Duration, 0, len(r.recent))
+	var total time.Duration
+	failed := 0
+	for _, e := range r.recent {
+		durations = append(durations, e.duration)
+		total += e.duration
+		if e.failed {
+			failed++
+		}
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	out.RecentFailureRate = float64(failed) / float64(len(r.recent))
+	out.RecentMeanDuration = total / time.Duration(len(durations))
+	out.RecentP50Duration = percentile(durations, 0.5)
+	out.RecentP95Duration = percentile(durations, 0.95)
+	out.RecentMaxDuration = durations[len(durations)-1]
+
+	return out
+}
+
+// percentile returns the nearest-rank percentile of the sorted
+// durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	idx := int(p*float64(len(sorted))+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+
+	return sorted[idx]
+}
+
+// TypeStatsQueue wraps a queue and tracks the durations and failures
+// of the jobs of each type as they complete, which TypeStats reports.
+// The durations are those of the jobs' runs, from their time info.
+// The stats are kept in memory, and describe the jobs that the
+// queue's workers have completed since the wrapper was built.
+type TypeStatsQueue struct {
+	amboy.Queue
+
+	window int
+	mu     sync.Mutex
+	types  map[string]*typeRecord
+}
+
+// NewTypeStatsQueue wraps a queue, which must not have started, to
+// track the stats of its job types, keeping the window's number of
+// recent executions of each type, or DefaultTypeStatsWindow if the
+// window is not positive. Start the returned queue rather than the
+// wrapped queue.
+func NewTypeStatsQueue(q amboy.Queue, window int) (*TypeStatsQueue, error) {
+	if window <= 0 {
+		window = DefaultTypeStatsWindow
+	}
+
+	sq := &TypeStatsQueue{Queue: q, window: window, types: map[string]*typeRecord{}}
+	if err := attach(q, sq); err != nil {
+		return nil, err
+	}
+
+	return sq, nil
+}
+
+// Complete marks the job complete in the wrapped queue, and records
+// its execution.
+func (q *TypeStatsQueue) Complete(ctx context.Context, j amboy.Job) {
+	q.Queue.Complete(ctx, j)
+
+	ti := j.TimeInfo()
+	e := execution{failed: j.Error() != nil}
+	if !ti.Start.IsZero() && ti.End.After(ti.Start) {
+		e.duration = ti.End.Sub(ti.Start)
+	}
+	completed := ti.End
+	if completed.IsZero() {
+		completed = time.Now()
+	}
+
+	name := j.Type().Name
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	r, ok := q.types[name]
+	if !ok {
+		r = &typeRecord{}
+		q.types[name] = r
+	}
+	r.add(e, q.window, completed)
+}
+
+// TypeStats returns the stats of the job types that have completed
+// jobs, ordered by type name.
+func (q *TypeStatsQueue) TypeStats() []TypeStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	out := make([]TypeStats, 0, len(q.types))
+	for name, r := range q.types {
+		out = append(out, r.stats(name))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Type < out[j].Type })
+
+	return out
+}
+
+// SetRunner sets the runner of the wrapped queue.
+func (q *TypeStatsQueue) SetRunner(r amboy.Runner) error { return setRunner(q.Queue, q, r) }
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypeStatsQueueRecordsExecutions(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q, err := NewTypeStatsQueue(queue.NewLocalLimitedSize(2, 16), 0)
+	require.NoError(t, err)
+	assert.Equal(DefaultTypeStatsWindow, q.window)
+	require.NoError(t, q.Start(ctx))
+
+	for _, cmd := range []string{"true", "true", "false", "sleep 0.01"} {
+		require.NoError(t, q.Put(ctx, job.NewShellJob(cmd, "")))
+	}
+	amboy.WaitInterval(ctx, q, 10*time.Millisecond)
+
+	stats := q.TypeStats()
+	require.Len(t, stats, 1)
+	assert.Equal("shell", stats[0].Type)
+	assert.Equal(4, stats[0].Executions)
+	assert.Equal(1, stats[0].Failures)
+	assert.Equal(4, stats[0].Recent)
+	assert.Equal(0.25, stats[0].RecentFailureRate)
+	assert.True(stats[0].RecentMaxDuration >= 10*time.Millisecond)
+	assert.False(stats[0].LastCompleted.IsZero())
+}
+
+func TestTypeRecordKeepsRecentWindow(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+
+	r := &typeRecord{}
+	for i := 0; i < 4; i++ {
+		r.add(execution{duration: time.Second}, 4, now)
+	}
+	// the type's jobs become ten times slower, and start failing
+	for i := 0; i < 2; i++ {
+		r.add(execution{duration: 10 * time.Second, failed: true}, 4, now)
+	}
+
+	stats := r.stats("extract")
+	assert.Equal(6, stats.Executions)
+	assert.Equal(2, stats.Failures)
+	assert.Equal(4, stats.Recent)
+	assert.Equal(0.5, stats.RecentFailureRate)
+	assert.Equal(4*time.Second, stats.MeanDuration)
+	assert.Equal(5500*time.Millisecond, stats.RecentMeanDuration)
+	assert.Equal(time.Second, stats.RecentP50Duration)
+	assert.Equal(10*time.Second, stats.RecentP95Duration)
+	assert.Equal(10*time.Second, stats.RecentMaxDuration)
+	assert.Equal(1.375, stats.Slowdown())
+
+	assert.Equal(float64(0), TypeStats{}.Slowdown())
+}
+
+func TestTypeStatsQueueRequiresStoppedQueue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := queue.NewLocalLimitedSize(1, 16)
+	require.NoError(t, q.Start(ctx))
+
+	_, err := NewTypeStatsQueue(q, 10)
+	assert.Error(t, err)
+}
@@ -0,0 +1,270 @@
+/*
+Package mirror synchronizes a bond cache directory with a mirror of
+MongoDB build archives, such as an S3 bucket or a web server that
+publishes a SHA256SUMS file, transferring only the archives that the
+mirror is missing or that differ from the local copies. It also
+reconciles two caches, such as a laptop's and a lab's, copying the
+archives that each is missing from the other.
+*/
+package mirror
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+)
+
+// Entry describes one archive in a manifest. Manifests from
+// different sources record different checksums: SHA256SUMS files
+// have no sizes, and S3 listings have no SHA256 checksums, but an
+// ETag that is the MD5 checksum of objects that were not uploaded in
+// parts.
+type Entry struct {
+	Name   string `bson:"name" json:"name" yaml:"name"`
+	Size   int64  `bson:"size" json:"size" yaml:"size"`
+	SHA256 string `bson:"sha256,omitempty" json:"sha256,omitempty" yaml:"sha256,omitempty"`
+	ETag   string `bson:"etag,omitempty" json:"etag,omitempty" yaml:"etag,omitempty"`
+}
+
+// Manifest maps archive file names to their entries.
+type Manifest map[string]Entry
+
+// Names returns the names of the archives in the manifest, sorted.
+func (m Manifest) Names() []string {
+	out := make([]string, 0, len(m))
+	for name := range m {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// ParseSHA256SUMS reads a manifest in the format of the sha256sum
+// command's output: one "<checksum>  <name>" line per file.
+func ParseSHA256SUMS(r io.Reader) (Manifest, error) {
+	out := Manifest{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, errors.Errorf("line %d is not a valid checksum entry: '%s'", line, text)
+		}
+
+		// sha256sum marks files read in binary mode with a '*'
+		name := path.Base(strings.TrimPrefix(fields[1], "*"))
+		out[name] = Entry{Name: name, Size: -1, SHA256: strings.ToLower(fields[0])}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "problem reading checksums")
+	}
+
+	return out, nil
+}
+
+type s3Listing struct {
+	Contents []struct {
+		Key  string
+		ETag string
+		Size int64
+	}
+}
+
+// ParseS3Listing reads a manifest from the XML response to an S3
+// ListObjects request. Entries are named by the base name of their
+// keys.
+func ParseS3Listing(r io.Reader) (Manifest, error) {
+	listing := s3Listing{}
+	if err := xml.NewDecoder(r).Decode(&listing); err != nil {
+		return nil, errors.Wrap(err, "problem parsing bucket listing")
+	}
+
+	out := Manifest{}
+	for _, obj := range listing.Contents {
+		if strings.HasSuffix(obj.Key, "/") {
+			continue
+		}
+
+		name := path.Base(obj.Key)
+		out[name] = Entry{Name: name, Size: obj.Size, ETag: strings.Trim(obj.ETag, `"`)}
+	}
+
+	return out, nil
+}
+
+// ParseManifest parses a manifest in any of the formats that the
+// package reads: a JSON list of entries, as WriteManifest writes, an
+// S3 bucket listing, or a SHA256SUMS file.
+func ParseManifest(data []byte) (Manifest, error) {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		entries := []Entry{}
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return nil, errors.Wrap(err, "problem parsing manifest")
+		}
+
+		out := Manifest{}
+		for _, entry := range entries {
+			if entry.Name == "" {
+				return nil, errors.New("manifest has an entry without a name")
+			}
+			out[entry.Name] = entry
+		}
+		return out, nil
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		return ParseS3Listing(bytes.NewReader(data))
+	default:
+		return ParseSHA256SUMS(bytes.NewReader(data))
+	}
+}
+
+// ReadManifestFile reads and parses a manifest file, such as one that
+// another machine wrote of its cache.
+func ReadManifestFile(fn string) (Manifest, error) {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading manifest %s", fn)
+	}
+
+	m, err := ParseManifest(data)
+	return m, errors.Wrapf(err, "problem reading manifest %s", fn)
+}
+
+// WriteManifest writes the manifest as a JSON list of its entries, in
+// name order, which ParseManifest reads.
+func WriteManifest(w io.Writer, m Manifest) error {
+	entries := make([]Entry, 0, len(m))
+	for _, name := range m.Names() {
+		entries = append(entries, m[name])
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(entries), "problem writing manifest")
+}
+
+// FetchManifest downloads and parses a manifest, which may be a
+// SHA256SUMS file, an S3 bucket listing, or a JSON manifest.
+func FetchManifest(ctx context.Context, url string) (Manifest, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem building request for %s", url)
+	}
+
+	client := bond.GetHTTPClient()
+	defer bond.PutHTTPClient(client)
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem fetching manifest from %s", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("encountered error %d (%s) for %s", resp.StatusCode, resp.Status, url)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading manifest from %s", url)
+	}
+
+	return ParseManifest(data)
+}
+
+// IsArchive reports whether the file name has the extension of a
+// MongoDB build archive.
+func IsArchive(name string) bool {
+	for _, ext := range []string{".tgz", ".tar.gz", ".zip", ".msi"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LocalManifest computes the manifest of the archives in a cache
+// directory. Directories (i.e. extracted builds) and other files are
+// not included.
+func LocalManifest(dir string) (Manifest, error) {
+	contents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading contents of %s", dir)
+	}
+
+	out := Manifest{}
+	for _, info := range contents {
+		if !info.Mode().IsRegular() || !IsArchive(info.Name()) {
+			continue
+		}
+
+		entry, err := fileEntry(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		out[entry.Name] = entry
+	}
+
+	return out, nil
+}
+
+func fileEntry(fn string) (Entry, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return Entry{}, errors.Wrapf(err, "problem opening %s", fn)
+	}
+	defer f.Close()
+
+	sha, sum := sha256.New(), md5.New()
+	size, err := io.Copy(io.MultiWriter(sha, sum), f)
+	if err != nil {
+		return Entry{}, errors.Wrapf(err, "problem computing checksums of %s", fn)
+	}
+
+	return Entry{
+		Name:   filepath.Base(fn),
+		Size:   size,
+		SHA256: hex.EncodeToString(sha.Sum(nil)),
+		ETag:   hex.EncodeToString(sum.Sum(nil)),
+	}, nil
+}
+
+// Matches reports whether the local entry has the same contents as
+// the remote entry, using the strongest checksum the remote has: its
+// SHA256 checksum if known, then its ETag (unless the object was
+// uploaded in parts, which gives it an ETag that is not an MD5
+// checksum), and otherwise its size.
+func (e Entry) Matches(remote Entry) bool {
+	switch {
+	case remote.SHA256 != "":
+		return strings.EqualFold(e.SHA256, remote.SHA256)
+	case remote.ETag != "" && !strings.Contains(remote.ETag, "-"):
+		return strings.EqualFold(e.ETag, remote.ETag)
+	default:
+		return remote.Size >= 0 && e.Size == remote.Size
+	}
+}
@@ -0,0 +1,145 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	// sha256 and md5 checksums of "hello"
+	helloSHA256 = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	helloMD5    = "5d41402abc4b2a76b9719d911017c592"
+)
+
+const testListing = `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Name>downloads</Name>
+  <Contents><Key>linux/a.tgz</Key><ETag>"5d41402abc4b2a76b9719d911017c592"</ETag><Size>5</Size></Contents>
+  <Contents><Key>linux/b.tgz</Key><ETag>"0123abcd-2"</ETag><Size>10</Size></Contents>
+  <Contents><Key>linux/</Key><ETag>"x"</ETag><Size>0</Size></Contents>
+</ListBucketResult>`
+
+func TestParseSHA256SUMS(t *testing.T) {
+	assert := assert.New(t)
+
+	m, err := ParseSHA256SUMS(strings.NewReader(fmt.Sprintf("# checksums\n%s  a.tgz\n\n%s *linux/b.zip\n",
+		helloSHA256, strings.ToUpper(helloSHA256))))
+	require.NoError(t, err)
+	assert.Equal([]string{"a.tgz", "b.zip"}, m.Names())
+	assert.Equal(helloSHA256, m["b.zip"].SHA256)
+	assert.Equal(int64(-1), m["a.tgz"].Size)
+
+	_, err = ParseSHA256SUMS(strings.NewReader("abc a.tgz\n"))
+	assert.Error(err)
+}
+
+func TestParseS3Listing(t *testing.T) {
+	assert := assert.New(t)
+
+	m, err := ParseS3Listing(strings.NewReader(testListing))
+	require.NoError(t, err)
+	assert.Equal([]string{"a.tgz", "b.tgz"}, m.Names())
+	assert.Equal(helloMD5, m["a.tgz"].ETag)
+	assert.Equal(int64(10), m["b.tgz"].Size)
+
+	_, err = ParseS3Listing(strings.NewReader("not xml"))
+	assert.Error(err)
+}
+
+func TestFetchManifestDetectsFormat(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bucket", func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, testListing) })
+	mux.HandleFunc("/SHA256SUMS", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  a.tgz\n", helloSHA256)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	m, err := FetchManifest(ctx, srv.URL+"/bucket")
+	require.NoError(t, err)
+	assert.Len(m, 2)
+
+	m, err = FetchManifest(ctx, srv.URL+"/SHA256SUMS")
+	require.NoError(t, err)
+	assert.Equal(helloSHA256, m["a.tgz"].SHA256)
+
+	_, err = FetchManifest(ctx, srv.URL+"/missing")
+	assert.Error(err)
+}
+
+func TestLocalManifest(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-mirror")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.tgz"), []byte("hello"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "full.json"), []byte("{}"), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "mongodb-linux-x86_64-4.0.1"), 0755))
+
+	m, err := LocalManifest(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.tgz"}, m.Names())
+	assert.Equal(Entry{Name: "a.tgz", Size: 5, SHA256: helloSHA256, ETag: helloMD5}, m["a.tgz"])
+}
+
+func TestEntryMatches(t *testing.T) {
+	assert := assert.New(t)
+	local := Entry{Name: "a.tgz", Size: 5, SHA256: helloSHA256, ETag: helloMD5}
+
+	assert.True(local.Matches(Entry{SHA256: strings.ToUpper(helloSHA256), Size: -1}))
+	assert.False(local.Matches(Entry{SHA256: helloMD5, Size: 5, ETag: helloMD5}))
+	assert.True(local.Matches(Entry{ETag: helloMD5, Size: 5}))
+	assert.False(local.Matches(Entry{ETag: "0123abcd", Size: 5}))
+	assert.True(local.Matches(Entry{ETag: "0123abcd-2", Size: 5}))
+	assert.False(local.Matches(Entry{ETag: "0123abcd-2", Size: 6}))
+	assert.False(local.Matches(Entry{Size: -1}))
+}
+
+func TestManifestFileRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-mirror")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := Manifest{
+		"a.tgz": {Name: "a.tgz", Size: 5, SHA256: helloSHA256, ETag: helloMD5},
+		"b.zip": {Name: "b.zip", Size: 7},
+	}
+	fn := filepath.Join(dir, "manifest.json")
+	f, err := os.Create(fn)
+	require.NoError(t, err)
+	require.NoError(t, WriteManifest(f, m))
+	require.NoError(t, f.Close())
+
+	out, err := ReadManifestFile(fn)
+	require.NoError(t, err)
+	assert.Equal(m, out)
+
+	require.NoError(t, ioutil.WriteFile(fn, []byte(helloSHA256+"  a.tgz\n"), 0644))
+	out, err = ReadManifestFile(fn)
+	require.NoError(t, err)
+	assert.Equal([]string{"a.tgz"}, out.Names())
+
+	_, err = ParseManifest([]byte(`[{"size": 5}]`))
+	assert.Error(err)
+	_, err = ReadManifestFile(filepath.Join(dir, "missing.json"))
+	assert.Error(err)
+}
@@ -0,0 +1,383 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+)
+
+// Peer is another cache that a cache reconciles with, which it writes
+// archives to and reads archives from.
+type Peer interface {
+	Uploader
+	Open(ctx context.Context, name string) (io.ReadCloser, error)
+}
+
+// DirectoryPeer is a Peer for a cache in a local (or mounted)
+// directory.
+type DirectoryPeer struct {
+	Path string
+}
+
+// Upload writes the archive to the peer's directory.
+func (p DirectoryPeer) Upload(ctx context.Context, name string, r io.Reader, size int64) error {
+	return DirectoryUploader{Path: p.Path}.Upload(ctx, name, r, size)
+}
+
+// Open opens the archive in the peer's directory.
+func (p DirectoryPeer) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	fn := filepath.Join(p.Path, name)
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem opening %s", fn)
+	}
+
+	return f, nil
+}
+
+// HTTPPeer is a Peer for a cache that serves its archives from a base
+// URL, and accepts archives PUT to it.
+type HTTPPeer struct {
+	BaseURL string
+	// Header is added to every request, e.g. for authorization.
+	Header http.Header
+}
+
+// Upload PUTs the archive to the base URL joined with its name.
+func (p HTTPPeer) Upload(ctx context.Context, name string, r io.Reader, size int64) error {
+	return HTTPUploader{BaseURL: p.BaseURL, Header: p.Header}.Upload(ctx, name, r, size)
+}
+
+// Open GETs the archive from the base URL joined with its name.
+func (p HTTPPeer) Open(ctx context.Context, name string) (io.ReadCloser, error) {
+	url := strings.TrimSuffix(p.BaseURL, "/") + "/" + name
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem building request for %s", url)
+	}
+	for k, v := range p.Header {
+		req.Header[k] = v
+	}
+
+	client := bond.GetHTTPClient()
+	defer bond.PutHTTPClient(client)
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem downloading %s", url)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("encountered error %d (%s) downloading %s", resp.StatusCode, resp.Status, url)
+	}
+
+	return resp.Body, nil
+}
+
+// Conflict describes an archive that both caches have, with different
+// contents.
+type Conflict struct {
+	Name   string `bson:"name" json:"name" yaml:"name"`
+	Local  Entry  `bson:"local" json:"local" yaml:"local"`
+	Remote Entry  `bson:"remote" json:"remote" yaml:"remote"`
+}
+
+// Plan lists the archives to copy in each direction to bring two
+// caches into agreement.
+type Plan struct {
+	// Push are the local archives to copy to the remote cache.
+	Push []Change `bson:"push" json:"push" yaml:"push"`
+	// Pull are the remote archives to copy to the local cache.
+	Pull []Change `bson:"pull" json:"pull" yaml:"pull"`
+	// Conflicts are the archives that differ between the caches,
+	// which are copied only in the direction that the caller
+	// prefers.
+	Conflicts []Conflict `bson:"conflicts" json:"conflicts" yaml:"conflicts"`
+	Unchanged []Entry    `bson:"unchanged" json:"unchanged" yaml:"unchanged"`
+}
+
+// Diff compares the manifests of two caches, returning the archives
+// that only one of them has, which are copied to the other, and those
+// that they both have with different contents, in name order.
+func Diff(local, remote Manifest) *Plan {
+	plan := &Plan{Push: []Change{}, Pull: []Change{}, Conflicts: []Conflict{}, Unchanged: []Entry{}}
+
+	for _, name := range local.Names() {
+		entry := local[name]
+		other, ok := remote[name]
+		switch {
+		case !ok:
+			plan.Push = append(plan.Push, Change{Entry: entry, Reason: Missing})
+		case !entry.Matches(other):
+			plan.Conflicts = append(plan.Conflicts, Conflict{Name: name, Local: entry, Remote: other})
+		default:
+			plan.Unchanged = append(plan.Unchanged, entry)
+		}
+	}
+
+	for _, name := range remote.Names() {
+		if _, ok := local[name]; !ok {
+			plan.Pull = append(plan.Pull, Change{Entry: remote[name], Reason: Missing})
+		}
+	}
+
+	return plan
+}
+
+// The sides that a reconcile can prefer for conflicting archives.
+const (
+	PreferLocal  = "local"
+	PreferRemote = "remote"
+)
+
+// Resolve moves the conflicts to the archives to push, if the
+// preference is PreferLocal, or to pull, if it's PreferRemote. With
+// no preference the plan is unchanged.
+func (p *Plan) Resolve(prefer string) {
+	if prefer == "" {
+		return
+	}
+
+	for _, c := range p.Conflicts {
+		if prefer == PreferLocal {
+			p.Push = append(p.Push, Change{Entry: c.Local, Reason: Changed})
+		} else {
+			p.Pull = append(p.Pull, Change{Entry: c.Remote, Reason: Changed})
+		}
+	}
+	p.Conflicts = []Conflict{}
+}
+
+// ReconcileOptions configures a reconcile of a local cache with a
+// peer.
+type ReconcileOptions struct {
+	// Path is the local cache directory.
+	Path string
+	// Remote is the manifest of the peer's cache.
+	Remote Manifest
+	// Peer transfers archives to and from the other cache. It is
+	// not required for a dry run.
+	Peer Peer
+	// Prefer resolves conflicts in favor of the local or remote
+	// archives. By default, conflicts are reported and neither
+	// copy is replaced.
+	Prefer string
+	// DryRun reports the plan without copying anything.
+	DryRun bool
+	// Sample, if between zero and one, trades the immediate
+	// verification of pulls for throughput, for very large
+	// reconciles: only this fraction of the archives that the
+	// local cache is missing, and every archive that replaces a
+	// changed local copy, are verified against their checksums,
+	// and the rest are only checked by size and reported as
+	// deferred. By default, every pull is fully verified.
+	Sample float64
+	// Queue, if specified, runs a VerifyJob that completes the
+	// verification of the deferred archives.
+	Queue amboy.Queue
+}
+
+// Validate returns an error if the options are incomplete.
+func (o ReconcileOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(o.Path == "", "must specify a local path")
+	catcher.NewWhen(o.Remote == nil, "must specify a remote manifest")
+	catcher.NewWhen(o.Peer == nil && !o.DryRun, "must specify a peer")
+	catcher.ErrorfWhen(o.Prefer != "" && o.Prefer != PreferLocal && o.Prefer != PreferRemote,
+		"preference '%s' must be '%s' or '%s'", o.Prefer, PreferLocal, PreferRemote)
+	catcher.NewWhen(o.Sample < 0 || o.Sample > 1, "verification sample must be between 0 and 1")
+	return catcher.Resolve()
+}
+
+// ReconcileReport summarizes a reconcile.
+type ReconcileReport struct {
+	Pushed    []Change   `bson:"pushed" json:"pushed" yaml:"pushed"`
+	Pulled    []Change   `bson:"pulled" json:"pulled" yaml:"pulled"`
+	Failed    []Change   `bson:"failed" json:"failed" yaml:"failed"`
+	Conflicts []Conflict `bson:"conflicts" json:"conflicts" yaml:"conflicts"`
+	Unchanged []Entry    `bson:"unchanged" json:"unchanged" yaml:"unchanged"`
+	// Deferred are the pulled archives that were only checked by
+	// size, for a sampled reconcile, and VerifyJob is the ID of
+	// the job that verifies them, if the reconcile queued one.
+	Deferred  []Entry `bson:"deferred,omitempty" json:"deferred,omitempty" yaml:"deferred,omitempty"`
+	VerifyJob string  `bson:"verify_job,omitempty" json:"verify_job,omitempty" yaml:"verify_job,omitempty"`
+	// BytesPushed and BytesPulled count the archives transferred
+	// (or, for a dry run, that would have been transferred).
+	BytesPushed int64 `bson:"bytes_pushed" json:"bytes_pushed" yaml:"bytes_pushed"`
+	BytesPulled int64 `bson:"bytes_pulled" json:"bytes_pulled" yaml:"bytes_pulled"`
+	DryRun      bool  `bson:"dry_run" json:"dry_run" yaml:"dry_run"`
+}
+
+func (r *ReconcileReport) String() string {
+	push, pull := "pushed", "pulled"
+	if r.DryRun {
+		push, pull = "would push", "would pull"
+	}
+
+	out := fmt.Sprintf("%s %d archives (%d bytes), %s %d archives (%d bytes), %d unchanged, %d conflicting, %d failed",
+		push, len(r.Pushed), r.BytesPushed, pull, len(r.Pulled), r.BytesPulled,
+		len(r.Unchanged), len(r.Conflicts), len(r.Failed))
+	if len(r.Deferred) > 0 {
+		out += fmt.Sprintf(", %d checked by size only", len(r.Deferred))
+	}
+
+	return out
+}
+
+// Reconcile copies the archives that only the local cache has to the
+// peer, and those that only the peer has to the local cache, so that
+// each cache has every archive, as rsync does in both directions.
+// Archives that differ between the caches are copied only if the
+// options prefer one side. Reconcile attempts every copy, and returns
+// an error describing the copies that failed along with a report that
+// includes them. For sampled reconciles, the verification of the
+// deferred archives is queued once every copy is attempted.
+func Reconcile(ctx context.Context, opts ReconcileOptions) (*ReconcileReport, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid reconcile options")
+	}
+
+	local, err := LocalManifest(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := Diff(local, opts.Remote)
+	plan.Resolve(opts.Prefer)
+	report := &ReconcileReport{Conflicts: plan.Conflicts, Unchanged: plan.Unchanged, DryRun: opts.DryRun}
+
+	catcher := grip.NewBasicCatcher()
+	for _, change := range plan.Push {
+		if ctx.Err() != nil {
+			catcher.Add(ctx.Err())
+			return report, catcher.Resolve()
+		}
+
+		if !opts.DryRun {
+			if err := upload(ctx, opts.Path, opts.Peer, change.Entry); err != nil {
+				catcher.Add(err)
+				report.Failed = append(report.Failed, change)
+				continue
+			}
+		}
+
+		logTransfer("pushed archive to peer", change, opts.DryRun)
+		report.Pushed = append(report.Pushed, change)
+		report.BytesPushed += change.Entry.Size
+	}
+
+	for _, change := range plan.Pull {
+		if ctx.Err() != nil {
+			catcher.Add(ctx.Err())
+			return report, catcher.Resolve()
+		}
+
+		full := fullyVerified(opts.Sample, change)
+		if !opts.DryRun {
+			if err := pull(ctx, opts, change.Entry, full); err != nil {
+				catcher.Add(err)
+				report.Failed = append(report.Failed, change)
+				continue
+			}
+		}
+		if !full {
+			report.Deferred = append(report.Deferred, change.Entry)
+		}
+
+		logTransfer("pulled archive from peer", change, opts.DryRun)
+		report.Pulled = append(report.Pulled, change)
+		// SHA256SUMS manifests have no sizes
+		if change.Entry.Size > 0 {
+			report.BytesPulled += change.Entry.Size
+		}
+	}
+
+	if opts.Queue != nil && !opts.DryRun && len(report.Deferred) > 0 {
+		j := NewVerifyJob(opts.Path, report.Deferred)
+		if err := opts.Queue.Put(ctx, j); err != nil {
+			catcher.Add(errors.Wrap(err, "problem queuing verification of deferred archives"))
+		} else {
+			report.VerifyJob = j.ID()
+		}
+	}
+
+	return report, catcher.Resolve()
+}
+
+// fullyVerified reports whether a pull of the sampled reconcile is
+// verified against its checksums: archives without sizes (e.g. from
+// SHA256SUMS manifests) can't be checked by size, so they're always
+// verified.
+func fullyVerified(sample float64, change Change) bool {
+	switch {
+	case sample <= 0 || sample >= 1:
+		return true
+	case change.Reason == Changed || change.Entry.Size < 0:
+		return true
+	default:
+		return sampled(change.Entry.Name, sample)
+	}
+}
+
+func logTransfer(msg string, change Change, dryRun bool) {
+	grip.Info(message.Fields{
+		"message": msg,
+		"name":    change.Entry.Name,
+		"reason":  change.Reason,
+		"size":    change.Entry.Size,
+		"dry_run": dryRun,
+	})
+}
+
+// pull copies an archive from the peer to a temporary file in the
+// local cache, and renames it into place once its contents match the
+// peer's manifest (or, unless full, only its size), so that a failed
+// copy never replaces an archive.
+func pull(ctx context.Context, opts ReconcileOptions, entry Entry, full bool) error {
+	r, err := opts.Peer.Open(ctx, entry.Name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	fn := filepath.Join(opts.Path, entry.Name)
+	tmp := fn + ".partial"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return errors.Wrapf(err, "problem creating %s", tmp)
+	}
+
+	_, err = io.Copy(f, &contextReader{ctx: ctx, r: r})
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(errors.Wrapf(err, "problem writing %s", tmp))
+	catcher.Add(errors.Wrapf(f.Close(), "problem closing %s", tmp))
+	switch {
+	case catcher.HasErrors():
+	case full:
+		got, err := fileEntry(tmp)
+		catcher.Add(err)
+		catcher.ErrorfWhen(err == nil && !got.Matches(entry), "copy of %s does not match the peer's manifest", entry.Name)
+	default:
+		info, err := os.Stat(tmp)
+		catcher.Add(errors.Wrapf(err, "problem checking size of %s", tmp))
+		catcher.ErrorfWhen(err == nil && info.Size() != entry.Size, "copy of %s does not match the peer's manifest", entry.Name)
+	}
+	if catcher.HasErrors() {
+		grip.Warning(os.Remove(tmp))
+		return catcher.Resolve()
+	}
+
+	return errors.Wrapf(os.Rename(tmp, fn), "problem moving %s into place", fn)
+}
@@ -0,0 +1,223 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	assert := assert.New(t)
+
+	local := Manifest{
+		"a.tgz": {Name: "a.tgz", Size: 5, SHA256: helloSHA256},
+		"b.tgz": {Name: "b.tgz", Size: 7, SHA256: "local"},
+		"c.zip": {Name: "c.zip", Size: 11},
+	}
+	remote := Manifest{
+		"a.tgz": {Name: "a.tgz", Size: 5, SHA256: helloSHA256},
+		"b.tgz": {Name: "b.tgz", Size: 5, SHA256: helloSHA256},
+		"d.zip": {Name: "d.zip", Size: 1},
+	}
+
+	plan := Diff(local, remote)
+	require.Len(t, plan.Push, 1)
+	assert.Equal("c.zip", plan.Push[0].Entry.Name)
+	require.Len(t, plan.Pull, 1)
+	assert.Equal("d.zip", plan.Pull[0].Entry.Name)
+	require.Len(t, plan.Conflicts, 1)
+	assert.Equal("b.tgz", plan.Conflicts[0].Name)
+	require.Len(t, plan.Unchanged, 1)
+
+	plan.Resolve(PreferRemote)
+	assert.Len(plan.Conflicts, 0)
+	require.Len(t, plan.Pull, 2)
+	assert.Equal(Changed, plan.Pull[1].Reason)
+	assert.Equal(int64(5), plan.Pull[1].Entry.Size)
+}
+
+func TestReconcileOptionsValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(ReconcileOptions{}.Validate())
+	assert.Error(ReconcileOptions{Path: "x", Remote: Manifest{}}.Validate())
+	assert.Error(ReconcileOptions{Path: "x", Remote: Manifest{}, DryRun: true, Prefer: "newest"}.Validate())
+	assert.NoError(ReconcileOptions{Path: "x", Remote: Manifest{}, DryRun: true}.Validate())
+	assert.NoError(ReconcileOptions{Path: "x", Remote: Manifest{}, Peer: DirectoryPeer{}, Prefer: PreferLocal}.Validate())
+}
+
+func TestReconcileDirectories(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir := newSyncTestCache(t)
+	defer os.RemoveAll(dir)
+	peerDir, err := ioutil.TempDir("", "bond-mirror-peer")
+	require.NoError(t, err)
+	defer os.RemoveAll(peerDir)
+
+	for name, data := range map[string]string{
+		"a.tgz": "hello",
+		"b.tgz": "hello",
+		"d.tgz": "lab only",
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(peerDir, name), []byte(data), 0644))
+	}
+
+	remote, err := LocalManifest(peerDir)
+	require.NoError(t, err)
+	opts := ReconcileOptions{Path: dir, Remote: remote, Peer: DirectoryPeer{Path: peerDir}, DryRun: true}
+	report, err := Reconcile(ctx, opts)
+	require.NoError(t, err)
+	assert.Len(report.Pushed, 1)
+	assert.Len(report.Pulled, 1)
+	assert.Len(report.Conflicts, 1)
+	assert.Equal(int64(len("lab only")), report.BytesPulled)
+	assert.True(strings.HasPrefix(report.String(), "would push 1 archives"))
+	_, err = os.Stat(filepath.Join(dir, "d.tgz"))
+	assert.True(os.IsNotExist(err))
+
+	opts.DryRun = false
+	report, err = Reconcile(ctx, opts)
+	require.NoError(t, err)
+	assert.Len(report.Failed, 0)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "d.tgz"))
+	require.NoError(t, err)
+	assert.Equal("lab only", string(data))
+	data, err = ioutil.ReadFile(filepath.Join(peerDir, "c.zip"))
+	require.NoError(t, err)
+	assert.Equal("new archive", string(data))
+
+	// conflicts are left alone, unless one side is preferred
+	data, err = ioutil.ReadFile(filepath.Join(dir, "b.tgz"))
+	require.NoError(t, err)
+	assert.Equal("changed", string(data))
+
+	opts.Remote, err = LocalManifest(peerDir)
+	require.NoError(t, err)
+	opts.Prefer = PreferRemote
+	report, err = Reconcile(ctx, opts)
+	require.NoError(t, err)
+	require.Len(t, report.Pulled, 1)
+	assert.Equal("b.tgz", report.Pulled[0].Entry.Name)
+	assert.Len(report.Unchanged, 3)
+
+	data, err = ioutil.ReadFile(filepath.Join(dir, "b.tgz"))
+	require.NoError(t, err)
+	assert.Equal("hello", string(data))
+}
+
+func TestReconcileRejectsMismatchedPulls(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "bond-mirror")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte("corrupt"))
+	}))
+	defer srv.Close()
+
+	report, err := Reconcile(ctx, ReconcileOptions{
+		Path:   dir,
+		Remote: Manifest{"a.tgz": {Name: "a.tgz", Size: -1, SHA256: helloSHA256}},
+		Peer:   HTTPPeer{BaseURL: srv.URL, Header: http.Header{"X-Token": []string{"secret"}}},
+	})
+	require.Error(t, err)
+	assert.Contains(err.Error(), "does not match")
+	require.Len(t, report.Failed, 1)
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(files, 0)
+}
+
+func TestReconcileSamplesVerification(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "bond-mirror")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	peerDir, err := ioutil.TempDir("", "bond-mirror-peer")
+	require.NoError(t, err)
+	defer os.RemoveAll(peerDir)
+
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("build-%d.tgz", i)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(peerDir, name), []byte(name), 0644))
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "build-0.tgz"), []byte("changed"), 0644))
+
+	q := queue.NewLocalLimitedSize(1, 16)
+	require.NoError(t, q.Start(ctx))
+
+	remote, err := LocalManifest(peerDir)
+	require.NoError(t, err)
+	opts := ReconcileOptions{Path: dir, Remote: remote, Peer: DirectoryPeer{Path: peerDir}, Prefer: PreferRemote, Sample: 0.5, Queue: q}
+	assert.Error(ReconcileOptions{Path: dir, Remote: remote, DryRun: true, Sample: 2}.Validate())
+
+	report, err := Reconcile(ctx, opts)
+	require.NoError(t, err)
+	assert.Len(report.Pulled, 20)
+	assert.True(len(report.Deferred) > 0 && len(report.Deferred) < 19, "%d deferred", len(report.Deferred))
+	for _, entry := range report.Deferred {
+		// changed archives are always verified
+		assert.NotEqual("build-0.tgz", entry.Name)
+		assert.False(sampled(entry.Name, opts.Sample), entry.Name)
+	}
+	assert.Contains(report.String(), "checked by size only")
+
+	require.NotEqual(t, "", report.VerifyJob)
+	j, ok := q.Get(ctx, report.VerifyJob)
+	require.True(t, ok)
+	require.True(t, amboy.WaitJobInterval(ctx, j, q, 10*time.Millisecond))
+	assert.NoError(j.Error())
+}
+
+func TestVerifyJobRemovesMismatchedArchives(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-mirror")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.tgz"), []byte("hello"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "b.tgz"), []byte("jello"), 0644))
+
+	j := NewVerifyJob(dir, []Entry{
+		{Name: "a.tgz", Size: 5, SHA256: helloSHA256},
+		{Name: "b.tgz", Size: 5, SHA256: helloSHA256},
+	})
+	j.Run(context.Background())
+	require.Error(t, j.Error())
+	assert.Contains(j.Error().Error(), "b.tgz does not match")
+	assert.Equal([]string{"b.tgz"}, j.Removed)
+
+	_, err = os.Stat(filepath.Join(dir, "a.tgz"))
+	assert.NoError(err)
+	_, err = os.Stat(filepath.Join(dir, "b.tgz"))
+	assert.True(os.IsNotExist(err))
+}
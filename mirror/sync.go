@@ -0,0 +1,249 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+)
+
+// Uploader writes archives to a mirror.
+type Uploader interface {
+	Upload(ctx context.Context, name string, r io.Reader, size int64) error
+}
+
+// DirectoryUploader is an Uploader for a mirror in a local (or
+// mounted) directory.
+type DirectoryUploader struct {
+	Path string
+}
+
+// Upload writes the archive to a temporary file in the directory, and
+// renames it into place once it's complete.
+func (u DirectoryUploader) Upload(ctx context.Context, name string, r io.Reader, size int64) error {
+	if err := os.MkdirAll(u.Path, 0755); err != nil {
+		return errors.Wrapf(err, "problem creating mirror directory %s", u.Path)
+	}
+
+	fn := filepath.Join(u.Path, name)
+	tmp := fn + ".partial"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return errors.Wrapf(err, "problem creating %s", tmp)
+	}
+
+	// stop promptly, and remove the temporary file, if the sync
+	// is cancelled.
+	_, err = io.Copy(f, &contextReader{ctx: ctx, r: r})
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(errors.Wrapf(err, "problem writing %s", tmp))
+	catcher.Add(errors.Wrapf(f.Close(), "problem closing %s", tmp))
+	if catcher.HasErrors() {
+		grip.Warning(os.Remove(tmp))
+		return catcher.Resolve()
+	}
+
+	return errors.Wrapf(os.Rename(tmp, fn), "problem moving %s into place", fn)
+}
+
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.r.Read(p)
+}
+
+// HTTPUploader is an Uploader that PUTs archives to a base URL, as
+// for an S3 bucket that accepts unsigned (or pre-authorized) writes.
+type HTTPUploader struct {
+	BaseURL string
+	// Header is added to every request, e.g. for authorization.
+	Header http.Header
+}
+
+// Upload PUTs the archive to the base URL joined with its name.
+func (u HTTPUploader) Upload(ctx context.Context, name string, r io.Reader, size int64) error {
+	url := strings.TrimSuffix(u.BaseURL, "/") + "/" + name
+	req, err := http.NewRequest(http.MethodPut, url, r)
+	if err != nil {
+		return errors.Wrapf(err, "problem building request for %s", url)
+	}
+	req.ContentLength = size
+	for k, v := range u.Header {
+		req.Header[k] = v
+	}
+
+	client := bond.GetHTTPClient()
+	defer bond.PutHTTPClient(client)
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "problem uploading %s", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("encountered error %d (%s) uploading %s", resp.StatusCode, resp.Status, url)
+	}
+
+	return nil
+}
+
+// Change describes an archive that the mirror does not have, or whose
+// contents differ from the local archive.
+type Change struct {
+	Entry  Entry  `bson:"entry" json:"entry" yaml:"entry"`
+	Reason string `bson:"reason" json:"reason" yaml:"reason"`
+}
+
+// The reasons for a Change.
+const (
+	Missing = "missing"
+	Changed = "changed"
+)
+
+// Compare returns the local archives that must be transferred for the
+// remote manifest to match, in name order, and the local archives
+// that already match the remote.
+func Compare(local, remote Manifest) ([]Change, []Entry) {
+	changes := []Change{}
+	unchanged := []Entry{}
+
+	for _, name := range local.Names() {
+		entry := local[name]
+		other, ok := remote[name]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Entry: entry, Reason: Missing})
+		case !entry.Matches(other):
+			changes = append(changes, Change{Entry: entry, Reason: Changed})
+		default:
+			unchanged = append(unchanged, entry)
+		}
+	}
+
+	return changes, unchanged
+}
+
+// SyncOptions configures a mirror sync.
+type SyncOptions struct {
+	// Path is the local cache directory.
+	Path string
+	// Remote is the mirror's current manifest.
+	Remote Manifest
+	// Uploader writes archives to the mirror. It is not required
+	// for a dry run.
+	Uploader Uploader
+	// DryRun reports the changes without uploading anything.
+	DryRun bool
+}
+
+// Validate returns an error if the options are incomplete.
+func (o SyncOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(o.Path == "", "must specify a local path")
+	catcher.NewWhen(o.Remote == nil, "must specify a remote manifest")
+	catcher.NewWhen(o.Uploader == nil && !o.DryRun, "must specify an uploader")
+	return catcher.Resolve()
+}
+
+// SyncReport summarizes a mirror sync.
+type SyncReport struct {
+	Uploaded  []Change `bson:"uploaded" json:"uploaded" yaml:"uploaded"`
+	Failed    []Change `bson:"failed" json:"failed" yaml:"failed"`
+	Unchanged []Entry  `bson:"unchanged" json:"unchanged" yaml:"unchanged"`
+	// BytesUploaded counts the archives transferred (or, for a
+	// dry run, that would have been transferred).
+	BytesUploaded int64 `bson:"bytes_uploaded" json:"bytes_uploaded" yaml:"bytes_uploaded"`
+	// BytesSaved counts the archives that were not transferred
+	// because the mirror already had them.
+	BytesSaved int64 `bson:"bytes_saved" json:"bytes_saved" yaml:"bytes_saved"`
+	DryRun     bool  `bson:"dry_run" json:"dry_run" yaml:"dry_run"`
+}
+
+func (r *SyncReport) String() string {
+	verb := "uploaded"
+	if r.DryRun {
+		verb = "would upload"
+	}
+
+	return fmt.Sprintf("%s %d archives (%d bytes), skipped %d unchanged archives (%d bytes saved), %d failed",
+		verb, len(r.Uploaded), r.BytesUploaded, len(r.Unchanged), r.BytesSaved, len(r.Failed))
+}
+
+// Sync uploads the archives in the local cache that are missing from
+// the mirror or differ from the mirror's copies. Sync attempts every
+// upload, and returns an error describing the uploads that failed
+// along with a report that includes them.
+func Sync(ctx context.Context, opts SyncOptions) (*SyncReport, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid sync options")
+	}
+
+	local, err := LocalManifest(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, unchanged := Compare(local, opts.Remote)
+	report := &SyncReport{Unchanged: unchanged, DryRun: opts.DryRun}
+	for _, entry := range unchanged {
+		report.BytesSaved += entry.Size
+	}
+
+	catcher := grip.NewBasicCatcher()
+	for _, change := range changes {
+		if ctx.Err() != nil {
+			catcher.Add(ctx.Err())
+			break
+		}
+
+		if !opts.DryRun {
+			if err := upload(ctx, opts.Path, opts.Uploader, change.Entry); err != nil {
+				catcher.Add(err)
+				report.Failed = append(report.Failed, change)
+				continue
+			}
+		}
+
+		grip.Info(message.Fields{
+			"message": "synced archive to mirror",
+			"name":    change.Entry.Name,
+			"reason":  change.Reason,
+			"size":    change.Entry.Size,
+			"dry_run": opts.DryRun,
+		})
+
+		report.Uploaded = append(report.Uploaded, change)
+		report.BytesUploaded += change.Entry.Size
+	}
+
+	return report, catcher.Resolve()
+}
+
+func upload(ctx context.Context, path string, u Uploader, entry Entry) error {
+	fn := filepath.Join(path, entry.Name)
+	f, err := os.Open(fn)
+	if err != nil {
+		return errors.Wrapf(err, "problem opening %s", fn)
+	}
+	defer f.Close()
+
+	return errors.Wrapf(u.Upload(ctx, entry.Name, f, entry.Size),
+		"problem uploading %s", entry.Name)
+}
@@ -0,0 +1,173 @@
+package mirror
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSyncTestCache(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "bond-mirror")
+	require.NoError(t, err)
+
+	for name, data := range map[string]string{
+		"a.tgz": "hello",
+		"b.tgz": "changed",
+		"c.zip": "new archive",
+	} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644))
+	}
+
+	return dir
+}
+
+func TestCompare(t *testing.T) {
+	assert := assert.New(t)
+
+	local := Manifest{
+		"a.tgz": {Name: "a.tgz", Size: 5, ETag: helloMD5},
+		"b.tgz": {Name: "b.tgz", Size: 7},
+		"c.zip": {Name: "c.zip", Size: 11},
+	}
+	remote := Manifest{
+		"a.tgz": {Name: "a.tgz", Size: 5, ETag: helloMD5},
+		"b.tgz": {Name: "b.tgz", Size: 5, ETag: helloMD5},
+		"d.zip": {Name: "d.zip", Size: 1},
+	}
+
+	changes, unchanged := Compare(local, remote)
+	require.Len(t, changes, 2)
+	assert.Equal("b.tgz", changes[0].Entry.Name)
+	assert.Equal(Changed, changes[0].Reason)
+	assert.Equal("c.zip", changes[1].Entry.Name)
+	assert.Equal(Missing, changes[1].Reason)
+	require.Len(t, unchanged, 1)
+	assert.Equal("a.tgz", unchanged[0].Name)
+}
+
+func TestSyncOptionsValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(SyncOptions{}.Validate())
+	assert.Error(SyncOptions{Path: "x", Remote: Manifest{}}.Validate())
+	assert.NoError(SyncOptions{Path: "x", Remote: Manifest{}, DryRun: true}.Validate())
+	assert.NoError(SyncOptions{Path: "x", Remote: Manifest{}, Uploader: DirectoryUploader{}}.Validate())
+}
+
+func TestSyncToDirectory(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir := newSyncTestCache(t)
+	defer os.RemoveAll(dir)
+	mirrorDir, err := ioutil.TempDir("", "bond-mirror-remote")
+	require.NoError(t, err)
+	defer os.RemoveAll(mirrorDir)
+
+	remote := Manifest{
+		"a.tgz": {Name: "a.tgz", Size: -1, SHA256: helloSHA256},
+		"b.tgz": {Name: "b.tgz", Size: -1, SHA256: helloSHA256},
+	}
+
+	opts := SyncOptions{Path: dir, Remote: remote, Uploader: DirectoryUploader{Path: mirrorDir}, DryRun: true}
+	report, err := Sync(ctx, opts)
+	require.NoError(t, err)
+	assert.Len(report.Uploaded, 2)
+	assert.Equal(int64(len("changed")+len("new archive")), report.BytesUploaded)
+	assert.Equal(int64(len("hello")), report.BytesSaved)
+	assert.True(strings.HasPrefix(report.String(), "would upload 2 archives"))
+	files, err := ioutil.ReadDir(mirrorDir)
+	require.NoError(t, err)
+	assert.Len(files, 0)
+
+	opts.DryRun = false
+	report, err = Sync(ctx, opts)
+	require.NoError(t, err)
+	assert.Len(report.Uploaded, 2)
+	assert.Len(report.Failed, 0)
+
+	data, err := ioutil.ReadFile(filepath.Join(mirrorDir, "c.zip"))
+	require.NoError(t, err)
+	assert.Equal("new archive", string(data))
+
+	_, err = os.Stat(filepath.Join(mirrorDir, "a.tgz"))
+	assert.True(os.IsNotExist(err))
+
+	// once synced, the mirror's own manifest matches the cache
+	remote, err = LocalManifest(mirrorDir)
+	require.NoError(t, err)
+	remote["a.tgz"] = Entry{Name: "a.tgz", Size: -1, SHA256: helloSHA256}
+	opts.Remote = remote
+	report, err = Sync(ctx, opts)
+	require.NoError(t, err)
+	assert.Len(report.Uploaded, 0)
+	assert.Len(report.Unchanged, 3)
+}
+
+func TestSyncOverHTTPReportsFailures(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir := newSyncTestCache(t)
+	defer os.RemoveAll(dir)
+
+	mu := sync.Mutex{}
+	uploaded := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, ".zip") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		data, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		uploaded[r.URL.Path] = string(data)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	report, err := Sync(ctx, SyncOptions{
+		Path:     dir,
+		Remote:   Manifest{"a.tgz": {Name: "a.tgz", Size: 5}},
+		Uploader: HTTPUploader{BaseURL: srv.URL + "/mirror/", Header: http.Header{"X-Token": []string{"secret"}}},
+	})
+	assert.Error(err)
+	require.NotNil(t, report)
+	require.Len(t, report.Uploaded, 1)
+	assert.Equal("b.tgz", report.Uploaded[0].Entry.Name)
+	require.Len(t, report.Failed, 1)
+	assert.Equal("c.zip", report.Failed[0].Entry.Name)
+	assert.Equal(map[string]string{"/mirror/b.tgz": "changed"}, uploaded)
+}
+
+func TestDirectoryUploaderStopsWhenCancelled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bond-mirror")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	u := DirectoryUploader{Path: dir}
+	assert.Error(t, u.Upload(ctx, "a.tgz", strings.NewReader("hello"), 5))
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 0)
+}
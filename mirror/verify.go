@@ -0,0 +1,106 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/dependency"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/registry"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+const verifyJobTypeName = "bond-mirror-verify"
+
+func init() {
+	registry.AddJobType(verifyJobTypeName, func() amboy.Job { return makeVerifyJob() })
+}
+
+// VerifyJob fully verifies archives that a sampled reconcile only
+// checked by size (see ReconcileOptions.Sample), so that the
+// verification that the reconcile deferred runs later, in a queue.
+// Archives whose contents do not match their entries are removed
+// from the cache, so that the next reconcile copies them again.
+type VerifyJob struct {
+	Path    string  `bson:"path" json:"path" yaml:"path"`
+	Entries []Entry `bson:"entries" json:"entries" yaml:"entries"`
+	// Removed are the names of the archives that did not match
+	// their entries.
+	Removed   []string `bson:"removed,omitempty" json:"removed,omitempty" yaml:"removed,omitempty"`
+	*job.Base `bson:"metadata" json:"metadata" yaml:"metadata"`
+}
+
+func makeVerifyJob() *VerifyJob {
+	return &VerifyJob{
+		Base: &job.Base{
+			JobType: amboy.JobType{
+				Name:    verifyJobTypeName,
+				Version: 0,
+			},
+		},
+	}
+}
+
+// NewVerifyJob constructs a job that fully verifies the archives of
+// the entries in the cache directory.
+func NewVerifyJob(path string, entries []Entry) *VerifyJob {
+	j := makeVerifyJob()
+	j.SetID(fmt.Sprintf("%s-%s-%d", verifyJobTypeName, filepath.Base(path), job.GetNumber()))
+	j.SetDependency(dependency.NewAlways())
+	j.Path = path
+	j.Entries = entries
+	j.UpdateTimeInfo(amboy.JobTimeInfo{Created: time.Now()})
+
+	return j
+}
+
+// Run computes the checksums of each archive, and removes those that
+// do not match their entries.
+func (j *VerifyJob) Run(ctx context.Context) {
+	defer j.MarkComplete()
+
+	for _, entry := range j.Entries {
+		if ctx.Err() != nil {
+			j.AddError(errors.Wrap(ctx.Err(), "stopped verifying archives"))
+			return
+		}
+
+		fn := filepath.Join(j.Path, entry.Name)
+		got, err := fileEntry(fn)
+		if err != nil {
+			j.AddError(err)
+			continue
+		}
+		if got.Matches(entry) {
+			continue
+		}
+
+		grip.Warning(message.Fields{
+			"message": "removing archive that failed deferred verification",
+			"name":    entry.Name,
+			"path":    j.Path,
+		})
+		j.Removed = append(j.Removed, entry.Name)
+		j.AddError(errors.Errorf("%s does not match the peer's manifest", entry.Name))
+		j.AddError(errors.Wrapf(os.Remove(fn), "problem removing %s", fn))
+	}
+}
+
+// sampled reports whether the archive is in the sample of the rate,
+// which is a fraction between zero and one. The sample is a
+// deterministic function of the archive's name, so that repeated
+// reconciles sample the same archives.
+func sampled(name string, rate float64) bool {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+
+	return float64(h.Sum64())/math.MaxUint64 < rate
+}
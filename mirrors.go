@@ -0,0 +1,346 @@
+package bond
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+// Defaults for the options of a MirrorSelector.
+const (
+	DefaultMirrorProbeInterval = 10 * time.Minute
+	DefaultMirrorProbeTimeout  = 5 * time.Second
+)
+
+// MirrorSelectorOptions configure a MirrorSelector.
+type MirrorSelectorOptions struct {
+	// Mirrors are the base URLs of the mirrors of the download
+	// servers, in the order that they're used until they're
+	// probed.
+	Mirrors []string `bson:"mirrors" json:"mirrors" yaml:"mirrors"`
+	// ProbeInterval is how long the results of probes are used
+	// before the mirrors are probed again, and defaults to
+	// DefaultMirrorProbeInterval.
+	ProbeInterval time.Duration `bson:"probe_interval" json:"probe_interval" yaml:"probe_interval"`
+	// ProbeTimeout limits each probe, and defaults to
+	// DefaultMirrorProbeTimeout. Mirrors that don't respond in
+	// time are unreachable until the next probe.
+	ProbeTimeout time.Duration `bson:"probe_timeout" json:"probe_timeout" yaml:"probe_timeout"`
+	// Client, if specified, makes the probes.
+	Client *http.Client `bson:"-" json:"-" yaml:"-"`
+}
+
+// Validate returns an error if the options are not valid.
+func (o MirrorSelectorOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(len(o.Mirrors) == 0, "must specify at least one mirror")
+	catcher.NewWhen(o.ProbeInterval < 0, "mirror probe interval must not be negative")
+	catcher.NewWhen(o.ProbeTimeout < 0, "mirror probe timeout must not be negative")
+	for _, base := range o.Mirrors {
+		u, err := url.Parse(base)
+		catcher.ErrorfWhen(err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https"),
+			"mirror '%s' is not an http(s) URL", base)
+	}
+
+	return catcher.Resolve()
+}
+
+// MirrorSelector orders several mirrors of the download servers, such
+// as the mirrors of each region of a globally distributed fleet, so
+// that each agent downloads from its nearest mirror that works. The
+// selector probes the mirrors with HEAD requests for the feed, and
+// orders them by their recent failures (of probes and of downloads),
+// and then by the latency of their probes; unreachable mirrors are
+// last. Mirrors are probed when they're first used, and again once
+// the probe interval passes, when the failures of downloads are
+// halved, so that mirrors that recover are used again.
+//
+// Configs with a selector (see WithMirrorSelector) rewrite URLs to
+// the first mirror, and try each mirror in order when a download
+// fails.
+type MirrorSelector struct {
+	client   *http.Client
+	interval time.Duration
+	timeout  time.Duration
+
+	mutex   sync.Mutex
+	mirrors []*mirrorHealth
+	probed  time.Time
+}
+
+type mirrorHealth struct {
+	base      string
+	latency   time.Duration
+	failures  int
+	reachable bool
+}
+
+// MirrorStatus describes a mirror of a selector, as of its last
+// probe.
+type MirrorStatus struct {
+	URL       string        `bson:"url" json:"url" yaml:"url"`
+	Reachable bool          `bson:"reachable" json:"reachable" yaml:"reachable"`
+	Latency   time.Duration `bson:"latency" json:"latency" yaml:"latency"`
+	Failures  int           `bson:"failures" json:"failures" yaml:"failures"`
+}
+
+// NewMirrorSelector builds a selector for the mirrors of the options.
+func NewMirrorSelector(opts MirrorSelectorOptions) (*MirrorSelector, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid mirror selector options")
+	}
+	if opts.ProbeInterval == 0 {
+		opts.ProbeInterval = DefaultMirrorProbeInterval
+	}
+	if opts.ProbeTimeout == 0 {
+		opts.ProbeTimeout = DefaultMirrorProbeTimeout
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	s := &MirrorSelector{client: opts.Client, interval: opts.ProbeInterval, timeout: opts.ProbeTimeout}
+	for _, base := range opts.Mirrors {
+		s.mirrors = append(s.mirrors, &mirrorHealth{base: strings.TrimSuffix(base, "/"), reachable: true})
+	}
+
+	return s, nil
+}
+
+// Mirrors returns the base URLs of the mirrors, best first, probing
+// them if they haven't been probed within the probe interval.
+func (s *MirrorSelector) Mirrors(ctx context.Context) []string {
+	s.mutex.Lock()
+	stale := time.Since(s.probed) > s.interval
+	if stale {
+		// other callers use the current order until the probe
+		// finishes
+		s.probed = time.Now()
+	}
+	s.mutex.Unlock()
+
+	if stale {
+		s.Probe(ctx)
+	}
+
+	return s.order()
+}
+
+// Best returns the base URL of the best mirror, as of the last probe,
+// without probing the mirrors.
+func (s *MirrorSelector) Best() string { return s.order()[0] }
+
+// Status returns the status of each mirror, best first.
+func (s *MirrorSelector) Status() []MirrorStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	out := make([]MirrorStatus, 0, len(s.mirrors))
+	for _, m := range s.sorted() {
+		out = append(out, MirrorStatus{URL: m.base, Reachable: m.reachable, Latency: m.latency, Failures: m.failures})
+	}
+
+	return out
+}
+
+// Probe requests the feed from every mirror, concurrently, and
+// records their latencies.
+func (s *MirrorSelector) Probe(ctx context.Context) {
+	path := "/full.json"
+	if u, err := url.Parse(FeedURL); err == nil {
+		path = u.EscapedPath()
+	}
+
+	s.mutex.Lock()
+	bases := make([]string, 0, len(s.mirrors))
+	for _, m := range s.mirrors {
+		bases = append(bases, m.base)
+	}
+	s.mutex.Unlock()
+
+	latencies := make([]time.Duration, len(bases))
+	errs := make([]error, len(bases))
+	wg := &sync.WaitGroup{}
+	for idx := range bases {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			latencies[idx], errs[idx] = s.probe(ctx, bases[idx]+path)
+		}(idx)
+	}
+	wg.Wait()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.probed = time.Now()
+	for idx, m := range s.mirrors {
+		m.failures /= 2
+		m.latency, m.reachable = latencies[idx], errs[idx] == nil
+		if errs[idx] != nil {
+			m.failures++
+		}
+
+		grip.Debug(message.WrapError(errs[idx], message.Fields{
+			"message": "probed mirror",
+			"mirror":  m.base,
+			"latency": m.latency.String(),
+		}))
+	}
+}
+
+func (s *MirrorSelector) probe(ctx context.Context, addr string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodHead, addr, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "problem building probe")
+	}
+
+	start := time.Now()
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, errors.Wrapf(err, "problem probing %s", addr)
+	}
+	resp.Body.Close()
+	latency := time.Since(start)
+
+	// mirrors that deny HEAD requests, or don't mirror the feed,
+	// are still reachable
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return latency, errors.Errorf("probing %s failed: %s", addr, resp.Status)
+	}
+
+	return latency, nil
+}
+
+// RecordResult records the result of a download from the mirror with
+// the base URL: failures move the mirror after the mirrors that fail
+// less often.
+func (s *MirrorSelector) RecordResult(base string, err error) {
+	if err == nil {
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, m := range s.mirrors {
+		if m.base == base {
+			m.failures++
+		}
+	}
+}
+
+func (s *MirrorSelector) order() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	out := make([]string, 0, len(s.mirrors))
+	for _, m := range s.sorted() {
+		out = append(out, m.base)
+	}
+
+	return out
+}
+
+// sorted returns the mirrors, best first. The caller must hold the
+// lock.
+func (s *MirrorSelector) sorted() []*mirrorHealth {
+	out := append([]*mirrorHealth(nil), s.mirrors...)
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		switch {
+		case a.reachable != b.reachable:
+			return a.reachable
+		case a.failures != b.failures:
+			return a.failures < b.failures
+		default:
+			return a.latency < b.latency
+		}
+	})
+
+	return out
+}
+
+// WithMirrorSelector downloads from the mirrors of the selector, best
+// first, rather than from the Config's mirror. Classes with their own
+// mirrors (see WithClassMirror) still use them.
+func WithMirrorSelector(s *MirrorSelector) Option { return func(c *Config) { c.Mirrors = s } }
+
+// mirrorAttempt is a URL to download a file from, and the base URL of
+// the selector's mirror that it's on, if it is.
+type mirrorAttempt struct {
+	base string
+	url  string
+}
+
+// mirrorAttempts returns the URLs to download the file at the URL
+// from, in order: each of the selector's mirrors, if the URL is on the
+// download servers and its class uses the selector, and otherwise
+// only the URL that MirrorURL returns.
+func (c *Config) mirrorAttempts(ctx context.Context, addr string) []mirrorAttempt {
+	if c == nil || c.Mirrors == nil {
+		return []mirrorAttempt{{url: c.MirrorURL(addr)}}
+	}
+	if _, ok := c.ClassMirrors[ClassifyURL(addr)]; ok || !isMirroredHost(addr) {
+		return []mirrorAttempt{{url: c.MirrorURL(addr)}}
+	}
+
+	parsed, _ := url.Parse(addr)
+	out := []mirrorAttempt{}
+	for _, base := range c.Mirrors.Mirrors(ctx) {
+		out = append(out, mirrorAttempt{base: base, url: base + parsed.EscapedPath()})
+	}
+
+	return out
+}
+
+// tryMirrors downloads from each of the attempts until one succeeds,
+// recording the results of the selector's mirrors.
+func (c *Config) tryMirrors(ctx context.Context, attempts []mirrorAttempt, download func(url string) error) error {
+	catcher := grip.NewBasicCatcher()
+	for idx, attempt := range attempts {
+		err := download(attempt.url)
+		if ctx.Err() != nil {
+			// canceled downloads aren't failures of the mirror
+			return err
+		}
+		if attempt.base != "" {
+			c.Mirrors.RecordResult(attempt.base, err)
+		}
+		if err == nil {
+			return nil
+		}
+
+		catcher.Add(err)
+		grip.WarningWhen(idx < len(attempts)-1, message.WrapError(err, message.Fields{
+			"message": "problem downloading from mirror, trying the next mirror",
+			"url":     attempt.url,
+		}))
+	}
+
+	return catcher.Resolve()
+}
+
+func isMirroredHost(addr string) bool {
+	parsed, err := url.Parse(addr)
+	if err != nil {
+		return false
+	}
+
+	for _, host := range mirroredHosts {
+		if parsed.Host == host {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,111 @@
+package bond
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMirror returns a mirror that responds after the delay, with the
+// status for the feed's probes, and serves archives if it has them.
+func newMirror(delay time.Duration, probeStatus int, archives bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(probeStatus)
+		case archives:
+			_, _ = w.Write([]byte("archive from " + r.Host))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestMirrorSelectorOptionsValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(MirrorSelectorOptions{Mirrors: []string{"https://us.example.net/mongodb"}}.Validate())
+	assert.Error(MirrorSelectorOptions{}.Validate())
+	assert.Error(MirrorSelectorOptions{Mirrors: []string{"us.example.net"}}.Validate())
+	assert.Error(MirrorSelectorOptions{Mirrors: []string{"https://us.example.net"}, ProbeTimeout: -1}.Validate())
+
+	_, err := NewMirrorSelector(MirrorSelectorOptions{})
+	assert.Error(err)
+}
+
+func TestMirrorSelectorOrdersByLatencyAndFailures(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	slow := newMirror(100*time.Millisecond, http.StatusOK, true)
+	defer slow.Close()
+	fast := newMirror(0, http.StatusForbidden, true)
+	defer fast.Close()
+	broken := newMirror(0, http.StatusBadGateway, true)
+	defer broken.Close()
+
+	s, err := NewMirrorSelector(MirrorSelectorOptions{Mirrors: []string{broken.URL, slow.URL, fast.URL + "/"}})
+	require.NoError(t, err)
+	assert.Equal(broken.URL, s.Best())
+
+	assert.Equal([]string{fast.URL, slow.URL, broken.URL}, s.Mirrors(ctx))
+	status := s.Status()
+	require.Len(t, status, 3)
+	assert.True(status[0].Reachable)
+	assert.False(status[2].Reachable)
+	assert.True(status[1].Latency > status[0].Latency)
+
+	// failed downloads move mirrors down until they recover
+	s.RecordResult(fast.URL, os.ErrNotExist)
+	assert.Equal(slow.URL, s.Best())
+	s.Probe(ctx)
+	assert.Equal(fast.URL, s.Best())
+}
+
+func TestConfigDownloadsFromNextMirror(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// the nearest mirror has not synced the archive
+	near := newMirror(0, http.StatusOK, false)
+	defer near.Close()
+	far := newMirror(50*time.Millisecond, http.StatusOK, true)
+	defer far.Close()
+
+	s, err := NewMirrorSelector(MirrorSelectorOptions{Mirrors: []string{far.URL, near.URL}})
+	require.NoError(t, err)
+	conf := NewConfig(WithMirrorSelector(s), WithHTTPClient(http.DefaultClient))
+
+	dir, err := ioutil.TempDir("", "bond-mirrors")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "mongodb-linux-x86_64-4.4.0.tgz")
+	require.NoError(t, conf.DownloadFile(ctx, "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-4.4.0.tgz", fn))
+	data, err := ioutil.ReadFile(fn)
+	require.NoError(t, err)
+	assert.Contains(string(data), "archive from")
+	assert.Equal(far.URL, s.Best())
+	assert.Equal(far.URL+"/full.json", conf.MirrorURL(FeedURL))
+
+	// existing files are not replaced
+	assert.Error(conf.DownloadFile(ctx, "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-4.4.0.tgz", fn))
+	_, err = os.Stat(fn)
+	assert.NoError(err)
+
+	// class mirrors replace the selector
+	conf = NewConfig(WithMirrorSelector(s), WithClassMirror(DebugSymbolArtifacts, ""))
+	assert.Len(conf.mirrorAttempts(ctx, "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-debugsymbols-4.4.0.tgz"), 1)
+	assert.Len(conf.mirrorAttempts(ctx, "https://example.net/mongodb.tgz"), 1)
+}
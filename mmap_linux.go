@@ -0,0 +1,48 @@
+//go:build linux
+
+package bond
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// mappedFile reads a memory-mapped file, whose pages the kernel reads
+// in as they're decoded and may reclaim afterwards, unlike a buffer of
+// the file's data.
+type mappedFile struct {
+	*bytes.Reader
+	data []byte
+}
+
+func (f *mappedFile) Close() error { return syscall.Munmap(f.data) }
+
+// openMapped opens the file for reading, memory-mapped.
+func openMapped(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if stat.Size() == 0 {
+		// empty files cannot be mapped
+		return ioutil.NopCloser(&bytes.Reader{}), nil
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(stat.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem mapping %s", path)
+	}
+
+	return &mappedFile{Reader: bytes.NewReader(data), data: data}, nil
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+
+package bond
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+type bufferedFile struct {
+	*bufio.Reader
+	file *os.File
+}
+
+func (f *bufferedFile) Close() error { return f.file.Close() }
+
+// openMapped opens the file for reading. Files are only mapped on
+// Linux; elsewhere, they're read through a buffer.
+func openMapped(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bufferedFile{Reader: bufio.NewReader(f), file: f}, nil
+}
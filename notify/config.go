@@ -0,0 +1,155 @@
+package notify
+
+import (
+	"regexp"
+
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// SenderType is the kind of a configured sender.
+type SenderType string
+
+// The types of configured senders.
+const (
+	SlackSenderType   SenderType = "slack"
+	EmailSenderType   SenderType = "email"
+	WebhookSenderType SenderType = "webhook"
+)
+
+// SenderConfig configures a named sender, with the options of its
+// type.
+type SenderConfig struct {
+	Name    string          `bson:"name" json:"name" yaml:"name"`
+	Type    SenderType      `bson:"type" json:"type" yaml:"type"`
+	Slack   *SlackOptions   `bson:"slack,omitempty" json:"slack,omitempty" yaml:"slack,omitempty"`
+	Email   *EmailOptions   `bson:"email,omitempty" json:"email,omitempty" yaml:"email,omitempty"`
+	Webhook *WebhookOptions `bson:"webhook,omitempty" json:"webhook,omitempty" yaml:"webhook,omitempty"`
+}
+
+func (c SenderConfig) sender() (Sender, error) {
+	switch c.Type {
+	case SlackSenderType:
+		if c.Slack == nil {
+			return nil, errors.New("slack sender has no slack options")
+		}
+		return NewSlackSender(*c.Slack)
+	case EmailSenderType:
+		if c.Email == nil {
+			return nil, errors.New("email sender has no email options")
+		}
+		return NewEmailSender(*c.Email)
+	case WebhookSenderType:
+		if c.Webhook == nil {
+			return nil, errors.New("webhook sender has no webhook options")
+		}
+		return NewWebhookSender(*c.Webhook)
+	default:
+		return nil, errors.Errorf("'%s' is not a valid sender type", c.Type)
+	}
+}
+
+// Rule sends the events that it matches to its senders.
+type Rule struct {
+	// Events are the types of the events that the rule matches,
+	// or all types, if there are none.
+	Events []EventType `bson:"events,omitempty" json:"events,omitempty" yaml:"events,omitempty"`
+	// Versions, if specified, is a regular expression that the
+	// releases of the events must match, so that the rule only
+	// matches release events.
+	Versions string `bson:"versions,omitempty" json:"versions,omitempty" yaml:"versions,omitempty"`
+	// JobTypes, if specified, are the types of the jobs of the
+	// events that the rule matches.
+	JobTypes []string `bson:"job_types,omitempty" json:"job_types,omitempty" yaml:"job_types,omitempty"`
+	// Senders are the names of the senders of the matched events.
+	Senders []string `bson:"senders" json:"senders" yaml:"senders"`
+}
+
+// rule is a Rule with its version pattern compiled.
+type rule struct {
+	Rule
+	versions *regexp.Regexp
+}
+
+func (r Rule) compile() rule {
+	out := rule{Rule: r}
+	if r.Versions != "" {
+		out.versions = regexp.MustCompile(r.Versions)
+	}
+	return out
+}
+
+func (r rule) matches(e Event) bool {
+	if len(r.Events) > 0 && !containsEvent(r.Events, e.Type) {
+		return false
+	}
+	if r.versions != nil && (e.Version == "" || !r.versions.MatchString(e.Version)) {
+		return false
+	}
+	if len(r.JobTypes) > 0 && !containsString(r.JobTypes, e.JobType) {
+		return false
+	}
+
+	return true
+}
+
+func containsEvent(types []EventType, t EventType) bool {
+	for _, et := range types {
+		if et == t {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Config configures the senders of notifications, and the rules that
+// route events to them.
+type Config struct {
+	Senders []SenderConfig `bson:"senders" json:"senders" yaml:"senders"`
+	Rules   []Rule         `bson:"rules" json:"rules" yaml:"rules"`
+}
+
+// Validate returns an error if the configuration is not valid, or if
+// its rules refer to senders that it does not configure.
+func (c Config) Validate() error { return c.validate(nil) }
+
+// validate checks the configuration, whose rules may also refer to
+// the external senders.
+func (c Config) validate(external map[string]bool) error {
+	catcher := grip.NewBasicCatcher()
+
+	names := map[string]bool{}
+	for name := range external {
+		names[name] = true
+	}
+	for idx, sc := range c.Senders {
+		catcher.ErrorfWhen(sc.Name == "", "sender %d has no name", idx+1)
+		catcher.ErrorfWhen(names[sc.Name], "sender '%s' is defined more than once", sc.Name)
+		names[sc.Name] = true
+	}
+
+	for idx, r := range c.Rules {
+		catcher.ErrorfWhen(len(r.Senders) == 0, "rule %d has no senders", idx+1)
+		for _, name := range r.Senders {
+			catcher.ErrorfWhen(!names[name], "rule %d refers to undefined sender '%s'", idx+1, name)
+		}
+		for _, t := range r.Events {
+			catcher.Wrapf(t.Validate(), "rule %d is invalid", idx+1)
+		}
+		if r.Versions != "" {
+			_, err := regexp.Compile(r.Versions)
+			catcher.Wrapf(err, "rule %d has an invalid versions pattern", idx+1)
+		}
+	}
+
+	return catcher.Resolve()
+}
@@ -0,0 +1,239 @@
+/*
+Package notify sends notifications of the events of queues' jobs and of
+bond's downloads, such as a job that failed or a release that appeared
+in the feed and was cached, through Slack, email, or webhooks. A
+Notifier routes events to senders with rules, so that who is notified
+of what is configuration:
+
+	{
+	  "senders": [{"name": "builds", "type": "slack", "slack": {"webhook_url": "https://hooks.slack.com/services/...", "channel": "#builds"}}],
+	  "rules": [{"events": ["release-available", "release-cached"], "versions": "^8\\.0\\.0-rc0$", "senders": ["builds"]}]
+	}
+
+Watch registers the Notifier's hooks on a middleware.HookedQueue, so
+that the lifecycle of the queue's jobs, and the events that jobs report
+(see Eventer), are notified.
+*/
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/middleware"
+)
+
+// EventType is the kind of an event.
+type EventType string
+
+// The types of events. The job events are the lifecycle of a queue's
+// jobs (see middleware.HookedQueue), and jobs report the release
+// events (see Eventer): ReleaseAvailable when a release appears in the
+// feed, and ReleaseCached when a release's build is downloaded.
+const (
+	JobDispatched    EventType = "job-dispatched"
+	JobCompleted     EventType = "job-completed"
+	JobFailed        EventType = "job-failed"
+	JobStuck         EventType = "job-stuck"
+	ReleaseAvailable EventType = "release-available"
+	ReleaseCached    EventType = "release-cached"
+)
+
+// Validate returns an error if the event type is not known.
+func (t EventType) Validate() error {
+	switch t {
+	case JobDispatched, JobCompleted, JobFailed, JobStuck, ReleaseAvailable, ReleaseCached:
+		return nil
+	default:
+		return errors.Errorf("'%s' is not a valid event type", t)
+	}
+}
+
+// Event describes something that happened to a job or a release. Only
+// the type and time are always set.
+type Event struct {
+	Type    EventType `bson:"type" json:"type" yaml:"type"`
+	Time    time.Time `bson:"time" json:"time" yaml:"time"`
+	JobID   string    `bson:"job_id,omitempty" json:"job_id,omitempty" yaml:"job_id,omitempty"`
+	JobType string    `bson:"job_type,omitempty" json:"job_type,omitempty" yaml:"job_type,omitempty"`
+	// Version is the release of a release event.
+	Version string `bson:"version,omitempty" json:"version,omitempty" yaml:"version,omitempty"`
+	// Path is the cache directory, or the build, of a release
+	// event.
+	Path   string   `bson:"path,omitempty" json:"path,omitempty" yaml:"path,omitempty"`
+	Errors []string `bson:"errors,omitempty" json:"errors,omitempty" yaml:"errors,omitempty"`
+	// Message, if specified, describes the event, instead of the
+	// summary that String returns.
+	Message string `bson:"message,omitempty" json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// JobEvent returns the event of the type for the job, with its status.
+func JobEvent(t EventType, j amboy.Job, stat amboy.JobStatusInfo) Event {
+	return Event{
+		Type:    t,
+		Time:    time.Now(),
+		JobID:   j.ID(),
+		JobType: j.Type().Name,
+		Errors:  stat.Errors,
+	}
+}
+
+// String returns the event's message, or a summary of the event.
+func (e Event) String() string {
+	if e.Message != "" {
+		return e.Message
+	}
+
+	switch e.Type {
+	case ReleaseAvailable:
+		return fmt.Sprintf("MongoDB %s is available", e.Version)
+	case ReleaseCached:
+		return fmt.Sprintf("MongoDB %s is cached in %s", e.Version, e.Path)
+	case JobFailed:
+		return fmt.Sprintf("job %s (%s) failed: %s", e.JobID, e.JobType, strings.Join(e.Errors, "; "))
+	default:
+		return fmt.Sprintf("%s: job %s (%s)", e.Type, e.JobID, e.JobType)
+	}
+}
+
+// Sender delivers the notification of an event.
+type Sender interface {
+	Send(context.Context, Event) error
+}
+
+// SenderFunc adapts a function to a Sender.
+type SenderFunc func(context.Context, Event) error
+
+// Send calls the function.
+func (f SenderFunc) Send(ctx context.Context, e Event) error { return f(ctx, e) }
+
+// Eventer is implemented by jobs that report events of their own when
+// they complete successfully, beyond the jobs' lifecycle events, such
+// as the release that a download cached.
+type Eventer interface {
+	Events() []Event
+}
+
+// sendTimeout limits each notification that a Notifier sends.
+const sendTimeout = 30 * time.Second
+
+// Notifier sends events to the senders of the rules that match them.
+type Notifier struct {
+	senders map[string]Sender
+	rules   []rule
+	wg      sync.WaitGroup
+}
+
+// NewNotifier builds the senders and rules of the configuration. The
+// custom senders, which may be nil, are available to the rules by
+// name along with the configuration's senders, so that applications
+// plug in senders of their own.
+func NewNotifier(conf Config, custom map[string]Sender) (*Notifier, error) {
+	names := map[string]bool{}
+	for name := range custom {
+		names[name] = true
+	}
+	if err := conf.validate(names); err != nil {
+		return nil, errors.Wrap(err, "invalid notification config")
+	}
+
+	n := &Notifier{senders: map[string]Sender{}}
+	for name, s := range custom {
+		n.senders[name] = s
+	}
+	for _, sc := range conf.Senders {
+		s, err := sc.sender()
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem building sender '%s'", sc.Name)
+		}
+		n.senders[sc.Name] = s
+	}
+	for _, r := range conf.Rules {
+		n.rules = append(n.rules, r.compile())
+	}
+
+	return n, nil
+}
+
+// match returns the names of the senders of the rules that match
+// the event, without duplicates, in the order of the rules.
+func (n *Notifier) match(e Event) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, r := range n.rules {
+		if !r.matches(e) {
+			continue
+		}
+		for _, name := range r.Senders {
+			if !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+		}
+	}
+
+	return out
+}
+
+// Notify sends the event to the senders of the rules that match it,
+// and returns the errors of the senders.
+func (n *Notifier) Notify(ctx context.Context, e Event) error {
+	catcher := grip.NewBasicCatcher()
+	for _, name := range n.match(e) {
+		sctx, cancel := context.WithTimeout(ctx, sendTimeout)
+		catcher.Wrapf(n.senders[name].Send(sctx, e), "problem sending %s to '%s'", e.Type, name)
+		cancel()
+	}
+
+	return catcher.Resolve()
+}
+
+// Watch registers hooks on the queue that notify the lifecycle events
+// of its jobs and the events that completed jobs report. The hooks
+// send the notifications in the background, so that they do not delay
+// the queue's workers, and log the senders' errors; Wait waits for
+// them.
+func (n *Notifier) Watch(q *middleware.HookedQueue) {
+	q.OnDispatch(n.hook(JobDispatched))
+	q.OnComplete(n.hook(JobCompleted))
+	q.OnError(n.hook(JobFailed))
+	q.OnStuck(n.hook(JobStuck))
+}
+
+func (n *Notifier) hook(t EventType) middleware.Hook {
+	return func(_ context.Context, j amboy.Job, stat amboy.JobStatusInfo) {
+		j = middleware.Unwrap(j)
+		events := []Event{JobEvent(t, j, stat)}
+		if eventer, ok := j.(Eventer); ok && t == JobCompleted {
+			events = append(events, eventer.Events()...)
+		}
+
+		for _, e := range events {
+			if len(n.match(e)) == 0 {
+				continue
+			}
+
+			n.wg.Add(1)
+			go func(e Event) {
+				defer n.wg.Done()
+				// the notifications outlive the hook's job
+				grip.Warning(message.WrapError(n.Notify(context.Background(), e), message.Fields{
+					"message": "problem sending notification",
+					"event":   e.Type,
+					"job":     e.JobID,
+				}))
+			}(e)
+		}
+	}
+}
+
+// Wait waits for the notifications that the hooks of watched queues
+// are sending.
+func (n *Notifier) Wait() { n.wg.Wait() }
@@ -0,0 +1,150 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/middleware"
+)
+
+type recordingSender struct {
+	mu     sync.Mutex
+	events []Event
+	err    error
+}
+
+func (s *recordingSender) Send(_ context.Context, e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+	return s.err
+}
+
+func (s *recordingSender) get() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Event(nil), s.events...)
+}
+
+func (s *recordingSender) types() []EventType {
+	out := []EventType{}
+	for _, e := range s.get() {
+		out = append(out, e.Type)
+	}
+	return out
+}
+
+// cachingJob reports the release that it cached when it completes.
+type cachingJob struct {
+	*job.ShellJob
+}
+
+func (j *cachingJob) Events() []Event {
+	return []Event{{Type: ReleaseCached, Version: "8.0.0-rc0", Path: "/cache/mongodb-8.0.0-rc0"}}
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	slack := SenderConfig{Name: "builds", Type: SlackSenderType, Slack: &SlackOptions{WebhookURL: "https://hooks.slack.com/services/x"}}
+	assert.NoError(Config{Senders: []SenderConfig{slack}, Rules: []Rule{{Senders: []string{"builds"}}}}.Validate())
+
+	for _, conf := range []Config{
+		{Senders: []SenderConfig{{Type: SlackSenderType}}},
+		{Senders: []SenderConfig{slack, slack}},
+		{Senders: []SenderConfig{slack}, Rules: []Rule{{}}},
+		{Senders: []SenderConfig{slack}, Rules: []Rule{{Senders: []string{"oncall"}}}},
+		{Senders: []SenderConfig{slack}, Rules: []Rule{{Events: []EventType{"job-exploded"}, Senders: []string{"builds"}}}},
+		{Senders: []SenderConfig{slack}, Rules: []Rule{{Versions: "[", Senders: []string{"builds"}}}},
+	} {
+		assert.Error(conf.Validate(), "%+v", conf)
+	}
+
+	// senders are built when the notifier is
+	for _, sc := range []SenderConfig{
+		{Name: "a", Type: "pager"},
+		{Name: "a", Type: SlackSenderType},
+		{Name: "a", Type: WebhookSenderType, Webhook: &WebhookOptions{URL: "ftp://example.net"}},
+		{Name: "a", Type: EmailSenderType, Email: &EmailOptions{Server: "smtp.example.net"}},
+	} {
+		_, err := NewNotifier(Config{Senders: []SenderConfig{sc}}, nil)
+		assert.Error(err, "%+v", sc)
+	}
+}
+
+func TestNotifierRoutesEvents(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	builds, oncall, failing := &recordingSender{}, &recordingSender{}, &recordingSender{err: errors.New("unreachable")}
+	n, err := NewNotifier(Config{Rules: []Rule{
+		{Events: []EventType{ReleaseAvailable, ReleaseCached}, Versions: `^8\.0\.0-rc0$`, Senders: []string{"builds"}},
+		{Events: []EventType{JobFailed, JobStuck}, Senders: []string{"oncall", "builds"}},
+		{Events: []EventType{JobFailed}, JobTypes: []string{"shell"}, Senders: []string{"oncall", "failing"}},
+	}}, map[string]Sender{"builds": builds, "oncall": oncall, "failing": failing})
+	require.NoError(t, err)
+
+	assert.NoError(n.Notify(ctx, Event{Type: ReleaseAvailable, Version: "8.0.0-rc0"}))
+	assert.NoError(n.Notify(ctx, Event{Type: ReleaseAvailable, Version: "7.0.2"}))
+	assert.NoError(n.Notify(ctx, Event{Type: JobCompleted, JobType: "shell"}))
+	assert.NoError(n.Notify(ctx, Event{Type: JobStuck, JobType: "download"}))
+	assert.Error(n.Notify(ctx, Event{Type: JobFailed, JobType: "shell"}))
+
+	assert.Equal([]EventType{ReleaseAvailable, JobStuck, JobFailed}, builds.types())
+	// senders of several matching rules are sent the event once
+	assert.Equal([]EventType{JobStuck, JobFailed}, oncall.types())
+	assert.Equal([]EventType{JobFailed}, failing.types())
+}
+
+func TestNotifierWatchesQueue(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	all, releases := &recordingSender{}, &recordingSender{}
+	n, err := NewNotifier(Config{Rules: []Rule{
+		{Events: []EventType{JobCompleted, JobFailed}, Senders: []string{"all"}},
+		{Versions: `^8\.0`, Senders: []string{"releases"}},
+	}}, map[string]Sender{"all": all, "releases": releases})
+	require.NoError(t, err)
+
+	q, err := middleware.NewHookedQueue(queue.NewLocalLimitedSize(1, 128))
+	require.NoError(t, err)
+	n.Watch(q)
+	require.NoError(t, q.Start(ctx))
+
+	passing := &cachingJob{ShellJob: job.NewShellJob("true", "")}
+	passing.SetID("passing")
+	failing := &cachingJob{ShellJob: job.NewShellJob("false", "")}
+	failing.SetID("failing")
+	require.NoError(t, q.Put(ctx, passing))
+	require.NoError(t, q.Put(ctx, failing))
+	require.True(t, amboy.WaitInterval(ctx, q, 10*time.Millisecond))
+
+	// the hooks run after the queue records the jobs as complete
+	for len(all.get()) < 2 && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	n.Wait()
+
+	byID := map[string]EventType{}
+	for _, e := range all.get() {
+		byID[e.JobID] = e.Type
+		assert.Equal("shell", e.JobType)
+	}
+	assert.Equal(map[string]EventType{"passing": JobCompleted, "failing": JobFailed}, byID)
+
+	// only jobs that complete successfully report their events
+	cached := releases.get()
+	require.Len(t, cached, 1)
+	assert.Equal(ReleaseCached, cached[0].Type)
+	assert.Equal("MongoDB 8.0.0-rc0 is cached in /cache/mongodb-8.0.0-rc0", cached[0].String())
+}
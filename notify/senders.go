@@ -0,0 +1,224 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+// WebhookOptions configure a sender that posts events, as JSON, to a
+// URL.
+type WebhookOptions struct {
+	URL string `bson:"url" json:"url" yaml:"url"`
+	// Headers are set on each request, such as an Authorization
+	// header that the receiver requires.
+	Headers map[string]string `bson:"headers,omitempty" json:"headers,omitempty" yaml:"headers,omitempty"`
+	// Client, if specified, sends the requests instead of the
+	// default client.
+	Client *http.Client `bson:"-" json:"-" yaml:"-"`
+}
+
+// Validate returns an error if the URL is not an HTTP URL.
+func (opts WebhookOptions) Validate() error { return validateURL(opts.URL) }
+
+func validateURL(val string) error {
+	u, err := url.Parse(val)
+	if err != nil {
+		return errors.Wrapf(err, "invalid URL '%s'", val)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return errors.Errorf("'%s' is not an HTTP URL", val)
+	}
+	return nil
+}
+
+type webhookSender struct {
+	opts WebhookOptions
+}
+
+// NewWebhookSender returns a sender that posts each event, encoded as
+// JSON, to the options' URL, for receivers that act on bond's events.
+func NewWebhookSender(opts WebhookOptions) (Sender, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid webhook options")
+	}
+	return &webhookSender{opts: opts}, nil
+}
+
+func (s *webhookSender) Send(ctx context.Context, e Event) error {
+	return postJSON(ctx, s.opts.Client, s.opts.URL, s.opts.Headers, e)
+}
+
+// SlackOptions configure a sender that posts events to a Slack
+// incoming webhook.
+type SlackOptions struct {
+	WebhookURL string `bson:"webhook_url" json:"webhook_url" yaml:"webhook_url"`
+	// Channel and Username, if specified, override the defaults of
+	// the webhook (e.g. #builds).
+	Channel  string `bson:"channel,omitempty" json:"channel,omitempty" yaml:"channel,omitempty"`
+	Username string `bson:"username,omitempty" json:"username,omitempty" yaml:"username,omitempty"`
+	// Client, if specified, sends the requests instead of the
+	// default client.
+	Client *http.Client `bson:"-" json:"-" yaml:"-"`
+}
+
+// Validate returns an error if the webhook URL is not an HTTP URL.
+func (opts SlackOptions) Validate() error { return validateURL(opts.WebhookURL) }
+
+type slackMessage struct {
+	Text     string `json:"text"`
+	Channel  string `json:"channel,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+type slackSender struct {
+	opts SlackOptions
+}
+
+// NewSlackSender returns a sender that posts a summary of each event
+// (see Event's String) to a Slack incoming webhook.
+func NewSlackSender(opts SlackOptions) (Sender, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid slack options")
+	}
+	return &slackSender{opts: opts}, nil
+}
+
+func (s *slackSender) Send(ctx context.Context, e Event) error {
+	return postJSON(ctx, s.opts.Client, s.opts.WebhookURL, nil, slackMessage{
+		Text:     e.String(),
+		Channel:  s.opts.Channel,
+		Username: s.opts.Username,
+	})
+}
+
+func postJSON(ctx context.Context, client *http.Client, target string, headers map[string]string, doc interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return errors.Wrap(err, "problem encoding notification")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "problem building request")
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "problem posting to %s", req.URL.Host)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return errors.Errorf("%s responded with %s: %s", req.URL.Host, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return nil
+}
+
+// EmailOptions configure a sender that emails events through an SMTP
+// server.
+type EmailOptions struct {
+	// Server is the host and port of the SMTP server (e.g.
+	// smtp.example.net:587).
+	Server string   `bson:"server" json:"server" yaml:"server"`
+	From   string   `bson:"from" json:"from" yaml:"from"`
+	To     []string `bson:"to" json:"to" yaml:"to"`
+	// Username and Password, if specified, authenticate with the
+	// server, which must then support TLS.
+	Username string `bson:"username,omitempty" json:"username,omitempty" yaml:"username,omitempty"`
+	Password string `bson:"password,omitempty" json:"password,omitempty" yaml:"password,omitempty"`
+	// SubjectPrefix starts the subject of each email, and defaults
+	// to "[bond]".
+	SubjectPrefix string `bson:"subject_prefix,omitempty" json:"subject_prefix,omitempty" yaml:"subject_prefix,omitempty"`
+}
+
+// Validate returns an error if the options do not specify the server,
+// sender, and recipients.
+func (opts EmailOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	_, _, err := net.SplitHostPort(opts.Server)
+	catcher.Wrapf(err, "invalid SMTP server '%s'", opts.Server)
+	catcher.NewWhen(opts.From == "", "must specify the sender of emails")
+	catcher.NewWhen(len(opts.To) == 0, "must specify the recipients of emails")
+	return catcher.Resolve()
+}
+
+type emailSender struct {
+	opts EmailOptions
+	// send is smtp.SendMail, except in tests.
+	send func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// NewEmailSender returns a sender that emails a summary of each event,
+// with the event as JSON, to the options' recipients.
+func NewEmailSender(opts EmailOptions) (Sender, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid email options")
+	}
+	if opts.SubjectPrefix == "" {
+		opts.SubjectPrefix = "[bond]"
+	}
+	return &emailSender{opts: opts, send: smtp.SendMail}, nil
+}
+
+func (s *emailSender) Send(ctx context.Context, e Event) error {
+	var auth smtp.Auth
+	if s.opts.Username != "" {
+		host, _, _ := net.SplitHostPort(s.opts.Server)
+		auth = smtp.PlainAuth("", s.opts.Username, s.opts.Password, host)
+	}
+
+	doc, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "problem encoding notification")
+	}
+
+	msg := &bytes.Buffer{}
+	fmt.Fprintf(msg, "From: %s\r\n", s.opts.From)
+	fmt.Fprintf(msg, "To: %s\r\n", strings.Join(s.opts.To, ", "))
+	fmt.Fprintf(msg, "Subject: %s %s\r\n", s.opts.SubjectPrefix, headerValue(e.String()))
+	fmt.Fprintf(msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(msg, "%s\r\n\r\n%s\r\n", e.String(), doc)
+
+	// smtp.SendMail does not take a context, so the send is
+	// abandoned, rather than interrupted, when the context ends
+	done := make(chan error, 1)
+	go func() { done <- s.send(s.opts.Server, auth, s.opts.From, s.opts.To, msg.Bytes()) }()
+	select {
+	case err = <-done:
+		return errors.Wrapf(err, "problem emailing through %s", s.opts.Server)
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "operation canceled")
+	}
+}
+
+// headerValue returns the first line of the value, so that it does not
+// end the header.
+func headerValue(val string) string {
+	if idx := strings.IndexAny(val, "\r\n"); idx >= 0 {
+		return val[:idx]
+	}
+	return val
+}
@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type postRecorder struct {
+	bodies  [][]byte
+	headers []http.Header
+	status  int
+}
+
+func (r *postRecorder) server() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		r.bodies = append(r.bodies, body)
+		r.headers = append(r.headers, req.Header)
+		if r.status != 0 {
+			http.Error(w, "no such hook", r.status)
+		}
+	}))
+}
+
+func TestWebhookSender(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	rec := &postRecorder{}
+	srv := rec.server()
+	defer srv.Close()
+
+	s, err := NewWebhookSender(WebhookOptions{URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer token"}})
+	require.NoError(t, err)
+	event := Event{Type: JobFailed, Time: time.Unix(1700000000, 0).UTC(), JobID: "download-1", Errors: []string{"timeout"}}
+	require.NoError(t, s.Send(ctx, event))
+
+	require.Len(t, rec.bodies, 1)
+	sent := Event{}
+	require.NoError(t, json.Unmarshal(rec.bodies[0], &sent))
+	assert.Equal(event, sent)
+	assert.Equal("Bearer token", rec.headers[0].Get("Authorization"))
+	assert.Equal("application/json", rec.headers[0].Get("Content-Type"))
+
+	rec.status = http.StatusNotFound
+	err = s.Send(ctx, event)
+	require.Error(t, err)
+	assert.Contains(err.Error(), "no such hook")
+
+	_, err = NewWebhookSender(WebhookOptions{URL: "hooks.example.net"})
+	assert.Error(err)
+}
+
+func TestSlackSender(t *testing.T) {
+	assert := assert.New(t)
+
+	rec := &postRecorder{}
+	srv := rec.server()
+	defer srv.Close()
+
+	s, err := NewSlackSender(SlackOptions{WebhookURL: srv.URL, Channel: "#builds"})
+	require.NoError(t, err)
+	require.NoError(t, s.Send(context.Background(), Event{Type: ReleaseAvailable, Version: "8.0.0-rc0"}))
+
+	require.Len(t, rec.bodies, 1)
+	msg := slackMessage{}
+	require.NoError(t, json.Unmarshal(rec.bodies[0], &msg))
+	assert.Equal(slackMessage{Text: "MongoDB 8.0.0-rc0 is available", Channel: "#builds"}, msg)
+
+	_, err = NewSlackSender(SlackOptions{})
+	assert.Error(err)
+}
+
+func TestEmailSender(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(EmailOptions{Server: "smtp.example.net", From: "bond@example.net", To: []string{"ops@example.net"}}.Validate())
+	assert.Error(EmailOptions{Server: "smtp.example.net:587", To: []string{"ops@example.net"}}.Validate())
+	assert.Error(EmailOptions{Server: "smtp.example.net:587", From: "bond@example.net"}.Validate())
+
+	s, err := NewEmailSender(EmailOptions{
+		Server:   "smtp.example.net:587",
+		From:     "bond@example.net",
+		To:       []string{"ops@example.net", "builds@example.net"},
+		Username: "bond",
+		Password: "secret",
+	})
+	require.NoError(t, err)
+
+	var sent struct {
+		addr string
+		auth smtp.Auth
+		to   []string
+		msg  string
+	}
+	s.(*emailSender).send = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		sent.addr, sent.auth, sent.to, sent.msg = addr, a, to, string(msg)
+		return nil
+	}
+
+	event := Event{Type: JobFailed, JobID: "download-1", JobType: "bond-recall-download-file", Errors: []string{"timeout\nretrying"}}
+	require.NoError(t, s.Send(context.Background(), event))
+	assert.Equal("smtp.example.net:587", sent.addr)
+	assert.NotNil(sent.auth)
+	assert.Equal([]string{"ops@example.net", "builds@example.net"}, sent.to)
+	assert.Contains(sent.msg, "To: ops@example.net, builds@example.net\r\n")
+	// the subject ends at the first line of the summary
+	assert.Contains(sent.msg, "Subject: [bond] job download-1 (bond-recall-download-file) failed: timeout\r\n")
+	assert.Contains(sent.msg, `"job_id": "download-1"`)
+
+	// sends that outlast their context are abandoned
+	block := make(chan struct{})
+	defer close(block)
+	s.(*emailSender).send = func(string, smtp.Auth, string, []string, []byte) error {
+		<-block
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Error(s.Send(ctx, event))
+}
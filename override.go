@@ -0,0 +1,191 @@
+package bond
+
+import (
+	"bytes"
+	"encoding/json"
+	"path"
+	"sync"
+	"text/template"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+// URLOverride replaces the URLs that the feed publishes for the builds
+// of a target and edition, for organizations that repackage the
+// archives under different paths. Downloads resolved through the
+// override keep the feed's checksums, so the repackaged archives
+// must be identical to the originals.
+//
+// The template is a text/template that renders the archive's URL,
+// with the fields of URLOverrideData (e.g.
+// "https://mirror.example.net/{{.Version}}/{{.Target}}/{{.FileName}}").
+type URLOverride struct {
+	Target   string         `bson:"target" json:"target" yaml:"target"`
+	Edition  MongoDBEdition `bson:"edition" json:"edition" yaml:"edition"`
+	Arch     MongoDBArch    `bson:"arch,omitempty" json:"arch,omitempty" yaml:"arch,omitempty"`
+	Template string         `bson:"template" json:"template" yaml:"template"`
+
+	tmpl *template.Template
+}
+
+// URLOverrideData holds the values available to the template of a
+// URLOverride. FileName is the base name of the URL in the feed.
+type URLOverrideData struct {
+	Version  string
+	Target   string
+	Arch     MongoDBArch
+	Edition  MongoDBEdition
+	Debug    bool
+	FileName string
+}
+
+// Validate checks that the override has a target, an edition, and a
+// valid template.
+func (o *URLOverride) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(o.Target == "", "url override must specify a target")
+	catcher.NewWhen(o.Edition == "", "url override must specify an edition")
+
+	tmpl, err := template.New(o.Target).Option("missingkey=error").Parse(o.Template)
+	catcher.Add(errors.Wrapf(err, "url override for %s (%s) has an invalid template", o.Target, o.Edition))
+	catcher.NewWhen(o.Template == "", "url override must specify a template")
+	o.tmpl = tmpl
+
+	return catcher.Resolve()
+}
+
+func (o *URLOverride) matches(opts BuildOptions) bool {
+	return o.Target == opts.Target && o.Edition == opts.Edition && (o.Arch == "" || o.Arch == opts.Arch)
+}
+
+func (o *URLOverride) render(data URLOverrideData) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := o.tmpl.Execute(buf, data); err != nil {
+		return "", errors.Wrapf(err, "problem rendering url override for %s (%s)", o.Target, o.Edition)
+	}
+
+	return buf.String(), nil
+}
+
+var (
+	urlOverrideMutex sync.RWMutex
+	urlOverrides     []*URLOverride
+)
+
+// RegisterURLOverride adds an override for the URLs of a target and
+// edition. Overrides that specify an architecture take precedence
+// over those that do not; otherwise, the most recently registered
+// override wins.
+func RegisterURLOverride(o URLOverride) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	urlOverrideMutex.Lock()
+	defer urlOverrideMutex.Unlock()
+	urlOverrides = append([]*URLOverride{&o}, urlOverrides...)
+
+	return nil
+}
+
+// LoadURLOverrides registers the overrides, as a JSON array. None of
+// the overrides are registered if any of them are invalid.
+func LoadURLOverrides(data []byte) error {
+	update := []URLOverride{}
+	if err := json.Unmarshal(data, &update); err != nil {
+		return errors.Wrap(err, "problem converting url overrides from json")
+	}
+
+	catcher := grip.NewBasicCatcher()
+	for idx := range update {
+		catcher.Add(update[idx].Validate())
+	}
+	if catcher.HasErrors() {
+		return catcher.Resolve()
+	}
+
+	for _, o := range update {
+		if err := RegisterURLOverride(o); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ResetURLOverrides removes all registered overrides.
+func ResetURLOverrides() {
+	urlOverrideMutex.Lock()
+	defer urlOverrideMutex.Unlock()
+	urlOverrides = nil
+}
+
+func getURLOverride(opts BuildOptions) *URLOverride {
+	urlOverrideMutex.RLock()
+	defer urlOverrideMutex.RUnlock()
+
+	var fallback *URLOverride
+	for _, o := range urlOverrides {
+		if !o.matches(opts) {
+			continue
+		}
+		if o.Arch != "" {
+			return o
+		}
+		if fallback == nil {
+			fallback = o
+		}
+	}
+
+	return fallback
+}
+
+// overrideDownload returns the download with its URLs replaced by
+// a registered override for the build options, if there is one.
+func overrideDownload(version string, opts BuildOptions, dl ArtifactDownload) ArtifactDownload {
+	o := getURLOverride(opts)
+	if o == nil {
+		return dl
+	}
+
+	orig := dl
+	data := URLOverrideData{
+		Version: version,
+		Target:  opts.Target,
+		Arch:    opts.Arch,
+		Edition: opts.Edition,
+	}
+
+	if dl.Archive.URL != "" {
+		data.FileName = path.Base(dl.Archive.URL)
+		url, err := o.render(data)
+		if err != nil {
+			grip.Warning(message.WrapError(err, message.Fields{
+				"message": "using feed url",
+				"version": version,
+				"url":     dl.Archive.URL,
+			}))
+			return orig
+		}
+		dl.Archive.URL = url
+	}
+
+	if dl.Archive.Debug != "" {
+		data.Debug = true
+		data.FileName = path.Base(dl.Archive.Debug)
+		url, err := o.render(data)
+		if err != nil {
+			grip.Warning(message.WrapError(err, message.Fields{
+				"message": "using feed url",
+				"version": version,
+				"url":     dl.Archive.Debug,
+			}))
+			return orig
+		}
+		dl.Archive.Debug = url
+	}
+
+	return dl
+}
@@ -0,0 +1,70 @@
+package bond
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLOverrides(t *testing.T) {
+	assert := assert.New(t)
+	defer ResetURLOverrides()
+
+	feed, err := NewArtifactsFeed("")
+	require.NoError(t, err)
+	defer os.RemoveAll(feed.dir)
+	require.NoError(t, feed.Reload([]byte(`{"versions": [
+  {"version": "4.0.0", "downloads": [
+    {"target": "ubuntu1804", "arch": "x86_64", "edition": "enterprise",
+     "archive": {"url": "https://example.net/a-4.0.0.tgz", "debug_symbols": "https://example.net/a-debug-4.0.0.tgz", "sha256": "`+helloSHA256+`"}},
+    {"target": "ubuntu1804", "arch": "ppc64le", "edition": "enterprise",
+     "archive": {"url": "https://example.net/b-4.0.0.tgz"}},
+    {"target": "rhel70", "arch": "x86_64", "edition": "enterprise",
+     "archive": {"url": "https://example.net/c-4.0.0.tgz"}}]}
+]}`)))
+	version, ok := feed.GetVersion("4.0.0")
+	require.True(t, ok)
+
+	require.NoError(t, RegisterURLOverride(URLOverride{
+		Target:   "ubuntu1804",
+		Edition:  Enterprise,
+		Template: "https://mirror.example.net/{{.Version}}/{{if .Debug}}debug/{{end}}{{.FileName}}",
+	}))
+	require.NoError(t, LoadURLOverrides([]byte(`[{"target": "ubuntu1804", "edition": "enterprise", "arch": "ppc64le",
+  "template": "https://power.example.net/{{.Arch}}/{{.FileName}}"}]`)))
+
+	dl, err := version.GetDownload(BuildOptions{Target: "ubuntu1804", Arch: AMD64, Edition: Enterprise})
+	require.NoError(t, err)
+	assert.Equal("https://mirror.example.net/4.0.0/a-4.0.0.tgz", dl.Archive.URL)
+	assert.Equal("https://mirror.example.net/4.0.0/debug/a-debug-4.0.0.tgz", dl.Archive.Debug)
+	assert.Equal([]Checksum{{SHA256, helloSHA256}}, feed.Checksums(dl.Archive.URL))
+
+	dl, err = version.GetDownload(BuildOptions{Target: "ubuntu1804", Arch: POWER, Edition: Enterprise})
+	require.NoError(t, err)
+	assert.Equal("https://power.example.net/ppc64le/b-4.0.0.tgz", dl.Archive.URL)
+
+	dl, err = version.GetDownload(BuildOptions{Target: "rhel70", Arch: AMD64, Edition: Enterprise})
+	require.NoError(t, err)
+	assert.Equal("https://example.net/c-4.0.0.tgz", dl.Archive.URL)
+
+	for _, o := range []URLOverride{
+		{Edition: Enterprise, Template: "x"},
+		{Target: "rhel70", Template: "x"},
+		{Target: "rhel70", Edition: Enterprise},
+		{Target: "rhel70", Edition: Enterprise, Template: "{{.Version"},
+	} {
+		assert.Error(RegisterURLOverride(o))
+	}
+	assert.Error(LoadURLOverrides([]byte(`[{"target": "rhel70", "edition": "enterprise", "template": "ok"}, {"target": "rhel70"}]`)))
+
+	dl, err = version.GetDownload(BuildOptions{Target: "rhel70", Arch: AMD64, Edition: Enterprise})
+	require.NoError(t, err)
+	assert.Equal("https://example.net/c-4.0.0.tgz", dl.Archive.URL)
+
+	ResetURLOverrides()
+	dl, err = version.GetDownload(BuildOptions{Target: "ubuntu1804", Arch: AMD64, Edition: Enterprise})
+	require.NoError(t, err)
+	assert.Equal("https://example.net/a-4.0.0.tgz", dl.Archive.URL)
+}
@@ -0,0 +1,38 @@
+package bond
+
+import (
+	"os"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+// preallocate reserves the disk space of the size bytes of the file
+// after the offset, when the size of a download is known before it's
+// written, so that the file is less fragmented, and so that a disk
+// without room for it fails the download before it starts rather
+// than when it's nearly complete. The file's size does not change,
+// so the size of a partial download remains the number of bytes
+// written. File systems that cannot reserve space write the file as
+// they would without it.
+func preallocate(f *os.File, offset, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+
+	err := fallocate(f, offset, size)
+	switch {
+	case err == nil:
+		return nil
+	case Is(err, ErrInsufficientSpace):
+		return errors.Wrapf(err, "cannot allocate %d bytes for %s", size, f.Name())
+	default:
+		grip.Debug(message.WrapError(err, message.Fields{
+			"message": "could not preallocate download",
+			"file":    f.Name(),
+			"size":    size,
+		}))
+		return nil
+	}
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package bond
+
+import (
+	"os"
+	"syscall"
+)
+
+// fallocKeepSize is FALLOC_FL_KEEP_SIZE, which reserves the space
+// without changing the size of the file.
+const fallocKeepSize = 0x01
+
+func fallocate(f *os.File, offset, size int64) error {
+	err := syscall.Fallocate(int(f.Fd()), fallocKeepSize, offset, size)
+	switch err {
+	case syscall.ENOSPC, syscall.EDQUOT, syscall.EFBIG:
+		// the file system does not have room for the file, or
+		// cannot hold a file of its size
+		return ErrInsufficientSpace
+	default:
+		return err
+	}
+}
@@ -0,0 +1,64 @@
+//go:build linux
+
+package bond
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreallocate(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-preallocate")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	f, err := os.Create(filepath.Join(dir, "archive.tgz"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	// the space is reserved without changing the size of the file
+	assert.NoError(preallocate(f, 0, 1<<20))
+	assert.NoError(preallocate(f, 0, 0))
+	stat, err := f.Stat()
+	require.NoError(t, err)
+	assert.EqualValues(0, stat.Size())
+
+	err = preallocate(f, 0, 1<<60)
+	assert.True(Is(err, ErrInsufficientSpace), "%v", err)
+}
+
+func TestDownloadFileFailsWithoutSpace(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.FormatInt(1<<60, 10))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "bond-preallocate-download")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for name, download := range map[string]func(context.Context, string, string) error{
+		"plain":     DownloadFile,
+		"resumable": func(ctx context.Context, url, fn string) error { return ResumeDownloadFile(ctx, url, fn, nil) },
+	} {
+		fn := filepath.Join(dir, name+".tgz")
+		err = download(context.Background(), srv.URL+"/"+name+".tgz", fn)
+		assert.True(Is(err, ErrInsufficientSpace), "%s: %v", name, err)
+		_, err = os.Stat(fn)
+		assert.True(os.IsNotExist(err), name)
+	}
+}
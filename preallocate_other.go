@@ -0,0 +1,13 @@
+//go:build !linux
+
+package bond
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+func fallocate(*os.File, int64, int64) error {
+	return errors.New("preallocation is not available on this platform")
+}
@@ -0,0 +1,167 @@
+package bond
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MetadataFileSuffix is the suffix of the file names of the metadata
+// that a MetadataProcessor writes next to archives.
+const MetadataFileSuffix = ".metadata.json"
+
+// Processor is a step of the post-processing of verified archives,
+// such as stripping binaries, re-compressing, generating metadata, or
+// scanning for malware, so that organizations can normalize archives
+// before internal consumers use them. Processors may replace the
+// archive, which is not verified again.
+type Processor interface {
+	Name() string
+	Process(context.Context, *Artifact) error
+}
+
+type processorFunc struct {
+	name string
+	fn   func(context.Context, *Artifact) error
+}
+
+// NewProcessor returns a Processor that calls the function, for
+// processing steps that run in-process.
+func NewProcessor(name string, fn func(context.Context, *Artifact) error) Processor {
+	return &processorFunc{name: name, fn: fn}
+}
+
+func (p *processorFunc) Name() string                                   { return p.name }
+func (p *processorFunc) Process(ctx context.Context, a *Artifact) error { return p.fn(ctx, a) }
+
+// WithProcessors sets the post-processing chain of verified archives;
+// by default, archives are not processed.
+func WithProcessors(processors ...Processor) Option {
+	return func(c *Config) { c.Processors = processors }
+}
+
+// GetProcessors returns the post-processing chain of the Config.
+func (c *Config) GetProcessors() []Processor {
+	if c == nil {
+		return nil
+	}
+
+	return c.Processors
+}
+
+// Process runs the Config's processors on the verified archive, in
+// order, and stops at the first that fails.
+func (c *Config) Process(ctx context.Context, a *Artifact) error {
+	a.conf = c
+
+	for _, p := range c.GetProcessors() {
+		if err := p.Process(ctx, a); err != nil {
+			return errors.Wrapf(err, "%s processing of %s failed", p.Name(), a.Path)
+		}
+	}
+
+	return nil
+}
+
+// CommandProcessor runs an external program on the archive, such as
+// a script that strips the binaries and re-compresses the archive in
+// place, or a malware scanner. The program is run with its arguments
+// followed by the archive's path, and with the BOND_ARCHIVE_URL
+// environment variable set to the archive's URL; it fails the
+// processing by exiting with a non-zero status.
+type CommandProcessor struct {
+	Label   string
+	Command []string
+	// Timeout limits the run time of the program, and defaults to
+	// five minutes.
+	Timeout time.Duration
+}
+
+// Name returns the label of the processor, or the name of its program.
+func (p *CommandProcessor) Name() string {
+	if p.Label != "" {
+		return p.Label
+	}
+	if len(p.Command) > 0 {
+		return p.Command[0]
+	}
+	return "command"
+}
+
+// Process runs the program on the archive.
+func (p *CommandProcessor) Process(ctx context.Context, a *Artifact) error {
+	if len(p.Command) == 0 {
+		return errors.New("command processor has no command")
+	}
+
+	out, err := runArchiveCommand(ctx, p.Command, p.Timeout, a)
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return errors.Errorf("%s failed on %s: %s", p.Name(), a.Path, strings.TrimSpace(string(out)))
+		}
+		return errors.Wrapf(err, "problem running %s", p.Name())
+	}
+
+	return nil
+}
+
+// ArtifactMetadata describes a processed archive, for the consumers
+// of a cache. A MetadataProcessor writes it next to the archive.
+type ArtifactMetadata struct {
+	Name      string    `bson:"name" json:"name" yaml:"name"`
+	URL       string    `bson:"url" json:"url" yaml:"url"`
+	Size      int64     `bson:"size" json:"size" yaml:"size"`
+	Checksum  Checksum  `bson:"checksum" json:"checksum" yaml:"checksum"`
+	Processed time.Time `bson:"processed" json:"processed" yaml:"processed"`
+}
+
+// MetadataProcessor writes an ArtifactMetadata file, named after the
+// archive with MetadataFileSuffix, next to the archive. The checksum
+// is of the archive as processed, so the processor should follow
+// those that replace the archive.
+type MetadataProcessor struct {
+	// Algorithm of the checksum, which defaults to SHA256.
+	Algorithm ChecksumAlgorithm
+}
+
+// Name returns "metadata".
+func (p *MetadataProcessor) Name() string { return "metadata" }
+
+// Process writes the metadata of the archive.
+func (p *MetadataProcessor) Process(_ context.Context, a *Artifact) error {
+	alg := p.Algorithm
+	if alg == "" {
+		alg = SHA256
+	}
+
+	info, err := os.Stat(a.Path)
+	if err != nil {
+		return errors.Wrapf(err, "problem reading %s", a.Path)
+	}
+
+	sum, err := FileChecksum(a.Path, alg)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(ArtifactMetadata{
+		Name:      filepath.Base(a.Path),
+		URL:       a.URL,
+		Size:      info.Size(),
+		Checksum:  sum,
+		Processed: time.Now(),
+	}, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "problem converting metadata to json")
+	}
+
+	fn := a.Path + MetadataFileSuffix
+	return errors.Wrapf(ioutil.WriteFile(fn, data, 0644), "problem writing %s", fn)
+}
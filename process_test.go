@@ -0,0 +1,95 @@
+package bond
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigProcessRunsProcessorsInOrder(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var nilConf *Config
+	assert.Empty(nilConf.GetProcessors())
+	assert.NoError(NewConfig().Process(ctx, &Artifact{Path: "archive.tgz"}))
+
+	order := []string{}
+	step := func(name string, err error) Processor {
+		return NewProcessor(name, func(_ context.Context, a *Artifact) error {
+			order = append(order, name)
+			return err
+		})
+	}
+
+	conf := NewConfig(WithProcessors(step("strip", nil), step("scan", errors.New("infected")), step("metadata", nil)))
+	require.Len(t, conf.GetProcessors(), 3)
+
+	err := conf.Process(ctx, &Artifact{Path: "archive.tgz"})
+	require.Error(t, err)
+	assert.Contains(err.Error(), "scan processing of archive.tgz failed")
+	assert.Contains(err.Error(), "infected")
+	assert.Equal([]string{"strip", "scan"}, order)
+}
+
+func TestCommandProcessor(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test uses a POSIX shell")
+	}
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "bond-process-command")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "archive.tgz")
+	require.NoError(t, ioutil.WriteFile(fn, []byte("archive"), 0644))
+
+	recompress := &CommandProcessor{Label: "recompress", Command: []string{"sh", "-c", `echo "$BOND_ARCHIVE_URL" > "$0"`}}
+	assert.Equal("recompress", recompress.Name())
+	require.NoError(t, recompress.Process(ctx, &Artifact{Path: fn, URL: "https://example.net/archive.tgz"}))
+	data, err := ioutil.ReadFile(fn)
+	require.NoError(t, err)
+	assert.Equal("https://example.net/archive.tgz\n", string(data))
+
+	err = (&CommandProcessor{Command: []string{"sh", "-c", "echo corrupt; exit 1"}}).Process(ctx, &Artifact{Path: fn})
+	require.Error(t, err)
+	assert.Contains(err.Error(), "corrupt")
+	assert.Error((&CommandProcessor{}).Process(ctx, &Artifact{Path: fn}))
+}
+
+func TestMetadataProcessor(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-process-metadata")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "archive.tgz")
+	require.NoError(t, ioutil.WriteFile(fn, []byte("hello"), 0644))
+
+	p := &MetadataProcessor{}
+	require.NoError(t, p.Process(context.Background(), &Artifact{Path: fn, URL: "https://example.net/archive.tgz"}))
+
+	data, err := ioutil.ReadFile(fn + MetadataFileSuffix)
+	require.NoError(t, err)
+	meta := ArtifactMetadata{}
+	require.NoError(t, json.Unmarshal(data, &meta))
+	assert.Equal("archive.tgz", meta.Name)
+	assert.Equal("https://example.net/archive.tgz", meta.URL)
+	assert.EqualValues(5, meta.Size)
+	assert.Equal(SHA256, meta.Checksum.Algorithm)
+	assert.Equal("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", meta.Checksum.Value)
+	assert.False(meta.Processed.IsZero())
+
+	assert.Error(p.Process(context.Background(), &Artifact{Path: filepath.Join(dir, "missing.tgz")}))
+}
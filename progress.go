@@ -0,0 +1,84 @@
+package bond
+
+import "io"
+
+// progressInterval is how many bytes a download writes between
+// reports of its progress.
+const progressInterval = 1024 * 1024
+
+// DownloadProgress reports the progress of a download.
+type DownloadProgress struct {
+	URL      string `bson:"url" json:"url" yaml:"url"`
+	FileName string `bson:"file" json:"file" yaml:"file"`
+	// Written is the number of bytes of the file written,
+	// including those of the partial download it resumed, if any.
+	Written int64 `bson:"written" json:"written" yaml:"written"`
+	// Total is the size of the file, or zero if the server did
+	// not report it.
+	Total int64 `bson:"total,omitempty" json:"total,omitempty" yaml:"total,omitempty"`
+	// Resumed reports whether the download resumed a partial
+	// download.
+	Resumed bool `bson:"resumed,omitempty" json:"resumed,omitempty" yaml:"resumed,omitempty"`
+	// Complete reports whether the download has finished.
+	Complete bool `bson:"complete,omitempty" json:"complete,omitempty" yaml:"complete,omitempty"`
+}
+
+// ProgressFunc receives reports of the progress of downloads: one
+// when a download starts writing, one for roughly every megabyte it
+// writes, and one when it completes. Downloads that fail stop
+// reporting. Concurrent downloads report concurrently, so functions
+// must be safe for concurrent use, and should return quickly.
+type ProgressFunc func(DownloadProgress)
+
+// WithProgress sets the function that receives reports of the
+// progress of the Config's downloads.
+func WithProgress(fn ProgressFunc) Option { return func(c *Config) { c.Progress = fn } }
+
+// getProgress returns the Config's progress function, or nil.
+func (c *Config) getProgress() ProgressFunc {
+	if c == nil {
+		return nil
+	}
+
+	return c.Progress
+}
+
+// progressWriter reports the progress of the writes of a download.
+type progressWriter struct {
+	w        io.Writer
+	report   ProgressFunc
+	progress DownloadProgress
+	reported int64
+}
+
+// newProgressWriter wraps the writer of a download, if there is a
+// progress function, and reports its start.
+func newProgressWriter(w io.Writer, report ProgressFunc, progress DownloadProgress) io.Writer {
+	if report == nil {
+		return w
+	}
+
+	pw := &progressWriter{w: w, report: report, progress: progress, reported: progress.Written}
+	report(progress)
+	return pw
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.progress.Written += int64(n)
+	if w.progress.Written-w.reported >= progressInterval {
+		w.reported = w.progress.Written
+		w.report(w.progress)
+	}
+
+	return n, err
+}
+
+// complete reports the completion of the download written to w, if
+// it reports progress.
+func complete(w io.Writer) {
+	if pw, ok := w.(*progressWriter); ok {
+		pw.progress.Complete = true
+		pw.report(pw.progress)
+	}
+}
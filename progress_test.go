@@ -0,0 +1,74 @@
+package bond
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadProgress(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	content := bytes.Repeat([]byte("x"), 3*progressInterval+10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "archive.tgz", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "bond-progress")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var (
+		mutex   sync.Mutex
+		reports []DownloadProgress
+	)
+	conf := NewConfig(WithProgress(func(p DownloadProgress) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		reports = append(reports, p)
+	}))
+
+	fn := filepath.Join(dir, "a.tgz")
+	require.NoError(t, conf.DownloadFile(ctx, srv.URL, fn))
+	require.True(t, len(reports) >= 4, "%d reports", len(reports))
+	assert.Equal(DownloadProgress{URL: srv.URL, FileName: fn, Total: int64(len(content))}, reports[0])
+	for idx := 1; idx < len(reports)-1; idx++ {
+		assert.True(reports[idx].Written-reports[idx-1].Written >= progressInterval, "report %d", idx)
+		assert.False(reports[idx].Complete)
+	}
+	assert.Equal(DownloadProgress{URL: srv.URL, FileName: fn, Written: int64(len(content)), Total: int64(len(content)), Complete: true}, reports[len(reports)-1])
+
+	// a resumed download reports the bytes of the partial download
+	reports = nil
+	fn = filepath.Join(dir, "b.tgz")
+	require.NoError(t, ioutil.WriteFile(PartialFileName(fn), content[:2*progressInterval], 0644))
+	require.NoError(t, writeDownloadState(fn, DownloadState{URL: srv.URL, Written: 2 * progressInterval, Total: int64(len(content))}))
+	require.NoError(t, conf.ResumeDownloadFile(ctx, srv.URL, fn, nil))
+	require.True(t, len(reports) >= 2, "%d reports", len(reports))
+	assert.True(reports[0].Resumed)
+	assert.EqualValues(2*progressInterval, reports[0].Written)
+	last := reports[len(reports)-1]
+	assert.True(last.Complete)
+	assert.EqualValues(len(content), last.Written)
+
+	data, err := ioutil.ReadFile(fn)
+	require.NoError(t, err)
+	assert.Equal(content, data)
+
+	// without a progress function, downloads do not report
+	reports = nil
+	require.NoError(t, NewConfig().ResumeDownloadFile(ctx, srv.URL, filepath.Join(dir, "c.tgz"), nil))
+	assert.Len(reports, 0)
+}
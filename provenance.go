@@ -0,0 +1,201 @@
+package bond
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ProvenanceFileName is the name of the file, within an extracted
+// build, that records the provenance of its archive.
+const ProvenanceFileName = ".bond-provenance.json"
+
+// The types of provenance documents, which are in-toto statements
+// with a bond predicate.
+const (
+	InTotoStatementType = "https://in-toto.io/Statement/v1"
+	ProvenancePredicate = "https://github.com/tychoish/bond/provenance/v1"
+)
+
+// The results of the verifiers in a provenance document.
+const (
+	VerifierPassed  = "passed"
+	VerifierSkipped = "skipped"
+)
+
+// Provenance is an in-toto statement that records where a cached
+// build's archive came from and how it was checked, for auditing the
+// binaries that enter a build system.
+type Provenance struct {
+	Type          string              `bson:"_type" json:"_type" yaml:"_type"`
+	Subject       []ProvenanceSubject `bson:"subject" json:"subject" yaml:"subject"`
+	PredicateType string              `bson:"predicateType" json:"predicateType" yaml:"predicateType"`
+	Predicate     ArchiveProvenance   `bson:"predicate" json:"predicate" yaml:"predicate"`
+}
+
+// ProvenanceSubject identifies an archive by its name and digests.
+type ProvenanceSubject struct {
+	Name   string            `bson:"name" json:"name" yaml:"name"`
+	Digest map[string]string `bson:"digest" json:"digest" yaml:"digest"`
+}
+
+// ArchiveProvenance is the predicate of a provenance document.
+type ArchiveProvenance struct {
+	// URL is the archive's address in the feed, and DownloadedFrom
+	// is the address it was downloaded from, when a mirror
+	// replaced it.
+	URL            string `bson:"url" json:"url" yaml:"url"`
+	DownloadedFrom string `bson:"downloaded_from,omitempty" json:"downloaded_from,omitempty" yaml:"downloaded_from,omitempty"`
+	// Checksums are the checksums that the feed publishes for the
+	// archive.
+	Checksums []Checksum           `bson:"checksums,omitempty" json:"checksums,omitempty" yaml:"checksums,omitempty"`
+	Verifiers []ProvenanceVerifier `bson:"verifiers" json:"verifiers" yaml:"verifiers"`
+	Started   time.Time            `bson:"started" json:"started" yaml:"started"`
+	Finished  time.Time            `bson:"finished" json:"finished" yaml:"finished"`
+	Verified  time.Time            `bson:"verified" json:"verified" yaml:"verified"`
+	// Warnings describe substitutions of the requested build, such
+	// as a fallback to a generic Linux build.
+	Warnings []string `bson:"warnings,omitempty" json:"warnings,omitempty" yaml:"warnings,omitempty"`
+}
+
+// ProvenanceVerifier is the result of a step of the verification of
+// the archive.
+type ProvenanceVerifier struct {
+	Name   string `bson:"name" json:"name" yaml:"name"`
+	Result string `bson:"result" json:"result" yaml:"result"`
+}
+
+// NewProvenance builds the provenance document of a downloaded and
+// verified archive, which was downloaded between the start and
+// finish times. The document's subject always has the archive's
+// SHA256 digest, and the digest of the checksum that verified it.
+func NewProvenance(a *Artifact, v Verification, started, finished time.Time) (Provenance, error) {
+	sum, err := FileChecksum(a.Path, SHA256)
+	if err != nil {
+		return Provenance{}, err
+	}
+
+	digest := map[string]string{string(SHA256): sum.Value}
+	if v.Checksum.Value != "" {
+		digest[string(v.Checksum.Algorithm)] = strings.ToLower(v.Checksum.Value)
+	}
+
+	out := Provenance{
+		Type:          InTotoStatementType,
+		Subject:       []ProvenanceSubject{{Name: filepath.Base(a.Path), Digest: digest}},
+		PredicateType: ProvenancePredicate,
+		Predicate: ArchiveProvenance{
+			URL:       a.URL,
+			Checksums: a.Checksums,
+			Verifiers: []ProvenanceVerifier{},
+			Started:   started,
+			Finished:  finished,
+			Verified:  v.Verified,
+		},
+	}
+	if mirrored := a.conf.MirrorURL(a.URL); mirrored != a.URL {
+		out.Predicate.DownloadedFrom = mirrored
+	}
+	for _, name := range v.Verifiers {
+		out.Predicate.Verifiers = append(out.Predicate.Verifiers, ProvenanceVerifier{Name: name, Result: VerifierPassed})
+	}
+	for _, name := range v.Skipped {
+		out.Predicate.Verifiers = append(out.Predicate.Verifiers, ProvenanceVerifier{Name: name, Result: VerifierSkipped})
+	}
+
+	return out, nil
+}
+
+// Digest returns the subject's digest with the algorithm, or an
+// empty string if the document does not have it.
+func (p Provenance) Digest(alg ChecksumAlgorithm) string {
+	if len(p.Subject) == 0 {
+		return ""
+	}
+
+	return p.Subject[0].Digest[string(alg)]
+}
+
+// WriteProvenance records the provenance document in the extracted
+// build directory, where the catalog reads it.
+func WriteProvenance(buildDir string, p Provenance) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "problem converting provenance to json")
+	}
+
+	fn := filepath.Join(buildDir, ProvenanceFileName)
+	return errors.Wrapf(ioutil.WriteFile(fn, data, 0644), "problem writing %s", fn)
+}
+
+// ReadProvenance reads the provenance document recorded in the
+// extracted build directory. The second value is false if the build
+// has no recorded provenance.
+func ReadProvenance(buildDir string) (Provenance, bool, error) {
+	data, err := ioutil.ReadFile(filepath.Join(buildDir, ProvenanceFileName))
+	if os.IsNotExist(err) {
+		return Provenance{}, false, nil
+	}
+	if err != nil {
+		return Provenance{}, false, errors.Wrapf(err, "problem reading provenance for %s", buildDir)
+	}
+
+	p := Provenance{}
+	if err = json.Unmarshal(data, &p); err != nil {
+		return Provenance{}, false, errors.Wrapf(err, "problem parsing provenance for %s", buildDir)
+	}
+
+	return p, true, nil
+}
+
+// BuildProvenance is the provenance of a build in a catalog.
+type BuildProvenance struct {
+	Build      string       `bson:"build" json:"build" yaml:"build"`
+	Version    string       `bson:"version" json:"version" yaml:"version"`
+	Options    BuildOptions `bson:"options" json:"options" yaml:"options"`
+	Provenance *Provenance  `bson:"provenance,omitempty" json:"provenance,omitempty" yaml:"provenance,omitempty"`
+}
+
+// Provenance returns the provenance document of the build at the
+// path. The second value is false if the build has no recorded
+// provenance, as is the case for builds downloaded by older versions
+// of bond.
+func (c *BuildCatalog) Provenance(path string) (Provenance, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	p, ok := c.provenance[path]
+	return p, ok
+}
+
+// Provenances returns the provenance of the catalog's builds, sorted
+// by path, optionally limited to the builds of a version. Builds
+// without recorded provenance are included, with a nil document, so
+// that audits can flag them.
+func (c *BuildCatalog) Provenances(version string) []BuildProvenance {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	out := []BuildProvenance{}
+	for info, path := range c.table {
+		if version != "" && info.Version != version {
+			continue
+		}
+
+		bp := BuildProvenance{Build: path, Version: info.Version, Options: info.Options}
+		if p, ok := c.provenance[path]; ok {
+			bp.Provenance = &p
+		}
+		out = append(out, bp)
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Build < out[j].Build })
+
+	return out
+}
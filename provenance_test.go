@@ -0,0 +1,99 @@
+package bond
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvenance(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-provenance")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+
+	build := writeTestBuild(t, dir, "mongodb-linux-x86_64-ubuntu1604-3.6.0")
+	writeTestBuild(t, dir, "mongodb-linux-x86_64-ubuntu1604-3.4.0")
+	archive := build + ".tgz"
+	require.NoError(t, ioutil.WriteFile(archive, []byte("archive"), 0644))
+	sum, err := FileChecksum(archive, SHA256)
+	require.NoError(t, err)
+	md5sum, err := FileChecksum(archive, MD5)
+	require.NoError(t, err)
+
+	conf := NewConfig(WithMirror("https://mirror.example.net/mongodb"))
+	a := &Artifact{Path: archive, URL: "https://fastdl.mongodb.org/linux/" + filepath.Base(archive), Checksums: []Checksum{md5sum}}
+	started := time.Now().Add(-time.Minute)
+	finished := time.Now()
+
+	v, err := conf.Verify(context.Background(), a)
+	require.NoError(t, err)
+	p, err := NewProvenance(a, v, started, finished)
+	require.NoError(t, err)
+
+	assert.Equal(InTotoStatementType, p.Type)
+	assert.Equal(ProvenancePredicate, p.PredicateType)
+	require.Len(t, p.Subject, 1)
+	assert.Equal(filepath.Base(archive), p.Subject[0].Name)
+	assert.Equal(sum.Value, p.Digest(SHA256))
+	assert.Equal(md5sum.Value, p.Digest(MD5))
+	assert.Equal("", p.Digest(SHA512))
+	assert.Equal(a.URL, p.Predicate.URL)
+	assert.Equal("https://mirror.example.net/mongodb/linux/"+filepath.Base(archive), p.Predicate.DownloadedFrom)
+	assert.Equal([]ProvenanceVerifier{{Name: "size", Result: VerifierPassed}, {Name: "checksum", Result: VerifierPassed}}, p.Predicate.Verifiers)
+	assert.True(p.Predicate.Started.Equal(started))
+	assert.False(p.Predicate.Verified.IsZero())
+
+	// without a mirror or published checksums
+	a = &Artifact{Path: archive, URL: "https://fastdl.mongodb.org/linux/" + filepath.Base(archive)}
+	v, err = NewConfig().Verify(context.Background(), a)
+	require.NoError(t, err)
+	unverified, err := NewProvenance(a, v, started, finished)
+	require.NoError(t, err)
+	assert.Empty(unverified.Predicate.DownloadedFrom)
+	assert.Len(unverified.Subject[0].Digest, 1)
+	assert.Contains(unverified.Predicate.Verifiers, ProvenanceVerifier{Name: "checksum", Result: VerifierSkipped})
+
+	_, ok, err := ReadProvenance(build)
+	require.NoError(t, err)
+	assert.False(ok)
+	require.NoError(t, WriteProvenance(build, p))
+	read, ok, err := ReadProvenance(build)
+	require.NoError(t, err)
+	assert.True(ok)
+	assert.Equal(p.Subject, read.Subject)
+	assert.Equal(p.Predicate.Verifiers, read.Predicate.Verifiers)
+
+	catalog := &BuildCatalog{Path: dir, table: map[BuildInfo]string{}, verified: map[string]Verification{}, provenance: map[string]Provenance{}}
+	require.NoError(t, catalog.Add(build))
+	require.NoError(t, catalog.Add(filepath.Join(dir, "mongodb-linux-x86_64-ubuntu1604-3.4.0")))
+
+	recorded, ok := catalog.Provenance(build)
+	assert.True(ok)
+	assert.Equal(sum.Value, recorded.Digest(SHA256))
+
+	all := catalog.Provenances("")
+	require.Len(t, all, 2)
+	assert.Equal("3.4.0", all[0].Version)
+	assert.Nil(all[0].Provenance)
+	require.NotNil(t, all[1].Provenance)
+	assert.Equal(build, all[1].Build)
+
+	assert.Len(catalog.Provenances("3.6.0"), 1)
+	assert.Len(catalog.Provenances("4.0.0"), 0)
+
+	// the provenance describes the catalog's copy, not installations
+	dest := filepath.Join(dir, "installed")
+	require.NoError(t, catalog.Install("3.6.0", dest, InstallOptions{}))
+	_, err = os.Stat(filepath.Join(dest, ProvenanceFileName))
+	assert.True(os.IsNotExist(err))
+}
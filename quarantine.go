@@ -0,0 +1,70 @@
+package bond
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// QuarantineDirName is the name of the directory, in a cache
+// directory, of files that failed verification. Quarantined files
+// are kept for inspection rather than removed, and are never used as
+// builds.
+const QuarantineDirName = ".quarantine"
+
+// QuarantinedFile describes a file in a cache's quarantine.
+type QuarantinedFile struct {
+	Path        string    `bson:"path" json:"path" yaml:"path"`
+	Size        int64     `bson:"size" json:"size" yaml:"size"`
+	Quarantined time.Time `bson:"quarantined" json:"quarantined" yaml:"quarantined"`
+}
+
+// Quarantine moves the file into the quarantine of its directory, and
+// returns its new path. A quarantined file with the same name is
+// replaced.
+func Quarantine(fileName string) (string, error) {
+	dir := filepath.Join(filepath.Dir(fileName), QuarantineDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", errors.Wrapf(err, "problem creating quarantine %s", dir)
+	}
+
+	target := filepath.Join(dir, filepath.Base(fileName))
+	if err := os.Rename(fileName, target); err != nil {
+		return "", errors.Wrapf(err, "problem quarantining %s", fileName)
+	}
+
+	// the modification time records when the file was quarantined
+	now := time.Now()
+	_ = os.Chtimes(target, now, now)
+
+	return target, nil
+}
+
+// GetQuarantinedFiles returns the files in the quarantine of the
+// directory, oldest first.
+func GetQuarantinedFiles(path string) ([]QuarantinedFile, error) {
+	dir := filepath.Join(path, QuarantineDirName)
+	contents, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []QuarantinedFile{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading quarantine %s", dir)
+	}
+
+	out := make([]QuarantinedFile, 0, len(contents))
+	for _, info := range contents {
+		out = append(out, QuarantinedFile{
+			Path:        filepath.Join(dir, info.Name()),
+			Size:        info.Size(),
+			Quarantined: info.ModTime(),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Quarantined.Before(out[j].Quarantined) })
+
+	return out, nil
+}
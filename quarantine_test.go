@@ -0,0 +1,40 @@
+package bond
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuarantine(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-quarantine")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files, err := GetQuarantinedFiles(dir)
+	require.NoError(t, err)
+	assert.Len(files, 0)
+
+	fn := filepath.Join(dir, "mongodb-linux-x86_64-4.4.1.tgz")
+	require.NoError(t, ioutil.WriteFile(fn, []byte("corrupt"), 0644))
+	target, err := Quarantine(fn)
+	require.NoError(t, err)
+	assert.Equal(filepath.Join(dir, QuarantineDirName, "mongodb-linux-x86_64-4.4.1.tgz"), target)
+	_, err = os.Stat(fn)
+	assert.True(os.IsNotExist(err))
+
+	files, err = GetQuarantinedFiles(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(target, files[0].Path)
+	assert.EqualValues(len("corrupt"), files[0].Size)
+
+	_, err = Quarantine(fn)
+	assert.Error(err)
+}
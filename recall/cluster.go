@@ -0,0 +1,314 @@
+package recall
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/jobs"
+)
+
+// ClusterRole is the role of a node of a cluster.
+type ClusterRole string
+
+// The roles of the nodes of a cluster. Shard and config server nodes
+// run mongod, and router nodes run mongos.
+const (
+	ShardRole        ClusterRole = "shard"
+	ConfigServerRole ClusterRole = "config"
+	MongosRole       ClusterRole = "mongos"
+)
+
+// Binary returns the name of the binary that nodes of the role run.
+func (r ClusterRole) Binary() string {
+	if r == MongosRole {
+		return "mongos"
+	}
+	return "mongod"
+}
+
+// ClusterMembers are nodes of a cluster that share a role and a
+// version, such as a shard's replica set.
+type ClusterMembers struct {
+	// Name of the members, which defaults to the role, and for
+	// shards to shard0, shard1, and so on.
+	Name string `bson:"name,omitempty" json:"name,omitempty" yaml:"name,omitempty"`
+	// Version is a release or a series, which resolves as the
+	// positional arguments of recall download do, and defaults
+	// to the topology's version.
+	Version string `bson:"version,omitempty" json:"version,omitempty" yaml:"version,omitempty"`
+	// Nodes is the number of nodes, which defaults to one for
+	// shards. Topologies without config servers or routers leave
+	// theirs at zero.
+	Nodes int `bson:"nodes,omitempty" json:"nodes,omitempty" yaml:"nodes,omitempty"`
+}
+
+// UnmarshalJSON decodes the members, with the number of nodes as a
+// number or, as in YAML topologies, as a string.
+func (m *ClusterMembers) UnmarshalJSON(data []byte) error {
+	type members ClusterMembers
+	doc := struct {
+		*members
+		Nodes json.Number `json:"nodes,omitempty"`
+	}{members: (*members)(m)}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	if doc.Nodes == "" {
+		m.Nodes = 0
+		return nil
+	}
+	nodes, err := doc.Nodes.Int64()
+	if err != nil {
+		return errors.Wrapf(err, "'%s' is not a number of nodes", doc.Nodes)
+	}
+	m.Nodes = int(nodes)
+
+	return nil
+}
+
+// ClusterTopology describes the nodes of a test cluster, and the
+// version that each runs, such as a sharded cluster in the middle of
+// an upgrade, or a replica set, which is a topology with one shard.
+type ClusterTopology struct {
+	// Version is the default version of the nodes.
+	Version       string            `bson:"version,omitempty" json:"version,omitempty" yaml:"version,omitempty"`
+	Options       bond.BuildOptions `bson:"options" json:"options" yaml:"options"`
+	Shards        []ClusterMembers  `bson:"shards" json:"shards" yaml:"shards"`
+	ConfigServers ClusterMembers    `bson:"config_servers,omitempty" json:"config_servers,omitempty" yaml:"config_servers,omitempty"`
+	Mongos        ClusterMembers    `bson:"mongos,omitempty" json:"mongos,omitempty" yaml:"mongos,omitempty"`
+}
+
+// ReadClusterTopology reads a topology from a file, as JSON or as
+// YAML, with the YAML support of ReadManifest.
+func ReadClusterTopology(path string) (*ClusterTopology, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading topology %s", path)
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		doc, err := decodeYAML(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem parsing topology %s", path)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, errors.Wrap(err, "problem converting topology")
+		}
+	}
+
+	t := &ClusterTopology{}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, errors.Wrapf(err, "problem parsing topology %s", path)
+	}
+
+	return t, nil
+}
+
+// Validate returns an error if the topology has no shards, if any
+// nodes have no version, or if it has config servers without routers
+// or routers without config servers.
+func (t ClusterTopology) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(len(t.Shards) == 0, "must specify at least one shard")
+	catcher.Wrap(t.Options.Validate(), "invalid build options")
+	catcher.NewWhen((t.ConfigServers.Nodes > 0) != (t.Mongos.Nodes > 0), "sharded clusters must have both config servers and routers")
+
+	names := map[string]bool{}
+	for _, group := range t.groups() {
+		catcher.ErrorfWhen(group.members.Nodes < 0, "%s must not have a negative number of nodes", group.members.Name)
+		catcher.ErrorfWhen(group.members.Nodes > 0 && group.members.Version == "", "%s must specify a version, or the topology a default version", group.members.Name)
+		catcher.ErrorfWhen(group.members.Nodes > 0 && names[group.members.Name], "topology has more than one group of nodes named %s", group.members.Name)
+		names[group.members.Name] = names[group.members.Name] || group.members.Nodes > 0
+	}
+
+	return catcher.Resolve()
+}
+
+type clusterGroup struct {
+	role    ClusterRole
+	members ClusterMembers
+}
+
+// groups returns the groups of nodes of the topology, with their
+// defaults.
+func (t ClusterTopology) groups() []clusterGroup {
+	out := make([]clusterGroup, 0, len(t.Shards)+2)
+	for idx, shard := range t.Shards {
+		if shard.Name == "" {
+			shard.Name = fmt.Sprintf("shard%d", idx)
+		}
+		if shard.Nodes == 0 {
+			shard.Nodes = 1
+		}
+		out = append(out, clusterGroup{role: ShardRole, members: shard})
+	}
+
+	for _, group := range []clusterGroup{{ConfigServerRole, t.ConfigServers}, {MongosRole, t.Mongos}} {
+		if group.members.Name == "" {
+			group.members.Name = string(group.role)
+		}
+		out = append(out, group)
+	}
+
+	for idx := range out {
+		if out[idx].members.Version == "" {
+			out[idx].members.Version = t.Version
+		}
+	}
+
+	return out
+}
+
+// ClusterNode is a node of a provisioned cluster, and the paths of
+// its build.
+type ClusterNode struct {
+	// Name is the name of the node's group with the node's index
+	// (e.g. shard0-1).
+	Name    string      `bson:"name" json:"name" yaml:"name"`
+	Role    ClusterRole `bson:"role" json:"role" yaml:"role"`
+	Version string      `bson:"version" json:"version" yaml:"version"`
+	// Build is the node's build directory, and Binary is the
+	// mongod or mongos executable in it.
+	Build  string `bson:"build" json:"build" yaml:"build"`
+	Binary string `bson:"binary" json:"binary" yaml:"binary"`
+}
+
+// ClusterManifest lists the binaries of each node of a provisioned
+// cluster, in the order of the topology: the shards, then the config
+// servers, then the routers.
+type ClusterManifest struct {
+	Path  string        `bson:"path" json:"path" yaml:"path"`
+	Nodes []ClusterNode `bson:"nodes" json:"nodes" yaml:"nodes"`
+}
+
+// Node returns the node with the name.
+func (m *ClusterManifest) Node(name string) (ClusterNode, bool) {
+	for _, node := range m.Nodes {
+		if node.Name == name {
+			return node, true
+		}
+	}
+
+	return ClusterNode{}, false
+}
+
+// ProvisionCluster downloads and extracts the build of every version
+// of the topology into the path, through a single queue with the
+// queue options, and returns the paths of the binaries of each node.
+// Nodes that share a version share a build, which is downloaded once.
+// ProvisionCluster returns an error, and no manifest, if any version
+// does not resolve, any download fails, or any build is missing a
+// node's binary.
+func ProvisionCluster(ctx context.Context, qopts QueueOptions, t ClusterTopology, path string, opts ...bond.Option) (*ClusterManifest, error) {
+	if err := t.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid cluster topology")
+	}
+
+	conf := bond.NewConfig(opts...)
+	if path == "" {
+		path = conf.CachePath
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem resolving absolute path")
+	}
+
+	feed, err := loadFeed(ctx, path, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem generating data feed")
+	}
+
+	// resolve each version to its archive, so that the nodes use
+	// the builds that the downloads extract
+	catcher := grip.NewBasicCatcher()
+	builds := map[string]string{}
+	urls := []string{}
+	for _, group := range t.groups() {
+		version := group.members.Version
+		if _, ok := builds[version]; ok || group.members.Nodes == 0 {
+			continue
+		}
+
+		archives, errs := feed.GetArchives([]string{version}, t.Options)
+		for url := range archives {
+			if _, ok := builds[version]; ok {
+				continue
+			}
+			item, err := newPlanItem(version, t.Options, url, path)
+			if err != nil {
+				catcher.Add(err)
+				continue
+			}
+			builds[version] = strings.TrimSuffix(item.File, filepath.Ext(item.File))
+			urls = append(urls, url)
+		}
+		for err := range errs {
+			catcher.Add(errors.Wrapf(err, "problem resolving %s %s", version, t.Options))
+		}
+	}
+	if catcher.HasErrors() {
+		return nil, catcher.Resolve()
+	}
+
+	err = runDownloads(ctx, nil, qopts, conf, path, func(ctx context.Context, q amboy.Queue, budget *RetryBudget, catcher grip.Catcher) error {
+		queued := make(chan string, len(urls))
+		for _, url := range urls {
+			queued <- url
+		}
+		close(queued)
+
+		downloads, errs := createJobs(feed, conf, budget, qopts, path, queued)
+		if qopts.persistent() {
+			downloads = skipQueued(ctx, q, downloads)
+		}
+		if err := jobs.Populate(ctx, q, downloads, qopts.workers(conf)); err != nil {
+			return errors.Wrap(err, "problem adding jobs to queue")
+		}
+		catcher.Add(aggregateErrors(errs))
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "problem provisioning cluster builds")
+	}
+
+	m := &ClusterManifest{Path: path}
+	for _, group := range t.groups() {
+		build := builds[group.members.Version]
+		binary := filepath.Join(build, "bin", group.role.Binary())
+		if strings.Contains(t.Options.Target, "windows") {
+			binary += ".exe"
+		}
+		if group.members.Nodes > 0 {
+			if _, err := os.Stat(binary); err != nil {
+				catcher.Add(errors.Wrapf(err, "build of %s for %s has no %s", group.members.Version, group.members.Name, group.role.Binary()))
+				continue
+			}
+		}
+
+		for idx := 0; idx < group.members.Nodes; idx++ {
+			m.Nodes = append(m.Nodes, ClusterNode{
+				Name:    fmt.Sprintf("%s-%d", group.members.Name, idx),
+				Role:    group.role,
+				Version: group.members.Version,
+				Build:   build,
+				Binary:  binary,
+			})
+		}
+	}
+	if catcher.HasErrors() {
+		return nil, catcher.Resolve()
+	}
+
+	return m, nil
+}
@@ -0,0 +1,140 @@
+package recall
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/testutil"
+)
+
+var clusterTestOptions = bond.BuildOptions{
+	Target:  testutil.DefaultBuild.Target,
+	Arch:    testutil.DefaultBuild.Arch,
+	Edition: testutil.DefaultBuild.Edition,
+}
+
+func TestClusterTopologyValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(ClusterTopology{}.Validate())
+	assert.Error(ClusterTopology{Shards: []ClusterMembers{{Version: "7.0.2"}}}.Validate())
+	assert.NoError(ClusterTopology{Options: clusterTestOptions, Shards: []ClusterMembers{{Version: "7.0.2", Nodes: 3}}}.Validate())
+
+	// nodes need a version
+	assert.Error(ClusterTopology{Options: clusterTestOptions, Shards: []ClusterMembers{{}}}.Validate())
+	assert.NoError(ClusterTopology{Version: "7.0.2", Options: clusterTestOptions, Shards: []ClusterMembers{{}}}.Validate())
+
+	// sharded clusters need both config servers and routers
+	sharded := ClusterTopology{Version: "7.0.2", Options: clusterTestOptions, Shards: []ClusterMembers{{}, {}}, Mongos: ClusterMembers{Nodes: 1}}
+	assert.Error(sharded.Validate())
+	sharded.ConfigServers.Nodes = 3
+	assert.NoError(sharded.Validate())
+
+	sharded.Shards[1].Name = "shard0"
+	assert.Error(sharded.Validate())
+	sharded.Shards[1].Name = ""
+	sharded.Mongos.Nodes = -1
+	assert.Error(sharded.Validate())
+}
+
+func TestProvisionCluster(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "bond-cluster")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	srv := testutil.NewServer(testutil.Release{Version: "7.0.2"}, testutil.Release{Version: "6.0.9"})
+	defer srv.Close()
+
+	// a cluster in the middle of an upgrade: one shard and the
+	// config servers are upgraded
+	topology := ClusterTopology{
+		Version:       "6.0.9",
+		Options:       clusterTestOptions,
+		Shards:        []ClusterMembers{{Version: "7.0.2", Nodes: 3}, {Nodes: 1}},
+		ConfigServers: ClusterMembers{Version: "7.0.2", Nodes: 1},
+		Mongos:        ClusterMembers{Nodes: 2},
+	}
+	m, err := ProvisionCluster(ctx, QueueOptions{}, topology, dir, srv.Options()...)
+	require.NoError(t, err)
+	require.Len(t, m.Nodes, 7)
+
+	names := []string{}
+	for _, node := range m.Nodes {
+		names = append(names, node.Name)
+		_, err := os.Stat(node.Binary)
+		assert.NoError(err, node.Name)
+		assert.Equal(filepath.Join(node.Build, "bin", node.Role.Binary()), node.Binary)
+	}
+	assert.Equal([]string{"shard0-0", "shard0-1", "shard0-2", "shard1-0", "config-0", "mongos-0", "mongos-1"}, names)
+
+	node, ok := m.Node("shard1-0")
+	require.True(t, ok)
+	assert.Equal(ShardRole, node.Role)
+	assert.Equal("6.0.9", node.Version)
+	assert.Equal("mongodb-linux-x86_64-ubuntu2204-6.0.9", filepath.Base(node.Build))
+
+	node, ok = m.Node("mongos-1")
+	require.True(t, ok)
+	assert.Equal(MongosRole, node.Role)
+	assert.Equal("mongos", filepath.Base(node.Binary))
+	_, ok = m.Node("config-1")
+	assert.False(ok)
+
+	// each version is downloaded once
+	assert.Equal(1, srv.Requests("/linux/"+testutil.DefaultBuild.ArchiveName("7.0.2")))
+	assert.Equal(1, srv.Requests("/linux/"+testutil.DefaultBuild.ArchiveName("6.0.9")))
+
+	topology.Mongos.Version = "5.0.1"
+	_, err = ProvisionCluster(ctx, QueueOptions{}, topology, dir, srv.Options()...)
+	require.Error(t, err)
+	assert.Contains(err.Error(), "5.0.1")
+}
+
+func TestReadClusterTopology(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-cluster-topology")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "topology.yaml")
+	require.NoError(t, ioutil.WriteFile(fn, []byte(`# an upgrading cluster
+version: 6.0.9
+options:
+  target: ubuntu2204
+  arch: x86_64
+  edition: targeted
+shards:
+  - version: 7.0.2
+    nodes: 3
+  - name: legacy
+config_servers:
+  nodes: 1
+mongos:
+  nodes: 2
+`), 0644))
+
+	topology, err := ReadClusterTopology(fn)
+	require.NoError(t, err)
+	assert.NoError(topology.Validate())
+	assert.Equal("6.0.9", topology.Version)
+	assert.Equal(clusterTestOptions, topology.Options)
+	require.Len(t, topology.Shards, 2)
+	assert.Equal(3, topology.Shards[0].Nodes)
+	assert.Equal("legacy", topology.Shards[1].Name)
+	assert.Equal(2, topology.Mongos.Nodes)
+
+	_, err = ReadClusterTopology(filepath.Join(dir, "missing.yaml"))
+	assert.Error(err)
+}
@@ -0,0 +1,437 @@
+package recall
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/dependency"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/registry"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/clock"
+	"github.com/tychoish/bond/driver"
+	"github.com/tychoish/bond/notify"
+)
+
+const (
+	refreshFeedJobTypeName = "bond-recall-refresh-feed"
+	pruneCacheJobTypeName  = "bond-recall-prune-cache"
+)
+
+// DaemonElectionKey is the key of the election of the daemons that
+// share a queue (see RunDaemon).
+const DaemonElectionKey = "recall-daemon"
+
+func init() {
+	registry.AddJobType(refreshFeedJobTypeName, func() amboy.Job { return makeRefreshFeedJob() })
+	registry.AddJobType(pruneCacheJobTypeName, func() amboy.Job { return makePruneCacheJob() })
+}
+
+// DaemonOptions configure a recall daemon (see RunDaemon).
+type DaemonOptions struct {
+	// Candidate identifies the daemon in the election of the
+	// daemons that share its queue, and defaults to the host name
+	// and process ID.
+	Candidate string `bson:"candidate" json:"candidate" yaml:"candidate"`
+	// LeaderTTL is how long the daemons wait for a leader that
+	// has stopped renewing its term before electing another, and
+	// defaults to 30 seconds.
+	LeaderTTL time.Duration `bson:"leader_ttl" json:"leader_ttl" yaml:"leader_ttl"`
+	// FeedRefresh is how often the leader schedules a refresh of
+	// the cache's feed, and defaults to four hours.
+	FeedRefresh time.Duration `bson:"feed_refresh" json:"feed_refresh" yaml:"feed_refresh"`
+	// Prune, if specified, is how often the leader schedules a
+	// garbage collection of the cache, which removes the files
+	// that are not builds, their archives, or feeds, and that
+	// were not modified for PruneMinAge, which defaults to a day.
+	Prune       time.Duration `bson:"prune" json:"prune" yaml:"prune"`
+	PruneMinAge time.Duration `bson:"prune_min_age" json:"prune_min_age" yaml:"prune_min_age"`
+	// Clock, if specified, times the schedules and the election.
+	Clock clock.Clock `bson:"-" json:"-" yaml:"-"`
+}
+
+// Validate returns an error if the options are invalid, and sets
+// defaults for unspecified values.
+func (o *DaemonOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(o.LeaderTTL < 0, "leader ttl must not be negative")
+	catcher.NewWhen(o.FeedRefresh < 0, "feed refresh interval must not be negative")
+	catcher.NewWhen(o.Prune < 0, "prune interval must not be negative")
+	catcher.NewWhen(o.PruneMinAge < 0, "prune minimum age must not be negative")
+	if catcher.HasErrors() {
+		return catcher.Resolve()
+	}
+
+	if o.Candidate == "" {
+		host, _ := os.Hostname()
+		o.Candidate = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if o.LeaderTTL == 0 {
+		o.LeaderTTL = 30 * time.Second
+	}
+	if o.FeedRefresh == 0 {
+		o.FeedRefresh = 4 * time.Hour
+	}
+	if o.PruneMinAge == 0 {
+		o.PruneMinAge = 24 * time.Hour
+	}
+	o.Clock = clock.Or(o.Clock)
+
+	return nil
+}
+
+// RunDaemon runs the workers of the queue, which run the downloads
+// that other recall commands submit to a persistent queue, until the
+// context is done, and schedules the recurring jobs of the cache path:
+// the feed refresh and, optionally, the garbage collection. Several
+// daemons may share a persistent queue for availability: they elect a
+// leader through the queue's driver (see driver.StoredLocker and
+// driver.Election), and only the leader schedules the recurring jobs,
+// which any daemon's workers may run. When the leader stops, or can no
+// longer reach the queue, another daemon is elected once the leader's
+// term expires. Daemons with a local queue are always the leader.
+//
+// Each recurring job has the ID of its period, so that a leader that
+// is elected in the middle of a period does not schedule the job
+// again, and holds a keyed lock on the cache path while it runs, so
+// that the jobs do not read the feed while another job writes it. The
+// options (e.g. mirrors) and the lock are not stored with the jobs, so
+// jobs that the workers of other processes run use the default
+// configuration, and do not lock the cache.
+func RunDaemon(ctx context.Context, qopts QueueOptions, path string, opts DaemonOptions, configs ...bond.Option) error {
+	if err := opts.Validate(); err != nil {
+		return errors.Wrap(err, "invalid daemon options")
+	}
+
+	conf := bond.NewConfig(configs...)
+	if path == "" {
+		path = conf.CachePath
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return errors.Wrap(err, "problem resolving absolute path")
+	}
+	if err = os.MkdirAll(path, 0755); err != nil {
+		return errors.Wrapf(err, "problem creating cache directory %s", path)
+	}
+
+	q, d, closer, err := qopts.newQueueWithDriver(ctx, conf)
+	if err != nil {
+		return err
+	}
+	defer closer()
+
+	var locker driver.Locker = driver.NewLockTable(opts.Clock)
+	if d != nil {
+		if locker, err = driver.NewStoredLocker(d, opts.Clock); err != nil {
+			return err
+		}
+	}
+
+	election, err := driver.NewElection(locker, driver.ElectionOptions{
+		Key:       DaemonElectionKey,
+		Candidate: opts.Candidate,
+		TTL:       opts.LeaderTTL,
+		Clock:     opts.Clock,
+	})
+	if err != nil {
+		return err
+	}
+
+	grip.Info(message.Fields{
+		"message":   "starting recall daemon",
+		"candidate": opts.Candidate,
+		"path":      path,
+		"driver":    qopts.Driver,
+	})
+
+	return election.Run(ctx, func(ctx context.Context) error {
+		return scheduleCacheJobs(ctx, q, locker, conf, path, opts)
+	})
+}
+
+// cacheSchedule is a recurring job of the daemon's leader.
+type cacheSchedule struct {
+	interval time.Duration
+	job      func(period time.Time) amboy.Job
+}
+
+// scheduleCacheJobs submits the job of each schedule's current period,
+// and of each period that follows, until the context is done.
+func scheduleCacheJobs(ctx context.Context, q amboy.Queue, locker driver.Locker, conf *bond.Config, path string, opts DaemonOptions) error {
+	schedules := []cacheSchedule{{
+		interval: opts.FeedRefresh,
+		job: func(period time.Time) amboy.Job {
+			j := NewRefreshFeedJob(conf, path, period)
+			j.locker = locker
+			return j
+		},
+	}}
+	if opts.Prune > 0 {
+		schedules = append(schedules, cacheSchedule{
+			interval: opts.Prune,
+			job: func(period time.Time) amboy.Job {
+				j := NewPruneCacheJob(conf, path, opts.PruneMinAge, period)
+				j.locker = locker
+				return j
+			},
+		})
+	}
+
+	for {
+		now := opts.Clock.Now()
+		next := time.Time{}
+		for _, s := range schedules {
+			period := now.Truncate(s.interval)
+			submitScheduled(ctx, q, s.job(period))
+
+			if due := period.Add(s.interval); next.IsZero() || due.Before(next) {
+				next = due
+			}
+		}
+
+		timer := opts.Clock.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C():
+		}
+	}
+}
+
+// submitScheduled adds the job to the queue, unless the queue already
+// has the job of its period.
+func submitScheduled(ctx context.Context, q amboy.Queue, j amboy.Job) {
+	if _, ok := q.Get(ctx, j.ID()); ok {
+		return
+	}
+
+	err := q.Put(ctx, j)
+	grip.Error(message.WrapError(err, message.Fields{
+		"message": "problem scheduling cache job",
+		"job":     j.ID(),
+	}))
+	grip.InfoWhen(err == nil, message.Fields{
+		"message": "scheduled cache job",
+		"job":     j.ID(),
+	})
+}
+
+// configOptions returns the options that reproduce the configuration
+// of a job, which is nil for jobs that were read from a queue.
+func configOptions(conf *bond.Config) []bond.Option {
+	if conf == nil {
+		return nil
+	}
+	return []bond.Option{func(c *bond.Config) { *c = *conf }}
+}
+
+// cacheLockTTL is the TTL of the lock that the cache jobs hold on their
+// cache directory.
+const cacheLockTTL = time.Minute
+
+// withCacheLock runs fn while the job holds the keyed lock of the cache
+// directory, so that the feed refresh and the garbage collection do
+// not read the feed while the other writes it. Jobs without a Locker
+// run fn without the lock.
+func withCacheLock(ctx context.Context, l driver.Locker, j amboy.Job, path string, fn func(context.Context) error) error {
+	if l == nil {
+		return fn(ctx)
+	}
+
+	lock, err := driver.NewLockerLock(l, driver.KeyedLockOptions{
+		Key:   "recall-cache-" + filepath.Clean(path),
+		Owner: j.ID(),
+		TTL:   cacheLockTTL,
+	})
+	if err != nil {
+		return err
+	}
+
+	return lock.Hold(ctx, fn)
+}
+
+// periodJobID returns the ID of the cache's job in the period. IDs
+// have the base name of the cache, for readability, and a hash of its
+// full path, so that the jobs of caches that share a base name (e.g.
+// /a/cache and /b/cache) in one queue do not collide.
+func periodJobID(jobType, path string, period time.Time) string {
+	sum := sha256.Sum256([]byte(filepath.Clean(path)))
+	return fmt.Sprintf("%s-%s-%x-%d", jobType, filepath.Base(path), sum[:6], period.Unix())
+}
+
+// RefreshFeedJob downloads the feed of a cache directory again, so
+// that the cache resolves new releases.
+type RefreshFeedJob struct {
+	Path string `bson:"path" json:"path" yaml:"path"`
+	// Released are the versions in the refreshed feed that were
+	// not in the cache's previous feed, which the job reports as
+	// available to notifiers (see notify.Notifier's Watch). The
+	// first refresh of a cache, which has no previous feed, does
+	// not report versions.
+	Released  []string `bson:"released,omitempty" json:"released,omitempty" yaml:"released,omitempty"`
+	*job.Base `bson:"metadata" json:"metadata" yaml:"metadata"`
+
+	// conf has the download options, and locker the Locker of the
+	// cache's lock, which are not serialized.
+	conf   *bond.Config
+	locker driver.Locker
+}
+
+func makeRefreshFeedJob() *RefreshFeedJob {
+	return &RefreshFeedJob{
+		Base: &job.Base{
+			JobType: amboy.JobType{
+				Name:    refreshFeedJobTypeName,
+				Version: 0,
+			},
+		},
+	}
+}
+
+// NewRefreshFeedJob constructs the job that refreshes the feed of the
+// cache directory in the period.
+func NewRefreshFeedJob(conf *bond.Config, path string, period time.Time) *RefreshFeedJob {
+	j := makeRefreshFeedJob()
+	j.SetID(periodJobID(refreshFeedJobTypeName, path, period))
+	j.SetDependency(dependency.NewAlways())
+	j.Path = path
+	j.conf = conf
+	j.UpdateTimeInfo(amboy.JobTimeInfo{Created: time.Now()})
+
+	return j
+}
+
+// Run downloads the feed.
+func (j *RefreshFeedJob) Run(ctx context.Context) {
+	defer j.MarkComplete()
+
+	feed, err := bond.NewArtifactsFeed(j.Path, configOptions(j.conf)...)
+	if err != nil {
+		j.AddError(err)
+		return
+	}
+
+	j.AddError(withCacheLock(ctx, j.locker, j, j.Path, func(ctx context.Context) error {
+		previous := map[string]bool{}
+		if err := feed.ReloadFile(feedFile(j.Path)); err == nil {
+			for _, v := range feed.Versions {
+				previous[v.Version] = true
+			}
+		}
+
+		if err := feed.Populate(ctx, 0); err != nil {
+			return errors.Wrapf(err, "problem refreshing the feed of %s", j.Path)
+		}
+
+		if len(previous) > 0 {
+			for _, v := range feed.Versions {
+				if !previous[v.Version] {
+					j.Released = append(j.Released, v.Version)
+				}
+			}
+		}
+		return nil
+	}))
+}
+
+// Events reports the releases that appeared in the refreshed feed.
+func (j *RefreshFeedJob) Events() []notify.Event {
+	out := make([]notify.Event, 0, len(j.Released))
+	for _, version := range j.Released {
+		out = append(out, notify.Event{
+			Type:    notify.ReleaseAvailable,
+			Time:    time.Now(),
+			JobID:   j.ID(),
+			JobType: j.Type().Name,
+			Version: version,
+			Path:    j.Path,
+		})
+	}
+
+	return out
+}
+
+// feedFile returns the feed's file in the cache path, as
+// bond.NewArtifactsFeed does.
+func feedFile(path string) string {
+	if strings.HasSuffix(path, ".json") {
+		return path
+	}
+	return filepath.Join(path, "full.json")
+}
+
+// PruneCacheJob collects the garbage of a cache directory (see
+// bond.BuildCatalog.GC), removing the files that are not builds, their
+// archives, or feeds, and were not modified for MinAge.
+type PruneCacheJob struct {
+	Path      string                `bson:"path" json:"path" yaml:"path"`
+	MinAge    time.Duration         `bson:"min_age" json:"min_age" yaml:"min_age"`
+	Report    *bond.CatalogGCReport `bson:"report,omitempty" json:"report,omitempty" yaml:"report,omitempty"`
+	*job.Base `bson:"metadata" json:"metadata" yaml:"metadata"`
+
+	// conf has the feed's download options, and locker the Locker
+	// of the cache's lock, which are not serialized.
+	conf   *bond.Config
+	locker driver.Locker
+}
+
+func makePruneCacheJob() *PruneCacheJob {
+	return &PruneCacheJob{
+		Base: &job.Base{
+			JobType: amboy.JobType{
+				Name:    pruneCacheJobTypeName,
+				Version: 0,
+			},
+		},
+	}
+}
+
+// NewPruneCacheJob constructs the job that prunes the cache directory
+// in the period.
+func NewPruneCacheJob(conf *bond.Config, path string, minAge time.Duration, period time.Time) *PruneCacheJob {
+	j := makePruneCacheJob()
+	j.SetID(periodJobID(pruneCacheJobTypeName, path, period))
+	j.SetDependency(dependency.NewAlways())
+	j.Path = path
+	j.MinAge = minAge
+	j.conf = conf
+	j.UpdateTimeInfo(amboy.JobTimeInfo{Created: time.Now()})
+
+	return j
+}
+
+// Run collects the garbage of the cache.
+func (j *PruneCacheJob) Run(ctx context.Context) {
+	defer j.MarkComplete()
+
+	err := withCacheLock(ctx, j.locker, j, j.Path, func(ctx context.Context) error {
+		catalog, err := bond.NewCatalog(ctx, j.Path, configOptions(j.conf)...)
+		if err != nil {
+			return errors.Wrapf(err, "problem reading the catalog of %s", j.Path)
+		}
+
+		j.Report, err = catalog.GC(bond.CatalogGCOptions{RemoveUnindexed: true, MinAge: j.MinAge})
+		return errors.Wrapf(err, "problem pruning %s", j.Path)
+	})
+	if err != nil {
+		j.AddError(err)
+		return
+	}
+
+	grip.Info(message.Fields{
+		"message": "pruned cache",
+		"path":    j.Path,
+		"report":  j.Report.String(),
+	})
+}
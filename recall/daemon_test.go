@@ -0,0 +1,119 @@
+package recall
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/testutil"
+)
+
+func TestDaemonOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	opts := DaemonOptions{}
+	require.NoError(t, opts.Validate())
+	assert.NotEmpty(opts.Candidate)
+	assert.Equal(30*time.Second, opts.LeaderTTL)
+	assert.Equal(4*time.Hour, opts.FeedRefresh)
+	assert.Equal(time.Duration(0), opts.Prune)
+	assert.Equal(24*time.Hour, opts.PruneMinAge)
+	assert.NotNil(opts.Clock)
+
+	assert.Error((&DaemonOptions{LeaderTTL: -1}).Validate())
+	assert.Error((&DaemonOptions{FeedRefresh: -1}).Validate())
+	assert.Error((&DaemonOptions{Prune: -1}).Validate())
+	assert.Error((&DaemonOptions{PruneMinAge: -1}).Validate())
+}
+
+func TestRunDaemonSchedulesCacheJobs(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	srv := testutil.NewServer(testutil.Release{Version: "7.0.2"})
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "bond-daemon")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	stale := filepath.Join(dir, "stale.tmp")
+	require.NoError(t, ioutil.WriteFile(stale, []byte("stale"), 0644))
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(stale, old, old))
+	fresh := filepath.Join(dir, "fresh.tmp")
+	require.NoError(t, ioutil.WriteFile(fresh, []byte("fresh"), 0644))
+
+	dctx, dcancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- RunDaemon(dctx, QueueOptions{}, dir, DaemonOptions{
+			Candidate: "a",
+			LeaderTTL: time.Second,
+			Prune:     time.Hour,
+		}, srv.Options()...)
+	}()
+
+	// the leader refreshes the feed and prunes the cache as soon
+	// as it's elected
+	for {
+		_, ferr := os.Stat(filepath.Join(dir, "full.json"))
+		_, serr := os.Stat(stale)
+		if ferr == nil && os.IsNotExist(serr) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("daemon did not run its cache jobs")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+
+	dcancel()
+	assert.NoError(<-done)
+	assert.True(srv.Requests(testutil.FeedPath) >= 1)
+	_, err = os.Stat(fresh)
+	assert.NoError(err)
+
+	assert.Error(RunDaemon(ctx, QueueOptions{}, dir, DaemonOptions{LeaderTTL: -1}))
+}
+
+func TestScheduleCacheJobsOncePerPeriod(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	conf := bond.NewConfig()
+	q, closer, err := QueueOptions{}.newQueue(ctx, conf)
+	require.NoError(t, err)
+	defer closer()
+
+	period := time.Now().Truncate(time.Hour)
+	first := NewPruneCacheJob(conf, "/nonexistent/cache", time.Hour, period)
+	submitScheduled(ctx, q, first)
+
+	// a leader elected later in the period finds its job
+	submitScheduled(ctx, q, NewPruneCacheJob(conf, "/nonexistent/cache", time.Hour, period))
+	next := NewPruneCacheJob(conf, "/nonexistent/cache", time.Hour, period.Add(time.Hour))
+	submitScheduled(ctx, q, next)
+	assert.NotEqual(first.ID(), next.ID())
+	// caches with the same base name have their own jobs
+	assert.NotEqual(first.ID(), NewPruneCacheJob(conf, "/other/cache", time.Hour, period).ID())
+	assert.Equal(first.ID(), NewPruneCacheJob(conf, "/nonexistent/./cache/", time.Hour, period).ID())
+
+	require.True(t, amboy.WaitInterval(ctx, q, 10*time.Millisecond))
+	assert.Equal(2, q.Stats(ctx).Total)
+
+	// the cache does not exist, so the jobs fail
+	j, ok := q.Get(ctx, first.ID())
+	require.True(t, ok)
+	assert.Error(j.Error())
+}
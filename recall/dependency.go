@@ -0,0 +1,211 @@
+package recall
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/dependency"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/amboy/registry"
+	"github.com/tychoish/bond/management"
+)
+
+const (
+	oncePerPeriodTypeName = "bond-once-per-period"
+	unlessCompletedName   = "bond-unless-completed"
+)
+
+func init() {
+	registry.AddDependencyType(oncePerPeriodTypeName, func() dependency.Manager {
+		return makeOncePerPeriod()
+	})
+	registry.AddDependencyType(unlessCompletedName, func() dependency.Manager {
+		return makeUnlessCompleted()
+	})
+}
+
+// OncePerPeriod is a dependency.Manager implementation that reports
+// that a job is a noop (Passed) if another job with the same ID
+// prefix has completed within the configured period. Use this
+// dependency to limit how often a recurring piece of work (e.g.
+// refreshing the feed) runs, even when producers submit it more
+// often.
+//
+// The manager uses the completion timestamps stored by the queue's
+// driver and must have access to the queue to resolve its state. The
+// queue is not serialized with the dependency, so dispatch jobs with
+// the dependency through a middleware.DependencyQueue, which attaches
+// its queue to the managers of jobs read from remote drivers, and
+// completes jobs whose dependency passed without running them.
+// Managers without a queue are always Ready.
+type OncePerPeriod struct {
+	Prefix string              `bson:"prefix" json:"prefix" yaml:"prefix"`
+	Period time.Duration       `bson:"period" json:"period" yaml:"period"`
+	T      dependency.TypeInfo `bson:"type" json:"type" yaml:"type"`
+	dependency.JobEdges
+
+	queue amboy.Queue
+}
+
+func makeOncePerPeriod() *OncePerPeriod {
+	return &OncePerPeriod{
+		T: dependency.TypeInfo{
+			Name:    oncePerPeriodTypeName,
+			Version: 0,
+		},
+		JobEdges: dependency.NewJobEdges(),
+	}
+}
+
+// NewOncePerPeriod constructs a OncePerPeriod dependency which checks
+// the queue for completed jobs whose IDs begin with prefix.
+func NewOncePerPeriod(q amboy.Queue, prefix string, period time.Duration) *OncePerPeriod {
+	d := makeOncePerPeriod()
+	d.Prefix = prefix
+	d.Period = period
+	d.queue = q
+
+	return d
+}
+
+// SetQueue attaches a queue to the dependency, which is required for
+// the dependency to resolve to any state other than Ready.
+func (d *OncePerPeriod) SetQueue(q amboy.Queue) { d.queue = q }
+
+// State returns Passed if a job matching the prefix completed within
+// the period, and Ready otherwise. The completed jobs of remote queues
+// are found in the queue's driver (see management.FindJobs), which
+// filters them itself if it can, and other queues are scanned.
+func (d *OncePerPeriod) State() dependency.State {
+	if d.queue == nil || d.Prefix == "" || d.Period <= 0 {
+		return dependency.Ready
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if rq, ok := d.queue.(queue.Remote); ok && rq.Driver() != nil {
+		completed, err := management.FindJobs(ctx, rq.Driver(), management.Filter{
+			Pattern: "^" + regexp.QuoteMeta(d.Prefix),
+			Status:  management.StatusCompleted,
+		})
+		if err == nil {
+			for _, info := range completed {
+				if d.within(info.TimeInfo.End, info.Status.ModificationTime) {
+					return dependency.Passed
+				}
+			}
+			return dependency.Ready
+		}
+	}
+
+	for stat := range d.queue.JobStats(ctx) {
+		if !stat.Completed || !strings.HasPrefix(stat.ID, d.Prefix) {
+			continue
+		}
+
+		j, ok := d.queue.Get(ctx, stat.ID)
+		if !ok {
+			continue
+		}
+
+		if d.within(j.TimeInfo().End, stat.ModificationTime) {
+			return dependency.Passed
+		}
+	}
+
+	return dependency.Ready
+}
+
+// within reports whether a job that ended, or was last modified, at
+// the times completed within the period.
+func (d *OncePerPeriod) within(end, modified time.Time) bool {
+	if end.IsZero() {
+		end = modified
+	}
+
+	return time.Since(end) < d.Period
+}
+
+// Type returns the TypeInfo for the dependency, to support
+// serialization.
+func (d *OncePerPeriod) Type() dependency.TypeInfo { return d.T }
+
+// UnlessCompleted is a dependency.Manager implementation for fallback
+// jobs, which should only run if another job has not completed
+// successfully. For example, a download from a secondary mirror
+// should only run if the download from the primary mirror failed or
+// was never submitted.
+//
+// The state of the dependency is:
+//
+//   - Ready, if the job does not exist or completed with errors.
+//   - Blocked, if the job exists and has not completed.
+//   - Passed, if the job completed without errors.
+//
+// As with OncePerPeriod, the queue is not serialized with the
+// dependency, so dispatch fallbacks through a
+// middleware.DependencyQueue, which holds them while the other job is
+// pending, and completes them without running them if it succeeded.
+// Managers without a queue are always Ready.
+type UnlessCompleted struct {
+	JobID string              `bson:"job_id" json:"job_id" yaml:"job_id"`
+	T     dependency.TypeInfo `bson:"type" json:"type" yaml:"type"`
+	dependency.JobEdges
+
+	queue amboy.Queue
+}
+
+func makeUnlessCompleted() *UnlessCompleted {
+	return &UnlessCompleted{
+		T: dependency.TypeInfo{
+			Name:    unlessCompletedName,
+			Version: 0,
+		},
+		JobEdges: dependency.NewJobEdges(),
+	}
+}
+
+// NewUnlessCompleted constructs an UnlessCompleted dependency that
+// checks the state of the job with the specified ID in the queue.
+func NewUnlessCompleted(q amboy.Queue, id string) *UnlessCompleted {
+	d := makeUnlessCompleted()
+	d.JobID = id
+	d.queue = q
+
+	return d
+}
+
+// SetQueue attaches a queue to the dependency, which is required for
+// the dependency to resolve to any state other than Ready.
+func (d *UnlessCompleted) SetQueue(q amboy.Queue) { d.queue = q }
+
+// State reports the state of the dependency based on the state of
+// the other job.
+func (d *UnlessCompleted) State() dependency.State {
+	if d.queue == nil || d.JobID == "" {
+		return dependency.Ready
+	}
+
+	j, ok := d.queue.Get(context.Background(), d.JobID)
+	if !ok {
+		return dependency.Ready
+	}
+
+	if !j.Status().Completed {
+		return dependency.Blocked
+	}
+
+	if j.Error() != nil {
+		return dependency.Ready
+	}
+
+	return dependency.Passed
+}
+
+// Type returns the TypeInfo for the dependency, to support
+// serialization.
+func (d *UnlessCompleted) Type() dependency.TypeInfo { return d.T }
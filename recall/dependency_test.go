@@ -0,0 +1,195 @@
+package recall
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/dependency"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/jobs"
+	"github.com/tychoish/bond/middleware"
+)
+
+func runTestJob(ctx context.Context, t *testing.T, q amboy.Queue, id string) amboy.Job {
+	j := job.NewShellJob("true", "")
+	j.SetID(id)
+	out, err := jobs.RunJob(ctx, q, j)
+	require.NoError(t, err)
+	return out
+}
+
+func TestOncePerPeriodDependency(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q := queue.NewLocalLimitedSize(2, 128)
+	require.NoError(t, q.Start(ctx))
+
+	dep := NewOncePerPeriod(q, "refresh-feed", time.Hour)
+	assert.Equal(oncePerPeriodTypeName, dep.Type().Name)
+	assert.Equal(dependency.Ready, dep.State())
+
+	runTestJob(ctx, t, q, "refresh-feed-0")
+	assert.Equal(dependency.Passed, dep.State())
+
+	// a job that completed outside of the period does not count
+	dep.Period = time.Nanosecond
+	assert.Equal(dependency.Ready, dep.State())
+
+	// other prefixes don't match
+	assert.Equal(dependency.Ready, NewOncePerPeriod(q, "other", time.Hour).State())
+
+	// without a queue, the dependency is always ready
+	dep = NewOncePerPeriod(nil, "refresh-feed", time.Hour)
+	assert.Equal(dependency.Ready, dep.State())
+	dep.SetQueue(q)
+	assert.Equal(dependency.Passed, dep.State())
+}
+
+func TestOncePerPeriodFindsCompletedJobsInRemoteDrivers(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	driver := queue.NewInternalDriver()
+	require.NoError(t, driver.Open(ctx))
+	defer driver.Close()
+	q := queue.NewRemoteUnordered(2)
+	require.NoError(t, q.SetDriver(driver))
+
+	dep := NewOncePerPeriod(q, "refresh-feed", time.Hour)
+	assert.Equal(dependency.Ready, dep.State())
+
+	j := job.NewShellJob("true", "")
+	j.SetID("refresh-feed-0")
+	j.SetStatus(amboy.JobStatusInfo{Completed: true})
+	j.UpdateTimeInfo(amboy.JobTimeInfo{End: time.Now()})
+	require.NoError(t, driver.Put(ctx, j))
+	assert.Equal(dependency.Passed, dep.State())
+	assert.Equal(dependency.Ready, NewOncePerPeriod(q, "other", time.Hour).State())
+
+	// the prefix is matched literally
+	assert.Equal(dependency.Ready, NewOncePerPeriod(q, "refresh.feed", time.Hour).State())
+
+	dep.Period = time.Nanosecond
+	assert.Equal(dependency.Ready, dep.State())
+}
+
+func TestOncePerPeriodJobsCompleteThroughDependencyQueues(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q, err := middleware.NewDependencyQueue(queue.NewLocalLimitedSize(2, 128), 10*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+	runTestJob(ctx, t, q, "refresh-feed-0")
+
+	// the dependency has lost its queue, as it would have if it
+	// were read from a remote driver, and the queue reattaches it.
+	j := job.NewShellJob("false", "")
+	j.SetID("refresh-feed-1")
+	j.SetDependency(NewOncePerPeriod(nil, "refresh-feed", time.Hour))
+	out, err := jobs.RunJob(ctx, q, j)
+	require.NoError(t, err)
+	assert.True(out.Status().Completed)
+	assert.Equal(dependency.Passed, out.Dependency().State())
+}
+
+func TestUnlessCompletedDependency(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q := queue.NewLocalLimitedSize(2, 128)
+	require.NoError(t, q.Start(ctx))
+
+	dep := NewUnlessCompleted(q, "mirror-a")
+	assert.Equal(unlessCompletedName, dep.Type().Name)
+
+	// the job doesn't exist
+	assert.Equal(dependency.Ready, dep.State())
+
+	// the job exists and succeeded
+	runTestJob(ctx, t, q, "mirror-a")
+	assert.Equal(dependency.Passed, dep.State())
+
+	// the job exists and failed
+	failed := job.NewShellJob("false", "")
+	failed.SetID("mirror-b")
+	_, err := jobs.RunJob(ctx, q, failed)
+	require.Error(t, err)
+	assert.Equal(dependency.Ready, NewUnlessCompleted(q, "mirror-b").State())
+
+	// without a queue, the dependency is always ready
+	dep = NewUnlessCompleted(nil, "mirror-a")
+	assert.Equal(dependency.Ready, dep.State())
+	dep.SetQueue(q)
+	assert.Equal(dependency.Passed, dep.State())
+}
+
+func TestUnlessCompletedIsBlockedForPendingJobs(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// canceling the context stops the workers, so new jobs
+	// remain pending.
+	q := queue.NewLocalLimitedSize(2, 128)
+	require.NoError(t, q.Start(ctx))
+	cancel()
+
+	j := job.NewShellJob("true", "")
+	j.SetID("pending")
+
+	ctx = context.Background()
+	require.NoError(t, q.Put(ctx, j))
+	assert.Equal(t, dependency.Blocked, NewUnlessCompleted(q, "pending").State())
+}
+
+func TestUnlessCompletedHoldsFallbacksInDependencyQueues(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q, err := middleware.NewDependencyQueue(queue.NewLocalLimitedSize(2, 128), 10*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, q.Start(ctx))
+
+	fallback := func(id, primary string) amboy.Job {
+		j := job.NewShellJob("false", "")
+		j.SetID(id)
+		j.SetDependency(NewUnlessCompleted(nil, primary))
+		return j
+	}
+
+	// the fallback waits for the primary, and completes without
+	// running when it succeeds
+	primary := job.NewShellJob("sleep 0.2", "")
+	primary.SetID("mirror-a")
+	require.NoError(t, q.Put(ctx, primary))
+	out, err := jobs.RunJob(ctx, q, fallback("mirror-a-fallback", "mirror-a"))
+	require.NoError(t, err)
+	assert.True(out.Status().Completed)
+	assert.True(primary.Status().Completed)
+	assert.NoError(primary.Error())
+
+	// the fallback runs when the primary fails
+	failed := job.NewShellJob("false", "")
+	failed.SetID("mirror-b")
+	require.NoError(t, q.Put(ctx, failed))
+	_, err = jobs.RunJob(ctx, q, fallback("mirror-b-fallback", "mirror-b"))
+	assert.Error(err)
+	assert.Error(failed.Error())
+}
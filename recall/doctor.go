@@ -0,0 +1,268 @@
+package recall
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+)
+
+// DefaultMinFreeSpace is the free disk space below which Diagnose
+// reports a problem: enough for a few enterprise builds and their
+// archives.
+const DefaultMinFreeSpace = 2 * 1024 * 1024 * 1024
+
+// DefaultCDNURL is the download server whose reachability Diagnose
+// checks.
+const DefaultCDNURL = "https://fastdl.mongodb.org/"
+
+// Diagnosis is the outcome of one check of Diagnose, with a hint for
+// fixing the problem when the check fails.
+type Diagnosis struct {
+	Check  string `bson:"check" json:"check" yaml:"check"`
+	OK     bool   `bson:"ok" json:"ok" yaml:"ok"`
+	Detail string `bson:"detail" json:"detail" yaml:"detail"`
+	Hint   string `bson:"hint,omitempty" json:"hint,omitempty" yaml:"hint,omitempty"`
+}
+
+func (d Diagnosis) String() string {
+	status := "ok"
+	if !d.OK {
+		status = "FAIL"
+	}
+
+	out := fmt.Sprintf("[%4s] %s: %s", status, d.Check, d.Detail)
+	if d.Hint != "" {
+		out += "\n       hint: " + d.Hint
+	}
+
+	return out
+}
+
+// DoctorOptions control the checks of Diagnose.
+type DoctorOptions struct {
+	// Path is the cache directory to check.
+	Path string `bson:"path" json:"path" yaml:"path"`
+	// MinFreeSpace is the number of free bytes that the cache's
+	// file system should have, and defaults to
+	// DefaultMinFreeSpace.
+	MinFreeSpace uint64 `bson:"min_free_space" json:"min_free_space" yaml:"min_free_space"`
+	// Timeout limits each network check, and defaults to 10
+	// seconds.
+	Timeout time.Duration `bson:"timeout" json:"timeout" yaml:"timeout"`
+}
+
+// Diagnose checks the environment that recall depends on: the
+// reachability of the feed, the download server, and the mirror, if
+// the options configure one; whether the cache directory is writable
+// and has enough free space; and whether there are partial downloads
+// left over from failed runs. Diagnose runs every check, and reports
+// the outcome of each, rather than stopping at the first problem.
+func Diagnose(ctx context.Context, opts DoctorOptions, configs ...bond.Option) []Diagnosis {
+	conf := bond.NewConfig(configs...)
+	if opts.Path == "" {
+		opts.Path = conf.CachePath
+	}
+	if opts.MinFreeSpace == 0 {
+		opts.MinFreeSpace = DefaultMinFreeSpace
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+
+	client, release := conf.Client()
+	defer release()
+
+	out := []Diagnosis{
+		checkURL(ctx, client, opts.Timeout, "feed", conf.MirrorURL(bond.FeedURL),
+			"check the network and proxy settings (HTTP_PROXY, HTTPS_PROXY), or configure a mirror"),
+	}
+
+	if conf.Mirror != "" {
+		out = append(out, checkURL(ctx, client, opts.Timeout, "mirror", conf.Mirror,
+			"check that the mirror is running and that its URL is correct"))
+	} else {
+		out = append(out, checkURL(ctx, client, opts.Timeout, "download server", DefaultCDNURL,
+			"check the network and proxy settings, or configure a mirror if the download server is blocked"))
+	}
+
+	for _, class := range bond.ArtifactClasses {
+		if base := conf.ClassMirrors[class]; base != "" && base != conf.Mirror {
+			out = append(out, checkURL(ctx, client, opts.Timeout, string(class)+" mirror", base,
+				"check that the "+string(class)+" mirror is running and that its URL is correct"))
+		}
+	}
+
+	return append(out,
+		checkCacheWritable(opts.Path),
+		checkFreeSpace(opts.Path, opts.MinFreeSpace),
+		checkPartialDownloads(opts.Path))
+}
+
+func checkURL(ctx context.Context, client *http.Client, timeout time.Duration, check, url, hint string) Diagnosis {
+	d := Diagnosis{Check: check}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodHead, url, nil)
+	if err != nil {
+		d.Detail = fmt.Sprintf("'%s' is not a valid URL: %s", url, err)
+		d.Hint = "correct the URL of the " + check
+		return d
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		d.Detail = fmt.Sprintf("could not reach %s: %s", url, err)
+		d.Hint = hint
+		return d
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	// servers that do not support HEAD requests are reachable.
+	if resp.StatusCode >= 500 {
+		d.Detail = fmt.Sprintf("%s responded with %s", url, resp.Status)
+		d.Hint = hint
+		return d
+	}
+
+	d.OK = true
+	d.Detail = fmt.Sprintf("%s responded with %s in %s", url, resp.Status, time.Since(start).Round(time.Millisecond))
+	return d
+}
+
+func checkCacheWritable(path string) Diagnosis {
+	d := Diagnosis{Check: "cache permissions"}
+
+	if stat, err := os.Stat(path); os.IsNotExist(err) {
+		// recall creates missing directories when it can
+		// write to the parent.
+		parent := filepath.Dir(path)
+		if err = touch(parent); err != nil {
+			d.Detail = fmt.Sprintf("%s does not exist and cannot be created: %s", path, err)
+			d.Hint = fmt.Sprintf("create %s, or specify a cache directory that you can write to", path)
+			return d
+		}
+		d.OK = true
+		d.Detail = fmt.Sprintf("%s does not exist, and will be created", path)
+		return d
+	} else if err != nil {
+		d.Detail = err.Error()
+		d.Hint = "check the permissions of the cache directory's parents"
+		return d
+	} else if !stat.IsDir() {
+		d.Detail = fmt.Sprintf("%s is not a directory", path)
+		d.Hint = "remove the file, or specify another cache directory"
+		return d
+	}
+
+	if err := touch(path); err != nil {
+		d.Detail = fmt.Sprintf("cannot write to %s: %s", path, err)
+		d.Hint = fmt.Sprintf("make %s writable by the current user (e.g. chown or chmod u+w)", path)
+		return d
+	}
+
+	d.OK = true
+	d.Detail = fmt.Sprintf("%s is writable", path)
+	return d
+}
+
+// touch creates and removes a file in the directory.
+func touch(dir string) error {
+	f, err := ioutil.TempFile(dir, ".recall-doctor")
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	return os.Remove(f.Name())
+}
+
+func checkFreeSpace(path string, min uint64) Diagnosis {
+	d := Diagnosis{Check: "free disk"}
+
+	// the cache may not exist yet, so check the nearest directory
+	// that does.
+	dir := path
+	for {
+		if _, err := os.Stat(dir); err == nil || dir == filepath.Dir(dir) {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	free, err := freeSpace(dir)
+	if err != nil {
+		d.Detail = errors.Wrapf(err, "problem checking free space of %s", dir).Error()
+		return d
+	}
+
+	d.Detail = fmt.Sprintf("%s has %s free", dir, formatBytes(free))
+	if free < min {
+		d.Hint = fmt.Sprintf("free at least %s, e.g. by collecting unindexed files from the cache", formatBytes(min-free))
+		return d
+	}
+
+	d.OK = true
+	return d
+}
+
+func checkPartialDownloads(path string) Diagnosis {
+	d := Diagnosis{Check: "dangling downloads"}
+
+	contents, err := ioutil.ReadDir(path)
+	if os.IsNotExist(err) {
+		d.OK = true
+		d.Detail = "the cache is empty"
+		return d
+	}
+	if err != nil {
+		d.Detail = err.Error()
+		return d
+	}
+
+	partial := []string{}
+	var size int64
+	for _, info := range contents {
+		if strings.HasSuffix(info.Name(), bond.PartialFileName("")) {
+			partial = append(partial, info.Name())
+			size += info.Size()
+		}
+	}
+
+	if len(partial) == 0 {
+		d.OK = true
+		d.Detail = "there are no partial downloads"
+		return d
+	}
+
+	d.Detail = fmt.Sprintf("%d partial downloads (%s): %s", len(partial), formatBytes(uint64(size)), strings.Join(partial, ", "))
+	d.Hint = "download the same releases again to resume them, or remove the .partial files and their .partial.json state files"
+	return d
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := uint64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package recall
+
+import "github.com/pkg/errors"
+
+func freeSpace(string) (uint64, error) {
+	return 0, errors.New("free space is not available on this platform")
+}
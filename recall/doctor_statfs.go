@@ -0,0 +1,16 @@
+//go:build linux || darwin
+
+package recall
+
+import "syscall"
+
+// freeSpace returns the bytes available to unprivileged users on the
+// file system of the path.
+func freeSpace(path string) (uint64, error) {
+	stat := syscall.Statfs_t{}
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
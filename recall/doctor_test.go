@@ -0,0 +1,75 @@
+package recall
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond"
+)
+
+func TestDiagnose(t *testing.T) {
+	assert := assert.New(t)
+
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "recall-doctor")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	byCheck := func(out []Diagnosis) map[string]Diagnosis {
+		checks := map[string]Diagnosis{}
+		for _, d := range out {
+			checks[d.Check] = d
+		}
+		return checks
+	}
+
+	opts := DoctorOptions{Path: dir, MinFreeSpace: 1}
+	checks := byCheck(Diagnose(context.Background(), opts, bond.WithMirror(srv.URL)))
+	assert.Len(checks, 5)
+	for _, d := range checks {
+		assert.True(d.OK, d.String())
+	}
+	assert.Contains(paths, "/full.json")
+	_, ok := checks["download server"]
+	assert.False(ok)
+
+	fn := filepath.Join(dir, bond.PartialFileName("mongodb-linux-x86_64-4.4.1.tgz"))
+	require.NoError(t, ioutil.WriteFile(fn, []byte("partial"), 0644))
+	checks = byCheck(Diagnose(context.Background(), opts, bond.WithMirror(srv.URL)))
+	assert.False(checks["dangling downloads"].OK)
+	assert.Contains(checks["dangling downloads"].Detail, "mongodb-linux-x86_64-4.4.1.tgz.partial")
+	assert.NotEmpty(checks["dangling downloads"].Hint)
+
+	srv.Close()
+	checks = byCheck(Diagnose(context.Background(), DoctorOptions{Path: filepath.Join(dir, "new")}, bond.WithMirror(srv.URL)))
+	assert.False(checks["feed"].OK)
+	assert.False(checks["mirror"].OK)
+	assert.NotEmpty(checks["feed"].Hint)
+	assert.True(checks["cache permissions"].OK)
+	assert.True(checks["dangling downloads"].OK)
+}
+
+func TestDiagnoseCacheThatIsAFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "recall-doctor")
+	require.NoError(t, err)
+	f.Close()
+	defer os.Remove(f.Name())
+
+	d := checkCacheWritable(f.Name())
+	assert.False(t, d.OK)
+	assert.Contains(t, d.Detail, "not a directory")
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "2.0 GiB", formatBytes(DefaultMinFreeSpace))
+}
@@ -0,0 +1,455 @@
+package recall
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+// ErrUnsafeArchive is returned when extracting an archive that
+// contains entries that would be written outside of the extraction
+// directory, if the extraction rejects unsafe archives.
+var ErrUnsafeArchive = errors.New("archive contains unsafe entries")
+
+// ExtractOptions control the extraction of archives.
+type ExtractOptions struct {
+	// RejectUnsafe causes extraction to fail when the archive
+	// has an unsafe entry: an absolute path, a path that
+	// traverses out of the extraction directory, or a link that
+	// points out of it. By default, unsafe entries are skipped
+	// with a warning.
+	RejectUnsafe bool `bson:"reject_unsafe" json:"reject_unsafe" yaml:"reject_unsafe"`
+	// WriteRate, if specified, limits the rate, in bytes per
+	// second, at which extraction writes files. Extractions in
+	// the process with the same rate share it, so that several
+	// concurrent extractions together do not exceed it.
+	WriteRate int64 `bson:"write_rate,omitempty" json:"write_rate,omitempty" yaml:"write_rate,omitempty"`
+	// Sync determines when the extracted files are flushed to
+	// disk, and defaults to SyncNone.
+	Sync SyncPolicy `bson:"sync,omitempty" json:"sync,omitempty" yaml:"sync,omitempty"`
+}
+
+// SyncPolicy determines when extraction flushes files to disk.
+// Flushing each file limits the data that the operating system
+// buffers, and writes to disk at once, during large extractions.
+type SyncPolicy string
+
+const (
+	// SyncNone leaves flushing to the operating system.
+	SyncNone SyncPolicy = "none"
+	// SyncEachFile flushes each file after it's written.
+	SyncEachFile SyncPolicy = "file"
+	// SyncArchive flushes all of the files after the archive is
+	// extracted, so that an extraction that completes is durable.
+	SyncArchive SyncPolicy = "archive"
+)
+
+// Validate returns an error if the options are not valid.
+func (opts ExtractOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(opts.WriteRate < 0, "cannot specify a negative write rate")
+
+	switch opts.Sync {
+	case "", SyncNone, SyncEachFile, SyncArchive:
+	default:
+		catcher.Errorf("'%s' is not a valid sync policy", opts.Sync)
+	}
+
+	return catcher.Resolve()
+}
+
+// ExtractTarGz extracts a gzipped tarball into the directory. Entries
+// are never written outside of the directory, including through
+// symbolic links created by earlier entries.
+func ExtractTarGz(fn, dir string, opts ExtractOptions) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return errors.Wrap(err, "error opening file")
+	}
+	defer f.Close()
+
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		return errors.Wrap(err, "problem reading gzip")
+	}
+	defer gzr.Close()
+
+	x, err := newExtractor(fn, dir, opts)
+	if err != nil {
+		return err
+	}
+
+	archive := tar.NewReader(gzr)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return x.finish()
+		}
+		if err != nil {
+			return errors.Wrapf(err, "problem reading %s", fn)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = x.dir(header.Name)
+		case tar.TypeReg:
+			err = x.file(header.Name, os.FileMode(header.Mode), archive)
+		case tar.TypeSymlink:
+			err = x.symlink(header.Name, header.Linkname)
+		case tar.TypeLink:
+			err = x.hardlink(header.Name, header.Linkname)
+		default:
+			// devices, fifos, and extended headers have no
+			// place in a build archive.
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ExtractZip extracts a zip archive into the directory, with the same
+// protections as ExtractTarGz.
+func ExtractZip(fn, dir string, opts ExtractOptions) error {
+	r, err := zip.OpenReader(fn)
+	if err != nil {
+		return errors.Wrap(err, "problem parsing archive")
+	}
+	defer r.Close()
+
+	x, err := newExtractor(fn, dir, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range r.File {
+		if err = x.zipEntry(f); err != nil {
+			return err
+		}
+	}
+
+	return x.finish()
+}
+
+type extractor struct {
+	archive  string
+	root     string
+	opts     ExtractOptions
+	throttle *writeThrottle
+	// written are the files to flush when the extraction
+	// finishes, with the SyncArchive policy.
+	written []string
+}
+
+func newExtractor(fn, dir string, opts ExtractOptions) (*extractor, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid extract options")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "problem creating %s", dir)
+	}
+
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem resolving %s", dir)
+	}
+
+	root, err = filepath.Abs(root)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem resolving %s", dir)
+	}
+
+	x := &extractor{archive: fn, root: root, opts: opts}
+	if opts.WriteRate > 0 {
+		x.throttle = getWriteThrottle(opts.WriteRate)
+	}
+
+	return x, nil
+}
+
+// finish flushes the extracted files, with the SyncArchive policy.
+func (x *extractor) finish() error {
+	if x.opts.Sync != SyncArchive {
+		return nil
+	}
+
+	catcher := grip.NewBasicCatcher()
+	for _, path := range x.written {
+		catcher.Add(syncFile(path))
+	}
+	x.written = nil
+
+	return errors.Wrapf(catcher.Resolve(), "problem flushing files extracted from %s", x.archive)
+}
+
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return errors.Wrapf(err, "problem opening %s", path)
+	}
+
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(errors.Wrapf(f.Sync(), "problem flushing %s", path))
+	catcher.Add(errors.Wrapf(f.Close(), "problem closing %s", path))
+	return catcher.Resolve()
+}
+
+// unsafe returns an error if the extraction rejects unsafe archives,
+// and otherwise logs that the entry is skipped.
+func (x *extractor) unsafe(name, reason string) error {
+	if x.opts.RejectUnsafe {
+		return errors.Wrapf(ErrUnsafeArchive, "entry '%s' in %s %s", name, x.archive, reason)
+	}
+
+	grip.Warning(message.Fields{
+		"message": "skipping unsafe archive entry",
+		"archive": x.archive,
+		"entry":   name,
+		"reason":  reason,
+	})
+
+	return nil
+}
+
+func (x *extractor) within(path string) bool {
+	return path == x.root || strings.HasPrefix(path, x.root+string(filepath.Separator))
+}
+
+// resolve returns the path that the archive entry should be written
+// to, with any links in its parent directories resolved, and an
+// empty string if the entry is unsafe.
+func (x *extractor) resolve(name string) (string, string) {
+	if name == "" {
+		return "", "has no name"
+	}
+
+	native := filepath.FromSlash(name)
+	if filepath.IsAbs(native) || filepath.VolumeName(native) != "" || strings.HasPrefix(name, "/") || strings.HasPrefix(name, `\`) {
+		return "", "has an absolute path"
+	}
+
+	clean := filepath.Clean(native)
+	if clean == "." {
+		return x.root, ""
+	}
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", "traverses out of the extraction directory"
+	}
+
+	parent, err := x.realPath(filepath.Dir(filepath.Join(x.root, clean)))
+	if err != nil || !x.within(parent) {
+		return "", "is inside a link that points out of the extraction directory"
+	}
+
+	return filepath.Join(parent, filepath.Base(clean)), ""
+}
+
+// realPath resolves the links in the longest existing prefix of the
+// path.
+func (x *extractor) realPath(path string) (string, error) {
+	rest := []string{}
+	for {
+		if _, err := os.Lstat(path); err == nil {
+			break
+		}
+
+		next := filepath.Dir(path)
+		if next == path {
+			break
+		}
+		rest = append([]string{filepath.Base(path)}, rest...)
+		path = next
+	}
+
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(append([]string{real}, rest...)...), nil
+}
+
+// replace removes an existing link at the path, so that the archive
+// cannot write through a link that an earlier entry created.
+func replace(path string) error {
+	if stat, err := os.Lstat(path); err == nil && stat.Mode()&os.ModeSymlink != 0 {
+		return errors.Wrapf(os.Remove(path), "problem removing link %s", path)
+	}
+
+	return nil
+}
+
+func (x *extractor) dir(name string) error {
+	path, reason := x.resolve(name)
+	if path == "" {
+		return x.unsafe(name, reason)
+	}
+
+	if err := replace(path); err != nil {
+		return err
+	}
+
+	return errors.Wrapf(os.MkdirAll(path, 0755), "problem creating directory %s", path)
+}
+
+func (x *extractor) file(name string, mode os.FileMode, r io.Reader) error {
+	path, reason := x.resolve(name)
+	if path == "" {
+		return x.unsafe(name, reason)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrapf(err, "problem creating directory for %s", path)
+	}
+
+	if err := replace(path); err != nil {
+		return err
+	}
+
+	if mode.Perm() == 0 {
+		mode = 0644
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode.Perm())
+	if err != nil {
+		return errors.Wrapf(err, "problem creating %s", path)
+	}
+
+	var w io.Writer = f
+	if x.throttle != nil {
+		w = &throttledWriter{w: f, throttle: x.throttle}
+	}
+
+	_, err = io.Copy(w, r)
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(errors.Wrapf(err, "problem writing %s", path))
+	if err == nil && x.opts.Sync == SyncEachFile {
+		catcher.Add(errors.Wrapf(f.Sync(), "problem flushing %s", path))
+	}
+	catcher.Add(errors.Wrapf(f.Close(), "problem closing %s", path))
+	if x.opts.Sync == SyncArchive {
+		x.written = append(x.written, path)
+	}
+
+	return catcher.Resolve()
+}
+
+func (x *extractor) symlink(name, target string) error {
+	path, reason := x.resolve(name)
+	if path == "" {
+		return x.unsafe(name, reason)
+	}
+
+	native := filepath.FromSlash(target)
+	if filepath.IsAbs(native) || filepath.VolumeName(native) != "" || strings.HasPrefix(target, "/") {
+		return x.unsafe(name, "links to an absolute path")
+	}
+
+	if !x.linksWithin(filepath.Dir(path), native) {
+		return x.unsafe(name, "links out of the extraction directory")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrapf(err, "problem creating directory for %s", path)
+	}
+
+	if err := os.RemoveAll(path); err != nil {
+		return errors.Wrapf(err, "problem replacing %s", path)
+	}
+
+	return errors.Wrapf(os.Symlink(native, path), "problem creating link %s", path)
+}
+
+// linksWithin reports whether a link in the directory to the target
+// stays within the extraction directory, resolving the target one
+// component at a time, as the operating system would, so that
+// existing links in the target are followed before any ".."
+// components after them.
+func (x *extractor) linksWithin(dir, target string) bool {
+	current := dir
+	for _, part := range strings.Split(target, string(filepath.Separator)) {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			current = filepath.Dir(current)
+		default:
+			current = filepath.Join(current, part)
+			if stat, err := os.Lstat(current); err == nil && stat.Mode()&os.ModeSymlink != 0 {
+				real, err := filepath.EvalSymlinks(current)
+				if err != nil {
+					return false
+				}
+				current = real
+			}
+		}
+
+		if !x.within(current) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (x *extractor) hardlink(name, target string) error {
+	path, reason := x.resolve(name)
+	if path == "" {
+		return x.unsafe(name, reason)
+	}
+
+	source, reason := x.resolve(target)
+	if source == "" {
+		return x.unsafe(name, "links to an entry that "+reason)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrapf(err, "problem creating directory for %s", path)
+	}
+
+	if err := os.RemoveAll(path); err != nil {
+		return errors.Wrapf(err, "problem replacing %s", path)
+	}
+
+	return errors.Wrapf(os.Link(source, path), "problem linking %s", path)
+}
+
+func (x *extractor) zipEntry(f *zip.File) error {
+	mode := f.Mode()
+	if mode.IsDir() {
+		return x.dir(f.Name)
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return errors.Wrapf(err, "problem opening %s in %s", f.Name, x.archive)
+	}
+	defer rc.Close()
+
+	if mode&os.ModeSymlink != 0 {
+		target, err := ioutil.ReadAll(rc)
+		if err != nil {
+			return errors.Wrapf(err, "problem reading link %s in %s", f.Name, x.archive)
+		}
+
+		return x.symlink(f.Name, string(target))
+	}
+
+	if !mode.IsRegular() {
+		return nil
+	}
+
+	return x.file(f.Name, mode, rc)
+}
@@ -0,0 +1,235 @@
+package recall
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond"
+)
+
+type testEntry struct {
+	name string
+	link string
+	kind byte
+	body string
+}
+
+func writeTestTarGz(t *testing.T, fn string, entries []testEntry) {
+	f, err := os.Create(fn)
+	require.NoError(t, err)
+	defer f.Close()
+	gzw := gzip.NewWriter(f)
+	defer gzw.Close()
+	tw := tar.NewWriter(gzw)
+	defer tw.Close()
+
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.kind, Linkname: e.link, Mode: 0755, Size: int64(len(e.body))}
+		if e.kind != tar.TypeReg {
+			hdr.Size = 0
+		}
+		require.NoError(t, tw.WriteHeader(hdr))
+		if e.kind == tar.TypeReg {
+			_, err = tw.Write([]byte(e.body))
+			require.NoError(t, err)
+		}
+	}
+}
+
+func newExtractTestDirs(t *testing.T) (string, string) {
+	base, err := ioutil.TempDir("", "bond-extract")
+	require.NoError(t, err)
+
+	dir := filepath.Join(base, "cache")
+	require.NoError(t, os.Mkdir(dir, 0755))
+	return base, dir
+}
+
+func TestExtractTarGzSkipsUnsafeEntries(t *testing.T) {
+	assert := assert.New(t)
+	base, dir := newExtractTestDirs(t)
+	defer os.RemoveAll(base)
+
+	fn := filepath.Join(base, "archive.tgz")
+	writeTestTarGz(t, fn, []testEntry{
+		{name: "./", kind: tar.TypeDir},
+		{name: "mongodb/bin/", kind: tar.TypeDir},
+		{name: "mongodb/bin/mongod", kind: tar.TypeReg, body: "binary"},
+		{name: "mongodb/current", kind: tar.TypeSymlink, link: "bin"},
+		{name: "mongodb/hard", kind: tar.TypeLink, link: "mongodb/bin/mongod"},
+		{name: "../escape", kind: tar.TypeReg, body: "evil"},
+		{name: "/abs", kind: tar.TypeReg, body: "evil"},
+		{name: "out", kind: tar.TypeSymlink, link: "../"},
+		{name: "out/escape", kind: tar.TypeReg, body: "evil"},
+		{name: "abs", kind: tar.TypeSymlink, link: base},
+		{name: "self", kind: tar.TypeSymlink, link: "."},
+		{name: "self/up", kind: tar.TypeSymlink, link: ".."},
+		{name: "sneaky", kind: tar.TypeSymlink, link: "self/../.."},
+		{name: "stolen", kind: tar.TypeLink, link: "../archive.tgz"},
+	})
+
+	require.NoError(t, ExtractTarGz(fn, dir, ExtractOptions{}))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "mongodb", "current", "mongod"))
+	require.NoError(t, err)
+	assert.Equal("binary", string(data))
+	data, err = ioutil.ReadFile(filepath.Join(dir, "mongodb", "hard"))
+	require.NoError(t, err)
+	assert.Equal("binary", string(data))
+
+	for _, name := range []string{"escape", "abs"} {
+		_, err = os.Lstat(filepath.Join(base, name))
+		assert.True(os.IsNotExist(err), name)
+	}
+	for _, name := range []string{"abs", "up", "sneaky", "stolen"} {
+		_, err = os.Lstat(filepath.Join(dir, name))
+		assert.True(os.IsNotExist(err), name)
+	}
+
+	// the link out of the directory was skipped, so the next
+	// entry created a directory in its place
+	stat, err := os.Lstat(filepath.Join(dir, "out"))
+	require.NoError(t, err)
+	assert.True(stat.IsDir())
+	_, err = os.Lstat(filepath.Join(dir, "self"))
+	assert.NoError(err)
+}
+
+func TestExtractTarGzRejectsUnsafeArchives(t *testing.T) {
+	base, dir := newExtractTestDirs(t)
+	defer os.RemoveAll(base)
+
+	for idx, entries := range [][]testEntry{
+		{{name: "../escape", kind: tar.TypeReg, body: "evil"}},
+		{{name: "/abs", kind: tar.TypeReg, body: "evil"}},
+		{{name: "out", kind: tar.TypeSymlink, link: "../.."}},
+		{{name: "self", kind: tar.TypeSymlink, link: "."}, {name: "self/up", kind: tar.TypeSymlink, link: ".."}},
+	} {
+		fn := filepath.Join(base, "archive.tgz")
+		writeTestTarGz(t, fn, entries)
+
+		err := ExtractTarGz(fn, dir, ExtractOptions{RejectUnsafe: true})
+		assert.True(t, bond.Is(err, ErrUnsafeArchive), "case %d: %v", idx, err)
+	}
+}
+
+func TestExtractZipSkipsUnsafeEntries(t *testing.T) {
+	assert := assert.New(t)
+	base, dir := newExtractTestDirs(t)
+	defer os.RemoveAll(base)
+
+	fn := filepath.Join(base, "archive.zip")
+	f, err := os.Create(fn)
+	require.NoError(t, err)
+	zw := zip.NewWriter(f)
+	for _, e := range []testEntry{
+		{name: "mongodb/bin/mongod.exe", body: "binary"},
+		{name: "../escape.txt", body: "evil"},
+		{name: "out", link: ".."},
+	} {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+		body := e.body
+		if e.link != "" {
+			hdr.SetMode(os.ModeSymlink | 0777)
+			body = e.link
+		} else {
+			hdr.SetMode(0644)
+		}
+		w, err := zw.CreateHeader(hdr)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(body))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+
+	require.NoError(t, ExtractZip(fn, dir, ExtractOptions{}))
+	data, err := ioutil.ReadFile(filepath.Join(dir, "mongodb", "bin", "mongod.exe"))
+	require.NoError(t, err)
+	assert.Equal("binary", string(data))
+
+	_, err = os.Lstat(filepath.Join(base, "escape.txt"))
+	assert.True(os.IsNotExist(err))
+	_, err = os.Lstat(filepath.Join(dir, "out"))
+	assert.True(os.IsNotExist(err))
+
+	assert.True(bond.Is(ExtractZip(fn, dir, ExtractOptions{RejectUnsafe: true}), ErrUnsafeArchive))
+}
+
+func TestExtractOptionsValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(ExtractOptions{}.Validate())
+	assert.NoError(ExtractOptions{WriteRate: 1 << 20, Sync: SyncArchive}.Validate())
+	assert.Error(ExtractOptions{WriteRate: -1}.Validate())
+	assert.Error(ExtractOptions{Sync: "always"}.Validate())
+
+	base, dir := newExtractTestDirs(t)
+	defer os.RemoveAll(base)
+	fn := filepath.Join(base, "archive.tgz")
+	writeTestTarGz(t, fn, []testEntry{{name: "mongod", kind: tar.TypeReg, body: "binary"}})
+	assert.Error(ExtractTarGz(fn, dir, ExtractOptions{Sync: "always"}))
+}
+
+func TestExtractTarGzThrottlesWrites(t *testing.T) {
+	assert := assert.New(t)
+	base, dir := newExtractTestDirs(t)
+	defer os.RemoveAll(base)
+
+	body := strings.Repeat("x", 3*throttleChunk)
+	fn := filepath.Join(base, "archive.tgz")
+	writeTestTarGz(t, fn, []testEntry{
+		{name: "mongodb/bin/", kind: tar.TypeDir},
+		{name: "mongodb/bin/mongod", kind: tar.TypeReg, body: body},
+		{name: "mongodb/bin/mongos", kind: tar.TypeReg, body: body},
+	})
+
+	for _, policy := range []SyncPolicy{SyncNone, SyncEachFile, SyncArchive} {
+		require.NoError(t, os.RemoveAll(dir))
+
+		// the first chunk is written at once, and each later chunk
+		// waits for the throttle
+		started := time.Now()
+		require.NoError(t, ExtractTarGz(fn, dir, ExtractOptions{WriteRate: 20 * throttleChunk, Sync: policy}))
+		assert.True(time.Since(started) >= 5*time.Second/20, "%s: %s", policy, time.Since(started))
+
+		for _, name := range []string{"mongod", "mongos"} {
+			data, err := ioutil.ReadFile(filepath.Join(dir, "mongodb", "bin", name))
+			require.NoError(t, err)
+			assert.Equal(body, string(data), "%s: %s", policy, name)
+		}
+	}
+}
+
+func TestWriteThrottleIsShared(t *testing.T) {
+	assert := assert.New(t)
+
+	throttle := getWriteThrottle(40 * throttleChunk)
+	assert.True(throttle == getWriteThrottle(40*throttleChunk))
+	assert.False(throttle == getWriteThrottle(41*throttleChunk))
+
+	// two writers that share the throttle split its rate
+	started := time.Now()
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			w := &throttledWriter{w: ioutil.Discard, throttle: throttle}
+			n, err := w.Write(make([]byte, 4*throttleChunk))
+			assert.NoError(err)
+			assert.Equal(4*throttleChunk, n)
+			done <- struct{}{}
+		}()
+	}
+	<-done
+	<-done
+	assert.True(time.Since(started) >= 7*time.Second/40, time.Since(started).String())
+}
@@ -0,0 +1,251 @@
+package recall
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/management"
+)
+
+// HistoryFileName is the name of the file, in a cache directory, that
+// records the download runs into that directory. The name is hidden
+// so that catalogs and garbage collection treat it as metadata.
+const HistoryFileName = ".recall-history.jsonl"
+
+// Run records a single invocation of FetchReleasesWithHistory: what
+// was requested, the download jobs that ran, and whether it failed.
+type Run struct {
+	ID       string            `bson:"_id" json:"id" yaml:"id"`
+	Path     string            `bson:"path" json:"path" yaml:"path"`
+	Releases []string          `bson:"releases" json:"releases" yaml:"releases"`
+	Options  bond.BuildOptions `bson:"options" json:"options" yaml:"options"`
+	Started  time.Time         `bson:"started" json:"started" yaml:"started"`
+	Finished time.Time         `bson:"finished" json:"finished" yaml:"finished"`
+	Jobs     []JobRecord       `bson:"jobs" json:"jobs" yaml:"jobs"`
+	Error    string            `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// JobRecord records the outcome of one download job of a run.
+type JobRecord struct {
+	ID       string    `bson:"id" json:"id" yaml:"id"`
+	URL      string    `bson:"url" json:"url" yaml:"url"`
+	FileName string    `bson:"file" json:"file" yaml:"file"`
+	Started  time.Time `bson:"started" json:"started" yaml:"started"`
+	Finished time.Time `bson:"finished" json:"finished" yaml:"finished"`
+	// Cached reports whether the file was already in the cache.
+	Cached bool   `bson:"cached,omitempty" json:"cached,omitempty" yaml:"cached,omitempty"`
+	Error  string `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+	// Environment is the process that completed the job.
+	Environment *management.Environment `bson:"env,omitempty" json:"env,omitempty" yaml:"env,omitempty"`
+}
+
+// Duration returns how long the run took.
+func (r Run) Duration() time.Duration { return r.Finished.Sub(r.Started) }
+
+// Failed reports whether the run, or any of its jobs, failed.
+func (r Run) Failed() bool {
+	if r.Error != "" {
+		return true
+	}
+
+	for _, j := range r.Jobs {
+		if j.Error != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r Run) String() string {
+	failed := 0
+	for _, j := range r.Jobs {
+		if j.Error != "" {
+			failed++
+		}
+	}
+
+	status := "ok"
+	if r.Failed() {
+		status = "failed"
+	}
+
+	return fmt.Sprintf("%s  %s  %-6s  %d jobs (%d failed) in %s  %v",
+		r.ID, r.Started.Format(time.RFC3339), status, len(r.Jobs), failed,
+		r.Duration().Round(time.Millisecond), r.Releases)
+}
+
+// CacheHits counts the jobs of the runs that started after the time
+// and found their files in the cache, and the total number of jobs of
+// those runs.
+func CacheHits(runs []Run, since time.Time) (hits, total int) {
+	for _, r := range runs {
+		if r.Started.Before(since) {
+			continue
+		}
+
+		for _, j := range r.Jobs {
+			total++
+			if j.Cached {
+				hits++
+			}
+		}
+	}
+
+	return hits, total
+}
+
+// History persists runs, so that they outlive the process that
+// downloaded the builds.
+type History interface {
+	Record(context.Context, Run) error
+	// Runs returns the most recent runs, newest first, up to the
+	// limit. A limit of zero or less returns every run.
+	Runs(context.Context, int) ([]Run, error)
+}
+
+// FileHistory is a History that appends runs to a file, one JSON
+// document per line. The file is opened for each operation, so that
+// invocations of recall on the same host may share a history.
+type FileHistory struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// NewFileHistory constructs a history that writes to the file at path,
+// which is created, with its directory, if it does not exist.
+func NewFileHistory(path string) *FileHistory { return &FileHistory{path: path} }
+
+// Record appends a run to the file.
+func (h *FileHistory) Record(_ context.Context, r Run) error {
+	doc, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "problem encoding run")
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if err = os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return errors.Wrapf(err, "problem creating directory of history '%s'", h.path)
+	}
+
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrapf(err, "problem opening history '%s'", h.path)
+	}
+
+	if _, err = f.Write(append(doc, '\n')); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "problem writing to history '%s'", h.path)
+	}
+
+	return errors.Wrapf(f.Close(), "problem closing history '%s'", h.path)
+}
+
+// Runs reads the file and returns the most recent runs. A history
+// that has no file yet has no runs.
+func (h *FileHistory) Runs(ctx context.Context, limit int) ([]Run, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	f, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return []Run{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem opening history '%s'", h.path)
+	}
+	defer f.Close()
+
+	runs := []Run{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		r := Run{}
+		if err = json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, errors.Wrapf(err, "problem parsing line %d of history '%s'", line, h.path)
+		}
+		runs = append(runs, r)
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "problem reading history '%s'", h.path)
+	}
+
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].Started.After(runs[j].Started) })
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+
+	return runs, nil
+}
+
+// FetchReleasesWithHistory is FetchReleases, through a queue with the
+// queue options, and records the run, and the outcome of each of its
+// download jobs, in the history, whether or not the run succeeds.
+func FetchReleasesWithHistory(ctx context.Context, history History, qopts QueueOptions, releases []string, path string, options bond.BuildOptions, opts ...bond.Option) error {
+	run := &Run{
+		Path:     path,
+		Releases: releases,
+		Options:  options,
+		Started:  time.Now(),
+	}
+	run.ID = run.Started.UTC().Format("20060102T150405.000000000")
+
+	err := fetchReleases(ctx, run, qopts, releases, path, options, opts...)
+	run.Finished = time.Now()
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	if herr := history.Record(context.Background(), *run); herr != nil {
+		if err == nil {
+			return errors.Wrap(herr, "problem recording run")
+		}
+		return errors.Wrapf(err, "problem recording run (%s)", herr)
+	}
+
+	return err
+}
+
+// recordJobs adds the completed download jobs of the queue to the run.
+func (r *Run) recordJobs(ctx context.Context, q amboy.Queue) {
+	for j := range q.Results(ctx) {
+		dj, ok := j.(*DownloadFileJob)
+		if !ok {
+			continue
+		}
+
+		ti := dj.TimeInfo()
+		rec := JobRecord{
+			ID:          dj.ID(),
+			URL:         dj.URL,
+			FileName:    dj.getFileName(),
+			Started:     ti.Start,
+			Finished:    ti.End,
+			Cached:      dj.Cached,
+			Environment: dj.Completed,
+		}
+		if err := dj.Error(); err != nil {
+			rec.Error = err.Error()
+		}
+		r.Jobs = append(r.Jobs, rec)
+	}
+
+	sort.Slice(r.Jobs, func(i, j int) bool { return r.Jobs[i].URL < r.Jobs[j].URL })
+}
@@ -0,0 +1,97 @@
+package recall
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond"
+)
+
+func TestFileHistory(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "recall-history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	history := NewFileHistory(filepath.Join(dir, HistoryFileName))
+	runs, err := history.Runs(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(runs, 0)
+
+	start := time.Now().Round(time.Second)
+	for i, rel := range []string{"4.0.1", "4.2.1", "4.4.1"} {
+		run := Run{
+			ID:       rel,
+			Releases: []string{rel},
+			Started:  start.Add(time.Duration(i) * time.Minute),
+			Finished: start.Add(time.Duration(i)*time.Minute + time.Second),
+		}
+		if rel == "4.2.1" {
+			run.Jobs = []JobRecord{{URL: "https://example.net/a.tgz", Error: "404"}}
+		}
+		require.NoError(t, history.Record(ctx, run))
+	}
+
+	runs, err = history.Runs(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	assert.Equal("4.4.1", runs[0].ID)
+	assert.Equal("4.2.1", runs[1].ID)
+	assert.False(runs[0].Failed())
+	assert.True(runs[1].Failed())
+	assert.Equal(time.Second, runs[1].Duration())
+	assert.Contains(runs[1].String(), "1 jobs (1 failed)")
+
+	runs, err = history.Runs(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(runs, 3)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "bad"), []byte("{\n"), 0644))
+	_, err = NewFileHistory(filepath.Join(dir, "bad")).Runs(ctx, 0)
+	assert.Error(err)
+}
+
+func TestCacheHits(t *testing.T) {
+	now := time.Now()
+	runs := []Run{
+		{Started: now, Jobs: []JobRecord{{Cached: true}, {Cached: true}, {}}},
+		{Started: now.Add(-time.Hour), Jobs: []JobRecord{{Cached: true}}},
+		{Started: now.Add(-48 * time.Hour), Jobs: []JobRecord{{}, {}}},
+	}
+
+	hits, total := CacheHits(runs, now.Add(-24*time.Hour))
+	assert.Equal(t, 3, hits)
+	assert.Equal(t, 4, total)
+
+	hits, total = CacheHits(runs, time.Time{})
+	assert.Equal(t, 3, hits)
+	assert.Equal(t, 6, total)
+}
+
+func TestFetchReleasesWithHistoryRecordsFailures(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "recall-history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	history := NewFileHistory(filepath.Join(dir, "new", HistoryFileName))
+	err = FetchReleasesWithHistory(context.Background(), history, QueueOptions{}, []string{"4.4.1"}, dir, bond.BuildOptions{})
+	assert.Error(err)
+
+	runs, err := history.Runs(context.Background(), 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.True(runs[0].Failed())
+	assert.Contains(runs[0].Error, "invalid build options")
+	assert.Equal([]string{"4.4.1"}, runs[0].Releases)
+	assert.Equal(dir, runs[0].Path)
+}
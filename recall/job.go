@@ -5,6 +5,7 @@ import (
 	"archive/zip"
 	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -12,7 +13,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/mholt/archiver"
 	"github.com/mongodb/amboy"
 	"github.com/mongodb/amboy/dependency"
 	"github.com/mongodb/amboy/job"
@@ -21,6 +21,8 @@ import (
 	"github.com/mongodb/grip/message"
 	"github.com/pkg/errors"
 	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/middleware"
+	"github.com/tychoish/bond/notify"
 )
 
 // DownloadFileJob is an amboy.Job implementation that supports
@@ -29,7 +31,62 @@ type DownloadFileJob struct {
 	URL       string `bson:"url" json:"url" yaml:"url"`
 	Directory string `bson:"dir" json:"dir" yaml:"dir"`
 	FileName  string `bson:"file" json:"file" yaml:"file"`
-	*job.Base `bson:"metadata" json:"metadata" yaml:"metadata"`
+	// Layout determines how the downloaded archive is stored in
+	// the directory, and defaults to bond.FlatLayout.
+	Layout bond.CacheLayout `bson:"layout,omitempty" json:"layout,omitempty" yaml:"layout,omitempty"`
+	// Checksums, if specified, are verified against the
+	// downloaded archive before it's extracted.
+	Checksums []bond.Checksum `bson:"checksums,omitempty" json:"checksums,omitempty" yaml:"checksums,omitempty"`
+	// Extract controls the extraction of the downloaded archive.
+	Extract ExtractOptions `bson:"extract" json:"extract" yaml:"extract"`
+	// Partial determines whether a partial download, from a
+	// failed or cancelled job, is kept for the next attempt to
+	// resume, or removed immediately.
+	Partial bond.PartialFilePolicy `bson:"partial,omitempty" json:"partial,omitempty" yaml:"partial,omitempty"`
+	// Warnings are the warnings of the resolution of the archive,
+	// such as a fallback to a generic Linux build, which the job
+	// records in the build's provenance.
+	Warnings []string `bson:"warnings,omitempty" json:"warnings,omitempty" yaml:"warnings,omitempty"`
+	// AllowedHosts, if specified, are the only hosts that the job
+	// may request, in addition to the hosts that its process
+	// allows (see bond.Config.Restrict).
+	AllowedHosts []string `bson:"allowed_hosts,omitempty" json:"allowed_hosts,omitempty" yaml:"allowed_hosts,omitempty"`
+	// Cached reports whether the file was already downloaded when
+	// the job ran.
+	Cached bool `bson:"cached,omitempty" json:"cached,omitempty" yaml:"cached,omitempty"`
+	// Submitter is the tag of the job's submitter, which counts
+	// the job against the submitter's quota in queues that have
+	// one (see middleware.QuotaQueue).
+	Submitter string `bson:"tag,omitempty" json:"tag,omitempty" yaml:"tag,omitempty"`
+	// Key is the idempotency key of the job's submission, which
+	// queues that check keys (see middleware.IdempotentQueue) use
+	// to reject retries of the submission.
+	Key string `bson:"idempotency_key,omitempty" json:"idempotency_key,omitempty" yaml:"idempotency_key,omitempty"`
+	// JobLabels are the labels of the job, which management
+	// filters can select (see management.Labeled).
+	JobLabels map[string]string `bson:"labels,omitempty" json:"labels,omitempty" yaml:"labels,omitempty"`
+	// Trace is the trace context of the job's submission, which
+	// queues that trace jobs (see middleware.TracingQueue)
+	// continue when the job runs.
+	Trace middleware.TraceContext `bson:"trace,omitempty" json:"trace,omitempty" yaml:"trace,omitempty"`
+	// Sig is the signature of the job's payload, which queues
+	// that sign jobs (see middleware.SigningQueue) verify before
+	// the job runs.
+	Sig string `bson:"signature,omitempty" json:"signature,omitempty" yaml:"signature,omitempty"`
+	// JobEnvironments records the processes that dispatched and
+	// completed the job, in queues that record them (see
+	// middleware.EnvironmentQueue).
+	middleware.JobEnvironments `bson:"env" json:"env" yaml:"env"`
+	*job.Base                  `bson:"metadata" json:"metadata" yaml:"metadata"`
+
+	// conf is the configuration of the download's client, which
+	// is not serialized: jobs that run in other processes use the
+	// defaults, with that process's client options (e.g. its
+	// allowed hosts, see bond.ClientOptions).
+	conf *bond.Config
+	// budget, if specified, limits the retries of the download,
+	// across the jobs of a batch.
+	budget *RetryBudget
 }
 
 func init() {
@@ -78,6 +135,79 @@ func NewDownloadJob(url, path string, force bool) (*DownloadFileJob, error) {
 	return j, nil
 }
 
+// Tag returns the tag of the job's submitter, for quotas.
+func (j *DownloadFileJob) Tag() string { return j.Submitter }
+
+// SetTag sets the tag of the job's submitter, for quotas.
+func (j *DownloadFileJob) SetTag(tag string) { j.Submitter = tag }
+
+// IdempotencyKey returns the idempotency key of the job's submission.
+func (j *DownloadFileJob) IdempotencyKey() string { return j.Key }
+
+// SetIdempotencyKey sets the idempotency key of the job's submission.
+func (j *DownloadFileJob) SetIdempotencyKey(key string) { j.Key = key }
+
+// Labels returns the labels of the job.
+func (j *DownloadFileJob) Labels() map[string]string { return j.JobLabels }
+
+// SetLabel sets a label of the job.
+func (j *DownloadFileJob) SetLabel(key, value string) {
+	if j.JobLabels == nil {
+		j.JobLabels = map[string]string{}
+	}
+	j.JobLabels[key] = value
+}
+
+// TraceContext returns the trace context of the job's submission.
+func (j *DownloadFileJob) TraceContext() middleware.TraceContext { return j.Trace }
+
+// SetTraceContext sets the trace context of the job's submission.
+func (j *DownloadFileJob) SetTraceContext(tc middleware.TraceContext) { j.Trace = tc }
+
+// SigningPayload returns the parts of the job that determine the
+// download: the archive, its destination, and its verification and
+// extraction.
+func (j *DownloadFileJob) SigningPayload() ([]byte, error) {
+	return json.Marshal(struct {
+		URL       string                 `json:"url"`
+		Directory string                 `json:"dir"`
+		FileName  string                 `json:"file"`
+		Layout    bond.CacheLayout       `json:"layout"`
+		Checksums []bond.Checksum        `json:"checksums"`
+		Extract   ExtractOptions         `json:"extract"`
+		Partial   bond.PartialFilePolicy `json:"partial"`
+	}{j.URL, j.Directory, j.FileName, j.Layout, j.Checksums, j.Extract, j.Partial})
+}
+
+// Signature returns the signature of the job's payload.
+func (j *DownloadFileJob) Signature() string { return j.Sig }
+
+// SetSignature sets the signature of the job's payload.
+func (j *DownloadFileJob) SetSignature(sig string) { j.Sig = sig }
+
+// ExpandParameters resolves the expressions in the job's directory
+// (see middleware.ParamsQueue), and points the job's dependency on the
+// downloaded file, if it has one, at the file in the resolved
+// directory.
+func (j *DownloadFileJob) ExpandParameters(expand func(string) (string, error)) error {
+	dir, err := expand(j.Directory)
+	if err != nil {
+		return errors.Wrap(err, "problem resolving directory")
+	}
+	if dir == j.Directory {
+		return nil
+	}
+
+	if err = j.setDirectory(dir); err != nil {
+		return err
+	}
+	if d := j.Dependency(); d != nil && d.Type().Name == "create-file" {
+		j.SetDependency(dependency.NewCreatesFile(j.getFileName()))
+	}
+
+	return nil
+}
+
 // Run implements the main action of the Job. This implementation
 // checks the job directly and returns early if the downloaded file
 // exists. This behavior may be redundant in the case that the queue
@@ -85,12 +215,14 @@ func NewDownloadJob(url, path string, force bool) (*DownloadFileJob, error) {
 func (j *DownloadFileJob) Run(ctx context.Context) {
 	defer j.MarkComplete()
 
+	logger := middleware.Logger(ctx)
 	fn := j.getFileName()
 	defer attemptTimestampUpdate(fn)
 
 	// in theory the queue should do this next check, but most do not
 	if state := j.Dependency().State(); state == dependency.Passed {
-		grip.Debug(message.Fields{
+		j.Cached = true
+		logger.Debug(message.Fields{
 			"file":    fn,
 			"message": "file is already downloaded",
 			"op":      "none",
@@ -98,34 +230,66 @@ func (j *DownloadFileJob) Run(ctx context.Context) {
 		return
 	}
 
-	if err := bond.DownloadFile(ctx, j.URL, fn); err != nil {
-		j.handleError(errors.Wrapf(err, "problem downloading file %s", fn))
+	started := time.Now()
+	if err := j.budget.Do(ctx, func(ctx context.Context) error { return j.download(ctx, fn) }); err != nil {
+		j.handleError(logger, errors.Wrapf(err, "problem downloading file %s", fn))
+		j.handlePartial(ctx, logger, fn)
 		return
 	}
 
-	grip.Debug(message.Fields{
+	logger.Debug(message.Fields{
 		"op":   "downloaded file complete",
 		"file": fn,
 	})
 
-	if err := extractArchive(fn); err != nil {
-		j.handleError(errors.Wrap(err, "problem extracting artifacts"))
+	finished := time.Now()
+	artifact := &bond.Artifact{Path: fn, URL: j.URL, Checksums: j.Checksums}
+	verified, err := j.config().Verify(ctx, artifact)
+	if err != nil {
+		j.quarantine(logger, fn)
+		j.handleError(logger, errors.Wrap(err, "problem verifying download"))
+		return
+	}
+	verified.Archive = j.FileName
+	j.config().StoreArtifact(ctx, fn)
+
+	provenance, err := bond.NewProvenance(artifact, verified, started, finished)
+	if err != nil {
+		j.handleError(logger, errors.Wrap(err, "problem recording provenance"))
+		return
+	}
+	provenance.Predicate.Warnings = j.Warnings
+
+	if err := extractArchive(fn, j.Extract); err != nil {
+		j.handleError(logger, errors.Wrap(err, "problem extracting artifacts"))
 		return
 	}
+
+	buildDir := strings.TrimSuffix(fn, filepath.Ext(fn))
+	if len(verified.Verifiers) > 0 {
+		logger.Warning(message.WrapError(bond.WriteVerification(buildDir, verified), message.Fields{
+			"message": "problem recording archive verification",
+			"file":    fn,
+		}))
+	}
+	logger.Warning(message.WrapError(bond.WriteProvenance(buildDir, provenance), message.Fields{
+		"message": "problem recording archive provenance",
+		"file":    fn,
+	}))
 }
 
 //
 // Internal Methods
 //
 
-func extractArchive(fn string) error {
+func extractArchive(fn string, opts ExtractOptions) error {
 	dir := filepath.Dir(fn)
 	baseName := filepath.Base(fn)
 	baseName = baseName[:len(baseName)-4]
 
 	if filepath.Ext(fn) == ".tgz" {
 		// there is no tar.gz because we renamed it in setURL()
-		if err := archiver.TarGz.Open(fn, dir); err != nil {
+		if err := ExtractTarGz(fn, dir, opts); err != nil {
 			return errors.Wrap(err, "problem extracting archive")
 		}
 
@@ -145,6 +309,12 @@ func extractArchive(fn string) error {
 		for {
 			header, err := archive.Next()
 			if err == io.EOF {
+				// the archives of other components (e.g. the
+				// database tools) have no mongod, and keep
+				// the names of their directories
+				break
+			}
+			if err != nil {
 				return errors.Wrap(err, "could not read archive contents")
 			}
 			if strings.HasSuffix(header.Name, "mongod") {
@@ -160,7 +330,7 @@ func extractArchive(fn string) error {
 			}
 		}
 	} else if filepath.Ext(fn) == ".zip" {
-		if err := archiver.Zip.Open(fn, dir); err != nil {
+		if err := ExtractZip(fn, dir, opts); err != nil {
 			return errors.Wrap(err, "problem extracting archive")
 		}
 		r, err := zip.OpenReader(fn)
@@ -212,15 +382,114 @@ func attemptTimestampUpdate(fn string) {
 	}
 }
 
-func (j *DownloadFileJob) handleError(err error) {
+func (j *DownloadFileJob) handleError(logger grip.Journaler, err error) {
 	j.AddError(err)
 
-	grip.Error(message.WrapError(err, message.Fields{
+	logger.Error(message.WrapError(err, message.Fields{
 		"message": "problem downloading file",
 		"name":    j.FileName,
 		"op":      "cleaning up artifacts",
 	}))
-	grip.Warning(os.RemoveAll(j.getFileName())) // cleanup
+	logger.Warning(os.RemoveAll(j.getFileName())) // cleanup
+}
+
+// handlePartial removes the partial download, if the job's policy is
+// to remove partial files, so that cancelled or failed jobs do not
+// leave them behind.
+func (j *DownloadFileJob) handlePartial(ctx context.Context, logger grip.Journaler, fn string) {
+	if _, err := os.Stat(bond.PartialFileName(fn)); os.IsNotExist(err) {
+		return
+	}
+
+	if j.Partial != bond.RemovePartialFiles {
+		logger.Info(message.Fields{
+			"message":   "keeping partial download to resume",
+			"file":      fn,
+			"cancelled": ctx.Err() != nil,
+		})
+		return
+	}
+
+	logger.Warning(message.WrapError(bond.RemoveDownloadState(fn), message.Fields{
+		"message":   "problem removing partial download",
+		"file":      fn,
+		"cancelled": ctx.Err() != nil,
+	}))
+}
+
+// quarantine moves an archive that failed verification out of the
+// cache, so that later jobs download it again rather than treating
+// it as downloaded.
+func (j *DownloadFileJob) quarantine(logger grip.Journaler, fn string) {
+	target, err := bond.Quarantine(fn)
+	if err != nil {
+		logger.Warning(message.WrapError(err, message.Fields{
+			"message": "problem quarantining archive that failed verification",
+			"file":    fn,
+		}))
+		return
+	}
+
+	logger.Notice(message.Fields{
+		"message": "quarantined archive that failed verification",
+		"file":    fn,
+		"target":  target,
+	})
+}
+
+// config returns the configuration of the download's client,
+// restricted to the job's allowed hosts, if it has any.
+func (j *DownloadFileJob) config() *bond.Config {
+	if len(j.AllowedHosts) == 0 {
+		return j.conf
+	}
+
+	return j.conf.Restrict(j.AllowedHosts...)
+}
+
+// download fetches the archive, resuming the partial download left by
+// an earlier attempt, if any.
+func (j *DownloadFileJob) download(ctx context.Context, fn string) error {
+	if err := j.config().ResumeDownloadFile(ctx, j.URL, fn, j.Checksums); err != nil {
+		return err
+	}
+
+	if j.Layout != bond.ContentAddressedLayout {
+		return nil
+	}
+
+	store, err := bond.NewContentStore(j.Directory)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err = store.Add(fn); err != nil {
+		grip.Warning(os.Remove(fn))
+		return errors.Wrapf(err, "problem storing %s", fn)
+	}
+
+	return nil
+}
+
+// Events reports the release of a build that the job downloaded, to
+// notifiers of the job's queue (see notify.Notifier's Watch), unless
+// the build was already cached.
+func (j *DownloadFileJob) Events() []notify.Event {
+	if j.Cached {
+		return nil
+	}
+
+	fn := j.getFileName()
+	buildDir := strings.TrimSuffix(fn, filepath.Ext(fn))
+	e := notify.Event{Type: notify.ReleaseCached, Time: time.Now(), JobID: j.ID(), JobType: j.Type().Name, Path: fn}
+	if info, err := bond.GetInfoFromFileName(buildDir); err == nil {
+		e.Version = info.Version
+	}
+	if _, err := os.Stat(buildDir); err == nil && buildDir != fn {
+		e.Path = buildDir
+	}
+
+	return []notify.Event{e}
 }
 
 func (j *DownloadFileJob) getFileName() string {
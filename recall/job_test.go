@@ -3,10 +3,13 @@ package recall
 import (
 	"context"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/mongodb/amboy"
 	"github.com/mongodb/amboy/dependency"
@@ -16,6 +19,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/driver"
+	"github.com/tychoish/bond/middleware"
 )
 
 type DownloadJobSuite struct {
@@ -174,10 +180,11 @@ func (s *DownloadJobSuite) TestConstructorSetsDependencyBasedOnForceParameter()
 
 func (s *DownloadJobSuite) TestErrorHandler() {
 	s.False(s.job.HasErrors())
-	s.job.handleError(nil)
+	logger := grip.NewJournaler("recall-test")
+	s.job.handleError(logger, nil)
 	s.False(s.job.HasErrors())
 
-	s.job.handleError(errors.New("foo"))
+	s.job.handleError(logger, errors.New("foo"))
 	s.True(s.job.HasErrors())
 
 }
@@ -274,12 +281,220 @@ func TestJobRegistry(t *testing.T) {
 		names = append(names, n)
 	}
 
-	assert.Len(names, 1)
+	assert.Len(names, 5)
 
-	jobType := "bond-recall-download-file"
-	j, err := registry.GetJobFactory(jobType)
-	job := j()
-	assert.NoError(err)
-	assert.Implements((*amboy.Job)(nil), job)
-	assert.Equal(job.Type().Name, jobType)
+	for _, jobType := range []string{"bond-recall-download-file", processJobTypeName, refreshFeedJobTypeName, pruneCacheJobTypeName, driver.LockRecordTypeName} {
+		j, err := registry.GetJobFactory(jobType)
+		assert.NoError(err)
+		job := j()
+		assert.Implements((*amboy.Job)(nil), job)
+		assert.Equal(job.Type().Name, jobType)
+	}
+}
+
+func TestDownloadJobTraceContextPersists(t *testing.T) {
+	assert := assert.New(t)
+
+	j, err := NewDownloadJob("https://example.net/mongodb-linux-x86_64-4.0.0.tgz", os.TempDir(), false)
+	require.NoError(t, err)
+	assert.Implements((*middleware.Traced)(nil), j)
+	assert.Empty(j.TraceContext())
+
+	tc := middleware.TraceContext{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	j.SetTraceContext(tc)
+	payload, err := registry.MakeJobInterchange(j, amboy.JSON)
+	require.NoError(t, err)
+	out, err := payload.Resolve(amboy.JSON)
+	require.NoError(t, err)
+	assert.Equal(tc, out.(*DownloadFileJob).TraceContext())
+}
+
+func TestDownloadJobSignaturePersists(t *testing.T) {
+	assert := assert.New(t)
+
+	j, err := NewDownloadJob("https://example.net/mongodb-linux-x86_64-4.0.0.tgz", os.TempDir(), false)
+	require.NoError(t, err)
+	assert.Implements((*middleware.Signed)(nil), j)
+
+	before, err := j.SigningPayload()
+	require.NoError(t, err)
+
+	// the records of other middleware are not signed
+	j.SetSignature("abc123")
+	j.SetTraceContext(middleware.TraceContext{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"})
+	j.Cached = true
+	after, err := j.SigningPayload()
+	require.NoError(t, err)
+	assert.Equal(before, after)
+
+	payload, err := registry.MakeJobInterchange(j, amboy.JSON)
+	require.NoError(t, err)
+	out, err := payload.Resolve(amboy.JSON)
+	require.NoError(t, err)
+	assert.Equal("abc123", out.(*DownloadFileJob).Signature())
+	roundTrip, err := out.(*DownloadFileJob).SigningPayload()
+	require.NoError(t, err)
+	assert.Equal(before, roundTrip)
+
+	j.URL = "https://example.net/other.tgz"
+	changed, err := j.SigningPayload()
+	require.NoError(t, err)
+	assert.NotEqual(before, changed)
+}
+
+func TestDownloadJobExpandParameters(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-params")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	j, err := NewDownloadJob("https://example.net/mongodb-linux-x86_64-4.0.0.tgz", filepath.Join(dir, "{{ hostname }}"), false)
+	require.NoError(t, err)
+	assert.Implements((*middleware.Parameterized)(nil), j)
+
+	e := &middleware.Expander{Hostname: "worker-1"}
+	require.NoError(t, j.ExpandParameters(func(value string) (string, error) { return e.Expand(j, value) }))
+	assert.Equal(filepath.Join(dir, "worker-1"), j.Directory)
+
+	// the dependency checks the resolved file
+	require.NoError(t, os.MkdirAll(j.Directory, 0755))
+	require.NoError(t, ioutil.WriteFile(j.getFileName(), []byte("cached"), 0644))
+	assert.Equal(dependency.Passed, j.Dependency().State())
+
+	j.Directory = "{{ env \"HOME\" }}"
+	assert.Error(j.ExpandParameters(func(value string) (string, error) { return e.Expand(j, value) }))
+}
+
+func TestDownloadJobVerifiesChecksums(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "bond-job-checksum")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	j, err := NewDownloadJob(srv.URL+"/mongodb-linux-x86_64-4.0.0.tgz", dir, false)
+	require.NoError(t, err)
+	j.Checksums = []bond.Checksum{{Algorithm: bond.SHA1, Value: "aaf4c61ddcc5e8a2dabede0f3b482cd9aea9434e"}}
+	j.Run(context.Background())
+
+	require.Error(t, j.Error())
+	assert.Contains(j.Error().Error(), bond.ErrChecksumMismatch.Error())
+	_, err = os.Stat(j.getFileName())
+	assert.True(os.IsNotExist(err))
+
+	quarantined, err := bond.GetQuarantinedFiles(dir)
+	require.NoError(t, err)
+	require.Len(t, quarantined, 1)
+	assert.Equal(filepath.Join(dir, bond.QuarantineDirName, j.FileName), quarantined[0].Path)
+}
+
+func TestDownloadJobAllowedHosts(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "bond-job-allowed-hosts")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	j, err := NewDownloadJob(srv.URL+"/mongodb-linux-x86_64-4.0.0.tgz", dir, false)
+	require.NoError(t, err)
+	j.AllowedHosts = []string{"downloads.mongodb.org"}
+
+	// the hosts survive serialization, for the jobs of remote queues
+	payload, err := registry.MakeJobInterchange(j, amboy.JSON)
+	require.NoError(t, err)
+	out, err := payload.Resolve(amboy.JSON)
+	require.NoError(t, err)
+	assert.Equal(j.AllowedHosts, out.(*DownloadFileJob).AllowedHosts)
+
+	out.Run(context.Background())
+	require.Error(t, out.Error())
+	assert.Contains(out.Error().Error(), bond.ErrHostNotAllowed.Error())
+	assert.Equal(0, requests)
+
+	// the job's hosts do not widen those of its process's config
+	j, err = NewDownloadJob(srv.URL+"/mongodb-linux-x86_64-4.0.1.tgz", dir, false)
+	require.NoError(t, err)
+	j.conf = bond.NewConfig(bond.WithAllowedHosts("downloads.mongodb.org"))
+	j.AllowedHosts = []string{"127.0.0.1"}
+	j.Run(context.Background())
+	require.Error(t, j.Error())
+	assert.Contains(j.Error().Error(), bond.ErrHostNotAllowed.Error())
+	assert.Equal(0, requests)
+
+	j, err = NewDownloadJob(srv.URL+"/mongodb-linux-x86_64-4.0.2.tgz", dir, false)
+	require.NoError(t, err)
+	j.AllowedHosts = []string{"127.0.0.1"}
+	j.Run(context.Background())
+	assert.Equal(1, requests)
+}
+
+func TestDownloadJobPartialFilePolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "11")
+		_, _ = w.Write([]byte("hello"))
+		w.(http.Flusher).Flush()
+		if strings.HasPrefix(r.URL.Path, "/blocking/") {
+			<-r.Context().Done()
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "bond-job-partial")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	j, err := NewDownloadJob(srv.URL+"/mongodb-linux-x86_64-4.0.0.tgz", dir, false)
+	require.NoError(t, err)
+	j.Run(context.Background())
+	require.Error(t, j.Error())
+	_, err = os.Stat(bond.PartialFileName(j.getFileName()))
+	assert.NoError(err, "partial file kept to resume")
+
+	require.NoError(t, bond.RemoveDownloadState(j.getFileName()))
+	j, err = NewDownloadJob(srv.URL+"/blocking/mongodb-linux-x86_64-4.0.1.tgz", dir, false)
+	require.NoError(t, err)
+	j.Partial = bond.RemovePartialFiles
+	partial := bond.PartialFileName(j.getFileName())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		j.Run(ctx)
+	}()
+
+	for {
+		if stat, err := os.Stat(partial); err == nil && stat.Size() == 5 {
+			break
+		}
+		select {
+		case <-done:
+			require.FailNow(t, "job finished before cancellation")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	cancel()
+	<-done
+
+	require.Error(t, j.Error())
+	for _, fn := range []string{partial, bond.DownloadStateFileName(j.getFileName())} {
+		_, err = os.Stat(fn)
+		assert.True(os.IsNotExist(err), fn)
+	}
 }
@@ -0,0 +1,208 @@
+package recall
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+)
+
+// ManifestEntry is an entry of a manifest: a set of releases and the
+// build to download for each. Fields that an entry does not specify
+// take their values from the manifest's defaults.
+type ManifestEntry struct {
+	// Version is a release (e.g. 4.4.1) or a series, which
+	// resolves as the positional arguments of recall download do
+	// (e.g. 6.0 for the newest nightly, or 6.0-current).
+	Version  string   `bson:"version,omitempty" json:"version,omitempty" yaml:"version,omitempty"`
+	Versions []string `bson:"versions,omitempty" json:"versions,omitempty" yaml:"versions,omitempty"`
+	// Constraint selects the releases in the feed that satisfy a
+	// semantic version range (e.g. ">=6.0.0 <6.0.10").
+	Constraint string `bson:"constraint,omitempty" json:"constraint,omitempty" yaml:"constraint,omitempty"`
+	// Latest limits a constraint to the newest release that
+	// satisfies it.
+	Latest  bool   `bson:"latest,omitempty" json:"latest,omitempty" yaml:"latest,omitempty"`
+	Target  string `bson:"target,omitempty" json:"target,omitempty" yaml:"target,omitempty"`
+	Arch    string `bson:"arch,omitempty" json:"arch,omitempty" yaml:"arch,omitempty"`
+	Edition string `bson:"edition,omitempty" json:"edition,omitempty" yaml:"edition,omitempty"`
+	Debug   bool   `bson:"debug,omitempty" json:"debug,omitempty" yaml:"debug,omitempty"`
+}
+
+// Manifest is a declarative list of builds to download.
+type Manifest struct {
+	Defaults ManifestEntry   `bson:"defaults" json:"defaults" yaml:"defaults"`
+	Builds   []ManifestEntry `bson:"builds" json:"builds" yaml:"builds"`
+}
+
+// ManifestBuild is a resolved entry of a manifest.
+type ManifestBuild struct {
+	Releases []string          `bson:"releases" json:"releases" yaml:"releases"`
+	Options  bond.BuildOptions `bson:"options" json:"options" yaml:"options"`
+}
+
+// ReadManifest reads a manifest from a file, as JSON or as YAML. YAML
+// manifests may use block-style mappings and sequences, flow
+// sequences of scalars, and comments, but not anchors, flow mappings,
+// or multi-line strings.
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading manifest %s", path)
+	}
+
+	m, err := ParseManifest(data)
+	return m, errors.Wrapf(err, "problem parsing manifest %s", path)
+}
+
+// ParseManifest parses a manifest from JSON or YAML data.
+func ParseManifest(data []byte) (*Manifest, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		doc, err := decodeYAML(data)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, errors.Wrap(err, "problem converting manifest")
+		}
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, errors.Wrap(err, "problem converting manifest")
+	}
+
+	if len(m.Builds) == 0 {
+		return nil, errors.New("manifest has no builds")
+	}
+
+	return m, nil
+}
+
+func mergeManifestEntry(entry, defaults ManifestEntry) ManifestEntry {
+	if entry.Target == "" {
+		entry.Target = defaults.Target
+	}
+	if entry.Arch == "" {
+		entry.Arch = defaults.Arch
+	}
+	if entry.Edition == "" {
+		entry.Edition = defaults.Edition
+	}
+	entry.Debug = entry.Debug || defaults.Debug
+
+	return entry
+}
+
+// Resolve returns the releases and build options of each entry of the
+// manifest, resolving constraints against the feed. Resolve reports
+// the problems of every entry, rather than stopping at the first.
+func (m *Manifest) Resolve(feed *bond.ArtifactsFeed) ([]ManifestBuild, error) {
+	catcher := grip.NewBasicCatcher()
+	out := make([]ManifestBuild, 0, len(m.Builds))
+
+	for idx, entry := range m.Builds {
+		entry = mergeManifestEntry(entry, m.Defaults)
+		build := ManifestBuild{
+			Options: bond.BuildOptions{
+				Target:  entry.Target,
+				Arch:    bond.ParseArch(entry.Arch),
+				Edition: bond.MongoDBEdition(entry.Edition),
+				Debug:   entry.Debug,
+			},
+		}
+		if err := build.Options.Validate(); err != nil {
+			catcher.Add(errors.Wrapf(err, "build %d has invalid options", idx+1))
+			continue
+		}
+
+		if entry.Version != "" {
+			build.Releases = append(build.Releases, entry.Version)
+		}
+		build.Releases = append(build.Releases, entry.Versions...)
+
+		if entry.Constraint != "" {
+			matches, err := feed.Match(entry.Constraint)
+			if err != nil {
+				catcher.Add(errors.Wrapf(err, "problem resolving build %d", idx+1))
+				continue
+			}
+			if entry.Latest {
+				matches = matches[len(matches)-1:]
+			}
+			for _, version := range matches {
+				build.Releases = append(build.Releases, version.Version)
+			}
+		}
+
+		if len(build.Releases) == 0 {
+			catcher.Add(errors.Errorf("build %d must specify a version, versions, or a constraint", idx+1))
+			continue
+		}
+
+		out = append(out, build)
+	}
+
+	return out, catcher.Resolve()
+}
+
+// FetchManifest downloads every build of the manifest into the path,
+// through a single queue with the queue options, and records the run in the history, if it's
+// not nil. FetchManifest returns an error if any entry of the
+// manifest does not resolve or any download fails, but downloads the
+// builds that do resolve.
+func FetchManifest(ctx context.Context, history History, qopts QueueOptions, m *Manifest, path string, opts ...bond.Option) error {
+	run := &Run{Path: path, Started: time.Now()}
+	run.ID = run.Started.UTC().Format("20060102T150405.000000000")
+
+	err := fetchManifest(ctx, run, qopts, m, path, opts...)
+	run.Finished = time.Now()
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	if history == nil {
+		return err
+	}
+
+	if herr := history.Record(context.Background(), *run); herr != nil {
+		if err == nil {
+			return errors.Wrap(herr, "problem recording run")
+		}
+		return errors.Wrapf(err, "problem recording run (%s)", herr)
+	}
+
+	return err
+}
+
+func fetchManifest(ctx context.Context, run *Run, qopts QueueOptions, m *Manifest, path string, opts ...bond.Option) error {
+	conf := bond.NewConfig(opts...)
+	if path == "" {
+		path = conf.CachePath
+	}
+
+	feed, err := loadFeed(ctx, path, opts...)
+	if err != nil {
+		return errors.Wrap(err, "problem generating data feed")
+	}
+
+	builds, resolveErr := m.Resolve(feed)
+	for _, b := range builds {
+		for _, rel := range b.Releases {
+			run.Releases = append(run.Releases, fmt.Sprintf("%s (%s)", rel, b.Options))
+		}
+	}
+
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(resolveErr)
+	if len(builds) > 0 {
+		catcher.Add(fetchBuilds(ctx, run, qopts, feed, conf, path, builds))
+	}
+
+	return catcher.Resolve()
+}
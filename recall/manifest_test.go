@@ -0,0 +1,140 @@
+package recall
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond"
+)
+
+const testManifest = `
+# builds for the compatibility tests
+defaults:
+  edition: enterprise
+  arch: x86_64
+  target: ubuntu2204
+
+builds:
+- version: 7.0.2          # pinned
+- versions: [6.0.9, "6.0.8"]
+  debug: true
+- constraint: ">=6.0.0 <7.0.0"
+  latest: true
+  edition: 'base'
+`
+
+func TestParseManifest(t *testing.T) {
+	assert := assert.New(t)
+
+	m, err := ParseManifest([]byte(testManifest))
+	require.NoError(t, err)
+	assert.Equal("ubuntu2204", m.Defaults.Target)
+	require.Len(t, m.Builds, 3)
+	assert.Equal("7.0.2", m.Builds[0].Version)
+	assert.Equal([]string{"6.0.9", "6.0.8"}, m.Builds[1].Versions)
+	assert.True(m.Builds[1].Debug)
+	assert.Equal(">=6.0.0 <7.0.0", m.Builds[2].Constraint)
+	assert.True(m.Builds[2].Latest)
+	assert.Equal("base", m.Builds[2].Edition)
+
+	fromJSON, err := ParseManifest([]byte(`{"defaults": {"target": "ubuntu2204"}, "builds": [{"version": "7.0.2"}]}`))
+	require.NoError(t, err)
+	assert.Equal("7.0.2", fromJSON.Builds[0].Version)
+
+	for name, doc := range map[string]string{
+		"empty":         "",
+		"no builds":     "defaults:\n  target: rhel80\n",
+		"tabs":          "builds:\n\t- version: 7.0.2\n",
+		"anchors":       "builds:\n- version: &v 7.0.2\n",
+		"duplicate key": "builds:\n- version: 7.0.2\n  version: 7.0.3\n",
+		"indentation":   "builds:\n  - version: 7.0.2\n - version: 7.0.3\n",
+		"not a mapping": "builds:\n- version: 7.0.2\n  7.0.3\n",
+	} {
+		_, err = ParseManifest([]byte(doc))
+		assert.Error(err, name)
+	}
+}
+
+func TestDecodeYAML(t *testing.T) {
+	assert := assert.New(t)
+
+	doc, err := decodeYAML([]byte("---\na:\n  - 1\n  -\n    b: \"x # y\"\n  - [c, 'd''s']\nempty:\nflag: false\nnull: ~\n"))
+	require.NoError(t, err)
+	assert.Equal(map[string]interface{}{
+		"a": []interface{}{
+			"1",
+			map[string]interface{}{"b": "x # y"},
+			[]interface{}{"c", "d's"},
+		},
+		"empty": nil,
+		"flag":  false,
+		"null":  nil,
+	}, doc)
+}
+
+func TestManifestResolve(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "recall-manifest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	feed, err := bond.NewArtifactsFeed(dir)
+	require.NoError(t, err)
+	require.NoError(t, feed.Reload([]byte(matrixTestFeed)))
+
+	m, err := ParseManifest([]byte(testManifest))
+	require.NoError(t, err)
+
+	builds, err := m.Resolve(feed)
+	require.NoError(t, err)
+	require.Len(t, builds, 3)
+	assert.Equal([]string{"7.0.2"}, builds[0].Releases)
+	assert.Equal(bond.BuildOptions{Target: "ubuntu2204", Arch: bond.AMD64, Edition: bond.Enterprise}, builds[0].Options)
+	assert.True(builds[1].Options.Debug)
+	assert.Equal([]string{"6.0.9"}, builds[2].Releases)
+	assert.Equal(bond.MongoDBEdition(bond.Base), builds[2].Options.Edition)
+
+	m.Builds = append(m.Builds, ManifestEntry{Constraint: ">=9.0.0"}, ManifestEntry{Target: "rhel90"})
+	builds, err = m.Resolve(feed)
+	require.Error(t, err)
+	assert.Len(builds, 3)
+	assert.Contains(err.Error(), "build 4")
+	assert.Contains(err.Error(), "build 5")
+
+	m = &Manifest{Builds: []ManifestEntry{{Version: "7.0.2"}}}
+	_, err = m.Resolve(feed)
+	require.Error(t, err)
+	assert.Contains(err.Error(), "build 1 has invalid options")
+}
+
+func TestFetchManifestRecordsUnresolvedBuilds(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "recall-manifest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "full.json"), []byte(matrixTestFeed), 0644))
+
+	m := &Manifest{
+		Defaults: ManifestEntry{Target: "ubuntu2204", Arch: "x86_64", Edition: "enterprise"},
+		Builds:   []ManifestEntry{{Constraint: ">=9.0.0"}, {Version: "6.0.9", Target: "rhel90"}},
+	}
+
+	history := NewFileHistory(filepath.Join(dir, HistoryFileName))
+	err = FetchManifest(context.Background(), history, QueueOptions{}, m, dir, bond.WithCachePath(dir))
+	require.Error(t, err)
+	assert.Contains(err.Error(), "no releases match")
+	assert.Contains(err.Error(), "rhel90")
+
+	runs, err := history.Runs(context.Background(), 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.True(runs[0].Failed())
+	assert.Len(runs[0].Releases, 1)
+}
@@ -0,0 +1,233 @@
+package recall
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// yamlLine is a significant line of a YAML document: its indentation
+// and its content, without comments.
+type yamlLine struct {
+	number  int
+	indent  int
+	content string
+}
+
+// decodeYAML decodes the block-style subset of YAML that manifests
+// use: mappings, sequences, flow sequences of scalars, quoted and
+// plain scalars, and comments. The result has the shape of a decoded
+// JSON document, with booleans and nulls decoded and all other
+// scalars as strings, so that versions such as 6.0 are not numbers.
+func decodeYAML(data []byte) (interface{}, error) {
+	lines := []yamlLine{}
+	for idx, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(stripYAMLComment(raw), " \t\r")
+		content := strings.TrimLeft(raw, " ")
+		if content == "" || content == "---" {
+			continue
+		}
+		if strings.HasPrefix(content, "\t") {
+			return nil, errors.Errorf("line %d is indented with a tab", idx+1)
+		}
+
+		lines = append(lines, yamlLine{number: idx + 1, indent: len(raw) - len(content), content: content})
+	}
+
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	d := &yamlDecoder{lines: lines}
+	out, err := d.block(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos < len(d.lines) {
+		return nil, errors.Errorf("line %d is not indented consistently", d.lines[d.pos].number)
+	}
+
+	return out, nil
+}
+
+type yamlDecoder struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (d *yamlDecoder) block(indent int) (interface{}, error) {
+	if isYAMLSequenceItem(d.lines[d.pos].content) {
+		return d.sequence(indent)
+	}
+	return d.mapping(indent)
+}
+
+func (d *yamlDecoder) sequence(indent int) (interface{}, error) {
+	out := []interface{}{}
+	for d.pos < len(d.lines) {
+		line := d.lines[d.pos]
+		if line.indent != indent || !isYAMLSequenceItem(line.content) {
+			break
+		}
+
+		rest := strings.TrimLeft(strings.TrimPrefix(line.content, "-"), " ")
+		switch {
+		case rest == "":
+			d.pos++
+			if d.pos >= len(d.lines) || d.lines[d.pos].indent <= indent {
+				out = append(out, nil)
+				continue
+			}
+			value, err := d.block(d.lines[d.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, value)
+		case isYAMLMappingEntry(rest):
+			// the item is a mapping that starts on the line of
+			// its dash, so continue it at the indentation of
+			// its first key.
+			d.lines[d.pos] = yamlLine{number: line.number, indent: line.indent + len(line.content) - len(rest), content: rest}
+			value, err := d.mapping(d.lines[d.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, value)
+		default:
+			value, err := parseYAMLScalar(rest, line.number)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, value)
+			d.pos++
+		}
+	}
+
+	return out, nil
+}
+
+func (d *yamlDecoder) mapping(indent int) (interface{}, error) {
+	out := map[string]interface{}{}
+	for d.pos < len(d.lines) {
+		line := d.lines[d.pos]
+		if line.indent != indent || isYAMLSequenceItem(line.content) {
+			break
+		}
+		if !isYAMLMappingEntry(line.content) {
+			return nil, errors.Errorf("line %d is not a key and value", line.number)
+		}
+
+		key, rest := splitYAMLMappingEntry(line.content)
+		if _, ok := out[key]; ok {
+			return nil, errors.Errorf("line %d repeats the key '%s'", line.number, key)
+		}
+		d.pos++
+
+		if rest != "" {
+			value, err := parseYAMLScalar(rest, line.number)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = value
+			continue
+		}
+
+		// the value is a nested block, which, for sequences,
+		// may be at the indentation of the key.
+		if d.pos < len(d.lines) {
+			next := d.lines[d.pos]
+			if next.indent > indent || (next.indent == indent && isYAMLSequenceItem(next.content)) {
+				value, err := d.block(next.indent)
+				if err != nil {
+					return nil, err
+				}
+				out[key] = value
+				continue
+			}
+		}
+		out[key] = nil
+	}
+
+	return out, nil
+}
+
+func isYAMLSequenceItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ")
+}
+
+func isYAMLMappingEntry(content string) bool {
+	if strings.HasPrefix(content, "\"") || strings.HasPrefix(content, "'") || strings.HasPrefix(content, "[") {
+		return false
+	}
+	return strings.Contains(content, ": ") || strings.HasSuffix(content, ":")
+}
+
+func splitYAMLMappingEntry(content string) (string, string) {
+	if idx := strings.Index(content, ": "); idx >= 0 {
+		return strings.TrimSpace(content[:idx]), strings.TrimSpace(content[idx+2:])
+	}
+	return strings.TrimSpace(strings.TrimSuffix(content, ":")), ""
+}
+
+func parseYAMLScalar(value string, line int) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(value, "["):
+		if !strings.HasSuffix(value, "]") {
+			return nil, errors.Errorf("line %d has an unterminated list", line)
+		}
+		out := []interface{}{}
+		for _, elem := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(value, "["), "]"), ",") {
+			if elem = strings.TrimSpace(elem); elem == "" {
+				continue
+			}
+			parsed, err := parseYAMLScalar(elem, line)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, parsed)
+		}
+		return out, nil
+	case strings.HasPrefix(value, "\""):
+		out, err := strconv.Unquote(value)
+		return out, errors.Wrapf(err, "line %d has an invalid quoted string", line)
+	case strings.HasPrefix(value, "'"):
+		if len(value) < 2 || !strings.HasSuffix(value, "'") {
+			return nil, errors.Errorf("line %d has an unterminated string", line)
+		}
+		return strings.Replace(value[1:len(value)-1], "''", "'", -1), nil
+	case strings.HasPrefix(value, "{") || strings.HasPrefix(value, "&") || strings.HasPrefix(value, "*") || value == "|" || value == ">":
+		return nil, errors.Errorf("line %d uses YAML that manifests do not support", line)
+	}
+
+	switch value {
+	case "null", "~":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+
+	return value, nil
+}
+
+// stripYAMLComment removes a comment, which starts with a # at the
+// beginning of the line or after a space, outside of quotes.
+func stripYAMLComment(line string) string {
+	var quote rune
+	for idx, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case (r == '"' || r == '\'') && (idx == 0 || strings.ContainsRune(" \t[,:", rune(line[idx-1]))):
+			quote = r
+		case r == '#' && (idx == 0 || line[idx-1] == ' ' || line[idx-1] == '\t'):
+			return line[:idx]
+		}
+	}
+
+	return line
+}
@@ -0,0 +1,106 @@
+package recall
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+)
+
+// MatrixFormat is the output format of WriteMatrix.
+type MatrixFormat string
+
+// The matrix formats. JSONMatrix is a JSON array of entries, and
+// GitHubMatrix is an object with the entries as its "include" list,
+// as GitHub Actions' fromJSON expects for a job's strategy matrix.
+const (
+	JSONMatrix   MatrixFormat = "json"
+	GitHubMatrix MatrixFormat = "github"
+)
+
+// MatrixEntry is a resolved build of a CI matrix: the current release
+// of a series for a target, with a key that changes whenever the
+// resolved archive does, for caching the build between CI runs.
+type MatrixEntry struct {
+	Series   string `bson:"series" json:"series" yaml:"series"`
+	Version  string `bson:"version" json:"version" yaml:"version"`
+	Target   string `bson:"target" json:"target" yaml:"target"`
+	Arch     string `bson:"arch" json:"arch" yaml:"arch"`
+	Edition  string `bson:"edition" json:"edition" yaml:"edition"`
+	URL      string `bson:"url" json:"url" yaml:"url"`
+	CacheKey string `bson:"cache_key" json:"cache_key" yaml:"cache_key"`
+}
+
+// BuildMatrix resolves the current release of each series for each
+// target, with the architecture, edition, and debug option of the
+// build options. BuildMatrix returns an error, and no entries, if any
+// combination does not resolve, so that a CI configuration never
+// silently loses coverage.
+func BuildMatrix(feed *bond.ArtifactsFeed, series, targets []string, options bond.BuildOptions) ([]MatrixEntry, error) {
+	catcher := grip.NewBasicCatcher()
+	entries := make([]MatrixEntry, 0, len(series)*len(targets))
+
+	for _, s := range series {
+		version, err := feed.GetStableRelease(s)
+		if err != nil {
+			catcher.Add(errors.Wrapf(err, "problem resolving %s", s))
+			continue
+		}
+
+		for _, target := range targets {
+			opts := options
+			opts.Target = target
+
+			url, err := feed.GetCurrentArchive(s, opts)
+			if err != nil {
+				catcher.Add(errors.Wrapf(err, "problem resolving %s for %s", s, target))
+				continue
+			}
+
+			sum := sha256.Sum256([]byte(url))
+			entries = append(entries, MatrixEntry{
+				Series:   s,
+				Version:  version.Version,
+				Target:   target,
+				Arch:     string(opts.Arch),
+				Edition:  string(opts.Edition),
+				URL:      url,
+				CacheKey: fmt.Sprintf("mongodb-%s-%s-%s-%s-%s", version.Version, target, opts.Arch, opts.Edition, hex.EncodeToString(sum[:6])),
+			})
+		}
+	}
+
+	if catcher.HasErrors() {
+		return nil, catcher.Resolve()
+	}
+
+	return entries, nil
+}
+
+// WriteMatrix writes the entries to the writer in the format.
+func WriteMatrix(w io.Writer, entries []MatrixEntry, format MatrixFormat) error {
+	var doc interface{}
+	switch format {
+	case JSONMatrix, "":
+		doc = entries
+	case GitHubMatrix:
+		doc = struct {
+			Include []MatrixEntry `json:"include"`
+		}{Include: entries}
+	default:
+		return errors.Errorf("'%s' is not a valid matrix format", format)
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return errors.Wrap(err, "problem encoding matrix")
+	}
+
+	_, err = fmt.Fprintln(w, string(out))
+	return errors.Wrap(err, "problem writing matrix")
+}
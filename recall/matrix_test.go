@@ -0,0 +1,63 @@
+package recall
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond"
+)
+
+const matrixTestFeed = `{"versions": [
+  {"version": "7.0.2", "current": true, "downloads": [
+    {"target": "ubuntu2204", "arch": "x86_64", "edition": "enterprise", "archive": {"url": "https://example.net/ubuntu2204-7.0.2.tgz"}},
+    {"target": "rhel90", "arch": "x86_64", "edition": "enterprise", "archive": {"url": "https://example.net/rhel90-7.0.2.tgz"}}]},
+  {"version": "6.0.9", "current": true, "downloads": [
+    {"target": "ubuntu2204", "arch": "x86_64", "edition": "enterprise", "archive": {"url": "https://example.net/ubuntu2204-6.0.9.tgz"}}]}
+]}`
+
+func TestBuildMatrix(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "recall-matrix")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	feed, err := bond.NewArtifactsFeed(dir)
+	require.NoError(t, err)
+	require.NoError(t, feed.Reload([]byte(matrixTestFeed)))
+
+	opts := bond.BuildOptions{Arch: bond.AMD64, Edition: bond.Enterprise}
+	entries, err := BuildMatrix(feed, []string{"7.0", "6.0"}, []string{"ubuntu2204"}, opts)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal("7.0.2", entries[0].Version)
+	assert.Equal("https://example.net/ubuntu2204-6.0.9.tgz", entries[1].URL)
+	assert.Contains(entries[0].CacheKey, "mongodb-7.0.2-ubuntu2204-x86_64-enterprise-")
+	assert.NotEqual(entries[0].CacheKey, entries[1].CacheKey)
+
+	_, err = BuildMatrix(feed, []string{"7.0", "6.0"}, []string{"ubuntu2204", "rhel90"}, opts)
+	assert.Error(err)
+	_, err = BuildMatrix(feed, []string{"5.0"}, []string{"ubuntu2204"}, opts)
+	assert.Error(err)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteMatrix(buf, entries, GitHubMatrix))
+	doc := struct {
+		Include []MatrixEntry `json:"include"`
+	}{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(entries, doc.Include)
+
+	buf.Reset()
+	require.NoError(t, WriteMatrix(buf, entries, JSONMatrix))
+	list := []MatrixEntry{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &list))
+	assert.Equal(entries, list)
+
+	assert.Error(WriteMatrix(buf, entries, "yaml"))
+}
@@ -0,0 +1,38 @@
+package recall
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/notify"
+)
+
+// ReadNotifier reads the configuration of a notifier (see
+// notify.Config) from a file, as JSON or as the subset of YAML that
+// manifests use (see ReadManifest), and builds the notifier, for the
+// Notifier of QueueOptions.
+func ReadNotifier(path string) (*notify.Notifier, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading notification config %s", path)
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		doc, err := decodeYAML(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem parsing notification config %s", path)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, errors.Wrap(err, "problem converting notification config")
+		}
+	}
+
+	conf := notify.Config{}
+	if err = json.Unmarshal(data, &conf); err != nil {
+		return nil, errors.Wrapf(err, "problem parsing notification config %s", path)
+	}
+
+	return notify.NewNotifier(conf, nil)
+}
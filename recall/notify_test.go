@@ -0,0 +1,95 @@
+package recall
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/notify"
+	"github.com/tychoish/bond/testutil"
+)
+
+const notifyTestConfig = `
+senders:
+  - name: builds
+    type: webhook
+    webhook:
+      url: %s
+rules:
+  # notify #builds when the release candidate appears and is cached
+  - events: [release-available, release-cached]
+    versions: '^8\.0\.0-rc0$'
+    senders: [builds]
+`
+
+func TestNotifyReleaseAvailableAndCached(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var mu sync.Mutex
+	events := []notify.Event{}
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := notify.Event{}
+		assert.NoError(json.NewDecoder(r.Body).Decode(&e))
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}))
+	defer hook.Close()
+
+	dir, err := ioutil.TempDir("", "bond-notify")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	confFile := filepath.Join(dir, "notify.yaml")
+	require.NoError(t, ioutil.WriteFile(confFile, []byte(fmt.Sprintf(notifyTestConfig, hook.URL)), 0644))
+	n, err := ReadNotifier(confFile)
+	require.NoError(t, err)
+	qopts := QueueOptions{Notifier: n}
+
+	// the cache has the feed from before the release candidate
+	srv := testutil.NewServer(testutil.Release{Version: "7.0.2"})
+	defer srv.Close()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "full.json"), srv.Feed(), 0644))
+	srv.AddRelease(testutil.Release{Version: "8.0.0-rc0"})
+
+	conf := bond.NewConfig(srv.Options()...)
+	q, closer, err := qopts.newQueue(ctx, conf)
+	require.NoError(t, err)
+	refresh := NewRefreshFeedJob(conf, dir, time.Now())
+	require.NoError(t, q.Put(ctx, refresh))
+	require.True(t, amboy.WaitInterval(ctx, q, 10*time.Millisecond))
+	closer()
+	assert.NoError(refresh.Error())
+	assert.Equal([]string{"8.0.0-rc0"}, refresh.Released)
+
+	require.NoError(t, fetchReleases(ctx, nil, qopts, []string{"7.0.2", "8.0.0-rc0"}, dir, clusterTestOptions, srv.Options()...))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, events, 2)
+	assert.Equal(notify.ReleaseAvailable, events[0].Type)
+	assert.Equal("8.0.0-rc0", events[0].Version)
+	assert.Equal(notify.ReleaseCached, events[1].Type)
+	assert.Equal("8.0.0-rc0", events[1].Version)
+	assert.Equal(filepath.Join(dir, "mongodb-linux-x86_64-ubuntu2204-8.0.0-rc0"), events[1].Path)
+
+	_, err = ReadNotifier(filepath.Join(dir, "missing.yaml"))
+	assert.Error(err)
+	require.NoError(t, ioutil.WriteFile(confFile, []byte(`{"rules": [{"senders": ["oncall"]}]}`), 0644))
+	_, err = ReadNotifier(confFile)
+	assert.Error(err)
+}
@@ -0,0 +1,263 @@
+package recall
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/jobs"
+)
+
+// PlanConstraints describe the builds that a cache should contain.
+// The plan includes every combination of the releases, editions,
+// targets, and architectures. Releases may be versions (e.g. 4.0.3)
+// or series, in any of the forms that bond.ArtifactsFeed.GetArchives
+// accepts (e.g. 4.0, 4.0-latest, or 4.0-current).
+type PlanConstraints struct {
+	Releases []string              `bson:"releases" json:"releases" yaml:"releases"`
+	Editions []bond.MongoDBEdition `bson:"editions" json:"editions" yaml:"editions"`
+	Targets  []string              `bson:"targets" json:"targets" yaml:"targets"`
+	Archs    []bond.MongoDBArch    `bson:"archs" json:"archs" yaml:"archs"`
+	Debug    bool                  `bson:"debug" json:"debug" yaml:"debug"`
+}
+
+// Validate returns an error if any of the constraints are empty.
+func (c PlanConstraints) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(len(c.Releases) == 0, "must specify at least one release")
+	catcher.NewWhen(len(c.Editions) == 0, "must specify at least one edition")
+	catcher.NewWhen(len(c.Targets) == 0, "must specify at least one target")
+	catcher.NewWhen(len(c.Archs) == 0, "must specify at least one arch")
+	return catcher.Resolve()
+}
+
+// BuildOptions returns every combination of the editions, targets,
+// and architectures.
+func (c PlanConstraints) BuildOptions() []bond.BuildOptions {
+	out := []bond.BuildOptions{}
+	for _, edition := range c.Editions {
+		for _, target := range c.Targets {
+			for _, arch := range c.Archs {
+				out = append(out, bond.BuildOptions{
+					Target:  target,
+					Arch:    arch,
+					Edition: edition,
+					Debug:   c.Debug,
+				})
+			}
+		}
+	}
+
+	return out
+}
+
+// PlanItem describes one archive in a plan.
+type PlanItem struct {
+	Release string            `bson:"release" json:"release" yaml:"release"`
+	Options bond.BuildOptions `bson:"options" json:"options" yaml:"options"`
+	URL     string            `bson:"url" json:"url" yaml:"url"`
+	File    string            `bson:"file" json:"file" yaml:"file"`
+	// Checksums are the checksums that the feed publishes for
+	// the archive, which the download verifies.
+	Checksums []bond.Checksum `bson:"checksums,omitempty" json:"checksums,omitempty" yaml:"checksums,omitempty"`
+	// Size is the size of the archive in bytes, or -1 if it is
+	// not known. Sizes are only known after Measure.
+	Size int64 `bson:"size" json:"size" yaml:"size"`
+}
+
+// Plan is the set of downloads needed to bring a cache directory up
+// to date with a set of constraints. Plans are computed without
+// modifying the cache, so that they can be reviewed (and measured)
+// before the downloads are enqueued.
+type Plan struct {
+	Path string `bson:"path" json:"path" yaml:"path"`
+	// Downloads are the archives that the cache is missing, each
+	// listed once even if several constraints resolve to it.
+	Downloads []PlanItem `bson:"downloads" json:"downloads" yaml:"downloads"`
+	// Cached are the archives that the cache already contains.
+	Cached []PlanItem `bson:"cached" json:"cached" yaml:"cached"`
+	// Unavailable describes combinations of constraints that the
+	// feed has no builds for.
+	Unavailable []string `bson:"unavailable" json:"unavailable" yaml:"unavailable"`
+}
+
+// NewPlan computes the downloads needed for the cache at path to
+// satisfy the constraints.
+func NewPlan(feed *bond.ArtifactsFeed, path string, c PlanConstraints) (*Plan, error) {
+	if err := c.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid plan constraints")
+	}
+
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem resolving absolute path")
+	}
+
+	plan := &Plan{Path: path}
+	seen := map[string]struct{}{}
+
+	for _, opts := range c.BuildOptions() {
+		for _, rel := range c.Releases {
+			urls, errs := feed.GetArchives([]string{rel}, opts)
+			for url := range urls {
+				if _, ok := seen[url]; ok {
+					continue
+				}
+				seen[url] = struct{}{}
+
+				item, err := newPlanItem(rel, opts, url, path)
+				if err != nil {
+					return nil, err
+				}
+				item.Checksums = feed.Checksums(url)
+
+				if isCached(item.File) {
+					plan.Cached = append(plan.Cached, item)
+				} else {
+					plan.Downloads = append(plan.Downloads, item)
+				}
+			}
+
+			for err := range errs {
+				plan.Unavailable = append(plan.Unavailable, fmt.Sprintf("%s %s: %s", rel, opts, err))
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+func newPlanItem(rel string, opts bond.BuildOptions, url, path string) (PlanItem, error) {
+	j := newDownloadJob()
+	if err := j.setURL(url); err != nil {
+		return PlanItem{}, errors.Wrapf(err, "invalid url for %s %s", rel, opts)
+	}
+	if err := j.setDirectory(path); err != nil {
+		return PlanItem{}, errors.WithStack(err)
+	}
+
+	return PlanItem{
+		Release: rel,
+		Options: opts,
+		URL:     url,
+		File:    j.getFileName(),
+		Size:    -1,
+	}, nil
+}
+
+// isCached reports whether the archive, or the directory extracted
+// from it, exists.
+func isCached(fn string) bool {
+	if _, err := os.Stat(fn); err == nil {
+		return true
+	}
+
+	_, err := os.Stat(strings.TrimSuffix(fn, filepath.Ext(fn)))
+	return err == nil
+}
+
+// Measure requests the size of each download from the server,
+// without downloading it. Archives whose size the server does not
+// report keep a size of -1.
+func (p *Plan) Measure(ctx context.Context) error {
+	client := bond.GetHTTPClient()
+	defer bond.PutHTTPClient(client)
+
+	catcher := grip.NewBasicCatcher()
+	for idx := range p.Downloads {
+		req, err := http.NewRequest(http.MethodHead, p.Downloads[idx].URL, nil)
+		if err != nil {
+			catcher.Add(errors.Wrapf(err, "problem building request for %s", p.Downloads[idx].URL))
+			continue
+		}
+
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			catcher.Add(errors.Wrapf(err, "problem requesting size of %s", p.Downloads[idx].URL))
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			catcher.Add(errors.Errorf("encountered error %d (%s) for %s", resp.StatusCode, resp.Status, p.Downloads[idx].URL))
+			continue
+		}
+
+		p.Downloads[idx].Size = resp.ContentLength
+	}
+
+	return catcher.Resolve()
+}
+
+// TotalSize returns the total size of the downloads with known sizes,
+// and the number of downloads whose size is not known.
+func (p *Plan) TotalSize() (int64, int) {
+	var (
+		total   int64
+		unknown int
+	)
+
+	for _, item := range p.Downloads {
+		if item.Size < 0 {
+			unknown++
+			continue
+		}
+		total += item.Size
+	}
+
+	return total, unknown
+}
+
+// Jobs returns a download job for each of the plan's downloads.
+func (p *Plan) Jobs() ([]amboy.Job, error) {
+	out := make([]amboy.Job, 0, len(p.Downloads))
+	for _, item := range p.Downloads {
+		j, err := NewDownloadJob(item.URL, p.Path, false)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem generating task for %s", item.URL)
+		}
+		j.Checksums = item.Checksums
+		out = append(out, j)
+	}
+
+	return out, nil
+}
+
+// Enqueue adds the plan's download jobs to the queue.
+func (p *Plan) Enqueue(ctx context.Context, q amboy.Queue) error {
+	downloads, err := p.Jobs()
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(jobs.PopulateSlice(ctx, q, downloads, 4), "problem adding jobs to queue")
+}
+
+// String summarizes the plan for review.
+func (p *Plan) String() string {
+	total, unknown := p.TotalSize()
+	out := []string{fmt.Sprintf("%d downloads, %d cached, %d unavailable in %s",
+		len(p.Downloads), len(p.Cached), len(p.Unavailable), p.Path)}
+
+	if unknown > 0 {
+		out = append(out, fmt.Sprintf("total size: %d bytes (%d unknown)", total, unknown))
+	} else {
+		out = append(out, fmt.Sprintf("total size: %d bytes", total))
+	}
+
+	items := make([]string, 0, len(p.Downloads))
+	for _, item := range p.Downloads {
+		items = append(items, fmt.Sprintf("  %s (%s)", item.URL, item.Release))
+	}
+	sort.Strings(items)
+
+	return strings.Join(append(out, items...), "\n")
+}
@@ -0,0 +1,145 @@
+package recall
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond"
+)
+
+const planTestFeed = `{"versions": [
+  {"version": "4.0.1", "downloads": [
+    {"target": "ubuntu1804", "arch": "x86_64", "edition": "enterprise", "archive": {"url": "%[1]s/enterprise-4.0.1.tgz"}},
+    {"target": "ubuntu1804", "arch": "x86_64", "edition": "targeted", "archive": {"url": "%[1]s/targeted-4.0.1.tgz"}}
+  ]},
+  {"version": "4.0.2", "downloads": [
+    {"target": "ubuntu1804", "arch": "x86_64", "edition": "enterprise", "archive": {"url": "%[1]s/enterprise-4.0.2.tgz"}}
+  ]}
+]}`
+
+func newPlanTestFeed(t *testing.T, url string) *bond.ArtifactsFeed {
+	dir, err := ioutil.TempDir("", "bond-plan-feed")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	feed, err := bond.NewArtifactsFeed(dir)
+	require.NoError(t, err)
+	require.NoError(t, feed.Reload([]byte(fmt.Sprintf(planTestFeed, url))))
+	return feed
+}
+
+func TestPlanConstraintsValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(PlanConstraints{}.Validate())
+	assert.Error(PlanConstraints{Releases: []string{"4.0.1"}}.Validate())
+
+	c := PlanConstraints{
+		Releases: []string{"4.0.1"},
+		Editions: []bond.MongoDBEdition{bond.Enterprise, bond.CommunityTargeted},
+		Targets:  []string{"ubuntu1804", "osx"},
+		Archs:    []bond.MongoDBArch{bond.AMD64},
+	}
+	assert.NoError(c.Validate())
+	assert.Len(c.BuildOptions(), 4)
+}
+
+func TestPlanComputesMissingDownloads(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var gets int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			gets++
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(r.URL.Path)*100))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "bond-plan")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "targeted-4.0.1"), 0755))
+
+	c := PlanConstraints{
+		Releases: []string{"4.0.1", "4.0.2", "4.0.1", "9.9.9"},
+		Editions: []bond.MongoDBEdition{bond.Enterprise, bond.CommunityTargeted},
+		Targets:  []string{"ubuntu1804"},
+		Archs:    []bond.MongoDBArch{bond.AMD64},
+	}
+
+	plan, err := NewPlan(newPlanTestFeed(t, srv.URL), dir, c)
+	require.NoError(t, err)
+
+	require.Len(t, plan.Downloads, 2)
+	assert.Equal(srv.URL+"/enterprise-4.0.1.tgz", plan.Downloads[0].URL)
+	assert.Equal(filepath.Join(dir, "enterprise-4.0.1.tgz"), plan.Downloads[0].File)
+	assert.Equal(srv.URL+"/enterprise-4.0.2.tgz", plan.Downloads[1].URL)
+	require.Len(t, plan.Cached, 1)
+	assert.Equal("4.0.1", plan.Cached[0].Release)
+	// 4.0.2 has no targeted build, and 9.9.9 doesn't exist
+	// for either edition.
+	assert.Len(plan.Unavailable, 3)
+
+	total, unknown := plan.TotalSize()
+	assert.Zero(total)
+	assert.Equal(2, unknown)
+
+	require.NoError(t, plan.Measure(ctx))
+	total, unknown = plan.TotalSize()
+	assert.Equal(int64(2*len("/enterprise-4.0.1.tgz")*100), total)
+	assert.Zero(unknown)
+	assert.Zero(gets)
+	assert.True(strings.HasPrefix(plan.String(), "2 downloads, 1 cached, 3 unavailable"))
+
+	// the directory is untouched until the plan is enqueued
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(files, 1)
+
+	jobs, err := plan.Jobs()
+	require.NoError(t, err)
+	assert.Len(jobs, 2)
+
+	q := queue.NewLocalLimitedSize(1, 16)
+	require.NoError(t, q.Start(ctx))
+	require.NoError(t, plan.Enqueue(ctx, q))
+	assert.Equal(2, q.Stats(ctx).Total)
+}
+
+func TestPlanMeasureReportsErrors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "bond-plan")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	plan, err := NewPlan(newPlanTestFeed(t, srv.URL), dir, PlanConstraints{
+		Releases: []string{"4.0.2"},
+		Editions: []bond.MongoDBEdition{bond.Enterprise},
+		Targets:  []string{"ubuntu1804"},
+		Archs:    []bond.MongoDBArch{bond.AMD64},
+	})
+	require.NoError(t, err)
+	require.Len(t, plan.Downloads, 1)
+
+	assert.Error(t, plan.Measure(ctx))
+	assert.Equal(t, int64(-1), plan.Downloads[0].Size)
+}
@@ -0,0 +1,104 @@
+package recall
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/dependency"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/registry"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/jobs"
+)
+
+const processJobTypeName = "bond-recall-process-artifact"
+
+func init() {
+	registry.AddJobType(processJobTypeName, func() amboy.Job { return makeProcessArtifactJob() })
+}
+
+// ProcessArtifactJob runs the processors of a Config (see
+// bond.Processor) on a downloaded, verified archive. Downloads
+// submit a job for each archive that they download, once the
+// downloads complete, when the Config has processors.
+type ProcessArtifactJob struct {
+	Path      string `bson:"path" json:"path" yaml:"path"`
+	URL       string `bson:"url" json:"url" yaml:"url"`
+	*job.Base `bson:"metadata" json:"metadata" yaml:"metadata"`
+
+	// conf has the processors, which are not serialized: jobs
+	// that run in other processes have no processors.
+	conf *bond.Config
+}
+
+func makeProcessArtifactJob() *ProcessArtifactJob {
+	return &ProcessArtifactJob{
+		Base: &job.Base{
+			JobType: amboy.JobType{
+				Name:    processJobTypeName,
+				Version: 0,
+			},
+		},
+	}
+}
+
+// NewProcessArtifactJob constructs a job that runs the processors of
+// the Config on the archive at the path, which was downloaded from
+// the URL.
+func NewProcessArtifactJob(conf *bond.Config, path, url string) *ProcessArtifactJob {
+	j := makeProcessArtifactJob()
+	j.SetID(fmt.Sprintf("%s-process-%d",
+		strings.Replace(path, string(filepath.Separator), "-", -1),
+		job.GetNumber()))
+	j.SetDependency(dependency.NewAlways())
+	j.Path = path
+	j.URL = url
+	j.conf = conf
+	j.UpdateTimeInfo(amboy.JobTimeInfo{Created: time.Now()})
+
+	return j
+}
+
+// Run processes the archive.
+func (j *ProcessArtifactJob) Run(ctx context.Context) {
+	defer j.MarkComplete()
+
+	j.AddError(j.conf.Process(ctx, &bond.Artifact{Path: j.Path, URL: j.URL}))
+	grip.Debug(message.WrapError(j.Error(), message.Fields{
+		"message":    "processed archive",
+		"file":       j.Path,
+		"processors": len(j.conf.GetProcessors()),
+	}))
+}
+
+// processDownloads submits a job that processes each archive that
+// the download jobs of the queue downloaded since the start, and
+// waits for the jobs. Archives that were already in the cache, or
+// failed to download or verify, are not processed.
+func processDownloads(ctx context.Context, q amboy.Queue, conf *bond.Config, start time.Time) error {
+	processing := []*ProcessArtifactJob{}
+	for j := range q.Results(ctx) {
+		dj, ok := j.(*DownloadFileJob)
+		if !ok || dj.Cached || dj.Error() != nil || dj.TimeInfo().End.Before(start) {
+			continue
+		}
+
+		processing = append(processing, NewProcessArtifactJob(conf, dj.getFileName(), dj.URL))
+	}
+
+	for _, j := range processing {
+		if err := q.Put(ctx, j); err != nil {
+			return errors.Wrapf(err, "problem adding processing job for %s", j.Path)
+		}
+	}
+
+	grip.Debugf("waiting for %d processing jobs to complete", len(processing))
+	return errors.Wrap(jobs.Wait(ctx, q, jobs.Backoff{}), "problem waiting for processing jobs")
+}
@@ -0,0 +1,72 @@
+package recall
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond"
+)
+
+func TestRunDownloadsProcessesDownloadedArchives(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	base, dir := newExtractTestDirs(t)
+	defer os.RemoveAll(base)
+
+	served := filepath.Join(base, "served")
+	require.NoError(t, os.Mkdir(served, 0755))
+	writeTestTarGz(t, filepath.Join(served, "mongodb-linux-x86_64-4.0.0.tgz"), []testEntry{
+		{name: "mongodb-linux-x86_64-4.0.0/bin/mongod", kind: '0', body: "mongod"},
+	})
+	srv := httptest.NewServer(http.FileServer(http.Dir(served)))
+	defer srv.Close()
+
+	mutex := &sync.Mutex{}
+	processed := []string{}
+	conf := bond.NewConfig(bond.WithProcessors(bond.NewProcessor("record", func(_ context.Context, a *bond.Artifact) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		processed = append(processed, a.Path)
+		return errors.New("rejected")
+	})))
+
+	// the archive of 4.0.1 is already in the cache, and isn't processed again
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "mongodb-linux-x86_64-4.0.1.tgz"), []byte("cached"), 0644))
+
+	err := runDownloads(ctx, nil, QueueOptions{}, conf, dir, func(ctx context.Context, q amboy.Queue, _ *RetryBudget, _ grip.Catcher) error {
+		for _, version := range []string{"4.0.0", "4.0.1"} {
+			j, err := NewDownloadJob(srv.URL+"/mongodb-linux-x86_64-"+version+".tgz", dir, false)
+			require.NoError(t, err)
+			j.conf = conf
+			require.NoError(t, q.Put(ctx, j))
+		}
+		return nil
+	})
+
+	// the errors of the processors are the errors of the downloads
+	require.Error(t, err)
+	assert.Contains(err.Error(), "record processing of")
+	assert.Equal([]string{filepath.Join(dir, "mongodb-linux-x86_64-4.0.0.tgz")}, processed)
+}
+
+func TestProcessArtifactJobWithoutProcessors(t *testing.T) {
+	j := NewProcessArtifactJob(nil, "archive.tgz", "https://example.net/archive.tgz")
+	assert.Equal(t, processJobTypeName, j.Type().Name)
+	j.Run(context.Background())
+	assert.True(t, j.Status().Completed)
+	assert.NoError(t, j.Error())
+}
@@ -0,0 +1,351 @@
+package recall
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/pool"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/jobs"
+	"github.com/tychoish/bond/management"
+	"github.com/tychoish/bond/middleware"
+	"github.com/tychoish/bond/notify"
+)
+
+// QueueDriver names the storage of the queue that downloads run
+// through.
+type QueueDriver string
+
+const (
+	// LocalQueue keeps the download jobs in memory, for the
+	// duration of a single fetch.
+	LocalQueue QueueDriver = "local"
+	// MongoDBQueue keeps the download jobs in a MongoDB
+	// collection, so that a fetch that's interrupted resumes, on
+	// the next run with the same queue, where it stopped.
+	MongoDBQueue QueueDriver = "mongodb"
+)
+
+// DefaultQueueName is the name of a persistent download queue that
+// does not specify one.
+const DefaultQueueName = "recall-downloads"
+
+// QueueOptions configure the queue that downloads run through. The
+// zero value runs the downloads through a local queue with the
+// concurrency of the download configuration.
+type QueueOptions struct {
+	// Workers is the number of concurrent downloads; if zero, the
+	// download configuration's concurrency.
+	Workers int `bson:"workers" json:"workers" yaml:"workers"`
+	// RateLimit, if specified, is the time each worker waits after
+	// each download before starting the next.
+	RateLimit time.Duration `bson:"rate_limit" json:"rate_limit" yaml:"rate_limit"`
+	// Driver is the storage of the queue, and defaults to
+	// LocalQueue.
+	Driver QueueDriver `bson:"driver" json:"driver" yaml:"driver"`
+	// Name is the name of a persistent queue, and defaults to
+	// DefaultQueueName.
+	Name string `bson:"name" json:"name" yaml:"name"`
+	// MongoDB configures the connection of a MongoDBQueue; the
+	// URI and database default to those of
+	// queue.DefaultMongoDBOptions.
+	MongoDB queue.MongoDBOptions `bson:"-" json:"-" yaml:"-"`
+	// Retries and RetryTime, if either is specified, are the
+	// retry budget of the batch: the total number of retries of
+	// failed downloads and their total time. Without a budget,
+	// failed downloads are not retried.
+	Retries   int           `bson:"retries" json:"retries" yaml:"retries"`
+	RetryTime time.Duration `bson:"retry_time" json:"retry_time" yaml:"retry_time"`
+	// RetryBackoff is the wait before a download's first retry,
+	// and defaults to DefaultRetryBackoff.
+	RetryBackoff time.Duration `bson:"retry_backoff" json:"retry_backoff" yaml:"retry_backoff"`
+	// Extract controls the extraction of the downloaded archives,
+	// including the limit of their write throughput.
+	Extract ExtractOptions `bson:"extract" json:"extract" yaml:"extract"`
+	// Tag identifies the submitter of the downloads, and is set
+	// on their jobs. Quotas limit the pending and running jobs of
+	// each tag, so that submitters who share a queue cannot
+	// starve each other.
+	Tag    string                      `bson:"tag,omitempty" json:"tag,omitempty" yaml:"tag,omitempty"`
+	Quotas map[string]middleware.Quota `bson:"quotas,omitempty" json:"quotas,omitempty" yaml:"quotas,omitempty"`
+	// Labels are set on the jobs of the downloads, so that
+	// operators can select them with management filters.
+	Labels map[string]string `bson:"labels,omitempty" json:"labels,omitempty" yaml:"labels,omitempty"`
+	// Requires are the capabilities that the workers that run the
+	// downloads must have (e.g. os=linux), and Capabilities are
+	// those of this process's workers, in addition to their host
+	// capabilities (see middleware.HostCapabilities). Workers only
+	// dispatch the downloads that they have the capabilities for,
+	// so that the workers of a persistent queue can span hosts with
+	// different operating systems and tools.
+	Requires     middleware.Capabilities `bson:"requires,omitempty" json:"requires,omitempty" yaml:"requires,omitempty"`
+	Capabilities middleware.Capabilities `bson:"capabilities,omitempty" json:"capabilities,omitempty" yaml:"capabilities,omitempty"`
+	// ParameterEnv lists the environment variables that the
+	// expressions in the parameters of downloads may read, such as
+	// a directory of "/cache/{{ date "2006-01-02" }}", which the
+	// workers resolve when they dispatch the download (see
+	// middleware.Expander).
+	ParameterEnv []string `bson:"parameter_env,omitempty" json:"parameter_env,omitempty" yaml:"parameter_env,omitempty"`
+	// MaxPending, if specified, pauses the submission of downloads
+	// while the queue has this many pending jobs, so that large
+	// batches don't outpace a small number of workers (see
+	// jobs.Producer).
+	MaxPending int `bson:"max_pending,omitempty" json:"max_pending,omitempty" yaml:"max_pending,omitempty"`
+	// Notifier, if specified, is notified of the lifecycle of the
+	// queue's jobs, and of the releases that they find and
+	// download (see notify.Notifier's Watch).
+	Notifier *notify.Notifier `bson:"-" json:"-" yaml:"-"`
+}
+
+// ParseQueueDriver parses the name of a queue driver. A MongoDB
+// connection string (e.g. mongodb://localhost:27017) is a
+// MongoDBQueue, and sets the URI of the options.
+func (o *QueueOptions) ParseQueueDriver(val string) error {
+	switch {
+	case val == "" || val == string(LocalQueue):
+		o.Driver = LocalQueue
+	case val == string(MongoDBQueue):
+		o.Driver = MongoDBQueue
+	case strings.HasPrefix(val, "mongodb://") || strings.HasPrefix(val, "mongodb+srv://"):
+		o.Driver = MongoDBQueue
+		o.MongoDB.URI = val
+	default:
+		return errors.Errorf("'%s' is not a valid queue driver", val)
+	}
+
+	return nil
+}
+
+// Validate returns an error if the options are not valid.
+func (o QueueOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+
+	catcher.NewWhen(o.Workers < 0, "cannot specify fewer than 0 workers")
+	catcher.NewWhen(o.RateLimit < 0, "cannot specify a negative rate limit")
+	catcher.NewWhen(o.RateLimit > 0 && o.RateLimit < time.Millisecond, "cannot specify a rate limit less than a millisecond")
+	catcher.NewWhen(o.Retries < 0, "cannot specify a negative number of retries")
+	catcher.NewWhen(o.RetryTime < 0, "cannot specify a negative retry time")
+	catcher.NewWhen(o.RetryBackoff < 0, "cannot specify a negative retry backoff")
+	catcher.NewWhen(o.MaxPending < 0, "cannot specify a negative number of pending jobs")
+	catcher.Add(o.Extract.Validate())
+	catcher.Wrap(management.ValidateLabels(o.Labels), "invalid labels")
+	for tag, quota := range o.Quotas {
+		catcher.Wrapf(quota.Validate(), "invalid quota for tag '%s'", tag)
+	}
+	catcher.Wrap(o.Requires.Validate(), "invalid required capabilities")
+	catcher.Wrap(o.Capabilities.Validate(), "invalid worker capabilities")
+	if missing := o.capabilities().Missing(o.Requires); !o.persistent() && len(missing) > 0 {
+		catcher.Errorf("the workers of a local queue lack the required capabilities %s",
+			strings.Join(missing, ", "))
+	}
+
+	switch o.Driver {
+	case "", LocalQueue, MongoDBQueue:
+	default:
+		catcher.Errorf("'%s' is not a valid queue driver", o.Driver)
+	}
+
+	return catcher.Resolve()
+}
+
+// producer returns the queue through which to submit downloads, which
+// applies backpressure if the options specify MaxPending.
+func (o QueueOptions) producer(q amboy.Queue) (amboy.Queue, error) {
+	if o.MaxPending == 0 {
+		return q, nil
+	}
+
+	p, err := jobs.NewProducer(q, jobs.ProducerOptions{High: o.MaxPending})
+	return p, errors.Wrap(err, "problem configuring backpressure")
+}
+
+// capabilities returns the capabilities of the queue's workers.
+func (o QueueOptions) capabilities() middleware.Capabilities {
+	return middleware.HostCapabilities().Merge(o.Capabilities)
+}
+
+func (o QueueOptions) persistent() bool { return o.Driver == MongoDBQueue }
+
+func (o QueueOptions) workers(conf *bond.Config) int {
+	if o.Workers > 0 {
+		return o.Workers
+	}
+	return conf.GetConcurrency()
+}
+
+// retryBudget returns the retry budget of the batch, or nil if the
+// options do not specify one.
+func (o QueueOptions) retryBudget() (*RetryBudget, error) {
+	if o.Retries == 0 && o.RetryTime == 0 {
+		return nil, nil
+	}
+
+	return NewRetryBudget(o.Retries, o.RetryTime, o.RetryBackoff)
+}
+
+// newQueue builds and starts the queue, and returns a function that
+// releases its resources.
+func (o QueueOptions) newQueue(ctx context.Context, conf *bond.Config) (amboy.Queue, func(), error) {
+	q, _, closer, err := o.newQueueWithDriver(ctx, conf)
+	return q, closer, err
+}
+
+// newQueueWithDriver builds and starts the queue, and also returns the
+// driver of a persistent queue, which is nil for a local queue.
+func (o QueueOptions) newQueueWithDriver(ctx context.Context, conf *bond.Config) (amboy.Queue, queue.Driver, func(), error) {
+	if err := o.Validate(); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "invalid queue options")
+	}
+
+	size := o.workers(conf)
+	closer := func() {}
+
+	var q amboy.Queue
+	var d queue.Driver
+	if o.persistent() {
+		name := o.Name
+		if name == "" {
+			name = DefaultQueueName
+		}
+		opts := o.MongoDB
+		defaults := queue.DefaultMongoDBOptions()
+		if opts.URI == "" {
+			opts.URI = defaults.URI
+		}
+		if opts.DB == "" {
+			opts.DB = defaults.DB
+		}
+
+		driver := queue.NewMongoDriver(name, opts)
+		if err := driver.Open(ctx); err != nil {
+			return nil, nil, nil, errors.Wrapf(err, "problem connecting to %s", opts.URI)
+		}
+		closer = driver.Close
+		d = driver
+
+		rq := queue.NewRemoteUnordered(size)
+		if err := rq.SetDriver(driver); err != nil {
+			closer()
+			return nil, nil, nil, errors.Wrap(err, "problem configuring queue driver")
+		}
+		q = rq
+	} else {
+		q = queue.NewLocalLimitedSize(size, 1048)
+	}
+
+	if o.RateLimit > 0 {
+		runner, err := pool.NewSimpleRateLimitedWorkers(size, o.RateLimit, q)
+		if err != nil {
+			closer()
+			return nil, nil, nil, errors.Wrap(err, "problem configuring rate limit")
+		}
+		if err = q.SetRunner(runner); err != nil {
+			closer()
+			return nil, nil, nil, errors.Wrap(err, "problem configuring rate limit")
+		}
+	}
+
+	if len(o.Quotas) > 0 {
+		qq, err := middleware.NewQuotaQueue(q, o.Quotas)
+		if err != nil {
+			closer()
+			return nil, nil, nil, errors.Wrap(err, "problem configuring quotas")
+		}
+		q = qq
+	}
+
+	cq, err := middleware.NewCapabilityQueue(q, o.capabilities())
+	if err != nil {
+		closer()
+		return nil, nil, nil, errors.Wrap(err, "problem configuring worker capabilities")
+	}
+	q = cq
+
+	// parameters are resolved after the checks of the wrapped
+	// queues, when the download is about to run
+	pq, err := middleware.NewParamsQueue(q, middleware.NewExpander(o.ParameterEnv...))
+	if err != nil {
+		closer()
+		return nil, nil, nil, errors.Wrap(err, "problem configuring parameters")
+	}
+	q = pq
+
+	// jobs record the workers that dispatch and complete them
+	eq, err := middleware.NewEnvironmentQueue(q)
+	if err != nil {
+		closer()
+		return nil, nil, nil, errors.Wrap(err, "problem configuring queue")
+	}
+	q = eq
+
+	if o.Notifier != nil {
+		hq, err := middleware.NewHookedQueue(q)
+		if err != nil {
+			closer()
+			return nil, nil, nil, errors.Wrap(err, "problem configuring notifications")
+		}
+		o.Notifier.Watch(hq)
+		q = hq
+
+		// the workers run the hooks after the queue records their
+		// jobs as complete, so stop the workers, and send the
+		// notifications of their last jobs, before the queue's
+		// resources are released
+		release := closer
+		closer = func() {
+			cctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			hq.Runner().Close(cctx)
+			o.Notifier.Wait()
+			release()
+		}
+	}
+
+	if err := q.Start(ctx); err != nil {
+		closer()
+		return nil, nil, nil, errors.Wrap(err, "problem starting queue")
+	}
+
+	return q, d, closer, nil
+}
+
+// resumeJobID returns an ID for a download that's the same across
+// runs, so that a persistent queue recognizes the jobs of a previous
+// run.
+func resumeJobID(j *DownloadFileJob) string {
+	return fmt.Sprintf("bond-recall-download-%s", strings.Replace(j.URL, "/", "-", -1))
+}
+
+// skipQueued passes on the jobs that are not already in the queue,
+// which, for a persistent queue, are the jobs of a previous run.
+func skipQueued(ctx context.Context, q amboy.Queue, jobs <-chan amboy.Job) <-chan amboy.Job {
+	out := make(chan amboy.Job)
+
+	go func() {
+		defer close(out)
+		for j := range jobs {
+			if _, ok := q.Get(ctx, j.ID()); ok {
+				grip.Info(message.Fields{
+					"message": "download is already in the queue",
+					"job":     j.ID(),
+				})
+				continue
+			}
+
+			select {
+			case out <- j:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
@@ -0,0 +1,215 @@
+package recall
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/amboy/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/jobs"
+	"github.com/tychoish/bond/management"
+	"github.com/tychoish/bond/middleware"
+)
+
+func TestQueueOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(QueueOptions{}.Validate())
+	assert.NoError(QueueOptions{Workers: 2, RateLimit: time.Second, Driver: MongoDBQueue}.Validate())
+	assert.Error(QueueOptions{Workers: -1}.Validate())
+	assert.Error(QueueOptions{RateLimit: time.Microsecond}.Validate())
+	assert.Error(QueueOptions{Driver: "redis"}.Validate())
+	assert.Error(QueueOptions{Retries: -1}.Validate())
+	assert.Error(QueueOptions{RetryTime: -time.Second}.Validate())
+	assert.NoError(QueueOptions{Tag: "ci", Quotas: map[string]middleware.Quota{"ci": {MaxRunning: 1}}}.Validate())
+	assert.Error(QueueOptions{Quotas: map[string]middleware.Quota{"ci": {MaxPending: -1}}}.Validate())
+
+	budget, err := QueueOptions{}.retryBudget()
+	assert.NoError(err)
+	assert.Nil(budget)
+	budget, err = QueueOptions{RetryTime: time.Minute}.retryBudget()
+	assert.NoError(err)
+	assert.NotNil(budget)
+
+	assert.Equal(bond.DefaultConcurrency, QueueOptions{}.workers(nil))
+	assert.Equal(2, QueueOptions{}.workers(bond.NewConfig(bond.WithConcurrency(2))))
+	assert.Equal(8, QueueOptions{Workers: 8}.workers(bond.NewConfig(bond.WithConcurrency(2))))
+
+	opts := QueueOptions{}
+	assert.NoError(opts.ParseQueueDriver(""))
+	assert.Equal(LocalQueue, opts.Driver)
+	assert.NoError(opts.ParseQueueDriver("mongodb://db.example.net:27017"))
+	assert.Equal(MongoDBQueue, opts.Driver)
+	assert.Equal("mongodb://db.example.net:27017", opts.MongoDB.URI)
+	assert.Error(opts.ParseQueueDriver("redis://localhost"))
+}
+
+func TestQueueOptionsRateLimitedQueue(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	q, closer, err := QueueOptions{Workers: 1, RateLimit: 10 * time.Millisecond}.newQueue(ctx, nil)
+	require.NoError(t, err)
+	defer closer()
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, q.Put(ctx, job.NewShellJob("true", "")))
+	}
+	require.NoError(t, jobs.Wait(ctx, q, jobs.Backoff{}))
+	assert.Equal(t, 3, q.Stats(ctx).Completed)
+
+	_, _, err = QueueOptions{Workers: -1}.newQueue(ctx, nil)
+	assert.Error(t, err)
+}
+
+func TestQueueOptionsQuotas(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	qopts := QueueOptions{Workers: 1, Tag: "ci", Quotas: map[string]middleware.Quota{"ci": {MaxPending: 1}}}
+	q, closer, err := qopts.newQueue(ctx, nil)
+	require.NoError(t, err)
+	defer closer()
+
+	eq, ok := q.(*middleware.EnvironmentQueue)
+	require.True(t, ok)
+	pq, ok := eq.Queue.(*middleware.ParamsQueue)
+	require.True(t, ok)
+	cq, ok := pq.Queue.(*middleware.CapabilityQueue)
+	require.True(t, ok)
+	qq, ok := cq.Queue.(*middleware.QuotaQueue)
+	require.True(t, ok)
+	quota, ok := qq.Quota("ci")
+	assert.True(ok)
+	assert.Equal(1, quota.MaxPending)
+
+	urls := make(chan string, 1)
+	urls <- "https://example.net/a.tgz"
+	close(urls)
+
+	downloads, _ := createJobs(nil, nil, nil, qopts, os.TempDir(), urls)
+	j := (<-downloads).(*DownloadFileJob)
+	assert.Equal("ci", j.Tag())
+}
+
+func TestQueueOptionsLabels(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(QueueOptions{Labels: map[string]string{"": "7.0"}}.Validate())
+
+	qopts := QueueOptions{Labels: map[string]string{"series": "7.0"}}
+	require.NoError(t, qopts.Validate())
+
+	urls := make(chan string, 1)
+	urls <- "https://example.net/a.tgz"
+	close(urls)
+
+	downloads, _ := createJobs(nil, nil, nil, qopts, os.TempDir(), urls)
+	j := (<-downloads).(*DownloadFileJob)
+	assert.Equal(map[string]string{"series": "7.0"}, management.LabelsOf(j))
+
+	// labels persist with the job
+	j.SetLabel("edition", "enterprise")
+	payload, err := registry.MakeJobInterchange(j, amboy.JSON)
+	require.NoError(t, err)
+	out, err := payload.Resolve(amboy.JSON)
+	require.NoError(t, err)
+	assert.Equal(map[string]string{"series": "7.0", "edition": "enterprise"}, management.LabelsOf(out))
+}
+
+func TestQueueOptionsCapabilities(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	assert.Error(QueueOptions{Requires: middleware.Capabilities{"": "linux"}}.Validate())
+	assert.Error(QueueOptions{Capabilities: middleware.Capabilities{"a,b": "true"}}.Validate())
+	// a local queue's only workers are in this process
+	assert.Error(QueueOptions{Requires: middleware.Capabilities{"has-docker": "true"}}.Validate())
+	assert.NoError(QueueOptions{Driver: MongoDBQueue, Requires: middleware.Capabilities{"has-docker": "true"}}.Validate())
+
+	qopts := QueueOptions{
+		Workers:      1,
+		Requires:     middleware.Capabilities{"has-docker": "true"},
+		Capabilities: middleware.Capabilities{"has-docker": "true"},
+	}
+	q, closer, err := qopts.newQueue(ctx, nil)
+	require.NoError(t, err)
+	defer closer()
+
+	cq, ok := q.(*middleware.EnvironmentQueue).Queue.(*middleware.ParamsQueue).Queue.(*middleware.CapabilityQueue)
+	require.True(t, ok)
+	assert.Equal("true", cq.Capabilities()["has-docker"])
+	assert.Equal(middleware.HostCapabilities()["os"], cq.Capabilities()["os"])
+
+	urls := make(chan string, 1)
+	urls <- "https://example.net/a.tgz"
+	close(urls)
+
+	downloads, _ := createJobs(nil, nil, nil, qopts, os.TempDir(), urls)
+	j := (<-downloads).(*DownloadFileJob)
+	assert.Equal(middleware.Capabilities{"has-docker": "true"}, middleware.Required(j))
+}
+
+func TestQueueOptionsProducer(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(QueueOptions{MaxPending: -1}.Validate())
+
+	q := queue.NewLocalLimitedSize(1, 16)
+	out, err := QueueOptions{}.producer(q)
+	require.NoError(t, err)
+	assert.Equal(q, out)
+
+	out, err = QueueOptions{MaxPending: 8}.producer(q)
+	require.NoError(t, err)
+	p, ok := out.(*jobs.Producer)
+	require.True(t, ok)
+	assert.Equal(q, p.Queue)
+}
+
+func TestSkipQueued(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	one, err := NewDownloadJob("https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-4.4.1.tgz", "build", false)
+	require.NoError(t, err)
+	two, err := NewDownloadJob("https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-4.4.2.tgz", "build", false)
+	require.NoError(t, err)
+
+	again, err := NewDownloadJob(one.URL, "build", false)
+	require.NoError(t, err)
+	assert.NotEqual(one.ID(), again.ID())
+	assert.Equal(resumeJobID(one), resumeJobID(again))
+	assert.NotEqual(resumeJobID(one), resumeJobID(two))
+
+	one.SetID(resumeJobID(one))
+	two.SetID(resumeJobID(two))
+
+	q, closer, err := QueueOptions{}.newQueue(ctx, nil)
+	require.NoError(t, err)
+	defer closer()
+	queued := job.NewShellJob("true", "")
+	queued.SetID(one.ID())
+	require.NoError(t, q.Put(ctx, queued))
+
+	input := make(chan amboy.Job, 2)
+	input <- one
+	input <- two
+	close(input)
+
+	ids := []string{}
+	for j := range skipQueued(ctx, q, input) {
+		ids = append(ids, j.ID())
+	}
+	assert.Equal([]string{two.ID()}, ids)
+}
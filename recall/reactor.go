@@ -5,10 +5,12 @@ import (
 	"time"
 
 	"github.com/mongodb/amboy"
-	"github.com/mongodb/amboy/queue"
 	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
 	"github.com/pkg/errors"
 	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/jobs"
+	"github.com/tychoish/bond/middleware"
 )
 
 // DownloadReleases accesses the feed and, based on the arguments
@@ -21,48 +23,163 @@ func DownloadReleases(releases []string, path string, options bond.BuildOptions)
 }
 
 // FetchReleases has the same behavior as DownloadReleases, but takes
-// a Context to facilitate caller implemented timeouts and cancelation.
-func FetchReleases(ctx context.Context, releases []string, path string, options bond.BuildOptions) error {
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+// a Context to facilitate caller implemented timeouts and cancelation,
+// and options to configure the feed and downloads. Without options,
+// the feed is shared through the feed cache.
+func FetchReleases(ctx context.Context, releases []string, path string, options bond.BuildOptions, opts ...bond.Option) error {
+	return fetchReleases(ctx, nil, QueueOptions{}, releases, path, options, opts...)
+}
 
+// fetchReleases implements FetchReleases, and adds the completed jobs
+// to the run, if it's not nil.
+func fetchReleases(ctx context.Context, run *Run, qopts QueueOptions, releases []string, path string, options bond.BuildOptions, opts ...bond.Option) error {
 	if err := options.Validate(); err != nil {
 		return errors.Wrap(err, "invalid build options")
 	}
 
-	feed, err := bond.GetArtifactsFeed(ctx, path)
+	conf := bond.NewConfig(opts...)
+	if path == "" {
+		path = conf.CachePath
+	}
+
+	feed, err := loadFeed(ctx, path, opts...)
 	if err != nil {
 		return errors.Wrap(err, "problem generating data feed")
 	}
 
-	q := queue.NewLocalLimitedSize(4, 1048)
-	if err := q.Start(ctx); err != nil {
-		return errors.Wrap(err, "problem starting queue")
+	return fetchBuilds(ctx, run, qopts, feed, conf, path, []ManifestBuild{{Releases: releases, Options: options}})
+}
+
+// loadFeed returns the feed in the path, which is shared through the
+// feed cache unless there are options.
+func loadFeed(ctx context.Context, path string, opts ...bond.Option) (*bond.ArtifactsFeed, error) {
+	if len(opts) == 0 {
+		return bond.GetCachedArtifactsFeed(ctx, path)
 	}
 
-	urls, errGroupOne := feed.GetArchives(releases, options)
-	jobs, errGroupTwo := createJobs(path, urls)
+	return bond.GetArtifactsFeed(ctx, path, opts...)
+}
+
+// fetchBuilds downloads the builds through a single queue, and adds
+// the completed jobs to the run, if it's not nil. Releases that do
+// not resolve do not stop the download of the others.
+func fetchBuilds(ctx context.Context, run *Run, qopts QueueOptions, feed *bond.ArtifactsFeed, conf *bond.Config, path string, builds []ManifestBuild) error {
+	return runDownloads(ctx, run, qopts, conf, path, func(ctx context.Context, q amboy.Queue, budget *RetryBudget, catcher grip.Catcher) error {
+		for _, b := range builds {
+			warnEndOfLife(b.Releases)
+
+			urls, errGroupOne := feed.GetArchives(b.Releases, b.Options)
+			downloads, errGroupTwo := createJobs(feed, conf, budget, qopts, path, urls)
+			if qopts.persistent() {
+				downloads = skipQueued(ctx, q, downloads)
+			}
+
+			if err := jobs.Populate(ctx, q, downloads, qopts.workers(conf)); err != nil {
+				return errors.Wrap(err, "problem adding jobs to queue")
+			}
 
-	if err := amboy.PopulateQueue(ctx, q, jobs); err != nil {
-		return errors.Wrap(err, "problem adding jobs to queue")
+			catcher.Add(errors.Wrap(aggregateErrors(errGroupOne, errGroupTwo), "problem populating jobs"))
+		}
+
+		return nil
+	})
+}
+
+// runDownloads runs the download jobs that populate adds to a single
+// queue, waits for them, and adds the completed jobs to the run, if
+// it's not nil. Populate returns errors that stop the downloads, and
+// adds those that do not, such as releases that do not resolve, to
+// the catcher. When the Config has processors, the archives that the
+// jobs download are processed once the downloads complete.
+func runDownloads(ctx context.Context, run *Run, qopts QueueOptions, conf *bond.Config, path string, populate func(context.Context, amboy.Queue, *RetryBudget, grip.Catcher) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	budget, err := qopts.retryBudget()
+	if err != nil {
+		return errors.Wrap(err, "invalid retry budget")
 	}
 
-	if err := aggregateErrors(errGroupOne, errGroupTwo); err != nil {
-		return errors.Wrap(err, "problem populating jobs")
+	q, closer, err := qopts.newQueue(ctx, conf)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	if run != nil {
+		defer run.recordJobs(ctx, q)
+	}
+
+	submit, err := qopts.producer(q)
+	if err != nil {
+		return err
+	}
+
+	catcher := grip.NewBasicCatcher()
+	start := time.Now()
+	if err = populate(ctx, submit, budget, catcher); err != nil {
+		return err
 	}
 
 	grip.Debugf("waiting for %d download jobs to complete", q.Stats(ctx).Total)
-	amboy.WaitInterval(ctx, q, 100*time.Millisecond)
+	if err := jobs.Wait(ctx, q, jobs.Backoff{}); err != nil {
+		catcher.Add(errors.Wrap(err, "problem waiting for download jobs"))
+		return catcher.Resolve()
+	}
 	grip.Debug("all download tasks complete, processing errors now")
+	grip.InfoWhen(budget != nil, message.Fields{
+		"message": "download retry budget",
+		"stats":   budget.Stats(),
+	})
+
+	if len(conf.GetProcessors()) > 0 {
+		if err := processDownloads(ctx, q, conf, start); err != nil {
+			catcher.Add(err)
+			return catcher.Resolve()
+		}
+	}
+
+	catcher.Add(errors.Wrap(amboy.ResolveErrors(ctx, q), "problem(s) detected in download jobs"))
+	if bond.HasCatalogIndex(path) {
+		// keep the index of a shared catalog current for its
+		// read-only readers
+		catcher.Add(errors.Wrap(bond.WriteCatalogIndex(ctx, path), "problem updating catalog index"))
+	}
 
-	if err := amboy.ResolveErrors(ctx, q); err != nil {
-		return errors.Wrap(err, "problem(s) detected in download jobs")
+	return catcher.Resolve()
+}
+
+// warnEndOfLife logs a warning for each release in a series that is
+// no longer supported.
+func warnEndOfLife(releases []string) {
+	now := time.Now()
+	for _, rel := range releases {
+		l, ok := bond.GetLifecycle(rel)
+		grip.WarningWhen(ok && l.IsEOLAt(now), message.Fields{
+			"message":     "requested release is past its end of life",
+			"release":     rel,
+			"series":      l.Series,
+			"end_of_life": l.EndOfLife,
+		})
 	}
+}
+
+// checksummer returns the checksums that are published for the
+// archive at a URL.
+type checksummer interface {
+	Checksums(url string) []bond.Checksum
+}
 
-	return nil
+// warner returns the warnings of the resolution of the archive at a
+// URL, which feeds implement.
+type warner interface {
+	Warnings(url string) []string
 }
 
-func createJobs(path string, urls <-chan string) (<-chan amboy.Job, <-chan error) {
+// createJobs builds a download job for each URL, with the checksums
+// of the feed, if any, which share the retry budget, if any, and
+// extract and are tagged with the queue options. Jobs for persistent
+// queues have IDs that are the same across runs.
+func createJobs(feed checksummer, conf *bond.Config, budget *RetryBudget, qopts QueueOptions, path string, urls <-chan string) (<-chan amboy.Job, <-chan error) {
 	output := make(chan amboy.Job)
 	errOut := make(chan error)
 
@@ -75,6 +192,26 @@ func createJobs(path string, urls <-chan string) (<-chan amboy.Job, <-chan error
 					"problem generating task for %s", url))
 				continue
 			}
+			if feed != nil {
+				j.Checksums = feed.Checksums(url)
+				if w, ok := feed.(warner); ok {
+					j.Warnings = w.Warnings(url)
+				}
+			}
+			j.conf = conf
+			j.budget = budget
+			j.Extract = qopts.Extract
+			j.Submitter = qopts.Tag
+			for key, value := range qopts.Labels {
+				j.SetLabel(key, value)
+			}
+			if err = middleware.Require(j, qopts.Requires); err != nil {
+				catcher.Add(errors.Wrapf(err, "problem generating task for %s", url))
+				continue
+			}
+			if qopts.persistent() {
+				j.SetID(resumeJobID(j))
+			}
 
 			output <- j
 		}
@@ -47,7 +47,7 @@ func (s *ReactorSuite) TestJobCreator() {
 	urls <- "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-2.8.10.tgz"
 	close(urls)
 
-	jobs, errs := createJobs(s.tempDir, urls)
+	jobs, errs := createJobs(nil, nil, nil, QueueOptions{}, s.tempDir, urls)
 
 	done := make(chan struct{})
 	go func() {
@@ -64,6 +64,25 @@ func (s *ReactorSuite) TestJobCreator() {
 	s.Nil(aggregateErrors(errs))
 }
 
+type warningFeed map[string][]string
+
+func (f warningFeed) Checksums(url string) []bond.Checksum { return nil }
+func (f warningFeed) Warnings(url string) []string         { return f[url] }
+
+func (s *ReactorSuite) TestCreateJobsRecordsWarnings() {
+	url := "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-4.0.28.tgz"
+	urls := make(chan string, 1)
+	urls <- url
+	close(urls)
+
+	feed := warningFeed{url: {"using the generic linux build"}}
+	jobs, errs := createJobs(feed, nil, nil, QueueOptions{}, s.tempDir, urls)
+	for j := range jobs {
+		s.Equal([]string{"using the generic linux build"}, j.(*DownloadFileJob).Warnings)
+	}
+	s.Nil(aggregateErrors(errs))
+}
+
 func (s *ReactorSuite) TestCreateJobsErrorsWithInvalidPath() {
 	urls := make(chan string, 2)
 	urls <- "https://fastdl.mongodb.org/linux/mongodb-linux-x86_64-2.8.9.tgz"
@@ -71,7 +90,7 @@ func (s *ReactorSuite) TestCreateJobsErrorsWithInvalidPath() {
 	close(urls)
 	fn := filepath.Join(s.tempDir, "foo")
 	s.NoError(ioutil.WriteFile(fn, []byte("hello"), 0644))
-	_, errs := createJobs(fn, urls)
+	_, errs := createJobs(nil, nil, nil, QueueOptions{}, fn, urls)
 
 	s.Error(aggregateErrors(errs))
 }
@@ -0,0 +1,170 @@
+package recall
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+)
+
+// ErrRetryBudgetExhausted is returned (wrapped with the last download
+// error) by downloads that failed after their batch's retry budget
+// ran out.
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// DefaultRetryBackoff is the wait before the first retry of a
+// download, when the budget does not specify one. Each later retry
+// of the same download waits twice as long, up to maxRetryBackoff.
+const DefaultRetryBackoff = time.Second
+
+const maxRetryBackoff = 30 * time.Second
+
+// RetryBudget limits the retries of all of the downloads in a batch,
+// rather than each download's, so that when the network is degraded
+// the batch fails once its retries run out, instead of each of its
+// downloads retrying on its own. Once the budget is exhausted,
+// downloads that have not started fail without being attempted.
+//
+// RetryBudgets are safe for concurrent use, and a nil RetryBudget
+// runs each download once.
+type RetryBudget struct {
+	retries int
+	time    time.Duration
+	backoff time.Duration
+
+	mutex     sync.Mutex
+	stats     RetryBudgetStats
+	exhausted error
+}
+
+// RetryBudgetStats reports the use of a retry budget.
+type RetryBudgetStats struct {
+	// Retries is the number of retries of the batch's downloads,
+	// and Time is the total time they took, including the waits
+	// before them.
+	Retries   int           `bson:"retries" json:"retries" yaml:"retries"`
+	Time      time.Duration `bson:"time" json:"time" yaml:"time"`
+	Exhausted bool          `bson:"exhausted" json:"exhausted" yaml:"exhausted"`
+}
+
+// NewRetryBudget constructs a budget of the total number of retries
+// and the total time that retries may take. Zero values do not limit
+// the budget, but a budget must limit one of them. The backoff is the
+// wait before a download's first retry, and defaults to
+// DefaultRetryBackoff.
+func NewRetryBudget(retries int, total, backoff time.Duration) (*RetryBudget, error) {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(retries < 0, "cannot specify a negative number of retries")
+	catcher.NewWhen(total < 0, "cannot specify a negative retry time")
+	catcher.NewWhen(backoff < 0, "cannot specify a negative retry backoff")
+	catcher.NewWhen(retries == 0 && total == 0, "must limit the number of retries or their time")
+	if catcher.HasErrors() {
+		return nil, catcher.Resolve()
+	}
+
+	if backoff == 0 {
+		backoff = DefaultRetryBackoff
+	}
+
+	return &RetryBudget{retries: retries, time: total, backoff: backoff}, nil
+}
+
+// Stats returns the use of the budget.
+func (b *RetryBudget) Stats() RetryBudgetStats {
+	if b == nil {
+		return RetryBudgetStats{}
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.stats
+}
+
+// Do runs the operation, and retries it, with backoff, while it
+// fails and the budget allows. Checksum mismatches, downloads that
+// the disk does not have room for, and cancellation are not retried.
+func (b *RetryBudget) Do(ctx context.Context, op func(context.Context) error) error {
+	if b == nil {
+		return op(ctx)
+	}
+
+	if err := b.check(); err != nil {
+		return err
+	}
+
+	err := op(ctx)
+	wait := b.backoff
+	for err != nil && retryable(ctx, err) {
+		if berr := b.acquire(err); berr != nil {
+			return berr
+		}
+
+		start := time.Now()
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			b.spend(time.Since(start))
+			return err
+		case <-timer.C:
+		}
+
+		err = op(ctx)
+		b.spend(time.Since(start))
+
+		if wait *= 2; wait > maxRetryBackoff {
+			wait = maxRetryBackoff
+		}
+	}
+
+	return err
+}
+
+func retryable(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && !bond.Is(err, bond.ErrChecksumMismatch) && !bond.Is(err, bond.ErrInsufficientSpace)
+}
+
+// check returns an error if the budget is exhausted.
+func (b *RetryBudget) check() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.exhausted
+}
+
+// acquire takes a retry from the budget for the attempt that failed
+// with the error, or marks the budget exhausted and returns an error.
+func (b *RetryBudget) acquire(err error) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.exhausted != nil {
+		return errors.Wrap(b.exhausted, err.Error())
+	}
+
+	if (b.retries > 0 && b.stats.Retries >= b.retries) || (b.time > 0 && b.stats.Time >= b.time) {
+		b.stats.Exhausted = true
+		b.exhausted = errors.Wrapf(ErrRetryBudgetExhausted, "%d retries in %s", b.stats.Retries, b.stats.Time)
+		grip.Warning(message.WrapError(err, message.Fields{
+			"message": "download retry budget is exhausted, failing the remaining downloads",
+			"retries": b.stats.Retries,
+			"time":    b.stats.Time.String(),
+		}))
+		return errors.Wrap(b.exhausted, err.Error())
+	}
+
+	b.stats.Retries++
+	return nil
+}
+
+func (b *RetryBudget) spend(d time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.stats.Time += d
+}
@@ -0,0 +1,126 @@
+package recall
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond"
+)
+
+func TestRetryBudget(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	for _, args := range [][]int{{0, 0, 0}, {-1, 0, 0}, {1, -1, 0}, {1, 0, -1}} {
+		_, err := NewRetryBudget(args[0], time.Duration(args[1]), time.Duration(args[2]))
+		assert.Error(err, "%v", args)
+	}
+
+	var nilBudget *RetryBudget
+	calls := 0
+	assert.Error(nilBudget.Do(ctx, func(context.Context) error { calls++; return errors.New("failed") }))
+	assert.Equal(1, calls)
+	assert.Equal(RetryBudgetStats{}, nilBudget.Stats())
+
+	budget, err := NewRetryBudget(3, 0, time.Millisecond)
+	require.NoError(t, err)
+
+	// a download that succeeds on a retry takes from the budget
+	calls = 0
+	assert.NoError(budget.Do(ctx, func(context.Context) error {
+		if calls++; calls < 2 {
+			return errors.New("reset")
+		}
+		return nil
+	}))
+	assert.Equal(2, calls)
+	assert.Equal(1, budget.Stats().Retries)
+
+	// checksum mismatches are not retried
+	calls = 0
+	err = budget.Do(ctx, func(context.Context) error { calls++; return errors.Wrap(bond.ErrChecksumMismatch, "bad") })
+	assert.True(bond.Is(err, bond.ErrChecksumMismatch))
+	assert.Equal(1, calls)
+
+	// a download that keeps failing spends the rest of the budget
+	calls = 0
+	err = budget.Do(ctx, func(context.Context) error { calls++; return errors.New("timeout") })
+	require.Error(t, err)
+	assert.True(bond.Is(err, ErrRetryBudgetExhausted))
+	assert.Contains(err.Error(), "timeout")
+	assert.Equal(3, calls)
+	stats := budget.Stats()
+	assert.Equal(3, stats.Retries)
+	assert.True(stats.Exhausted)
+	assert.True(stats.Time > 0)
+
+	// later downloads fail without being attempted
+	calls = 0
+	err = budget.Do(ctx, func(context.Context) error { calls++; return nil })
+	assert.True(bond.Is(err, ErrRetryBudgetExhausted))
+	assert.Equal(0, calls)
+}
+
+func TestRetryBudgetTime(t *testing.T) {
+	assert := assert.New(t)
+
+	budget, err := NewRetryBudget(0, 20*time.Millisecond, 5*time.Millisecond)
+	require.NoError(t, err)
+
+	err = budget.Do(context.Background(), func(context.Context) error { return errors.New("timeout") })
+	assert.True(bond.Is(err, ErrRetryBudgetExhausted))
+	stats := budget.Stats()
+	assert.True(stats.Time >= 20*time.Millisecond)
+	assert.True(stats.Retries >= 2)
+
+	// cancellation interrupts the wait before a retry
+	budget, err = NewRetryBudget(10, 0, time.Hour)
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = budget.Do(ctx, func(context.Context) error { return errors.New("timeout") })
+	assert.Error(err)
+	assert.False(bond.Is(err, ErrRetryBudgetExhausted))
+	assert.Equal(1, budget.Stats().Retries)
+}
+
+func TestDownloadJobsShareRetryBudget(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "bond-job-retry")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	budget, err := NewRetryBudget(4, 0, time.Millisecond)
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		j, err := NewDownloadJob(fmt.Sprintf("%s/mongodb-linux-x86_64-4.0.%d.tgz", srv.URL, i), dir, false)
+		require.NoError(t, err)
+		j.budget = budget
+		j.Run(context.Background())
+		assert.Error(j.Error())
+	}
+
+	// the first download spends the budget, and the others fail
+	// without a request
+	assert.EqualValues(5, atomic.LoadInt64(&requests))
+	assert.Equal(4, budget.Stats().Retries)
+}
@@ -0,0 +1,298 @@
+package recall
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/management"
+)
+
+// Version is the version of the recall binary, which is set when the
+// binary is built:
+//
+//	go build -ldflags "-X github.com/tychoish/bond/recall.Version=1.2.0" ./main
+//
+// Binaries built without a version cannot tell whether a release is
+// newer, and only update when forced. Versioned binaries also
+// report the version as the bond version of the environments that
+// jobs record (see management.Environment).
+var Version = "dev"
+
+func init() {
+	if management.BondVersion == "" && Version != "dev" {
+		management.BondVersion = Version
+	}
+}
+
+// SelfUpdateRelease is the document that a release endpoint serves
+// to describe the newest release of recall.
+type SelfUpdateRelease struct {
+	Version string            `bson:"version" json:"version" yaml:"version"`
+	Builds  []SelfUpdateBuild `bson:"builds" json:"builds" yaml:"builds"`
+}
+
+// SelfUpdateBuild is the binary of a release for a platform.
+type SelfUpdateBuild struct {
+	OS     string `bson:"os" json:"os" yaml:"os"`
+	Arch   string `bson:"arch" json:"arch" yaml:"arch"`
+	URL    string `bson:"url" json:"url" yaml:"url"`
+	SHA256 string `bson:"sha256" json:"sha256" yaml:"sha256"`
+	// Signature is the base64 encoded ed25519 signature of the
+	// build's SignedPayload, which covers the binary through its
+	// checksum.
+	Signature string `bson:"signature,omitempty" json:"signature,omitempty" yaml:"signature,omitempty"`
+}
+
+// SignedPayload returns the document that the signature of the build
+// of a release signs: "<version>|<os>|<arch>|<sha256>". Signing the
+// version and platform with the checksum prevents a signed build
+// from being served as another release or for another platform.
+func (b SelfUpdateBuild) SignedPayload(version string) []byte {
+	return []byte(strings.Join([]string{version, b.OS, b.Arch, b.SHA256}, "|"))
+}
+
+// SelfUpdateOptions configure SelfUpdate.
+type SelfUpdateOptions struct {
+	// Endpoint is the URL of the release document.
+	Endpoint string `bson:"endpoint" json:"endpoint" yaml:"endpoint"`
+	// PublicKey is the base64 encoded ed25519 key that signs
+	// releases. Releases without a valid signature are rejected.
+	PublicKey string `bson:"public_key,omitempty" json:"public_key,omitempty" yaml:"public_key,omitempty"`
+	// Insecure installs releases without verifying their
+	// signatures, when there is no public key. Releases are
+	// otherwise only installed with a public key.
+	Insecure bool `bson:"insecure" json:"insecure" yaml:"insecure"`
+	// Executable is the binary to replace, and defaults to the
+	// running binary.
+	Executable string `bson:"executable,omitempty" json:"executable,omitempty" yaml:"executable,omitempty"`
+	// Force installs the release even if it's not newer than
+	// Version.
+	Force bool `bson:"force" json:"force" yaml:"force"`
+	// CheckOnly reports whether there's a newer release without
+	// installing it.
+	CheckOnly bool `bson:"check_only" json:"check_only" yaml:"check_only"`
+}
+
+// Validate returns an error if the options are not valid.
+func (opts SelfUpdateOptions) Validate() error {
+	if opts.Endpoint == "" {
+		return errors.New("must specify a release endpoint")
+	}
+	if opts.PublicKey != "" {
+		if _, err := opts.publicKey(); err != nil {
+			return err
+		}
+	} else if !opts.Insecure && !opts.CheckOnly {
+		return errors.New("must specify a public key to verify releases, or allow insecure updates")
+	}
+
+	return nil
+}
+
+func (opts SelfUpdateOptions) publicKey() (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(opts.PublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem decoding public key")
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, errors.Errorf("public key has %d bytes, not %d", len(key), ed25519.PublicKeySize)
+	}
+
+	return ed25519.PublicKey(key), nil
+}
+
+// SelfUpdateResult reports the outcome of SelfUpdate.
+type SelfUpdateResult struct {
+	Current string `bson:"current" json:"current" yaml:"current"`
+	Latest  string `bson:"latest" json:"latest" yaml:"latest"`
+	// Available reports whether the release is newer than the
+	// current version.
+	Available  bool   `bson:"available" json:"available" yaml:"available"`
+	Updated    bool   `bson:"updated" json:"updated" yaml:"updated"`
+	Executable string `bson:"executable,omitempty" json:"executable,omitempty" yaml:"executable,omitempty"`
+}
+
+func (r *SelfUpdateResult) String() string {
+	switch {
+	case r.Updated:
+		return fmt.Sprintf("updated %s from %s to %s", r.Executable, r.Current, r.Latest)
+	case r.Available:
+		return fmt.Sprintf("recall %s is available (current version is %s)", r.Latest, r.Current)
+	default:
+		return fmt.Sprintf("recall %s is the newest release", r.Current)
+	}
+}
+
+// SelfUpdate checks the release endpoint for a newer release of
+// recall and, unless the options only check, verifies the signature
+// of the build for this platform, downloads its binary, verifies its
+// checksum, and replaces the executable with it. The new binary is written next to the
+// executable and renamed over it, so the executable is never partly
+// written.
+func SelfUpdate(ctx context.Context, opts SelfUpdateOptions, configs ...bond.Option) (*SelfUpdateResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid self-update options")
+	}
+	conf := bond.NewConfig(configs...)
+
+	release, err := fetchSelfUpdateRelease(ctx, conf, opts.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &SelfUpdateResult{Current: Version, Latest: release.Version}
+	out.Available, err = isNewerRelease(Version, release.Version)
+	if err != nil && !opts.Force {
+		return out, err
+	}
+	if opts.CheckOnly || (!out.Available && !opts.Force) {
+		return out, nil
+	}
+
+	build, ok := release.build(runtime.GOOS, runtime.GOARCH)
+	if !ok {
+		return out, errors.Errorf("release %s has no build for %s/%s", release.Version, runtime.GOOS, runtime.GOARCH)
+	}
+	if build.SHA256 == "" {
+		return out, errors.Errorf("release %s does not publish a checksum for %s/%s", release.Version, build.OS, build.Arch)
+	}
+	if opts.PublicKey != "" {
+		if err = verifySelfUpdateSignature(opts, release.Version, build); err != nil {
+			return out, err
+		}
+	}
+
+	exe := opts.Executable
+	if exe == "" {
+		if exe, err = os.Executable(); err != nil {
+			return out, errors.Wrap(err, "problem finding the executable")
+		}
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return out, errors.Wrap(err, "problem resolving the executable")
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		return out, errors.Wrapf(err, "problem reading %s", exe)
+	}
+	out.Executable = exe
+
+	// the new binary is in the directory of the executable, so
+	// that renaming it over the executable is atomic.
+	tmp := filepath.Join(filepath.Dir(exe), fmt.Sprintf(".%s.update-%d", filepath.Base(exe), os.Getpid()))
+	_ = os.Remove(tmp)
+	defer os.Remove(tmp)
+
+	if err = conf.DownloadFile(ctx, build.URL, tmp); err != nil {
+		return out, errors.Wrapf(err, "problem downloading %s", build.URL)
+	}
+	if _, err = bond.VerifyFile(tmp, []bond.Checksum{{Algorithm: bond.SHA256, Value: build.SHA256}}); err != nil {
+		return out, err
+	}
+
+	if err = os.Chmod(tmp, info.Mode().Perm()|0111); err != nil {
+		return out, errors.Wrapf(err, "problem setting the mode of %s", tmp)
+	}
+	if err = os.Rename(tmp, exe); err != nil {
+		return out, errors.Wrapf(err, "problem replacing %s", exe)
+	}
+	out.Updated = true
+
+	return out, nil
+}
+
+func fetchSelfUpdateRelease(ctx context.Context, conf *bond.Config, endpoint string) (*SelfUpdateRelease, error) {
+	client, done := conf.Client()
+	defer done()
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem building request")
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem checking %s", endpoint)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s responded with %s", endpoint, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading %s", endpoint)
+	}
+
+	release := &SelfUpdateRelease{}
+	if err = json.Unmarshal(data, release); err != nil {
+		return nil, errors.Wrapf(err, "problem parsing release from %s", endpoint)
+	}
+	if release.Version == "" {
+		return nil, errors.Errorf("release from %s has no version", endpoint)
+	}
+
+	return release, nil
+}
+
+func (r *SelfUpdateRelease) build(goos, goarch string) (SelfUpdateBuild, bool) {
+	for _, b := range r.Builds {
+		if b.OS == goos && b.Arch == goarch {
+			return b, true
+		}
+	}
+
+	return SelfUpdateBuild{}, false
+}
+
+// isNewerRelease reports whether the release is newer than the
+// current version, and returns an error if either is not a semantic
+// version.
+func isNewerRelease(current, release string) (bool, error) {
+	latest, err := semver.Parse(strings.TrimPrefix(release, "v"))
+	if err != nil {
+		return false, errors.Wrapf(err, "release version '%s' is not valid", release)
+	}
+
+	running, err := semver.Parse(strings.TrimPrefix(current, "v"))
+	if err != nil {
+		return false, errors.Errorf("cannot compare the release to version '%s', update with force", current)
+	}
+
+	return latest.GT(running), nil
+}
+
+func verifySelfUpdateSignature(opts SelfUpdateOptions, version string, build SelfUpdateBuild) error {
+	if build.Signature == "" {
+		return errors.Errorf("the build for %s/%s is not signed", build.OS, build.Arch)
+	}
+
+	key, err := opts.publicKey()
+	if err != nil {
+		return err
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(build.Signature)
+	if err != nil {
+		return errors.Wrap(err, "problem decoding signature")
+	}
+
+	if !ed25519.Verify(key, build.SignedPayload(version), sig) {
+		return errors.Errorf("the signature of the build for %s/%s is not valid", build.OS, build.Arch)
+	}
+
+	return nil
+}
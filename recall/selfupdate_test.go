@@ -0,0 +1,131 @@
+package recall
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfUpdate(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "recall-self-update")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	binary := []byte("new recall binary")
+	sum := sha256.Sum256(binary)
+	release := SelfUpdateRelease{Version: "1.3.0"}
+	release.Builds = append(release.Builds, SelfUpdateBuild{
+		OS:     runtime.GOOS,
+		Arch:   runtime.GOARCH,
+		SHA256: hex.EncodeToString(sum[:]),
+	})
+	release.Builds[0].Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, release.Builds[0].SignedPayload("1.3.0")))
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	release.Builds[0].URL = srv.URL + "/recall"
+	mux.HandleFunc("/recall", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(binary) })
+	mux.HandleFunc("/release.json", func(w http.ResponseWriter, r *http.Request) { _ = json.NewEncoder(w).Encode(release) })
+
+	exe := filepath.Join(dir, "recall")
+	require.NoError(t, ioutil.WriteFile(exe, []byte("old recall binary"), 0755))
+
+	defer func(v string) { Version = v }(Version)
+	opts := SelfUpdateOptions{
+		Endpoint:   srv.URL + "/release.json",
+		PublicKey:  base64.StdEncoding.EncodeToString(pub),
+		Executable: exe,
+	}
+
+	Version = "dev"
+	_, err = SelfUpdate(ctx, opts)
+	assert.Error(err)
+
+	Version = "1.3.0"
+	res, err := SelfUpdate(ctx, opts)
+	require.NoError(t, err)
+	assert.False(res.Available)
+	assert.False(res.Updated)
+
+	Version = "1.2.0"
+	opts.CheckOnly = true
+	res, err = SelfUpdate(ctx, opts)
+	require.NoError(t, err)
+	assert.True(res.Available)
+	assert.False(res.Updated)
+	assert.Contains(res.String(), "1.3.0 is available")
+
+	opts.CheckOnly = false
+	res, err = SelfUpdate(ctx, opts)
+	require.NoError(t, err)
+	assert.True(res.Updated)
+	data, err := ioutil.ReadFile(exe)
+	require.NoError(t, err)
+	assert.Equal(binary, data)
+
+	// a build that does not match its signature is not installed
+	require.NoError(t, ioutil.WriteFile(exe, []byte("old recall binary"), 0755))
+	signature := release.Builds[0].Signature
+	release.Builds[0].Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte("other")))
+	_, err = SelfUpdate(ctx, opts)
+	require.Error(t, err)
+	assert.Contains(err.Error(), "signature")
+
+	// nor is a signed build served as another release
+	release.Builds[0].Signature = signature
+	release.Version = "1.4.0"
+	_, err = SelfUpdate(ctx, opts)
+	require.Error(t, err)
+	assert.Contains(err.Error(), "signature")
+	release.Version = "1.3.0"
+
+	// nor is a binary that does not match its checksum
+	release.Builds[0].SHA256 = hex.EncodeToString(make([]byte, sha256.Size))
+	release.Builds[0].Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(priv, release.Builds[0].SignedPayload("1.3.0")))
+	_, err = SelfUpdate(ctx, opts)
+	require.Error(t, err)
+	data, err = ioutil.ReadFile(exe)
+	require.NoError(t, err)
+	assert.Equal("old recall binary", string(data))
+
+	contents, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(contents, 1)
+
+	// updates without a key must be insecure
+	opts.PublicKey = ""
+	_, err = SelfUpdate(ctx, opts)
+	require.Error(t, err)
+	assert.Contains(err.Error(), "public key")
+	release.Builds[0].SHA256 = hex.EncodeToString(sum[:])
+	release.Builds[0].Signature = ""
+	opts.Insecure = true
+	res, err = SelfUpdate(ctx, opts)
+	require.NoError(t, err)
+	assert.True(res.Updated)
+
+	assert.Error(SelfUpdateOptions{}.Validate())
+	assert.NoError(SelfUpdateOptions{Endpoint: srv.URL, CheckOnly: true}.Validate())
+	assert.Error(SelfUpdateOptions{Endpoint: srv.URL, PublicKey: "short"}.Validate())
+}
@@ -0,0 +1,81 @@
+package recall
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// throttleChunk is the largest write that a throttled writer makes
+// at once, so that concurrent extractions take turns.
+const throttleChunk = 64 << 10
+
+// writeThrottle limits the throughput of the writes that share it to
+// a rate in bytes per second. Writers reserve time for each write,
+// so that writers that share a throttle split its rate.
+type writeThrottle struct {
+	rate  int64
+	mutex sync.Mutex
+	next  time.Time
+}
+
+var (
+	throttleMutex sync.Mutex
+	throttles     = map[int64]*writeThrottle{}
+)
+
+// getWriteThrottle returns the process's throttle for the rate, so
+// that all of the extractions with the same rate share it.
+func getWriteThrottle(rate int64) *writeThrottle {
+	throttleMutex.Lock()
+	defer throttleMutex.Unlock()
+
+	t, ok := throttles[rate]
+	if !ok {
+		t = &writeThrottle{rate: rate}
+		throttles[rate] = t
+	}
+
+	return t
+}
+
+// wait blocks until the throttle allows a write of n bytes.
+func (t *writeThrottle) wait(n int) {
+	t.mutex.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	delay := t.next.Sub(now)
+	t.next = t.next.Add(time.Duration(int64(n) * int64(time.Second) / t.rate))
+	t.mutex.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+type throttledWriter struct {
+	w        io.Writer
+	throttle *writeThrottle
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > throttleChunk {
+			chunk = chunk[:throttleChunk]
+		}
+
+		w.throttle.wait(len(chunk))
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+
+	return written, nil
+}
@@ -0,0 +1,133 @@
+package recall
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/jobs"
+)
+
+// toolchainFeedTTL is how long the component feeds of a toolchain are
+// cached, which is the same as the server feed's.
+const toolchainFeedTTL = 4 * time.Hour
+
+// toolchainChecksums are the checksums of a toolchain's archives, by
+// the URLs that they're downloaded from.
+type toolchainChecksums map[string][]bond.Checksum
+
+func (t toolchainChecksums) Checksums(url string) []bond.Checksum { return t[url] }
+
+// FetchToolchain downloads the archives of the components of a
+// toolchain for the release and platform into the path, so that a
+// single fetch assembles a complete test environment: e.g. the current
+// 7.0 server with the newest database tools, mongosh, and crypt_shared
+// library. The versions select the components, and pin the versions
+// of those that have one (e.g. {bond.ToolsComponent: "100.9"}); with
+// no versions, the toolchain has the bond.DefaultComponents.
+//
+// FetchToolchain returns the toolchain, which records the components
+// that could not be resolved, and an error if any component could not
+// be resolved or downloaded. The components that resolve are
+// downloaded even when others do not.
+func FetchToolchain(ctx context.Context, history History, qopts QueueOptions, release string, versions map[bond.Component]string, path string, options bond.BuildOptions, opts ...bond.Option) (*bond.Toolchain, error) {
+	run := &Run{Path: path, Options: options, Started: time.Now()}
+	run.ID = run.Started.UTC().Format("20060102T150405.000000000")
+
+	tc, err := fetchToolchain(ctx, run, qopts, release, versions, path, options, opts...)
+	run.Finished = time.Now()
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	if history == nil {
+		return tc, err
+	}
+
+	if herr := history.Record(context.Background(), *run); herr != nil {
+		if err == nil {
+			return tc, errors.Wrap(herr, "problem recording run")
+		}
+		return tc, errors.Wrapf(err, "problem recording run (%s)", herr)
+	}
+
+	return tc, err
+}
+
+func fetchToolchain(ctx context.Context, run *Run, qopts QueueOptions, release string, versions map[bond.Component]string, path string, options bond.BuildOptions, opts ...bond.Option) (*bond.Toolchain, error) {
+	if err := options.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid build options")
+	}
+
+	components := bond.DefaultComponents
+	if len(versions) > 0 {
+		components = make([]bond.Component, 0, len(versions))
+		for c := range versions {
+			if err := c.Validate(); err != nil {
+				return nil, err
+			}
+		}
+		for _, c := range bond.Components {
+			if _, ok := versions[c]; ok {
+				components = append(components, c)
+			}
+		}
+	}
+
+	conf := bond.NewConfig(opts...)
+	if path == "" {
+		path = conf.CachePath
+	}
+
+	agg, err := bond.NewComponentFeedAggregator(path, components, opts...)
+	if err != nil {
+		return nil, err
+	}
+	for c, err := range agg.Populate(ctx, toolchainFeedTTL) {
+		grip.Warning(errors.Wrapf(err, "problem loading the %s feed", c))
+	}
+
+	tc := agg.ResolveVersions(release, options, versions)
+	for _, c := range components {
+		if artifact, ok := tc.Artifacts[c]; ok {
+			run.Releases = append(run.Releases, fmt.Sprintf("%s %s", c, artifact.Version))
+		}
+	}
+
+	catcher := grip.NewBasicCatcher()
+	catcher.Wrap(tc.Err(), "problem resolving toolchain")
+	if len(tc.Artifacts) == 0 {
+		return tc, catcher.Resolve()
+	}
+
+	catcher.Add(runDownloads(ctx, run, qopts, conf, path, func(ctx context.Context, q amboy.Queue, budget *RetryBudget, populateErrs grip.Catcher) error {
+		sums := toolchainChecksums{}
+		urls := make(chan string, len(tc.Artifacts))
+		for _, artifact := range tc.Artifacts {
+			url := conf.MirrorURL(artifact.URL)
+			if artifact.SHA256 != "" {
+				sums[url] = []bond.Checksum{{Algorithm: bond.SHA256, Value: artifact.SHA256}}
+			}
+			urls <- url
+		}
+		close(urls)
+
+		downloads, errGroup := createJobs(sums, conf, budget, qopts, path, urls)
+		if qopts.persistent() {
+			downloads = skipQueued(ctx, q, downloads)
+		}
+
+		if err := jobs.Populate(ctx, q, downloads, qopts.workers(conf)); err != nil {
+			return errors.Wrap(err, "problem adding jobs to queue")
+		}
+
+		populateErrs.Add(errors.Wrap(aggregateErrors(errGroup), "problem populating jobs"))
+		return nil
+	}))
+
+	return tc, catcher.Resolve()
+}
@@ -0,0 +1,332 @@
+package bond
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/blang/semver"
+	"github.com/pkg/errors"
+)
+
+// SpecifierKind is the kind of a version specifier.
+type SpecifierKind string
+
+// The kinds of version specifiers.
+const (
+	// ExactSpecifier is a version in the feed (e.g. "4.4.18").
+	ExactSpecifier SpecifierKind = "exact"
+	// StableSpecifier is the newest release of a series (e.g.
+	// "6.0-stable" or "6.0-current"), or of the feed ("latest").
+	StableSpecifier SpecifierKind = "stable"
+	// ReleaseCandidateSpecifier is the newest release candidate of
+	// a series (e.g. "7.0-rc"), or of the feed ("rc").
+	ReleaseCandidateSpecifier SpecifierKind = "rc"
+	// NightlySpecifier is the nightly build of a series (e.g.
+	// "6.0", "6.0-latest", or "v7.0-latest-nightly"), or of the
+	// newest series in the feed ("nightly").
+	NightlySpecifier SpecifierKind = "nightly"
+	// RangeSpecifier is a semantic version range (e.g. ">=5.0.0
+	// <6.0.0"), which selects every release in the range.
+	RangeSpecifier SpecifierKind = "range"
+)
+
+// VersionSpecifier describes the releases that a specifier selects.
+type VersionSpecifier struct {
+	Kind SpecifierKind `bson:"kind" json:"kind" yaml:"kind"`
+	// Series is the series of stable, release candidate, and
+	// nightly specifiers, or empty for the newest in the feed.
+	Series string `bson:"series,omitempty" json:"series,omitempty" yaml:"series,omitempty"`
+	// Version is the version of an exact specifier, or the
+	// constraint of a range.
+	Version string `bson:"version,omitempty" json:"version,omitempty" yaml:"version,omitempty"`
+}
+
+var seriesPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+
+// ParseVersionSpecifier parses a version specifier. Specifiers are
+// exact versions, "latest" (the newest release), "rc" (the newest
+// release candidate), "nightly", a series with a "-stable",
+// "-current", "-rc", "-latest", or "-latest-nightly" suffix, a bare
+// series, which selects its nightly build, or a semantic version
+// range.
+func ParseVersionSpecifier(spec string) (VersionSpecifier, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	if spec == "" {
+		return VersionSpecifier{}, errors.New("cannot resolve an empty version specifier")
+	}
+
+	if strings.ContainsAny(spec, "<>=!~^| ") {
+		constraint := completeRange(spec)
+		if _, err := semver.ParseRange(constraint); err != nil {
+			return VersionSpecifier{}, errors.Wrapf(err, "'%s' is not a valid version range", spec)
+		}
+		return VersionSpecifier{Kind: RangeSpecifier, Version: constraint}, nil
+	}
+
+	switch spec {
+	case "latest", "stable", "current":
+		return VersionSpecifier{Kind: StableSpecifier}, nil
+	case "rc":
+		return VersionSpecifier{Kind: ReleaseCandidateSpecifier}, nil
+	case "nightly", "latest-nightly":
+		return VersionSpecifier{Kind: NightlySpecifier}, nil
+	}
+
+	trimmed := strings.TrimPrefix(spec, "v")
+	parts := strings.SplitN(trimmed, "-", 2)
+	if !seriesPattern.MatchString(parts[0]) {
+		if _, err := NewMongoDBVersion(trimmed); err != nil {
+			return VersionSpecifier{}, errors.Errorf("'%s' is not a valid version specifier", spec)
+		}
+		return VersionSpecifier{Kind: ExactSpecifier, Version: trimmed}, nil
+	}
+
+	series := parts[0]
+	if len(parts) == 1 {
+		return VersionSpecifier{Kind: NightlySpecifier, Series: series}, nil
+	}
+
+	switch parts[1] {
+	case "stable", "current":
+		return VersionSpecifier{Kind: StableSpecifier, Series: series}, nil
+	case "rc", "latest-rc":
+		return VersionSpecifier{Kind: ReleaseCandidateSpecifier, Series: series}, nil
+	case "latest", "nightly", "latest-nightly":
+		return VersionSpecifier{Kind: NightlySpecifier, Series: series}, nil
+	default:
+		return VersionSpecifier{}, errors.Errorf("'%s' is not a valid version specifier", spec)
+	}
+}
+
+// completeRange adds a patch component to the series in the range
+// (e.g. ">=5.0 <6.0" is ">=5.0.0 <6.0.0"), which semantic version
+// ranges require.
+func completeRange(spec string) string {
+	terms := strings.Fields(spec)
+	for idx, term := range terms {
+		start := strings.IndexAny(term, "0123456789")
+		if start < 0 {
+			continue
+		}
+		if seriesPattern.MatchString(term[start:]) {
+			terms[idx] = term + ".0"
+		}
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// Resolution is a build that a version specifier resolved to.
+type Resolution struct {
+	Specifier string `bson:"specifier" json:"specifier" yaml:"specifier"`
+	// Version is the release of the build. The nightly build of a
+	// series is named after the series' first release, which is
+	// its Version.
+	Version  *ArtifactVersion `bson:"version" json:"version" yaml:"version"`
+	Download ArtifactDownload `bson:"download" json:"download" yaml:"download"`
+	// URL is the URL of the build's archive, or of its debug
+	// symbols, rewritten for the feed's mirror.
+	URL     string `bson:"url" json:"url" yaml:"url"`
+	Nightly bool   `bson:"nightly,omitempty" json:"nightly,omitempty" yaml:"nightly,omitempty"`
+	// Warning describes a substitution of the requested build,
+	// such as a fallback to a generic Linux build.
+	Warning string `bson:"warning,omitempty" json:"warning,omitempty" yaml:"warning,omitempty"`
+}
+
+// Resolve returns the builds, for the options, of the releases that
+// the version specifier selects (see ParseVersionSpecifier), in
+// ascending order. Ranges select the releases in the range that have
+// the build, and other specifiers a single release. Resolve returns
+// an error wrapping ErrVersionNotFound if no release matches the
+// specifier.
+func (feed *ArtifactsFeed) Resolve(spec string, options BuildOptions) ([]Resolution, error) {
+	parsed, err := ParseVersionSpecifier(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if parsed.Kind == NightlySpecifier {
+		return feed.resolveNightly(spec, parsed.Series, options)
+	}
+
+	versions, err := feed.resolveVersions(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []Resolution{}
+	var missing error
+	for _, version := range versions {
+		dl, warning, err := feed.getDownload(version, options)
+		if err != nil {
+			missing = err
+			continue
+		}
+
+		url := dl.Archive.URL
+		if options.Debug {
+			url = dl.Archive.Debug
+		}
+		url = feed.conf.MirrorURL(url)
+		feed.recordWarning(url, warning)
+		out = append(out, Resolution{Specifier: spec, Version: version, Download: dl, URL: url, Warning: warning})
+	}
+
+	if len(out) == 0 {
+		return nil, errors.Wrapf(feed.explainMissingBuild(missing), "could not resolve '%s'", spec)
+	}
+
+	return out, nil
+}
+
+// resolveVersions returns the releases that the specifier selects.
+func (feed *ArtifactsFeed) resolveVersions(spec VersionSpecifier) ([]*ArtifactVersion, error) {
+	switch spec.Kind {
+	case ExactSpecifier:
+		version, ok := feed.GetVersion(spec.Version)
+		if !ok {
+			return nil, errors.Wrapf(ErrVersionNotFound, "no version defined for %s", spec.Version)
+		}
+		return []*ArtifactVersion{version}, nil
+	case RangeSpecifier:
+		return feed.Match(spec.Version)
+	case StableSpecifier:
+		if spec.Series != "" {
+			if version, err := feed.GetStableRelease(spec.Series); err == nil {
+				return []*ArtifactVersion{version}, nil
+			}
+		}
+		return feed.newest(spec, func(v *MongoDBVersion) bool { return !v.IsReleaseCandidate() })
+	case ReleaseCandidateSpecifier:
+		return feed.newest(spec, func(v *MongoDBVersion) bool { return v.IsReleaseCandidate() })
+	default:
+		return nil, errors.Errorf("cannot resolve %s specifiers", spec.Kind)
+	}
+}
+
+// newest returns the newest release, in the specifier's series if it
+// has one, that the filter accepts. Development builds are never
+// selected.
+func (feed *ArtifactsFeed) newest(spec VersionSpecifier, filter func(*MongoDBVersion) bool) ([]*ArtifactVersion, error) {
+	feed.mutex.RLock()
+	defer feed.mutex.RUnlock()
+
+	var (
+		newest  *ArtifactVersion
+		version *MongoDBVersion
+	)
+	for _, v := range feed.Versions {
+		parsed, err := NewMongoDBVersion(v.Version)
+		if err != nil || parsed.IsDevelopmentBuild() || !filter(parsed) {
+			continue
+		}
+		if spec.Series != "" && parsed.Series() != spec.Series {
+			continue
+		}
+
+		if version == nil || parsed.IsGreaterThan(version) {
+			newest, version = v, parsed
+		}
+	}
+
+	if newest == nil {
+		scope := "the feed"
+		if spec.Series != "" {
+			scope = "series " + spec.Series
+		}
+		return nil, errors.Wrapf(ErrVersionNotFound, "no %s release in %s", spec.Kind, scope)
+	}
+
+	return []*ArtifactVersion{newest}, nil
+}
+
+// resolveNightly resolves the nightly build of the series, or of the
+// newest series with a first release in the feed.
+func (feed *ArtifactsFeed) resolveNightly(spec, series string, options BuildOptions) ([]Resolution, error) {
+	if series == "" {
+		all := feed.seriesReleases()
+		if len(all) == 0 {
+			return nil, errors.Wrap(ErrVersionNotFound, "no series in the feed has a nightly build")
+		}
+		series = all[len(all)-1]
+	}
+
+	url, err := feed.GetLatestArchive(series, options)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not resolve '%s'", spec)
+	}
+
+	version, _ := feed.GetVersion(series + ".0")
+	dl, warning, err := feed.getDownload(version, options)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not resolve '%s'", spec)
+	}
+
+	return []Resolution{{Specifier: spec, Version: version, Download: dl, URL: url, Nightly: true, Warning: warning}}, nil
+}
+
+// seriesReleases returns the series that have a first release in the
+// feed, in ascending order.
+func (feed *ArtifactsFeed) seriesReleases() []string {
+	feed.mutex.RLock()
+	defer feed.mutex.RUnlock()
+
+	versions := MongoDBVersionSlice{}
+	for _, v := range feed.Versions {
+		parsed, err := NewMongoDBVersion(v.Version)
+		if err != nil || !parsed.IsRelease() || parsed.IsReleaseCandidate() {
+			continue
+		}
+		if _, ok := feed.table[parsed.Series()+".0"]; ok {
+			versions = append(versions, *parsed)
+		}
+	}
+	versions.Sort()
+
+	out := []string{}
+	for _, v := range versions {
+		if len(out) == 0 || out[len(out)-1] != v.Series() {
+			out = append(out, v.Series())
+		}
+	}
+
+	return out
+}
+
+// ResolveSpecifier returns the paths of the builds in the catalog,
+// for the options, of the releases that the version specifier selects
+// in the catalog's feed, with the feed's Resolve. Unlike Resolve,
+// which selects among the cached builds, the releases are those of
+// the feed: "7.0-stable" is not in the catalog until the newest 7.0
+// release is. Ranges select the releases in the range that are in the
+// catalog, and ResolveSpecifier returns an error wrapping
+// ErrVersionNotFound if none are.
+func (c *BuildCatalog) ResolveSpecifier(spec string, options BuildOptions) ([]string, error) {
+	resolved, err := c.feed.Resolve(spec, options)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []string{}
+	var missing error
+	for _, r := range resolved {
+		version := r.Version.Version
+		if r.Nightly {
+			version = fmt.Sprintf("%s-latest", coerceSeries(version))
+		}
+
+		path, err := c.Get(version, string(options.Edition), options.Target, string(options.Arch), options.Debug)
+		if err != nil {
+			missing = err
+			continue
+		}
+		out = append(out, path)
+	}
+
+	if len(out) == 0 {
+		return nil, errors.Wrapf(missing, "could not resolve '%s' in the catalog", spec)
+	}
+
+	return out, nil
+}
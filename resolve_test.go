@@ -0,0 +1,165 @@
+package bond
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var resolveTestOptions = BuildOptions{Target: "ubuntu2204", Arch: AMD64, Edition: Enterprise}
+
+func resolveTestArchive(version string) string {
+	return fmt.Sprintf("https://downloads.mongodb.com/linux/mongodb-linux-x86_64-enterprise-ubuntu2204-%s.tgz", version)
+}
+
+// resolveTestFeed returns a feed with builds of the versions, of
+// which the current versions are marked current. 5.0.0 has no builds.
+func resolveTestFeed() string {
+	current := map[string]bool{"7.0.2": true, "6.0.9": true, "5.0.20": true}
+	versions := []string{}
+	for _, v := range []string{"7.1.0-rc0", "7.0.3-rc1", "7.0.2", "7.0.1", "7.0.0", "6.0.10-rc0", "6.0.9", "6.0.0", "5.0.20", "5.0.0", "4.4.3-12-g1234567"} {
+		downloads := ""
+		if v != "5.0.0" {
+			downloads = fmt.Sprintf(`{"target": "ubuntu2204", "arch": "x86_64", "edition": "enterprise",
+			  "archive": {"url": %q, "debug_symbols": %q}}`, resolveTestArchive(v), strings.Replace(resolveTestArchive(v), "ubuntu2204-", "ubuntu2204-debugsymbols-", 1))
+		}
+		versions = append(versions, fmt.Sprintf(`{"version": %q, "current": %t, "downloads": [%s]}`, v, current[v], downloads))
+	}
+
+	return `{"versions": [` + strings.Join(versions, ",\n") + `]}`
+}
+
+func TestParseVersionSpecifier(t *testing.T) {
+	assert := assert.New(t)
+
+	for spec, expected := range map[string]VersionSpecifier{
+		"4.4.18":              {Kind: ExactSpecifier, Version: "4.4.18"},
+		"v7.0.2":              {Kind: ExactSpecifier, Version: "7.0.2"},
+		"7.0.3-rc1":           {Kind: ExactSpecifier, Version: "7.0.3-rc1"},
+		"latest":              {Kind: StableSpecifier},
+		"rc":                  {Kind: ReleaseCandidateSpecifier},
+		"nightly":             {Kind: NightlySpecifier},
+		"6.0-stable":          {Kind: StableSpecifier, Series: "6.0"},
+		"6.0-current":         {Kind: StableSpecifier, Series: "6.0"},
+		"7.0-rc":              {Kind: ReleaseCandidateSpecifier, Series: "7.0"},
+		"6.0":                 {Kind: NightlySpecifier, Series: "6.0"},
+		"6.0-latest":          {Kind: NightlySpecifier, Series: "6.0"},
+		"v7.0-latest-nightly": {Kind: NightlySpecifier, Series: "7.0"},
+		">=5.0 <6.0":          {Kind: RangeSpecifier, Version: ">=5.0.0 <6.0.0"},
+		"<4.4.0 || >=6.0":     {Kind: RangeSpecifier, Version: "<4.4.0 || >=6.0.0"},
+	} {
+		parsed, err := ParseVersionSpecifier(spec)
+		require.NoError(t, err, spec)
+		assert.Equal(expected, parsed, spec)
+	}
+
+	for _, spec := range []string{"", "6.0-bogus", ">=five", "six"} {
+		_, err := ParseVersionSpecifier(spec)
+		assert.Error(err, spec)
+	}
+}
+
+func TestFeedResolve(t *testing.T) {
+	assert := assert.New(t)
+
+	feed, err := NewArtifactsFeed("")
+	require.NoError(t, err)
+	defer os.RemoveAll(feed.dir)
+	require.NoError(t, feed.Reload([]byte(resolveTestFeed())))
+
+	for spec, expected := range map[string][]string{
+		"7.0.1":             {"7.0.1"},
+		"latest":            {"7.0.2"},
+		"rc":                {"7.1.0-rc0"},
+		"7.0-rc":            {"7.0.3-rc1"},
+		"6.0-stable":        {"6.0.9"},
+		"v6.0-current":      {"6.0.9"},
+		">=5.0 <6.0":        {"5.0.20"},
+		">=6.0.0 <7.0.0":    {"6.0.0", "6.0.9"},
+		"<6.0 || >=7.0.2":   {"5.0.20", "7.0.2"},
+		"v7.0-latest-build": nil,
+	} {
+		resolved, err := feed.Resolve(spec, resolveTestOptions)
+		if expected == nil {
+			assert.Error(err, spec)
+			continue
+		}
+		require.NoError(t, err, spec)
+
+		versions := []string{}
+		for _, r := range resolved {
+			versions = append(versions, r.Version.Version)
+			assert.Equal(resolveTestArchive(r.Version.Version), r.URL, spec)
+			assert.Equal(resolveTestOptions, r.Download.GetBuildOptions(), spec)
+			assert.False(r.Nightly)
+		}
+		assert.Equal(expected, versions, spec)
+	}
+
+	for _, spec := range []string{"7.0", "7.0-latest", "v7.0-latest-nightly", "nightly"} {
+		resolved, err := feed.Resolve(spec, resolveTestOptions)
+		require.NoError(t, err, spec)
+		require.Len(t, resolved, 1, spec)
+		assert.True(resolved[0].Nightly, spec)
+		assert.Equal("7.0.0", resolved[0].Version.Version, spec)
+		assert.Equal(strings.Replace(resolveTestArchive("7.0.0"), "7.0.0", "v7.0-latest", 1), resolved[0].URL, spec)
+	}
+
+	debug := resolveTestOptions
+	debug.Debug = true
+	resolved, err := feed.Resolve("6.0-stable", debug)
+	require.NoError(t, err)
+	assert.Contains(resolved[0].URL, "debugsymbols-6.0.9")
+	_, err = feed.Resolve("6.0", debug)
+	assert.Error(err)
+
+	_, err = feed.Resolve("4.4.18", resolveTestOptions)
+	assert.True(Is(err, ErrVersionNotFound))
+	_, err = feed.Resolve("5.0.0", resolveTestOptions)
+	assert.Error(err)
+	_, err = feed.Resolve("4.2-stable", resolveTestOptions)
+	assert.True(Is(err, ErrVersionNotFound))
+	_, err = feed.Resolve("latest", BuildOptions{Target: "rhel90", Arch: AMD64, Edition: Enterprise})
+	assert.Error(err)
+
+	// archives of specifiers are resolved in order
+	urls, errs := feed.GetArchives([]string{"latest", ">=6.0 <7.0", "4.4.18"}, resolveTestOptions)
+	out := []string{}
+	for url := range urls {
+		out = append(out, url)
+	}
+	assert.Equal([]string{resolveTestArchive("7.0.2"), resolveTestArchive("6.0.0"), resolveTestArchive("6.0.9")}, out)
+	assert.Error(<-errs)
+}
+
+func TestCatalogResolveSpecifier(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := newTestSharedCatalogDir(t)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "full.json"), []byte(resolveTestFeed()), 0644))
+
+	older := writeTestBuild(t, dir, "mongodb-linux-x86_64-enterprise-ubuntu2204-6.0.0")
+	newest := writeTestBuild(t, dir, "mongodb-linux-x86_64-enterprise-ubuntu2204-6.0.9")
+	catalog, err := NewCatalog(context.Background(), dir)
+	require.NoError(t, err)
+
+	paths, err := catalog.ResolveSpecifier("6.0-stable", resolveTestOptions)
+	require.NoError(t, err)
+	assert.Equal([]string{newest}, paths)
+
+	paths, err = catalog.ResolveSpecifier(">=5.0 <7.0", resolveTestOptions)
+	require.NoError(t, err)
+	assert.Equal([]string{older, newest}, paths)
+
+	// the newest release is not cached
+	_, err = catalog.ResolveSpecifier("latest", resolveTestOptions)
+	assert.True(Is(err, ErrVersionNotFound))
+}
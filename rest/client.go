@@ -0,0 +1,153 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mongodb/amboy"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/management"
+)
+
+// Client is an HTTP client for the ManagementService, and implements
+// management.Admin so that the queue administration commands can
+// manage remote queues.
+type Client struct {
+	base   string
+	client *http.Client
+	token  string
+}
+
+// NewClient constructs a client for a service at the specified base
+// URL (including any prefix that the service's routes are attached
+// under). If the http.Client is nil, the client uses
+// http.DefaultClient.
+func NewClient(base string, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Client{
+		base:   strings.TrimRight(base, "/") + "/v1/management",
+		client: client,
+	}
+}
+
+// SetToken sets the bearer token that the client presents to the
+// service.
+func (c *Client) SetToken(token string) { c.token = token }
+
+// Stats returns the stats of the remote queue's driver.
+func (c *Client) Stats(ctx context.Context) (amboy.QueueStats, error) {
+	out := amboy.QueueStats{}
+	err := c.do(ctx, http.MethodGet, "/stats", nil, &out)
+	return out, err
+}
+
+// FindJobs returns the summaries of the jobs that match the filter.
+func (c *Client) FindJobs(ctx context.Context, f management.Filter) ([]management.JobInfo, error) {
+	out := []management.JobInfo{}
+	err := c.do(ctx, http.MethodGet, "/jobs?"+encodeFilter(f).Encode(), nil, &out)
+	return out, err
+}
+
+// CountJobs returns the number of jobs that match the filter,
+// ignoring its Skip and Limit.
+func (c *Client) CountJobs(ctx context.Context, f management.Filter) (int, error) {
+	f.Skip, f.Limit = 0, 0
+	out := countResponse{}
+	err := c.do(ctx, http.MethodGet, "/count?"+encodeFilter(f).Encode(), nil, &out)
+	return out.Count, err
+}
+
+// ErrorReport returns the remote queue's error report.
+func (c *Client) ErrorReport(ctx context.Context, window string) ([]management.ErrorGroup, error) {
+	path := "/errors"
+	if window != "" {
+		path += "?" + url.Values{"window": []string{window}}.Encode()
+	}
+
+	out := []management.ErrorGroup{}
+	err := c.do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// Job returns the summary of the job with the specified ID.
+func (c *Client) Job(ctx context.Context, id string) (management.JobInfo, error) {
+	out := management.JobInfo{}
+	err := c.do(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id), nil, &out)
+	return out, err
+}
+
+// RequeueByID requeues the job with the specified ID.
+func (c *Client) RequeueByID(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, "/jobs/"+url.PathEscape(id)+"/requeue", nil, nil)
+}
+
+// Abort aborts the job with the specified ID.
+func (c *Client) Abort(ctx context.Context, id, note string) error {
+	return c.do(ctx, http.MethodPost, "/jobs/"+url.PathEscape(id)+"/abort", abortRequest{Note: note}, nil)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		doc, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err, "problem encoding request")
+		}
+		payload = bytes.NewReader(doc)
+	}
+
+	req, err := http.NewRequest(method, c.base+path, payload)
+	if err != nil {
+		return errors.Wrap(err, "problem building request")
+	}
+	req = req.WithContext(ctx)
+	c.authorize(req)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "problem with request to %s", req.URL)
+	}
+	defer resp.Body.Close()
+
+	if err = responseError(req, resp); err != nil {
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(out), "problem parsing response")
+}
+
+func (c *Client) authorize(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+}
+
+// responseError returns an error, with the service's message if it
+// has one, if the response is not successful.
+func responseError(req *http.Request, resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	e := errorResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+		return errors.Errorf("request to %s failed: %s", req.URL, resp.Status)
+	}
+
+	return errors.Errorf("request to %s failed: %s", req.URL, e.Error)
+}
@@ -0,0 +1,87 @@
+package rest
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/management"
+)
+
+func TestClientManagesRemoteQueue(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	driver := queue.NewInternalDriver()
+	require.NoError(t, driver.Open(ctx))
+	defer driver.Close()
+
+	for id, stat := range map[string]amboy.JobStatusInfo{
+		"failed":  {Completed: true, Errors: []string{"exit status 1"}, ModificationTime: time.Now()},
+		"pending": {},
+		"done":    {Completed: true},
+	} {
+		j := job.NewShellJob("true", "")
+		j.SetID(id)
+		j.SetStatus(stat)
+		j.UpdateTimeInfo(amboy.JobTimeInfo{Created: time.Now()})
+		require.NoError(t, driver.Put(ctx, j))
+	}
+
+	srv := httptest.NewServer(NewManagementService(management.New(driver)).Handler())
+	defer srv.Close()
+
+	var client management.Admin = NewClient(srv.URL+"/", nil)
+
+	stats, err := client.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(3, stats.Total)
+
+	jobs, err := client.FindJobs(ctx, management.Filter{Status: management.StatusFailed})
+	require.NoError(t, err)
+	require.Len(t, jobs, 1)
+	assert.Equal("failed", jobs[0].ID)
+
+	jobs, err = client.FindJobs(ctx, management.Filter{Limit: 2, Skip: 1, SubmittedAfter: time.Now().Add(-time.Hour)})
+	require.NoError(t, err)
+	assert.Len(jobs, 2)
+
+	_, err = client.FindJobs(ctx, management.Filter{Status: "broken"})
+	assert.Error(err)
+
+	count, err := NewClient(srv.URL, nil).CountJobs(ctx, management.Filter{Status: management.StatusCompleted, Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(2, count)
+	_, err = NewClient(srv.URL, nil).CountJobs(ctx, management.Filter{Pattern: "["})
+	assert.Error(err)
+
+	report, err := NewClient(srv.URL, nil).ErrorReport(ctx, "1h")
+	require.NoError(t, err)
+	require.Len(t, report, 1)
+	assert.Equal("exit status N", report[0].Message)
+
+	info, err := client.Job(ctx, "pending")
+	require.NoError(t, err)
+	assert.Equal("shell", info.Type.Name)
+	_, err = client.Job(ctx, "does-not-exist")
+	assert.Error(err)
+
+	require.NoError(t, client.RequeueByID(ctx, "failed"))
+	info, err = client.Job(ctx, "failed")
+	require.NoError(t, err)
+	assert.False(info.Status.Completed)
+
+	require.NoError(t, client.Abort(ctx, "pending", "operator request"))
+	info, err = client.Job(ctx, "pending")
+	require.NoError(t, err)
+	assert.True(info.Status.Completed)
+	assert.Equal([]string{"aborted: operator request"}, info.Status.Errors)
+	assert.Error(client.Abort(ctx, "does-not-exist", ""))
+}
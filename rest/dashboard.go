@@ -0,0 +1,274 @@
+package rest
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/registry"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/management"
+	"github.com/tychoish/bond/middleware"
+)
+
+// DashboardRecentJobs is the number of jobs shown on the dashboard's
+// overview page.
+const DashboardRecentJobs = 50
+
+// Dashboard is an http.Handler provider that serves a minimal HTML
+// dashboard for a queue, backed by the management API: an overview
+// page with the queue's stats, the most recent jobs and the current
+// error report, and a page for each job with its status, errors and
+// payload, with buttons to requeue or abort the job. With a source of
+// type stats, the overview also shows the durations and failure rates
+// of each job type.
+type Dashboard struct {
+	manager *management.Manager
+	runner  amboy.AbortableRunner
+	types   middleware.TypeStatsReporter
+	tmpl    *template.Template
+}
+
+// NewDashboard constructs a dashboard for the manager's driver.
+func NewDashboard(m *management.Manager) *Dashboard {
+	return &Dashboard{
+		manager: m,
+		tmpl: template.Must(template.New("dashboard").Funcs(template.FuncMap{
+			"percent": func(rate float64) float64 { return rate * 100 },
+		}).Parse(dashboardTemplates)),
+	}
+}
+
+// SetRunner attaches the queue's runner to the dashboard. When the
+// runner is set, aborting a job also interrupts it if it is running.
+func (d *Dashboard) SetRunner(r amboy.AbortableRunner) { d.runner = r }
+
+// SetTypeStats sets the source of the stats of the queue's job types,
+// such as a middleware.TypeStatsQueue, which the overview shows.
+func (d *Dashboard) SetTypeStats(r middleware.TypeStatsReporter) { d.types = r }
+
+// Handler returns an http.Handler that serves the dashboard:
+//
+//	GET  /                    overview
+//	GET  /jobs/<id>           job detail
+//	POST /jobs/<id>/requeue   requeue the job
+//	POST /jobs/<id>/abort     abort the job, and mark it failed
+func (d *Dashboard) Handler() http.Handler {
+	mux := http.NewServeMux()
+	d.AttachRoutes(mux, "")
+	return mux
+}
+
+// AttachRoutes registers the dashboard's pages on an existing mux,
+// under the specified prefix (which may be empty).
+func (d *Dashboard) AttachRoutes(mux *http.ServeMux, prefix string) {
+	prefix = strings.TrimRight(prefix, "/")
+
+	mux.HandleFunc(prefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != prefix+"/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		onlyMethod(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			d.overview(w, r, prefix)
+		})(w, r)
+	})
+	mux.HandleFunc(prefix+"/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, prefix+"/jobs/")
+
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(id, "/requeue"):
+			d.requeue(w, r, prefix, strings.TrimSuffix(id, "/requeue"))
+		case r.Method == http.MethodPost && strings.HasSuffix(id, "/abort"):
+			d.abort(w, r, prefix, strings.TrimSuffix(id, "/abort"))
+		case r.Method == http.MethodGet:
+			d.job(w, r, prefix, id)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s is not supported", r.Method))
+		}
+	})
+}
+
+type dashboardOverview struct {
+	Prefix string
+	Stats  amboy.QueueStats
+	Jobs   []management.JobInfo
+	Errors []management.ErrorGroup
+	Types  []middleware.TypeStats
+}
+
+func (d *Dashboard) overview(w http.ResponseWriter, r *http.Request, prefix string) {
+	ctx := r.Context()
+	jobs, err := d.manager.FindJobs(ctx, management.Filter{})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// jobs are ordered oldest first: show the most recent first.
+	if len(jobs) > DashboardRecentJobs {
+		jobs = jobs[len(jobs)-DashboardRecentJobs:]
+	}
+	for i, j := 0, len(jobs)-1; i < j; i, j = i+1, j-1 {
+		jobs[i], jobs[j] = jobs[j], jobs[i]
+	}
+
+	report, err := d.manager.ErrorReport(ctx, 0)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	out := dashboardOverview{
+		Prefix: prefix,
+		Stats:  d.manager.Driver().Stats(ctx),
+		Jobs:   jobs,
+		Errors: report,
+	}
+	if d.types != nil {
+		out.Types = d.types.TypeStats()
+	}
+
+	d.render(w, http.StatusOK, "overview", out)
+}
+
+type dashboardJob struct {
+	Prefix  string
+	Job     management.JobInfo
+	Payload string
+	Running bool
+}
+
+func (d *Dashboard) job(w http.ResponseWriter, r *http.Request, prefix, id string) {
+	j, err := d.manager.Driver().Get(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, errors.Wrapf(err, "problem finding job '%s'", id))
+		return
+	}
+
+	out := dashboardJob{Prefix: prefix, Job: management.NewJobInfo(j)}
+	if d.runner != nil {
+		out.Running = d.runner.IsRunning(id)
+	}
+
+	if payload, err := registry.MakeJobInterchange(j, amboy.JSON); err != nil {
+		out.Payload = err.Error()
+	} else if doc, err := json.MarshalIndent(payload, "", "  "); err != nil {
+		out.Payload = err.Error()
+	} else {
+		out.Payload = string(doc)
+	}
+
+	d.render(w, http.StatusOK, "job", out)
+}
+
+func (d *Dashboard) requeue(w http.ResponseWriter, r *http.Request, prefix, id string) {
+	if err := d.manager.RequeueByID(r.Context(), id); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.Redirect(w, r, prefix+"/jobs/"+id, http.StatusSeeOther)
+}
+
+func (d *Dashboard) abort(w http.ResponseWriter, r *http.Request, prefix, id string) {
+	ctx := r.Context()
+	if d.runner != nil && d.runner.IsRunning(id) {
+		if err := d.runner.Abort(ctx, id); err != nil {
+			writeError(w, http.StatusInternalServerError, errors.Wrapf(err, "problem aborting job '%s'", id))
+			return
+		}
+	}
+
+	if err := d.manager.Abort(ctx, id, "aborted from the dashboard"); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	http.Redirect(w, r, prefix+"/jobs/"+id, http.StatusSeeOther)
+}
+
+func (d *Dashboard) render(w http.ResponseWriter, code int, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	grip.Error(errors.Wrapf(d.tmpl.ExecuteTemplate(w, name, data), "problem rendering dashboard page '%s'", name))
+}
+
+const dashboardTemplates = `
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 0.25em 0.5em; text-align: left; }
+pre { background: #f4f4f4; padding: 1em; overflow: auto; }
+form { display: inline; }
+</style>
+</head>
+<body>
+{{end}}
+
+{{define "footer"}}</body>
+</html>
+{{end}}
+
+{{define "overview"}}{{template "header" "queue dashboard"}}
+<h1>Queue</h1>
+<table>
+<tr><th>total</th><th>pending</th><th>running</th><th>completed</th><th>blocked</th></tr>
+<tr><td>{{.Stats.Total}}</td><td>{{.Stats.Pending}}</td><td>{{.Stats.Running}}</td><td>{{.Stats.Completed}}</td><td>{{.Stats.Blocked}}</td></tr>
+</table>
+
+{{if .Types}}<h2>Job Types</h2>
+<table>
+<tr><th>type</th><th>executions</th><th>failures</th><th>mean</th><th>recent</th><th>recent failure rate</th><th>recent mean</th><th>recent p95</th><th>slowdown</th><th>last completed</th></tr>
+{{range .Types}}<tr><td>{{.Type}}</td><td>{{.Executions}}</td><td>{{.Failures}}</td><td>{{.MeanDuration}}</td><td>{{.Recent}}</td><td>{{printf "%.1f%%" (percent .RecentFailureRate)}}</td><td>{{.RecentMeanDuration}}</td><td>{{.RecentP95Duration}}</td><td>{{printf "%.1fx" .Slowdown}}</td><td>{{.LastCompleted}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Failures</h2>
+{{if .Errors}}<table>
+<tr><th>type</th><th>error</th><th>count</th><th>examples</th></tr>
+{{range .Errors}}{{$prefix := $.Prefix}}<tr><td>{{.JobType}}</td><td>{{.Message}}</td><td>{{.Count}}</td><td>{{range .Examples}}<a href="{{$prefix}}/jobs/{{.}}">{{.}}</a> {{end}}</td></tr>
+{{end}}</table>{{else}}<p>no failed jobs</p>{{end}}
+
+<h2>Recent Jobs</h2>
+<table>
+<tr><th>id</th><th>type</th><th>completed</th><th>in progress</th><th>errors</th><th>modified</th></tr>
+{{range .Jobs}}<tr><td><a href="{{$.Prefix}}/jobs/{{.ID}}">{{.ID}}</a></td><td>{{.Type.Name}}</td><td>{{.Status.Completed}}</td><td>{{.Status.InProgress}}</td><td>{{.Status.ErrorCount}}</td><td>{{.Status.ModificationTime}}</td></tr>
+{{end}}</table>
+{{template "footer"}}{{end}}
+
+{{define "job"}}{{template "header" .Job.ID}}
+<p><a href="{{.Prefix}}/">&larr; queue</a></p>
+<h1>{{.Job.ID}}</h1>
+<table>
+<tr><th>type</th><td>{{.Job.Type.Name}} (version {{.Job.Type.Version}})</td></tr>
+<tr><th>completed</th><td>{{.Job.Status.Completed}}</td></tr>
+<tr><th>in progress</th><td>{{.Job.Status.InProgress}}{{if .Running}} (running){{end}}</td></tr>
+<tr><th>owner</th><td>{{.Job.Status.Owner}}</td></tr>
+<tr><th>modifications</th><td>{{.Job.Status.ModificationCount}}, last at {{.Job.Status.ModificationTime}}</td></tr>
+<tr><th>created</th><td>{{.Job.TimeInfo.Created}}</td></tr>
+<tr><th>started</th><td>{{.Job.TimeInfo.Start}}</td></tr>
+<tr><th>ended</th><td>{{.Job.TimeInfo.End}}</td></tr>
+</table>
+
+<p>
+<form method="post" action="{{.Prefix}}/jobs/{{.Job.ID}}/requeue"><button type="submit">requeue</button></form>
+<form method="post" action="{{.Prefix}}/jobs/{{.Job.ID}}/abort"><button type="submit">abort</button></form>
+</p>
+
+<h2>Errors</h2>
+{{if .Job.Status.Errors}}<pre>{{range .Job.Status.Errors}}{{.}}
+{{end}}</pre>{{else}}<p>none</p>{{end}}
+
+<h2>Payload</h2>
+<pre>{{.Payload}}</pre>
+{{template "footer"}}{{end}}
+`
@@ -0,0 +1,133 @@
+package rest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/management"
+	"github.com/tychoish/bond/middleware"
+)
+
+func TestDashboardPagesAndActions(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	driver := queue.NewInternalDriver()
+	require.NoError(t, driver.Open(ctx))
+	defer driver.Close()
+
+	failed := job.NewShellJob("false", "")
+	failed.SetID("failed-job")
+	failed.SetStatus(amboy.JobStatusInfo{Completed: true, Errors: []string{"exit status 1"}})
+	require.NoError(t, driver.Put(ctx, failed))
+
+	pending := job.NewShellJob("true", "")
+	pending.SetID("pending-job")
+	require.NoError(t, driver.Put(ctx, pending))
+
+	mux := http.NewServeMux()
+	NewDashboard(management.New(driver)).AttachRoutes(mux, "/dashboard/")
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	code, body := get("/dashboard/")
+	assert.Equal(http.StatusOK, code)
+	assert.Contains(body, `href="/dashboard/jobs/failed-job"`)
+	assert.Contains(body, `href="/dashboard/jobs/pending-job"`)
+	assert.Contains(body, "exit status N")
+
+	code, body = get("/dashboard/jobs/failed-job")
+	assert.Equal(http.StatusOK, code)
+	assert.Contains(body, "exit status 1")
+	assert.Contains(body, `action="/dashboard/jobs/failed-job/requeue"`)
+
+	code, _ = get("/dashboard/jobs/does-not-exist")
+	assert.Equal(http.StatusNotFound, code)
+
+	code, _ = get("/dashboard/other")
+	assert.Equal(http.StatusNotFound, code)
+
+	resp, err := http.PostForm(srv.URL+"/dashboard/jobs/failed-job/requeue", url.Values{})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal("/dashboard/jobs/failed-job", resp.Request.URL.Path)
+
+	j, err := driver.Get(ctx, "failed-job")
+	require.NoError(t, err)
+	assert.False(j.Status().Completed)
+	assert.Empty(j.Status().Errors)
+
+	resp, err = http.PostForm(srv.URL+"/dashboard/jobs/pending-job/abort", url.Values{})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	j, err = driver.Get(ctx, "pending-job")
+	require.NoError(t, err)
+	assert.True(j.Status().Completed)
+}
+
+type staticTypeStats []middleware.TypeStats
+
+func (s staticTypeStats) TypeStats() []middleware.TypeStats { return s }
+
+func TestDashboardShowsTypeStats(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	driver := queue.NewInternalDriver()
+	require.NoError(t, driver.Open(ctx))
+	defer driver.Close()
+
+	d := NewDashboard(management.New(driver))
+	srv := httptest.NewServer(d.Handler())
+	defer srv.Close()
+
+	get := func() string {
+		resp, err := http.Get(srv.URL + "/")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	assert.NotContains(get(), "Job Types")
+
+	d.SetTypeStats(staticTypeStats{{
+		Type:               "bond-recall-download-file",
+		Executions:         20,
+		Failures:           2,
+		MeanDuration:       time.Second,
+		Recent:             10,
+		RecentFailureRate:  0.2,
+		RecentMeanDuration: 10 * time.Second,
+	}})
+	body := get()
+	assert.Contains(body, "Job Types")
+	assert.Contains(body, "<td>bond-recall-download-file</td>")
+	assert.Contains(body, "20.0%")
+	assert.Contains(body, "10.0x")
+}
@@ -0,0 +1,239 @@
+package rest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/driver"
+)
+
+// HealthCheck reports an error if some component of the application
+// is not healthy. Checks should respect the context's deadline.
+type HealthCheck func(context.Context) error
+
+type namedCheck struct {
+	name  string
+	check HealthCheck
+}
+
+// HealthService collects a set of named checks and exposes them as
+// liveness and readiness endpoints, suitable for use as Kubernetes
+// probes.
+type HealthService struct {
+	// Timeout is the maximum amount of time that all checks may
+	// take to complete. Checks that have not returned by the
+	// deadline fail. Defaults to 5 seconds.
+	Timeout time.Duration
+
+	mu     sync.RWMutex
+	checks []namedCheck
+}
+
+// NewHealthService returns an empty health service. Add checks with
+// AddCheck; a service with no checks is always ready.
+func NewHealthService() *HealthService {
+	return &HealthService{Timeout: 5 * time.Second}
+}
+
+// AddCheck registers a check with the service. Names must be unique
+// and non-empty.
+func (s *HealthService) AddCheck(name string, check HealthCheck) error {
+	if name == "" {
+		return errors.New("health checks must be named")
+	}
+	if check == nil {
+		return errors.Errorf("health check '%s' is nil", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.checks {
+		if c.name == name {
+			return errors.Errorf("health check '%s' is already registered", name)
+		}
+	}
+
+	s.checks = append(s.checks, namedCheck{name: name, check: check})
+	return nil
+}
+
+// Handler returns an http.Handler that routes requests to the
+// service's endpoints:
+//
+//	GET /healthz  liveness: the process is able to serve requests
+//	GET /readyz   readiness: all registered checks pass
+func (s *HealthService) Handler() http.Handler {
+	mux := http.NewServeMux()
+	s.AttachRoutes(mux, "")
+	return mux
+}
+
+// AttachRoutes registers the service's endpoints on an existing mux,
+// under the specified prefix (which may be empty).
+func (s *HealthService) AttachRoutes(mux *http.ServeMux, prefix string) {
+	prefix = strings.TrimRight(prefix, "/")
+
+	mux.HandleFunc(prefix+"/healthz", onlyMethod(http.MethodGet, s.Live))
+	mux.HandleFunc(prefix+"/readyz", onlyMethod(http.MethodGet, s.Ready))
+}
+
+// CheckResult reports the outcome of a single health check.
+type CheckResult struct {
+	Name     string        `bson:"name" json:"name" yaml:"name"`
+	OK       bool          `bson:"ok" json:"ok" yaml:"ok"`
+	Error    string        `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+	Duration time.Duration `bson:"duration" json:"duration" yaml:"duration"`
+}
+
+// HealthReport is the response document for the health endpoints.
+type HealthReport struct {
+	OK     bool          `bson:"ok" json:"ok" yaml:"ok"`
+	Checks []CheckResult `bson:"checks,omitempty" json:"checks,omitempty" yaml:"checks,omitempty"`
+}
+
+// Check runs all registered checks concurrently and reports their
+// results in the order they were registered.
+func (s *HealthService) Check(ctx context.Context) HealthReport {
+	s.mu.RLock()
+	checks := make([]namedCheck, len(s.checks))
+	copy(checks, s.checks)
+	s.mu.RUnlock()
+
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	report := HealthReport{OK: true, Checks: make([]CheckResult, len(checks))}
+	wg := &sync.WaitGroup{}
+	for idx, c := range checks {
+		wg.Add(1)
+		go func(idx int, c namedCheck) {
+			defer wg.Done()
+			report.Checks[idx] = runCheck(ctx, c)
+		}(idx, c)
+	}
+	wg.Wait()
+
+	for _, res := range report.Checks {
+		report.OK = report.OK && res.OK
+	}
+
+	return report
+}
+
+func runCheck(ctx context.Context, c namedCheck) CheckResult {
+	start := time.Now()
+	errs := make(chan error, 1)
+	go func() { errs <- c.check(ctx) }()
+
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		err = errors.Wrap(ctx.Err(), "check did not complete")
+	}
+
+	res := CheckResult{Name: c.name, OK: err == nil, Duration: time.Since(start)}
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	return res
+}
+
+// Live is an http.HandlerFunc for liveness probes. It does not run
+// any checks: if the process can respond, it is alive.
+func (s *HealthService) Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthReport{OK: true})
+}
+
+// Ready is an http.HandlerFunc for readiness probes, which runs all
+// checks and responds with 503 if any fail.
+func (s *HealthService) Ready(w http.ResponseWriter, r *http.Request) {
+	report := s.Check(r.Context())
+	code := http.StatusOK
+	if !report.OK {
+		code = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, code, report)
+}
+
+// QueueCheck returns a check that fails if the queue or its runner
+// have not started, or if the queue's stats cannot be collected
+// before the check's deadline.
+func QueueCheck(q amboy.Queue) HealthCheck {
+	return func(ctx context.Context) error {
+		if !q.Started() {
+			return errors.Errorf("queue '%s' is not running", q.ID())
+		}
+		if r := q.Runner(); r == nil || !r.Started() {
+			return errors.Errorf("runner for queue '%s' is not running", q.ID())
+		}
+
+		return waitFor(ctx, func() { q.Stats(ctx) })
+	}
+}
+
+// DriverCheck returns a check that fails if the driver does not
+// respond to a stats request before the check's deadline, which
+// typically indicates that the driver cannot reach its backing
+// storage. For driver.Monitored drivers, the check also fails while
+// the driver is degraded.
+func DriverCheck(d queue.Driver) HealthCheck {
+	return func(ctx context.Context) error {
+		if md, ok := d.(*driver.Monitored); ok {
+			if status := md.Health(); status.State != driver.Healthy {
+				return errors.Errorf("driver '%s' is %s since %s: %s", d.ID(), status.State,
+					status.Since.Format(time.RFC3339), status.Error)
+			}
+		}
+
+		return errors.Wrapf(waitFor(ctx, func() { d.Stats(ctx) }), "driver '%s'", d.ID())
+	}
+}
+
+// DirectoryWritableCheck returns a check that fails unless a file can
+// be created in the directory (e.g. a cache directory).
+func DirectoryWritableCheck(path string) HealthCheck {
+	return func(ctx context.Context) error {
+		f, err := ioutil.TempFile(path, ".healthcheck")
+		if err != nil {
+			return errors.Wrapf(err, "directory '%s' is not writable", path)
+		}
+
+		name := f.Name()
+		if err = f.Close(); err != nil {
+			return errors.Wrapf(err, "problem closing file in '%s'", path)
+		}
+
+		return errors.Wrapf(os.Remove(name), "problem removing file in '%s'", path)
+	}
+}
+
+func waitFor(ctx context.Context, op func()) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		op()
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "operation did not complete")
+	}
+}
@@ -0,0 +1,117 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond/driver"
+)
+
+func getHealth(t *testing.T, srv *httptest.Server, path string) (int, HealthReport) {
+	resp, err := http.Get(srv.URL + path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	out := HealthReport{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&out))
+	return resp.StatusCode, out
+}
+
+func TestHealthServiceReportsReadiness(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "bond-health")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	q := queue.NewLocalLimitedSize(2, 128)
+	require.NoError(t, q.Start(ctx))
+
+	hs := NewHealthService()
+	require.NoError(t, hs.AddCheck("queue", QueueCheck(q)))
+	require.NoError(t, hs.AddCheck("driver", DriverCheck(queue.NewInternalDriver())))
+	require.NoError(t, hs.AddCheck("cache", DirectoryWritableCheck(dir)))
+	assert.Error(hs.AddCheck("cache", DirectoryWritableCheck(dir)))
+	assert.Error(hs.AddCheck("", DirectoryWritableCheck(dir)))
+
+	srv := httptest.NewServer(hs.Handler())
+	defer srv.Close()
+
+	code, report := getHealth(t, srv, "/readyz")
+	assert.Equal(http.StatusOK, code)
+	assert.True(report.OK)
+	require.Len(t, report.Checks, 3)
+	assert.Equal("queue", report.Checks[0].Name)
+
+	require.NoError(t, hs.AddCheck("missing", DirectoryWritableCheck(filepath.Join(dir, "does-not-exist"))))
+	code, report = getHealth(t, srv, "/readyz")
+	assert.Equal(http.StatusServiceUnavailable, code)
+	assert.False(report.OK)
+	require.Len(t, report.Checks, 4)
+	assert.False(report.Checks[3].OK)
+	assert.NotEmpty(report.Checks[3].Error)
+
+	code, report = getHealth(t, srv, "/healthz")
+	assert.Equal(http.StatusOK, code)
+	assert.True(report.OK)
+}
+
+func TestHealthChecksFailForStoppedQueuesAndSlowChecks(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(QueueCheck(queue.NewLocalLimitedSize(2, 128))(context.Background()))
+
+	hs := NewHealthService()
+	hs.Timeout = 10 * time.Millisecond
+	require.NoError(t, hs.AddCheck("slow", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	}))
+	require.NoError(t, hs.AddCheck("failing", func(ctx context.Context) error {
+		return errors.New("broken")
+	}))
+
+	report := hs.Check(context.Background())
+	assert.False(report.OK)
+	assert.Contains(report.Checks[0].Error, "did not complete")
+	assert.Equal("broken", report.Checks[1].Error)
+}
+
+func TestDriverCheckReportsDegradedDrivers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	failing := false
+	md, err := driver.NewMonitored(queue.NewInternalDriver(), driver.HealthOptions{
+		Interval: time.Hour,
+		Check: func(context.Context, queue.Driver) error {
+			if failing {
+				return errors.New("no reachable servers")
+			}
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	check := DriverCheck(md)
+	assert.NoError(t, check(ctx))
+
+	failing = true
+	md.CheckNow(ctx)
+	err = check(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no reachable servers")
+}
@@ -0,0 +1,242 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/management"
+)
+
+// ManagementService exposes the operations of a management.Manager
+// as HTTP handlers, for use by the Client and the queue
+// administration commands.
+type ManagementService struct {
+	manager *management.Manager
+}
+
+// NewManagementService constructs a service for the manager.
+func NewManagementService(m *management.Manager) *ManagementService {
+	return &ManagementService{manager: m}
+}
+
+// Handler returns an http.Handler that routes requests to the
+// service's endpoints:
+//
+//	GET  /v1/management/stats              the driver's stats
+//	GET  /v1/management/jobs               find jobs (filter in the query string)
+//	GET  /v1/management/count              count jobs (filter in the query string)
+//	GET  /v1/management/jobs/<id>          a summary of the job
+//	POST /v1/management/jobs/<id>/requeue  requeue the job
+//	POST /v1/management/jobs/<id>/abort    abort the job (note in the body)
+//	GET  /v1/management/errors             the error report (window in the query string)
+func (s *ManagementService) Handler() http.Handler {
+	mux := http.NewServeMux()
+	s.AttachRoutes(mux, "")
+	return mux
+}
+
+// AttachRoutes registers the service's endpoints on an existing mux,
+// under the specified prefix (which may be empty).
+func (s *ManagementService) AttachRoutes(mux *http.ServeMux, prefix string) {
+	prefix = strings.TrimRight(prefix, "/") + "/v1/management"
+
+	mux.HandleFunc(prefix+"/stats", onlyMethod(http.MethodGet, s.Stats))
+	mux.HandleFunc(prefix+"/errors", onlyMethod(http.MethodGet, s.Errors))
+	mux.HandleFunc(prefix+"/jobs", onlyMethod(http.MethodGet, s.FindJobs))
+	mux.HandleFunc(prefix+"/count", onlyMethod(http.MethodGet, s.CountJobs))
+	mux.HandleFunc(prefix+"/jobs/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, prefix+"/jobs/")
+
+		switch {
+		case r.Method == http.MethodPost && strings.HasSuffix(id, "/requeue"):
+			s.Requeue(w, r, strings.TrimSuffix(id, "/requeue"))
+		case r.Method == http.MethodPost && strings.HasSuffix(id, "/abort"):
+			s.Abort(w, r, strings.TrimSuffix(id, "/abort"))
+		case r.Method == http.MethodGet:
+			s.Job(w, r, id)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s is not supported", r.Method))
+		}
+	})
+}
+
+// Stats writes the driver's stats.
+func (s *ManagementService) Stats(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.manager.Stats(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// Errors writes the error report. The optional "window" query
+// parameter is a duration (e.g. "1h").
+func (s *ManagementService) Errors(w http.ResponseWriter, r *http.Request) {
+	var window time.Duration
+	if val := r.URL.Query().Get("window"); val != "" {
+		var err error
+		if window, err = time.ParseDuration(val); err != nil {
+			writeError(w, http.StatusBadRequest, errors.Wrapf(err, "invalid window '%s'", val))
+			return
+		}
+	}
+
+	report, err := s.manager.ErrorReport(r.Context(), window)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// FindJobs writes the summaries of the jobs that match the filter
+// described by the query string.
+func (s *ManagementService) FindJobs(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	jobs, err := s.manager.FindJobs(r.Context(), f)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+type countResponse struct {
+	Count int `bson:"count" json:"count" yaml:"count"`
+}
+
+// CountJobs writes the number of jobs that match the filter described
+// by the query string, without reading the jobs when the filter only
+// selects jobs by status and ID (see management.CountJobs).
+func (s *ManagementService) CountJobs(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	count, err := s.manager.CountJobs(r.Context(), f)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, countResponse{Count: count})
+}
+
+// Job writes the summary of the job with the specified ID.
+func (s *ManagementService) Job(w http.ResponseWriter, r *http.Request, id string) {
+	info, err := s.manager.Job(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, info)
+}
+
+// Requeue resets the job with the specified ID.
+func (s *ManagementService) Requeue(w http.ResponseWriter, r *http.Request, id string) {
+	if err := s.manager.RequeueByID(r.Context(), id); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+type abortRequest struct {
+	Note string `bson:"note" json:"note" yaml:"note"`
+}
+
+// Abort marks the job with the specified ID failed. The body of the
+// request may contain a JSON document with a note.
+func (s *ManagementService) Abort(w http.ResponseWriter, r *http.Request, id string) {
+	req := abortRequest{}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, errors.Wrap(err, "problem parsing request"))
+			return
+		}
+	}
+
+	if err := s.manager.Abort(r.Context(), id, req.Note); err != nil {
+		grip.Debug(err)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+func encodeFilter(f management.Filter) url.Values {
+	q := url.Values{}
+	if f.Type != "" {
+		q.Set("type", f.Type)
+	}
+	if f.Pattern != "" {
+		q.Set("pattern", f.Pattern)
+	}
+	if f.Status != management.StatusAny {
+		q.Set("status", string(f.Status))
+	}
+	if !f.SubmittedAfter.IsZero() {
+		q.Set("submitted_after", f.SubmittedAfter.Format(time.RFC3339Nano))
+	}
+	if len(f.Labels) > 0 {
+		q.Set("labels", management.FormatLabels(f.Labels))
+	}
+	if f.Skip > 0 {
+		q.Set("skip", strconv.Itoa(f.Skip))
+	}
+	if f.Limit > 0 {
+		q.Set("limit", strconv.Itoa(f.Limit))
+	}
+
+	return q
+}
+
+func parseFilter(q url.Values) (management.Filter, error) {
+	f := management.Filter{
+		Type:    q.Get("type"),
+		Pattern: q.Get("pattern"),
+		Status:  management.JobStatus(q.Get("status")),
+	}
+
+	var err error
+	if f.Labels, err = management.ParseLabels(q.Get("labels")); err != nil {
+		return f, err
+	}
+	if val := q.Get("submitted_after"); val != "" {
+		if f.SubmittedAfter, err = time.Parse(time.RFC3339Nano, val); err != nil {
+			return f, errors.Wrapf(err, "invalid submitted_after '%s'", val)
+		}
+	}
+	if val := q.Get("skip"); val != "" {
+		if f.Skip, err = strconv.Atoi(val); err != nil {
+			return f, errors.Wrapf(err, "invalid skip '%s'", val)
+		}
+	}
+	if val := q.Get("limit"); val != "" {
+		if f.Limit, err = strconv.Atoi(val); err != nil {
+			return f, errors.Wrapf(err, "invalid limit '%s'", val)
+		}
+	}
+
+	return f, nil
+}
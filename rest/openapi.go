@@ -0,0 +1,284 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/registry"
+	"github.com/tychoish/bond/management"
+	"github.com/tychoish/bond/middleware"
+)
+
+// openAPIRoute describes an endpoint of the services for the OpenAPI
+// document. The schemas of the request and response bodies are
+// generated from the values' types, so they're the documents that the
+// handlers read and write.
+type openAPIRoute struct {
+	method   string
+	path     string
+	summary  string
+	query    map[string]string
+	request  interface{}
+	response interface{}
+	stream   bool
+}
+
+var openAPIRoutes = []openAPIRoute{
+	{method: http.MethodGet, path: "/v1/status", summary: "queue status and stats", response: QueueStatus{}},
+	{method: http.MethodGet, path: "/v1/stats", summary: "queue stats", response: amboy.QueueStats{}},
+	{method: http.MethodGet, path: "/v1/stats/types", summary: "stats of the job types, if the queue reports them",
+		response: []middleware.TypeStats{}},
+	{method: http.MethodGet, path: "/v1/jobs", summary: "status of all jobs in the queue",
+		query: map[string]string{
+			"labels":     "only jobs with these comma-separated key=value labels",
+			"batch_size": "number of statuses that the service reads from the queue's driver at a time",
+		},
+		response: []amboy.JobStatusInfo{}},
+	{method: http.MethodPost, path: "/v1/jobs", summary: "submit a job",
+		request: registry.JobInterchange{}, response: createResponse{}},
+	{method: http.MethodGet, path: "/v1/jobs/{id}", summary: "the job document", response: registry.JobInterchange{}},
+	{method: http.MethodGet, path: "/v1/jobs/{id}/status", summary: "the job's status and timing information",
+		response: JobStatus{}},
+	{method: http.MethodGet, path: "/v1/jobs/{id}/watch", summary: "stream status updates until the job completes",
+		query:    map[string]string{"interval": "polling interval, in milliseconds"},
+		response: JobStatus{}, stream: true},
+	{method: http.MethodGet, path: "/v1/management/stats", summary: "the driver's stats", response: amboy.QueueStats{}},
+	{method: http.MethodGet, path: "/v1/management/jobs", summary: "find jobs",
+		query: map[string]string{
+			"type":            "only jobs of this type",
+			"pattern":         "only jobs whose IDs match this regular expression",
+			"status":          "only jobs with this status (pending, in-progress, completed, failed)",
+			"submitted_after": "only jobs created after this RFC 3339 time",
+			"labels":          "only jobs with these comma-separated key=value labels",
+			"skip":            "number of jobs to skip",
+			"limit":           "maximum number of jobs",
+		},
+		response: []management.JobInfo{}},
+	{method: http.MethodGet, path: "/v1/management/count", summary: "count jobs",
+		query: map[string]string{
+			"type":            "only jobs of this type",
+			"pattern":         "only jobs whose IDs match this regular expression",
+			"status":          "only jobs with this status (pending, in-progress, completed, failed)",
+			"submitted_after": "only jobs created after this RFC 3339 time",
+			"labels":          "only jobs with these comma-separated key=value labels",
+		},
+		response: countResponse{}},
+	{method: http.MethodGet, path: "/v1/management/jobs/{id}", summary: "a summary of the job",
+		response: management.JobInfo{}},
+	{method: http.MethodPost, path: "/v1/management/jobs/{id}/requeue", summary: "requeue the job",
+		response: struct{}{}},
+	{method: http.MethodPost, path: "/v1/management/jobs/{id}/abort", summary: "abort the job",
+		request: abortRequest{}, response: struct{}{}},
+	{method: http.MethodGet, path: "/v1/management/errors", summary: "the error report",
+		query:    map[string]string{"window": "only jobs that failed within this duration (e.g. 1h)"},
+		response: []management.ErrorGroup{}},
+}
+
+// OpenAPI returns an OpenAPI 3 document that describes the endpoints
+// of the QueueService and the ManagementService, for clients not
+// written in Go. The QueueService serves the document at
+// /v1/openapi.json, and the rest package's openapi.json is a copy of
+// it.
+func OpenAPI() map[string]interface{} {
+	g := &openAPISchemas{components: map[string]interface{}{}}
+	paths := map[string]map[string]interface{}{}
+
+	for _, route := range openAPIRoutes {
+		op := map[string]interface{}{
+			"summary":     route.summary,
+			"operationId": operationID(route),
+			"responses": map[string]interface{}{
+				"200":     g.body(route.response, route.stream),
+				"default": g.body(errorResponse{}, false),
+			},
+		}
+
+		params := []interface{}{}
+		if strings.Contains(route.path, "{id}") {
+			params = append(params, map[string]interface{}{
+				"name": "id", "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, name := range sortedKeys(route.query) {
+			params = append(params, map[string]interface{}{
+				"name": name, "in": "query", "description": route.query[name],
+				"schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if route.request != nil {
+			op["requestBody"] = g.body(route.request, false)
+		}
+
+		if paths[route.path] == nil {
+			paths[route.path] = map[string]interface{}{}
+		}
+		paths[route.path][strings.ToLower(route.method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "bond queue service",
+			"version": "1",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": g.components},
+	}
+}
+
+// OpenAPI is an http.HandlerFunc that writes the service's OpenAPI
+// document.
+func (s *QueueService) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, OpenAPI())
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func operationID(route openAPIRoute) string {
+	parts := []string{strings.ToLower(route.method)}
+	for _, part := range strings.Split(strings.Trim(route.path, "/"), "/") {
+		part = strings.Trim(part, "{}")
+		if part == "v1" {
+			continue
+		}
+		parts = append(parts, strings.ToUpper(part[:1])+part[1:])
+	}
+
+	return strings.Join(parts, "")
+}
+
+// openAPISchemas generates the schemas of types, and collects the
+// schemas of named structs as components.
+type openAPISchemas struct {
+	components map[string]interface{}
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	durationType  = reflect.TypeOf(time.Duration(0))
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func (g *openAPISchemas) body(value interface{}, stream bool) map[string]interface{} {
+	contentType := "application/json"
+	if stream {
+		contentType = "application/x-ndjson"
+	}
+
+	return map[string]interface{}{
+		"description": contentType,
+		"content": map[string]interface{}{
+			contentType: map[string]interface{}{"schema": g.schema(reflect.TypeOf(value))},
+		},
+	}
+}
+
+func (g *openAPISchemas) schema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == durationType:
+		return map[string]interface{}{"type": "integer", "format": "int64", "description": "nanoseconds"}
+	case t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType):
+		// documents with their own encodings (e.g. job payloads)
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+
+		name := path.Base(t.PkgPath()) + "." + t.Name()
+		if _, ok := g.components[name]; !ok {
+			// reserve the name, for recursive types
+			g.components[name] = nil
+			g.components[name] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// object returns the schema of a struct, with a property for each
+// exported field that encoding/json encodes.
+func (g *openAPISchemas) object(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	required := []string{}
+	g.fields(t, props, &required)
+
+	out := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		out["required"] = required
+	}
+
+	return out
+}
+
+func (g *openAPISchemas) fields(t reflect.Type, props map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx:]
+		}
+
+		if name == "" && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			g.fields(field.Type, props, required)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		props[name] = g.schema(field.Type)
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
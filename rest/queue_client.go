@@ -0,0 +1,173 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/registry"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/management"
+	"github.com/tychoish/bond/middleware"
+)
+
+// QueueClient is an HTTP client for the QueueService, for Go services
+// that submit jobs to a remote queue. Jobs are converted to and from
+// the service's payloads with amboy's registry, so the client submits
+// and returns jobs of the types registered in the process (e.g.
+// *recall.DownloadFileJob), rather than payloads.
+type QueueClient struct {
+	requests *Client
+}
+
+// NewQueueClient constructs a client for a service at the specified
+// base URL (including any prefix that the service's routes are
+// attached under). If the http.Client is nil, the client uses
+// http.DefaultClient.
+func NewQueueClient(base string, client *http.Client) *QueueClient {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &QueueClient{requests: &Client{
+		base:   strings.TrimRight(base, "/") + "/v1",
+		client: client,
+	}}
+}
+
+// SetToken sets the bearer token that the client presents to the
+// service.
+func (c *QueueClient) SetToken(token string) { c.requests.SetToken(token) }
+
+// Status reports whether the remote queue is running, and its stats.
+func (c *QueueClient) Status(ctx context.Context) (QueueStatus, error) {
+	out := QueueStatus{}
+	err := c.requests.do(ctx, http.MethodGet, "/status", nil, &out)
+	return out, err
+}
+
+// Stats returns the stats of the remote queue.
+func (c *QueueClient) Stats(ctx context.Context) (amboy.QueueStats, error) {
+	out := amboy.QueueStats{}
+	err := c.requests.do(ctx, http.MethodGet, "/stats", nil, &out)
+	return out, err
+}
+
+// TypeStats returns the stats of the remote queue's job types, and
+// fails if the queue does not report them.
+func (c *QueueClient) TypeStats(ctx context.Context) ([]middleware.TypeStats, error) {
+	out := []middleware.TypeStats{}
+	err := c.requests.do(ctx, http.MethodGet, "/stats/types", nil, &out)
+	return out, err
+}
+
+// JobStatuses returns the statuses of the jobs in the remote queue
+// that have all of the labels, or of every job if there are none.
+func (c *QueueClient) JobStatuses(ctx context.Context, labels map[string]string) ([]amboy.JobStatusInfo, error) {
+	path := "/jobs"
+	if len(labels) > 0 {
+		path += "?" + url.Values{"labels": []string{management.FormatLabels(labels)}}.Encode()
+	}
+
+	out := []amboy.JobStatusInfo{}
+	err := c.requests.do(ctx, http.MethodGet, path, nil, &out)
+	return out, err
+}
+
+// Submit adds the job to the remote queue and returns its ID. The
+// job's type must be registered in this process, as it must be in the
+// service's. If the queue rejects the job as a retry of the
+// submission of its idempotency key, Submit returns the ID of the job
+// of the original submission.
+func (c *QueueClient) Submit(ctx context.Context, j amboy.Job) (string, error) {
+	if _, err := registry.GetJobFactory(j.Type().Name); err != nil {
+		return "", errors.Wrapf(err, "cannot submit job '%s'", j.ID())
+	}
+
+	payload, err := registry.MakeJobInterchange(j, amboy.JSON)
+	if err != nil {
+		return "", errors.Wrapf(err, "problem converting job '%s'", j.ID())
+	}
+
+	resp := createResponse{}
+	if err = c.requests.do(ctx, http.MethodPost, "/jobs", payload, &resp); err != nil {
+		return "", errors.Wrapf(err, "problem submitting job '%s'", j.ID())
+	}
+	if !resp.Registered {
+		return "", errors.Errorf("job '%s' was not registered: %s", j.ID(), resp.Error)
+	}
+
+	return resp.ID, nil
+}
+
+// Job returns the job with the specified ID, as the registered type
+// of the job, so that callers can read its results with a type
+// assertion.
+func (c *QueueClient) Job(ctx context.Context, id string) (amboy.Job, error) {
+	payload := &registry.JobInterchange{}
+	if err := c.requests.do(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id), nil, payload); err != nil {
+		return nil, err
+	}
+
+	j, err := payload.Resolve(amboy.JSON)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem resolving job '%s'", id)
+	}
+
+	return j, nil
+}
+
+// JobStatus returns the status of the job with the specified ID.
+func (c *QueueClient) JobStatus(ctx context.Context, id string) (JobStatus, error) {
+	out := JobStatus{}
+	err := c.requests.do(ctx, http.MethodGet, "/jobs/"+url.PathEscape(id)+"/status", nil, &out)
+	return out, err
+}
+
+// Wait watches the job with the specified ID, polling at the interval
+// (or the service's default, if it's zero), and returns its status
+// once it completes. Wait returns the job's status without an error
+// when the job fails: check the status's Error.
+func (c *QueueClient) Wait(ctx context.Context, id string, interval time.Duration) (JobStatus, error) {
+	path := c.requests.base + "/jobs/" + url.PathEscape(id) + "/watch"
+	if ms := interval.Nanoseconds() / int64(time.Millisecond); ms > 0 {
+		path += "?" + url.Values{"interval": []string{strconv.FormatInt(ms, 10)}}.Encode()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return JobStatus{}, errors.Wrap(err, "problem building request")
+	}
+	req = req.WithContext(ctx)
+	c.requests.authorize(req)
+
+	resp, err := c.requests.client.Do(req)
+	if err != nil {
+		return JobStatus{}, errors.Wrapf(err, "problem with request to %s", req.URL)
+	}
+	defer resp.Body.Close()
+
+	if err = responseError(req, resp); err != nil {
+		return JobStatus{}, err
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		stat := JobStatus{}
+		if err = dec.Decode(&stat); err != nil {
+			if ctx.Err() != nil {
+				return JobStatus{}, errors.Wrap(ctx.Err(), "stopped waiting for job")
+			}
+			return JobStatus{}, errors.Wrapf(err, "problem reading status of job '%s'", id)
+		}
+
+		if stat.Completed {
+			return stat, nil
+		}
+	}
+}
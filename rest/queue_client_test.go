@@ -0,0 +1,116 @@
+package rest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/mongodb/amboy/job"
+	"github.com/tychoish/bond/middleware"
+)
+
+func (s *QueueServiceSuite) TestQueueClientSubmitsAndWaitsForJobs() {
+	client := NewQueueClient(s.server.URL, nil)
+
+	status, err := client.Status(s.ctx)
+	s.require.NoError(err)
+	s.True(status.Started)
+
+	id, err := client.Submit(s.ctx, job.NewShellJob("echo submitted", ""))
+	s.require.NoError(err)
+	s.NotEmpty(id)
+
+	stat, err := client.Wait(s.ctx, id, 10*time.Millisecond)
+	s.require.NoError(err)
+	s.True(stat.Completed)
+	s.Empty(stat.Error)
+
+	stat, err = client.JobStatus(s.ctx, id)
+	s.NoError(err)
+	s.Equal(id, stat.ID)
+
+	// jobs are returned as their registered types
+	j, err := client.Job(s.ctx, id)
+	s.require.NoError(err)
+	shell, ok := j.(*job.ShellJob)
+	s.require.True(ok)
+	s.Equal("submitted", shell.Output)
+
+	stats, err := client.Stats(s.ctx)
+	s.NoError(err)
+	s.Equal(1, stats.Completed)
+
+	statuses, err := client.JobStatuses(s.ctx, nil)
+	s.NoError(err)
+	s.Len(statuses, 1)
+
+	_, err = client.Job(s.ctx, "does-not-exist")
+	s.Error(err)
+	_, err = client.Wait(s.ctx, "does-not-exist", 0)
+	s.Error(err)
+	_, err = client.TypeStats(s.ctx)
+	s.Error(err)
+}
+
+func (s *QueueServiceSuite) TestQueueClientRequiresRegisteredTypes() {
+	client := NewQueueClient(s.server.URL, nil)
+
+	unregistered := newKeyedJob("unregistered", "")
+	unregistered.JobType.Name = "rest-unregistered-test"
+	_, err := client.Submit(s.ctx, unregistered)
+	s.Error(err)
+	s.Equal(0, s.service.Queue().Stats(s.ctx).Total)
+}
+
+func (s *QueueServiceSuite) TestQueueClientRetriesIdempotentSubmissions() {
+	q, err := middleware.NewIdempotentQueue(s.service.Queue(), time.Minute)
+	s.require.NoError(err)
+	s.service = NewQueueService(q, testServiceOptions)
+	s.server.Close()
+	s.server = httptest.NewServer(s.service.Handler())
+	client := NewQueueClient(s.server.URL, nil)
+
+	id, err := client.Submit(s.ctx, newKeyedJob("first", "submission"))
+	s.NoError(err)
+	s.Equal("first", id)
+
+	id, err = client.Submit(s.ctx, newKeyedJob("retry", "submission"))
+	s.NoError(err)
+	s.Equal("first", id)
+}
+
+func (s *QueueServiceSuite) TestOpenAPIDocument() {
+	doc := map[string]interface{}{}
+	s.Equal(http.StatusOK, s.get("/v1/openapi.json", &doc))
+	s.Equal("3.0.3", doc["openapi"])
+
+	paths := doc["paths"].(map[string]interface{})
+	for _, route := range openAPIRoutes {
+		s.Contains(paths, route.path)
+	}
+
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	status := schemas["rest.JobStatus"].(map[string]interface{})["properties"].(map[string]interface{})
+	s.Contains(status, "time_info")
+	s.Contains(schemas, "amboy.JobTimeInfo")
+}
+
+// TestOpenAPIFileIsCurrent checks that openapi.json matches the
+// document of the service. Regenerate it with
+// "BOND_UPDATE_OPENAPI=1 go test ./rest -run QueueServiceSuite/TestOpenAPIFileIsCurrent".
+func (s *QueueServiceSuite) TestOpenAPIFileIsCurrent() {
+	doc, err := json.MarshalIndent(OpenAPI(), "", "  ")
+	s.require.NoError(err)
+	doc = append(doc, '\n')
+
+	if os.Getenv("BOND_UPDATE_OPENAPI") != "" {
+		s.require.NoError(ioutil.WriteFile("openapi.json", doc, 0644))
+	}
+
+	current, err := ioutil.ReadFile("openapi.json")
+	s.require.NoError(err)
+	s.Equal(string(doc), string(current), "openapi.json is out of date")
+}
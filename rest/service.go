@@ -0,0 +1,438 @@
+/*
+Package rest provides an HTTP interface to amboy queues, so that
+clients and scripts not written in Go can submit and monitor jobs.
+
+The service uses the amboy job registry to resolve submitted job
+payloads, and only accepts the job types that its options allow, since
+any job type registered in the process (including shell jobs) could
+otherwise be submitted.
+*/
+package rest
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/amboy/registry"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/management"
+	"github.com/tychoish/bond/middleware"
+)
+
+// DefaultMaxJobSize is the size limit of submitted jobs, for services
+// that do not specify one.
+const DefaultMaxJobSize = 1 << 20
+
+// QueueServiceOptions configure a QueueService.
+type QueueServiceOptions struct {
+	// JobTypes are the types of the jobs that clients may submit.
+	// The service rejects jobs of other types, and every job, if
+	// there are none.
+	JobTypes []string `bson:"job_types" json:"job_types" yaml:"job_types"`
+	// Token, if specified, is the bearer token that requests must
+	// present.
+	Token string `bson:"-" json:"-" yaml:"-"`
+	// MaxJobSize limits the size of submitted jobs, and defaults to
+	// DefaultMaxJobSize.
+	MaxJobSize int64 `bson:"max_job_size" json:"max_job_size" yaml:"max_job_size"`
+}
+
+// QueueService wraps an amboy.Queue and exposes its operations as
+// a collection of HTTP handlers. Use Handler to produce an
+// http.Handler to mount in an application's mux.
+type QueueService struct {
+	queue   amboy.Queue
+	manager *management.Manager
+	opts    QueueServiceOptions
+	types   map[string]bool
+}
+
+// NewQueueService constructs a service for the specified queue. The
+// queue should be started by the caller. If the queue is a
+// queue.Remote, the service uses a management.Manager for the queue's
+// driver to find jobs.
+func NewQueueService(q amboy.Queue, opts QueueServiceOptions) *QueueService {
+	if opts.MaxJobSize <= 0 {
+		opts.MaxJobSize = DefaultMaxJobSize
+	}
+
+	s := &QueueService{queue: q, opts: opts, types: map[string]bool{}}
+	for _, name := range opts.JobTypes {
+		s.types[name] = true
+	}
+	if rq, ok := q.(queue.Remote); ok && rq.Driver() != nil {
+		s.manager = management.New(rq.Driver())
+	}
+
+	return s
+}
+
+// Queue provides access to the underlying queue object for the service.
+func (s *QueueService) Queue() amboy.Queue { return s.queue }
+
+// SetManager replaces the manager that the service uses to find the
+// jobs of the queue, which should manage the queue's driver. A nil
+// manager makes the service read jobs from the queue.
+func (s *QueueService) SetManager(m *management.Manager) { s.manager = m }
+
+// Handler returns an http.Handler that routes requests to the
+// service's endpoints:
+//
+//	GET  /v1/status           queue status and stats
+//	GET  /v1/stats            queue stats
+//	GET  /v1/stats/types      stats of the job types, if the queue reports them
+//	GET  /v1/jobs             status of all jobs in the queue
+//	POST /v1/jobs             submit a job of an allowed type (registry.JobInterchange)
+//	GET  /v1/jobs/<id>        the job document
+//	GET  /v1/jobs/<id>/status the job's status and timing information
+//	GET  /v1/jobs/<id>/watch  stream status updates until the job completes
+//	GET  /v1/openapi.json     the OpenAPI document of the service (see OpenAPI)
+//
+// If the service has a token, every endpoint requires it. Go services
+// can use a QueueClient rather than these endpoints.
+func (s *QueueService) Handler() http.Handler {
+	mux := http.NewServeMux()
+	s.AttachRoutes(mux, "")
+	return mux
+}
+
+// AttachRoutes registers the service's endpoints on an existing mux,
+// under the specified prefix (which may be empty).
+func (s *QueueService) AttachRoutes(mux *http.ServeMux, prefix string) {
+	prefix = strings.TrimRight(prefix, "/")
+
+	mux.HandleFunc(prefix+"/v1/status", s.authorized(onlyMethod(http.MethodGet, s.Status)))
+	mux.HandleFunc(prefix+"/v1/stats", s.authorized(onlyMethod(http.MethodGet, s.Stats)))
+	mux.HandleFunc(prefix+"/v1/stats/types", s.authorized(onlyMethod(http.MethodGet, s.TypeStats)))
+	mux.HandleFunc(prefix+"/v1/openapi.json", s.authorized(onlyMethod(http.MethodGet, s.OpenAPI)))
+	mux.HandleFunc(prefix+"/v1/jobs", s.authorized(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			s.JobStats(w, r)
+		case http.MethodPost:
+			s.Create(w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s is not supported", r.Method))
+		}
+	}))
+	mux.HandleFunc(prefix+"/v1/jobs/", s.authorized(onlyMethod(http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, prefix+"/v1/jobs/")
+		switch {
+		case strings.HasSuffix(id, "/status"):
+			s.JobStatus(w, r, strings.TrimSuffix(id, "/status"))
+			return
+		case strings.HasSuffix(id, "/watch"):
+			s.WatchJob(w, r, strings.TrimSuffix(id, "/watch"))
+			return
+		}
+
+		s.Job(w, r, id)
+	})))
+}
+
+func (s *QueueService) authorized(h http.HandlerFunc) http.HandlerFunc {
+	if s.opts.Token == "" {
+		return h
+	}
+
+	expected := []byte("Bearer " + s.opts.Token)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="bond"`)
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// QueueStatus reports whether the queue is running, and its stats.
+type QueueStatus struct {
+	Started bool             `bson:"started" json:"started" yaml:"started"`
+	QueueID string           `bson:"queue_id" json:"queue_id" yaml:"queue_id"`
+	Stats   amboy.QueueStats `bson:"stats" json:"stats" yaml:"stats"`
+}
+
+func (s *QueueService) getStatus(ctx context.Context) QueueStatus {
+	return QueueStatus{
+		Started: s.queue.Started(),
+		QueueID: s.queue.ID(),
+		Stats:   s.queue.Stats(ctx),
+	}
+}
+
+// Status is an http.HandlerFunc that reports if the queue is running
+// along with the current stats.
+func (s *QueueService) Status(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.getStatus(r.Context()))
+}
+
+// Stats is an http.HandlerFunc that writes the queue's stats.
+func (s *QueueService) Stats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.queue.Stats(r.Context()))
+}
+
+// TypeStats is an http.HandlerFunc that writes the stats of the
+// queue's job types, if the queue reports them (see
+// middleware.TypeStatsQueue), and otherwise responds with 501 Not
+// Implemented.
+func (s *QueueService) TypeStats(w http.ResponseWriter, r *http.Request) {
+	reporter, ok := s.queue.(middleware.TypeStatsReporter)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, errors.Errorf("queue %T does not report type stats", s.queue))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, reporter.TypeStats())
+}
+
+// JobStats is an http.HandlerFunc that writes the status of every
+// job in the queue as a JSON array. The labels query parameter (e.g.
+// ?labels=series=7.0) selects only the jobs with those labels, which
+// the service's manager finds, when it has one, so that drivers that
+// implement management.JobFinder filter their own jobs.
+//
+// Without labels, the service streams the statuses from its manager's
+// driver, when it has one, a batch at a time (see
+// management.StreamJobStats), so that the service holds at most a
+// batch in memory. The batch_size query parameter sets the size of the
+// batches.
+func (s *QueueService) JobStats(w http.ResponseWriter, r *http.Request) {
+	labels, err := management.ParseLabels(r.URL.Query().Get("labels"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	opts := management.StatsOptions{}
+	if val := r.URL.Query().Get("batch_size"); val != "" {
+		if opts.BatchSize, err = strconv.Atoi(val); err != nil || opts.BatchSize <= 0 {
+			writeError(w, http.StatusBadRequest, errors.Errorf("invalid batch_size '%s'", val))
+			return
+		}
+	}
+
+	if len(labels) == 0 && s.manager != nil {
+		s.streamJobStats(w, r, opts)
+		return
+	}
+
+	if len(labels) > 0 && s.manager != nil {
+		jobs, err := s.manager.FindJobs(r.Context(), management.Filter{Labels: labels})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, errors.Wrap(err, "problem finding jobs"))
+			return
+		}
+
+		out := make([]amboy.JobStatusInfo, 0, len(jobs))
+		for _, j := range jobs {
+			out = append(out, j.Status)
+		}
+
+		writeJSON(w, http.StatusOK, out)
+		return
+	}
+
+	out := []amboy.JobStatusInfo{}
+	for stat := range s.queue.JobStats(r.Context()) {
+		if len(labels) > 0 {
+			j, ok := s.queue.Get(r.Context(), stat.ID)
+			if !ok || !management.MatchLabels(j, labels) {
+				continue
+			}
+		}
+		out = append(out, stat)
+	}
+
+	writeJSON(w, http.StatusOK, out)
+}
+
+// streamJobStats writes the statuses of the manager's driver as a JSON
+// array, encoding each batch as the driver reads it. Errors after the
+// first batch was written end the response early, which clients see
+// as an invalid document.
+func (s *QueueService) streamJobStats(w http.ResponseWriter, r *http.Request, opts management.StatsOptions) {
+	written := false
+	enc := json.NewEncoder(w)
+	err := s.manager.StreamJobStats(r.Context(), opts, func(batch []amboy.JobStatusInfo) error {
+		for _, stat := range batch {
+			if !written {
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.WriteHeader(http.StatusOK)
+				if _, err := io.WriteString(w, "["); err != nil {
+					return err
+				}
+				written = true
+			} else if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+
+			if err := enc.Encode(stat); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	switch {
+	case err != nil && !written:
+		writeError(w, http.StatusInternalServerError, errors.Wrap(err, "problem reading job stats"))
+	case err != nil:
+		grip.Warning(errors.Wrap(err, "problem streaming job stats"))
+	case !written:
+		writeJSON(w, http.StatusOK, []amboy.JobStatusInfo{})
+	default:
+		_, err = io.WriteString(w, "]\n")
+		grip.Debug(errors.Wrap(err, "problem writing response"))
+	}
+}
+
+type createResponse struct {
+	Registered bool   `bson:"registered" json:"registered" yaml:"registered"`
+	ID         string `bson:"id,omitempty" json:"id,omitempty" yaml:"id,omitempty"`
+	Duplicate  bool   `bson:"duplicate,omitempty" json:"duplicate,omitempty" yaml:"duplicate,omitempty"`
+	Error      string `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// submissionTracker is implemented by queues that record the jobs of
+// idempotency keys, such as middleware.IdempotentQueue.
+type submissionTracker interface {
+	Submission(key string) (string, bool)
+}
+
+// Create is an http.HandlerFunc that reads a job, in the
+// registry.JobInterchange format, from the body of the request and
+// adds it to the queue. Jobs of types that the service does not
+// allow are rejected before they're resolved. If the queue rejects the job as a duplicate
+// submission of its idempotency key, the response reports the job
+// that was submitted with the key as registered, so that clients may
+// retry submissions whose responses they did not receive.
+func (s *QueueService) Create(w http.ResponseWriter, r *http.Request) {
+	resp := createResponse{}
+	payload := &registry.JobInterchange{}
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, s.opts.MaxJobSize))
+	if err != nil {
+		code := http.StatusBadRequest
+		if int64(len(data)) >= s.opts.MaxJobSize {
+			code = http.StatusRequestEntityTooLarge
+			err = errors.Errorf("jobs are limited to %d bytes", s.opts.MaxJobSize)
+		}
+		resp.Error = errors.Wrap(err, "problem reading job payload").Error()
+		writeJSON(w, code, resp)
+		return
+	}
+
+	if err = json.Unmarshal(data, payload); err != nil {
+		resp.Error = errors.Wrap(err, "problem parsing job payload").Error()
+		writeJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	if !s.types[payload.Type] {
+		resp.Error = errors.Errorf("jobs of type '%s' may not be submitted", payload.Type).Error()
+		writeJSON(w, http.StatusForbidden, resp)
+		return
+	}
+
+	j, err := payload.Resolve(amboy.JSON)
+	if err != nil {
+		resp.Error = errors.Wrap(err, "problem resolving job").Error()
+		writeJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+	resp.ID = j.ID()
+
+	if err = s.queue.Put(r.Context(), j); err != nil {
+		if id, ok := s.submission(j, err); ok {
+			resp.ID, resp.Registered, resp.Duplicate = id, true, true
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+
+		grip.Debug(err)
+		resp.Error = errors.Wrap(err, "problem adding job to queue").Error()
+		writeJSON(w, http.StatusConflict, resp)
+		return
+	}
+
+	resp.Registered = true
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// submission returns the ID of the job that was submitted with the
+// job's idempotency key, if the error rejected the job as a duplicate
+// submission.
+func (s *QueueService) submission(j amboy.Job, err error) (string, bool) {
+	ij, ok := j.(middleware.Idempotent)
+	if !ok || errors.Cause(err) != middleware.ErrDuplicateSubmission {
+		return "", false
+	}
+
+	tracker, ok := s.queue.(submissionTracker)
+	if !ok {
+		return "", false
+	}
+
+	return tracker.Submission(ij.IdempotencyKey())
+}
+
+// Job writes the job document, in the registry.JobInterchange
+// format, for the job with the specified ID.
+func (s *QueueService) Job(w http.ResponseWriter, r *http.Request, id string) {
+	j, ok := s.queue.Get(r.Context(), id)
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.Errorf("job '%s' does not exist", id))
+		return
+	}
+
+	payload, err := registry.MakeJobInterchange(j, amboy.JSON)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errors.Wrapf(err, "problem converting job '%s'", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, payload)
+}
+
+// JobStatus describes the status and timing of a job, and its errors.
+type JobStatus struct {
+	ID        string              `bson:"id" json:"id" yaml:"id"`
+	Type      amboy.JobType       `bson:"type" json:"type" yaml:"type"`
+	Completed bool                `bson:"completed" json:"completed" yaml:"completed"`
+	Status    amboy.JobStatusInfo `bson:"status" json:"status" yaml:"status"`
+	TimeInfo  amboy.JobTimeInfo   `bson:"time_info" json:"time_info" yaml:"time_info"`
+	Error     string              `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// JobStatus writes the status and timing information for the job
+// with the specified ID.
+func (s *QueueService) JobStatus(w http.ResponseWriter, r *http.Request, id string) {
+	j, ok := s.queue.Get(r.Context(), id)
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.Errorf("job '%s' does not exist", id))
+		return
+	}
+
+	resp := JobStatus{
+		ID:        j.ID(),
+		Type:      j.Type(),
+		Completed: j.Status().Completed,
+		Status:    j.Status(),
+		TimeInfo:  j.TimeInfo(),
+	}
+	if err := j.Error(); err != nil {
+		resp.Error = err.Error()
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
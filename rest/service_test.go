@@ -0,0 +1,399 @@
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/dependency"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/amboy/registry"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/tychoish/bond/driver/drivertest"
+	"github.com/tychoish/bond/jobs"
+	"github.com/tychoish/bond/management"
+	"github.com/tychoish/bond/middleware"
+)
+
+type keyedJob struct {
+	Key       string `json:"key"`
+	*job.Base `json:"metadata"`
+}
+
+func newKeyedJob(id, key string) *keyedJob {
+	j := &keyedJob{Key: key, Base: &job.Base{JobType: amboy.JobType{Name: "rest-keyed-test", Version: 0}}}
+	j.SetID(id)
+	j.SetDependency(dependency.NewAlways())
+	return j
+}
+
+func (j *keyedJob) IdempotencyKey() string       { return j.Key }
+func (j *keyedJob) SetIdempotencyKey(key string) { j.Key = key }
+func (j *keyedJob) Run(context.Context)          { j.MarkComplete() }
+
+// labeledJob has labels, for filters.
+type labeledJob struct {
+	*job.ShellJob
+	JobLabels map[string]string
+}
+
+func newLabeledJob(id string, labels map[string]string) *labeledJob {
+	j := &labeledJob{ShellJob: job.NewShellJob("true", ""), JobLabels: labels}
+	j.SetID(id)
+	return j
+}
+
+func (j *labeledJob) Labels() map[string]string  { return j.JobLabels }
+func (j *labeledJob) SetLabel(key, value string) { j.JobLabels[key] = value }
+
+type QueueServiceSuite struct {
+	service *QueueService
+	server  *httptest.Server
+	ctx     context.Context
+	cancel  context.CancelFunc
+	require *require.Assertions
+	suite.Suite
+}
+
+// testServiceOptions allow the job types of the tests, and a type
+// that isn't registered.
+var testServiceOptions = QueueServiceOptions{JobTypes: []string{"shell", "rest-keyed-test", "does-not-exist"}}
+
+func TestQueueServiceSuite(t *testing.T) {
+	suite.Run(t, new(QueueServiceSuite))
+}
+
+func (s *QueueServiceSuite) SetupSuite() {
+	job.RegisterDefaultJobs()
+	registry.AddJobType("rest-keyed-test", func() amboy.Job { return newKeyedJob("", "") })
+	s.require = s.Require()
+}
+
+func (s *QueueServiceSuite) SetupTest() {
+	s.ctx, s.cancel = context.WithTimeout(context.Background(), time.Minute)
+	q := queue.NewLocalLimitedSize(2, 128)
+	s.require.NoError(q.Start(s.ctx))
+
+	s.service = NewQueueService(q, testServiceOptions)
+	s.server = httptest.NewServer(s.service.Handler())
+}
+
+func (s *QueueServiceSuite) TearDownTest() {
+	s.server.Close()
+	s.cancel()
+}
+
+func (s *QueueServiceSuite) get(path string, out interface{}) int {
+	resp, err := http.Get(s.server.URL + path)
+	s.require.NoError(err)
+	defer resp.Body.Close()
+
+	if out != nil {
+		s.require.NoError(json.NewDecoder(resp.Body).Decode(out))
+	}
+
+	return resp.StatusCode
+}
+
+func (s *QueueServiceSuite) post(path string, payload interface{}, out interface{}) int {
+	body, err := json.Marshal(payload)
+	s.require.NoError(err)
+
+	resp, err := http.Post(s.server.URL+path, "application/json", bytes.NewReader(body))
+	s.require.NoError(err)
+	defer resp.Body.Close()
+
+	if out != nil {
+		s.require.NoError(json.NewDecoder(resp.Body).Decode(out))
+	}
+
+	return resp.StatusCode
+}
+
+func (s *QueueServiceSuite) TestStatusReportsRunningQueue() {
+	out := QueueStatus{}
+	s.Equal(http.StatusOK, s.get("/v1/status", &out))
+	s.True(out.Started)
+	s.Equal(s.service.Queue().ID(), out.QueueID)
+}
+
+func (s *QueueServiceSuite) TestTypeStatsRequiresReporter() {
+	s.Equal(http.StatusNotImplemented, s.get("/v1/stats/types", nil))
+
+	q, err := middleware.NewTypeStatsQueue(queue.NewLocalLimitedSize(1, 16), 10)
+	s.require.NoError(err)
+	s.require.NoError(q.Start(s.ctx))
+	s.require.NoError(q.Put(s.ctx, job.NewShellJob("true", "")))
+	amboy.WaitInterval(s.ctx, q, 10*time.Millisecond)
+
+	srv := httptest.NewServer(NewQueueService(q, testServiceOptions).Handler())
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/v1/stats/types")
+	s.require.NoError(err)
+	defer resp.Body.Close()
+
+	out := []middleware.TypeStats{}
+	s.require.NoError(json.NewDecoder(resp.Body).Decode(&out))
+	s.require.Len(out, 1)
+	s.Equal("shell", out[0].Type)
+	s.Equal(1, out[0].Executions)
+}
+
+func (s *QueueServiceSuite) TestCreateAndFetchJob() {
+	j := job.NewShellJob("true", "")
+	payload, err := registry.MakeJobInterchange(j, amboy.JSON)
+	s.require.NoError(err)
+
+	resp := createResponse{}
+	s.Equal(http.StatusOK, s.post("/v1/jobs", payload, &resp))
+	s.True(resp.Registered)
+	s.Equal(j.ID(), resp.ID)
+
+	// adding the same job again is a conflict
+	s.Equal(http.StatusConflict, s.post("/v1/jobs", payload, &resp))
+	s.False(resp.Registered)
+
+	s.NoError(jobs.WaitJob(s.ctx, s.service.Queue(), j.ID(), jobs.Backoff{}))
+
+	status := JobStatus{}
+	s.Equal(http.StatusOK, s.get("/v1/jobs/"+j.ID()+"/status", &status))
+	s.True(status.Completed)
+	s.Equal("shell", status.Type.Name)
+	s.Empty(status.Error)
+
+	doc := registry.JobInterchange{}
+	s.Equal(http.StatusOK, s.get("/v1/jobs/"+j.ID(), &doc))
+	s.Equal(j.ID(), doc.Name)
+
+	stats := amboy.QueueStats{}
+	s.Equal(http.StatusOK, s.get("/v1/stats", &stats))
+	s.Equal(1, stats.Total)
+	s.Equal(1, stats.Completed)
+
+	jobs := []amboy.JobStatusInfo{}
+	s.Equal(http.StatusOK, s.get("/v1/jobs", &jobs))
+	s.Len(jobs, 1)
+	s.Equal(j.ID(), jobs[0].ID)
+}
+
+func (s *QueueServiceSuite) TestJobStatsFiltersByLabels() {
+	q := s.service.Queue()
+	s.require.NoError(q.Put(s.ctx, newLabeledJob("v70", map[string]string{"series": "7.0"})))
+	s.require.NoError(q.Put(s.ctx, newLabeledJob("v60", map[string]string{"series": "6.0"})))
+	s.require.NoError(q.Put(s.ctx, job.NewShellJob("true", "")))
+
+	jobs := []amboy.JobStatusInfo{}
+	s.Equal(http.StatusOK, s.get("/v1/jobs?labels=series=7.0", &jobs))
+	s.require.Len(jobs, 1)
+	s.Equal("v70", jobs[0].ID)
+
+	jobs = []amboy.JobStatusInfo{}
+	s.Equal(http.StatusOK, s.get("/v1/jobs", &jobs))
+	s.Len(jobs, 3)
+
+	s.Equal(http.StatusBadRequest, s.get("/v1/jobs?labels=series", nil))
+}
+
+func (s *QueueServiceSuite) TestJobStatsFiltersByLabelsThroughManager() {
+	d := drivertest.New("rest-labels")
+	q := queue.NewRemoteUnordered(2)
+	s.require.NoError(q.SetDriver(d))
+	s.require.NoError(q.Put(s.ctx, newLabeledJob("v70", map[string]string{"series": "7.0"})))
+	s.require.NoError(q.Put(s.ctx, newLabeledJob("v60", map[string]string{"series": "6.0"})))
+
+	s.service = NewQueueService(q, testServiceOptions)
+	s.server.Close()
+	s.server = httptest.NewServer(s.service.Handler())
+
+	jobs := []amboy.JobStatusInfo{}
+	s.Equal(http.StatusOK, s.get("/v1/jobs?labels=series=7.0", &jobs))
+	s.require.Len(jobs, 1)
+	s.Equal("v70", jobs[0].ID)
+	s.Empty(d.CallsFor(drivertest.OpGet))
+	s.Len(d.CallsFor(drivertest.OpFind), 1)
+}
+
+func (s *QueueServiceSuite) TestJobStatsStreamsBatchesThroughManager() {
+	d := drivertest.New("rest-stats")
+	q := queue.NewRemoteUnordered(2)
+	s.require.NoError(q.SetDriver(d))
+	for i := 0; i < 5; i++ {
+		j := job.NewShellJob("true", "")
+		j.SetID(fmt.Sprintf("job-%d", i))
+		s.require.NoError(q.Put(s.ctx, j))
+	}
+
+	s.service = NewQueueService(q, testServiceOptions)
+	s.server.Close()
+	s.server = httptest.NewServer(s.service.Handler())
+
+	jobs := []amboy.JobStatusInfo{}
+	s.Equal(http.StatusOK, s.get("/v1/jobs?batch_size=2", &jobs))
+	s.require.Len(jobs, 5)
+	s.Equal("job-0", jobs[0].ID)
+	s.Equal("job-4", jobs[4].ID)
+	s.Len(d.CallsFor(drivertest.OpFind), 3)
+	s.Empty(d.CallsFor(drivertest.OpGet))
+
+	// failures before the first batch are errors
+	d.FailNext(drivertest.OpFind, errors.New("unreachable"))
+	s.Equal(http.StatusInternalServerError, s.get("/v1/jobs", nil))
+	s.Equal(http.StatusBadRequest, s.get("/v1/jobs?batch_size=0", nil))
+
+	s.service.SetManager(management.New(drivertest.New("rest-empty")))
+	jobs = nil
+	s.Equal(http.StatusOK, s.get("/v1/jobs", &jobs))
+	s.NotNil(jobs)
+	s.Empty(jobs)
+}
+
+func (s *QueueServiceSuite) TestCreateRetriesIdempotentSubmissions() {
+	q, err := middleware.NewIdempotentQueue(s.service.Queue(), time.Minute)
+	s.require.NoError(err)
+	s.service = NewQueueService(q, testServiceOptions)
+	s.server.Close()
+	s.server = httptest.NewServer(s.service.Handler())
+
+	first, err := registry.MakeJobInterchange(newKeyedJob("first", "submission"), amboy.JSON)
+	s.require.NoError(err)
+	resp := createResponse{}
+	s.Equal(http.StatusOK, s.post("/v1/jobs", first, &resp))
+	s.True(resp.Registered)
+	s.False(resp.Duplicate)
+
+	// a retry with a new ID reports the first job
+	retry, err := registry.MakeJobInterchange(newKeyedJob("retry", "submission"), amboy.JSON)
+	s.require.NoError(err)
+	resp = createResponse{}
+	s.Equal(http.StatusOK, s.post("/v1/jobs", retry, &resp))
+	s.True(resp.Registered)
+	s.True(resp.Duplicate)
+	s.Equal("first", resp.ID)
+
+	_, ok := q.Get(s.ctx, "retry")
+	s.False(ok)
+}
+
+func (s *QueueServiceSuite) TestCreateWithInvalidPayloads() {
+	resp := createResponse{}
+	s.Equal(http.StatusBadRequest, s.post("/v1/jobs", "not a job", &resp))
+	s.NotEmpty(resp.Error)
+
+	s.Equal(http.StatusBadRequest, s.post("/v1/jobs", registry.JobInterchange{Type: "does-not-exist"}, &resp))
+	s.NotEmpty(resp.Error)
+}
+
+func (s *QueueServiceSuite) TestCreateRejectsJobsOfOtherTypes() {
+	other := newKeyedJob("other", "")
+	other.JobType.Name = "rest-other-test"
+	payload, err := registry.MakeJobInterchange(other, amboy.JSON)
+	s.require.NoError(err)
+
+	resp := createResponse{}
+	s.Equal(http.StatusForbidden, s.post("/v1/jobs", payload, &resp))
+	s.False(resp.Registered)
+	s.Contains(resp.Error, payload.Type)
+
+	// services without job types accept none
+	s.service = NewQueueService(s.service.Queue(), QueueServiceOptions{})
+	s.server.Close()
+	s.server = httptest.NewServer(s.service.Handler())
+	payload, err = registry.MakeJobInterchange(job.NewShellJob("true", ""), amboy.JSON)
+	s.require.NoError(err)
+	s.Equal(http.StatusForbidden, s.post("/v1/jobs", payload, &resp))
+	s.Equal(0, s.service.Queue().Stats(s.ctx).Total)
+}
+
+func (s *QueueServiceSuite) TestCreateLimitsTheSizeOfJobs() {
+	s.service = NewQueueService(s.service.Queue(), QueueServiceOptions{JobTypes: []string{"shell"}, MaxJobSize: 2048})
+	s.server.Close()
+	s.server = httptest.NewServer(s.service.Handler())
+
+	payload, err := registry.MakeJobInterchange(job.NewShellJob("echo "+strings.Repeat("x", 4096), ""), amboy.JSON)
+	s.require.NoError(err)
+	resp := createResponse{}
+	s.Equal(http.StatusRequestEntityTooLarge, s.post("/v1/jobs", payload, &resp))
+	s.Contains(resp.Error, "2048 bytes")
+
+	payload, err = registry.MakeJobInterchange(job.NewShellJob("true", ""), amboy.JSON)
+	s.require.NoError(err)
+	s.Equal(http.StatusOK, s.post("/v1/jobs", payload, &resp))
+	s.True(resp.Registered)
+}
+
+func (s *QueueServiceSuite) TestTokensAreRequired() {
+	opts := testServiceOptions
+	opts.Token = "secret"
+	s.service = NewQueueService(s.service.Queue(), opts)
+	s.server.Close()
+	s.server = httptest.NewServer(s.service.Handler())
+
+	for _, path := range []string{"/v1/status", "/v1/jobs", "/v1/jobs/does-not-exist", "/v1/openapi.json"} {
+		s.Equal(http.StatusUnauthorized, s.get(path, nil), path)
+	}
+	s.Equal(http.StatusUnauthorized, s.post("/v1/jobs", "not a job", nil))
+
+	client := NewQueueClient(s.server.URL, nil)
+	_, err := client.Submit(s.ctx, job.NewShellJob("true", ""))
+	s.Error(err)
+
+	client.SetToken("secret")
+	id, err := client.Submit(s.ctx, job.NewShellJob("true", ""))
+	s.require.NoError(err)
+	stat, err := client.Wait(s.ctx, id, 10*time.Millisecond)
+	s.require.NoError(err)
+	s.True(stat.Completed)
+}
+
+func (s *QueueServiceSuite) TestMissingJobsAreNotFound() {
+	out := errorResponse{}
+	s.Equal(http.StatusNotFound, s.get("/v1/jobs/does-not-exist", &out))
+	s.NotEmpty(out.Error)
+	s.Equal(http.StatusNotFound, s.get("/v1/jobs/does-not-exist/status", &out))
+}
+
+func (s *QueueServiceSuite) TestUnsupportedMethods() {
+	req, err := http.NewRequest(http.MethodDelete, s.server.URL+"/v1/jobs", nil)
+	s.require.NoError(err)
+	resp, err := http.DefaultClient.Do(req)
+	s.require.NoError(err)
+	resp.Body.Close()
+	s.Equal(http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func (s *QueueServiceSuite) TestWatchStreamsUntilCompletion() {
+	j := job.NewShellJob("sleep 0.1", "")
+	s.require.NoError(s.service.Queue().Put(s.ctx, j))
+
+	resp, err := http.Get(s.server.URL + "/v1/jobs/" + j.ID() + "/watch?interval=10")
+	s.require.NoError(err)
+	defer resp.Body.Close()
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	var last JobStatus
+	count := 0
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		s.require.NoError(json.Unmarshal(scanner.Bytes(), &last))
+		count++
+	}
+	s.NoError(scanner.Err())
+	s.True(count >= 1)
+	s.True(last.Completed)
+	s.Equal(j.ID(), last.ID)
+
+	out := errorResponse{}
+	s.Equal(http.StatusNotFound, s.get("/v1/jobs/does-not-exist/watch", &out))
+	s.Equal(http.StatusBadRequest, s.get("/v1/jobs/"+j.ID()+"/watch?interval=foo", &out))
+}
@@ -0,0 +1,42 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+type errorResponse struct {
+	Error string `bson:"error" json:"error" yaml:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, data interface{}) {
+	out, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		grip.Error(errors.Wrap(err, "problem rendering response"))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	_, err = w.Write(out)
+	grip.Debug(errors.Wrap(err, "problem writing response"))
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorResponse{Error: err.Error()})
+}
+
+func onlyMethod(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s is not supported", r.Method))
+			return
+		}
+
+		h(w, r)
+	}
+}
@@ -0,0 +1,91 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+)
+
+const defaultWatchInterval = 500 * time.Millisecond
+
+// WatchJob is a long-lived handler that streams the status of a job
+// as newline-delimited JSON documents (JobStatus), writing a
+// new document every time the job's status changes, until the job
+// completes or the client disconnects. Clients may control the
+// polling interval with the "interval" query parameter, in
+// milliseconds. The rpc package streams the same updates to gRPC
+// clients.
+func (s *QueueService) WatchJob(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+
+	interval := defaultWatchInterval
+	if val := r.URL.Query().Get("interval"); val != "" {
+		ms, err := strconv.Atoi(val)
+		if err != nil || ms <= 0 {
+			writeError(w, http.StatusBadRequest, errors.Errorf("'%s' is not a valid interval", val))
+			return
+		}
+		interval = time.Duration(ms) * time.Millisecond
+	}
+
+	j, ok := s.queue.Get(ctx, id)
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.Errorf("job '%s' does not exist", id))
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	lastModCount := -1
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			j, ok = s.queue.Get(ctx, id)
+			if !ok {
+				return
+			}
+
+			stat := j.Status()
+			if stat.ModificationCount != lastModCount || stat.Completed {
+				lastModCount = stat.ModificationCount
+
+				resp := JobStatus{
+					ID:        j.ID(),
+					Type:      j.Type(),
+					Completed: stat.Completed,
+					Status:    stat,
+					TimeInfo:  j.TimeInfo(),
+				}
+				if err := j.Error(); err != nil {
+					resp.Error = err.Error()
+				}
+
+				if err := enc.Encode(resp); err != nil {
+					grip.Debug(errors.Wrap(err, "problem writing job status"))
+					return
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+
+			if stat.Completed {
+				return
+			}
+
+			timer.Reset(interval)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package bond
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+)
+
+// DownloadState records the progress of a download, in a file next to
+// the partially downloaded file, so that a download interrupted by a
+// failure or a restart can resume where it stopped.
+type DownloadState struct {
+	URL       string     `bson:"url" json:"url" yaml:"url"`
+	Written   int64      `bson:"written" json:"written" yaml:"written"`
+	Total     int64      `bson:"total" json:"total" yaml:"total"`
+	ETag      string     `bson:"etag,omitempty" json:"etag,omitempty" yaml:"etag,omitempty"`
+	Checksums []Checksum `bson:"checksums,omitempty" json:"checksums,omitempty" yaml:"checksums,omitempty"`
+	Updated   time.Time  `bson:"updated" json:"updated" yaml:"updated"`
+}
+
+// PartialFilePolicy determines what happens to the partial file of a
+// download that fails or is cancelled.
+type PartialFilePolicy string
+
+// The partial file policies. By default, partial files are kept so
+// that the next attempt resumes the download.
+const (
+	ResumePartialFiles PartialFilePolicy = "resume"
+	RemovePartialFiles PartialFilePolicy = "remove"
+)
+
+// PartialFileName returns the name of the file that holds a
+// resumable download until it's complete.
+func PartialFileName(fileName string) string { return fileName + ".partial" }
+
+// DownloadStateFileName returns the name of the file that records the
+// state of a resumable download.
+func DownloadStateFileName(fileName string) string { return fileName + ".partial.json" }
+
+// GetDownloadState returns the state of an incomplete resumable
+// download of the file. The second value is false if there is no
+// incomplete download.
+func GetDownloadState(fileName string) (DownloadState, bool, error) {
+	data, err := ioutil.ReadFile(DownloadStateFileName(fileName))
+	if os.IsNotExist(err) {
+		return DownloadState{}, false, nil
+	}
+	if err != nil {
+		return DownloadState{}, false, errors.Wrapf(err, "problem reading download state for %s", fileName)
+	}
+
+	state := DownloadState{}
+	if err = json.Unmarshal(data, &state); err != nil {
+		return DownloadState{}, false, errors.Wrapf(err, "problem parsing download state for %s", fileName)
+	}
+
+	return state, true, nil
+}
+
+func writeDownloadState(fileName string, state DownloadState) error {
+	state.Updated = time.Now()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "problem converting download state to json")
+	}
+
+	fn := DownloadStateFileName(fileName)
+	tmp := fn + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrapf(err, "problem writing download state for %s", fileName)
+	}
+
+	return errors.Wrapf(os.Rename(tmp, fn), "problem writing download state for %s", fileName)
+}
+
+// RemoveDownloadState removes the partial file and state of an
+// incomplete resumable download.
+func RemoveDownloadState(fileName string) error {
+	catcher := grip.NewBasicCatcher()
+	for _, fn := range []string{PartialFileName(fileName), DownloadStateFileName(fileName)} {
+		if err := os.Remove(fn); err != nil && !os.IsNotExist(err) {
+			catcher.Add(err)
+		}
+	}
+
+	return catcher.Resolve()
+}
+
+// downloadStateInterval is how many bytes a resumable download writes
+// between updates to its state file.
+const downloadStateInterval = 8 * 1024 * 1024
+
+// ResumeDownloadFile downloads a resource (url) into a file specified
+// by fileName, like DownloadFile, but writes to a partial file and
+// records its progress in a state file. If the download fails or the
+// process exits, the partial file is kept, and the next call for the
+// same url and checksums resumes the download from the end of the
+// partial file, if the server supports range requests. If the server
+// cannot resume the download from the end of the partial file, the
+// partial file is discarded and the download restarts. The checksums
+// are only used to tell whether a partial file belongs to the same
+// archive; verify the completed file with VerifyFile.
+func ResumeDownloadFile(ctx context.Context, url, fileName string, sums []Checksum) error {
+	client := GetHTTPClient()
+	defer PutHTTPClient(client)
+
+	return resumeDownloadFile(ctx, client, nil, url, fileName, sums)
+}
+
+func resumeDownloadFile(ctx context.Context, client *http.Client, progress ProgressFunc, url, fileName string, sums []Checksum) error {
+	if err := createDirectory(filepath.Dir(fileName)); err != nil {
+		return errors.Wrapf(err, "problem creating enclosing directory for %s", fileName)
+	}
+
+	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
+		return errors.Errorf("'%s' file exists", fileName)
+	}
+
+	state, ok, err := GetDownloadState(fileName)
+	if err != nil {
+		grip.Warning(err)
+	}
+
+	partial := PartialFileName(fileName)
+	if ok && state.URL == url && reflect.DeepEqual(state.Checksums, sums) {
+		stat, err := os.Stat(partial)
+		if err != nil {
+			state.Written = 0
+		} else {
+			// the state file may lag behind the partial file.
+			state.Written = stat.Size()
+		}
+	} else {
+		if ok {
+			grip.Info(message.Fields{
+				"message": "discarding partial download of a different file",
+				"file":    fileName,
+				"url":     state.URL,
+			})
+		}
+		state = DownloadState{URL: url, Checksums: sums}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return errors.Wrap(err, "problem building request")
+	}
+
+	if state.Written > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", state.Written))
+		if state.ETag != "" {
+			req.Header.Set("If-Range", state.ETag)
+		}
+	}
+
+	grip.Noticeln("downloading:", fileName)
+	recordDownloadStart()
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		recordDownloadFailure()
+		return errors.Wrap(err, "problem downloading file")
+	}
+	defer resp.Body.Close()
+
+	if state.Written > 0 {
+		var reason string
+		switch resp.StatusCode {
+		case http.StatusRequestedRangeNotSatisfiable:
+			reason = "server cannot resume the download"
+		case http.StatusPartialContent:
+			if start, total, err := parseContentRange(resp.Header.Get("Content-Range")); err != nil {
+				reason = err.Error()
+			} else if start != state.Written {
+				reason = fmt.Sprintf("server resumed the download at %d bytes, not %d", start, state.Written)
+			} else if total > 0 {
+				state.Total = total
+			}
+		}
+
+		if reason != "" {
+			// the partial file cannot be resumed, so restart
+			// the download from the beginning.
+			recordDownloadFailure()
+			grip.Warning(resp.Body.Close())
+			grip.Info(message.Fields{
+				"message": "discarding partial download",
+				"reason":  reason,
+				"file":    fileName,
+				"url":     url,
+				"written": state.Written,
+			})
+			if err = RemoveDownloadState(fileName); err != nil {
+				return errors.Wrapf(err, "problem discarding partial download of %s", fileName)
+			}
+
+			return resumeDownloadFile(ctx, client, progress, url, fileName, sums)
+		}
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && state.Written > 0:
+		flags |= os.O_APPEND
+		grip.Infof("resuming download of %s at %d bytes", fileName, state.Written)
+	case resp.StatusCode < 300:
+		// the server ignored the range, or the file changed
+		flags |= os.O_TRUNC
+		state.Written = 0
+		state.Total = resp.ContentLength
+	default:
+		recordDownloadFailure()
+		return errors.Errorf("encountered error %d (%s) for %s", resp.StatusCode, resp.Status, url)
+	}
+	state.ETag = resp.Header.Get("ETag")
+	if state.Total <= 0 && resp.ContentLength > 0 {
+		state.Total = state.Written + resp.ContentLength
+	}
+
+	output, err := os.OpenFile(partial, flags, 0644)
+	if err != nil {
+		recordDownloadFailure()
+		return errors.Wrapf(err, "could not create file for package '%s'", fileName)
+	}
+
+	if err = preallocate(output, state.Written, resp.ContentLength); err != nil {
+		recordDownloadFailure()
+		grip.Warning(output.Close())
+		grip.Warning(writeDownloadState(fileName, state))
+		return errors.Wrapf(err, "problem downloading %s", url)
+	}
+
+	w := newProgressWriter(output, progress, DownloadProgress{
+		URL:      url,
+		FileName: fileName,
+		Written:  state.Written,
+		Total:    state.Total,
+		Resumed:  state.Written > 0,
+	})
+	n, err := copyWithState(w, resp.Body, fileName, &state)
+	catcher := grip.NewBasicCatcher()
+	catcher.Add(err)
+	catcher.Add(output.Close())
+	if catcher.HasErrors() {
+		recordDownloadFailure()
+		grip.Warning(writeDownloadState(fileName, state))
+		return errors.Wrapf(catcher.Resolve(), "problem writing %s to file %s (%d bytes written)", url, fileName, state.Written)
+	}
+
+	if state.Total > 0 && state.Written != state.Total {
+		recordDownloadFailure()
+		grip.Warning(writeDownloadState(fileName, state))
+		return errors.Errorf("download of %s is incomplete (%d of %d bytes)", url, state.Written, state.Total)
+	}
+
+	if err = os.Rename(partial, fileName); err != nil {
+		recordDownloadFailure()
+		return errors.Wrapf(err, "problem moving %s into place", fileName)
+	}
+	grip.Warning(os.Remove(DownloadStateFileName(fileName)))
+	complete(w)
+
+	recordDownloadSuccess(n)
+	grip.Debugf("%d bytes downloaded. (%s)", n, fileName)
+	return nil
+}
+
+// parseContentRange returns the first byte and the total size from
+// the Content-Range header of a partial response, e.g. "bytes
+// 5-10/11". The total is -1 if it is unknown.
+func parseContentRange(header string) (int64, int64, error) {
+	var (
+		start, end int64
+		total      string
+	)
+
+	if _, err := fmt.Sscanf(header, "bytes %d-%d/%s", &start, &end, &total); err != nil {
+		return 0, 0, errors.Wrapf(err, "invalid content range '%s'", header)
+	}
+	if start < 0 || end < start {
+		return 0, 0, errors.Errorf("invalid content range '%s'", header)
+	}
+	if total == "*" {
+		return start, -1, nil
+	}
+
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil || size <= end {
+		return 0, 0, errors.Errorf("invalid content range '%s'", header)
+	}
+
+	return start, size, nil
+}
+
+func copyWithState(w io.Writer, r io.Reader, fileName string, state *DownloadState) (int64, error) {
+	var (
+		total       int64
+		sinceUpdate int64
+	)
+
+	buf := make([]byte, 32*1024)
+	for {
+		nr, rerr := r.Read(buf)
+		if nr > 0 {
+			nw, werr := w.Write(buf[:nr])
+			total += int64(nw)
+			sinceUpdate += int64(nw)
+			state.Written += int64(nw)
+			if werr != nil {
+				return total, werr
+			}
+
+			if sinceUpdate >= downloadStateInterval {
+				sinceUpdate = 0
+				grip.Warning(writeDownloadState(fileName, *state))
+			}
+		}
+
+		if rerr == io.EOF {
+			return total, nil
+		}
+		if rerr != nil {
+			return total, rerr
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package bond
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumeDownloadFileAfterInterruption(t *testing.T) {
+	assert := assert.New(t)
+
+	content := []byte("hello world")
+	interrupt := true
+	ranges := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		if interrupt {
+			interrupt = false
+			w.Header().Set("Content-Length", "11")
+			_, _ = w.Write(content[:5])
+			return
+		}
+		http.ServeContent(w, r, "a.tgz", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "bond-resume")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "a.tgz")
+	sums := []Checksum{{SHA256, "abc"}}
+
+	require.Error(t, ResumeDownloadFile(context.Background(), srv.URL, fn, sums))
+	state, ok, err := GetDownloadState(fn)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(srv.URL, state.URL)
+	assert.EqualValues(5, state.Written)
+	assert.EqualValues(11, state.Total)
+	assert.Equal(sums, state.Checksums)
+
+	require.NoError(t, ResumeDownloadFile(context.Background(), srv.URL, fn, sums))
+	assert.Equal([]string{"", "bytes=5-"}, ranges)
+
+	data, err := ioutil.ReadFile(fn)
+	require.NoError(t, err)
+	assert.Equal(content, data)
+	for _, name := range []string{PartialFileName(fn), DownloadStateFileName(fn)} {
+		_, err = os.Stat(name)
+		assert.True(os.IsNotExist(err), name)
+	}
+
+	assert.Error(ResumeDownloadFile(context.Background(), srv.URL, fn, sums))
+}
+
+func TestResumeDownloadFileDiscardsOtherDownloads(t *testing.T) {
+	assert := assert.New(t)
+
+	ranges := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "bond-resume")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fn := filepath.Join(dir, "a.tgz")
+
+	// a partial download of the same url with different checksums,
+	// and then a server that ignores ranges.
+	for _, sums := range [][]Checksum{{{SHA256, "other"}}, nil} {
+		require.NoError(t, ioutil.WriteFile(PartialFileName(fn), []byte("stale data"), 0644))
+		require.NoError(t, writeDownloadState(fn, DownloadState{URL: srv.URL, Written: 10}))
+		require.NoError(t, ResumeDownloadFile(context.Background(), srv.URL, fn, sums))
+
+		data, err := ioutil.ReadFile(fn)
+		require.NoError(t, err)
+		assert.Equal("hello", string(data))
+		require.NoError(t, os.Remove(fn))
+	}
+	assert.Equal([]string{"", "bytes=10-"}, ranges)
+
+	require.NoError(t, ioutil.WriteFile(PartialFileName(fn), []byte("stale"), 0644))
+	require.NoError(t, writeDownloadState(fn, DownloadState{URL: srv.URL}))
+	require.NoError(t, RemoveDownloadState(fn))
+	_, ok, err := GetDownloadState(fn)
+	assert.NoError(err)
+	assert.False(ok)
+	_, err = os.Stat(PartialFileName(fn))
+	assert.True(os.IsNotExist(err))
+}
+
+func TestResumeDownloadFileRestartsUnresumableDownloads(t *testing.T) {
+	assert := assert.New(t)
+
+	content := []byte("hello world")
+	for name, resume := range map[string]http.HandlerFunc{
+		"RangeNotSatisfiable": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		},
+		"WrongRange": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Range", "bytes 0-10/11")
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content)
+		},
+		"MissingRange": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write(content[5:])
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ranges := []string{}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ranges = append(ranges, r.Header.Get("Range"))
+				if r.Header.Get("Range") != "" {
+					resume(w, r)
+					return
+				}
+				_, _ = w.Write(content)
+			}))
+			defer srv.Close()
+
+			dir, err := ioutil.TempDir("", "bond-resume")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			fn := filepath.Join(dir, "a.tgz")
+
+			require.NoError(t, ioutil.WriteFile(PartialFileName(fn), []byte("stale data!!"), 0644))
+			require.NoError(t, writeDownloadState(fn, DownloadState{URL: srv.URL, Written: 12}))
+			require.NoError(t, ResumeDownloadFile(context.Background(), srv.URL, fn, nil))
+			assert.Equal([]string{"bytes=12-", ""}, ranges)
+
+			data, err := ioutil.ReadFile(fn)
+			require.NoError(t, err)
+			assert.Equal(content, data)
+			_, ok, err := GetDownloadState(fn)
+			assert.NoError(err)
+			assert.False(ok)
+		})
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	assert := assert.New(t)
+
+	start, total, err := parseContentRange("bytes 5-10/11")
+	assert.NoError(err)
+	assert.EqualValues(5, start)
+	assert.EqualValues(11, total)
+
+	start, total, err = parseContentRange("bytes 5-10/*")
+	assert.NoError(err)
+	assert.EqualValues(5, start)
+	assert.EqualValues(-1, total)
+
+	for _, header := range []string{"", "bytes */11", "bytes 10-5/11", "bytes 5-10/10", "items 5-10/11"} {
+		_, _, err = parseContentRange(header)
+		assert.Error(err, header)
+	}
+}
@@ -0,0 +1,262 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/registry"
+	"github.com/pkg/errors"
+)
+
+// Client is a gRPC client for the QueueService. Calls that fail with
+// a gRPC status return an *Error.
+type Client struct {
+	base   string
+	client *http.Client
+}
+
+// NewClient constructs a client for a server at the specified base
+// URL. The http.Client must use HTTP/2: for example, the client of a
+// TLS server with HTTP/2 enabled. If the http.Client is nil, the
+// client uses http.DefaultClient, which negotiates HTTP/2 with TLS
+// servers.
+func NewClient(base string, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Client{
+		base:   strings.TrimRight(base, "/") + "/" + ServiceName + "/",
+		client: client,
+	}
+}
+
+// SubmitJob adds the job to the remote queue and returns its ID. If
+// the queue rejects the job as a retry of the submission of its
+// idempotency key, SubmitJob returns the ID of the job of the
+// original submission.
+func (c *Client) SubmitJob(ctx context.Context, j amboy.Job) (string, error) {
+	payload, err := registry.MakeJobInterchange(j, amboy.JSON)
+	if err != nil {
+		return "", errors.Wrapf(err, "problem converting job '%s'", j.ID())
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", errors.Wrapf(err, "problem encoding job '%s'", j.ID())
+	}
+
+	resp := &submitJobResponse{}
+	if err := c.invoke(ctx, "SubmitJob", &submitJobRequest{job: data}, resp); err != nil {
+		return "", err
+	}
+
+	return resp.id, nil
+}
+
+// GetJob returns the status of the job with the specified ID.
+func (c *Client) GetJob(ctx context.Context, id string) (*JobStatus, error) {
+	out := &JobStatus{}
+	if err := c.invoke(ctx, "GetJob", &getJobRequest{id: id}, out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// QueueStats returns the stats of the remote queue.
+func (c *Client) QueueStats(ctx context.Context) (amboy.QueueStats, error) {
+	out := &queueStats{}
+	if err := c.invoke(ctx, "QueueStats", &queueStatsRequest{}, out); err != nil {
+		return amboy.QueueStats{}, err
+	}
+
+	return out.QueueStats, nil
+}
+
+// WatchJob starts a watch of the job with the specified ID, which the
+// server checks on the interval, or every 500 milliseconds if the
+// interval is zero. Read the job's statuses from the watcher until it
+// returns io.EOF, after the job completes, and close it when done.
+func (c *Client) WatchJob(ctx context.Context, id string, interval time.Duration) (*JobWatcher, error) {
+	st, err := c.call(ctx, "WatchJob", &watchJobRequest{id: id, interval: interval})
+	if err != nil {
+		return nil, err
+	}
+
+	return &JobWatcher{stream: st}, nil
+}
+
+// JobWatcher reads the statuses of a watched job.
+type JobWatcher struct {
+	stream *clientStream
+}
+
+// Recv returns the next status of the job, blocking until the job's
+// status changes. Recv returns io.EOF when the job has completed and
+// the watcher has returned its final status.
+func (w *JobWatcher) Recv() (*JobStatus, error) {
+	out := &JobStatus{}
+	if err := w.stream.recv(out); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// Close ends the watch.
+func (w *JobWatcher) Close() error { return w.stream.close() }
+
+// invoke calls a method with a single response message.
+func (c *Client) invoke(ctx context.Context, method string, req, resp message) error {
+	st, err := c.call(ctx, method, req)
+	if err != nil {
+		return err
+	}
+	defer st.close()
+
+	if err := st.recv(resp); err != nil {
+		if err == io.EOF {
+			return statusError(Internal, "call of %s returned no response message", method)
+		}
+		return err
+	}
+
+	if err := st.recv(resp); err != io.EOF {
+		if err == nil {
+			return statusError(Internal, "call of %s returned more than one response message", method)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (c *Client) call(ctx context.Context, method string, req message) (*clientStream, error) {
+	body := &bytes.Buffer{}
+	if err := writeFrame(body, req); err != nil {
+		return nil, errors.Wrap(err, "problem encoding request")
+	}
+
+	r, err := http.NewRequest(http.MethodPost, c.base+method, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem building request")
+	}
+	r = r.WithContext(ctx)
+	r.Header.Set("Content-Type", contentType+"+proto")
+	r.Header.Set("Te", "trailers")
+	if deadline, ok := ctx.Deadline(); ok {
+		r.Header.Set("Grpc-Timeout", encodeTimeout(time.Until(deadline)))
+	}
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		if cerr := contextError(ctx, err); cerr != nil {
+			return nil, cerr
+		}
+		return nil, statusError(Unavailable, "%s", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, statusError(httpStatusCode(resp.StatusCode), "server returned HTTP status %s", resp.Status)
+	}
+	if !validContentType(resp.Header.Get("Content-Type")) {
+		resp.Body.Close()
+		return nil, statusError(Internal, "server returned content type '%s'", resp.Header.Get("Content-Type"))
+	}
+
+	// responses without messages may send their status in the
+	// headers rather than the trailers
+	if err := responseStatus(resp.Header); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return &clientStream{ctx: ctx, resp: resp}, nil
+}
+
+// contextError returns the status of a call that failed because its
+// context ended, if it did.
+func contextError(ctx context.Context, err error) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return statusError(DeadlineExceeded, "%s", err)
+	case context.Canceled:
+		return statusError(Canceled, "%s", err)
+	default:
+		return nil
+	}
+}
+
+// httpStatusCode maps the HTTP status of a response that is not a
+// gRPC response to a gRPC code, as the gRPC libraries do.
+func httpStatusCode(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return Internal
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return Unimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return Unavailable
+	default:
+		return Unknown
+	}
+}
+
+// responseStatus returns the error of the status in the header, if it
+// has one that is not OK.
+func responseStatus(h http.Header) error {
+	val := h.Get("Grpc-Status")
+	if val == "" {
+		return nil
+	}
+
+	code, err := strconv.Atoi(val)
+	if err != nil {
+		return statusError(Internal, "server returned invalid status '%s'", val)
+	}
+	if Code(code) == OK {
+		return nil
+	}
+
+	return &Error{Code: Code(code), Message: decodeMessage(h.Get("Grpc-Message"))}
+}
+
+// clientStream reads the messages of a response, and then its status.
+type clientStream struct {
+	ctx  context.Context
+	resp *http.Response
+}
+
+func (st *clientStream) recv(m message) error {
+	err := readFrame(st.resp.Body, m)
+	if err == nil {
+		return nil
+	}
+	if err != io.EOF {
+		if cerr := contextError(st.ctx, err); cerr != nil {
+			return cerr
+		}
+		return err
+	}
+
+	// trailers are available after the body is read
+	if st.resp.Trailer.Get("Grpc-Status") == "" && st.resp.Header.Get("Grpc-Status") == "" {
+		return statusError(Internal, "server did not return a status")
+	}
+	if err := responseStatus(st.resp.Trailer); err != nil {
+		return err
+	}
+
+	return io.EOF
+}
+
+func (st *clientStream) close() error { return st.resp.Body.Close() }
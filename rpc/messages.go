@@ -0,0 +1,212 @@
+package rpc
+
+import (
+	"time"
+
+	"github.com/mongodb/amboy"
+)
+
+// JobStatus is the status and timing information of a job, as the
+// JobStatus message of queue.proto.
+type JobStatus struct {
+	ID       string              `bson:"id" json:"id" yaml:"id"`
+	Type     amboy.JobType       `bson:"type" json:"type" yaml:"type"`
+	Status   amboy.JobStatusInfo `bson:"status" json:"status" yaml:"status"`
+	TimeInfo amboy.JobTimeInfo   `bson:"time_info" json:"time_info" yaml:"time_info"`
+	Error    string              `bson:"error,omitempty" json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func newJobStatus(j amboy.Job) *JobStatus {
+	out := &JobStatus{
+		ID:       j.ID(),
+		Type:     j.Type(),
+		Status:   j.Status(),
+		TimeInfo: j.TimeInfo(),
+	}
+	if err := j.Error(); err != nil {
+		out.Error = err.Error()
+	}
+
+	return out
+}
+
+func (s *JobStatus) marshal() []byte {
+	w := &protoWriter{}
+	w.string(1, s.ID)
+	w.string(2, s.Type.Name)
+	w.int(3, int64(s.Type.Version))
+	w.bool(4, s.Status.Completed)
+	w.bool(5, s.Status.InProgress)
+	w.string(6, s.Status.Owner)
+	w.int(7, int64(s.Status.ModificationCount))
+	w.timestamp(8, s.Status.ModificationTime)
+	w.int(9, int64(s.Status.ErrorCount))
+	w.strings(10, s.Status.Errors)
+	w.timestamp(11, s.TimeInfo.Created)
+	w.timestamp(12, s.TimeInfo.Start)
+	w.timestamp(13, s.TimeInfo.End)
+	w.string(14, s.Error)
+	return w.buf
+}
+
+func (s *JobStatus) unmarshal(buf []byte) error {
+	return decodeFields(buf, func(f protoField) (err error) {
+		switch f.number {
+		case 1:
+			s.ID, s.Status.ID = f.string(), f.string()
+		case 2:
+			s.Type.Name = f.string()
+		case 3:
+			s.Type.Version = int(int32(f.int()))
+		case 4:
+			s.Status.Completed = f.bool()
+		case 5:
+			s.Status.InProgress = f.bool()
+		case 6:
+			s.Status.Owner = f.string()
+		case 7:
+			s.Status.ModificationCount = int(f.int())
+		case 8:
+			s.Status.ModificationTime, err = decodeTimestamp(f)
+		case 9:
+			s.Status.ErrorCount = int(int32(f.int()))
+		case 10:
+			s.Status.Errors = append(s.Status.Errors, f.string())
+		case 11:
+			s.TimeInfo.Created, err = decodeTimestamp(f)
+		case 12:
+			s.TimeInfo.Start, err = decodeTimestamp(f)
+		case 13:
+			s.TimeInfo.End, err = decodeTimestamp(f)
+		case 14:
+			s.Error = f.string()
+		}
+		return err
+	})
+}
+
+type submitJobRequest struct {
+	job []byte
+}
+
+func (r *submitJobRequest) marshal() []byte {
+	w := &protoWriter{}
+	w.bytes(1, r.job)
+	return w.buf
+}
+
+func (r *submitJobRequest) unmarshal(buf []byte) error {
+	return decodeFields(buf, func(f protoField) error {
+		if f.number == 1 {
+			r.job = f.data
+		}
+		return nil
+	})
+}
+
+type submitJobResponse struct {
+	id        string
+	duplicate bool
+}
+
+func (r *submitJobResponse) marshal() []byte {
+	w := &protoWriter{}
+	w.string(1, r.id)
+	w.bool(2, r.duplicate)
+	return w.buf
+}
+
+func (r *submitJobResponse) unmarshal(buf []byte) error {
+	return decodeFields(buf, func(f protoField) error {
+		switch f.number {
+		case 1:
+			r.id = f.string()
+		case 2:
+			r.duplicate = f.bool()
+		}
+		return nil
+	})
+}
+
+type getJobRequest struct {
+	id string
+}
+
+func (r *getJobRequest) marshal() []byte {
+	w := &protoWriter{}
+	w.string(1, r.id)
+	return w.buf
+}
+
+func (r *getJobRequest) unmarshal(buf []byte) error {
+	return decodeFields(buf, func(f protoField) error {
+		if f.number == 1 {
+			r.id = f.string()
+		}
+		return nil
+	})
+}
+
+type watchJobRequest struct {
+	id       string
+	interval time.Duration
+}
+
+func (r *watchJobRequest) marshal() []byte {
+	w := &protoWriter{}
+	w.string(1, r.id)
+	w.duration(2, r.interval)
+	return w.buf
+}
+
+func (r *watchJobRequest) unmarshal(buf []byte) error {
+	return decodeFields(buf, func(f protoField) (err error) {
+		switch f.number {
+		case 1:
+			r.id = f.string()
+		case 2:
+			r.interval, err = decodeDuration(f)
+		}
+		return err
+	})
+}
+
+type queueStatsRequest struct{}
+
+func (r *queueStatsRequest) marshal() []byte { return nil }
+
+func (r *queueStatsRequest) unmarshal(buf []byte) error {
+	return decodeFields(buf, func(protoField) error { return nil })
+}
+
+type queueStats struct {
+	amboy.QueueStats
+}
+
+func (s *queueStats) marshal() []byte {
+	w := &protoWriter{}
+	w.int(1, int64(s.Running))
+	w.int(2, int64(s.Completed))
+	w.int(3, int64(s.Pending))
+	w.int(4, int64(s.Blocked))
+	w.int(5, int64(s.Total))
+	return w.buf
+}
+
+func (s *queueStats) unmarshal(buf []byte) error {
+	return decodeFields(buf, func(f protoField) error {
+		switch f.number {
+		case 1:
+			s.Running = int(f.int())
+		case 2:
+			s.Completed = int(f.int())
+		case 3:
+			s.Pending = int(f.int())
+		case 4:
+			s.Blocked = int(f.int())
+		case 5:
+			s.Total = int(f.int())
+		}
+		return nil
+	})
+}
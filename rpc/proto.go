@@ -0,0 +1,215 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Protocol buffer wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// message is implemented by the service's messages, which encode
+// themselves in the protocol buffer wire format of the messages in
+// queue.proto.
+type message interface {
+	marshal() []byte
+	unmarshal([]byte) error
+}
+
+// protoWriter encodes the fields of a message. As proto3 requires,
+// fields with default values are omitted, except for the elements of
+// repeated fields.
+type protoWriter struct {
+	buf []byte
+}
+
+func (w *protoWriter) tag(field, wire int) {
+	w.buf = binary.AppendUvarint(w.buf, uint64(field)<<3|uint64(wire))
+}
+
+func (w *protoWriter) uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	w.tag(field, wireVarint)
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+func (w *protoWriter) int(field int, v int64) { w.uint(field, uint64(v)) }
+
+func (w *protoWriter) bool(field int, v bool) {
+	if v {
+		w.uint(field, 1)
+	}
+}
+
+func (w *protoWriter) bytes(field int, v []byte) {
+	if len(v) == 0 {
+		return
+	}
+	w.tag(field, wireBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+func (w *protoWriter) string(field int, v string) { w.bytes(field, []byte(v)) }
+
+func (w *protoWriter) strings(field int, v []string) {
+	for _, s := range v {
+		w.tag(field, wireBytes)
+		w.buf = binary.AppendUvarint(w.buf, uint64(len(s)))
+		w.buf = append(w.buf, s...)
+	}
+}
+
+// timestamp encodes a google.protobuf.Timestamp, omitting zero times.
+func (w *protoWriter) timestamp(field int, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+
+	ts := &protoWriter{}
+	ts.int(1, t.Unix())
+	ts.int(2, int64(t.Nanosecond()))
+	w.embedded(field, ts.buf)
+}
+
+// duration encodes a google.protobuf.Duration.
+func (w *protoWriter) duration(field int, d time.Duration) {
+	if d == 0 {
+		return
+	}
+
+	ds := &protoWriter{}
+	ds.int(1, int64(d/time.Second))
+	ds.int(2, int64(d%time.Second))
+	w.embedded(field, ds.buf)
+}
+
+// embedded encodes an embedded message, which, unlike other fields,
+// is present even when all of its fields have default values.
+func (w *protoWriter) embedded(field int, v []byte) {
+	w.tag(field, wireBytes)
+	w.buf = binary.AppendUvarint(w.buf, uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+// protoField is a field decoded from a message: the value of varint
+// fields, or the contents of length-delimited fields.
+type protoField struct {
+	number int
+	wire   int
+	value  uint64
+	data   []byte
+}
+
+func (f protoField) int() int64     { return int64(f.value) }
+func (f protoField) bool() bool     { return f.value != 0 }
+func (f protoField) string() string { return string(f.data) }
+
+func (f protoField) check(wire int) error {
+	if f.wire != wire {
+		return errors.Errorf("field %d has wire type %d, not %d", f.number, f.wire, wire)
+	}
+	return nil
+}
+
+// decodeFields calls the function for each field of the message.
+// Fields of the fixed-width wire types, which none of the service's
+// messages use, are passed to the function as their raw bytes, so
+// that decoders skip them along with other unknown fields.
+func decodeFields(buf []byte, fn func(protoField) error) error {
+	for len(buf) > 0 {
+		key, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return errors.New("invalid field key")
+		}
+		buf = buf[n:]
+
+		f := protoField{number: int(key >> 3), wire: int(key & 7)}
+		switch f.wire {
+		case wireVarint:
+			f.value, n = binary.Uvarint(buf)
+			if n <= 0 {
+				return errors.Errorf("invalid varint for field %d", f.number)
+			}
+			buf = buf[n:]
+		case wireBytes:
+			size, n := binary.Uvarint(buf)
+			if n <= 0 || size > uint64(len(buf)-n) {
+				return errors.Errorf("invalid length for field %d", f.number)
+			}
+			f.data = buf[n : n+int(size)]
+			buf = buf[n+int(size):]
+		case wireFixed64, wireFixed32:
+			size := 8
+			if f.wire == wireFixed32 {
+				size = 4
+			}
+			if len(buf) < size {
+				return errors.Errorf("truncated field %d", f.number)
+			}
+			f.data = buf[:size]
+			buf = buf[size:]
+		default:
+			return errors.Errorf("field %d has unsupported wire type %d", f.number, f.wire)
+		}
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func decodeTimestamp(f protoField) (time.Time, error) {
+	if err := f.check(wireBytes); err != nil {
+		return time.Time{}, err
+	}
+
+	var sec, nsec int64
+	err := decodeFields(f.data, func(tf protoField) error {
+		switch tf.number {
+		case 1:
+			sec = tf.int()
+		case 2:
+			nsec = tf.int()
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "invalid timestamp for field %d", f.number)
+	}
+
+	return time.Unix(sec, nsec), nil
+}
+
+func decodeDuration(f protoField) (time.Duration, error) {
+	if err := f.check(wireBytes); err != nil {
+		return 0, err
+	}
+
+	var sec, nsec int64
+	err := decodeFields(f.data, func(df protoField) error {
+		switch df.number {
+		case 1:
+			sec = df.int()
+		case 2:
+			nsec = df.int()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid duration for field %d", f.number)
+	}
+
+	return time.Duration(sec)*time.Second + time.Duration(nsec), nil
+}
@@ -0,0 +1,81 @@
+package rpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageWireFormat(t *testing.T) {
+	assert := assert.New(t)
+
+	// encodings match those of the protocol buffer libraries for the
+	// messages in queue.proto
+	assert.Equal([]byte{0x0a, 0x03, 'j', 'o', 'b'}, (&getJobRequest{id: "job"}).marshal())
+	assert.Equal([]byte{0x0a, 0x01, 'a', 0x12, 0x04, 0x08, 0x01, 0x10, 0x02}, (&watchJobRequest{id: "a", interval: time.Second + 2}).marshal())
+	assert.Equal([]byte{0x08, 0x01, 0x28, 0xac, 0x02}, (&queueStats{QueueStats: amboy.QueueStats{Running: 1, Total: 300}}).marshal())
+	assert.Empty((&queueStatsRequest{}).marshal())
+	assert.Empty((&JobStatus{}).marshal())
+}
+
+func TestJobStatusRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now()
+	in := &JobStatus{
+		ID:   "job",
+		Type: amboy.JobType{Name: "shell", Version: 2},
+		Status: amboy.JobStatusInfo{
+			ID:                "job",
+			Owner:             "worker",
+			Completed:         true,
+			ModificationTime:  now,
+			ModificationCount: 3,
+			ErrorCount:        2,
+			Errors:            []string{"", "failed"},
+		},
+		TimeInfo: amboy.JobTimeInfo{Created: now.Add(-time.Minute), End: now},
+		Error:    "failed",
+	}
+
+	out := &JobStatus{}
+	require.NoError(t, out.unmarshal(in.marshal()))
+	assert.Equal(in.ID, out.ID)
+	assert.Equal(in.Type, out.Type)
+	assert.Equal(in.Status.Errors, out.Status.Errors)
+	assert.Equal(in.Status.ModificationCount, out.Status.ModificationCount)
+	assert.True(in.Status.ModificationTime.Equal(out.Status.ModificationTime))
+	assert.True(in.TimeInfo.Created.Equal(out.TimeInfo.Created))
+	assert.True(out.TimeInfo.Start.IsZero())
+	assert.Equal(in.Error, out.Error)
+
+	// unknown fields are skipped, and truncated fields are errors
+	w := &protoWriter{buf: in.marshal()}
+	w.string(99, "future")
+	w.tag(98, wireFixed64)
+	w.buf = append(w.buf, make([]byte, 8)...)
+	assert.NoError((&JobStatus{}).unmarshal(w.buf))
+	assert.Error((&JobStatus{}).unmarshal([]byte{0x0a, 0x05, 'j'}))
+}
+
+func TestTimeoutAndMessageEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, d := range []time.Duration{time.Nanosecond, time.Second, 90 * time.Minute, 1000 * time.Hour} {
+		enc := encodeTimeout(d)
+		assert.True(len(enc) <= 9, enc)
+		dec, err := decodeTimeout(enc)
+		require.NoError(t, err)
+		assert.True(dec >= d, enc)
+	}
+	_, err := decodeTimeout("10x")
+	assert.Error(err)
+	_, err = decodeTimeout("S")
+	assert.Error(err)
+
+	assert.Equal("job 'a%25b' failed%0A", encodeMessage("job 'a%b' failed\n"))
+	assert.Equal("job 'a%b' failed\n", decodeMessage(encodeMessage("job 'a%b' failed\n")))
+}
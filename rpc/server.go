@@ -0,0 +1,318 @@
+/*
+Package rpc provides a gRPC interface to amboy queues, which
+queue.proto defines, so that clients in any language with gRPC
+support can submit jobs of the types that the server allows, read
+their status, stream status changes
+until jobs complete, and read the queue's stats.
+
+The server and client implement the gRPC protocol with the HTTP/2
+support of net/http and encode the service's messages themselves, so
+the package does not depend on the gRPC libraries. Serve the server
+over TLS, or with a server that accepts unencrypted HTTP/2
+connections, since gRPC requires HTTP/2.
+
+The gRPC libraries are not vendored: google.golang.org/grpc brings the
+protocol buffer runtime, golang.org/x/net/http2 and genproto with it,
+which every program that imports bond would have to vendor for four
+methods. The service needs only a small part of the protocol, which
+is specified independently of any library ("gRPC over HTTP2" in the
+grpc/grpc repository): POST requests to /<service>/<method>,
+length-prefixed messages, the grpc-timeout header, and the
+grpc-status and grpc-message trailers. Its messages have only scalar,
+string and repeated string fields, whose protocol buffer encoding is
+stable. Besides the package's own client, the tests check the server
+with requests assembled byte by byte from those specifications, with
+the headers that grpc-go sends, and check the encoding of the
+messages against that of protoc's generated code.
+
+The package does not implement compression (calls that use it fail
+with Unimplemented), gRPC-Web, the reflection or health services, or
+call credentials; put an authenticating proxy or handler in front of
+the server. Clients generated from queue.proto with protoc (or
+buf) in any language interoperate with the server, and the server may
+be replaced with one generated for grpc-go without changing the
+protocol, if bond vendors the gRPC libraries.
+*/
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/registry"
+	"github.com/mongodb/grip"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/middleware"
+)
+
+// ServiceName is the full name of the gRPC service in queue.proto.
+const ServiceName = "bond.queue.v1.QueueService"
+
+const defaultWatchInterval = 500 * time.Millisecond
+
+// ServerOptions configure a Server.
+type ServerOptions struct {
+	// JobTypes are the types of the jobs that clients may submit.
+	// The server rejects jobs of other types, and every job, if
+	// there are none.
+	JobTypes []string `bson:"job_types" json:"job_types" yaml:"job_types"`
+}
+
+// Server is an http.Handler that serves the gRPC QueueService for an
+// amboy.Queue. Mount it at the root of a mux, or under the service's
+// path, "/bond.queue.v1.QueueService/".
+type Server struct {
+	queue amboy.Queue
+	types map[string]bool
+}
+
+// NewServer constructs a server for the queue, which the caller
+// should start.
+func NewServer(q amboy.Queue, opts ServerOptions) *Server {
+	s := &Server{queue: q, types: map[string]bool{}}
+	for _, name := range opts.JobTypes {
+		s.types[name] = true
+	}
+
+	return s
+}
+
+// Queue provides access to the underlying queue object for the server.
+func (s *Server) Queue() amboy.Queue { return s.queue }
+
+// serverStream is the response of a call, which sends messages in the
+// body and the call's status in the trailers.
+type serverStream struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (st *serverStream) send(m message) error {
+	if err := writeFrame(st.w, m); err != nil {
+		return err
+	}
+	if st.flusher != nil {
+		st.flusher.Flush()
+	}
+	return nil
+}
+
+func (st *serverStream) finish(err error) {
+	code, msg := OK, ""
+	if err != nil {
+		code, msg = Unknown, err.Error()
+		if e, ok := err.(*Error); ok {
+			code, msg = e.Code, e.Message
+		}
+	}
+
+	st.w.Header().Set("Grpc-Status", strconv.Itoa(int(code)))
+	if msg != "" {
+		st.w.Header().Set("Grpc-Message", encodeMessage(msg))
+	}
+}
+
+// ServeHTTP handles calls of the service's methods.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "gRPC calls must use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.ProtoMajor != 2 {
+		http.Error(w, "gRPC calls require HTTP/2", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	if !validContentType(r.Header.Get("Content-Type")) {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.WriteHeader(http.StatusOK)
+
+	st := &serverStream{w: w}
+	st.flusher, _ = w.(http.Flusher)
+
+	ctx := r.Context()
+	if val := r.Header.Get("Grpc-Timeout"); val != "" {
+		timeout, err := decodeTimeout(val)
+		if err != nil {
+			st.finish(statusError(InvalidArgument, "%s", err))
+			return
+		}
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if enc := r.Header.Get("Grpc-Encoding"); enc != "" && enc != "identity" {
+		st.finish(statusError(Unimplemented, "message encoding '%s' is not supported", enc))
+		return
+	}
+
+	method := strings.TrimPrefix(r.URL.Path, "/"+ServiceName+"/")
+	switch method {
+	case "SubmitJob":
+		req := &submitJobRequest{}
+		st.finish(s.unary(r, st, req, func() (message, error) { return s.submitJob(ctx, req) }))
+	case "GetJob":
+		req := &getJobRequest{}
+		st.finish(s.unary(r, st, req, func() (message, error) { return s.getJob(ctx, req) }))
+	case "QueueStats":
+		req := &queueStatsRequest{}
+		st.finish(s.unary(r, st, req, func() (message, error) { return s.queueStats(ctx) }))
+	case "WatchJob":
+		req := &watchJobRequest{}
+		if err := readRequest(r, req); err != nil {
+			st.finish(err)
+			return
+		}
+		st.finish(s.watchJob(ctx, req, st))
+	default:
+		st.finish(statusError(Unimplemented, "unknown method '%s'", r.URL.Path))
+	}
+}
+
+// readRequest reads the single request message of a call.
+func readRequest(r *http.Request, req message) error {
+	if err := readFrame(r.Body, req); err != nil {
+		if err == io.EOF {
+			return statusError(InvalidArgument, "call has no request message")
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) unary(r *http.Request, st *serverStream, req message, call func() (message, error)) error {
+	if err := readRequest(r, req); err != nil {
+		return err
+	}
+
+	resp, err := call()
+	if err != nil {
+		return err
+	}
+
+	return errors.Wrap(st.send(resp), "problem writing response")
+}
+
+// submissionTracker is implemented by queues that record the jobs of
+// idempotency keys, such as middleware.IdempotentQueue.
+type submissionTracker interface {
+	Submission(key string) (string, bool)
+}
+
+func (s *Server) submitJob(ctx context.Context, req *submitJobRequest) (message, error) {
+	payload := &registry.JobInterchange{}
+	if err := json.Unmarshal(req.job, payload); err != nil {
+		return nil, statusError(InvalidArgument, "problem parsing job payload: %s", err)
+	}
+	if !s.types[payload.Type] {
+		return nil, statusError(PermissionDenied, "jobs of type '%s' may not be submitted", payload.Type)
+	}
+
+	j, err := payload.Resolve(amboy.JSON)
+	if err != nil {
+		return nil, statusError(InvalidArgument, "problem resolving job: %s", err)
+	}
+
+	if err = s.queue.Put(ctx, j); err != nil {
+		if id, ok := s.submission(j, err); ok {
+			return &submitJobResponse{id: id, duplicate: true}, nil
+		}
+
+		grip.Debug(err)
+		if _, ok := s.queue.Get(ctx, j.ID()); ok {
+			return nil, statusError(AlreadyExists, "job '%s' already exists", j.ID())
+		}
+		return nil, statusError(FailedPrecondition, "problem adding job to queue: %s", err)
+	}
+
+	return &submitJobResponse{id: j.ID()}, nil
+}
+
+// submission returns the ID of the job that was submitted with the
+// job's idempotency key, if the error rejected the job as a duplicate
+// submission.
+func (s *Server) submission(j amboy.Job, err error) (string, bool) {
+	ij, ok := j.(middleware.Idempotent)
+	if !ok || errors.Cause(err) != middleware.ErrDuplicateSubmission {
+		return "", false
+	}
+
+	tracker, ok := s.queue.(submissionTracker)
+	if !ok {
+		return "", false
+	}
+
+	return tracker.Submission(ij.IdempotencyKey())
+}
+
+func (s *Server) getJob(ctx context.Context, req *getJobRequest) (message, error) {
+	j, ok := s.queue.Get(ctx, req.id)
+	if !ok {
+		return nil, statusError(NotFound, "job '%s' does not exist", req.id)
+	}
+
+	return newJobStatus(j), nil
+}
+
+func (s *Server) queueStats(ctx context.Context) (message, error) {
+	return &queueStats{QueueStats: s.queue.Stats(ctx)}, nil
+}
+
+// watchJob sends the status of the job every time that it changes,
+// checking the job on the request's interval, and ends the call with
+// an OK status when the job completes.
+func (s *Server) watchJob(ctx context.Context, req *watchJobRequest, st *serverStream) error {
+	interval := req.interval
+	if interval < 0 {
+		return statusError(InvalidArgument, "interval must not be negative")
+	}
+	if interval == 0 {
+		interval = defaultWatchInterval
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	lastModCount := -1
+	for {
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return statusError(DeadlineExceeded, "watch of job '%s' timed out", req.id)
+			}
+			return statusError(Canceled, "watch of job '%s' was canceled", req.id)
+		case <-timer.C:
+			j, ok := s.queue.Get(ctx, req.id)
+			if !ok {
+				return statusError(NotFound, "job '%s' does not exist", req.id)
+			}
+
+			stat := j.Status()
+			if stat.ModificationCount != lastModCount || stat.Completed {
+				lastModCount = stat.ModificationCount
+				if err := st.send(newJobStatus(j)); err != nil {
+					return errors.Wrap(err, "problem writing job status")
+				}
+			}
+
+			if stat.Completed {
+				return nil
+			}
+
+			timer.Reset(interval)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/dependency"
+	"github.com/mongodb/amboy/job"
+	"github.com/mongodb/amboy/queue"
+	"github.com/mongodb/amboy/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testJob runs until its channel is closed, if it blocks.
+type testJob struct {
+	Block     bool `json:"block"`
+	*job.Base `json:"metadata"`
+	release   chan struct{}
+}
+
+func init() {
+	registry.AddJobType("rpc-test", func() amboy.Job { return newTestJob("", false) })
+}
+
+func newTestJob(id string, block bool) *testJob {
+	j := &testJob{Block: block, Base: &job.Base{JobType: amboy.JobType{Name: "rpc-test"}}, release: make(chan struct{})}
+	j.SetID(id)
+	j.SetDependency(dependency.NewAlways())
+	return j
+}
+
+func (j *testJob) Run(ctx context.Context) {
+	defer j.MarkComplete()
+
+	if !j.Block {
+		return
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-j.release:
+	}
+}
+
+func startServer(t *testing.T, ctx context.Context) (amboy.Queue, *httptest.Server, *Client) {
+	q := queue.NewLocalLimitedSize(2, 128)
+	require.NoError(t, q.Start(ctx))
+
+	srv := httptest.NewUnstartedServer(NewServer(q, ServerOptions{JobTypes: []string{"rpc-test"}}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+
+	return q, srv, NewClient(srv.URL, srv.Client())
+}
+
+func TestServerCalls(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q, srv, client := startServer(t, ctx)
+	defer srv.Close()
+
+	id, err := client.SubmitJob(ctx, newTestJob("quick", false))
+	require.NoError(t, err)
+	require.True(t, amboy.WaitInterval(ctx, q, 10*time.Millisecond))
+
+	stat, err := client.GetJob(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(id, stat.ID)
+	assert.Equal("rpc-test", stat.Type.Name)
+	assert.True(stat.Status.Completed)
+	assert.False(stat.TimeInfo.End.IsZero())
+	assert.Empty(stat.Error)
+
+	stats, err := client.QueueStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(1, stats.Total)
+	assert.Equal(1, stats.Completed)
+
+	// errors are gRPC statuses
+	_, err = client.GetJob(ctx, "missing")
+	require.Error(t, err)
+	assert.Equal(NotFound, StatusCode(err))
+	assert.Contains(err.Error(), "job 'missing' does not exist")
+
+	stored, ok := q.Get(ctx, id)
+	require.True(t, ok)
+	_, err = client.SubmitJob(ctx, stored)
+	assert.Equal(AlreadyExists, StatusCode(err))
+
+	err = client.invoke(ctx, "SubmitJob", &submitJobRequest{job: []byte("{")}, &submitJobResponse{})
+	assert.Equal(InvalidArgument, StatusCode(err))
+
+	// jobs of other types are rejected
+	_, err = client.SubmitJob(ctx, job.NewShellJob("true", ""))
+	assert.Equal(PermissionDenied, StatusCode(err))
+	assert.Equal(1, q.Stats(ctx).Total)
+
+	err = client.invoke(ctx, "Missing", &getJobRequest{}, &JobStatus{})
+	assert.Equal(Unimplemented, StatusCode(err))
+}
+
+func TestServerWatchesJobs(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q, srv, client := startServer(t, ctx)
+	defer srv.Close()
+
+	j := newTestJob("slow", true)
+	require.NoError(t, q.Put(ctx, j))
+
+	w, err := client.WatchJob(ctx, j.ID(), 5*time.Millisecond)
+	require.NoError(t, err)
+	defer w.Close()
+
+	// the watch streams statuses as the job changes
+	first, err := w.Recv()
+	require.NoError(t, err)
+	assert.Equal("slow", first.ID)
+	assert.False(first.Status.Completed)
+
+	close(j.release)
+
+	var last *JobStatus
+	for {
+		stat, err := w.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		last = stat
+	}
+	require.NotNil(t, last)
+	assert.True(last.Status.Completed)
+
+	w, err = client.WatchJob(ctx, j.ID(), -time.Second)
+	require.NoError(t, err)
+	_, err = w.Recv()
+	assert.Equal(InvalidArgument, StatusCode(err))
+	w.Close()
+
+	w, err = client.WatchJob(ctx, "missing", 0)
+	require.NoError(t, err)
+	_, err = w.Recv()
+	assert.Equal(NotFound, StatusCode(err))
+	w.Close()
+
+	// watches end with the call's deadline
+	require.NoError(t, q.Put(ctx, newTestJob("blocked", true)))
+	tctx, tcancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer tcancel()
+	w, err = client.WatchJob(tctx, "blocked", 5*time.Millisecond)
+	if err == nil {
+		for err == nil {
+			_, err = w.Recv()
+		}
+		w.Close()
+	}
+	assert.Contains([]Code{DeadlineExceeded, Canceled}, StatusCode(err))
+}
+
+func TestServerRejectsInvalidCalls(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, srv, client := startServer(t, ctx)
+	defer srv.Close()
+
+	// gRPC requires HTTP/2
+	h1 := httptest.NewServer(NewServer(queue.NewLocalLimitedSize(1, 16), ServerOptions{}))
+	defer h1.Close()
+	_, err := NewClient(h1.URL, nil).QueueStats(ctx)
+	assert.Equal(Unknown, StatusCode(err))
+
+	body := &bytes.Buffer{}
+	require.NoError(t, writeFrame(body, &queueStatsRequest{}))
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/"+ServiceName+"/QueueStats", body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(http.StatusUnsupportedMediaType, resp.StatusCode)
+
+	// calls must have a request message
+	req, err = http.NewRequest(http.MethodPost, srv.URL+"/"+ServiceName+"/GetJob", &bytes.Buffer{})
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", contentType)
+	resp, err = srv.Client().Do(req)
+	require.NoError(t, err)
+	st := &clientStream{ctx: ctx, resp: resp}
+	assert.Equal(InvalidArgument, StatusCode(st.recv(&JobStatus{})))
+	st.close()
+
+	_, err = client.GetJob(ctx, "")
+	assert.Equal(NotFound, StatusCode(err))
+}
+
+// grpcCall makes a call with the headers that grpc-go clients send,
+// and a body assembled by hand, and returns the response's messages,
+// its length prefixes removed, and its trailers.
+func grpcCall(t *testing.T, srv *httptest.Server, method string, body []byte, header map[string]string) ([][]byte, http.Header) {
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/bond.queue.v1.QueueService/"+method, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+	req.Header.Set("User-Agent", "grpc-go/1.64.0")
+	req.Header.Set("Grpc-Accept-Encoding", "gzip")
+	req.Header.Set("Grpc-Timeout", "9999878u")
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, 2, resp.ProtoMajor)
+	require.Equal(t, "application/grpc", resp.Header.Get("Content-Type"))
+
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	msgs := [][]byte{}
+	for len(data) > 0 {
+		require.True(t, len(data) >= 5)
+		require.Equal(t, byte(0), data[0], "messages are not compressed")
+		size := int(data[1])<<24 | int(data[2])<<16 | int(data[3])<<8 | int(data[4])
+		require.True(t, len(data) >= 5+size)
+		msgs = append(msgs, data[5:5+size])
+		data = data[5+size:]
+	}
+
+	return msgs, resp.Trailer
+}
+
+func TestServerSpeaksGRPCWireProtocol(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	q, srv, _ := startServer(t, ctx)
+	defer srv.Close()
+
+	require.NoError(t, q.Put(ctx, newTestJob("wire", false)))
+	require.True(t, amboy.WaitInterval(ctx, q, 10*time.Millisecond))
+
+	// GetJobRequest{id: "wire"}: field 1, length-delimited
+	getJob := []byte{0x00, 0x00, 0x00, 0x00, 0x06, 0x0a, 0x04, 'w', 'i', 'r', 'e'}
+	msgs, trailer := grpcCall(t, srv, "GetJob", getJob, nil)
+	assert.Equal("0", trailer.Get("Grpc-Status"))
+	require.Len(t, msgs, 1)
+	// JobStatus starts with its id, field 1
+	assert.Equal([]byte{0x0a, 0x04, 'w', 'i', 'r', 'e'}, msgs[0][:6])
+	stat := &JobStatus{}
+	require.NoError(t, stat.unmarshal(msgs[0]))
+	assert.True(stat.Status.Completed)
+
+	// QueueStatsRequest has no fields, so its message is empty, and
+	// QueueStats{completed: 1, total: 1} are fields 2 and 5
+	msgs, trailer = grpcCall(t, srv, "QueueStats", []byte{0x00, 0x00, 0x00, 0x00, 0x00}, nil)
+	assert.Equal("0", trailer.Get("Grpc-Status"))
+	require.Len(t, msgs, 1)
+	assert.Equal([]byte{0x10, 0x01, 0x28, 0x01}, msgs[0])
+
+	// a stream of a completed job has one status before its status
+	msgs, trailer = grpcCall(t, srv, "WatchJob", getJob, nil)
+	assert.Equal("0", trailer.Get("Grpc-Status"))
+	assert.Len(msgs, 1)
+
+	// errors are trailers, with percent-encoded messages
+	msgs, trailer = grpcCall(t, srv, "GetJob", []byte{0x00, 0x00, 0x00, 0x00, 0x05, 0x0a, 0x03, 'a', '%', 'b'}, nil)
+	assert.Empty(msgs)
+	assert.Equal("5", trailer.Get("Grpc-Status"))
+	assert.Equal("job 'a%25b' does not exist", trailer.Get("Grpc-Message"))
+
+	_, trailer = grpcCall(t, srv, "CancelJob", getJob, nil)
+	assert.Equal("12", trailer.Get("Grpc-Status"))
+
+	compressed := append([]byte{0x01}, getJob[1:]...)
+	_, trailer = grpcCall(t, srv, "GetJob", compressed, map[string]string{"Grpc-Encoding": "gzip"})
+	assert.Equal("12", trailer.Get("Grpc-Status"))
+}
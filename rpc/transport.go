@@ -0,0 +1,118 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MaxMessageSize is the largest message that the server and client
+// accept, which is the default of the gRPC libraries.
+const MaxMessageSize = 4 << 20
+
+const contentType = "application/grpc"
+
+// writeFrame writes the message as a gRPC length-prefixed message,
+// which is never compressed.
+func writeFrame(w io.Writer, m message) error {
+	data := m.marshal()
+
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	frame = append(frame, data...)
+
+	_, err := w.Write(frame)
+	return errors.WithStack(err)
+}
+
+// readFrame reads a gRPC length-prefixed message into the message,
+// returning io.EOF if the stream has no more messages.
+func readFrame(r io.Reader, m message) error {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return err
+		}
+		return statusError(Internal, "problem reading message: %s", err)
+	}
+
+	if header[0] != 0 {
+		return statusError(Unimplemented, "compressed messages are not supported")
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > MaxMessageSize {
+		return statusError(ResourceExhausted, "message of %d bytes is larger than the maximum of %d", size, MaxMessageSize)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return statusError(Internal, "problem reading message: %s", err)
+	}
+
+	if err := m.unmarshal(data); err != nil {
+		return statusError(Internal, "problem decoding message: %s", err)
+	}
+
+	return nil
+}
+
+// validContentType reports whether the content type is a gRPC
+// content type with the protocol buffer codec.
+func validContentType(ct string) bool {
+	if idx := strings.IndexByte(ct, ';'); idx >= 0 {
+		ct = ct[:idx]
+	}
+	ct = strings.TrimSpace(ct)
+
+	return ct == contentType || ct == contentType+"+proto"
+}
+
+var timeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// encodeTimeout formats a timeout for the grpc-timeout header, which
+// allows at most eight digits.
+func encodeTimeout(d time.Duration) string {
+	if d <= 0 {
+		return "0n"
+	}
+
+	for _, unit := range []byte{'n', 'u', 'm', 'S', 'M'} {
+		// round up, so that the server never times out first
+		v := (d + timeoutUnits[unit] - 1) / timeoutUnits[unit]
+		if v < 1e8 {
+			return strconv.FormatInt(int64(v), 10) + string(unit)
+		}
+	}
+
+	return strconv.FormatInt(int64((d+time.Hour-1)/time.Hour), 10) + "H"
+}
+
+func decodeTimeout(s string) (time.Duration, error) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, errors.Errorf("invalid timeout '%s'", s)
+	}
+
+	unit, ok := timeoutUnits[s[len(s)-1]]
+	if !ok {
+		return 0, errors.Errorf("invalid unit of timeout '%s'", s)
+	}
+
+	v, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || v < 0 {
+		return 0, errors.Errorf("invalid timeout '%s'", s)
+	}
+
+	return time.Duration(v) * unit, nil
+}
@@ -0,0 +1,223 @@
+package sharedcache
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+)
+
+// Client is a client for a shared cache server. Clients implement
+// bond.ArtifactSource, so that downloads check the shared cache
+// before the public download servers, and bond.ArtifactSink, so that
+// verified downloads are uploaded to the shared cache:
+//
+//	client := sharedcache.NewClient(base, token, nil)
+//	conf := bond.NewConfig(bond.WithArtifactSource(client), bond.WithArtifactSink(client))
+type Client struct {
+	base   string
+	token  string
+	client *http.Client
+}
+
+// NewClient constructs a client for the server at the base URL. The
+// token, if specified, authenticates the requests. If the http.Client
+// is nil, the client uses http.DefaultClient.
+func NewClient(base, token string, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &Client{
+		base:   strings.TrimRight(base, "/"),
+		token:  token,
+		client: client,
+	}
+}
+
+func (c *Client) newRequest(method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem building request")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	return req, nil
+}
+
+func (c *Client) request(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := c.newRequest(method, path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem requesting %s", req.URL)
+	}
+
+	return resp, nil
+}
+
+func artifactPath(key string) string { return ArtifactsPath + url.PathEscape(key) }
+
+// Stat returns the entry of the archive with the key. The second
+// value is false if the server does not have the archive.
+func (c *Client) Stat(ctx context.Context, key string) (Entry, bool, error) {
+	if err := ValidateKey(key); err != nil {
+		return Entry{}, false, err
+	}
+
+	resp, err := c.request(ctx, http.MethodHead, artifactPath(key), nil)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+		entry := Entry{Key: key, Size: size, SHA256: resp.Header.Get(ChecksumHeader)}
+		if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+			entry.Modified = modified
+		}
+		return entry, true, nil
+	case http.StatusNotFound:
+		return Entry{}, false, nil
+	default:
+		return Entry{}, false, errors.Errorf("shared cache responded to %s with %s", key, resp.Status)
+	}
+}
+
+// Manifest returns the list of the server's archives.
+func (c *Client) Manifest(ctx context.Context) (Manifest, error) {
+	out := Manifest{}
+	resp, err := c.request(ctx, http.MethodGet, ManifestPath, nil)
+	if err != nil {
+		return out, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return out, errors.Errorf("shared cache responded to manifest request with %s", resp.Status)
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&out)
+	return out, errors.Wrap(err, "problem parsing manifest")
+}
+
+// FetchArtifact downloads the archive with the key into the file, and
+// returns false, without an error, if the server does not have it.
+// The archive is written to a temporary file that's renamed into
+// place once it's complete and matches the checksum that the server
+// reports, so a failed download does not leave a partial file.
+func (c *Client) FetchArtifact(ctx context.Context, key, fileName string) (bool, error) {
+	if err := ValidateKey(key); err != nil {
+		return false, err
+	}
+
+	resp, err := c.request(ctx, http.MethodGet, artifactPath(key), nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, errors.Errorf("shared cache responded to %s with %s", key, resp.Status)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return false, errors.Wrapf(err, "problem creating enclosing directory for %s", fileName)
+	}
+
+	tmp := fileName + ".shared"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return false, errors.Wrapf(err, "problem creating %s", tmp)
+	}
+	defer os.Remove(tmp)
+
+	_, err = io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "problem downloading %s from shared cache", key)
+	}
+
+	if sum := resp.Header.Get(ChecksumHeader); sum != "" {
+		if _, err = bond.VerifyFile(tmp, []bond.Checksum{{Algorithm: bond.SHA256, Value: sum}}); err != nil {
+			return false, err
+		}
+	}
+
+	if err = os.Rename(tmp, fileName); err != nil {
+		return false, errors.Wrapf(err, "problem renaming %s", tmp)
+	}
+
+	return true, nil
+}
+
+// Upload adds the archive in the file to the server with the key,
+// unless the server already has it.
+func (c *Client) Upload(ctx context.Context, key, fileName string) error {
+	if _, ok, err := c.Stat(ctx, key); err != nil || ok {
+		return err
+	}
+
+	sum, err := bond.FileChecksum(fileName, bond.SHA256)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return errors.Wrapf(err, "problem opening %s", fileName)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "problem finding size of %s", fileName)
+	}
+
+	req, err := c.newRequest(http.MethodPut, artifactPath(key), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	req.Header.Set(ChecksumHeader, sum.Value)
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "problem uploading %s", key)
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	default:
+		return errors.Errorf("shared cache responded to upload of %s with %s", key, resp.Status)
+	}
+}
+
+// StoreArtifact implements bond.ArtifactSink with Upload.
+func (c *Client) StoreArtifact(ctx context.Context, key, fileName string) error {
+	return c.Upload(ctx, key, fileName)
+}
@@ -0,0 +1,160 @@
+package sharedcache
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond"
+)
+
+const testKey = "mongodb-linux-x86_64-ubuntu2204-7.0.2.tgz"
+
+func newTestServer(sum string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.URL.Path == ManifestPath:
+			_ = json.NewEncoder(w).Encode(Manifest{Artifacts: []Entry{{Key: testKey, Size: 7, SHA256: sum}}})
+		case r.URL.Path == ArtifactsPath+testKey:
+			w.Header().Set(ChecksumHeader, sum)
+			w.Header().Set("Content-Length", "7")
+			_, _ = w.Write([]byte("archive"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestValidateKey(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(ValidateKey(testKey))
+	assert.NoError(ValidateKey("mongodb-windows-x86_64-7.0.2.zip"))
+	for _, key := range []string{"", "../full.json", "linux/a.tgz", ".bond-last-gc", "full.json", `..\a.tgz`} {
+		assert.Error(ValidateKey(key), key)
+	}
+}
+
+func TestClient(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "sharedcache-client")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sum, err := bond.FileChecksum(writeFile(t, dir, "expected", "archive"), bond.SHA256)
+	require.NoError(t, err)
+
+	srv := newTestServer(sum.Value)
+	defer srv.Close()
+	client := NewClient(srv.URL+"/", "secret", nil)
+
+	entry, ok, err := client.Stat(ctx, testKey)
+	require.NoError(t, err)
+	assert.True(ok)
+	assert.Equal(int64(7), entry.Size)
+	assert.Equal(sum.Value, entry.SHA256)
+
+	_, ok, err = client.Stat(ctx, "mongodb-linux-x86_64-ubuntu2204-6.0.9.tgz")
+	require.NoError(t, err)
+	assert.False(ok)
+
+	m, err := client.Manifest(ctx)
+	require.NoError(t, err)
+	require.Len(t, m.Artifacts, 1)
+	assert.Equal(testKey, m.Artifacts[0].Key)
+
+	fn := filepath.Join(dir, testKey)
+	ok, err = client.FetchArtifact(ctx, testKey, fn)
+	require.NoError(t, err)
+	assert.True(ok)
+	data, err := ioutil.ReadFile(fn)
+	require.NoError(t, err)
+	assert.Equal("archive", string(data))
+
+	ok, err = client.FetchArtifact(ctx, "mongodb-linux-x86_64-ubuntu2204-6.0.9.tgz", filepath.Join(dir, "missing.tgz"))
+	require.NoError(t, err)
+	assert.False(ok)
+
+	_, _, err = NewClient(srv.URL, "wrong", nil).Stat(ctx, testKey)
+	assert.Error(err)
+	_, err = NewClient(srv.URL, "", nil).Manifest(ctx)
+	assert.Error(err)
+}
+
+func TestClientRejectsCorruptArtifacts(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "sharedcache-client")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	srv := newTestServer(strings.Repeat("0", 64))
+	defer srv.Close()
+
+	fn := filepath.Join(dir, testKey)
+	ok, err := NewClient(srv.URL, "secret", nil).FetchArtifact(context.Background(), testKey, fn)
+	assert.Error(err)
+	assert.False(ok)
+	contents, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(contents, 0)
+}
+
+func TestClientAsArtifactSource(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "sharedcache-source")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("from the cdn"))
+	}))
+	defer cdn.Close()
+	shared := newTestServer("")
+	defer shared.Close()
+
+	conf := bond.NewConfig(bond.WithArtifactSource(NewClient(shared.URL, "secret", nil)))
+
+	hit := filepath.Join(dir, testKey)
+	require.NoError(t, conf.DownloadFile(ctx, cdn.URL+"/"+testKey, hit))
+	data, err := ioutil.ReadFile(hit)
+	require.NoError(t, err)
+	assert.Equal("archive", string(data))
+
+	miss := filepath.Join(dir, "mongodb-linux-x86_64-ubuntu2204-6.0.9.tgz")
+	require.NoError(t, conf.ResumeDownloadFile(ctx, cdn.URL+"/"+filepath.Base(miss), miss, nil))
+	data, err = ioutil.ReadFile(miss)
+	require.NoError(t, err)
+	assert.Equal("from the cdn", string(data))
+
+	// a shared cache that fails does not fail the download
+	conf = bond.NewConfig(bond.WithArtifactSource(NewClient(shared.URL, "wrong", nil)))
+	fallback := filepath.Join(dir, "fallback", testKey)
+	require.NoError(t, conf.DownloadFile(ctx, cdn.URL+"/"+testKey, fallback))
+	data, err = ioutil.ReadFile(fallback)
+	require.NoError(t, err)
+	assert.Equal("from the cdn", string(data))
+}
+
+func writeFile(t *testing.T, dir, name, contents string) string {
+	fn := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(fn, []byte(contents), 0644))
+	return fn
+}
@@ -0,0 +1,238 @@
+package sharedcache
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+)
+
+// DefaultPeerRefresh is how long a PeerSource reuses the manifests of
+// its peers, when its options do not specify a refresh interval.
+const DefaultPeerRefresh = time.Minute
+
+// PeerOptions configure a PeerSource.
+type PeerOptions struct {
+	// Peers are the base URLs of the shared cache servers of the
+	// other agents (e.g. the "recall serve-cache" of each CI
+	// agent).
+	Peers []string `bson:"peers" json:"peers" yaml:"peers"`
+	// Token, if specified, authenticates the requests to every
+	// peer.
+	Token string `bson:"-" json:"-" yaml:"-"`
+	// Refresh is how long the manifests of peers are reused
+	// before they're requested again, and defaults to
+	// DefaultPeerRefresh. Peers that fail are skipped until their
+	// next refresh.
+	Refresh time.Duration `bson:"refresh" json:"refresh" yaml:"refresh"`
+	// Client, if specified, makes the requests to peers.
+	Client *http.Client `bson:"-" json:"-" yaml:"-"`
+}
+
+// Validate returns an error if the options are not valid.
+func (o PeerOptions) Validate() error {
+	catcher := grip.NewBasicCatcher()
+	catcher.NewWhen(len(o.Peers) == 0, "must specify at least one peer")
+	catcher.NewWhen(o.Refresh < 0, "peer refresh interval must not be negative")
+	for _, base := range o.Peers {
+		u, err := url.Parse(base)
+		catcher.ErrorfWhen(err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https"),
+			"peer '%s' is not an http(s) URL", base)
+	}
+
+	return catcher.Resolve()
+}
+
+// PeerSource is an experimental bond.ArtifactSource that fetches
+// archives from the caches of other agents, such as the agents of a
+// CI fleet, each of which serves its cache with a shared cache
+// Server. The source learns which archives each peer has from the
+// peers' manifests, and fetches an archive from the first peer that
+// has it, preferring peers on the local network (with private or
+// loopback addresses) to other peers, so that a fleet downloads each
+// archive from the download servers about once.
+//
+// Archives are only fetched from peers whose manifests have their
+// checksums, and must match them, so a peer with a corrupt archive
+// does not pass it on; the jobs that download archives also verify
+// them against the feed's checksums. When no peer has an archive, or
+// every fetch fails, FetchArtifact returns false, without an error,
+// and the archive is downloaded from its URL.
+type PeerSource struct {
+	refresh time.Duration
+	peers   []*peer
+}
+
+type peer struct {
+	client *Client
+	base   string
+	local  bool
+
+	mutex     sync.Mutex
+	manifest  map[string]Entry
+	refreshed time.Time
+}
+
+// NewPeerSource builds a source for the peers of the options.
+func NewPeerSource(opts PeerOptions) (*PeerSource, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid peer options")
+	}
+	if opts.Refresh == 0 {
+		opts.Refresh = DefaultPeerRefresh
+	}
+
+	s := &PeerSource{refresh: opts.Refresh}
+	for _, base := range opts.Peers {
+		s.peers = append(s.peers, &peer{
+			client: NewClient(base, opts.Token, opts.Client),
+			base:   base,
+			local:  isLocalPeer(base),
+		})
+	}
+	sort.SliceStable(s.peers, func(i, j int) bool { return s.peers[i].local && !s.peers[j].local })
+
+	return s, nil
+}
+
+// Peers returns the base URLs of the source's peers, in the order
+// that they're tried: peers on the local network first.
+func (s *PeerSource) Peers() []string {
+	out := make([]string, 0, len(s.peers))
+	for _, p := range s.peers {
+		out = append(out, p.base)
+	}
+
+	return out
+}
+
+// FetchArtifact fetches the archive with the key into the file from
+// the first peer that has it, and returns false if none does.
+func (s *PeerSource) FetchArtifact(ctx context.Context, key, fileName string) (bool, error) {
+	if err := ValidateKey(key); err != nil {
+		return false, err
+	}
+
+	for _, p := range s.peers {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+
+		entry, ok := p.lookup(ctx, key, s.refresh)
+		if !ok || entry.SHA256 == "" {
+			continue
+		}
+
+		if err := p.fetch(ctx, entry, fileName); err != nil {
+			grip.Warning(message.WrapError(err, message.Fields{
+				"message": "problem fetching archive from peer",
+				"key":     key,
+				"peer":    p.base,
+			}))
+			continue
+		}
+
+		grip.Info(message.Fields{
+			"message": "fetched archive from peer",
+			"key":     key,
+			"peer":    p.base,
+			"size":    entry.Size,
+			"local":   p.local,
+		})
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// lookup returns the peer's entry for the key, requesting the peer's
+// manifest if the manifest is older than the refresh interval.
+func (p *peer) lookup(ctx context.Context, key string, refresh time.Duration) (Entry, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if time.Since(p.refreshed) > refresh {
+		p.refreshed = time.Now()
+		m, err := p.client.Manifest(ctx)
+		if err != nil {
+			// skip the peer until the next refresh
+			p.manifest = nil
+			grip.Debug(message.WrapError(err, message.Fields{
+				"message": "problem requesting manifest of peer",
+				"peer":    p.base,
+			}))
+			return Entry{}, false
+		}
+
+		p.manifest = make(map[string]Entry, len(m.Artifacts))
+		for _, entry := range m.Artifacts {
+			p.manifest[entry.Key] = entry
+		}
+	}
+
+	entry, ok := p.manifest[key]
+	return entry, ok
+}
+
+// fetch downloads the archive from the peer, and removes it unless it
+// matches the size and checksum of the peer's manifest.
+func (p *peer) fetch(ctx context.Context, entry Entry, fileName string) error {
+	ok, err := p.client.FetchArtifact(ctx, entry.Key, fileName)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.Errorf("peer no longer has %s", entry.Key)
+	}
+
+	info, err := os.Stat(fileName)
+	if err == nil && info.Size() != entry.Size {
+		err = errors.Errorf("%s is %d bytes, but the peer's manifest has %d", entry.Key, info.Size(), entry.Size)
+	}
+	if err == nil {
+		_, err = bond.VerifyFile(fileName, []bond.Checksum{{Algorithm: bond.SHA256, Value: entry.SHA256}})
+	}
+	if err != nil {
+		grip.Warning(os.Remove(fileName))
+		return errors.Wrapf(err, "archive from peer %s does not match its manifest", p.base)
+	}
+
+	return nil
+}
+
+// isLocalPeer reports whether the host of the peer's URL is on the
+// local network: a loopback, private, or link-local address, or a
+// name that resolves to one.
+func isLocalPeer(base string) bool {
+	u, err := url.Parse(base)
+	if err != nil {
+		return false
+	}
+
+	host := u.Hostname()
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		addrs, err := net.LookupIP(host)
+		if err != nil {
+			return false
+		}
+		ips = addrs
+	}
+
+	for _, ip := range ips {
+		if !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() {
+			return false
+		}
+	}
+
+	return len(ips) > 0
+}
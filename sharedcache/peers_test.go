@@ -0,0 +1,95 @@
+package sharedcache
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerOptionsValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error(PeerOptions{}.Validate())
+	assert.Error(PeerOptions{Peers: []string{"agent-2:8080"}}.Validate())
+	assert.Error(PeerOptions{Peers: []string{"ftp://agent-2"}}.Validate())
+	assert.Error(PeerOptions{Peers: []string{"http://agent-2"}, Refresh: -1}.Validate())
+	assert.NoError(PeerOptions{Peers: []string{"http://agent-2:8080", "https://agent-3"}}.Validate())
+}
+
+func TestPeerSourcePrefersLocalPeers(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(isLocalPeer("http://127.0.0.1:8080"))
+	assert.True(isLocalPeer("http://10.1.2.3"))
+	assert.True(isLocalPeer("http://[fe80::1]:8080"))
+	assert.False(isLocalPeer("http://8.8.8.8"))
+
+	s, err := NewPeerSource(PeerOptions{Peers: []string{"http://8.8.8.8:8080", "http://192.168.1.5:8080", "http://1.1.1.1"}})
+	require.NoError(t, err)
+	assert.Equal([]string{"http://192.168.1.5:8080", "http://8.8.8.8:8080", "http://1.1.1.1"}, s.Peers())
+}
+
+func TestPeerSourceFetchesVerifiedArchives(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "sharedcache-peers")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// a peer whose copy of the archive does not match its manifest
+	var manifests int32
+	corrupt := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == ManifestPath {
+			atomic.AddInt32(&manifests, 1)
+			_ = json.NewEncoder(w).Encode(Manifest{Artifacts: []Entry{{Key: testKey, Size: 7, SHA256: "0000"}}})
+			return
+		}
+		_, _ = w.Write([]byte("corrupt"))
+	}))
+	defer corrupt.Close()
+
+	peerDir := filepath.Join(dir, "peer")
+	require.NoError(t, os.Mkdir(peerDir, 0755))
+	writeFile(t, peerDir, testKey, "archive")
+	healthy := httptest.NewServer(NewServer(peerDir, ServerOptions{Token: "secret"}).Handler())
+	defer healthy.Close()
+
+	s, err := NewPeerSource(PeerOptions{Peers: []string{corrupt.URL, healthy.URL}, Token: "secret"})
+	require.NoError(t, err)
+
+	fn := filepath.Join(dir, "cache", testKey)
+	ok, err := s.FetchArtifact(ctx, testKey, fn)
+	require.NoError(t, err)
+	assert.True(ok)
+	data, err := ioutil.ReadFile(fn)
+	require.NoError(t, err)
+	assert.Equal("archive", string(data))
+
+	// manifests are reused, and archives that no peer has are
+	// downloaded from their URLs
+	ok, err = s.FetchArtifact(ctx, "mongodb-linux-x86_64-ubuntu2204-6.0.9.tgz", filepath.Join(dir, "cache", "missing.tgz"))
+	require.NoError(t, err)
+	assert.False(ok)
+	assert.Equal(int32(1), atomic.LoadInt32(&manifests))
+
+	_, err = s.FetchArtifact(ctx, "../full.json", fn)
+	assert.Error(err)
+
+	// peers that fail are skipped
+	healthy.Close()
+	s, err = NewPeerSource(PeerOptions{Peers: []string{healthy.URL}})
+	require.NoError(t, err)
+	ok, err = s.FetchArtifact(ctx, testKey, filepath.Join(dir, "other", testKey))
+	assert.NoError(err)
+	assert.False(ok)
+}
@@ -0,0 +1,70 @@
+/*
+Package sharedcache implements a small HTTP protocol for sharing a
+bond cache between machines, so that a team's bond instances download
+each archive from the public download servers once, and from a cache
+server on their network after that.
+
+Archives are identified by keys, which are their file names in a
+cache (e.g. mongodb-linux-x86_64-ubuntu2204-7.0.2.tgz). The protocol
+has four requests, all under a base URL:
+
+	HEAD <base>/artifacts/<key>   200 with the size and checksum headers, or 404
+	GET  <base>/artifacts/<key>   200 (or 206 for a range) with the archive, or 404
+	PUT  <base>/artifacts/<key>   201 when the archive is added, 200 if the cache has it,
+	                              or 403 if the server does not accept uploads
+	GET  <base>/manifest          200 with a JSON Manifest of the cache's archives
+
+Uploads may send the archive's checksum in the checksum header, and
+servers reject uploads that do not match it.
+
+Servers that require authentication accept a bearer token in the
+Authorization header, and respond with 401 to requests without it.
+
+Client implements the protocol, and is a bond.ArtifactSource and
+bond.ArtifactSink; Server serves a bond cache directory over it.
+*/
+package sharedcache
+
+import (
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The paths of the protocol's requests, relative to the base URL.
+const (
+	ArtifactsPath = "/artifacts/"
+	ManifestPath  = "/manifest"
+)
+
+// ChecksumHeader is the header of artifact responses that holds the
+// SHA256 checksum of the archive, when the server knows it.
+const ChecksumHeader = "X-Bond-Sha256"
+
+// Entry describes an archive in a shared cache.
+type Entry struct {
+	Key      string    `bson:"key" json:"key" yaml:"key"`
+	Size     int64     `bson:"size" json:"size" yaml:"size"`
+	SHA256   string    `bson:"sha256,omitempty" json:"sha256,omitempty" yaml:"sha256,omitempty"`
+	Modified time.Time `bson:"modified" json:"modified" yaml:"modified"`
+}
+
+// Manifest lists the archives in a shared cache.
+type Manifest struct {
+	Artifacts []Entry `bson:"artifacts" json:"artifacts" yaml:"artifacts"`
+}
+
+// ValidateKey returns an error if the key is not the file name of an
+// archive, so that keys cannot refer to other files of a cache.
+func ValidateKey(key string) error {
+	switch {
+	case key == "" || key != path.Base(key) || strings.ContainsAny(key, `/\`) || strings.HasPrefix(key, "."):
+		return errors.Errorf("'%s' is not a valid artifact key", key)
+	case !strings.HasSuffix(key, ".tgz") && !strings.HasSuffix(key, ".zip"):
+		return errors.Errorf("'%s' is not an archive", key)
+	}
+
+	return nil
+}
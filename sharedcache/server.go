@@ -0,0 +1,287 @@
+package sharedcache
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond"
+)
+
+// DefaultMaxUploadSize is the size limit of uploads to a server that
+// does not specify one.
+const DefaultMaxUploadSize = 4 << 30
+
+// ServerOptions configure a Server.
+type ServerOptions struct {
+	// Token, if specified, is the bearer token that requests must
+	// present.
+	Token string `bson:"-" json:"-" yaml:"-"`
+	// AllowUploads accepts the archives that clients upload.
+	AllowUploads bool `bson:"allow_uploads" json:"allow_uploads" yaml:"allow_uploads"`
+	// MaxUploadSize limits the size of uploads, and defaults to
+	// DefaultMaxUploadSize.
+	MaxUploadSize int64 `bson:"max_upload_size" json:"max_upload_size" yaml:"max_upload_size"`
+}
+
+// Server serves the archives of a bond cache directory over the
+// shared cache protocol. Servers are safe for concurrent use.
+type Server struct {
+	path string
+	opts ServerOptions
+
+	// sums caches the checksums of archives, which are only
+	// computed again when an archive's size or modification time
+	// changes.
+	mutex sync.Mutex
+	sums  map[string]cachedSum
+}
+
+type cachedSum struct {
+	size     int64
+	modified time.Time
+	value    string
+}
+
+// NewServer constructs a server for the cache directory.
+func NewServer(path string, opts ServerOptions) *Server {
+	if opts.MaxUploadSize <= 0 {
+		opts.MaxUploadSize = DefaultMaxUploadSize
+	}
+
+	return &Server{path: path, opts: opts, sums: map[string]cachedSum{}}
+}
+
+// Handler returns an http.Handler for the server's endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	s.AttachRoutes(mux, "")
+	return mux
+}
+
+// AttachRoutes registers the server's endpoints on an existing mux,
+// under the specified prefix (which may be empty).
+func (s *Server) AttachRoutes(mux *http.ServeMux, prefix string) {
+	prefix = strings.TrimRight(prefix, "/")
+
+	mux.HandleFunc(prefix+ManifestPath, s.authorized(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s is not supported", r.Method))
+			return
+		}
+		s.Manifest(w, r)
+	}))
+	mux.HandleFunc(prefix+ArtifactsPath, s.authorized(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, prefix+ArtifactsPath)
+		if err := ValidateKey(key); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			s.Artifact(w, r, key)
+		case http.MethodPut:
+			s.Upload(w, r, key)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, errors.Errorf("method %s is not supported", r.Method))
+		}
+	}))
+}
+
+func (s *Server) authorized(h http.HandlerFunc) http.HandlerFunc {
+	if s.opts.Token == "" {
+		return h
+	}
+
+	expected := []byte("Bearer " + s.opts.Token)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="bond"`)
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// Manifest writes the manifest of the cache's archives.
+func (s *Server) Manifest(w http.ResponseWriter, r *http.Request) {
+	contents, err := ioutil.ReadDir(s.path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errors.Wrapf(err, "problem reading %s", s.path))
+		return
+	}
+
+	out := Manifest{Artifacts: []Entry{}}
+	for _, info := range contents {
+		if ValidateKey(info.Name()) != nil {
+			continue
+		}
+
+		entry, err := s.entry(info.Name())
+		if err != nil {
+			grip.Warning(message.WrapError(err, message.Fields{
+				"message": "problem describing archive",
+				"key":     info.Name(),
+			}))
+			continue
+		}
+		out.Artifacts = append(out.Artifacts, entry)
+	}
+	sort.Slice(out.Artifacts, func(i, j int) bool { return out.Artifacts[i].Key < out.Artifacts[j].Key })
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// Artifact serves the archive with the key, with support for range
+// and conditional requests.
+func (s *Server) Artifact(w http.ResponseWriter, r *http.Request, key string) {
+	entry, err := s.entry(key)
+	if os.IsNotExist(errors.Cause(err)) {
+		writeError(w, http.StatusNotFound, errors.Errorf("%s is not in the cache", key))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	f, err := os.Open(filepath.Join(s.path, key))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errors.Wrapf(err, "problem opening %s", key))
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set(ChecksumHeader, entry.SHA256)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("ETag", fmt.Sprintf("%q", entry.SHA256))
+	http.ServeContent(w, r, key, entry.Modified, f)
+}
+
+// Upload adds an uploaded archive to the cache, if the server accepts
+// uploads. The archive is written to a temporary file, checked
+// against the checksum header, if the client sends one, and renamed
+// into place. Uploads of archives that the cache has succeed without
+// replacing them.
+func (s *Server) Upload(w http.ResponseWriter, r *http.Request, key string) {
+	if !s.opts.AllowUploads {
+		writeError(w, http.StatusForbidden, errors.New("the shared cache does not accept uploads"))
+		return
+	}
+
+	fn := filepath.Join(s.path, key)
+	if _, err := os.Stat(fn); err == nil {
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(r.Body, s.opts.MaxUploadSize))
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.ContentLength > s.opts.MaxUploadSize {
+		writeError(w, http.StatusRequestEntityTooLarge, errors.Errorf("uploads are limited to %d bytes", s.opts.MaxUploadSize))
+		return
+	}
+
+	tmp, err := ioutil.TempFile(s.path, "."+key+".upload-")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, errors.Wrap(err, "problem creating upload"))
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, io.LimitReader(r.Body, s.opts.MaxUploadSize+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	switch {
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, errors.Wrapf(err, "problem writing %s", key))
+		return
+	case n > s.opts.MaxUploadSize:
+		writeError(w, http.StatusRequestEntityTooLarge, errors.Errorf("uploads are limited to %d bytes", s.opts.MaxUploadSize))
+		return
+	case n == 0:
+		writeError(w, http.StatusBadRequest, errors.Errorf("upload of %s is empty", key))
+		return
+	}
+
+	if sum := r.Header.Get(ChecksumHeader); sum != "" {
+		if _, err = bond.VerifyFile(tmp.Name(), []bond.Checksum{{Algorithm: bond.SHA256, Value: sum}}); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		writeError(w, http.StatusInternalServerError, errors.Wrapf(err, "problem writing %s", key))
+		return
+	}
+	if err = os.Rename(tmp.Name(), fn); err != nil {
+		writeError(w, http.StatusInternalServerError, errors.Wrapf(err, "problem adding %s", key))
+		return
+	}
+
+	grip.Info(message.Fields{
+		"message": "added uploaded archive to shared cache",
+		"key":     key,
+		"size":    n,
+		"remote":  r.RemoteAddr,
+	})
+	w.WriteHeader(http.StatusCreated)
+}
+
+// entry describes the archive, computing its checksum if it's not
+// cached.
+func (s *Server) entry(key string) (Entry, error) {
+	fn := filepath.Join(s.path, key)
+	info, err := os.Stat(fn)
+	if err != nil {
+		return Entry{}, errors.WithStack(err)
+	}
+	if info.IsDir() {
+		return Entry{}, errors.WithStack(os.ErrNotExist)
+	}
+
+	out := Entry{Key: key, Size: info.Size(), Modified: info.ModTime()}
+
+	s.mutex.Lock()
+	cached, ok := s.sums[key]
+	s.mutex.Unlock()
+	if ok && cached.size == out.Size && cached.modified.Equal(out.Modified) {
+		out.SHA256 = cached.value
+		return out, nil
+	}
+
+	sum, err := bond.FileChecksum(fn, bond.SHA256)
+	if err != nil {
+		return Entry{}, err
+	}
+	out.SHA256 = sum.Value
+
+	s.mutex.Lock()
+	s.sums[key] = cachedSum{size: out.Size, modified: out.Modified, value: sum.Value}
+	s.mutex.Unlock()
+
+	return out, nil
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{Error: err.Error()})
+}
@@ -0,0 +1,196 @@
+package sharedcache
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond"
+)
+
+func TestServer(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "sharedcache-server")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sum, err := bond.FileChecksum(writeFile(t, dir, testKey, "archive"), bond.SHA256)
+	require.NoError(t, err)
+	writeFile(t, dir, "full.json", "{}")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "mongodb-linux-x86_64-ubuntu2204-7.0.2"), 0755))
+
+	srv := httptest.NewServer(NewServer(dir, ServerOptions{Token: "secret"}).Handler())
+	defer srv.Close()
+	client := NewClient(srv.URL, "secret", nil)
+
+	entry, ok, err := client.Stat(ctx, testKey)
+	require.NoError(t, err)
+	assert.True(ok)
+	assert.Equal(int64(7), entry.Size)
+	assert.Equal(sum.Value, entry.SHA256)
+	assert.False(entry.Modified.IsZero())
+
+	_, ok, err = client.Stat(ctx, "mongodb-linux-x86_64-ubuntu2204-6.0.9.tgz")
+	require.NoError(t, err)
+	assert.False(ok)
+
+	m, err := client.Manifest(ctx)
+	require.NoError(t, err)
+	require.Len(t, m.Artifacts, 1)
+	assert.Equal(testKey, m.Artifacts[0].Key)
+	assert.Equal(sum.Value, m.Artifacts[0].SHA256)
+
+	fn := filepath.Join(dir, "downloads", testKey)
+	ok, err = client.FetchArtifact(ctx, testKey, fn)
+	require.NoError(t, err)
+	assert.True(ok)
+	data, err := ioutil.ReadFile(fn)
+	require.NoError(t, err)
+	assert.Equal("archive", string(data))
+
+	// uploads are rejected unless the server accepts them
+	assert.Error(client.Upload(ctx, "mongodb-linux-x86_64-ubuntu2204-6.0.9.tgz", fn))
+
+	_, _, err = NewClient(srv.URL, "wrong", nil).Stat(ctx, testKey)
+	assert.Error(err)
+	_, err = NewClient(srv.URL, "", nil).Manifest(ctx)
+	assert.Error(err)
+}
+
+func TestServerRanges(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "sharedcache-server")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeFile(t, dir, testKey, "archive")
+
+	srv := httptest.NewServer(NewServer(dir, ServerOptions{}).Handler())
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+ArtifactsPath+testKey, nil)
+	require.NoError(t, err)
+	req.Header.Set("Range", "bytes=3-")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(http.StatusPartialContent, resp.StatusCode)
+	assert.Equal("hive", string(data))
+	assert.NotEmpty(resp.Header.Get(ChecksumHeader))
+
+	for path, code := range map[string]int{
+		ArtifactsPath + "full.json":   http.StatusBadRequest,
+		ArtifactsPath + ".tgz":        http.StatusBadRequest,
+		ArtifactsPath + "missing.tgz": http.StatusNotFound,
+	} {
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(code, resp.StatusCode, path)
+	}
+
+	resp, err = http.Post(srv.URL+ManifestPath, "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestServerUploads(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "sharedcache-server")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	srcDir := filepath.Join(dir, "src")
+	cacheDir := filepath.Join(dir, "cache")
+	require.NoError(t, os.Mkdir(srcDir, 0755))
+	require.NoError(t, os.Mkdir(cacheDir, 0755))
+
+	srv := httptest.NewServer(NewServer(cacheDir, ServerOptions{Token: "secret", AllowUploads: true, MaxUploadSize: 16}).Handler())
+	defer srv.Close()
+	client := NewClient(srv.URL, "secret", nil)
+
+	fn := writeFile(t, srcDir, testKey, "archive")
+	require.NoError(t, client.Upload(ctx, testKey, fn))
+	data, err := ioutil.ReadFile(filepath.Join(cacheDir, testKey))
+	require.NoError(t, err)
+	assert.Equal("archive", string(data))
+
+	// uploading an archive that the cache has does not replace it
+	require.NoError(t, ioutil.WriteFile(fn, []byte("changed"), 0644))
+	require.NoError(t, client.StoreArtifact(ctx, testKey, fn))
+	data, err = ioutil.ReadFile(filepath.Join(cacheDir, testKey))
+	require.NoError(t, err)
+	assert.Equal("archive", string(data))
+
+	// uploads that are too large or don't match their checksums
+	// are rejected, and do not leave files in the cache
+	large := writeFile(t, srcDir, "mongodb-linux-x86_64-ubuntu2204-6.0.9.tgz", strings.Repeat("a", 17))
+	assert.Error(client.Upload(ctx, filepath.Base(large), large))
+
+	req, err := http.NewRequest(http.MethodPut, srv.URL+ArtifactsPath+"mongodb-linux-x86_64-ubuntu2204-5.0.1.tgz", bytes.NewBufferString("archive"))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set(ChecksumHeader, strings.Repeat("0", 64))
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	contents, err := ioutil.ReadDir(cacheDir)
+	require.NoError(t, err)
+	require.Len(t, contents, 1)
+	assert.Equal(testKey, contents[0].Name())
+}
+
+func TestServerAsArtifactSink(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "sharedcache-sink")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cacheDir := filepath.Join(dir, "cache")
+	require.NoError(t, os.Mkdir(cacheDir, 0755))
+
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("from the cdn"))
+	}))
+	defer cdn.Close()
+	shared := httptest.NewServer(NewServer(cacheDir, ServerOptions{AllowUploads: true}).Handler())
+	defer shared.Close()
+
+	client := NewClient(shared.URL, "", nil)
+	conf := bond.NewConfig(bond.WithArtifactSource(client), bond.WithArtifactSink(client))
+
+	// a miss downloads from the cdn, and the download is stored
+	// in the shared cache, where the next machine finds it
+	fn := filepath.Join(dir, "first", testKey)
+	require.NoError(t, conf.DownloadFile(ctx, cdn.URL+"/"+testKey, fn))
+	conf.StoreArtifact(ctx, fn)
+
+	_, ok, err := client.Stat(ctx, testKey)
+	require.NoError(t, err)
+	assert.True(ok)
+
+	cdn.Close()
+	next := filepath.Join(dir, "second", testKey)
+	require.NoError(t, conf.DownloadFile(ctx, cdn.URL+"/"+testKey, next))
+	data, err := ioutil.ReadFile(next)
+	require.NoError(t, err)
+	assert.Equal("from the cdn", string(data))
+}
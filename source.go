@@ -0,0 +1,108 @@
+package bond
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/message"
+)
+
+// ArtifactSource is a source of archives, such as a cache that a team
+// shares, that a Config checks before downloading an archive from its
+// URL. Archives are identified by their file names in the cache.
+type ArtifactSource interface {
+	// FetchArtifact writes the archive with the key to the file,
+	// and returns false, without an error, if the source does not
+	// have the archive.
+	FetchArtifact(ctx context.Context, key, fileName string) (bool, error)
+}
+
+// ArtifactSink is a destination for downloaded archives, such as a
+// cache that a team shares, so that other machines can fetch them
+// from it.
+type ArtifactSink interface {
+	// StoreArtifact adds the archive in the file to the sink with
+	// the key.
+	StoreArtifact(ctx context.Context, key, fileName string) error
+}
+
+// ChainSources returns a source that fetches archives from the first
+// of the sources that has them, such as the caches of peers and then
+// a shared cache. A source that fails does not stop the chain; the
+// errors are returned if no source has the archive.
+func ChainSources(sources ...ArtifactSource) ArtifactSource { return sourceChain(sources) }
+
+type sourceChain []ArtifactSource
+
+func (c sourceChain) FetchArtifact(ctx context.Context, key, fileName string) (bool, error) {
+	catcher := grip.NewBasicCatcher()
+	for _, src := range c {
+		ok, err := src.FetchArtifact(ctx, key, fileName)
+		if err != nil {
+			catcher.Add(err)
+			_ = os.Remove(fileName)
+			continue
+		}
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, catcher.Resolve()
+}
+
+// WithArtifactSource sets a source that downloads check before the
+// archive's URL.
+func WithArtifactSource(src ArtifactSource) Option {
+	return func(c *Config) { c.Source = src }
+}
+
+// WithArtifactSink sets a sink that receives verified downloads.
+func WithArtifactSink(sink ArtifactSink) Option {
+	return func(c *Config) { c.Sink = sink }
+}
+
+// StoreArtifact adds a downloaded, verified archive to the Config's
+// sink, if it has one. Problems with the sink are logged, rather than
+// returned, because they do not affect the download.
+func (c *Config) StoreArtifact(ctx context.Context, fileName string) {
+	if c == nil || c.Sink == nil {
+		return
+	}
+
+	key := filepath.Base(fileName)
+	grip.Warning(message.WrapError(c.Sink.StoreArtifact(ctx, key, fileName), message.Fields{
+		"message": "problem storing archive in sink",
+		"key":     key,
+	}))
+}
+
+// fetchFromSource fetches the file from the Config's source, if it
+// has one, and reports whether it did. Problems with the source are
+// logged, so that the download falls back to the archive's URL.
+func (c *Config) fetchFromSource(ctx context.Context, url, fileName string) bool {
+	if c == nil || c.Source == nil {
+		return false
+	}
+
+	key := filepath.Base(fileName)
+	ok, err := c.Source.FetchArtifact(ctx, key, fileName)
+	if err != nil {
+		grip.Warning(message.WrapError(err, message.Fields{
+			"message": "problem fetching archive from source, downloading it instead",
+			"key":     key,
+			"url":     url,
+		}))
+		_ = os.Remove(fileName)
+		return false
+	}
+
+	grip.DebugWhen(ok, message.Fields{
+		"message": "fetched archive from source",
+		"key":     key,
+	})
+
+	return ok
+}
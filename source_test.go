@@ -0,0 +1,39 @@
+package bond
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSource struct {
+	ok  bool
+	err error
+}
+
+func (s fakeSource) FetchArtifact(ctx context.Context, key, fileName string) (bool, error) {
+	return s.ok, s.err
+}
+
+func TestChainSources(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	ok, err := ChainSources(fakeSource{}, fakeSource{ok: true}).FetchArtifact(ctx, "a.tgz", "x")
+	assert.NoError(err)
+	assert.True(ok)
+
+	ok, err = ChainSources(fakeSource{err: os.ErrPermission}, fakeSource{ok: true}).FetchArtifact(ctx, "a.tgz", "x")
+	assert.NoError(err)
+	assert.True(ok)
+
+	ok, err = ChainSources(fakeSource{err: os.ErrPermission}, fakeSource{}).FetchArtifact(ctx, "a.tgz", "x")
+	assert.Error(err)
+	assert.False(ok)
+
+	ok, err = ChainSources().FetchArtifact(ctx, "a.tgz", "x")
+	assert.NoError(err)
+	assert.False(ok)
+}
@@ -0,0 +1,19 @@
+//go:build windows
+
+package subprocess
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Windows has no process groups that can be signaled, so only the
+// command itself is stopped, and it's killed without a grace period.
+const (
+	terminate = syscall.SIGKILL
+	kill      = syscall.SIGKILL
+)
+
+func setGroup(cmd *exec.Cmd) {}
+
+func signalGroup(cmd *exec.Cmd, _ syscall.Signal) error { return cmd.Process.Kill() }
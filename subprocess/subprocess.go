@@ -0,0 +1,87 @@
+/*
+Package subprocess runs commands in their own process groups, so that
+when a command is cancelled, or its deadline passes, every process
+that it started (such as a mongod, or the tools of an extraction) is
+stopped with it, rather than only the command itself.
+*/
+package subprocess
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultGracePeriod is how long processes that Run stops have to
+// exit after they're signaled to terminate, before they're killed.
+const DefaultGracePeriod = 5 * time.Second
+
+// Run starts the command in a new process group and waits for it to
+// exit, returning its combined standard output and error. When the
+// context is done, Run signals the group to terminate, kills it if
+// it has not exited after the grace period (or immediately, if the
+// grace period is zero), and returns the output captured so far,
+// along with an error that wraps the context's error.
+//
+// The command must not have been started, and Run replaces its
+// standard output and error. Processes that leave the group (e.g. by
+// starting a new session) are not stopped.
+func Run(ctx context.Context, cmd *exec.Cmd, grace time.Duration) ([]byte, error) {
+	out := &buffer{}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	setGroup(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "problem starting %s", cmd.Path)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		return out.Bytes(), err
+	case <-ctx.Done():
+	}
+
+	if grace > 0 {
+		_ = signalGroup(cmd, terminate)
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+
+		select {
+		case <-done:
+			return out.Bytes(), errors.Wrapf(ctx.Err(), "stopped %s", cmd.Path)
+		case <-timer.C:
+		}
+	}
+
+	_ = signalGroup(cmd, kill)
+	<-done
+
+	return out.Bytes(), errors.Wrapf(ctx.Err(), "killed %s and its process group", cmd.Path)
+}
+
+// buffer is a bytes.Buffer that is safe for the concurrent writes of
+// a command's output and error.
+type buffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *buffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *buffer) Bytes() []byte {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
@@ -0,0 +1,71 @@
+//go:build linux
+
+package subprocess
+
+import (
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// running reports whether the process exists and is not a zombie.
+func running(pid int) bool {
+	data, err := ioutil.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+
+	fields := strings.Fields(string(data[strings.LastIndex(string(data), ")")+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func TestRunKillsProcessGroup(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, grace := range []time.Duration{0, time.Second} {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		start := time.Now()
+		// the grandchild ignores SIGTERM, so it's killed after the
+		// grace period
+		cmd := exec.Command("sh", "-c", "sh -c 'trap \"\" TERM; sleep 30' & echo $!; wait")
+		out, err := Run(ctx, cmd, grace)
+		cancel()
+
+		require.Error(t, err)
+		assert.Equal(context.DeadlineExceeded, errors.Cause(err))
+		assert.True(time.Since(start) < 10*time.Second)
+
+		// the partial output is kept
+		pid, err := strconv.Atoi(strings.TrimSpace(string(out)))
+		require.NoError(t, err, string(out))
+		// the grandchild's exit may not be complete when its
+		// output closes
+		for i := 0; i < 100 && running(pid); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.False(running(pid), "grandchild %d is still running", pid)
+	}
+}
+
+func TestRunReturnsOutput(t *testing.T) {
+	assert := assert.New(t)
+
+	out, err := Run(context.Background(), exec.Command("sh", "-c", "echo out; echo err >&2"), DefaultGracePeriod)
+	assert.NoError(err)
+	assert.Contains(string(out), "out\n")
+	assert.Contains(string(out), "err\n")
+
+	_, err = Run(context.Background(), exec.Command("sh", "-c", "exit 3"), 0)
+	assert.Error(err)
+
+	_, err = Run(context.Background(), exec.Command("/does/not/exist"), 0)
+	assert.Error(err)
+}
@@ -0,0 +1,115 @@
+package bond
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Platform is a target and architecture that a release has builds
+// for, with the editions of those builds.
+type Platform struct {
+	Target   string           `bson:"target" json:"target" yaml:"target"`
+	Arch     MongoDBArch      `bson:"arch" json:"arch" yaml:"arch"`
+	Editions []MongoDBEdition `bson:"editions" json:"editions" yaml:"editions"`
+}
+
+// Platforms returns the platforms that the version has builds for,
+// ordered by target and then architecture, for tools that build
+// compatibility tables. Source archives are not included. Platforms
+// returns an error wrapping ErrVersionNotFound if the feed does not
+// have the version.
+func (feed *ArtifactsFeed) Platforms(version string) ([]Platform, error) {
+	v, ok := feed.GetVersion(version)
+	if !ok {
+		return nil, errors.Wrapf(ErrVersionNotFound, "version %s is not in the feed", version)
+	}
+
+	type platformKey struct {
+		target string
+		arch   MongoDBArch
+	}
+
+	index := map[platformKey]int{}
+	out := []Platform{}
+	for _, dl := range v.Downloads {
+		if dl.Edition == "source" {
+			continue
+		}
+
+		key := platformKey{target: dl.Target, arch: dl.Arch}
+		idx, ok := index[key]
+		if !ok {
+			idx = len(out)
+			index[key] = idx
+			out = append(out, Platform{Target: dl.Target, Arch: dl.Arch})
+		}
+
+		if !containsEdition(out[idx].Editions, dl.Edition) {
+			out[idx].Editions = append(out[idx].Editions, dl.Edition)
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Target != out[j].Target {
+			return out[i].Target < out[j].Target
+		}
+		return out[i].Arch < out[j].Arch
+	})
+
+	return out, nil
+}
+
+// VersionsForTarget returns the releases and release candidates in the
+// feed that have a build for the target, in ascending order; with an
+// architecture, only builds for that architecture count. Development
+// builds are never included. VersionsForTarget returns an error
+// wrapping ErrVersionNotFound if no release has a build for the
+// target.
+func (feed *ArtifactsFeed) VersionsForTarget(target string, arch MongoDBArch) ([]string, error) {
+	feed.mutex.RLock()
+	defer feed.mutex.RUnlock()
+
+	type targetVersion struct {
+		parsed  *MongoDBVersion
+		version string
+	}
+
+	matches := []targetVersion{}
+	for _, version := range feed.Versions {
+		parsed, err := NewMongoDBVersion(version.Version)
+		if err != nil || parsed.IsDevelopmentBuild() {
+			continue
+		}
+
+		for _, dl := range version.Downloads {
+			if dl.Edition != "source" && dl.Target == target && (arch == "" || dl.Arch == arch) {
+				matches = append(matches, targetVersion{parsed: parsed, version: version.Version})
+				break
+			}
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, errors.Wrapf(ErrVersionNotFound, "no releases have builds for %s", target)
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].parsed.IsLessThan(matches[j].parsed) })
+
+	out := make([]string, len(matches))
+	for idx := range matches {
+		out[idx] = matches[idx].version
+	}
+
+	return out, nil
+}
+
+func containsEdition(editions []MongoDBEdition, edition MongoDBEdition) bool {
+	for _, e := range editions {
+		if e == edition {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,69 @@
+package bond
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const supportTestFeed = `{"versions": [
+  {"version": "7.0.2", "downloads": [
+    {"target": "ubuntu2204", "arch": "x86_64", "edition": "targeted"},
+    {"target": "ubuntu2204", "arch": "x86_64", "edition": "enterprise"},
+    {"target": "ubuntu2204", "arch": "ppc64le", "edition": "targeted"},
+    {"target": "rhel90", "arch": "x86_64", "edition": "targeted"},
+    {"target": "src", "arch": "x86_64", "edition": "source"}]},
+  {"version": "7.0.3-5-g1234567", "downloads": [
+    {"target": "ubuntu2204", "arch": "x86_64", "edition": "targeted"}]},
+  {"version": "7.0.0-rc1", "downloads": [
+    {"target": "ubuntu2204", "arch": "x86_64", "edition": "targeted"}]},
+  {"version": "6.0.9", "downloads": [
+    {"target": "ubuntu2204", "arch": "x86_64", "edition": "targeted"},
+    {"target": "ubuntu2004", "arch": "x86_64", "edition": "targeted"}]}
+]}`
+
+func TestFeedPlatforms(t *testing.T) {
+	assert := assert.New(t)
+
+	feed, err := NewArtifactsFeed("")
+	require.NoError(t, err)
+	defer os.RemoveAll(feed.dir)
+	require.NoError(t, feed.Reload([]byte(supportTestFeed)))
+
+	platforms, err := feed.Platforms("7.0.2")
+	require.NoError(t, err)
+	assert.Equal([]Platform{
+		{Target: "rhel90", Arch: AMD64, Editions: []MongoDBEdition{CommunityTargeted}},
+		{Target: "ubuntu2204", Arch: POWER, Editions: []MongoDBEdition{CommunityTargeted}},
+		{Target: "ubuntu2204", Arch: AMD64, Editions: []MongoDBEdition{CommunityTargeted, Enterprise}},
+	}, platforms)
+
+	_, err = feed.Platforms("8.0.0")
+	assert.True(Is(err, ErrVersionNotFound))
+}
+
+func TestFeedVersionsForTarget(t *testing.T) {
+	assert := assert.New(t)
+
+	feed, err := NewArtifactsFeed("")
+	require.NoError(t, err)
+	defer os.RemoveAll(feed.dir)
+	require.NoError(t, feed.Reload([]byte(supportTestFeed)))
+
+	versions, err := feed.VersionsForTarget("ubuntu2204", "")
+	require.NoError(t, err)
+	assert.Equal([]string{"6.0.9", "7.0.0-rc1", "7.0.2"}, versions)
+
+	versions, err = feed.VersionsForTarget("ubuntu2204", POWER)
+	require.NoError(t, err)
+	assert.Equal([]string{"7.0.2"}, versions)
+
+	versions, err = feed.VersionsForTarget("ubuntu2004", AMD64)
+	require.NoError(t, err)
+	assert.Equal([]string{"6.0.9"}, versions)
+
+	_, err = feed.VersionsForTarget("rhel90", POWER)
+	assert.True(Is(err, ErrVersionNotFound))
+}
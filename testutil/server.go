@@ -0,0 +1,481 @@
+/*
+Package testutil provides a fake of MongoDB's download servers, so
+that applications that embed bond can test the resolution and
+download of builds without network access.
+
+A Server serves a feed of the releases it's given, and an archive for
+each of their builds, which extracts to a build directory with stub
+binaries. Bond reaches the server as a mirror:
+
+	srv := testutil.NewServer(testutil.Release{Version: "7.0.2"}, testutil.Release{Version: "6.0.9"})
+	defer srv.Close()
+
+	feed, err := bond.GetArtifactsFeed(ctx, dir, srv.Options()...)
+
+Servers also serve the database tools and mongosh feeds, with the
+releases added with AddTools and AddShell, and a crypt_shared library
+with each enterprise build, for applications that fetch toolchains.
+
+Servers can delay their responses and fail or corrupt requests, to
+test how applications handle slow and degraded networks.
+*/
+package testutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tychoish/bond"
+)
+
+// The paths of the feeds on a Server.
+const (
+	FeedPath      = "/full.json"
+	ToolsFeedPath = "/tools/db/release.json"
+	ShellFeedPath = "/compass/mongosh.json"
+)
+
+// DefaultBuild is the build of releases that do not specify any.
+var DefaultBuild = Build{Target: "ubuntu2204", Arch: bond.AMD64, Edition: bond.CommunityTargeted}
+
+// Release is a release in a Server's feed.
+type Release struct {
+	Version string
+	// Current marks the release as the current release of its
+	// series.
+	Current bool
+	// Builds are the release's builds, and default to
+	// DefaultBuild.
+	Builds []Build
+}
+
+// Build is a build of a release, for Linux.
+type Build struct {
+	Target  string
+	Arch    bond.MongoDBArch
+	Edition bond.MongoDBEdition
+}
+
+// ArchiveName returns the file name of the build's archive for the
+// version, which follows the names of MongoDB's archives.
+func (b Build) ArchiveName(version string) string {
+	switch b.Edition {
+	case bond.Enterprise:
+		return fmt.Sprintf("mongodb-linux-%s-enterprise-%s-%s.tgz", b.Arch, b.Target, version)
+	case bond.Base:
+		return fmt.Sprintf("mongodb-linux-%s-%s.tgz", b.Arch, version)
+	default:
+		return fmt.Sprintf("mongodb-linux-%s-%s-%s.tgz", b.Arch, b.Target, version)
+	}
+}
+
+// Server is a fake of MongoDB's download servers. Servers are safe
+// for concurrent use.
+type Server struct {
+	srv *httptest.Server
+
+	mutex    sync.Mutex
+	releases []Release
+	tools    []string
+	shells   []string
+	archives map[string][]byte
+	latency  time.Duration
+	failures map[string][]int
+	corrupt  map[string]bool
+	requests map[string]int
+}
+
+// NewServer starts a server with a feed of the releases.
+func NewServer(releases ...Release) *Server {
+	s := &Server{
+		archives: map[string][]byte{},
+		failures: map[string][]int{},
+		corrupt:  map[string]bool{},
+		requests: map[string]int{},
+	}
+	for _, r := range releases {
+		s.AddRelease(r)
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	return s
+}
+
+// URL returns the base URL of the server.
+func (s *Server) URL() string { return s.srv.URL }
+
+// Close shuts down the server.
+func (s *Server) Close() { s.srv.Close() }
+
+// Options returns the bond options that direct feed and archive
+// requests to the server.
+func (s *Server) Options() []bond.Option {
+	return []bond.Option{bond.WithMirror(s.srv.URL)}
+}
+
+// AddRelease adds the release, and archives of its builds, to the
+// server.
+func (s *Server) AddRelease(r Release) {
+	if len(r.Builds) == 0 {
+		r.Builds = []Build{DefaultBuild}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.releases = append(s.releases, r)
+	for _, b := range r.Builds {
+		s.archives[archivePath(b, r.Version)] = buildArchive(b, r.Version)
+		if b.Edition == bond.Enterprise {
+			s.archives[cryptSharedPath(b, r.Version)] = cryptSharedArchive(b, r.Version)
+		}
+	}
+}
+
+// AddTools adds releases of the database tools, with builds for the
+// platform of DefaultBuild, to the server's tools feed.
+func (s *Server) AddTools(versions ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, v := range versions {
+		s.tools = append(s.tools, v)
+		s.archives[toolsPath(v)] = stubArchive(strings.TrimSuffix(path.Base(toolsPath(v)), ".tgz"),
+			map[string]string{"bin/mongodump": stubScript("mongodump", v), "bin/mongorestore": stubScript("mongorestore", v)})
+	}
+}
+
+// AddShell adds releases of mongosh, with builds for Linux on the
+// architecture of DefaultBuild, to the server's mongosh feed.
+func (s *Server) AddShell(versions ...string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, v := range versions {
+		s.shells = append(s.shells, v)
+		s.archives[shellPath(v)] = stubArchive(strings.TrimSuffix(path.Base(shellPath(v)), ".tgz"),
+			map[string]string{"bin/mongosh": stubScript("mongosh", v)})
+	}
+}
+
+// SetLatency delays every response by the duration.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.latency = d
+}
+
+// FailNext makes the next n requests for the path (e.g. FeedPath, or
+// the path of an ArchiveURL) fail with the HTTP status. An empty path
+// fails the next requests for any path.
+func (s *Server) FailNext(path string, n int, status int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := 0; i < n; i++ {
+		s.failures[path] = append(s.failures[path], status)
+	}
+}
+
+// Corrupt makes the server respond to requests for the archive of the
+// build with data that does not match the checksums in the feed.
+func (s *Server) Corrupt(version string, b Build) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.corrupt[archivePath(b, version)] = true
+}
+
+// Requests returns the number of requests for the path, including
+// those that failed.
+func (s *Server) Requests(path string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.requests[path]
+}
+
+// ArchiveURL returns the URL of the build's archive in the feed,
+// which bond downloads from the server when it uses the server's
+// options.
+func ArchiveURL(version string, b Build) string {
+	host := "https://fastdl.mongodb.org"
+	if b.Edition == bond.Enterprise {
+		host = "https://downloads.mongodb.com"
+	}
+
+	return host + archivePath(b, version)
+}
+
+func archivePath(b Build, version string) string { return "/linux/" + b.ArchiveName(version) }
+
+// CryptSharedURL returns the URL of the crypt_shared archive of an
+// enterprise build in the feed.
+func CryptSharedURL(version string, b Build) string {
+	return "https://downloads.mongodb.com" + cryptSharedPath(b, version)
+}
+
+func cryptSharedPath(b Build, version string) string {
+	return fmt.Sprintf("/linux/mongo_crypt_shared_v1-linux-%s-enterprise-%s-%s.tgz", b.Arch, b.Target, version)
+}
+
+// ToolsURL returns the URL of the database tools archive of the
+// version in the tools feed.
+func ToolsURL(version string) string { return "https://fastdl.mongodb.org" + toolsPath(version) }
+
+func toolsPath(version string) string {
+	return fmt.Sprintf("/tools/db/mongodb-database-tools-%s-%s-%s.tgz", DefaultBuild.Target, DefaultBuild.Arch, version)
+}
+
+// ShellURL returns the URL of the mongosh archive of the version in
+// the mongosh feed.
+func ShellURL(version string) string { return "https://downloads.mongodb.com" + shellPath(version) }
+
+func shellPath(version string) string {
+	return fmt.Sprintf("/compass/mongosh-%s-%s.tgz", version, shellDistro)
+}
+
+// shellDistro is the mongosh feed's name of the platform of
+// DefaultBuild.
+const shellDistro = "linux-x64"
+
+// Feed returns the server's feed.
+func (s *Server) Feed() []byte {
+	type archive struct {
+		URL    string `json:"url"`
+		MD5    string `json:"md5"`
+		SHA1   string `json:"sha1"`
+		SHA256 string `json:"sha256"`
+	}
+	type download struct {
+		Target      string              `json:"target"`
+		Arch        bond.MongoDBArch    `json:"arch"`
+		Edition     bond.MongoDBEdition `json:"edition"`
+		Archive     archive             `json:"archive"`
+		CryptShared *archive            `json:"crypt_shared,omitempty"`
+	}
+	type version struct {
+		Version            string     `json:"version"`
+		ProductionRelease  bool       `json:"production_release"`
+		DevelopmentRelease bool       `json:"development_release"`
+		Current            bool       `json:"current"`
+		Downloads          []download `json:"downloads"`
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	doc := struct {
+		Versions []version `json:"versions"`
+	}{Versions: []version{}}
+	for _, r := range s.releases {
+		v := version{
+			Version:            r.Version,
+			ProductionRelease:  !strings.Contains(r.Version, "-"),
+			DevelopmentRelease: strings.Contains(r.Version, "-"),
+			Current:            r.Current,
+		}
+		for _, b := range r.Builds {
+			target := b.Target
+			if b.Edition == bond.Base {
+				target = "linux"
+			}
+
+			data := s.archives[archivePath(b, r.Version)]
+			md5sum, sha1sum, sha256sum := md5.Sum(data), sha1.Sum(data), sha256.Sum256(data)
+			dl := download{
+				Target:  target,
+				Arch:    b.Arch,
+				Edition: b.Edition,
+				Archive: archive{
+					URL:    ArchiveURL(r.Version, b),
+					MD5:    hex.EncodeToString(md5sum[:]),
+					SHA1:   hex.EncodeToString(sha1sum[:]),
+					SHA256: hex.EncodeToString(sha256sum[:]),
+				},
+			}
+			if b.Edition == bond.Enterprise {
+				crypt := sha256.Sum256(s.archives[cryptSharedPath(b, r.Version)])
+				dl.CryptShared = &archive{URL: CryptSharedURL(r.Version, b), SHA256: hex.EncodeToString(crypt[:])}
+			}
+			v.Downloads = append(v.Downloads, dl)
+		}
+		doc.Versions = append(doc.Versions, v)
+	}
+
+	out, _ := json.Marshal(doc)
+	return out
+}
+
+// ToolFeeds returns the server's database tools and mongosh feeds.
+func (s *Server) ToolFeeds() (tools []byte, shell []byte) {
+	type archive struct {
+		URL    string `json:"url"`
+		SHA256 string `json:"sha256"`
+	}
+	type download struct {
+		Name    string  `json:"name,omitempty"`
+		Distro  string  `json:"distro,omitempty"`
+		Arch    string  `json:"arch"`
+		Archive archive `json:"archive"`
+	}
+	type version struct {
+		Version   string     `json:"version"`
+		Downloads []download `json:"downloads"`
+	}
+	type feed struct {
+		Versions []version `json:"versions"`
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sum := func(path string) string {
+		out := sha256.Sum256(s.archives[path])
+		return hex.EncodeToString(out[:])
+	}
+
+	toolsFeed := feed{Versions: []version{}}
+	for _, v := range s.tools {
+		toolsFeed.Versions = append(toolsFeed.Versions, version{Version: v, Downloads: []download{{
+			Name:    DefaultBuild.Target,
+			Arch:    string(DefaultBuild.Arch),
+			Archive: archive{URL: ToolsURL(v), SHA256: sum(toolsPath(v))},
+		}}})
+	}
+
+	shellFeed := feed{Versions: []version{}}
+	for _, v := range s.shells {
+		shellFeed.Versions = append(shellFeed.Versions, version{Version: v, Downloads: []download{{
+			Distro:  shellDistro,
+			Arch:    "x64",
+			Archive: archive{URL: ShellURL(v), SHA256: sum(shellPath(v))},
+		}}})
+	}
+
+	tools, _ = json.Marshal(toolsFeed)
+	shell, _ = json.Marshal(shellFeed)
+	return tools, shell
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.requests[r.URL.Path]++
+	latency := s.latency
+	status := s.nextFailure(r.URL.Path)
+	data, ok := s.archives[r.URL.Path]
+	corrupt := s.corrupt[r.URL.Path]
+	s.mutex.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	switch {
+	case status != 0:
+		http.Error(w, http.StatusText(status), status)
+	case r.URL.Path == FeedPath:
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(s.Feed())
+	case r.URL.Path == ToolsFeedPath || r.URL.Path == ShellFeedPath:
+		tools, shell := s.ToolFeeds()
+		if r.URL.Path == ShellFeedPath {
+			tools = shell
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(tools)
+	case !ok:
+		http.NotFound(w, r)
+	default:
+		if corrupt {
+			data = append([]byte("corrupt"), data...)
+		}
+		w.Header().Set("Content-Type", "application/gzip")
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+	}
+}
+
+// nextFailure returns the status of the next failure of requests
+// for the path, or 0. The caller must hold the mutex.
+func (s *Server) nextFailure(path string) int {
+	for _, key := range []string{path, ""} {
+		if queued := s.failures[key]; len(queued) > 0 {
+			s.failures[key] = queued[1:]
+			return queued[0]
+		}
+	}
+
+	return 0
+}
+
+// buildArchive returns a gzipped tarball of a build directory, with
+// stub binaries that print the version.
+func buildArchive(b Build, version string) []byte {
+	files := map[string]string{}
+	for _, bin := range []string{"mongod", "mongos", "mongo"} {
+		files["bin/"+bin] = stubScript(bin, version)
+	}
+
+	return stubArchive(strings.TrimSuffix(b.ArchiveName(version), ".tgz"), files)
+}
+
+// cryptSharedArchive returns a gzipped tarball of the crypt_shared
+// library of an enterprise build, with a stub library.
+func cryptSharedArchive(b Build, version string) []byte {
+	return stubArchive(strings.TrimSuffix(path.Base(cryptSharedPath(b, version)), ".tgz"),
+		map[string]string{"lib/mongo_crypt_v1.so": "mongo_crypt_v1 " + version + "\n"})
+}
+
+func stubScript(bin, version string) string {
+	return fmt.Sprintf("#!/bin/sh\necho \"%s version v%s\"\n", bin, version)
+}
+
+// stubArchive returns a gzipped tarball of a directory with the files,
+// by their paths within the directory, which are executable.
+func stubArchive(dir string, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	modified := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	_ = tw.WriteHeader(&tar.Header{Name: dir + "/", Mode: 0755, Typeflag: tar.TypeDir, ModTime: modified})
+	created := map[string]bool{}
+	for _, name := range names {
+		if sub := path.Dir(name); sub != "." && !created[sub] {
+			created[sub] = true
+			_ = tw.WriteHeader(&tar.Header{Name: dir + "/" + sub + "/", Mode: 0755, Typeflag: tar.TypeDir, ModTime: modified})
+		}
+		data := []byte(files[name])
+		_ = tw.WriteHeader(&tar.Header{Name: dir + "/" + name, Mode: 0755, Size: int64(len(data)), Typeflag: tar.TypeReg, ModTime: modified})
+		_, _ = tw.Write(data)
+	}
+
+	_ = tw.Close()
+	_ = gz.Close()
+	return buf.Bytes()
+}
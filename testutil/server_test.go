@@ -0,0 +1,194 @@
+package testutil
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tychoish/bond"
+	"github.com/tychoish/bond/recall"
+)
+
+func TestServerFeed(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "bond-testutil-feed")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	enterprise := Build{Target: "rhel90", Arch: bond.AMD64, Edition: bond.Enterprise}
+	srv := NewServer(Release{Version: "7.0.2", Current: true, Builds: []Build{DefaultBuild, enterprise}}, Release{Version: "7.1.0-rc0"})
+	defer srv.Close()
+
+	feed, err := bond.GetArtifactsFeed(ctx, dir, srv.Options()...)
+	require.NoError(t, err)
+	assert.Equal(1, srv.Requests(FeedPath))
+
+	version, ok := feed.GetVersion("7.0.2")
+	require.True(t, ok)
+	assert.True(version.ProductionRelease)
+	assert.True(version.Current)
+	dl, err := version.GetDownload(bond.BuildOptions{Target: "rhel90", Arch: bond.AMD64, Edition: bond.Enterprise})
+	require.NoError(t, err)
+	assert.Equal(ArchiveURL("7.0.2", enterprise), dl.Archive.URL)
+	assert.Len(dl.Checksums(), 3)
+
+	rc, ok := feed.GetVersion("7.1.0-rc0")
+	require.True(t, ok)
+	assert.False(rc.ProductionRelease)
+
+	_, ok = feed.GetVersion("6.0.9")
+	assert.False(ok)
+}
+
+func TestServerDownloads(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "bond-testutil-download")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	srv := NewServer(Release{Version: "7.0.2"}, Release{Version: "6.0.9"})
+	defer srv.Close()
+
+	opts := bond.BuildOptions{Target: DefaultBuild.Target, Arch: DefaultBuild.Arch, Edition: DefaultBuild.Edition}
+	require.NoError(t, recall.FetchReleases(ctx, []string{"7.0.2", "6.0.9"}, dir, opts, srv.Options()...))
+
+	catalog, err := bond.NewCatalog(ctx, dir, srv.Options()...)
+	require.NoError(t, err)
+	path, err := catalog.Get("7.0.2", string(opts.Edition), opts.Target, string(opts.Arch), false)
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(path, "bin", "mongod"))
+	assert.NoError(err)
+
+	sums, err := catalog.Checksums("6.0.9")
+	require.NoError(t, err)
+	require.Len(t, sums, 1)
+	assert.True(sums[0].OK())
+	assert.Equal(1, srv.Requests("/linux/"+DefaultBuild.ArchiveName("6.0.9")))
+}
+
+func TestServerFailures(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "bond-testutil-failures")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	srv := NewServer(Release{Version: "7.0.2"}, Release{Version: "6.0.9"})
+	defer srv.Close()
+	opts := bond.BuildOptions{Target: DefaultBuild.Target, Arch: DefaultBuild.Arch, Edition: DefaultBuild.Edition}
+
+	srv.FailNext(FeedPath, 1, http.StatusServiceUnavailable)
+	_, err = bond.GetArtifactsFeed(ctx, dir, srv.Options()...)
+	assert.Error(err)
+	_, err = bond.GetArtifactsFeed(ctx, dir, srv.Options()...)
+	assert.NoError(err)
+
+	srv.Corrupt("7.0.2", DefaultBuild)
+	err = recall.FetchReleases(ctx, []string{"7.0.2"}, dir, opts, srv.Options()...)
+	require.Error(t, err)
+	assert.Contains(err.Error(), bond.ErrChecksumMismatch.Error())
+
+	// failures of any path are retried within a retry budget
+	srv.FailNext("", 2, http.StatusBadGateway)
+	archive := "/linux/" + DefaultBuild.ArchiveName("6.0.9")
+	history := recall.NewFileHistory(filepath.Join(dir, recall.HistoryFileName))
+	err = recall.FetchReleasesWithHistory(ctx, history, recall.QueueOptions{Retries: 5, RetryBackoff: time.Millisecond}, []string{"6.0.9"}, dir, opts, srv.Options()...)
+	require.NoError(t, err)
+	assert.Equal(3, srv.Requests(archive))
+
+	// the history records the process that ran each job
+	runs, err := history.Runs(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	require.NotEmpty(t, runs[0].Jobs)
+	require.NotNil(t, runs[0].Jobs[0].Environment)
+	assert.Equal(os.Getpid(), runs[0].Jobs[0].Environment.PID)
+
+	srv.SetLatency(time.Second)
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = bond.NewConfig(srv.Options()...).CacheDownload(tctx, 0, bond.FeedURL, filepath.Join(dir, "full.json"), true)
+	assert.Error(err)
+}
+
+func TestServerToolchain(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "bond-testutil-toolchain")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	enterprise := Build{Target: DefaultBuild.Target, Arch: DefaultBuild.Arch, Edition: bond.Enterprise}
+	srv := NewServer(Release{Version: "7.0.2", Current: true, Builds: []Build{enterprise}})
+	defer srv.Close()
+	srv.AddTools("100.9.4", "100.10.0")
+	srv.AddShell("2.1.1")
+
+	opts := bond.BuildOptions{Target: enterprise.Target, Arch: enterprise.Arch, Edition: enterprise.Edition}
+	versions := map[bond.Component]string{
+		bond.ServerComponent:      "",
+		bond.ToolsComponent:       "100.9",
+		bond.ShellComponent:       "",
+		bond.CryptSharedComponent: "",
+	}
+	history := recall.NewFileHistory(filepath.Join(dir, recall.HistoryFileName))
+	tc, err := recall.FetchToolchain(ctx, history, recall.QueueOptions{}, "7.0", versions, dir, opts, srv.Options()...)
+	require.NoError(t, err)
+	require.True(t, tc.Complete())
+	assert.Equal("100.9.4", tc.Artifacts[bond.ToolsComponent].Version)
+	assert.Equal(CryptSharedURL("7.0.2", enterprise), tc.Artifacts[bond.CryptSharedComponent].URL)
+	assert.Equal(1, srv.Requests(FeedPath))
+
+	toolchain := []string{
+		filepath.Join(strings.TrimSuffix(enterprise.ArchiveName("7.0.2"), ".tgz"), "bin", "mongod"),
+		filepath.Join("mongodb-database-tools-ubuntu2204-x86_64-100.9.4", "bin", "mongodump"),
+		filepath.Join("mongosh-2.1.1-linux-x64", "bin", "mongosh"),
+		filepath.Join("mongo_crypt_shared_v1-linux-x86_64-enterprise-ubuntu2204-7.0.2", "lib", "mongo_crypt_v1.so"),
+	}
+	for _, fn := range toolchain {
+		_, err = os.Stat(filepath.Join(dir, fn))
+		assert.NoError(err, fn)
+	}
+
+	// the daemon's prunes of the cache keep every component
+	prune := recall.NewPruneCacheJob(bond.NewConfig(srv.Options()...), dir, 0, time.Now())
+	prune.Run(ctx)
+	require.NoError(t, prune.Error())
+	assert.Empty(prune.Report.Removed)
+	for _, fn := range toolchain {
+		_, err = os.Stat(filepath.Join(dir, fn))
+		assert.NoError(err, fn)
+	}
+
+	// the catalog has the server build alongside the other
+	// components
+	catalog, err := bond.NewCatalog(ctx, dir, srv.Options()...)
+	require.NoError(t, err)
+	_, err = catalog.Get("7.0.2", string(opts.Edition), opts.Target, string(opts.Arch), false)
+	assert.NoError(err)
+
+	runs, err := history.Runs(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Len(runs[0].Jobs, 4)
+	assert.Contains(runs[0].Releases, "database-tools 100.9.4")
+
+	// components that do not resolve are errors, but do not
+	// stop the others
+	tc, err = recall.FetchToolchain(ctx, nil, recall.QueueOptions{}, "7.0", map[bond.Component]string{bond.ShellComponent: "3"}, dir, opts, srv.Options()...)
+	assert.Error(err)
+	assert.Contains(tc.Errors, bond.ShellComponent)
+}
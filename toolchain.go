@@ -0,0 +1,555 @@
+package bond
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/mongodb/grip"
+	"github.com/mongodb/grip/recovery"
+	"github.com/pkg/errors"
+)
+
+// Component identifies a part of a MongoDB toolchain that is
+// published in its own feed.
+type Component string
+
+// The components of a MongoDB toolchain.
+const (
+	ServerComponent Component = "server"
+	ToolsComponent  Component = "database-tools"
+	ShellComponent  Component = "mongosh"
+	// CryptSharedComponent is the crypt_shared library, for
+	// automatic client-side field level encryption, which the
+	// server feed publishes with enterprise builds.
+	CryptSharedComponent Component = "crypt_shared"
+)
+
+// DefaultComponents are the components of a toolchain that do not
+// specify any.
+var DefaultComponents = []Component{ServerComponent, ToolsComponent, ShellComponent}
+
+// Components lists the components of a toolchain.
+var Components = []Component{ServerComponent, ToolsComponent, ShellComponent, CryptSharedComponent}
+
+// Validate returns an error if the component is not known.
+func (c Component) Validate() error {
+	for _, component := range Components {
+		if c == component {
+			return nil
+		}
+	}
+
+	return errors.Errorf("'%s' is not a valid component", c)
+}
+
+// The feeds for the components of a toolchain other than the server.
+const (
+	ToolsFeedURL = "https://downloads.mongodb.org/tools/db/release.json"
+	ShellFeedURL = "https://downloads.mongodb.com/compass/mongosh.json"
+)
+
+// ParseComponentVersion parses the pinned version of a component, in
+// the form component=version (e.g. "database-tools=100.9").
+func ParseComponentVersion(val string) (Component, string, error) {
+	parts := strings.SplitN(val, "=", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+		return "", "", errors.Errorf("'%s' is not in the form component=version", val)
+	}
+
+	c := Component(strings.TrimSpace(parts[0]))
+	if err := c.Validate(); err != nil {
+		return "", "", err
+	}
+
+	return c, strings.TrimSpace(parts[1]), nil
+}
+
+// ComponentArtifact is the archive for a component of a toolchain.
+type ComponentArtifact struct {
+	Component Component `bson:"component" json:"component" yaml:"component"`
+	Version   string    `bson:"version" json:"version" yaml:"version"`
+	URL       string    `bson:"url" json:"url" yaml:"url"`
+	SHA256    string    `bson:"sha256,omitempty" json:"sha256,omitempty" yaml:"sha256,omitempty"`
+}
+
+// ComponentFeed is a feed that publishes the builds of a component.
+type ComponentFeed interface {
+	Component() Component
+	// Populate loads the feed, using a cached copy if it's newer
+	// than the ttl.
+	Populate(context.Context, time.Duration) error
+	// Resolve returns the component's archive for a server
+	// release (a version or a series) and platform.
+	Resolve(release string, opts BuildOptions) (ComponentArtifact, error)
+}
+
+// VersionedFeed is implemented by component feeds that resolve a
+// version of the component that's chosen independently of the server
+// release, for toolchains that pin the version of a component.
+type VersionedFeed interface {
+	ComponentFeed
+	// ResolveVersion returns the component's archive for a
+	// version, or a series of versions (e.g. "100.9"), and
+	// platform.
+	ResolveVersion(version string, opts BuildOptions) (ComponentArtifact, error)
+}
+
+// ServerFeed adapts an ArtifactsFeed to the ComponentFeed interface.
+type ServerFeed struct {
+	*ArtifactsFeed
+}
+
+// Component returns ServerComponent.
+func (f ServerFeed) Component() Component { return ServerComponent }
+
+// Resolve returns the archive for a version, or for the current
+// stable release of a series (e.g. 4.0).
+func (f ServerFeed) Resolve(release string, opts BuildOptions) (ComponentArtifact, error) {
+	version, dl, err := resolveServerRelease(f.ArtifactsFeed, release, opts)
+	if err != nil {
+		return ComponentArtifact{}, err
+	}
+
+	out := ComponentArtifact{
+		Component: ServerComponent,
+		Version:   version.Version,
+		URL:       dl.Archive.URL,
+		SHA256:    dl.Archive.Sha256,
+	}
+	if opts.Debug {
+		out.URL = dl.Archive.Debug
+	}
+
+	return out, nil
+}
+
+// ResolveVersion is the same as Resolve, because the server's version
+// is the release.
+func (f ServerFeed) ResolveVersion(version string, opts BuildOptions) (ComponentArtifact, error) {
+	return f.Resolve(version, opts)
+}
+
+// resolveServerRelease returns the version and download of the
+// release, which is a version or a series, in the feed.
+func resolveServerRelease(feed *ArtifactsFeed, release string, opts BuildOptions) (*ArtifactVersion, ArtifactDownload, error) {
+	var version *ArtifactVersion
+	if len(coerceSeries(release)) == len(release) {
+		var err error
+		version, err = feed.GetStableRelease(release)
+		if err != nil {
+			return nil, ArtifactDownload{}, err
+		}
+	} else {
+		var ok bool
+		version, ok = feed.GetVersion(release)
+		if !ok {
+			return nil, ArtifactDownload{}, errors.Wrapf(ErrVersionNotFound, "no version defined for %s", release)
+		}
+	}
+
+	dl, err := version.GetDownload(opts)
+	if err != nil {
+		return nil, ArtifactDownload{}, err
+	}
+
+	return version, dl, nil
+}
+
+// CryptSharedFeed adapts an ArtifactsFeed to the ComponentFeed
+// interface for the crypt_shared library, which the server feed
+// publishes with the enterprise builds of 6.0 and later. The feed may
+// share its ArtifactsFeed with a ServerFeed.
+type CryptSharedFeed struct {
+	*ArtifactsFeed
+}
+
+// Component returns CryptSharedComponent.
+func (f CryptSharedFeed) Component() Component { return CryptSharedComponent }
+
+// Resolve returns the crypt_shared archive of the enterprise build of
+// a version, or of the current stable release of a series, for the
+// platform. The edition of the options does not affect the result.
+func (f CryptSharedFeed) Resolve(release string, opts BuildOptions) (ComponentArtifact, error) {
+	opts.Edition = Enterprise
+	opts.Debug = false
+	version, dl, err := resolveServerRelease(f.ArtifactsFeed, release, opts)
+	if err != nil {
+		return ComponentArtifact{}, err
+	}
+
+	if dl.CryptShared.URL == "" {
+		return ComponentArtifact{}, errors.Wrapf(ErrVersionNotFound, "release %s has no %s library for %s (%s)",
+			version.Version, CryptSharedComponent, opts.Target, opts.Arch)
+	}
+
+	return ComponentArtifact{
+		Component: CryptSharedComponent,
+		Version:   version.Version,
+		URL:       dl.CryptShared.URL,
+		SHA256:    dl.CryptShared.Sha256,
+	}, nil
+}
+
+// ResolveVersion is the same as Resolve, because the library's
+// version is the server release.
+func (f CryptSharedFeed) ResolveVersion(version string, opts BuildOptions) (ComponentArtifact, error) {
+	return f.Resolve(version, opts)
+}
+
+// ToolDownload is a build in the database tools or mongosh feeds.
+// The database tools feed names a build's platform with Name, and the
+// mongosh feed with Distro.
+type ToolDownload struct {
+	Name    string `bson:"name" json:"name" yaml:"name"`
+	Distro  string `bson:"distro" json:"distro" yaml:"distro"`
+	Arch    string `bson:"arch" json:"arch" yaml:"arch"`
+	Archive struct {
+		URL    string `bson:"url" json:"url" yaml:"url"`
+		Sha256 string `bson:"sha256" json:"sha256" yaml:"sha256"`
+	} `bson:"archive" json:"archive" yaml:"archive"`
+}
+
+// ToolVersion is a release in the database tools or mongosh feeds.
+type ToolVersion struct {
+	Version   string         `bson:"version" json:"version" yaml:"version"`
+	Downloads []ToolDownload `bson:"downloads" json:"downloads" yaml:"downloads"`
+}
+
+// ToolFeed is the feed for a component, such as the database tools or
+// mongosh, that is released independently of the server. Every
+// server release uses the newest stable release of the component.
+type ToolFeed struct {
+	Versions []ToolVersion `bson:"versions" json:"versions" yaml:"versions"`
+
+	component Component
+	url       string
+	path      string
+	match     func(ToolDownload, BuildOptions) bool
+	conf      *Config
+	mutex     sync.RWMutex
+}
+
+// NewToolsFeed returns the database tools feed, cached in the
+// directory.
+func NewToolsFeed(dir string) *ToolFeed {
+	return &ToolFeed{
+		component: ToolsComponent,
+		url:       ToolsFeedURL,
+		path:      filepath.Join(dir, "tools-release.json"),
+		match: func(dl ToolDownload, opts BuildOptions) bool {
+			return dl.Name == opts.Target && dl.Arch == string(opts.Arch)
+		},
+	}
+}
+
+// NewShellFeed returns the mongosh feed, cached in the directory.
+// The mongosh feed publishes one build for each operating system and
+// architecture, rather than for each distribution.
+func NewShellFeed(dir string) *ToolFeed {
+	return &ToolFeed{
+		component: ShellComponent,
+		url:       ShellFeedURL,
+		path:      filepath.Join(dir, "mongosh.json"),
+		match: func(dl ToolDownload, opts BuildOptions) bool {
+			return dl.Distro == shellDistro(opts)
+		},
+	}
+}
+
+func shellDistro(opts BuildOptions) string {
+	arch := string(opts.Arch)
+	switch opts.Arch {
+	case AMD64:
+		arch = "x64"
+	case "aarch64":
+		arch = "arm64"
+	}
+
+	switch {
+	case opts.Target == "osx" || opts.Target == "macos":
+		return "darwin-" + arch
+	case strings.HasPrefix(opts.Target, "windows"):
+		return "win32-" + arch
+	default:
+		return "linux-" + arch
+	}
+}
+
+// Component returns the feed's component.
+func (f *ToolFeed) Component() Component { return f.component }
+
+// Populate downloads the feed, if the cached copy is missing or older
+// than the ttl, and loads it.
+func (f *ToolFeed) Populate(ctx context.Context, ttl time.Duration) error {
+	data, err := f.conf.CacheDownload(ctx, ttl, f.url, f.path, false)
+	if err != nil {
+		return errors.Wrapf(err, "problem getting %s feed data", f.component)
+	}
+
+	return errors.Wrapf(f.Reload(data), "problem reloading %s feed", f.component)
+}
+
+// Reload replaces the feed's contents with the data.
+func (f *ToolFeed) Reload(data []byte) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.Versions = nil
+	return errors.Wrap(json.Unmarshal(data, f), "problem converting data from json")
+}
+
+// Resolve returns the newest stable release of the component for the
+// platform. The server release does not affect the result.
+func (f *ToolFeed) Resolve(_ string, opts BuildOptions) (ComponentArtifact, error) {
+	return f.ResolveVersion("", opts)
+}
+
+// ResolveVersion returns the release of the component for the
+// platform with the version, or the newest stable release in the
+// series of versions (e.g. "100.9" or "2"). An empty version is the
+// newest stable release.
+func (f *ToolFeed) ResolveVersion(version string, opts BuildOptions) (ComponentArtifact, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	var (
+		out    ComponentArtifact
+		newest semver.Version
+	)
+
+	for _, v := range f.Versions {
+		parsed, err := semver.Parse(v.Version)
+		if err != nil || (out.URL != "" && parsed.LTE(newest)) {
+			continue
+		}
+		if v.Version != version && (len(parsed.Pre) > 0 || !inVersionSeries(v.Version, version)) {
+			continue
+		}
+
+		for _, dl := range v.Downloads {
+			if !f.match(dl, opts) {
+				continue
+			}
+
+			newest = parsed
+			out = ComponentArtifact{
+				Component: f.component,
+				Version:   v.Version,
+				URL:       dl.Archive.URL,
+				SHA256:    dl.Archive.Sha256,
+			}
+			break
+		}
+	}
+
+	if out.URL == "" {
+		if version != "" {
+			return out, errors.Wrapf(ErrVersionNotFound, "no %s %s build for %s (%s)",
+				f.component, version, opts.Target, opts.Arch)
+		}
+		return out, errors.Wrapf(ErrVersionNotFound, "no %s build for %s (%s)",
+			f.component, opts.Target, opts.Arch)
+	}
+
+	return out, nil
+}
+
+// inVersionSeries reports whether the version is in the series, which
+// is a prefix of whole components of versions (e.g. 100.9.4 is in
+// "100" and "100.9"). Every version is in the empty series.
+func inVersionSeries(version, series string) bool {
+	return series == "" || version == series || strings.HasPrefix(version, series+".")
+}
+
+// Toolchain is the set of archives that make up a MongoDB release on
+// a platform.
+type Toolchain struct {
+	Release   string                          `bson:"release" json:"release" yaml:"release"`
+	Options   BuildOptions                    `bson:"options" json:"options" yaml:"options"`
+	Artifacts map[Component]ComponentArtifact `bson:"artifacts" json:"artifacts" yaml:"artifacts"`
+	// Errors records the components that could not be resolved.
+	Errors map[Component]string `bson:"errors,omitempty" json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// Complete reports whether every component was resolved.
+func (t *Toolchain) Complete() bool { return len(t.Errors) == 0 }
+
+// Err returns an error describing the components that could not be
+// resolved, or nil if the toolchain is complete.
+func (t *Toolchain) Err() error {
+	if t.Complete() {
+		return nil
+	}
+
+	components := make([]string, 0, len(t.Errors))
+	for c := range t.Errors {
+		components = append(components, string(c))
+	}
+	sort.Strings(components)
+
+	catcher := grip.NewBasicCatcher()
+	for _, c := range components {
+		catcher.Add(errors.Errorf("%s: %s", c, t.Errors[Component(c)]))
+	}
+
+	return catcher.Resolve()
+}
+
+// FeedAggregator loads several component feeds concurrently and
+// resolves toolchains from them. A failure to load or resolve one
+// feed does not affect the others: the failure is recorded in the
+// Toolchain, alongside the components that did resolve.
+type FeedAggregator struct {
+	feeds []ComponentFeed
+
+	mutex  sync.RWMutex
+	failed map[Component]error
+}
+
+// NewFeedAggregator returns an aggregator for the feeds.
+func NewFeedAggregator(feeds ...ComponentFeed) *FeedAggregator {
+	return &FeedAggregator{feeds: feeds, failed: map[Component]error{}}
+}
+
+// NewDefaultFeedAggregator returns an aggregator for the
+// DefaultComponents (the server, database tools, and mongosh feeds),
+// cached in the directory. Call Populate to load the feeds. The
+// options apply to all of the feeds.
+func NewDefaultFeedAggregator(dir string, opts ...Option) (*FeedAggregator, error) {
+	return NewComponentFeedAggregator(dir, DefaultComponents, opts...)
+}
+
+// NewComponentFeedAggregator returns an aggregator for the feeds of
+// the components, cached in the directory. The server and
+// crypt_shared components share the server feed, which loads once.
+// Call Populate to load the feeds. The options apply to all of the
+// feeds.
+func NewComponentFeedAggregator(dir string, components []Component, opts ...Option) (*FeedAggregator, error) {
+	server, err := NewArtifactsFeed(dir, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem building server feed")
+	}
+
+	feeds := make([]ComponentFeed, 0, len(components))
+	seen := map[Component]bool{}
+	for _, c := range components {
+		if err = c.Validate(); err != nil {
+			return nil, err
+		}
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+
+		switch c {
+		case ServerComponent:
+			feeds = append(feeds, ServerFeed{server})
+		case CryptSharedComponent:
+			feeds = append(feeds, CryptSharedFeed{server})
+		case ToolsComponent:
+			tools := NewToolsFeed(server.dir)
+			tools.conf = server.conf
+			feeds = append(feeds, tools)
+		case ShellComponent:
+			shell := NewShellFeed(server.dir)
+			shell.conf = server.conf
+			feeds = append(feeds, shell)
+		}
+	}
+
+	return NewFeedAggregator(feeds...), nil
+}
+
+// Populate loads all of the feeds concurrently, and returns the errors
+// from the feeds that could not be loaded. Until a feed loads
+// successfully, toolchains report its error rather than resolving it.
+func (a *FeedAggregator) Populate(ctx context.Context, ttl time.Duration) map[Component]error {
+	wg := &sync.WaitGroup{}
+	for _, feed := range a.feeds {
+		wg.Add(1)
+		go func(feed ComponentFeed) {
+			defer wg.Done()
+			defer recovery.LogStackTraceAndContinue(fmt.Sprintf("populating %s feed", feed.Component()))
+
+			err := feed.Populate(ctx, ttl)
+
+			a.mutex.Lock()
+			defer a.mutex.Unlock()
+			if err != nil {
+				a.failed[feed.Component()] = err
+			} else {
+				delete(a.failed, feed.Component())
+			}
+		}(feed)
+	}
+	wg.Wait()
+
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+	out := map[Component]error{}
+	for c, err := range a.failed {
+		out[c] = err
+	}
+
+	return out
+}
+
+// Resolve returns the toolchain for the release and platform,
+// e.g. Resolve("4.0", opts) returns the current 4.0 server release
+// with the newest database tools and mongosh.
+func (a *FeedAggregator) Resolve(release string, opts BuildOptions) *Toolchain {
+	return a.ResolveVersions(release, opts, nil)
+}
+
+// ResolveVersions returns the toolchain for the release and platform,
+// with the versions of the components that the versions pin (e.g.
+// {ToolsComponent: "100.9"}). Components without a version resolve as
+// they do with Resolve, and pinned versions of feeds that are not
+// VersionedFeeds are errors.
+func (a *FeedAggregator) ResolveVersions(release string, opts BuildOptions, versions map[Component]string) *Toolchain {
+	out := &Toolchain{
+		Release:   release,
+		Options:   opts,
+		Artifacts: map[Component]ComponentArtifact{},
+		Errors:    map[Component]string{},
+	}
+
+	a.mutex.RLock()
+	defer a.mutex.RUnlock()
+
+	for _, feed := range a.feeds {
+		if err, ok := a.failed[feed.Component()]; ok {
+			out.Errors[feed.Component()] = err.Error()
+			continue
+		}
+
+		var (
+			artifact ComponentArtifact
+			err      error
+		)
+		if version, ok := versions[feed.Component()]; ok && version != "" {
+			vf, ok := feed.(VersionedFeed)
+			if !ok {
+				out.Errors[feed.Component()] = fmt.Sprintf("the %s feed cannot resolve version %s", feed.Component(), version)
+				continue
+			}
+			artifact, err = vf.ResolveVersion(version, opts)
+		} else {
+			artifact, err = feed.Resolve(release, opts)
+		}
+		if err != nil {
+			out.Errors[feed.Component()] = err.Error()
+			continue
+		}
+		out.Artifacts[feed.Component()] = artifact
+	}
+
+	return out
+}
@@ -0,0 +1,242 @@
+package bond
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	toolchainServerFeed = `{"versions": [
+  {"version": "4.0.2", "current": true, "downloads": [
+    {"target": "ubuntu1804", "arch": "x86_64", "edition": "enterprise", "archive": {"url": "https://example.net/server-4.0.2.tgz", "sha256": "abc"}}
+  ]},
+  {"version": "7.0.2", "current": true, "downloads": [
+    {"target": "ubuntu1804", "arch": "x86_64", "edition": "enterprise", "archive": {"url": "https://example.net/server-7.0.2.tgz"},
+     "crypt_shared": {"url": "https://example.net/mongo_crypt_shared_v1-7.0.2.tgz", "sha256": "123"}},
+    {"target": "ubuntu1804", "arch": "x86_64", "edition": "targeted", "archive": {"url": "https://example.net/server-targeted-7.0.2.tgz"}}
+  ]},
+  {"version": "4.0.1", "downloads": [
+    {"target": "ubuntu1804", "arch": "x86_64", "edition": "enterprise", "archive": {"url": "https://example.net/server-4.0.1.tgz"}}
+  ]}
+]}`
+	toolchainToolsFeed = `{"versions": [
+  {"version": "100.9.4", "downloads": [
+    {"name": "ubuntu1804", "arch": "x86_64", "archive": {"url": "https://example.net/tools-100.9.4.tgz", "sha256": "def"}}
+  ]},
+  {"version": "100.10.0", "downloads": [
+    {"name": "ubuntu1804", "arch": "x86_64", "archive": {"url": "https://example.net/tools-100.10.0.tgz"}}
+  ]},
+  {"version": "100.11.0-rc0", "downloads": [
+    {"name": "ubuntu1804", "arch": "x86_64", "archive": {"url": "https://example.net/tools-100.11.0-rc0.tgz"}}
+  ]}
+]}`
+	toolchainShellFeed = `{"versions": [
+  {"version": "2.1.1", "downloads": [
+    {"distro": "linux-x64", "arch": "x64", "archive": {"url": "https://example.net/mongosh-2.1.1-linux-x64.tgz"}},
+    {"distro": "darwin-arm64", "arch": "arm64", "archive": {"url": "https://example.net/mongosh-2.1.1-darwin-arm64.zip"}}
+  ]}
+]}`
+)
+
+type failingFeed struct {
+	component Component
+}
+
+func (f failingFeed) Component() Component { return f.component }
+func (f failingFeed) Populate(context.Context, time.Duration) error {
+	return errors.New("feed unavailable")
+}
+func (f failingFeed) Resolve(string, BuildOptions) (ComponentArtifact, error) {
+	return ComponentArtifact{}, errors.New("should not resolve a feed that failed to load")
+}
+
+func newToolchainFeeds(t *testing.T) (string, ServerFeed, *ToolFeed, *ToolFeed) {
+	dir, err := ioutil.TempDir("", "bond-toolchain")
+	require.NoError(t, err)
+
+	server, err := NewArtifactsFeed(dir)
+	require.NoError(t, err)
+	require.NoError(t, server.Reload([]byte(toolchainServerFeed)))
+
+	tools := NewToolsFeed(dir)
+	require.NoError(t, tools.Reload([]byte(toolchainToolsFeed)))
+
+	shell := NewShellFeed(dir)
+	require.NoError(t, shell.Reload([]byte(toolchainShellFeed)))
+
+	return dir, ServerFeed{server}, tools, shell
+}
+
+func TestToolchainResolvesEachComponent(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, server, tools, shell := newToolchainFeeds(t)
+	defer os.RemoveAll(dir)
+
+	opts := BuildOptions{Target: "ubuntu1804", Arch: AMD64, Edition: Enterprise}
+	tc := NewFeedAggregator(server, tools, shell).Resolve("4.0", opts)
+	require.True(t, tc.Complete(), "%v", tc.Errors)
+	assert.NoError(tc.Err())
+
+	assert.Equal(ComponentArtifact{
+		Component: ServerComponent,
+		Version:   "4.0.2",
+		URL:       "https://example.net/server-4.0.2.tgz",
+		SHA256:    "abc",
+	}, tc.Artifacts[ServerComponent])
+	assert.Equal("100.10.0", tc.Artifacts[ToolsComponent].Version)
+	assert.Equal("https://example.net/mongosh-2.1.1-linux-x64.tgz", tc.Artifacts[ShellComponent].URL)
+
+	tc = NewFeedAggregator(server, tools, shell).Resolve("4.0.1", opts)
+	assert.True(tc.Complete())
+	assert.Equal("4.0.1", tc.Artifacts[ServerComponent].Version)
+
+	tc = NewFeedAggregator(server, tools, shell).Resolve("4.0", BuildOptions{Target: "macos", Arch: "aarch64", Edition: Enterprise})
+	assert.False(tc.Complete())
+	assert.Len(tc.Artifacts, 1)
+	assert.Equal("https://example.net/mongosh-2.1.1-darwin-arm64.zip", tc.Artifacts[ShellComponent].URL)
+	assert.Contains(tc.Errors, ServerComponent)
+	assert.Contains(tc.Errors, ToolsComponent)
+	assert.Error(tc.Err())
+}
+
+func TestFeedAggregatorIsolatesFeedErrors(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	dir, server, _, shell := newToolchainFeeds(t)
+	defer os.RemoveAll(dir)
+
+	// a feed with a zero ttl always downloads, so use a failing
+	// feed for the tools, and load the others from the cache.
+	agg := NewFeedAggregator(failingFeed{ToolsComponent}, shell)
+	require.NoError(t, ioutil.WriteFile(shell.path, []byte(toolchainShellFeed), 0644))
+
+	errs := agg.Populate(ctx, time.Hour)
+	require.Len(t, errs, 1)
+	assert.Contains(errs[ToolsComponent].Error(), "feed unavailable")
+
+	tc := agg.Resolve("4.0", BuildOptions{Target: "ubuntu1804", Arch: AMD64})
+	assert.Contains(tc.Errors[ToolsComponent], "feed unavailable")
+	assert.Len(tc.Artifacts, 1)
+	assert.Contains(tc.Artifacts, ShellComponent)
+
+	assert.Equal(ServerComponent, server.Component())
+}
+
+func TestCryptSharedFeedResolvesEnterpriseLibrary(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, server, _, _ := newToolchainFeeds(t)
+	defer os.RemoveAll(dir)
+	crypt := CryptSharedFeed{server.ArtifactsFeed}
+	assert.Equal(CryptSharedComponent, crypt.Component())
+
+	// the edition does not matter: only enterprise builds publish
+	// the library
+	artifact, err := crypt.Resolve("7.0", BuildOptions{Target: "ubuntu1804", Arch: AMD64, Edition: CommunityTargeted})
+	require.NoError(t, err)
+	assert.Equal(ComponentArtifact{
+		Component: CryptSharedComponent,
+		Version:   "7.0.2",
+		URL:       "https://example.net/mongo_crypt_shared_v1-7.0.2.tgz",
+		SHA256:    "123",
+	}, artifact)
+
+	sums := server.Checksums(artifact.URL)
+	require.Len(t, sums, 1)
+	assert.Equal(Checksum{Algorithm: SHA256, Value: "123"}, sums[0])
+
+	_, err = crypt.Resolve("4.0", BuildOptions{Target: "ubuntu1804", Arch: AMD64})
+	assert.True(Is(err, ErrVersionNotFound))
+	_, err = crypt.ResolveVersion("7.0.2", BuildOptions{Target: "ubuntu1604", Arch: AMD64})
+	assert.Error(err)
+}
+
+func TestToolFeedResolvesVersions(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, _, tools, _ := newToolchainFeeds(t)
+	defer os.RemoveAll(dir)
+	opts := BuildOptions{Target: "ubuntu1804", Arch: AMD64}
+
+	for version, expected := range map[string]string{
+		"":             "100.10.0",
+		"100":          "100.10.0",
+		"100.9":        "100.9.4",
+		"100.9.4":      "100.9.4",
+		"100.11.0-rc0": "100.11.0-rc0",
+	} {
+		artifact, err := tools.ResolveVersion(version, opts)
+		require.NoError(t, err, version)
+		assert.Equal(expected, artifact.Version, version)
+	}
+
+	for _, version := range []string{"100.1", "100.11", "10"} {
+		_, err := tools.ResolveVersion(version, opts)
+		assert.True(Is(err, ErrVersionNotFound), version)
+	}
+}
+
+func TestFeedAggregatorResolvesPinnedVersions(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, server, tools, shell := newToolchainFeeds(t)
+	defer os.RemoveAll(dir)
+
+	opts := BuildOptions{Target: "ubuntu1804", Arch: AMD64, Edition: Enterprise}
+	agg := NewFeedAggregator(server, tools, shell, CryptSharedFeed{server.ArtifactsFeed}, failingFeed{"other"})
+
+	tc := agg.ResolveVersions("7.0", opts, map[Component]string{ToolsComponent: "100.9", CryptSharedComponent: "7.0.2", "other": "1.0"})
+	assert.Equal("7.0.2", tc.Artifacts[ServerComponent].Version)
+	assert.Equal("100.9.4", tc.Artifacts[ToolsComponent].Version)
+	assert.Equal("2.1.1", tc.Artifacts[ShellComponent].Version)
+	assert.Equal("7.0.2", tc.Artifacts[CryptSharedComponent].Version)
+	require.Len(t, tc.Errors, 1)
+	assert.Contains(tc.Errors["other"], "cannot resolve version")
+
+	tc = agg.ResolveVersions("7.0", opts, map[Component]string{ToolsComponent: "99"})
+	assert.Contains(tc.Errors, ToolsComponent)
+}
+
+func TestNewComponentFeedAggregator(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "bond-toolchain")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	agg, err := NewComponentFeedAggregator(dir, []Component{ServerComponent, CryptSharedComponent, ShellComponent, ShellComponent})
+	require.NoError(t, err)
+	require.Len(t, agg.feeds, 3)
+	assert.Equal(agg.feeds[0].(ServerFeed).ArtifactsFeed, agg.feeds[1].(CryptSharedFeed).ArtifactsFeed)
+
+	agg, err = NewDefaultFeedAggregator(dir)
+	require.NoError(t, err)
+	assert.Len(agg.feeds, len(DefaultComponents))
+
+	_, err = NewComponentFeedAggregator(dir, []Component{"compass"})
+	assert.Error(err)
+}
+
+func TestParseComponentVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	c, version, err := ParseComponentVersion("database-tools=100.9")
+	require.NoError(t, err)
+	assert.Equal(ToolsComponent, c)
+	assert.Equal("100.9", version)
+
+	for _, val := range []string{"", "mongosh", "mongosh=", "compass=1.0"} {
+		_, _, err = ParseComponentVersion(val)
+		assert.Error(err, val)
+	}
+}
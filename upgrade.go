@@ -0,0 +1,90 @@
+package bond
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// UpgradeSeries returns the release series that a deployment must
+// pass through when upgrading, in order: MongoDB only supports
+// upgrades from one major release series to the next, so each series
+// with lifecycle metadata is a required step. Rapid and development
+// releases are never steps.
+func UpgradeSeries() []string {
+	lifecycleMutex.RLock()
+	defer lifecycleMutex.RUnlock()
+
+	type step struct {
+		series string
+		parsed *MongoDBVersion
+	}
+
+	steps := make([]step, 0, len(lifecycles))
+	for series := range lifecycles {
+		parsed, err := NewMongoDBVersion(series + ".0")
+		if err != nil {
+			continue
+		}
+		steps = append(steps, step{series: series, parsed: parsed})
+	}
+	sort.Slice(steps, func(i, j int) bool { return steps[i].parsed.IsLessThan(steps[j].parsed) })
+
+	out := make([]string, len(steps))
+	for idx := range steps {
+		out[idx] = steps[idx].series
+	}
+
+	return out
+}
+
+// UpgradePath returns the series of each step of an upgrade from the
+// release or series to the other, not including the series that the
+// upgrade starts from (e.g. 4.4, 5.0, and 6.0 for an upgrade from 4.2
+// to 6.0). Use LoadLifecycles to add series that bond does not know
+// about.
+func UpgradePath(from, to string) ([]string, error) {
+	from, to = releaseSeries(from), releaseSeries(to)
+	series := UpgradeSeries()
+
+	start, end := -1, -1
+	for idx, s := range series {
+		switch s {
+		case from:
+			start = idx
+		case to:
+			end = idx
+		}
+	}
+
+	switch {
+	case start < 0:
+		return nil, errors.Errorf("%s is not a release series that upgrades start from", from)
+	case end < 0:
+		return nil, errors.Errorf("%s is not a release series that upgrades go to", to)
+	case end <= start:
+		return nil, errors.Errorf("%s is not an upgrade from %s", to, from)
+	}
+
+	return series[start+1 : end+1], nil
+}
+
+// UpgradePlan returns the newest release in the feed of each step of
+// an upgrade from one series to another, in the order of the upgrade.
+func (feed *ArtifactsFeed) UpgradePlan(from, to string) ([]*ArtifactVersion, error) {
+	path, err := UpgradePath(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := make([]*ArtifactVersion, 0, len(path))
+	for _, series := range path {
+		span, err := feed.Span(series+".0", series+".999")
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem finding the newest release of %s", series)
+		}
+		plan = append(plan, span[len(span)-1])
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,65 @@
+package bond
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgradePath(t *testing.T) {
+	assert := assert.New(t)
+
+	path, err := UpgradePath("4.2", "6.0")
+	require.NoError(t, err)
+	assert.Equal([]string{"4.4", "5.0", "6.0"}, path)
+
+	path, err = UpgradePath("3.4.24", "4.0.1")
+	require.NoError(t, err)
+	assert.Equal([]string{"3.6", "4.0"}, path)
+
+	path, err = UpgradePath("7.0", "8.0")
+	require.NoError(t, err)
+	assert.Equal([]string{"8.0"}, path)
+
+	_, err = UpgradePath("6.0", "4.2")
+	assert.Error(err)
+	_, err = UpgradePath("4.2", "4.2")
+	assert.Error(err)
+	_, err = UpgradePath("5.1", "6.0")
+	assert.Error(err)
+	_, err = UpgradePath("4.2", "6.3")
+	assert.Error(err)
+
+	series := UpgradeSeries()
+	assert.Equal("2.4", series[0])
+	for idx := 1; idx < len(series); idx++ {
+		prev, err := NewMongoDBVersion(series[idx-1] + ".0")
+		require.NoError(t, err)
+		next, err := NewMongoDBVersion(series[idx] + ".0")
+		require.NoError(t, err)
+		assert.True(prev.IsLessThan(next))
+	}
+}
+
+func TestFeedUpgradePlan(t *testing.T) {
+	assert := assert.New(t)
+
+	feed, err := NewArtifactsFeed("")
+	require.NoError(t, err)
+	defer os.RemoveAll(feed.dir)
+	require.NoError(t, feed.Reload([]byte(`{"versions": [
+  {"version": "6.0.2"}, {"version": "6.0.10"}, {"version": "6.1.0"}, {"version": "6.0.11-rc0"},
+  {"version": "5.0.3"}, {"version": "5.0.0"}, {"version": "5.3.1"},
+  {"version": "4.4.29"}, {"version": "4.4.30-2-g1234567"},
+  {"version": "4.2.25"}
+]}`)))
+
+	plan, err := feed.UpgradePlan("4.2", "6.0")
+	require.NoError(t, err)
+	assert.Equal([]string{"4.4.29", "5.0.3", "6.0.10"}, spanVersions(plan))
+
+	_, err = feed.UpgradePlan("6.0", "7.0")
+	assert.True(Is(err, ErrVersionNotFound))
+}
@@ -17,7 +17,7 @@ func init() {
 		New: func() interface{} {
 			return &http.Client{
 				Timeout: httpClientTimeout,
-				Transport: &http.Transport{
+				Transport: &taggingTransport{base: &http.Transport{
 					TLSClientConfig:     &tls.Config{},
 					Proxy:               http.ProxyFromEnvironment,
 					DisableCompression:  false,
@@ -30,7 +30,7 @@ func init() {
 						KeepAlive: 0,
 					}).Dial,
 					TLSHandshakeTimeout: 10 * time.Second,
-				},
+				}},
 			}
 		},
 	}
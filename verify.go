@@ -0,0 +1,329 @@
+package bond
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tychoish/bond/subprocess"
+)
+
+// Artifact is a downloaded archive, as verifiers see it.
+type Artifact struct {
+	// Path is the archive on disk.
+	Path string
+	// URL is the address the archive was downloaded from.
+	URL string
+	// Checksums are the checksums that the feed publishes for the
+	// archive, if any.
+	Checksums []Checksum
+	// Size is the expected size of the archive in bytes, or zero
+	// if it's not known.
+	Size int64
+	// Verified is the checksum that verified the archive, which
+	// verifiers that check checksums set.
+	Verified Checksum
+
+	conf *Config
+}
+
+// Verifier is a step of the verification of downloaded archives,
+// which runs after the download and before the archive is extracted.
+// Verifiers return an error wrapping ErrVerificationFailed (or
+// ErrChecksumMismatch) if the archive is not valid, and
+// ErrVerificationSkipped if they have nothing to check.
+type Verifier interface {
+	Name() string
+	Verify(context.Context, *Artifact) error
+}
+
+type verifierFunc struct {
+	name string
+	fn   func(context.Context, *Artifact) error
+}
+
+// NewVerifier returns a Verifier that calls the function, for
+// validation steps that run in-process.
+func NewVerifier(name string, fn func(context.Context, *Artifact) error) Verifier {
+	return &verifierFunc{name: name, fn: fn}
+}
+
+func (v *verifierFunc) Name() string                                  { return v.name }
+func (v *verifierFunc) Verify(ctx context.Context, a *Artifact) error { return v.fn(ctx, a) }
+
+// DefaultVerifiers returns the verifiers of a Config that does not
+// specify any: a SizeVerifier and a ChecksumVerifier.
+func DefaultVerifiers() []Verifier {
+	return []Verifier{&SizeVerifier{}, &ChecksumVerifier{}}
+}
+
+// GetVerifiers returns the verification pipeline of the Config.
+func (c *Config) GetVerifiers() []Verifier {
+	if c == nil || c.Verifiers == nil {
+		return DefaultVerifiers()
+	}
+
+	return c.Verifiers
+}
+
+// Verify runs the Config's verifiers on the archive, in order, and
+// stops at the first that fails. The returned Verification names the
+// verifiers that checked the archive, and is suitable for
+// WriteVerification.
+func (c *Config) Verify(ctx context.Context, a *Artifact) (Verification, error) {
+	a.conf = c
+	out := Verification{Verifiers: []string{}}
+
+	for _, v := range c.GetVerifiers() {
+		err := v.Verify(ctx, a)
+		if Is(err, ErrVerificationSkipped) {
+			out.Skipped = append(out.Skipped, v.Name())
+			continue
+		}
+		if err != nil {
+			return out, errors.Wrapf(err, "%s verification of %s failed", v.Name(), a.Path)
+		}
+		out.Verifiers = append(out.Verifiers, v.Name())
+	}
+
+	out.Checksum = a.Verified
+	out.Verified = time.Now()
+
+	return out, nil
+}
+
+// SizeVerifier checks that the archive is not empty, has the expected
+// size, when it's known, and is within the bounds, if specified.
+type SizeVerifier struct {
+	MinSize int64
+	MaxSize int64
+}
+
+// Name returns "size".
+func (v *SizeVerifier) Name() string { return "size" }
+
+// Verify checks the size of the archive.
+func (v *SizeVerifier) Verify(_ context.Context, a *Artifact) error {
+	info, err := os.Stat(a.Path)
+	if err != nil {
+		return errors.Wrapf(err, "problem reading %s", a.Path)
+	}
+	size := info.Size()
+
+	switch {
+	case size == 0:
+		return errors.Wrapf(ErrVerificationFailed, "%s is empty", a.Path)
+	case a.Size > 0 && size != a.Size:
+		return errors.Wrapf(ErrVerificationFailed, "%s has %d bytes, expected %d", a.Path, size, a.Size)
+	case v.MinSize > 0 && size < v.MinSize:
+		return errors.Wrapf(ErrVerificationFailed, "%s has %d bytes, fewer than %d", a.Path, size, v.MinSize)
+	case v.MaxSize > 0 && size > v.MaxSize:
+		return errors.Wrapf(ErrVerificationFailed, "%s has %d bytes, more than %d", a.Path, size, v.MaxSize)
+	}
+
+	return nil
+}
+
+// ChecksumVerifier checks the archive against the strongest of its
+// published checksums, and sets the artifact's verified checksum.
+type ChecksumVerifier struct {
+	// Required fails archives that have no published checksums,
+	// rather than skipping them.
+	Required bool
+}
+
+// Name returns "checksum".
+func (v *ChecksumVerifier) Name() string { return "checksum" }
+
+// Verify checks the archive's checksum.
+func (v *ChecksumVerifier) Verify(_ context.Context, a *Artifact) error {
+	if len(a.Checksums) == 0 {
+		if v.Required {
+			return errors.Wrapf(ErrVerificationFailed, "no checksums are published for %s", a.URL)
+		}
+		return ErrVerificationSkipped
+	}
+
+	sum, err := VerifyFile(a.Path, a.Checksums)
+	if err != nil {
+		return err
+	}
+	a.Verified = sum
+
+	return nil
+}
+
+// SignatureSuffix is the suffix of the URLs and files of detached
+// archive signatures.
+const SignatureSuffix = ".sig"
+
+// SignatureVerifier checks the detached Ed25519ph signature of the
+// archive: an ed25519 signature, in the pre-hashed variant of RFC
+// 8032, of the archive's SHA-512 digest, which publishers create with
+// ed25519.PrivateKey.Sign and ed25519.Options{Hash: crypto.SHA512}.
+// The archive is read once, to compute its digest, so verifying
+// large archives doesn't hold them in memory.
+//
+// The signature, raw or base64 encoded, is read from the archive's
+// path with SignatureSuffix or, if that file does not exist,
+// downloaded from the archive's URL with SignatureSuffix.
+type SignatureVerifier struct {
+	PublicKey ed25519.PublicKey
+}
+
+// Name returns "signature".
+func (v *SignatureVerifier) Name() string { return "signature" }
+
+// Verify checks the archive's signature.
+func (v *SignatureVerifier) Verify(ctx context.Context, a *Artifact) error {
+	if len(v.PublicKey) != ed25519.PublicKeySize {
+		return errors.Errorf("public key has %d bytes, not %d", len(v.PublicKey), ed25519.PublicKeySize)
+	}
+
+	sig, err := readSignature(ctx, a)
+	if err != nil {
+		return err
+	}
+
+	digest, err := fileDigest(a.Path)
+	if err != nil {
+		return err
+	}
+
+	if err = ed25519.VerifyWithOptions(v.PublicKey, digest, sig, &ed25519.Options{Hash: crypto.SHA512}); err != nil {
+		return errors.Wrapf(ErrVerificationFailed, "%s does not match its signature", a.Path)
+	}
+
+	return nil
+}
+
+// fileDigest returns the SHA-512 digest of the file, which Ed25519ph
+// signatures sign.
+func fileDigest(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem opening %s", path)
+	}
+	defer f.Close()
+
+	h := sha512.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, errors.Wrapf(err, "problem reading %s", path)
+	}
+
+	return h.Sum(nil), nil
+}
+
+func readSignature(ctx context.Context, a *Artifact) ([]byte, error) {
+	data, err := ioutil.ReadFile(a.Path + SignatureSuffix)
+	if os.IsNotExist(err) {
+		data, err = fetchSignature(ctx, a.conf, a.URL+SignatureSuffix)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == ed25519.SignatureSize {
+		return data, nil
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, errors.Wrapf(ErrVerificationFailed, "signature of %s is not valid", a.Path)
+	}
+
+	return sig, nil
+}
+
+func fetchSignature(ctx context.Context, conf *Config, url string) ([]byte, error) {
+	client, release := conf.Client()
+	defer release()
+
+	req, err := http.NewRequest(http.MethodGet, conf.MirrorURL(url), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "problem building request")
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem downloading signature %s", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Wrapf(ErrVerificationFailed, "signature %s is not available (%s)", url, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	return data, errors.Wrapf(err, "problem reading signature %s", url)
+}
+
+// CommandVerifier runs an external program, such as a malware
+// scanner, on the archive. The program is run with its arguments
+// followed by the archive's path, and with the BOND_ARCHIVE_URL
+// environment variable set to the archive's URL; it fails the
+// archive by exiting with a non-zero status.
+type CommandVerifier struct {
+	Label   string
+	Command []string
+	// Timeout limits the run time of the program, and defaults to
+	// five minutes.
+	Timeout time.Duration
+}
+
+// Name returns the label of the verifier, or the name of its program.
+func (v *CommandVerifier) Name() string {
+	if v.Label != "" {
+		return v.Label
+	}
+	if len(v.Command) > 0 {
+		return v.Command[0]
+	}
+	return "command"
+}
+
+// Verify runs the program on the archive.
+func (v *CommandVerifier) Verify(ctx context.Context, a *Artifact) error {
+	if len(v.Command) == 0 {
+		return errors.New("command verifier has no command")
+	}
+
+	out, err := runArchiveCommand(ctx, v.Command, v.Timeout, a)
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return errors.Wrapf(ErrVerificationFailed, "%s rejected %s: %s",
+				v.Name(), a.Path, strings.TrimSpace(string(out)))
+		}
+		return errors.Wrapf(err, "problem running %s", v.Name())
+	}
+
+	return nil
+}
+
+// runArchiveCommand runs the program of a CommandVerifier or a
+// CommandProcessor on the archive, and returns its output.
+func runArchiveCommand(ctx context.Context, command []string, timeout time.Duration, a *Artifact) ([]byte, error) {
+	if timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args := append(append([]string{}, command[1:]...), a.Path)
+	cmd := exec.Command(command[0], args...)
+	cmd.Env = append(os.Environ(), "BOND_ARCHIVE_URL="+a.URL)
+
+	// programs that time out are stopped along with any processes
+	// that they started
+	return subprocess.Run(ctx, cmd, subprocess.DefaultGracePeriod)
+}
@@ -0,0 +1,159 @@
+package bond
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerificationPipeline(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "bond-verify")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "archive.tgz")
+	require.NoError(t, ioutil.WriteFile(fn, []byte("archive"), 0644))
+	sum, err := FileChecksum(fn, SHA256)
+	require.NoError(t, err)
+
+	// the default pipeline checks the size, and skips the checksum
+	// when none are published
+	v, err := NewConfig().Verify(ctx, &Artifact{Path: fn})
+	require.NoError(t, err)
+	assert.Equal([]string{"size"}, v.Verifiers)
+
+	var nilConf *Config
+	v, err = nilConf.Verify(ctx, &Artifact{Path: fn, Checksums: []Checksum{sum}})
+	require.NoError(t, err)
+	assert.Equal([]string{"size", "checksum"}, v.Verifiers)
+	assert.Equal(sum, v.Checksum)
+
+	_, err = NewConfig().Verify(ctx, &Artifact{Path: fn, Checksums: []Checksum{{Algorithm: SHA256, Value: "00"}}})
+	assert.True(Is(err, ErrChecksumMismatch))
+	_, err = NewConfig().Verify(ctx, &Artifact{Path: fn, Size: 100})
+	assert.True(Is(err, ErrVerificationFailed))
+
+	conf := NewConfig(WithVerifiers(&SizeVerifier{MaxSize: 3}))
+	_, err = conf.Verify(ctx, &Artifact{Path: fn})
+	assert.True(Is(err, ErrVerificationFailed))
+
+	conf = NewConfig(WithVerifiers(&ChecksumVerifier{Required: true}))
+	_, err = conf.Verify(ctx, &Artifact{Path: fn})
+	assert.True(Is(err, ErrVerificationFailed))
+
+	// verifiers run in order, and the pipeline stops at the first
+	// that fails
+	calls := []string{}
+	conf = NewConfig(WithVerifiers(
+		NewVerifier("first", func(context.Context, *Artifact) error { calls = append(calls, "first"); return nil }),
+		NewVerifier("scanner", func(context.Context, *Artifact) error {
+			calls = append(calls, "scanner")
+			return errors.Wrap(ErrVerificationFailed, "infected")
+		}),
+		NewVerifier("last", func(context.Context, *Artifact) error { calls = append(calls, "last"); return nil }),
+	))
+	_, err = conf.Verify(ctx, &Artifact{Path: fn})
+	require.Error(t, err)
+	assert.Contains(err.Error(), "scanner verification")
+	assert.Equal([]string{"first", "scanner"}, calls)
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "bond-verify-signature")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	sign := func(data string) []byte {
+		digest := sha512.Sum512([]byte(data))
+		out, err := priv.Sign(nil, digest[:], &ed25519.Options{Hash: crypto.SHA512})
+		require.NoError(t, err)
+		return out
+	}
+
+	fn := filepath.Join(dir, "archive.tgz")
+	require.NoError(t, ioutil.WriteFile(fn, []byte("archive"), 0644))
+	sig := base64.StdEncoding.EncodeToString(sign("archive"))
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/archive.tgz.sig" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(sig))
+	}))
+	defer srv.Close()
+
+	conf := NewConfig(WithVerifiers(&SignatureVerifier{PublicKey: pub}))
+	_, err = conf.Verify(ctx, &Artifact{Path: fn, URL: srv.URL + "/archive.tgz"})
+	assert.NoError(err)
+	_, err = conf.Verify(ctx, &Artifact{Path: fn, URL: srv.URL + "/other.tgz"})
+	assert.True(Is(err, ErrVerificationFailed))
+
+	// a signature next to the archive is used before the URL
+	require.NoError(t, ioutil.WriteFile(fn+SignatureSuffix, sign("other"), 0644))
+	_, err = conf.Verify(ctx, &Artifact{Path: fn, URL: srv.URL + "/archive.tgz"})
+	assert.True(Is(err, ErrVerificationFailed))
+
+	// signatures of the archive itself, rather than of its digest,
+	// are not valid
+	require.NoError(t, ioutil.WriteFile(fn+SignatureSuffix, ed25519.Sign(priv, []byte("archive")), 0644))
+	_, err = conf.Verify(ctx, &Artifact{Path: fn})
+	assert.True(Is(err, ErrVerificationFailed))
+	require.NoError(t, ioutil.WriteFile(fn+SignatureSuffix, sign("archive"), 0644))
+	_, err = conf.Verify(ctx, &Artifact{Path: fn})
+	assert.NoError(err)
+}
+
+func TestCommandVerifier(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test uses a POSIX shell")
+	}
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	dir, err := ioutil.TempDir("", "bond-verify-command")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "archive.tgz")
+	require.NoError(t, ioutil.WriteFile(fn, []byte("archive"), 0644))
+
+	clean := &CommandVerifier{Label: "scanner", Command: []string{"sh", "-c", `test -f "$0" && test -n "$BOND_ARCHIVE_URL"`}}
+	assert.Equal("scanner", clean.Name())
+	assert.NoError(clean.Verify(ctx, &Artifact{Path: fn, URL: "https://example.net/archive.tgz"}))
+
+	infected := &CommandVerifier{Command: []string{"sh", "-c", "echo infected; exit 1"}}
+	assert.Equal("sh", infected.Name())
+	err = infected.Verify(ctx, &Artifact{Path: fn})
+	require.Error(t, err)
+	assert.True(Is(err, ErrVerificationFailed))
+	assert.Contains(err.Error(), "infected")
+
+	err = (&CommandVerifier{Command: []string{filepath.Join(dir, "missing")}}).Verify(ctx, &Artifact{Path: fn})
+	require.Error(t, err)
+	assert.False(Is(err, ErrVerificationFailed))
+	assert.Error((&CommandVerifier{}).Verify(ctx, &Artifact{Path: fn}))
+}
@@ -39,7 +39,8 @@ func (version *ArtifactVersion) refresh() {
 // given a BuildOptions object.
 func (version *ArtifactVersion) GetDownload(key BuildOptions) (ArtifactDownload, error) {
 	version.mutex.RLock()
-	defer version.mutex.RLock()
+	defer version.mutex.RUnlock()
+	requested := key
 
 	// TODO: this is the place to fix hanlding for the Base edition, which is not necessarily intuitive.
 	if key.Edition == Base {
@@ -70,11 +71,10 @@ func (version *ArtifactVersion) GetDownload(key BuildOptions) (ArtifactDownload,
 
 	dl, ok := version.table[key]
 	if !ok {
-		return ArtifactDownload{}, errors.Errorf("there is no build for %s (%s) in edition %s",
-			key.Target, key.Arch, key.Edition)
+		return ArtifactDownload{}, errors.WithStack(version.newBuildNotFoundError(requested, key))
 	}
 
-	return dl, nil
+	return overrideDownload(version.Version, requested, dl), nil
 }
 
 // GetBuildTypes builds, from an ArtifactsVersion object a BuildTypes